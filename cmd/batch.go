@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// manifestEntry is one image of a batch manifest. Columns/fields other than the
+// known ones are carried as request metadata.
+type manifestEntry struct {
+	Line       int
+	ImageID    string
+	OriginPath string
+	Version    string
+	Metadata   map[string]string
+}
+
+// batchResult is one row of the batch report
+type batchResult struct {
+	Entry   manifestEntry
+	Status  string
+	EventID string
+	Err     error
+}
+
+// runBatch publishes a processing request for every image of a CSV or JSONL manifest
+func runBatch(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("batch", flag.ExitOnError)
+	manifestPath := fset.String("manifest", "", "CSV (with header) or JSONL manifest (required)")
+	fset.StringVar(manifestPath, "m", "", "Manifest path (shorthand)")
+	version := fset.String("version", "v2", "Processing version for entries without processing_version")
+	rate := fset.Float64("rate", 5, "Requests published per second (0 = unlimited)")
+	verify := fset.Bool("verify", false, "Check that each origin path exists on the input mount before publishing")
+	force := fset.Bool("force", false, "Mark requests as forced (reprocess images that already have outputs)")
+	dryRun := fset.Bool("dry-run", false, "Parse and verify the manifest without publishing")
+	tenant := fset.String("tenant", "", "Tenant of all entries (multi-tenant deployments, see TENANT_ROUTING_FILE)")
+	reportPath := fset.String("report", "", "Report CSV path (default <manifest>.report.csv)")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+	logFormat := fset.String("log-format", "text", "Log format (text or json)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc batch [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Publish a processing request for every image of a manifest.\n\n")
+		fmt.Fprintf(os.Stderr, "The manifest needs an origin_path column/field (relative to the input mount);\n")
+		fmt.Fprintf(os.Stderr, "image_id (default: file name without extension) and processing_version are\n")
+		fmt.Fprintf(os.Stderr, "optional, every other column/field is passed on as request metadata.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc batch -m ./tcga-brca.csv --rate 10 --verify\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *manifestPath == "" {
+		fset.Usage()
+		return fmt.Errorf("--manifest is required")
+	}
+	if *version != "v1" && *version != "v2" {
+		return fmt.Errorf("invalid --version %q, expected v1 or v2", *version)
+	}
+	if *rate < 0 {
+		return fmt.Errorf("--rate must not be negative")
+	}
+	if *reportPath == "" {
+		*reportPath = strings.TrimSuffix(*manifestPath, filepath.Ext(*manifestPath)) + ".report.csv"
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: *logFormat,
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ApplyTenant(*tenant); err != nil {
+		return err
+	}
+
+	entries, err := readManifest(*manifestPath, *version)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("manifest %s has no entries", *manifestPath)
+	}
+
+	var cnt *container.Container
+	if !*dryRun {
+		// The local publisher would write every request over the images' result.json
+		if !cfg.UsesPubSub() {
+			return fmt.Errorf("publishing needs a cloud environment or PUBSUB_EMULATOR_HOST (APP_ENV=%s), use --dry-run to check the manifest", cfg.Env)
+		}
+		cnt, err = container.New(ctx, cfg, log)
+		if err != nil {
+			return fmt.Errorf("failed to initialize container: %w", err)
+		}
+		defer func() {
+			if err := cnt.Close(); err != nil {
+				log.Error("Failed to close container", "error", err)
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if *rate > 0 && !*dryRun {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	if *dryRun {
+		fmt.Fprintf(os.Stderr, "Checking %d manifest entries\n", len(entries))
+	} else {
+		fmt.Fprintf(os.Stderr, "Publishing %d requests to %s\n", len(entries), cfg.ImageRequestTopicID)
+	}
+
+	startedAt := time.Now()
+	seen := make(map[string]int, len(entries))
+	results := make([]batchResult, 0, len(entries))
+	failed := 0
+	for i, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := batchResult{Entry: entry, Status: "published"}
+		switch {
+		case seen[entry.ImageID] > 0:
+			result.Status = "failed"
+			result.Err = fmt.Errorf("duplicate image ID, first seen on line %d", seen[entry.ImageID])
+		case *verify && !fileExistsAt(filepath.Join(cfg.Storage.InputMountPath, entry.OriginPath)):
+			result.Status = "failed"
+			result.Err = fmt.Errorf("origin path not found on the input mount")
+		case *dryRun:
+			result.Status = "ok"
+		default:
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+				}
+			}
+			request := &events.ImageProcessRequestEvent{
+				BaseEvent:         events.NewBaseEvent(events.ImageProcessRequestEventType),
+				ImageID:           entry.ImageID,
+				OriginPath:        entry.OriginPath,
+				ProcessingVersion: entry.Version,
+				BucketName:        cfg.GCP.InputBucketName,
+				Tenant:            cfg.Tenant,
+				Force:             *force,
+				Metadata:          entry.Metadata,
+			}
+			result.EventID = request.EventID
+			if err := publishRequest(ctx, cnt, request); err != nil {
+				result.Status = "failed"
+				result.Err = err
+			}
+		}
+		if _, ok := seen[entry.ImageID]; !ok {
+			seen[entry.ImageID] = entry.Line
+		}
+		if result.Status == "failed" {
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] failed %s: %v\n", i+1, len(entries), entry.ImageID, result.Err)
+		} else if (i+1)%100 == 0 || i+1 == len(entries) {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s elapsed, %d failed\n", i+1, len(entries), time.Since(startedAt).Round(time.Second), failed)
+		}
+		results = append(results, result)
+	}
+
+	if err := writeBatchReport(*reportPath, results); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Done: %d ok, %d failed, report written to %s\n", len(results)-failed, failed, *reportPath)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d requests failed", failed, len(results))
+	}
+	return nil
+}
+
+// readManifest reads a .jsonl/.ndjson manifest or, for any other extension, a CSV manifest
+func readManifest(manifestPath, defaultVersion string) ([]manifestEntry, error) {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer f.Close()
+
+	var entries []manifestEntry
+	switch strings.ToLower(filepath.Ext(manifestPath)) {
+	case ".jsonl", ".ndjson":
+		entries, err = readJSONLManifest(f)
+	default:
+		entries, err = readCSVManifest(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", manifestPath, err)
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if entry.OriginPath == "" {
+			return nil, fmt.Errorf("invalid manifest %s: line %d has no origin_path", manifestPath, entry.Line)
+		}
+		if entry.ImageID == "" {
+			base := path.Base(filepath.ToSlash(entry.OriginPath))
+			entry.ImageID = strings.TrimSuffix(base, path.Ext(base))
+		}
+		if err := model.ValidateRelativePath("origin_path", entry.OriginPath); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: line %d: %w", manifestPath, entry.Line, err)
+		}
+		if err := model.ValidateImageID(entry.ImageID); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: line %d: %w", manifestPath, entry.Line, err)
+		}
+		if err := model.ValidateMetadata(entry.Metadata); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: line %d: %w", manifestPath, entry.Line, err)
+		}
+		if entry.Version == "" {
+			entry.Version = defaultVersion
+		}
+		if entry.Version != "v1" && entry.Version != "v2" {
+			return nil, fmt.Errorf("invalid manifest %s: line %d has processing_version %q", manifestPath, entry.Line, entry.Version)
+		}
+	}
+	return entries, nil
+}
+
+func readCSVManifest(r io.Reader) ([]manifestEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var entries []manifestEntry
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				fields[name] = strings.TrimSpace(record[i])
+			}
+		}
+		entries = append(entries, newManifestEntry(line, fields))
+	}
+	return entries, nil
+}
+
+func readJSONLManifest(r io.Reader) ([]manifestEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var entries []manifestEntry
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(text), &raw); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		fields := make(map[string]string, len(raw))
+		for name, value := range raw {
+			if value == nil {
+				continue
+			}
+			if s, ok := value.(string); ok {
+				fields[strings.ToLower(name)] = s
+			} else {
+				fields[strings.ToLower(name)] = fmt.Sprint(value)
+			}
+		}
+		entries = append(entries, newManifestEntry(line, fields))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func newManifestEntry(line int, fields map[string]string) manifestEntry {
+	entry := manifestEntry{
+		Line:       line,
+		ImageID:    fields["image_id"],
+		OriginPath: fields["origin_path"],
+		Version:    fields["processing_version"],
+	}
+	delete(fields, "image_id")
+	delete(fields, "origin_path")
+	delete(fields, "processing_version")
+	for name, value := range fields {
+		if value == "" {
+			delete(fields, name)
+		}
+	}
+	if len(fields) > 0 {
+		entry.Metadata = fields
+	}
+	return entry
+}
+
+func writeBatchReport(reportPath string, results []batchResult) error {
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"line", "image_id", "origin_path", "processing_version", "status", "event_id", "error"})
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		w.Write([]string{
+			fmt.Sprintf("%d", r.Entry.Line),
+			r.Entry.ImageID,
+			r.Entry.OriginPath,
+			r.Entry.Version,
+			r.Status,
+			r.EventID,
+			errText,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
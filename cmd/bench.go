@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// benchCase is one combination of the settings matrix
+type benchCase struct {
+	TileSize    int
+	Suffix      string
+	Quality     int
+	Concurrency int
+}
+
+// benchResult is the outcome of a benchCase averaged over all runs
+type benchResult struct {
+	Case     benchCase
+	Duration time.Duration
+	Tiles    int
+	Bytes    int64
+	Err      error
+}
+
+// runBench tiles a slide with every combination of the given settings and prints
+// a comparison table, to pick production defaults on real data
+func runBench(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("bench", flag.ExitOnError)
+	inputPath := fset.String("input", "", "Path to the slide to tile (required)")
+	fset.StringVar(inputPath, "i", "", "Path to the slide to tile (shorthand)")
+	workDir := fset.String("work-dir", "", "Directory for the temporary pyramids (default system temp dir)")
+	tileSizes := fset.String("tile-sizes", "256,512", "Comma-separated tile sizes")
+	suffixes := fset.String("suffixes", "jpg", "Comma-separated tile formats (jpg, png, webp)")
+	qualities := fset.String("qualities", "75,85", "Comma-separated tile qualities")
+	concurrency := fset.String("concurrency", "1,4", "Comma-separated vips thread counts")
+	runs := fset.Int("runs", 1, "Runs per combination, durations are averaged")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc bench [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Tile a slide with a matrix of DZI settings and compare durations and output sizes.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc bench -i ./slide.svs --tile-sizes 256,512 --qualities 80,90 --concurrency 2,4\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *inputPath == "" {
+		fset.Usage()
+		return fmt.Errorf("--input is required")
+	}
+	if *runs <= 0 {
+		return fmt.Errorf("--runs must be positive")
+	}
+
+	cases, err := benchMatrix(*tileSizes, *suffixes, *qualities, *concurrency)
+	if err != nil {
+		return err
+	}
+
+	absInput, err := filepath.Abs(*inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve input path: %w", err)
+	}
+	if _, err := os.Stat(absInput); err != nil {
+		return fmt.Errorf("input file does not exist: %s", absInput)
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	root, err := os.MkdirTemp(*workDir, "himgproc-bench-")
+	if err != nil {
+		return fmt.Errorf("failed to create bench directory: %w", err)
+	}
+	defer os.RemoveAll(root)
+
+	vips := processors.NewVipsProcessor(log)
+
+	fmt.Fprintf(os.Stderr, "Benchmarking %s: %d combinations x %d runs\n", filepath.Base(absInput), len(cases), *runs)
+
+	results := make([]benchResult, 0, len(cases))
+	for i, c := range cases {
+		fmt.Fprintf(os.Stderr, "[%d/%d] tile=%d suffix=%s quality=%d concurrency=%d\n",
+			i+1, len(cases), c.TileSize, c.Suffix, c.Quality, c.Concurrency)
+
+		result := runBenchCase(ctx, vips, cfg, absInput, root, c, *runs)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		results = append(results, result)
+	}
+
+	printBenchResults(results)
+	return nil
+}
+
+func runBenchCase(ctx context.Context, vips *processors.VipsProcessor, cfg *config.Config, inputPath, root string, c benchCase, runs int) benchResult {
+	result := benchResult{Case: c}
+
+	dziConfig := cfg.DZIConfig
+	dziConfig.TileSize = c.TileSize
+	dziConfig.Suffix = c.Suffix
+	dziConfig.Quality = c.Quality
+
+	vips.SetResourceLimits(c.Concurrency, cfg.Memory.VipsCacheMB, cfg.Memory.VipsDiscMB)
+
+	var total time.Duration
+	for run := 0; run < runs; run++ {
+		outDir := filepath.Join(root, fmt.Sprintf("t%d_%s_q%d_c%d_r%d", c.TileSize, c.Suffix, c.Quality, c.Concurrency, run))
+		outputBase := filepath.Join(outDir, "image")
+
+		startedAt := time.Now()
+		_, err := vips.CreateDZI(ctx, inputPath, outputBase, cfg.ImageProcessTimeoutMinute.DZIConversion, dziConfig, "fs", nil)
+		total += time.Since(startedAt)
+		if err != nil {
+			result.Err = err
+			os.RemoveAll(outDir)
+			return result
+		}
+
+		// Output is identical across runs, measure it once
+		if run == 0 {
+			result.Tiles, result.Bytes, err = measurePyramid(outputBase+"_files", c.Suffix)
+			if err != nil {
+				result.Err = err
+			}
+		}
+		os.RemoveAll(outDir)
+	}
+
+	result.Duration = total / time.Duration(runs)
+	return result
+}
+
+// measurePyramid counts the tiles and bytes of an fs-container pyramid
+func measurePyramid(filesDir, suffix string) (int, int64, error) {
+	tiles := 0
+	var size int64
+	err := filepath.WalkDir(filesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), "."+suffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		tiles++
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to measure pyramid: %w", err)
+	}
+	return tiles, size, nil
+}
+
+func printBenchResults(results []benchResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TILE\tSUFFIX\tQUALITY\tCONCURRENCY\tDURATION\tTILES\tSIZE MB\tAVG TILE KB\t")
+	for _, r := range results {
+		c := r.Case
+		if r.Err != nil {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%d\tfailed: %v\t\t\t\t\n", c.TileSize, c.Suffix, c.Quality, c.Concurrency, r.Err)
+			continue
+		}
+		avgKB := 0.0
+		if r.Tiles > 0 {
+			avgKB = float64(r.Bytes) / float64(r.Tiles) / 1024
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%d\t%.1f\t%.1f\t\n",
+			c.TileSize, c.Suffix, c.Quality, c.Concurrency,
+			r.Duration.Round(time.Millisecond),
+			r.Tiles,
+			float64(r.Bytes)/(1<<20),
+			avgKB)
+	}
+	w.Flush()
+}
+
+// benchMatrix expands the comma-separated setting lists into every combination
+func benchMatrix(tileSizes, suffixes, qualities, concurrency string) ([]benchCase, error) {
+	sizes, err := parseIntList("tile-sizes", tileSizes)
+	if err != nil {
+		return nil, err
+	}
+	qs, err := parseIntList("qualities", qualities)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := parseIntList("concurrency", concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var formats []string
+	for _, s := range strings.Split(suffixes, ",") {
+		if s = strings.TrimPrefix(strings.TrimSpace(s), "."); s != "" {
+			formats = append(formats, s)
+		}
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("--suffixes needs at least one value")
+	}
+
+	var cases []benchCase
+	for _, size := range sizes {
+		for _, format := range formats {
+			for _, q := range qs {
+				for _, t := range threads {
+					cases = append(cases, benchCase{TileSize: size, Suffix: format, Quality: q, Concurrency: t})
+				}
+			}
+		}
+	}
+	return cases, nil
+}
+
+func parseIntList(name, value string) ([]int, error) {
+	var values []int
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid --%s value %q", name, s)
+		}
+		values = append(values, n)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("--%s needs at least one value", name)
+	}
+	return values, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+// runConfig dispatches the config subcommands
+func runConfig(ctx context.Context, args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc config init [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Write a commented .env template with every supported setting.\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("missing config subcommand")
+	}
+	switch args[0] {
+	case "init":
+		return runConfigInit(args[1:])
+	default:
+		usage()
+		return fmt.Errorf("unknown config subcommand %q", args[0])
+	}
+}
+
+// runConfigInit writes the .env template of an environment profile
+func runConfigInit(args []string) error {
+	fset := flag.NewFlagSet("config init", flag.ExitOnError)
+	env := fset.String("env", string(config.EnvLocal), "Environment profile whose defaults are used (LOCAL, DEV or PROD)")
+	output := fset.String("output", ".env", "File to write, - for stdout")
+	fset.StringVar(output, "o", ".env", "File to write (shorthand)")
+	force := fset.Bool("force", false, "Overwrite an existing file")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc config init [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Write a commented .env template with every supported setting and the\n")
+		fmt.Fprintf(os.Stderr, "defaults of an environment profile.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc config init --env PROD -o ./prod.env\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := config.WriteTemplate(&buf, config.Environment(strings.ToUpper(*env))); err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(*output, flags, 0644)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", *output)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s configuration template to %s\n", strings.ToUpper(*env), *output)
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/imagehash"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runDiff compares two processed outputs of the same image, e.g. from the deployed and
+// a candidate vips version, and fails when they diverge
+func runDiff(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("diff", flag.ExitOnError)
+	outputRoot := fset.String("output-root", "", "Output root image IDs are resolved against (default OUTPUT_MOUNT_PATH)")
+	outputRootB := fset.String("output-root-b", "", "Output root the second image ID is resolved against (default --output-root)")
+	samples := fset.Int("samples", 8, "Tiles sampled per level in addition to the corner and center tiles")
+	maxDistance := fset.Int("max-distance", imagehash.DefaultMaxDistance, "Tile hash bits that may differ")
+	asJSON := fset.Bool("json", false, "Print the result as JSON")
+	logLevel := fset.String("log-level", "ERROR", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc diff [options] <image-id | output-dir> <image-id | output-dir>\n\n")
+		fmt.Fprintf(os.Stderr, "Compare the descriptors, tile counts and sampled tile hashes of two outputs of an image.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc diff --output-root /out/vips-8.15 --output-root-b /out/vips-8.16 my-img-001 my-img-001\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return fmt.Errorf("exactly two image IDs or output directories are required")
+	}
+	if *samples < 0 {
+		return fmt.Errorf("--samples must not be negative")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Existing directories are used as is, anything else is an image ID under its root
+	rootA := *outputRoot
+	if rootA == "" {
+		rootA = cfg.Storage.OutputMountPath
+	}
+	rootB := *outputRootB
+	if rootB == "" {
+		rootB = rootA
+	}
+	resolve := func(target, root string) string {
+		if info, err := os.Stat(target); err == nil && info.IsDir() {
+			return target
+		}
+		return filepath.Join(root, target)
+	}
+	dirA := resolve(fset.Arg(0), rootA)
+	dirB := resolve(fset.Arg(1), rootB)
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, log),
+		InfraStorage.NewMountStorage(cfg.Storage.OutputMountPath, log))
+
+	diff, err := svc.DiffStored(ctx, dirA, dirB, *samples, *maxDistance)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+	} else {
+		printDiff(diff)
+	}
+
+	if !diff.Equal() {
+		return fmt.Errorf("outputs in %s and %s diverge", dirA, dirB)
+	}
+	return nil
+}
+
+func printDiff(d *service.OutputDiff) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "A:\t%s (%s)\n", d.A, d.ContainerA)
+	fmt.Fprintf(w, "B:\t%s (%s)\n", d.B, d.ContainerB)
+	for _, side := range []struct {
+		name       string
+		descriptor *dzi.Descriptor
+	}{{"A", d.DescriptorA}, {"B", d.DescriptorB}} {
+		if desc := side.descriptor; desc != nil {
+			fmt.Fprintf(w, "Descriptor %s:\t%d x %d, tile %d, overlap %d, %s\n", side.name, desc.Width, desc.Height, desc.TileSize, desc.Overlap, desc.Format)
+		}
+	}
+	for _, level := range d.Levels {
+		fmt.Fprintf(w, "Level %d:\t%d in A, %d in B, %d expected\n", level.Level, level.FoundA, level.FoundB, level.Expected)
+	}
+	maxDistance := 0
+	for _, tile := range d.Tiles {
+		maxDistance = max(maxDistance, tile.Distance)
+	}
+	fmt.Fprintf(w, "Tiles sampled:\t%d\n", len(d.Tiles))
+	fmt.Fprintf(w, "Largest hash distance:\t%d bits (max %d)\n", maxDistance, d.MaxDistance)
+	w.Flush()
+
+	if len(d.Differences) > 0 {
+		fmt.Println("\nDifferences:")
+		for _, difference := range d.Differences {
+			fmt.Printf("  %s\n", difference)
+		}
+	}
+
+	if d.Equal() {
+		fmt.Println("\nResult: EQUAL")
+	} else {
+		fmt.Println("\nResult: DIVERGED")
+	}
+}
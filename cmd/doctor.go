@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/api/iterator"
+
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// cloudCheckTimeout bounds each Pub/Sub and GCS check so a missing credential does not hang
+const cloudCheckTimeout = 20 * time.Second
+
+// runDoctor checks binaries, scratch space, mounts and (in cloud environments) Pub/Sub
+// topics and bucket permissions, and prints a pass/fail report
+func runDoctor(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cloud := fset.Bool("cloud", false, "Also check Pub/Sub and GCS when APP_ENV is LOCAL")
+	asJSON := fset.Bool("json", false, "Print the report as JSON")
+	logLevel := fset.String("log-level", "ERROR", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc doctor [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Check the environment a processing job needs and print a pass/fail report.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, log),
+		InfraStorage.NewMountStorage(cfg.Storage.OutputMountPath, log))
+
+	checks := svc.Diagnose(ctx)
+	if cfg.UsesPubSub() || cfg.UsesGCS() || *cloud {
+		checks = append(checks, cloudChecks(ctx, cfg)...)
+	}
+	checks = append(checks, service.DiagnosticCheck{
+		Name:   "firestore",
+		Status: service.CheckSkip,
+		Detail: "not accessed by this service, records are updated from result events",
+	})
+
+	failed := 0
+	for _, check := range checks {
+		if check.Status == service.CheckFail {
+			failed++
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(checks); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", strings.ToUpper(string(check.Status)), check.Name, check.Detail)
+		}
+		w.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// cloudChecks verifies the Pub/Sub topics exist and the buckets are readable/writable
+// with the credentials the job runs with
+func cloudChecks(ctx context.Context, cfg *config.Config) []service.DiagnosticCheck {
+	var checks []service.DiagnosticCheck
+	fail := func(name string, err error) {
+		checks = append(checks, service.DiagnosticCheck{Name: name, Status: service.CheckFail, Detail: err.Error()})
+	}
+	pass := func(name, detail string) {
+		checks = append(checks, service.DiagnosticCheck{Name: name, Status: service.CheckPass, Detail: detail})
+	}
+
+	if cfg.GCP.ProjectID == "" {
+		fail("gcp project", fmt.Errorf("PROJECT_ID is not set"))
+		return checks
+	}
+
+	pubsubClient, err := container.NewPubSubClient(ctx, cfg)
+	if err != nil {
+		fail("pubsub client", err)
+	} else {
+		defer pubsubClient.Close()
+		topicIDs := []string{cfg.ImageProcessingTopicID, cfg.ImageRequestTopicID}
+		if cfg.DeadLetter.MaxAttempts > 0 {
+			topicIDs = append(topicIDs, cfg.DeadLetter.TopicID)
+		}
+		for _, topicID := range topicIDs {
+			name := "pubsub topic " + topicID
+			checkCtx, cancel := context.WithTimeout(ctx, cloudCheckTimeout)
+			exists, err := pubsubClient.Topic(topicID).Exists(checkCtx)
+			cancel()
+			switch {
+			case err != nil:
+				fail(name, err)
+			case !exists:
+				fail(name, fmt.Errorf("topic does not exist in project %s", cfg.GCP.ProjectID))
+			default:
+				pass(name, "exists")
+			}
+		}
+	}
+
+	storageClient, err := container.NewStorageClient(ctx, cfg)
+	if err != nil {
+		fail("gcs client", err)
+		return checks
+	}
+	defer storageClient.Close()
+
+	if cfg.GCP.InputBucketName == "" {
+		fail("input bucket", fmt.Errorf("ORIGINAL_BUCKET_NAME is not set"))
+	} else {
+		name := "input bucket " + cfg.GCP.InputBucketName
+		checkCtx, cancel := context.WithTimeout(ctx, cloudCheckTimeout)
+		_, err := storageClient.Bucket(cfg.GCP.InputBucketName).Objects(checkCtx, nil).Next()
+		cancel()
+		if err != nil && err != iterator.Done {
+			fail(name, fmt.Errorf("cannot list objects: %w", err))
+		} else {
+			pass(name, "readable")
+		}
+	}
+
+	if cfg.GCP.OutputBucketName == "" {
+		fail("output bucket", fmt.Errorf("PROCESSED_BUCKET_NAME is not set"))
+	} else {
+		name := "output bucket " + cfg.GCP.OutputBucketName
+		if err := container.ProbeBucketWrite(ctx, storageClient.Bucket(cfg.GCP.OutputBucketName)); err != nil {
+			fail(name, err)
+		} else {
+			pass(name, "writable")
+		}
+	}
+
+	return checks
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/e2e"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runE2E processes a fixture slide through the configured container and checks the
+// outputs and the result event end to end
+func runE2E(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("e2e", flag.ExitOnError)
+	imageID := fset.String("image-id", "", "Image ID of the fixture (default e2e-<unix time>)")
+	version := fset.String("version", "v2", "Processing version (v1 = fs container, v2 = zip container)")
+	width := fset.Int("width", 2048, "Fixture width in pixels")
+	height := fset.Int("height", 1536, "Fixture height in pixels")
+	tenant := fset.String("tenant", "", "Tenant to run as (multi-tenant deployments, see TENANT_ROUTING_FILE)")
+	keep := fset.Bool("keep", false, "Keep the fixture on the input mount")
+	asJSON := fset.Bool("json", false, "Print the result as JSON")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc e2e [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Write a fixture slide to the input mount, process it with the configured\n")
+		fmt.Fprintf(os.Stderr, "storage and topics, and check the uploaded outputs and the result event.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc e2e --version v1 --json\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ApplyTenant(*tenant); err != nil {
+		return err
+	}
+	if err := utils.LoadSupportedFormats(); err != nil {
+		return fmt.Errorf("failed to load supported formats from embed: %w", err)
+	}
+
+	result, err := e2e.Run(ctx, cfg, log, e2e.Options{
+		ImageID:           *imageID,
+		ProcessingVersion: *version,
+		Width:             *width,
+		Height:            *height,
+		Keep:              *keep,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, check := range result.Checks {
+			status := "ok"
+			if !check.OK {
+				status = "FAILED"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, status, check.Detail)
+		}
+		w.Flush()
+		fmt.Printf("\n%s in %s, outputs in %s\n", result.ImageID,
+			(time.Duration(result.DurationMs) * time.Millisecond).Round(time.Millisecond), result.OutputDir)
+	}
+
+	if !result.OK() {
+		return fmt.Errorf("end-to-end checks failed for %s", result.ImageID)
+	}
+	return nil
+}
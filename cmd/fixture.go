@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/testutil/fixture"
+)
+
+// runFixture writes a synthetic pyramidal slide with a known pattern for tiling tests
+func runFixture(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("fixture", flag.ExitOnError)
+	output := fset.String("output", "", "Slide to write, .svs implies --svs (required)")
+	fset.StringVar(output, "o", "", "Slide to write (shorthand)")
+	width := fset.Int("width", 4096, "Level-0 width in pixels")
+	height := fset.Int("height", 3072, "Level-0 height in pixels")
+	tileSize := fset.Int("tile-size", 256, "Tile edge of every level (multiple of 16)")
+	cellSize := fset.Int("cell-size", 512, "Edge of the pattern cells (power of two)")
+	levels := fset.Int("levels", 0, "Pyramid levels (0 = until the slide fits in one tile)")
+	svs := fset.Bool("svs", false, "Lay the file out like an Aperio SVS (description, thumbnail)")
+	mpp := fset.Float64("mpp", 0.25, "Microns per pixel at level 0")
+	compress := fset.Bool("compress", true, "Deflate-compress tiles")
+	asJSON := fset.Bool("json", false, "Print the generated levels as JSON")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc fixture [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Write a synthetic tiled pyramidal TIFF whose pixels follow a known cell pattern.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc fixture -o ./test-data/input/synthetic.svs --width 20000 --height 15000\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		fset.Usage()
+		return fmt.Errorf("--output is required")
+	}
+
+	info, err := fixture.Write(*output, fixture.Options{
+		Width:    *width,
+		Height:   *height,
+		TileSize: *tileSize,
+		CellSize: *cellSize,
+		Levels:   *levels,
+		SVS:      *svs || strings.EqualFold(filepath.Ext(*output), ".svs"),
+		MPP:      *mpp,
+		Compress: *compress,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	fmt.Printf("Wrote %s (%d KB)\n", info.Path, info.Size>>10)
+	for i, level := range info.Levels {
+		fmt.Printf("  level %d: %dx%d (downsample %d)\n", i, level.Width, level.Height, level.Downsample)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+)
+
+// runFormats dispatches the formats subcommands
+func runFormats(ctx context.Context, args []string) error {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc formats list [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Print the input formats and the processors that handle them.\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("missing formats subcommand")
+	}
+	switch args[0] {
+	case "list":
+		return runFormatsList(args[1:])
+	default:
+		usage()
+		return fmt.Errorf("unknown formats subcommand %q", args[0])
+	}
+}
+
+// runFormatsList prints the capability matrix: for every supported format the
+// processors that read its dimensions, make the thumbnail and tile it, and the
+// conversions it needs first
+func runFormatsList(args []string) error {
+	fset := flag.NewFlagSet("formats list", flag.ExitOnError)
+	asJSON := fset.Bool("json", false, "Print the matrix as JSON")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc formats list [options] [format ...]\n\n")
+		fmt.Fprintf(os.Stderr, "Print the capability matrix of the input formats, or of the given ones.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc formats list svs mrxs\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	capabilities := processors.FormatCapabilities()
+	if fset.NArg() > 0 {
+		capabilities = capabilities[:0]
+		for _, format := range fset.Args() {
+			capability, ok := processors.LookupFormat(format)
+			if !ok {
+				return fmt.Errorf("%s", processors.UnsupportedFormatMessage(format, ""))
+			}
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(capabilities)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FORMAT\tFAMILY\tINFO\tTHUMBNAIL\tTILING\tCONVERSIONS")
+	for _, c := range capabilities {
+		conversions := "-"
+		if len(c.Conversions) > 0 {
+			conversions = strings.Join(c.Conversions, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Format,
+			c.Family,
+			strings.Join(c.Info, ", "),
+			c.Thumbnail,
+			strings.Join(c.Tiling, ", "),
+			conversions)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runGC removes stale workspaces left in the scratch dir by crashed or killed jobs
+func runGC(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("gc", flag.ExitOnError)
+	dir := fset.String("dir", "", "Scratch directory to clean (default SCRATCH_DIR)")
+	maxAge := fset.Duration("max-age", 0, "Remove workspaces untouched for this long (default SCRATCH_GC_MAX_AGE_MINUTES)")
+	dryRun := fset.Bool("dry-run", false, "List stale workspaces without removing them")
+	asJSON := fset.Bool("json", false, "Print the result as JSON")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc gc [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Remove stale workspace directories from the scratch directory.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *dir == "" {
+		*dir = cfg.Scratch.Dir
+	}
+	if *maxAge == 0 {
+		*maxAge = cfg.Scratch.GCMaxAge
+	}
+	if *maxAge <= 0 {
+		return fmt.Errorf("--max-age must be positive")
+	}
+
+	result, err := service.CollectScratch(log, *dir, *maxAge, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		verb := "Removed"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		for _, path := range result.Removed {
+			fmt.Printf("%s %s\n", verb, path)
+		}
+		for _, path := range result.Failed {
+			fmt.Printf("Failed to remove %s\n", path)
+		}
+		fmt.Printf("%s %d workspaces (%d MB) older than %s in %s, kept %d\n",
+			verb, len(result.Removed), result.FreedBytes>>20, maxAge.Round(time.Minute), result.Dir, result.Kept)
+	}
+
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d workspaces could not be removed", len(result.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/internal/testutil/golden"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runGolden tiles the fixture slides of the golden cases and compares the pyramids
+// with the stored manifests, or rewrites the manifests with --update
+func runGolden(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("golden", flag.ExitOnError)
+	dir := fset.String("dir", "test-data/golden", "Directory of the golden manifests")
+	update := fset.Bool("update", false, "Rewrite the manifests from the current output instead of comparing")
+	only := fset.String("case", "", "Comma-separated case names to run (default all)")
+	maxDistance := fset.Int("max-distance", golden.DefaultMaxDistance, "Tile hash bits that may differ")
+	workDir := fset.String("work-dir", "", "Directory for fixtures and pyramids (default system temp dir)")
+	keep := fset.Bool("keep", false, "Keep the fixtures and pyramids for inspection")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc golden [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Tile synthetic slides and compare descriptor, tile counts and sampled tile hashes\n")
+		fmt.Fprintf(os.Stderr, "with the golden manifests. Cases:")
+		for _, c := range golden.DefaultCases() {
+			fmt.Fprintf(os.Stderr, " %s", c.Name)
+		}
+		fmt.Fprintf(os.Stderr, "\n\nOptions:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc golden --update --case svs-jpg-256\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	cases := golden.DefaultCases()
+	if *only != "" {
+		byName := make(map[string]golden.Case, len(cases))
+		for _, c := range cases {
+			byName[c.Name] = c
+		}
+		cases = nil
+		for _, name := range strings.Split(*only, ",") {
+			c, ok := byName[strings.TrimSpace(name)]
+			if !ok {
+				return fmt.Errorf("unknown golden case %q", name)
+			}
+			cases = append(cases, c)
+		}
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	vips := processors.NewVipsProcessor(log)
+	if err := vips.VerifyBinary(); err != nil {
+		return err
+	}
+
+	root, err := os.MkdirTemp(*workDir, "himgproc-golden-")
+	if err != nil {
+		return fmt.Errorf("failed to create golden work directory: %w", err)
+	}
+	if *keep {
+		fmt.Fprintf(os.Stderr, "Keeping fixtures and pyramids in %s\n", root)
+	} else {
+		defer os.RemoveAll(root)
+	}
+
+	failed := 0
+	for _, c := range cases {
+		got, err := golden.Generate(ctx, vips, c, cfg.DZIConfig, cfg.ImageProcessTimeoutMinute.DZIConversion, root)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Printf("FAIL %s: %v\n", c.Name, err)
+			failed++
+			continue
+		}
+
+		path := golden.Path(*dir, c.Name)
+		if *update {
+			if err := got.Save(path); err != nil {
+				return err
+			}
+			fmt.Printf("UPDATED %s (%d tiles sampled)\n", path, len(got.Tiles))
+			continue
+		}
+
+		want, err := golden.Load(path)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v (run with --update to create it)\n", c.Name, err)
+			failed++
+			continue
+		}
+		diffs := golden.Compare(want, got, *maxDistance)
+		if len(diffs) == 0 {
+			fmt.Printf("ok   %s\n", c.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s (golden from %s, now %s):\n", c.Name, orUnknown(want.Vips), orUnknown(got.Vips))
+		for _, diff := range diffs {
+			fmt.Printf("  %s\n", diff)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d golden cases failed", failed, len(cases))
+	}
+	return nil
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown vips"
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runInspect prints what a processing job would see for a slide (dimensions,
+// levels, MPP, vendor properties, tile estimates and processor path) without
+// running the job
+func runInspect(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inputPath := fset.String("input", "", "Path to the slide to inspect (required)")
+	fset.StringVar(inputPath, "i", "", "Path to the slide to inspect (shorthand)")
+	asJSON := fset.Bool("json", false, "Print the inspection as JSON")
+	showProperties := fset.Bool("properties", false, "Print all vendor properties")
+	logLevel := fset.String("log-level", "ERROR", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc inspect [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Print slide metadata and the processing path without running a job.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *inputPath == "" && fset.NArg() > 0 {
+		*inputPath = fset.Arg(0)
+	}
+	if *inputPath == "" {
+		fset.Usage()
+		return fmt.Errorf("--input is required")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := utils.LoadSupportedFormats(); err != nil {
+		return fmt.Errorf("failed to load supported formats from embed: %w", err)
+	}
+
+	dir := filepath.Dir(*inputPath)
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(dir, log),
+		InfraStorage.NewMountStorage(dir, log))
+
+	inspection, err := svc.Inspect(ctx, *inputPath)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(inspection)
+	}
+
+	printInspection(inspection, *showProperties)
+	return nil
+}
+
+func printInspection(in *service.SlideInspection, showProperties bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "File:\t%s\n", in.Path)
+	fmt.Fprintf(w, "Format:\t%s (supported: %t)\n", in.Extension, in.Supported)
+	fmt.Fprintf(w, "Size:\t%.1f MB\n", float64(in.SizeBytes)/(1<<20))
+	fmt.Fprintf(w, "Dimensions:\t%d x %d\n", in.Width, in.Height)
+	fmt.Fprintf(w, "Dimension probe:\t%s\n", in.DimensionProbe)
+	fmt.Fprintf(w, "Pipeline:\t%s\n", strings.Join(in.Pipeline, " -> "))
+	if in.Bands != nil {
+		fmt.Fprintf(w, "Bands:\t%d %s (%s)\n", in.Bands.Bands, in.Bands.Format, in.Bands.Interpretation)
+	}
+	if in.Slide != nil {
+		if in.Slide.Vendor != "" {
+			fmt.Fprintf(w, "Vendor:\t%s\n", in.Slide.Vendor)
+		}
+		if in.Slide.MPPX > 0 || in.Slide.MPPY > 0 {
+			fmt.Fprintf(w, "MPP:\t%g x %g um/px\n", in.Slide.MPPX, in.Slide.MPPY)
+		}
+		for i, level := range in.Slide.Levels {
+			fmt.Fprintf(w, "Slide level %d:\t%d x %d (downsample %g)\n", i, level.Width, level.Height, level.Downsample)
+		}
+	}
+	if in.DZI != nil {
+		fmt.Fprintf(w, "DZI:\ttile %d, overlap %d, %s, %d levels\n", in.DZI.TileSize, in.DZI.Overlap, in.DZI.Format, len(in.LevelTiles))
+		fmt.Fprintf(w, "Estimated tiles:\t%d\n", in.EstimatedTiles)
+	}
+	fmt.Fprintf(w, "Estimated scratch:\t%.1f MB\n", float64(in.EstimatedScratchBytes)/(1<<20))
+	fmt.Fprintf(w, "Memory check:\t%s\n", in.MemoryCheck)
+	for _, warning := range in.Warnings {
+		fmt.Fprintf(w, "Warning:\t%s\n", warning)
+	}
+	w.Flush()
+
+	if showProperties && in.Slide != nil {
+		keys := make([]string, 0, len(in.Slide.Properties))
+		for key := range in.Slide.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", key, in.Slide.Properties[key])
+		}
+		w.Flush()
+	}
+}
@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	stderrors "errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/histopathai/image-processing-service/internal/domain/model"
 	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/events/stdout"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
 	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/logger"
 )
 
@@ -31,6 +39,17 @@ func main() {
 		cancel()
 	}()
 
+	// Subcommands run instead of a processing job
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(ctx, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s failed: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Run the job
 	if err := run(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Job failed: %v\n", err)
@@ -38,6 +57,31 @@ func main() {
 	}
 }
 
+// commands are the subcommands selected by the first argument
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"batch":         runBatch,
+	"bench":         runBench,
+	"config":        runConfig,
+	"diff":          runDiff,
+	"doctor":        runDoctor,
+	"e2e":           runE2E,
+	"fixture":       runFixture,
+	"formats":       runFormats,
+	"golden":        runGolden,
+	"gc":            runGC,
+	"inspect":       runInspect,
+	"migrate":       runMigrate,
+	"outdated":      runOutdated,
+	"validate":      runValidate,
+	"process-dir":   runProcessDir,
+	"purge-deleted": runPurgeDeleted,
+	"replay":        runReplay,
+	"reprocess":     runReprocess,
+	"schema":        runSchema,
+	"sign":          runSign,
+	"transcode":     runTranscode,
+}
+
 func run(ctx context.Context) error {
 	// Parse CLI flags
 	inputPath := flag.String("input", "", "Path to input image file (required)")
@@ -50,6 +94,7 @@ func run(ctx context.Context) error {
 	version := flag.String("version", "v2", "Processing version (v1 or v2)")
 	logLevel := flag.String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR)")
 	logFormat := flag.String("log-format", "", "Log format (text or json)")
+	noProgress := flag.Bool("no-progress", false, "Log as usual instead of showing progress bars on a terminal")
 
 	// DZI overrides
 	tileSize := flag.Int("tile-size", 0, "DZI Tile Size (default 256 or env TILE_SIZE)")
@@ -60,18 +105,46 @@ func run(ctx context.Context) error {
 	dziSuffix := flag.String("dzi-suffix", "", "DZI Suffix (default jpg or env DZI_SUFFIX)")
 	dziCompression := flag.Int("dzi-compression", -1, "DZI Zip Compression Level 0-9 (default 0 or env DZI_COMPRESSION)")
 
+	// Job type
+	jobType := flag.String("job", "process", "Job type (process, extract_region or render_annotations)")
+	region := flag.String("region", "", "Region to extract as x,y,width,height (level-0 origin, level-sized extent)")
+	regionLevel := flag.Int("region-level", 0, "Pyramid level to extract the region from")
+	regionFormat := flag.String("region-format", "png", "Region output format (png or tiff)")
+	annotations := flag.String("annotations", "", "Path to a GeoJSON annotation file (level-0 pixel coordinates)")
+	renderSize := flag.Int("render-size", 0, "Longest edge of the annotated overview (default 2048)")
+
 	// Thumbnail overrides
 	thumbnailSize := flag.Int("thumbnail-size", 0, "Thumbnail size (default 256 or env THUMBNAIL_SIZE)")
 	thumbnailQuality := flag.Int("thumbnail-quality", 0, "Thumbnail quality (default 90 or env THUMBNAIL_QUALITY)")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: himgproc [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: himgproc [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc batch [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc bench [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc config init [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc diff [options] <a> <b>\n")
+		fmt.Fprintf(os.Stderr, "       himgproc doctor [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc fixture [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc golden [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc gc [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc inspect [options] <file>\n")
+		fmt.Fprintf(os.Stderr, "       himgproc validate [options] <image-id | output-dir>\n")
+		fmt.Fprintf(os.Stderr, "       himgproc migrate [options] <image-id>...\n")
+		fmt.Fprintf(os.Stderr, "       himgproc process-dir [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc purge-deleted [options]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc replay [options] <event.json>\n")
+		fmt.Fprintf(os.Stderr, "       himgproc reprocess [options] <image-id>\n")
+		fmt.Fprintf(os.Stderr, "       himgproc schema [--check] [event-type | event.json...]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc sign [options] <image-id> [file...]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc transcode [options] <image-id>...\n\n")
 		fmt.Fprintf(os.Stderr, "Process medical whole slide images locally.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  himgproc -i ./image.svs -o ./output\n")
 		fmt.Fprintf(os.Stderr, "  himgproc --input ./image.png --image-id my-img-001 --version v2\n")
+		fmt.Fprintf(os.Stderr, "  himgproc -i ./slide.svs --job extract_region --region 1000,2000,512,512 --region-level 1\n")
+		fmt.Fprintf(os.Stderr, "  himgproc -i ./slide.svs --job render_annotations --annotations ./tumor.geojson\n")
 	}
 
 	flag.Parse()
@@ -87,6 +160,7 @@ func run(ctx context.Context) error {
 			Version:          *version,
 			LogLevel:         *logLevel,
 			LogFormat:        *logFormat,
+			NoProgress:       *noProgress,
 			TileSize:         *tileSize,
 			Overlap:          *overlap,
 			Quality:          *quality,
@@ -96,6 +170,12 @@ func run(ctx context.Context) error {
 			DZICompression:   *dziCompression,
 			ThumbnailSize:    *thumbnailSize,
 			ThumbnailQuality: *thumbnailQuality,
+			JobType:          *jobType,
+			Region:           *region,
+			RegionLevel:      *regionLevel,
+			RegionFormat:     *regionFormat,
+			Annotations:      *annotations,
+			RenderSize:       *renderSize,
 		}
 		return runCLI(ctx, opts)
 	}
@@ -112,6 +192,7 @@ type CLIOptions struct {
 	Version          string
 	LogLevel         string
 	LogFormat        string
+	NoProgress       bool
 	TileSize         int
 	Overlap          int
 	Quality          int
@@ -121,6 +202,12 @@ type CLIOptions struct {
 	DZICompression   int
 	ThumbnailSize    int
 	ThumbnailQuality int
+	JobType          string
+	Region           string
+	RegionLevel      int
+	RegionFormat     string
+	Annotations      string
+	RenderSize       int
 }
 
 func runCLI(ctx context.Context, opts CLIOptions) error {
@@ -151,6 +238,14 @@ func runCLI(ctx context.Context, opts CLIOptions) error {
 	os.Setenv("INPUT_MOUNT_PATH", filepath.Dir(absInput))
 	os.Setenv("OUTPUT_MOUNT_PATH", absOutput)
 
+	// On a terminal the job is shown as progress bars instead of log lines,
+	// unless a log level was asked for explicitly
+	var progress *progressRenderer
+	if !opts.NoProgress && isInteractive(os.Stderr) {
+		progress = newProgressRenderer(os.Stderr)
+	}
+	quiet := progress != nil && opts.LogLevel == ""
+
 	if opts.LogLevel == "" {
 		opts.LogLevel = "INFO"
 	}
@@ -190,9 +285,12 @@ func runCLI(ctx context.Context, opts CLIOptions) error {
 	}
 
 	log := logger.New(logger.Config{
-		Level:  opts.LogLevel,
+		Level:  strings.ToLower(opts.LogLevel),
 		Format: opts.LogFormat,
 	})
+	if quiet {
+		log = slog.New(slog.DiscardHandler)
+	}
 
 	log.Info("Starting himgproc",
 		"input", absInput,
@@ -214,6 +312,24 @@ func runCLI(ctx context.Context, opts CLIOptions) error {
 	if err != nil {
 		return fmt.Errorf("failed to create job input: %w", err)
 	}
+	var annotationData []byte
+	if opts.Annotations != "" {
+		annotationData, err = os.ReadFile(opts.Annotations)
+		if err != nil {
+			return fmt.Errorf("failed to read annotations: %w", err)
+		}
+	}
+
+	if err := applyJobType(input, jobSpec{
+		Type:         opts.JobType,
+		Region:       opts.Region,
+		RegionLevel:  opts.RegionLevel,
+		RegionFormat: opts.RegionFormat,
+		Annotations:  annotationData,
+		RenderSize:   opts.RenderSize,
+	}); err != nil {
+		return fmt.Errorf("failed to configure job: %w", err)
+	}
 
 	cnt, err := container.New(ctx, cfg, log)
 	if err != nil {
@@ -225,7 +341,23 @@ func runCLI(ctx context.Context, opts CLIOptions) error {
 		}
 	}()
 
-	if err := cnt.JobOrchestrator.ProcessJob(ctx, input); err != nil {
+	// The clients above live past the job's deadline, so the result can still go out
+	ctx, cancel := jobContext(ctx, cfg)
+	defer cancel()
+
+	if progress != nil {
+		cnt.ImageProcessingService.SetProgress(progress.Update)
+		// The event is still written to result.json
+		if publisher, ok := cnt.EventPublisher.(*stdout.Publisher); ok {
+			publisher.SetEcho(false)
+		}
+	}
+
+	err = cnt.JobOrchestrator.ProcessJob(ctx, input)
+	if progress != nil {
+		progress.Finish(opts.ImageID, filepath.Join(absOutput, opts.ImageID), err)
+	}
+	if err != nil {
 		return fmt.Errorf("image processing failed: %w", err)
 	}
 
@@ -262,7 +394,7 @@ func runLegacy(ctx context.Context, logLevel, logFormat string) error {
 		return fmt.Errorf("failed to load supported formats from embed: %w", err)
 	}
 
-	input, err := getJobInput()
+	input, err := getJobInput(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to get job input: %w", err)
 	}
@@ -270,8 +402,16 @@ func runLegacy(ctx context.Context, logLevel, logFormat string) error {
 	log.Info("Job input loaded",
 		"image_id", input.ImageID,
 		"origin_path", input.OriginPath,
+		"tenant", input.Tenant,
 	)
 
+	// Before the container is built, so its clients use the tenant's buckets and topic
+	if err := cfg.ApplyTenant(input.Tenant); err != nil {
+		return fmt.Errorf("failed to route job: %w", err)
+	}
+	cfg.ThumbnailConfig.Mode = cfg.ThumbnailConfig.ModeFor(input.Metadata["dataset"])
+	cfg.QC.ApplyDataset(input.Metadata["dataset"])
+
 	cnt, err := container.New(ctx, cfg, log)
 	if err != nil {
 		return fmt.Errorf("failed to initialize container: %w", err)
@@ -282,7 +422,16 @@ func runLegacy(ctx context.Context, logLevel, logFormat string) error {
 		}
 	}()
 
+	// The clients above live past the job's deadline, so the result can still go out
+	ctx, cancel := jobContext(ctx, cfg)
+	defer cancel()
+
 	if err := cnt.JobOrchestrator.ProcessJob(ctx, input); err != nil {
+		if stderrors.Is(err, service.ErrDeadLettered) {
+			// Exit cleanly so Cloud Run does not run the poison image again
+			log.Error("Job failed permanently", "image_id", input.ImageID, "error", err)
+			return nil
+		}
 		return fmt.Errorf("image processing failed: %w", err)
 	}
 
@@ -290,13 +439,190 @@ func runLegacy(ctx context.Context, logLevel, logFormat string) error {
 	return nil
 }
 
-func getJobInput() (*model.JobInput, error) {
+// processStart approximates the start of the Cloud Run task, which its timeout counts from
+var processStart = time.Now()
+
+// jobContext bounds a job by JOB_TIMEOUT_SECONDS, keeping JOB_CLEANUP_RESERVE_SECONDS
+// back for cleanup and the result event (see pkg/deadline)
+func jobContext(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.Deadline.JobTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return deadline.WithBudget(ctx, processStart.Add(cfg.Deadline.JobTimeout), cfg.Deadline.CleanupReserve)
+}
+
+func getJobInput(cfg *config.Config) (*model.JobInput, error) {
+	input, err := jobInputFromEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set from the publish time and expires_at of the request event, a job starting
+	// after its expiry is skipped with an expired result
+	for _, field := range []struct {
+		env   string
+		value *time.Time
+	}{
+		{"INPUT_REQUESTED_AT", &input.RequestedAt},
+		{"INPUT_EXPIRES_AT", &input.ExpiresAt},
+	} {
+		value := os.Getenv(field.env)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", field.env, err)
+		}
+		*field.value = t
+	}
+
+	// Set from the event ID and correlation ID of the request event, the events of the
+	// job are published as caused by it
+	input.RequestEventID = os.Getenv("INPUT_REQUEST_EVENT_ID")
+	input.CorrelationID = os.Getenv("INPUT_CORRELATION_ID")
+
+	return input, nil
+}
+
+func jobInputFromEnv(cfg *config.Config) (*model.JobInput, error) {
 	imageID := os.Getenv("INPUT_IMAGE_ID")
 	originPath := os.Getenv("INPUT_ORIGIN_PATH")
 	processingVersion := os.Getenv("INPUT_PROCESSING_VERSION")
 	bucketName := os.Getenv("INPUT_BUCKET_NAME")
 
-	return model.NewJobInputFromEnv(imageID, originPath, processingVersion, bucketName)
+	// Deletions need no original
+	if model.JobType(os.Getenv("INPUT_JOB_TYPE")) == model.JobTypeDelete {
+		input, err := model.NewDeletionJobInput(imageID, bucketName)
+		if err != nil {
+			return nil, err
+		}
+		input.Tenant = os.Getenv("INPUT_TENANT")
+		return input, nil
+	}
+
+	// Transcoding reads the stored outputs, not the original
+	if model.JobType(os.Getenv("INPUT_JOB_TYPE")) == model.JobTypeTranscode {
+		spec := &model.TranscodeSpec{
+			Format: os.Getenv("INPUT_TRANSCODE_FORMAT"),
+			Prefix: os.Getenv("INPUT_TRANSCODE_PREFIX"),
+		}
+		if value := os.Getenv("INPUT_TRANSCODE_QUALITY"); value != "" {
+			quality, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid INPUT_TRANSCODE_QUALITY: %w", err)
+			}
+			spec.Quality = quality
+		}
+		input, err := model.NewTranscodeJobInput(imageID, bucketName, spec)
+		if err != nil {
+			return nil, err
+		}
+		input.Tenant = os.Getenv("INPUT_TENANT")
+		return input, nil
+	}
+
+	input, err := model.NewJobInputFromEnv(imageID, originPath, processingVersion, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := jobSpec{
+		Type:         os.Getenv("INPUT_JOB_TYPE"),
+		Region:       os.Getenv("INPUT_REGION"),
+		RegionFormat: os.Getenv("INPUT_REGION_FORMAT"),
+	}
+
+	if value := os.Getenv("INPUT_REGION_LEVEL"); value != "" {
+		spec.RegionLevel, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INPUT_REGION_LEVEL: %w", err)
+		}
+	}
+
+	if value := os.Getenv("INPUT_RENDER_SIZE"); value != "" {
+		spec.RenderSize, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INPUT_RENDER_SIZE: %w", err)
+		}
+	}
+
+	// Annotations are passed inline or as a path relative to the input mount
+	if value := os.Getenv("INPUT_ANNOTATIONS"); value != "" {
+		spec.Annotations = []byte(value)
+	} else if value := os.Getenv("INPUT_ANNOTATIONS_PATH"); value != "" {
+		annotationsPath, err := storage.ResolveWithin(cfg.Storage.InputMountPath, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INPUT_ANNOTATIONS_PATH: %w", err)
+		}
+		spec.Annotations, err = os.ReadFile(annotationsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read INPUT_ANNOTATIONS_PATH: %w", err)
+		}
+	}
+
+	if err := applyJobType(input, spec); err != nil {
+		return nil, err
+	}
+
+	// Set from the tenant attribute and metadata of the request event
+	input.Tenant = os.Getenv("INPUT_TENANT")
+	if value := os.Getenv("INPUT_METADATA"); value != "" {
+		metadata, err := model.ParseMetadata([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid INPUT_METADATA: %w", err)
+		}
+		input.Metadata = metadata
+	}
+
+	return input, nil
+}
+
+// jobSpec carries the job type selection and its type-specific parameters
+type jobSpec struct {
+	Type         string
+	Region       string
+	RegionLevel  int
+	RegionFormat string
+	Annotations  []byte
+	RenderSize   int
+}
+
+// applyJobType configures a non-default job type on the input
+func applyJobType(input *model.JobInput, spec jobSpec) error {
+	jobType := spec.Type
+	if jobType == "" {
+		jobType = string(model.JobTypeProcess)
+	}
+
+	switch model.JobType(jobType) {
+	case model.JobTypeProcess:
+		return nil
+	case model.JobTypeExtractRegion:
+		region, err := model.ParseRegion(spec.Region, spec.RegionLevel, spec.RegionFormat)
+		if err != nil {
+			return err
+		}
+		return input.SetRegionExtraction(region)
+	case model.JobTypeRenderAnnotations:
+		if len(spec.Annotations) == 0 {
+			return fmt.Errorf("annotations are required for %s", jobType)
+		}
+		annotations, err := model.ParseAnnotations(spec.Annotations)
+		if err != nil {
+			return err
+		}
+		var region *model.RegionSpec
+		if spec.Region != "" {
+			region, err = model.ParseRegion(spec.Region, spec.RegionLevel, string(model.RegionFormatPNG))
+			if err != nil {
+				return err
+			}
+		}
+		return input.SetAnnotationRender(annotations, region, spec.RenderSize)
+	default:
+		return fmt.Errorf("unsupported job type: %s", jobType)
+	}
 }
 
 func setEnvDefault(key, value string) {
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runMigrate converts fs-layout outputs (loose tiles) to the zip container in place
+// and publishes updated completion events, so old and new images are served the same way
+func runMigrate(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("migrate", flag.ExitOnError)
+	all := fset.Bool("all", false, "Migrate every fs-layout image under the output mount")
+	keepTiles := fset.Bool("keep-tiles", false, "Keep tiles/ after the zip container has been validated")
+	dryRun := fset.Bool("dry-run", false, "List the images that would be migrated")
+	logLevel := fset.String("log-level", "INFO", "Log level (DEBUG, INFO, WARN, ERROR)")
+	logFormat := fset.String("log-format", "text", "Log format (text or json)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc migrate [options] <image-id>...\n")
+		fmt.Fprintf(os.Stderr, "       himgproc migrate [options] --all\n\n")
+		fmt.Fprintf(os.Stderr, "Convert fs-layout outputs (tiles/) into image.zip + IndexMap.json in place.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *all == (fset.NArg() > 0) {
+		fset.Usage()
+		return fmt.Errorf("pass either image IDs or --all")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: *logFormat,
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	imageIDs := fset.Args()
+	if *all {
+		imageIDs, err = findFSOutputs(cfg.Storage.OutputMountPath)
+		if err != nil {
+			return err
+		}
+	}
+	if len(imageIDs) == 0 {
+		fmt.Fprintf(os.Stderr, "No fs-layout outputs found in %s\n", cfg.Storage.OutputMountPath)
+		return nil
+	}
+
+	if *dryRun {
+		for _, imageID := range imageIDs {
+			fmt.Println(imageID)
+		}
+		return nil
+	}
+
+	cnt, err := container.New(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to initialize container: %w", err)
+	}
+	defer func() {
+		if err := cnt.Close(); err != nil {
+			log.Error("Failed to close container", "error", err)
+		}
+	}()
+
+	failed := 0
+	for i, imageID := range imageIDs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := cnt.JobOrchestrator.MigrateJob(ctx, imageID, *keepTiles); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] failed %s: %v\n", i+1, len(imageIDs), imageID, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "[%d/%d] migrated %s\n", i+1, len(imageIDs), imageID)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed to migrate", failed, len(imageIDs))
+	}
+	return nil
+}
+
+// findFSOutputs lists the image directories under root that hold tiles/ but no image.zip
+func findFSOutputs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list output mount: %w", err)
+	}
+	var imageIDs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if fileExistsAt(filepath.Join(dir, "tiles")) && !fileExistsAt(filepath.Join(dir, "image.zip")) {
+			imageIDs = append(imageIDs, entry.Name())
+		}
+	}
+	return imageIDs, nil
+}
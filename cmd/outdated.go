@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runOutdated finds the images on the output mount produced by an older pipeline
+// version (tiling parameters or software versions) and optionally requests their
+// re-processing
+func runOutdated(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("outdated", flag.ExitOnError)
+	outputRoot := fset.String("output-root", "", "Output root to scan (default OUTPUT_MOUNT_PATH)")
+	tenant := fset.String("tenant", "", "Tenant of the images (multi-tenant deployments, see TENANT_ROUTING_FILE)")
+	limit := fset.Int("limit", 0, "Requeue at most this many images, 0 for all")
+	publish := fset.Bool("publish", false, "Publish a forced processing request for every outdated image")
+	asJSON := fset.Bool("json", false, "Print the outdated images as JSON")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc outdated [options]\n\n")
+		fmt.Fprintf(os.Stderr, "List the images whose pipeline.json does not match the current pipeline\n")
+		fmt.Fprintf(os.Stderr, "version, a hash of the output settings and the software versions.\n")
+		fmt.Fprintf(os.Stderr, "Outputs without a pipeline.json predate the stamps and are listed too.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc outdated --publish --limit 100\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ApplyTenant(*tenant); err != nil {
+		return err
+	}
+	if err := utils.LoadSupportedFormats(); err != nil {
+		return fmt.Errorf("failed to load supported formats from embed: %w", err)
+	}
+	if *outputRoot == "" {
+		*outputRoot = cfg.Storage.OutputMountPath
+	}
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, log),
+		InfraStorage.NewMountStorage(*outputRoot, log))
+
+	outdated, err := svc.OutdatedOutputs(ctx, *outputRoot)
+	if err != nil {
+		return err
+	}
+
+	// The outputs do not record their original, it is looked up like for reprocess
+	var requeue []model.OutdatedImage
+	var unresolved []string
+	for i := range outdated {
+		image := &outdated[i]
+		image.Tenant = cfg.Tenant
+		image.BucketName = cfg.GCP.InputBucketName
+		origin, err := locateOriginal(cfg.Storage.InputMountPath, image.ImageID)
+		if err != nil {
+			log.Warn("Original of outdated image not found", "image_id", image.ImageID, "error", err)
+			unresolved = append(unresolved, image.ImageID)
+			continue
+		}
+		image.OriginPath = origin
+		if *limit == 0 || len(requeue) < *limit {
+			requeue = append(requeue, *image)
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(outdated); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "IMAGE\tPIPELINE\tVERSION\tORIGIN\n")
+		for _, image := range outdated {
+			pipeline := image.PipelineVersion
+			if pipeline == "" {
+				pipeline = "-"
+			}
+			origin := image.OriginPath
+			if origin == "" {
+				origin = "(not found)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", image.ImageID, pipeline, image.ProcessingVersion, origin)
+		}
+		w.Flush()
+		fmt.Printf("\n%d outdated images in %s, current pipeline version %s\n",
+			len(outdated), *outputRoot, svc.PipelineVersion(ctx))
+	}
+
+	if !*publish || len(requeue) == 0 {
+		return nil
+	}
+	// The local publisher would write the requests over the images' result.json
+	if !cfg.UsesPubSub() {
+		return fmt.Errorf("--publish needs a cloud environment or PUBSUB_EMULATOR_HOST (APP_ENV=%s)", cfg.Env)
+	}
+
+	cnt, err := container.New(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to initialize container: %w", err)
+	}
+	defer func() {
+		if err := cnt.Close(); err != nil {
+			log.Error("Failed to close container", "error", err)
+		}
+	}()
+
+	published, err := cnt.JobOrchestrator.RequeueOutdated(ctx, requeue)
+	fmt.Fprintf(os.Stderr, "Published %d of %d processing requests to %s\n", published, len(requeue), cfg.ImageRequestTopicID)
+	if err != nil {
+		return err
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("no original found for %d outdated images: %s", len(unresolved), strings.Join(unresolved, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// dirJob is one slide found under the input directory
+type dirJob struct {
+	ImageID string
+	Path    string
+}
+
+// dirResult is one row of the process-dir summary
+type dirResult struct {
+	Job      dirJob
+	Status   string
+	Duration time.Duration
+	Size     int64
+	Width    int
+	Height   int
+	Err      error
+}
+
+// runProcessDir processes every supported slide under a local directory with
+// jobs admitted by their estimated cost and writes a summary CSV next to the outputs
+func runProcessDir(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("process-dir", flag.ExitOnError)
+	inputDir := fset.String("input", "", "Directory of slides to process (required)")
+	fset.StringVar(inputDir, "i", "", "Directory of slides to process (shorthand)")
+	outputDir := fset.String("output", "./output", "Output root, each image is written to <output>/<image-id>")
+	fset.StringVar(outputDir, "o", "./output", "Output root (shorthand)")
+	version := fset.String("version", "v2", "Processing version (v1 = fs container, v2 = zip container)")
+	concurrency := fset.Int("concurrency", 0, "Upper bound of slides processed at once, admitted by estimated memory and scratch (default SCHEDULER_MAX_JOBS)")
+	recursive := fset.Bool("recursive", true, "Descend into subdirectories")
+	skipExisting := fset.Bool("skip-existing", false, "Skip slides whose output directory already holds image.dzi")
+	summaryPath := fset.String("summary", "", "Summary CSV path (default <output>/summary.csv)")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+	logFormat := fset.String("log-format", "text", "Log format (text or json)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc process-dir [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Process every supported slide under a local directory.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc process-dir -i ./slides -o ./processed --concurrency 2\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *inputDir == "" {
+		fset.Usage()
+		return fmt.Errorf("--input is required")
+	}
+	if *version != "v1" && *version != "v2" {
+		return fmt.Errorf("invalid --version %q, expected v1 or v2", *version)
+	}
+	container := "zip"
+	if *version == "v1" {
+		container = "fs"
+	}
+
+	absInput, err := filepath.Abs(*inputDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve input path: %w", err)
+	}
+	absOutput, err := filepath.Abs(*outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output path: %w", err)
+	}
+	if err := os.MkdirAll(absOutput, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if *summaryPath == "" {
+		*summaryPath = filepath.Join(absOutput, "summary.csv")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: *logFormat,
+	})
+
+	os.Setenv("INPUT_MOUNT_PATH", absInput)
+	os.Setenv("OUTPUT_MOUNT_PATH", absOutput)
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := utils.LoadSupportedFormats(); err != nil {
+		return fmt.Errorf("failed to load supported formats from embed: %w", err)
+	}
+
+	jobs, err := findSlides(ctx, absInput, *recursive)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no supported slides found in %s", absInput)
+	}
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(absInput, log),
+		InfraStorage.NewMountStorage(absOutput, log))
+	scheduler := service.NewJobScheduler(log, cfg)
+
+	limit := *concurrency
+	if limit <= 0 {
+		limit = scheduler.MaxJobs()
+	}
+
+	fmt.Fprintf(os.Stderr, "Processing %d slides from %s with up to %d at once\n", len(jobs), absInput, limit)
+
+	var mu sync.Mutex
+	results := make([]dirResult, 0, len(jobs))
+	done := 0
+
+	g := new(errgroup.Group)
+	g.SetLimit(limit)
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			var result dirResult
+			if *skipExisting && fileExistsAt(filepath.Join(absOutput, job.ImageID, "image.dzi")) {
+				result = dirResult{Job: job, Status: "skipped"}
+			} else {
+				result = processDirSlide(ctx, svc, scheduler, job, container)
+			}
+
+			mu.Lock()
+			results = append(results, result)
+			done++
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s (%s)\n", done, len(jobs), result.Status, job.ImageID, result.Duration.Round(time.Second))
+			mu.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Job.ImageID < results[j].Job.ImageID })
+	if err := writeDirSummary(*summaryPath, results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == "failed" {
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Done: %d processed, %d failed, summary written to %s\n", len(results)-failed, failed, *summaryPath)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d slides failed", failed, len(results))
+	}
+	return nil
+}
+
+func processDirSlide(ctx context.Context, svc *service.ImageProcessingService, scheduler *service.JobScheduler, job dirJob, container string) dirResult {
+	startedAt := time.Now()
+	result := dirResult{Job: job, Status: "ok"}
+	fail := func(err error) dirResult {
+		result.Status = "failed"
+		result.Err = err
+		result.Duration = time.Since(startedAt)
+		return result
+	}
+
+	file, err := model.NewFile(job.ImageID, job.Path, "", nil, nil, nil, nil)
+	if err != nil {
+		return fail(err)
+	}
+
+	size, err := svc.InputSize(ctx, file)
+	if err != nil {
+		return fail(err)
+	}
+	release, err := scheduler.Admit(ctx, scheduler.Cost(file, size))
+	if err != nil {
+		return fail(err)
+	}
+	defer release()
+
+	workspace, err := svc.ProcessFile(ctx, file, container)
+	if err != nil {
+		return fail(err)
+	}
+	workspace.Remove()
+
+	result.Duration = time.Since(startedAt)
+	result.Size = size
+	result.Width = file.WidthValue()
+	result.Height = file.HeightValue()
+	return result
+}
+
+// findSlides lists the supported slides under dir. Image IDs are the relative
+// path without extension, with separators replaced so nested slides stay unique.
+func findSlides(ctx context.Context, dir string, recursive bool) ([]dirJob, error) {
+	var jobs []dirJob
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !utils.SupportedFormats.IsSupported(filepath.Ext(path)) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		id := strings.TrimSuffix(rel, filepath.Ext(rel))
+		id = strings.ReplaceAll(filepath.ToSlash(id), "/", "__")
+		jobs = append(jobs, dirJob{ImageID: id, Path: path})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk input directory: %w", err)
+	}
+	return jobs, nil
+}
+
+func writeDirSummary(path string, results []dirResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create summary: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"image_id", "input_path", "status", "duration_s", "size_bytes", "width", "height", "error"})
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		w.Write([]string{
+			r.Job.ImageID,
+			r.Job.Path,
+			r.Status,
+			strconv.FormatFloat(r.Duration.Seconds(), 'f', 1, 64),
+			strconv.FormatInt(r.Size, 10),
+			strconv.Itoa(r.Width),
+			strconv.Itoa(r.Height),
+			errText,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
+
+func fileExistsAt(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
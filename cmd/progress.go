@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/service"
+)
+
+// progressRedrawInterval throttles redraws caused by percentage updates
+const progressRedrawInterval = 100 * time.Millisecond
+
+const progressBarWidth = 30
+
+// isInteractive reports whether f is a terminal that understands cursor movement
+func isInteractive(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressStep is the last known state of one step
+type progressStep struct {
+	name      string
+	status    service.ProgressStatus
+	percent   int
+	startedAt time.Time
+	elapsed   time.Duration
+	err       error
+}
+
+// progressRenderer draws one line per step of a local job, redrawing them in place
+// as progress updates arrive, and prints a summary when the job ends
+type progressRenderer struct {
+	out   io.Writer
+	color bool
+
+	mu        sync.Mutex
+	steps     []*progressStep // In the order they were first reported
+	byName    map[string]*progressStep
+	drawn     int // Lines written by the last draw
+	lastDraw  time.Time
+	startedAt time.Time
+}
+
+func newProgressRenderer(out io.Writer) *progressRenderer {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return &progressRenderer{
+		out:       out,
+		color:     !noColor,
+		byName:    make(map[string]*progressStep),
+		startedAt: time.Now(),
+	}
+}
+
+// Update is the service.ProgressFunc of the renderer
+func (r *progressRenderer) Update(p service.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	step, ok := r.byName[p.Step]
+	if !ok {
+		step = &progressStep{name: p.Step, percent: -1}
+		r.byName[p.Step] = step
+		r.steps = append(r.steps, step)
+	}
+
+	switch p.Status {
+	case service.ProgressStarted:
+		step.startedAt = time.Now()
+	case service.ProgressRunning:
+		step.percent = p.Percent
+		if p.Status == step.status && time.Since(r.lastDraw) < progressRedrawInterval {
+			return
+		}
+	case service.ProgressCompleted, service.ProgressFailed:
+		step.elapsed = p.Elapsed
+		step.err = p.Err
+	}
+	step.status = p.Status
+	r.draw()
+}
+
+// draw moves the cursor back over the previous drawing and writes every step line
+func (r *progressRenderer) draw() {
+	var b strings.Builder
+	if r.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", r.drawn)
+	}
+	for _, step := range r.steps {
+		b.WriteString("\r\033[2K")
+		b.WriteString(r.stepLine(step))
+		b.WriteByte('\n')
+	}
+	io.WriteString(r.out, b.String())
+	r.drawn = len(r.steps)
+	r.lastDraw = time.Now()
+}
+
+func (r *progressRenderer) stepLine(step *progressStep) string {
+	name := fmt.Sprintf("%-16s", step.name)
+	switch step.status {
+	case service.ProgressCompleted:
+		return fmt.Sprintf("  %s %s %s", r.paint("32", "✓"), name, r.paint("2", formatElapsed(step.elapsed)))
+	case service.ProgressFailed:
+		return fmt.Sprintf("  %s %s %s %s", r.paint("31", "✗"), name, r.paint("2", formatElapsed(step.elapsed)), r.paint("31", firstLine(step.err)))
+	case service.ProgressSkipped:
+		return fmt.Sprintf("  %s %s %s", r.paint("2", "-"), r.paint("2", name), r.paint("2", "skipped"))
+	}
+
+	running := formatElapsed(time.Since(step.startedAt))
+	if step.percent < 0 {
+		return fmt.Sprintf("  %s %s %s", r.paint("33", "•"), name, r.paint("2", running))
+	}
+	filled := step.percent * progressBarWidth / 100
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	return fmt.Sprintf("  %s %s %s %3d%% %s", r.paint("33", "•"), name, r.paint("36", bar), step.percent, r.paint("2", running))
+}
+
+// Finish prints the summary of the job. The step lines are already final, every
+// state change was drawn when it arrived.
+func (r *progressRenderer) Finish(imageID, outputDir string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	completed, skipped := 0, 0
+	for _, step := range r.steps {
+		switch step.status {
+		case service.ProgressCompleted:
+			completed++
+		case service.ProgressSkipped:
+			skipped++
+		}
+	}
+
+	elapsed := formatElapsed(time.Since(r.startedAt))
+	fmt.Fprintln(r.out)
+	if err != nil {
+		fmt.Fprintf(r.out, "%s %s after %s\n", r.paint("1;31", "✗ Failed"), imageID, elapsed)
+		fmt.Fprintf(r.out, "  %s\n", err)
+		return
+	}
+	fmt.Fprintf(r.out, "%s %s in %s (%d steps, %d skipped)\n", r.paint("1;32", "✓ Processed"), imageID, elapsed, completed, skipped)
+	fmt.Fprintf(r.out, "  outputs: %s\n", outputDir)
+}
+
+// paint wraps s in an SGR color code unless NO_COLOR is set
+func (r *progressRenderer) paint(code, s string) string {
+	if !r.color {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+func formatElapsed(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func firstLine(err error) string {
+	if err == nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(err.Error(), "\n")
+	return line
+}
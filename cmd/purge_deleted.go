@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runPurgeDeleted removes the outputs of deleted images whose retention window
+// (DELETE_RETENTION_HOURS) has passed
+func runPurgeDeleted(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("purge-deleted", flag.ExitOnError)
+	tenant := fset.String("tenant", "", "Tenant of the images (multi-tenant deployments, see TENANT_ROUTING_FILE)")
+	dryRun := fset.Bool("dry-run", false, "List the expired outputs without removing them")
+	asJSON := fset.Bool("json", false, "Print the result as JSON")
+	logLevel := fset.String("log-level", "WARN", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc purge-deleted [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Remove the outputs on OUTPUT_MOUNT_PATH whose .deleted.json marker is past\n")
+		fmt.Fprintf(os.Stderr, "its purge_after time. Run it periodically when DELETE_RETENTION_HOURS is set.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ApplyTenant(*tenant); err != nil {
+		return err
+	}
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, log),
+		InfraStorage.NewMountStorage(cfg.Storage.OutputMountPath, log))
+
+	result, err := svc.PurgeDeleted(ctx, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		verb := "Purged"
+		if *dryRun {
+			verb = "Would purge"
+		}
+		for _, prefix := range result.Purged {
+			fmt.Printf("%s %s\n", verb, prefix)
+		}
+		for _, prefix := range result.Failed {
+			fmt.Printf("Failed to purge %s\n", prefix)
+		}
+		fmt.Printf("%s %d deleted outputs in %s, %d within their retention window\n",
+			verb, len(result.Purged), result.Root, result.Pending)
+	}
+
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d deleted outputs could not be purged", len(result.Failed))
+	}
+	return nil
+}
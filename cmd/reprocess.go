@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/utils"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// reprocessOverrideKeys are the settings a reprocess request may override
+var reprocessOverrideKeys = map[string]bool{
+	"TILE_SIZE":                true,
+	"OVERLAP":                  true,
+	"QUALITY":                  true,
+	"DZI_LAYOUT":               true,
+	"DZI_SUFFIX":               true,
+	"DZI_COMPRESSION":          true,
+	"DZI_DEDUP":                true,
+	"THUMBNAIL_SIZE":           true,
+	"THUMBNAIL_QUALITY":        true,
+	"THUMBNAIL_WIDTH":          true,
+	"THUMBNAIL_HEIGHT":         true,
+	"THUMBNAIL_MODE":           true,
+	"STATS_ENABLED":            true,
+	"OVERVIEW_ENABLED":         true,
+	"WATERMARK_ENABLED":        true,
+	"CHANNEL_LUT":              true,
+	"CHANNEL_RESCALE":          true,
+	"INPUT_STAGING":            true,
+	"DNG_WHITE_BALANCE":        true,
+	"DNG_GAMMA":                true,
+	"DNG_HIGHLIGHT":            true,
+	"DNG_COLOR_SPACE":          true,
+	"INTERMEDIATE_FORMAT":      true,
+	"INTERMEDIATE_COMPRESSION": true,
+	"INTERMEDIATE_BIT_DEPTH":   true,
+	"QC_ENABLED":               true,
+	"QC_HOLD_FAILED":           true,
+}
+
+// overrideFlags collects repeated --set KEY=VALUE flags
+type overrideFlags map[string]string
+
+func (o overrideFlags) String() string {
+	pairs := make([]string, 0, len(o))
+	for key, value := range o {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (o overrideFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.ToUpper(strings.TrimSpace(key))
+	if !ok || key == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", value)
+	}
+	if !reprocessOverrideKeys[key] {
+		return fmt.Errorf("%s cannot be overridden", key)
+	}
+	o[key] = val
+	return nil
+}
+
+// retileOverrideKeys are the settings that can change with --from-level; the others
+// change the tile grid or every level
+var retileOverrideKeys = map[string]bool{
+	"QUALITY": true,
+}
+
+// runReprocess reruns the processing job of a single image, either directly in this
+// process or by publishing a request event, to fix individual bad slides
+func runReprocess(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("reprocess", flag.ExitOnError)
+	originPath := fset.String("origin-path", "", "Original path relative to the input mount (default: looked up by image ID)")
+	version := fset.String("version", "v2", "Processing version (v1 = fs container, v2 = zip container)")
+	force := fset.Bool("force", false, "Reprocess even if the image already has published outputs")
+	publish := fset.Bool("publish", false, "Publish a request event instead of running the job here")
+	dryRun := fset.Bool("dry-run", false, "Print the resolved request without running or publishing it")
+	tenant := fset.String("tenant", "", "Tenant of the image (multi-tenant deployments, see TENANT_ROUTING_FILE)")
+	fromLevel := fset.Int("from-level", 0, "Only regenerate the fs-layout levels below this one from its stored tiles (see --set QUALITY)")
+	overrides := overrideFlags{}
+	fset.Var(overrides, "set", "Setting override as KEY=VALUE, repeatable (e.g. TILE_SIZE=512)")
+	logLevel := fset.String("log-level", "INFO", "Log level (DEBUG, INFO, WARN, ERROR)")
+	logFormat := fset.String("log-format", "text", "Log format (text or json)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc reprocess [options] <image-id>\n\n")
+		fmt.Fprintf(os.Stderr, "Reprocess one image. The original is looked up on the input mount as\n")
+		fmt.Fprintf(os.Stderr, "<image-id>/<file> or <image-id>-<file> unless --origin-path is given.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nOverridable settings:\n  ")
+		keys := make([]string, 0, len(reprocessOverrideKeys))
+		for key := range reprocessOverrideKeys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(os.Stderr, "%s\n", strings.Join(keys, ", "))
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc reprocess --force --set QUALITY=90 --set TILE_SIZE=512 my-img-001\n")
+		fmt.Fprintf(os.Stderr, "  himgproc reprocess --from-level 10 --set QUALITY=70 my-img-001\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return fmt.Errorf("exactly one image ID is required")
+	}
+	imageID := fset.Arg(0)
+	if err := model.ValidateImageID(imageID); err != nil {
+		return err
+	}
+	if *originPath != "" {
+		if err := model.ValidateRelativePath("--origin-path", *originPath); err != nil {
+			return err
+		}
+	}
+	if *version != "v1" && *version != "v2" {
+		return fmt.Errorf("invalid --version %q, expected v1 or v2", *version)
+	}
+	if *fromLevel > 0 {
+		if *publish {
+			return fmt.Errorf("--from-level runs here, it cannot be combined with --publish")
+		}
+		for key := range overrides {
+			if !retileOverrideKeys[key] {
+				return fmt.Errorf("%s changes every level, reprocess without --from-level", key)
+			}
+		}
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: *logFormat,
+	})
+
+	// Direct runs pick the overrides up through the config loader
+	if !*publish && !*dryRun {
+		for key, value := range overrides {
+			os.Setenv(key, value)
+		}
+	}
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := cfg.ApplyTenant(*tenant); err != nil {
+		return err
+	}
+	if err := utils.LoadSupportedFormats(); err != nil {
+		return fmt.Errorf("failed to load supported formats from embed: %w", err)
+	}
+
+	if *fromLevel > 0 && !*dryRun {
+		return runRetile(ctx, cfg, log, imageID, *fromLevel)
+	}
+
+	origin := *originPath
+	if origin == "" {
+		origin, err = locateOriginal(cfg.Storage.InputMountPath, imageID)
+		if err != nil {
+			return err
+		}
+	} else if !fileExistsAt(filepath.Join(cfg.Storage.InputMountPath, origin)) {
+		return fmt.Errorf("original %s not found on the input mount %s", origin, cfg.Storage.InputMountPath)
+	}
+
+	outputDir := filepath.Join(cfg.Storage.OutputMountPath, imageID)
+	if !*force && fileExistsAt(filepath.Join(outputDir, "image.dzi")) {
+		return fmt.Errorf("%s already has outputs in %s, use --force to reprocess", imageID, outputDir)
+	}
+
+	request := &events.ImageProcessRequestEvent{
+		BaseEvent:         events.NewBaseEvent(events.ImageProcessRequestEventType),
+		ImageID:           imageID,
+		OriginPath:        origin,
+		ProcessingVersion: *version,
+		BucketName:        cfg.GCP.InputBucketName,
+		Tenant:            cfg.Tenant,
+		Overrides:         overrides,
+		Force:             *force,
+	}
+
+	log.Info("Reprocess request resolved",
+		"image_id", imageID,
+		"origin_path", origin,
+		"version", *version,
+		"overrides", overrides.String(),
+		"publish", *publish)
+
+	if *dryRun {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(request)
+	}
+	if *publish {
+		// The local publisher would write the request over the image's result.json
+		if !cfg.UsesPubSub() {
+			return fmt.Errorf("--publish needs a cloud environment or PUBSUB_EMULATOR_HOST (APP_ENV=%s)", cfg.Env)
+		}
+		cnt, err := container.New(ctx, cfg, log)
+		if err != nil {
+			return fmt.Errorf("failed to initialize container: %w", err)
+		}
+		defer func() {
+			if err := cnt.Close(); err != nil {
+				log.Error("Failed to close container", "error", err)
+			}
+		}()
+		if err := publishRequest(ctx, cnt, request); err != nil {
+			return err
+		}
+		log.Info("Reprocess request published",
+			"image_id", imageID,
+			"topic", cfg.ImageRequestTopicID,
+			"event_id", request.EventID)
+		return nil
+	}
+
+	bucket := cfg.GCP.InputBucketName
+	if bucket == "" {
+		bucket = "local"
+	}
+	input, err := model.NewJobInputFromEnv(imageID, origin, *version, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to create job input: %w", err)
+	}
+	input.Tenant = cfg.Tenant
+
+	// Local runs write to the output mount directly, so point it at the image directory
+	if !cfg.UsesGCS() {
+		cfg.Storage.OutputMountPath = outputDir
+	}
+
+	cnt, err := container.New(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to initialize container: %w", err)
+	}
+	defer func() {
+		if err := cnt.Close(); err != nil {
+			log.Error("Failed to close container", "error", err)
+		}
+	}()
+
+	if err := cnt.JobOrchestrator.ProcessJob(ctx, input); err != nil {
+		return fmt.Errorf("image processing failed: %w", err)
+	}
+
+	log.Info("Reprocess completed successfully", "image_id", imageID)
+	return nil
+}
+
+// runRetile regenerates the low pyramid levels of an image from its stored tiles
+func runRetile(ctx context.Context, cfg *config.Config, log *slog.Logger, imageID string, fromLevel int) error {
+	outputDir := filepath.Join(cfg.Storage.OutputMountPath, imageID)
+	if !fileExistsAt(filepath.Join(outputDir, "image.dzi")) {
+		return fmt.Errorf("%s has no outputs in %s to re-tile", imageID, outputDir)
+	}
+
+	cnt, err := container.New(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to initialize container: %w", err)
+	}
+	defer func() {
+		if err := cnt.Close(); err != nil {
+			log.Error("Failed to close container", "error", err)
+		}
+	}()
+
+	if err := cnt.JobOrchestrator.RetileJob(ctx, imageID, fromLevel); err != nil {
+		return fmt.Errorf("re-tiling failed: %w", err)
+	}
+
+	log.Info("Re-tiling completed successfully", "image_id", imageID, "from_level", fromLevel)
+	return nil
+}
+
+// publishRequest publishes a processing request to the request topic
+func publishRequest(ctx context.Context, cnt *container.Container, request *events.ImageProcessRequestEvent) error {
+	data, err := cnt.EventSerializer.Serialize(request)
+	if err != nil {
+		return err
+	}
+	attributes := map[string]string{
+		"event_type": string(request.GetEventType()),
+		"image_id":   request.GetImageID(),
+	}
+	if request.Tenant != "" {
+		attributes["tenant"] = request.Tenant
+	}
+	if err := cnt.EventPublisher.Publish(ctx, cnt.Config.ImageRequestTopicID, data, attributes); err != nil {
+		return fmt.Errorf("failed to publish request: %w", err)
+	}
+	return nil
+}
+
+// locateOriginal finds the original of an image on the input mount, stored either as
+// <image-id>/<file> or as <image-id>-<file>, and returns its path relative to the mount
+func locateOriginal(root, imageID string) (string, error) {
+	var candidates []string
+
+	if entries, err := os.ReadDir(filepath.Join(root, imageID)); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() && utils.SupportedFormats.IsSupported(filepath.Ext(entry.Name())) {
+				candidates = append(candidates, filepath.Join(imageID, entry.Name()))
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return "", fmt.Errorf("failed to list input mount %s: %w", root, err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !utils.SupportedFormats.IsSupported(filepath.Ext(name)) {
+				continue
+			}
+			if strings.HasPrefix(name, imageID+"-") || strings.TrimSuffix(name, filepath.Ext(name)) == imageID {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no original found for %s on the input mount %s, use --origin-path", imageID, root)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("several originals found for %s (%s), use --origin-path", imageID, strings.Join(candidates, ", "))
+	}
+}
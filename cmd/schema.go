@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/histopathai/image-processing-service/pkg/eventschema"
+)
+
+// runSchema prints the JSON Schemas of the events, or checks event files against them
+func runSchema(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("schema", flag.ExitOnError)
+	check := fset.Bool("check", false, "Validate the given event files (- for stdin) instead of printing schemas")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc schema [event-type]\n")
+		fmt.Fprintf(os.Stderr, "       himgproc schema --check <event.json | -> ...\n\n")
+		fmt.Fprintf(os.Stderr, "List the event types, print the JSON Schema of one, or validate event files.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc schema --check ./test-data/output/my-img-001/result.json\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	if *check {
+		if fset.NArg() == 0 {
+			fset.Usage()
+			return fmt.Errorf("at least one event file is required")
+		}
+		invalid := 0
+		for _, source := range fset.Args() {
+			var data []byte
+			var err error
+			if source == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(source)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read event: %w", err)
+			}
+			if err := eventschema.ValidateEvent(data); err != nil {
+				fmt.Printf("INVALID %s: %v\n", source, err)
+				invalid++
+				continue
+			}
+			fmt.Printf("ok      %s\n", source)
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%d of %d events are invalid", invalid, fset.NArg())
+		}
+		return nil
+	}
+
+	switch fset.NArg() {
+	case 0:
+		for _, eventType := range eventschema.Types() {
+			fmt.Println(eventType)
+		}
+		return nil
+	case 1:
+		data, err := eventschema.Schema(fset.Arg(0))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	default:
+		fset.Usage()
+		return fmt.Errorf("at most one event type is allowed")
+	}
+}
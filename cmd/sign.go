@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// maxSignedURLExpiry is the longest lifetime V4 signed URLs support
+const maxSignedURLExpiry = 7 * 24 * time.Hour
+
+// runSign prints signed URLs for the published outputs of an image, for handing a
+// single image to someone without bucket access
+func runSign(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("sign", flag.ExitOnError)
+	expires := fset.Duration("expires", time.Hour, "URL lifetime (at most 168h)")
+	asJSON := fset.Bool("json", false, "Print the URLs as a JSON object keyed by file name")
+	logLevel := fset.String("log-level", "ERROR", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc sign [options] <image-id> [file...]\n\n")
+		fmt.Fprintf(os.Stderr, "Mint signed GET URLs for an image's outputs in the processed bucket.\n")
+		fmt.Fprintf(os.Stderr, "Without files every object directly under <image-id>/ is signed. Content-addressed\n")
+		fmt.Fprintf(os.Stderr, "outputs are signed by their prefix, e.g. content/<sha256>.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  himgproc sign --expires 24h my-img-001 image.dzi image.zip IndexMap.json\n")
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 {
+		fset.Usage()
+		return fmt.Errorf("an image ID is required")
+	}
+	if *expires <= 0 || *expires > maxSignedURLExpiry {
+		return fmt.Errorf("--expires must be between 0 and %s", maxSignedURLExpiry)
+	}
+	imageID := fset.Arg(0)
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Env == config.EnvLocal {
+		return fmt.Errorf("signed URLs need a cloud environment (APP_ENV=%s)", cfg.Env)
+	}
+	if cfg.GCP.OutputBucketName == "" {
+		return fmt.Errorf("PROCESSED_BUCKET_NAME is not set")
+	}
+
+	client, err := container.NewStorageClient(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer client.Close()
+
+	gcs := InfraStorage.NewGCSStorage(log, client, cfg.GCP.OutputBucketName)
+	urls, err := gcs.SignedURLs(ctx, imageID, fset.Args()[1:], *expires)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no outputs found for %s in gs://%s", imageID, cfg.GCP.OutputBucketName)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(urls)
+	}
+
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Signed %d URLs for %s, valid until %s\n", len(urls), imageID, time.Now().Add(*expires).Format(time.RFC3339))
+	for _, name := range names {
+		fmt.Printf("%s\t%s\n", name, urls[name])
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runTranscode re-encodes the stored tiles of images in another format or quality
+// under a parallel output prefix and publishes a completion event for each
+func runTranscode(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("transcode", flag.ExitOnError)
+	format := fset.String("format", "webp", "Tile format of the output (jpg, jpeg, webp or png)")
+	quality := fset.Int("quality", 0, "Tile quality 1-100 (default env QUALITY)")
+	prefix := fset.String("prefix", "", "Output directory on the output mount (default <image-id>-<format>, one image only)")
+	logLevel := fset.String("log-level", "INFO", "Log level (DEBUG, INFO, WARN, ERROR)")
+	logFormat := fset.String("log-format", "text", "Log format (text or json)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc transcode [options] <image-id>...\n\n")
+		fmt.Fprintf(os.Stderr, "Re-encode the stored tiles (tiles/ or image.zip) of images into a parallel output prefix.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return fmt.Errorf("pass at least one image ID")
+	}
+	if *prefix != "" && fset.NArg() > 1 {
+		return fmt.Errorf("--prefix takes a single image ID")
+	}
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: *logFormat,
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	inputs := make([]*model.JobInput, 0, fset.NArg())
+	for _, imageID := range fset.Args() {
+		input, err := model.NewTranscodeJobInput(imageID, "local", &model.TranscodeSpec{
+			Format:  strings.ToLower(*format),
+			Quality: *quality,
+			Prefix:  *prefix,
+		})
+		if err != nil {
+			return err
+		}
+		input.Tenant = cfg.Tenant
+		inputs = append(inputs, input)
+	}
+
+	cnt, err := container.New(ctx, cfg, log)
+	if err != nil {
+		return fmt.Errorf("failed to initialize container: %w", err)
+	}
+	defer func() {
+		if err := cnt.Close(); err != nil {
+			log.Error("Failed to close container", "error", err)
+		}
+	}()
+
+	failed := 0
+	for i, input := range inputs {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := cnt.JobOrchestrator.ProcessJob(ctx, input); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "[%d/%d] failed %s: %v\n", i+1, len(inputs), input.ImageID, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "[%d/%d] transcoded %s to %s\n", i+1, len(inputs), input.ImageID, input.Transcode.Prefix)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed to transcode", failed, len(inputs))
+	}
+	return nil
+}
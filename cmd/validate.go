@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/internal/service"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+)
+
+// runValidate checks published outputs (descriptor, IndexMap.json and tiles) of an
+// image, e.g. after a bucket migration, and fails when anything is missing or corrupt
+func runValidate(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("validate", flag.ExitOnError)
+	outputRoot := fset.String("output-root", "", "Output root the image ID is resolved against (default OUTPUT_MOUNT_PATH)")
+	deep := fset.Bool("deep", false, "Read and decode every tile (verifies zip CRCs and tile headers)")
+	asJSON := fset.Bool("json", false, "Print the result as JSON")
+	logLevel := fset.String("log-level", "ERROR", "Log level (DEBUG, INFO, WARN, ERROR)")
+
+	fset.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: himgproc validate [options] <image-id | output-dir>\n\n")
+		fmt.Fprintf(os.Stderr, "Check the published DZI descriptor, IndexMap.json and tile pyramid of an image.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fset.PrintDefaults()
+	}
+
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return fmt.Errorf("exactly one image ID or output directory is required")
+	}
+	target := fset.Arg(0)
+
+	log := logger.New(logger.Config{
+		Level:  strings.ToLower(*logLevel),
+		Format: "text",
+	})
+
+	cfg, err := config.LoadConfig(log)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// An existing directory is used as is, anything else is an image ID under the output root
+	dir := target
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		root := *outputRoot
+		if root == "" {
+			root = cfg.Storage.OutputMountPath
+		}
+		dir = filepath.Join(root, target)
+	}
+
+	svc := service.NewImageProcessingService(log, cfg,
+		InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, log),
+		InfraStorage.NewMountStorage(cfg.Storage.OutputMountPath, log))
+
+	result, err := svc.ValidateStored(ctx, dir, *deep)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		printValidation(result)
+	}
+
+	if !result.OK() {
+		return fmt.Errorf("outputs in %s are invalid", dir)
+	}
+	return nil
+}
+
+func printValidation(v *service.StoredValidation) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Directory:\t%s\n", v.Dir)
+	fmt.Fprintf(w, "Container:\t%s\n", v.Container)
+	if d := v.Descriptor; d != nil {
+		fmt.Fprintf(w, "Descriptor:\t%d x %d, tile %d, overlap %d, %s\n", d.Width, d.Height, d.TileSize, d.Overlap, d.Format)
+	}
+	for _, level := range v.Levels {
+		status := "ok"
+		if !level.Complete() {
+			status = "INCOMPLETE"
+		}
+		fmt.Fprintf(w, "Level %d:\t%d/%d\t%s\n", level.Level, level.Found, level.Expected, status)
+	}
+	if v.TilesChecked > 0 {
+		fmt.Fprintf(w, "Tiles decoded:\t%d\n", v.TilesChecked)
+	}
+	fmt.Fprintf(w, "Missing tiles:\t%d\n", v.MissingCount)
+	fmt.Fprintf(w, "Unexpected tiles:\t%d\n", v.UnexpectedCount)
+	fmt.Fprintf(w, "Corrupt tiles:\t%d\n", v.CorruptCount)
+	w.Flush()
+
+	printList := func(title string, items []string, total int) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Printf("\n%s", title)
+		if total > len(items) {
+			fmt.Printf(" (first %d of %d)", len(items), total)
+		}
+		fmt.Println(":")
+		for _, item := range items {
+			fmt.Printf("  %s\n", item)
+		}
+	}
+	printList("Missing", v.Missing, v.MissingCount)
+	printList("Unexpected", v.Unexpected, v.UnexpectedCount)
+	printList("Corrupt", v.Corrupt, v.CorruptCount)
+	printList("Issues", v.Issues, len(v.Issues))
+
+	if v.OK() {
+		fmt.Println("\nResult: OK")
+	} else {
+		fmt.Println("\nResult: FAILED")
+	}
+}
@@ -54,6 +54,7 @@ locals {
 
   # Construct the topic name with the appropriate prefix
   processing_completed_topic = "${local.pubsub_prefix}image-processing-results"
+  processing_dlq_topic       = "${local.pubsub_prefix}image-processing-dlq"
 
   input_mount_path  = "/gcs/${local.original_bucket_name}"
   output_mount_path = "/gcs/${local.processed_bucket_name}"
@@ -181,6 +182,20 @@ resource "google_cloud_run_v2_job" "image_processing_job" {
           name  = "IMAGE_PROCESS_RESULT_TOPIC_ID"
           value = local.processing_completed_topic
         }
+        env {
+          name  = "IMAGE_PROCESS_DLQ_TOPIC_ID"
+          value = local.processing_dlq_topic
+        }
+        # Processing stops JOB_CLEANUP_RESERVE_SECONDS before the task timeout
+        env {
+          name  = "JOB_TIMEOUT_SECONDS"
+          value = trimsuffix(each.value.timeout, "s")
+        }
+        # The last task attempt only dead-letters images whose earlier attempts crashed
+        env {
+          name  = "POISON_MAX_ATTEMPTS"
+          value = each.value.max_retries
+        }
         env {
           name  = "INPUT_MOUNT_PATH"
           value = local.input_mount_path
@@ -0,0 +1,171 @@
+// Package dzi models Deep Zoom Image descriptors (.dzi) and the pyramid
+// geometry they imply.
+package dzi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const Namespace = "http://schemas.microsoft.com/deepzoom/2008"
+
+// Descriptor is the content of a .dzi file
+type Descriptor struct {
+	TileSize int
+	Overlap  int
+	Format   string // Tile file extension, e.g. jpeg or png
+	Width    int
+	Height   int
+}
+
+type xmlSize struct {
+	Width  int `xml:"Width,attr"`
+	Height int `xml:"Height,attr"`
+}
+
+type xmlImage struct {
+	XMLName  xml.Name `xml:"Image"`
+	Xmlns    string   `xml:"xmlns,attr,omitempty"`
+	Format   string   `xml:"Format,attr"`
+	Overlap  int      `xml:"Overlap,attr"`
+	TileSize int      `xml:"TileSize,attr"`
+	Size     xmlSize  `xml:"Size"`
+}
+
+// Parse reads a .dzi XML document
+func Parse(r io.Reader) (*Descriptor, error) {
+	var doc xmlImage
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid dzi document: %w", err)
+	}
+
+	d := &Descriptor{
+		TileSize: doc.TileSize,
+		Overlap:  doc.Overlap,
+		Format:   doc.Format,
+		Width:    doc.Size.Width,
+		Height:   doc.Size.Height,
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ParseFile reads the .dzi file at path
+func ParseFile(path string) (*Descriptor, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dzi file: %w", err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+func (d *Descriptor) Validate() error {
+	if d.TileSize <= 0 {
+		return fmt.Errorf("dzi tile size must be positive, got %d", d.TileSize)
+	}
+	if d.Overlap < 0 {
+		return fmt.Errorf("dzi overlap must not be negative, got %d", d.Overlap)
+	}
+	if d.Width <= 0 || d.Height <= 0 {
+		return fmt.Errorf("dzi size must be positive, got %dx%d", d.Width, d.Height)
+	}
+	if d.Format == "" {
+		return fmt.Errorf("dzi format is required")
+	}
+	return nil
+}
+
+// Write encodes the descriptor as a .dzi XML document
+func (d *Descriptor) Write(w io.Writer) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	doc := xmlImage{
+		Xmlns:    Namespace,
+		Format:   d.Format,
+		Overlap:  d.Overlap,
+		TileSize: d.TileSize,
+		Size:     xmlSize{Width: d.Width, Height: d.Height},
+	}
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile writes the descriptor to path
+func (d *Descriptor) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create dzi file: %w", err)
+	}
+	if err := d.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MaxLevel is the index of the full-resolution level; level 0 is 1x1
+func (d *Descriptor) MaxLevel() int {
+	return int(math.Ceil(math.Log2(float64(max(d.Width, d.Height)))))
+}
+
+// LevelCount is the number of pyramid levels
+func (d *Descriptor) LevelCount() int {
+	return d.MaxLevel() + 1
+}
+
+// LevelSize returns the image dimensions at level
+func (d *Descriptor) LevelSize(level int) (int, int) {
+	scale := math.Pow(2, float64(d.MaxLevel()-level))
+	return int(math.Ceil(float64(d.Width) / scale)), int(math.Ceil(float64(d.Height) / scale))
+}
+
+// LevelTiles returns the tile grid (columns, rows) at level
+func (d *Descriptor) LevelTiles(level int) (int, int) {
+	w, h := d.LevelSize(level)
+	return (w + d.TileSize - 1) / d.TileSize, (h + d.TileSize - 1) / d.TileSize
+}
+
+// ExpectedTiles is the number of tiles a complete level contains
+func (d *Descriptor) ExpectedTiles(level int) int {
+	cols, rows := d.LevelTiles(level)
+	return cols * rows
+}
+
+// TotalTiles is the number of tiles across all levels
+func (d *Descriptor) TotalTiles() int {
+	total := 0
+	for level := 0; level < d.LevelCount(); level++ {
+		total += d.ExpectedTiles(level)
+	}
+	return total
+}
+
+// TileName is the path of a tile relative to the <name>_files directory
+func (d *Descriptor) TileName(level, col, row int) string {
+	return fmt.Sprintf("%d/%d_%d.%s", level, col, row, d.Format)
+}
+
+// FormatForSuffix maps a tile suffix (jpg, .png, .jpg[Q=90], ...) to the Format value
+// dzsave writes: the extension of the tiles, without the dot or the saver options
+func FormatForSuffix(suffix string) string {
+	if i := strings.Index(suffix, "["); i >= 0 {
+		suffix = suffix[:i]
+	}
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(suffix), "."))
+}
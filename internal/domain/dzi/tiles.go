@@ -0,0 +1,100 @@
+package dzi
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// tilePathPattern matches ".../<level>/<col>_<row>.<ext>" as written by the dz layout
+var tilePathPattern = regexp.MustCompile(`(?:^|/)(\d+)/(\d+)_(\d+)\.[A-Za-z0-9]+$`)
+
+// ParseTilePath extracts the level, column and row from a dz layout tile path
+func ParseTilePath(name string) (level, col, row int, ok bool) {
+	m := tilePathPattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	level, _ = strconv.Atoi(m[1])
+	col, _ = strconv.Atoi(m[2])
+	row, _ = strconv.Atoi(m[3])
+	return level, col, row, true
+}
+
+// LevelTally is the tile count of a single pyramid level
+type LevelTally struct {
+	Level    int `json:"level"`
+	Expected int `json:"expected"`
+	Found    int `json:"found"`
+}
+
+func (t LevelTally) Complete() bool {
+	return t.Found == t.Expected
+}
+
+// TallyTiles counts the tiles per level among names. Paths that are not tiles,
+// or tiles outside the level grid, are returned in unexpected.
+func (d *Descriptor) TallyTiles(names []string) (tallies []LevelTally, unexpected []string) {
+	found := make([]int, d.LevelCount())
+	for _, name := range names {
+		level, col, row, ok := ParseTilePath(name)
+		if !ok {
+			continue
+		}
+		if level >= len(found) {
+			unexpected = append(unexpected, name)
+			continue
+		}
+		cols, rows := d.LevelTiles(level)
+		if col >= cols || row >= rows {
+			unexpected = append(unexpected, name)
+			continue
+		}
+		found[level]++
+	}
+
+	tallies = make([]LevelTally, len(found))
+	for level := range found {
+		tallies[level] = LevelTally{
+			Level:    level,
+			Expected: d.ExpectedTiles(level),
+			Found:    found[level],
+		}
+	}
+	return tallies, unexpected
+}
+
+// TilePosition is a tile of the pyramid by level, column and row
+type TilePosition struct {
+	Level int
+	Col   int
+	Row   int
+}
+
+// SampleTiles picks the corner and center tiles of every level, which covers the edge
+// tiles where off-by-one errors in size and overlap show up, plus up to extra tiles
+// per level spread evenly over the rest of the grid
+func (d *Descriptor) SampleTiles(extra int) []TilePosition {
+	var positions []TilePosition
+	for level := 0; level < d.LevelCount(); level++ {
+		cols, rows := d.LevelTiles(level)
+		seen := make(map[[2]int]bool)
+		add := func(col, row int) {
+			if seen[[2]int{col, row}] {
+				return
+			}
+			seen[[2]int{col, row}] = true
+			positions = append(positions, TilePosition{Level: level, Col: col, Row: row})
+		}
+		for _, pos := range [][2]int{
+			{0, 0}, {cols - 1, 0}, {0, rows - 1}, {cols - 1, rows - 1}, {cols / 2, rows / 2},
+		} {
+			add(pos[0], pos[1])
+		}
+		total := cols * rows
+		for i := 1; i <= extra && i <= total; i++ {
+			index := i * total / (extra + 1)
+			add(index%cols, index/cols)
+		}
+	}
+	return positions
+}
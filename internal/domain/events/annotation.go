@@ -0,0 +1,24 @@
+package events
+
+import "github.com/histopathai/image-processing-service/internal/domain/model"
+
+const (
+	ImageAnnotationRenderCompleteEventType EventType = "image.annotation.render.complete.v1"
+)
+
+type ImageAnnotationRenderCompleteEvent struct {
+	BaseEvent
+	ImageID    string            `json:"image_id"`
+	Region     *model.RegionSpec `json:"region,omitempty"`
+	ShapeCount int               `json:"shape_count"`
+	Content    *model.Content    `json:"content,omitempty"`
+
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	FailureCode   string `json:"failure_code,omitempty"` // FailureCodeRequestExpired for expired requests
+	Retryable     bool   `json:"retryable"`
+}
+
+func (e *ImageAnnotationRenderCompleteEvent) GetImageID() string {
+	return e.ImageID
+}
@@ -4,14 +4,22 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
 )
 
 type EventType string
 
+// BaseEvent is embedded in every event. CorrelationID is the event ID of the request
+// that started the chain of events about an image, CausationID the event this one was
+// published in response to; both are empty on events nothing caused, such as a new
+// request.
 type BaseEvent struct {
-	EventID   string    `json:"event_id"`
-	EventType EventType `json:"event_type"`
-	Timestamp time.Time `json:"timestamp"`
+	EventID       string    `json:"event_id"`
+	EventType     EventType `json:"event_type"`
+	Timestamp     time.Time `json:"timestamp"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	CausationID   string    `json:"causation_id,omitempty"`
 }
 
 func NewBaseEvent(eventType EventType) BaseEvent {
@@ -22,10 +30,36 @@ func NewBaseEvent(eventType EventType) BaseEvent {
 	}
 }
 
+// NewBaseEventWith is NewBaseEvent with the ID and timestamp taken from ids and clock
+func NewBaseEventWith(eventType EventType, clock port.Clock, ids port.IDGenerator) BaseEvent {
+	return BaseEvent{
+		EventID:   ids.NewID(),
+		EventType: eventType,
+		Timestamp: clock.Now(),
+	}
+}
+
+// CausedBy marks the event as published in response to the event causationID, in the
+// chain correlationID. An empty correlationID starts the chain at the causing event.
+func (e *BaseEvent) CausedBy(causationID, correlationID string) {
+	if correlationID == "" {
+		correlationID = causationID
+	}
+	e.CausationID = causationID
+	e.CorrelationID = correlationID
+}
+
 type Event interface {
 	GetEventID() string
 	GetEventType() EventType
 	GetTimestamp() time.Time
+	GetCorrelationID() string
+}
+
+// ImageEvent is an event about a single image, published with image attributes
+type ImageEvent interface {
+	Event
+	GetImageID() string
 }
 
 func (e BaseEvent) GetEventID() string {
@@ -39,3 +73,7 @@ func (e BaseEvent) GetEventType() EventType {
 func (e BaseEvent) GetTimestamp() time.Time {
 	return e.Timestamp
 }
+
+func (e BaseEvent) GetCorrelationID() string {
+	return e.CorrelationID
+}
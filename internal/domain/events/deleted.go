@@ -0,0 +1,31 @@
+package events
+
+import "time"
+
+const (
+	ImageDeletedEventType EventType = "image.deleted.v1"
+)
+
+// ImageDeletedEvent reports a deletion job. Within the soft-delete window the outputs
+// are only marked (Purged false) and are removed by a deletion request after
+// PurgeAfter.
+type ImageDeletedEvent struct {
+	BaseEvent
+	ImageID    string     `json:"image_id"`
+	Success    bool       `json:"success"`
+	Purged     bool       `json:"purged"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter *time.Time `json:"purge_after,omitempty"`
+
+	// SharedWith lists the images whose records still use the content-addressed outputs
+	// of the image, which were therefore kept (purged false, no purge_after)
+	SharedWith []string `json:"shared_with,omitempty"`
+
+	FailureReason string `json:"failure_reason,omitempty"`
+	FailureCode   string `json:"failure_code,omitempty"` // FailureCodeRequestExpired for expired requests
+	Retryable     bool   `json:"retryable"`
+}
+
+func (e *ImageDeletedEvent) GetImageID() string {
+	return e.ImageID
+}
@@ -1,6 +1,9 @@
 package events
 
-import "github.com/histopathai/image-processing-service/internal/domain/model"
+import (
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+)
 
 const (
 	ImageProcessCompleteEventType EventType = "image.process.complete.v1"
@@ -9,7 +12,10 @@ const (
 type ProcessResult struct {
 	Width  int   `json:"width"`
 	Height int   `json:"height"`
-	Size   int64 `json:"size"`
+	Size   int64 `json:"size"` // Bytes of the original file
+
+	// Levels is the pyramid of a whole-slide input, level 0 first
+	Levels []model.ImageLevel `json:"levels,omitempty"`
 }
 
 type ImageProcessCompleteEvent struct {
@@ -18,8 +24,83 @@ type ImageProcessCompleteEvent struct {
 	ProcessingVersion string          `json:"processing_version"`
 	Contents          []model.Content `json:"contents"`
 
-	Success       bool           `json:"success"`
-	Result        *ProcessResult `json:"result,omitempty"`
-	FailureReason string         `json:"failure_reason,omitempty"`
-	Retryable     bool           `json:"retryable"`
+	// Outputs are the fully qualified URIs of the main outputs, also the URIs of their
+	// entries in Contents
+	Outputs *OutputURIs `json:"outputs,omitempty"`
+
+	// PipelineVersion is the pipeline the outputs were produced with (pipeline.json)
+	PipelineVersion string `json:"pipeline_version,omitempty"`
+
+	Success       bool             `json:"success"`
+	Status        vobj.ImageStatus `json:"status,omitempty"` // processed, duplicate, failed or failed_permanent (dead-lettered)
+	Result        *ProcessResult   `json:"result,omitempty"`
+	FailureReason string           `json:"failure_reason,omitempty"`
+	Retryable     bool             `json:"retryable"`
+
+	// SuggestedWorkerType is set when the job failed for lack of disk or memory and a
+	// larger worker type is likely to succeed
+	SuggestedWorkerType string `json:"suggested_worker_type,omitempty"`
+
+	// FailureCode classifies failures clients handle specially (FailureCodeCorruptInput)
+	FailureCode string `json:"failure_code,omitempty"`
+
+	// Failure is the structured form of FailureReason, for dispatchers that decide on
+	// retries programmatically
+	Failure *FailureDetail `json:"failure,omitempty"`
+
+	// QuarantinePath is the output storage path of the failure.json (and copy of the
+	// original) of a permanently failed image, when it was quarantined
+	QuarantinePath string `json:"quarantine_path,omitempty"`
+
+	// AssociatedImages lists the exported label, macro and thumbnail images of a
+	// whole-slide image, also listed in associated.json and in Contents
+	AssociatedImages []model.AssociatedImage `json:"associated_images,omitempty"`
+
+	// QC is the slide QC verdict (qc.json), when QC_ENABLED is set
+	QC *model.QCResult `json:"qc,omitempty"`
+
+	// DuplicateOf is the image ID whose original has the same SHA-256, set with status
+	// duplicate: the image was not processed and Contents and Outputs are that image's
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// Metadata echoes the dataset/clinical fields of the request
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Transcode is set by tile transcoding jobs: Contents and Outputs are then the
+	// transcoded pyramid under its prefix, not the primary outputs of the image
+	Transcode *model.TranscodeSpec `json:"transcode,omitempty"`
+}
+
+// OutputURIs locates the outputs of a processed image. Tiles are in image.zip for
+// processing version v2 and under tiles for v1; artifacts not produced are empty.
+type OutputURIs struct {
+	DZI       string `json:"dzi"`
+	Tiles     string `json:"tiles,omitempty"`
+	Zip       string `json:"zip,omitempty"`
+	IndexMap  string `json:"index_map,omitempty"`
+	Thumbnail string `json:"thumbnail"`
+	Stats     string `json:"stats,omitempty"`
+	Pipeline  string `json:"pipeline,omitempty"`
+	Report    string `json:"report,omitempty"`
+	OMETIFF   string `json:"ome_tiff,omitempty"`
+}
+
+// FailureDetail describes the error a job failed with
+type FailureDetail struct {
+	Type    string         `json:"type"`              // Error type of the failure, e.g. storage_error
+	Causes  []string       `json:"causes,omitempty"`  // Error types it wraps, outermost first
+	Context map[string]any `json:"context,omitempty"` // Context collected along the error chain, e.g. binary and exit_code
+	Stderr  string         `json:"stderr,omitempty"`  // End of the stderr of a failed external command
+}
+
+// FailureCodeCorruptInput marks a failure caused by a truncated or corrupt input:
+// retrying is pointless, the original has to be uploaded again
+const FailureCodeCorruptInput = "CORRUPT_INPUT"
+
+// FailureCodeRequestExpired marks the result of a request that was not processed
+// because it arrived after its expiry; the dispatcher decides whether to re-enqueue it
+const FailureCodeRequestExpired = "REQUEST_EXPIRED"
+
+func (e *ImageProcessCompleteEvent) GetImageID() string {
+	return e.ImageID
 }
@@ -0,0 +1,23 @@
+package events
+
+import "github.com/histopathai/image-processing-service/internal/domain/model"
+
+const (
+	ImageRegionExtractCompleteEventType EventType = "image.region.extract.complete.v1"
+)
+
+type ImageRegionExtractCompleteEvent struct {
+	BaseEvent
+	ImageID string           `json:"image_id"`
+	Region  model.RegionSpec `json:"region"`
+	Content *model.Content   `json:"content,omitempty"`
+
+	Success       bool   `json:"success"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	FailureCode   string `json:"failure_code,omitempty"` // FailureCodeRequestExpired for expired requests
+	Retryable     bool   `json:"retryable"`
+}
+
+func (e *ImageRegionExtractCompleteEvent) GetImageID() string {
+	return e.ImageID
+}
@@ -0,0 +1,32 @@
+package events
+
+import "time"
+
+const (
+	ImageProcessRequestEventType EventType = "image.process.request.v1"
+)
+
+// ImageProcessRequestEvent asks for an image to be (re)processed. Overrides are
+// configuration env vars (e.g. TILE_SIZE) applied to that job only; Metadata carries
+// caller fields (dataset, case, stain, ...) through to the job (INPUT_METADATA), which
+// stores them with the image record and echoes them in the result event. Tenant
+// selects the buckets and topics of a multi-tenant deployment. A request started
+// after ExpiresAt is skipped with an expired result. A dead-lettered request carries
+// the FailureReason of its job, processing ignores it.
+type ImageProcessRequestEvent struct {
+	BaseEvent
+	ImageID           string            `json:"image_id"`
+	OriginPath        string            `json:"origin_path"`
+	ProcessingVersion string            `json:"processing_version"`
+	BucketName        string            `json:"bucket_name,omitempty"`
+	Tenant            string            `json:"tenant,omitempty"`
+	Overrides         map[string]string `json:"overrides,omitempty"`
+	Force             bool              `json:"force,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+	ExpiresAt         *time.Time        `json:"expires_at,omitempty"`
+	FailureReason     string            `json:"failure_reason,omitempty"`
+}
+
+func (e *ImageProcessRequestEvent) GetImageID() string {
+	return e.ImageID
+}
@@ -3,6 +3,8 @@ package events
 import (
 	"encoding/json"
 	"fmt"
+
+	"github.com/histopathai/image-processing-service/pkg/eventschema"
 )
 
 type EventSerializer interface {
@@ -10,21 +12,39 @@ type EventSerializer interface {
 	Deserialize(data []byte, v interface{}) error
 }
 
-type JSONEventSerializer struct{}
+type JSONEventSerializer struct {
+	strict bool
+}
 
 func NewJSONEventSerializer() *JSONEventSerializer {
 	return &JSONEventSerializer{}
 }
 
+// SetStrict makes Serialize and Deserialize reject events that do not match the
+// schema of their event type (see pkg/eventschema)
+func (s *JSONEventSerializer) SetStrict(strict bool) {
+	s.strict = strict
+}
+
 func (s *JSONEventSerializer) Serialize(event interface{}) ([]byte, error) {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize event: %w", err)
 	}
+	if s.strict {
+		if err := eventschema.ValidateEvent(data); err != nil {
+			return nil, fmt.Errorf("failed to serialize event: %w", err)
+		}
+	}
 	return data, nil
 }
 
 func (s *JSONEventSerializer) Deserialize(data []byte, event interface{}) error {
+	if s.strict {
+		if err := eventschema.ValidateEvent(data); err != nil {
+			return fmt.Errorf("failed to deserialize event: %w", err)
+		}
+	}
 	if err := json.Unmarshal(data, event); err != nil {
 		return fmt.Errorf("failed to deserialize event: %w", err)
 	}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Point is a level-0 pixel coordinate
+type Point struct {
+	X float64
+	Y float64
+}
+
+// AnnotationStyle follows the simplestyle-spec property names used by GeoJSON tools
+type AnnotationStyle struct {
+	Stroke        string  `json:"stroke,omitempty"`
+	StrokeWidth   float64 `json:"stroke-width,omitempty"`
+	StrokeOpacity float64 `json:"stroke-opacity,omitempty"`
+	Fill          string  `json:"fill,omitempty"`
+	FillOpacity   float64 `json:"fill-opacity,omitempty"`
+}
+
+// AnnotationShape is a flattened geometry: closed polygons (with holes as extra
+// rings) or an open polyline
+type AnnotationShape struct {
+	Rings  [][]Point
+	Closed bool
+	Style  AnnotationStyle
+}
+
+type AnnotationSet struct {
+	Shapes []AnnotationShape
+}
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties AnnotationStyle `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// ParseAnnotations parses a GeoJSON FeatureCollection (or a single Feature) whose
+// coordinates are level-0 pixel positions
+func ParseAnnotations(data []byte) (*AnnotationSet, error) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid annotation payload: %w", err)
+	}
+
+	var features []geoJSONFeature
+	switch probe.Type {
+	case "FeatureCollection":
+		var collection geoJSONFeatureCollection
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, fmt.Errorf("invalid feature collection: %w", err)
+		}
+		features = collection.Features
+	case "Feature":
+		var feature geoJSONFeature
+		if err := json.Unmarshal(data, &feature); err != nil {
+			return nil, fmt.Errorf("invalid feature: %w", err)
+		}
+		features = []geoJSONFeature{feature}
+	default:
+		return nil, fmt.Errorf("unsupported annotation payload type: %q", probe.Type)
+	}
+
+	set := &AnnotationSet{}
+	for i, feature := range features {
+		shapes, err := feature.shapes()
+		if err != nil {
+			return nil, fmt.Errorf("feature %d: %w", i, err)
+		}
+		set.Shapes = append(set.Shapes, shapes...)
+	}
+
+	if len(set.Shapes) == 0 {
+		return nil, fmt.Errorf("annotation payload contains no geometries")
+	}
+
+	return set, nil
+}
+
+func (f geoJSONFeature) shapes() ([]AnnotationShape, error) {
+	style := f.Properties
+	geometry := f.Geometry
+
+	switch geometry.Type {
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("invalid polygon coordinates: %w", err)
+		}
+		rings, err := toRings(coords)
+		if err != nil {
+			return nil, err
+		}
+		return []AnnotationShape{{Rings: rings, Closed: true, Style: style}}, nil
+
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("invalid multipolygon coordinates: %w", err)
+		}
+		shapes := make([]AnnotationShape, 0, len(coords))
+		for _, polygon := range coords {
+			rings, err := toRings(polygon)
+			if err != nil {
+				return nil, err
+			}
+			shapes = append(shapes, AnnotationShape{Rings: rings, Closed: true, Style: style})
+		}
+		return shapes, nil
+
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("invalid linestring coordinates: %w", err)
+		}
+		rings, err := toRings([][][]float64{coords})
+		if err != nil {
+			return nil, err
+		}
+		return []AnnotationShape{{Rings: rings, Closed: false, Style: style}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %q", geometry.Type)
+	}
+}
+
+func toRings(coords [][][]float64) ([][]Point, error) {
+	rings := make([][]Point, 0, len(coords))
+	for _, ring := range coords {
+		if len(ring) < 2 {
+			return nil, fmt.Errorf("geometry ring needs at least 2 positions")
+		}
+		points := make([]Point, 0, len(ring))
+		for _, position := range ring {
+			if len(position) < 2 {
+				return nil, fmt.Errorf("position needs x and y")
+			}
+			points = append(points, Point{X: position[0], Y: position[1]})
+		}
+		rings = append(rings, points)
+	}
+	return rings, nil
+}
@@ -0,0 +1,16 @@
+package model
+
+// AssociatedImage is an image exported from next to the pyramid of a whole-slide image,
+// such as the macro or scanner thumbnail
+type AssociatedImage struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Path   string `json:"path"` // Relative to the outputs in associated.json, the output path in events
+	Size   int64  `json:"size"`
+}
+
+// AssociatedManifest is associated.json, the list of exported associated images
+type AssociatedManifest struct {
+	Images []AssociatedImage `json:"images"`
+}
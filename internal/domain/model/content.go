@@ -9,4 +9,8 @@ type Content struct {
 	ContentType   vobj.ContentType     `json:"content_type"`
 	Size          int64                `json:"size"`
 	UploadPending bool                 `json:"upload_pending"`
+
+	// URI is the fully qualified location of the content (gs://bucket/path, file:///path),
+	// Path being relative to the provider's bucket or root
+	URI string `json:"uri,omitempty"`
 }
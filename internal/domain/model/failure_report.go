@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// FailureReport is written as failure.json to the quarantine of a permanently failed
+// image, so support can see why it failed without digging through the job logs
+type FailureReport struct {
+	ImageID           string    `json:"image_id"`
+	OriginPath        string    `json:"origin_path"`
+	BucketName        string    `json:"bucket_name,omitempty"`
+	ProcessingVersion string    `json:"processing_version"`
+	Status            string    `json:"status"`
+	FailedAt          time.Time `json:"failed_at"`
+	Attempt           int       `json:"attempt"`
+	WorkerType        string    `json:"worker_type"`
+
+	FailureReason       string         `json:"failure_reason"`
+	FailureCode         string         `json:"failure_code,omitempty"`
+	ErrorType           string         `json:"error_type,omitempty"`
+	ErrorContext        map[string]any `json:"error_context,omitempty"` // e.g. the binary, exit code and stderr of a failed command
+	SuggestedWorkerType string         `json:"suggested_worker_type,omitempty"`
+
+	// Original is the file name of the copy of the input next to failure.json, ""
+	// when only OriginPath references it
+	Original string `json:"original,omitempty"`
+}
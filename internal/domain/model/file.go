@@ -16,6 +16,17 @@ type File struct {
 	Height *int
 	Size   *int64
 	Format *string
+
+	// Levels is the pyramid of a whole-slide input as OpenSlide reports it, level 0
+	// first; empty for other formats
+	Levels []ImageLevel
+}
+
+// ImageLevel is one resolution level of a pyramidal input
+type ImageLevel struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Downsample float64 `json:"downsample"` // Relative to level 0
 }
 
 func NewFile(id, filename, dir string, width, height *int, size *int64, format *string) (*File, error) {
@@ -54,7 +65,12 @@ func (f *File) Exists() bool {
 	return err == nil
 }
 
+// Extension is the lowercased extension of the file name, or the extension of the
+// format detected from the content when that did not match the name (see SetFormat)
 func (f *File) Extension() string {
+	if f.Format != nil && *f.Format != "" {
+		return "." + *f.Format
+	}
 	return strings.ToLower(filepath.Ext(f.Filename))
 }
 
@@ -96,6 +112,11 @@ func (f *File) SetDimensions(width, height int, size int64) {
 	f.Size = &size
 }
 
+// SetLevels records the pyramid levels of the input
+func (f *File) SetLevels(levels []ImageLevel) {
+	f.Levels = levels
+}
+
 func (f *File) SetFormat(format string) {
 	f.Format = &format
 }
@@ -131,6 +152,7 @@ func (f *File) Clone() *File {
 		format := *f.Format
 		clone.Format = &format
 	}
+	clone.Levels = append([]ImageLevel(nil), f.Levels...)
 
 	return clone
 }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Phases of a job reported in its heartbeats
+const (
+	PhaseStarting   = "starting"   // Checks and input lookups before admission
+	PhaseAdmission  = "admission"  // Waiting for memory and scratch
+	PhaseProcessing = "processing" // Staging, tiling and the other processing steps
+	PhaseUploading  = "uploading"
+	PhasePublishing = "publishing" // Result event and image record
+)
+
+// Heartbeat is the liveness record of a worker running a job. It is rewritten every
+// heartbeat interval while the job runs and removed when it ends, so a supervisor
+// finds the jobs of crashed workers by an old UpdatedAt and wedged ones by an old
+// PhaseStartedAt.
+type Heartbeat struct {
+	WorkerID       string    `json:"worker_id"`
+	WorkerType     string    `json:"worker_type,omitempty"`
+	Tenant         string    `json:"tenant,omitempty"`
+	ImageID        string    `json:"image_id"`
+	JobType        JobType   `json:"job_type"`
+	TaskAttempt    int       `json:"task_attempt"` // Zero-based Cloud Run task attempt
+	Phase          string    `json:"phase"`
+	StartedAt      time.Time `json:"started_at"`       // Start of the job
+	PhaseStartedAt time.Time `json:"phase_started_at"` // Start of the current phase
+	UpdatedAt      time.Time `json:"updated_at"`       // Time of the last beat
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+)
+
+// ImageRecord is the persisted processing state of an image, one per image ID
+type ImageRecord struct {
+	ImageID           string            `json:"image_id"`
+	Tenant            string            `json:"tenant,omitempty"`
+	OriginPath        string            `json:"origin_path"`
+	BucketName        string            `json:"bucket_name,omitempty"`
+	ProcessingVersion string            `json:"processing_version"`
+	PipelineVersion   string            `json:"pipeline_version,omitempty"` // Pipeline the outputs are produced with, see PipelineStamp
+	Checksum          string            `json:"checksum,omitempty"`         // SHA-256 of the original, when it was computed
+	Metadata          map[string]string `json:"metadata,omitempty"`         // Dataset/clinical fields of the request
+	RequestEventID    string            `json:"request_event_id,omitempty"` // Event ID of the request the record was created for
+	CorrelationID     string            `json:"correlation_id,omitempty"`   // Chain of events of that request, see events.BaseEvent
+	Status            vobj.ImageStatus  `json:"status"`
+	FailureReason     string            `json:"failure_reason,omitempty"`
+	Result            *ImageResult      `json:"result,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// ImageResult is what a successful job produced
+type ImageResult struct {
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Size       int64    `json:"size"`
+	OutputPath string   `json:"output_path"`
+	Contents   []string `json:"contents,omitempty"` // Output paths of the published contents
+
+	Levels []ImageLevel `json:"levels,omitempty"` // Pyramid of a whole-slide input
+}
+
+// ImageStatusUpdate changes the status of an ImageRecord. Result is kept when nil and
+// Checksum when empty; FailureReason is cleared unless the status is a failure.
+type ImageStatusUpdate struct {
+	Status        vobj.ImageStatus
+	FailureReason string
+	Result        *ImageResult
+	Checksum      string
+	UpdatedAt     time.Time
+}
+
+// DailyCount is the number of records of one UTC day
+type DailyCount struct {
+	Day   time.Time `json:"day"` // Midnight UTC
+	Count int       `json:"count"`
+}
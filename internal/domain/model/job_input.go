@@ -1,20 +1,56 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
+
+type JobType string
+
+const (
+	JobTypeProcess           JobType = "process"
+	JobTypeExtractRegion     JobType = "extract_region"
+	JobTypeRenderAnnotations JobType = "render_annotations"
+	JobTypeDelete            JobType = "delete"
+	JobTypeTranscode         JobType = "transcode_tiles"
+)
+
+// DefaultAnnotationRenderSize is the longest edge of an annotated overview render
+const DefaultAnnotationRenderSize = 2048
+
+func (t JobType) IsValid() bool {
+	switch t {
+	case JobTypeProcess, JobTypeExtractRegion, JobTypeRenderAnnotations, JobTypeDelete, JobTypeTranscode:
+		return true
+	default:
+		return false
+	}
+}
 
 type JobInput struct {
 	ImageID           string
 	OriginPath        string
 	ProcessingVersion string
+	JobType           JobType
+	Region            *RegionSpec
+	Annotations       *AnnotationSet
+	RenderSize        int
+	Transcode         *TranscodeSpec
+	Metadata          map[string]string // Dataset/clinical fields of the request, echoed in the result event
+	Tenant            string            // Selects the tenant's buckets and topic (config.ApplyTenant), empty in single-tenant deployments
+	RequestedAt       time.Time         // Timestamp of the request event, zero when unknown
+	ExpiresAt         time.Time         // Not-after of the request event, zero when it does not expire
+	RequestEventID    string            // Event ID of the request, the causation of the events of the job
+	CorrelationID     string            // Correlation ID of the request, its event ID when it started the chain
 	bucketName        string
 }
 
 func NewJobInput(imageID, originPath, processingVersion string) (*JobInput, error) {
-	if imageID == "" {
-		return nil, fmt.Errorf("image ID is required")
+	if err := ValidateImageID(imageID); err != nil {
+		return nil, err
 	}
-	if originPath == "" {
-		return nil, fmt.Errorf("origin path is required")
+	if err := ValidateRelativePath("origin path", originPath); err != nil {
+		return nil, err
 	}
 	if processingVersion == "" {
 		return nil, fmt.Errorf("processing version is required")
@@ -24,16 +60,17 @@ func NewJobInput(imageID, originPath, processingVersion string) (*JobInput, erro
 		ImageID:           imageID,
 		OriginPath:        originPath,
 		ProcessingVersion: processingVersion,
+		JobType:           JobTypeProcess,
 		bucketName:        "local",
 	}, nil
 }
 
 func NewJobInputFromEnv(imageID, originPath, processingVersion, bucketName string) (*JobInput, error) {
-	if imageID == "" {
-		return nil, fmt.Errorf("image ID is required")
+	if err := ValidateImageID(imageID); err != nil {
+		return nil, err
 	}
-	if originPath == "" {
-		return nil, fmt.Errorf("origin path is required")
+	if err := ValidateRelativePath("origin path", originPath); err != nil {
+		return nil, err
 	}
 	if processingVersion == "" {
 		return nil, fmt.Errorf("processing version is required")
@@ -46,6 +83,62 @@ func NewJobInputFromEnv(imageID, originPath, processingVersion, bucketName strin
 		ImageID:           imageID,
 		OriginPath:        originPath,
 		ProcessingVersion: processingVersion,
+		JobType:           JobTypeProcess,
 		bucketName:        bucketName,
 	}, nil
 }
+
+// NewDeletionJobInput creates the input of a job that deletes the outputs of an image;
+// it needs no original
+func NewDeletionJobInput(imageID, bucketName string) (*JobInput, error) {
+	if err := ValidateImageID(imageID); err != nil {
+		return nil, err
+	}
+	return &JobInput{
+		ImageID:    imageID,
+		JobType:    JobTypeDelete,
+		bucketName: bucketName,
+	}, nil
+}
+
+// BucketName is the input bucket of the job, "local" for local runs
+func (j *JobInput) BucketName() string {
+	return j.bucketName
+}
+
+// SetRegionExtraction turns the job into a region extraction job
+func (j *JobInput) SetRegionExtraction(region *RegionSpec) error {
+	if region == nil {
+		return fmt.Errorf("region is required for region extraction")
+	}
+	if err := region.Validate(); err != nil {
+		return err
+	}
+	j.JobType = JobTypeExtractRegion
+	j.Region = region
+	return nil
+}
+
+// SetAnnotationRender turns the job into an annotation burn-in job. Without a
+// region the annotations are drawn on an overview whose longest edge is renderSize.
+func (j *JobInput) SetAnnotationRender(annotations *AnnotationSet, region *RegionSpec, renderSize int) error {
+	if annotations == nil || len(annotations.Shapes) == 0 {
+		return fmt.Errorf("annotations are required for annotation rendering")
+	}
+	if region != nil {
+		if err := region.Validate(); err != nil {
+			return err
+		}
+	}
+	if renderSize == 0 {
+		renderSize = DefaultAnnotationRenderSize
+	}
+	if renderSize < 0 {
+		return fmt.Errorf("render size must be positive")
+	}
+	j.JobType = JobTypeRenderAnnotations
+	j.Annotations = annotations
+	j.Region = region
+	j.RenderSize = renderSize
+	return nil
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Limits of the dataset/clinical metadata of a job. Pub/Sub messages and Firestore
+// documents both have size limits, and metadata is repeated in every result event.
+const (
+	MaxMetadataEntries    = 64
+	MaxMetadataValueBytes = 1024
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// ParseMetadata parses the JSON object of string fields carried by INPUT_METADATA
+func ParseMetadata(data []byte) (map[string]string, error) {
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, errors.WrapValidationError(err, "metadata must be a JSON object of strings")
+	}
+	if err := ValidateMetadata(metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// ValidateMetadata checks the dataset/clinical metadata passed through a job: lower
+// case keys (dataset, case_id, stain, ...), printable values and bounded sizes
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > MaxMetadataEntries {
+		return errors.NewValidationError("too many metadata fields").
+			WithContext("fields", len(metadata)).
+			WithContext("max", MaxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return errors.NewValidationError("invalid metadata key").WithContext("key", key)
+		}
+		if len(value) > MaxMetadataValueBytes {
+			return errors.NewValidationError("metadata value too long").
+				WithContext("key", key).
+				WithContext("max_bytes", MaxMetadataValueBytes)
+		}
+		if !utf8.ValidString(value) || containsControl(value) {
+			return errors.NewValidationError("metadata value is not printable text").WithContext("key", key)
+		}
+	}
+	return nil
+}
+
+func containsControl(s string) bool {
+	for _, r := range s {
+		if unicode.IsControl(r) && r != '\t' {
+			return true
+		}
+	}
+	return false
+}
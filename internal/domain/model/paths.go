@@ -0,0 +1,38 @@
+package model
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ValidateImageID rejects image IDs that are not a single path element: the ID names
+// the output directory of the image, so "..", separators or control characters would
+// let an event write outside the output mount
+func ValidateImageID(imageID string) error {
+	switch {
+	case imageID == "":
+		return errors.NewValidationError("image ID is required")
+	case imageID == "." || imageID == "..",
+		strings.ContainsAny(imageID, `/\`),
+		strings.ContainsFunc(imageID, unicode.IsControl):
+		return errors.NewValidationError("image ID must be a single path element").
+			WithContext("image_id", imageID)
+	}
+	return nil
+}
+
+// ValidateRelativePath rejects paths that are absolute or climb out of the directory
+// they are relative to (see filepath.IsLocal). field names the path in the error.
+func ValidateRelativePath(field, p string) error {
+	if p == "" {
+		return errors.NewValidationError(field + " is required")
+	}
+	if strings.ContainsFunc(p, unicode.IsControl) || !filepath.IsLocal(filepath.FromSlash(p)) {
+		return errors.NewValidationError(field+" must be a relative path inside the mount").
+			WithContext("path", p)
+	}
+	return nil
+}
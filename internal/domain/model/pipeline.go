@@ -0,0 +1,23 @@
+package model
+
+// PipelineStamp identifies the pipeline that produced a set of outputs and is written
+// as pipeline.json next to them. Version is a hash of the output parameters and the
+// software versions: outputs stamped with another version were produced differently
+// and are candidates for re-processing.
+type PipelineStamp struct {
+	Version    string            `json:"version"`
+	Parameters map[string]any    `json:"parameters"`
+	Software   map[string]string `json:"software"`
+}
+
+// OutdatedImage is an image whose outputs were produced by another pipeline version
+type OutdatedImage struct {
+	ImageID           string            `json:"image_id"`
+	OriginPath        string            `json:"origin_path"`
+	ProcessingVersion string            `json:"processing_version"`
+	PipelineVersion   string            `json:"pipeline_version"` // Empty for outputs produced before pipeline stamps
+	OutputPath        string            `json:"output_path"`
+	Tenant            string            `json:"tenant,omitempty"`
+	BucketName        string            `json:"bucket_name,omitempty"`
+	Metadata          map[string]string `json:"metadata,omitempty"`
+}
@@ -0,0 +1,18 @@
+package model
+
+// QC verdicts of a slide
+const (
+	QCVerdictPass = "pass"
+	QCVerdictWarn = "warn" // Published, but worth a look
+	QCVerdictFail = "fail" // Published, or held for review with QC_HOLD_FAILED
+)
+
+// QCResult is qc.json, the QC verdict of a slide with the measures it was reached on
+type QCResult struct {
+	Verdict        string   `json:"verdict"`
+	Dataset        string   `json:"dataset,omitempty"` // Dataset whose thresholds were applied, empty for the defaults
+	TissueFraction float64  `json:"tissue_fraction"`
+	FocusScore     float64  `json:"focus_score"`
+	Brightness     float64  `json:"brightness"`
+	Reasons        []string `json:"reasons,omitempty"` // Thresholds the slide missed, one per measure
+}
@@ -0,0 +1,91 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type RegionFormat string
+
+const (
+	RegionFormatPNG  RegionFormat = "png"
+	RegionFormatTIFF RegionFormat = "tiff"
+)
+
+// RegionSpec describes a rectangular area of a slide.
+// X and Y are level-0 coordinates (OpenSlide convention), Width and Height are
+// in pixels of the requested Level.
+type RegionSpec struct {
+	X      int          `json:"x"`
+	Y      int          `json:"y"`
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Level  int          `json:"level"`
+	Format RegionFormat `json:"format"`
+}
+
+// ParseRegion parses a "x,y,width,height" string into a RegionSpec
+func ParseRegion(value string, level int, format string) (*RegionSpec, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("region must be in x,y,width,height form: %q", value)
+	}
+
+	var coords [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid region coordinate %q: %w", part, err)
+		}
+		coords[i] = n
+	}
+
+	if format == "" {
+		format = string(RegionFormatPNG)
+	}
+
+	region := &RegionSpec{
+		X:      coords[0],
+		Y:      coords[1],
+		Width:  coords[2],
+		Height: coords[3],
+		Level:  level,
+		Format: RegionFormat(strings.ToLower(format)),
+	}
+	if err := region.Validate(); err != nil {
+		return nil, err
+	}
+	return region, nil
+}
+
+func (r *RegionSpec) Validate() error {
+	if r.X < 0 || r.Y < 0 {
+		return fmt.Errorf("region origin cannot be negative")
+	}
+	if r.Width <= 0 || r.Height <= 0 {
+		return fmt.Errorf("region width and height must be positive")
+	}
+	if r.Level < 0 {
+		return fmt.Errorf("region level cannot be negative")
+	}
+	switch r.Format {
+	case RegionFormatPNG, RegionFormatTIFF:
+	default:
+		return fmt.Errorf("unsupported region format: %s", r.Format)
+	}
+	return nil
+}
+
+// Extension returns the file extension (with dot) of the region output
+func (r *RegionSpec) Extension() string {
+	if r.Format == RegionFormatTIFF {
+		return ".tiff"
+	}
+	return ".png"
+}
+
+// Filename returns a deterministic output filename for the region
+func (r *RegionSpec) Filename() string {
+	return fmt.Sprintf("region_%d_%d_%d_%d_l%d%s", r.X, r.Y, r.Width, r.Height, r.Level, r.Extension())
+}
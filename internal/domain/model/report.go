@@ -0,0 +1,132 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+type StepStatus string
+
+const (
+	StepStatusOK      StepStatus = "ok"
+	StepStatusFailed  StepStatus = "failed"
+	StepStatusSkipped StepStatus = "skipped"
+)
+
+// ReportStep records the outcome and duration of one processing step
+type ReportStep struct {
+	Name       string     `json:"name"`
+	Status     StepStatus `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type ReportInput struct {
+	Filename  string `json:"filename"`
+	Extension string `json:"extension"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	SizeBytes int64  `json:"size_bytes"`
+	SHA256    string `json:"sha256,omitempty"`
+
+	Levels []ImageLevel `json:"levels,omitempty"` // Pyramid of a whole-slide input
+}
+
+// ProcessingReport is the reproducibility record written as report.json next
+// to the outputs of every processed image
+type ProcessingReport struct {
+	ImageID     string            `json:"image_id"`
+	Container   string            `json:"container"`
+	Attempt     int               `json:"attempt"`
+	StartedAt   time.Time         `json:"started_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+	Input       ReportInput       `json:"input"`
+	Parameters  map[string]any    `json:"parameters"`
+	Steps       []ReportStep      `json:"steps"`
+	Validation  map[string]any    `json:"validation,omitempty"`
+	Software    map[string]string `json:"software"`
+
+	// PipelineVersion is the version stamped in pipeline.json
+	PipelineVersion string `json:"pipeline_version,omitempty"`
+
+	// WorkspacePeakBytes is the largest size of the workspace measured during the job
+	WorkspacePeakBytes int64 `json:"workspace_peak_bytes,omitempty"`
+
+	mu sync.Mutex
+}
+
+func NewProcessingReport(imageID, container string, attempt int) *ProcessingReport {
+	return &ProcessingReport{
+		ImageID:    imageID,
+		Container:  container,
+		Attempt:    attempt,
+		StartedAt:  time.Now().UTC(),
+		Parameters: make(map[string]any),
+		Software:   make(map[string]string),
+	}
+}
+
+// SetInput records the probed properties of the input file
+func (r *ProcessingReport) SetInput(file *File) {
+	r.Input = ReportInput{
+		Filename:  file.Filename,
+		Extension: file.Extension(),
+		Width:     file.WidthValue(),
+		Height:    file.HeightValue(),
+		SizeBytes: file.SizeValue(),
+		Levels:    file.Levels,
+	}
+}
+
+// SetInputChecksum records the SHA-256 of the input, when it was computed
+func (r *ProcessingReport) SetInputChecksum(sum string) {
+	r.Input.SHA256 = sum
+}
+
+// RecordStep appends a finished step; a non-nil err marks it failed. Safe for concurrent use.
+func (r *ProcessingReport) RecordStep(name string, startedAt time.Time, err error) {
+	step := ReportStep{
+		Name:       name,
+		Status:     StepStatusOK,
+		StartedAt:  startedAt.UTC(),
+		DurationMs: time.Since(startedAt).Milliseconds(),
+	}
+	if err != nil {
+		step.Status = StepStatusFailed
+		step.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Steps = append(r.Steps, step)
+}
+
+// RecordFinishedStep appends a step that ran before the report was created, such as
+// the staging of an original hashed before the job decided to process it
+func (r *ProcessingReport) RecordFinishedStep(name string, startedAt time.Time, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Steps = append(r.Steps, ReportStep{
+		Name:       name,
+		Status:     StepStatusOK,
+		StartedAt:  startedAt.UTC(),
+		DurationMs: duration.Milliseconds(),
+	})
+}
+
+// SkipStep records a step that was disabled for this run
+func (r *ProcessingReport) SkipStep(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Steps = append(r.Steps, ReportStep{
+		Name:      name,
+		Status:    StepStatusSkipped,
+		StartedAt: time.Now().UTC(),
+	})
+}
+
+// Complete stamps the completion time
+func (r *ProcessingReport) Complete() {
+	r.CompletedAt = time.Now().UTC()
+}
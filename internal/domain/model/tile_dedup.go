@@ -0,0 +1,44 @@
+package model
+
+import "sync"
+
+// TileDedup tracks tile content hashes so identical tiles (typically blank
+// background) are stored once and referenced from their other positions
+type TileDedup struct {
+	mu         sync.Mutex
+	canonical  map[string]string // content hash -> first tile path with that content
+	references map[string]string // duplicate tile path -> canonical tile path
+}
+
+func NewTileDedup() *TileDedup {
+	return &TileDedup{
+		canonical:  make(map[string]string),
+		references: make(map[string]string),
+	}
+}
+
+// Observe registers a tile. It returns the canonical path for the content and
+// whether the tile is a duplicate of an earlier one.
+func (d *TileDedup) Observe(path, hash string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if canonical, ok := d.canonical[hash]; ok && canonical != path {
+		d.references[path] = canonical
+		return canonical, true
+	}
+	d.canonical[hash] = path
+	return path, false
+}
+
+// References returns a copy of the duplicate -> canonical map
+func (d *TileDedup) References() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	refs := make(map[string]string, len(d.references))
+	for k, v := range d.references {
+		refs[k] = v
+	}
+	return refs
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TranscodeSpec describes a tile transcoding job: the stored pyramid of an image is
+// re-encoded in Format and written next to the image's outputs under Prefix
+type TranscodeSpec struct {
+	Format  string `json:"format"`  // Tile suffix and DZI Format of the output: jpg, jpeg, webp or png
+	Quality int    `json:"quality"` // 1-100, 0 uses QUALITY; ignored for png
+	Prefix  string `json:"prefix"`  // Output directory on the output mount, <image-id>-<suffix>; <image-id>-<format> by default
+}
+
+// NewTranscodeJobInput creates the input of a job that transcodes the stored tiles of
+// an image; like a deletion it needs no original. An empty spec.Prefix is set to
+// <image-id>-<format>.
+func NewTranscodeJobInput(imageID, bucketName string, spec *TranscodeSpec) (*JobInput, error) {
+	if err := ValidateImageID(imageID); err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		return nil, fmt.Errorf("transcode spec is required")
+	}
+	if spec.Prefix == "" {
+		spec.Prefix = imageID + "-" + spec.Format
+	}
+	if err := spec.ValidateFor(imageID); err != nil {
+		return nil, err
+	}
+	return &JobInput{
+		ImageID:    imageID,
+		JobType:    JobTypeTranscode,
+		Transcode:  spec,
+		bucketName: bucketName,
+	}, nil
+}
+
+func (t *TranscodeSpec) Validate() error {
+	switch t.Format {
+	case "jpg", "jpeg", "webp", "png":
+	default:
+		return fmt.Errorf("unsupported tile format: %q", t.Format)
+	}
+	if t.Quality < 0 || t.Quality > 100 {
+		return fmt.Errorf("tile quality must be between 1 and 100, got %d", t.Quality)
+	}
+	if err := ValidateImageID(t.Prefix); err != nil {
+		return fmt.Errorf("invalid transcode prefix: %w", err)
+	}
+	return nil
+}
+
+// ValidateFor validates the spec of a transcode of imageID: the prefix has to be in the
+// namespace of the image, <image-id>-<suffix>, so a transcode never replaces the
+// outputs of the image or of another one
+func (t *TranscodeSpec) ValidateFor(imageID string) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if suffix, ok := strings.CutPrefix(t.Prefix, imageID+"-"); !ok || suffix == "" {
+		return fmt.Errorf("transcode prefix %q must start with %q", t.Prefix, imageID+"-")
+	}
+	return nil
+}
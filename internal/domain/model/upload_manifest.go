@@ -0,0 +1,16 @@
+package model
+
+// UploadManifest is upload-manifest.json, the objects uploaded to the output prefix of
+// an image with their size and CRC32C, for offline verification and exact mirroring
+type UploadManifest struct {
+	Version   int              `json:"version"`
+	Algorithm string           `json:"algorithm"` // crc32c: base64 of the big-endian Castagnoli checksum, as in GCS object metadata
+	Objects   []UploadedObject `json:"objects"`
+}
+
+// UploadedObject is one object of an upload manifest
+type UploadedObject struct {
+	Path   string `json:"path"` // Relative to the output prefix, slash separated
+	Size   int64  `json:"size"`
+	CRC32C string `json:"crc32c"`
+}
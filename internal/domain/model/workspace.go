@@ -5,19 +5,30 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 type Workspace struct {
-	file *File
-	dir  string
+	file    *File
+	dir     string
+	source  string
+	preview string
+
+	mu       sync.Mutex
+	uploaded map[string]bool
+	dedup    *TileDedup
 }
 
-func NewWorkspace(file *File) (*Workspace, error) {
+// NewWorkspace creates a workspace directory for file under root (/tmp when empty)
+func NewWorkspace(file *File, root string) (*Workspace, error) {
 	if file == nil {
 		return nil, fmt.Errorf("file cannot be nil")
 	}
+	if root == "" {
+		root = "/tmp"
+	}
 
-	tempDir, err := os.MkdirTemp("/tmp", fmt.Sprintf("workspace-%s", file.ID))
+	tempDir, err := os.MkdirTemp(root, fmt.Sprintf("workspace-%s", file.ID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
 	}
@@ -28,6 +39,27 @@ func NewWorkspace(file *File) (*Workspace, error) {
 	}, nil
 }
 
+// NewWorkspaceNamed creates the workspace directory workspace-<file ID>-<suffix> under
+// root (/tmp when empty), for callers that need predictable workspace paths
+func NewWorkspaceNamed(file *File, root, suffix string) (*Workspace, error) {
+	if file == nil {
+		return nil, fmt.Errorf("file cannot be nil")
+	}
+	if root == "" {
+		root = "/tmp"
+	}
+
+	dir := filepath.Join(root, fmt.Sprintf("workspace-%s-%s", file.ID, suffix))
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %w", err)
+	}
+
+	return &Workspace{
+		file: file,
+		dir:  dir,
+	}, nil
+}
+
 func (w *Workspace) Join(elem ...string) string {
 	elements := append([]string{w.dir}, elem...)
 	return filepath.Join(elements...)
@@ -60,6 +92,14 @@ func (w *Workspace) RemoveFile(filePath string) error {
 	return nil
 }
 
+// RemoveDir removes a directory of the workspace and everything below it
+func (w *Workspace) RemoveDir(relPath string) error {
+	if err := os.RemoveAll(w.Join(relPath)); err != nil {
+		return fmt.Errorf("failed to remove directory %s: %w", relPath, err)
+	}
+	return nil
+}
+
 func (w *Workspace) File() *File {
 	return w.file
 }
@@ -72,10 +112,90 @@ func (w *Workspace) List() ([]fs.DirEntry, error) {
 	return entries, nil
 }
 
+// SetSource records an intermediate in the workspace that replaces the original
+// as the pixel source for later steps (e.g. a channel-mapped copy)
+func (w *Workspace) SetSource(path string) {
+	w.source = path
+}
+
+// Source returns the intermediate set with SetSource, or "" when the original is used
+func (w *Workspace) Source() string {
+	return w.source
+}
+
+// SetPreview records a downsampled rendering of a source vips cannot open. Steps
+// that only need the whole image at low resolution (thumbnail, stats, overviews) read
+// it instead of the source, and the pyramid is tiled through OpenSlide.
+func (w *Workspace) SetPreview(path string) {
+	w.preview = path
+}
+
+// Preview returns the rendering set with SetPreview, or "" when vips reads the source
+func (w *Workspace) Preview() string {
+	return w.preview
+}
+
+// MarkUploaded records that the workspace-relative path was already copied to
+// output storage, so the final copy can skip it
+func (w *Workspace) MarkUploaded(relPath string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.uploaded == nil {
+		w.uploaded = make(map[string]bool)
+	}
+	w.uploaded[filepath.Clean(relPath)] = true
+}
+
+// TileDedup returns the tile deduplication registry of the workspace
+func (w *Workspace) TileDedup() *TileDedup {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dedup == nil {
+		w.dedup = NewTileDedup()
+	}
+	return w.dedup
+}
+
+func (w *Workspace) IsUploaded(relPath string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.uploaded[filepath.Clean(relPath)]
+}
+
 func (w *Workspace) Dir() string {
 	return w.dir
 }
 
+// Usage returns the bytes of the files in the workspace. Files removed while it walks
+// the workspace are not counted.
+func (w *Workspace) Usage() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(w.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return size, fmt.Errorf("failed to measure workspace: %w", err)
+	}
+	return size, nil
+}
+
 func (w *Workspace) Exists() bool {
 	info, err := os.Stat(w.dir)
 	return err == nil && info.IsDir()
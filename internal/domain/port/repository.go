@@ -0,0 +1,55 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+)
+
+// ImageRepository persists the processing state of images. GetByID and
+// FindByChecksum return an errors.ErrorTypeNotFound error when nothing matches.
+type ImageRepository interface {
+	// Create stores the record of a new job, replacing the record of an earlier run
+	Create(ctx context.Context, record *model.ImageRecord) error
+	UpdateStatus(ctx context.Context, imageID string, update model.ImageStatusUpdate) error
+	GetByID(ctx context.Context, imageID string) (*model.ImageRecord, error)
+	// FindByChecksum returns the most recently updated processed record of an original;
+	// records of jobs in flight or failed are skipped. A Firestore implementation needs
+	// a composite index on (checksum, status, updated_at).
+	FindByChecksum(ctx context.Context, checksum string) (*model.ImageRecord, error)
+	// FindByOutputPath returns the records whose result is stored at outputPath, none
+	// when no record points there. Content-addressed outputs are shared by every image
+	// of the same original.
+	FindByOutputPath(ctx context.Context, outputPath string) ([]*model.ImageRecord, error)
+}
+
+// ImageDashboard answers the operator queries of the processing dashboard. A Firestore
+// implementation needs composite indexes on (status, updated_at),
+// (status, metadata.dataset, updated_at) and (status, pipeline_version, updated_at).
+type ImageDashboard interface {
+	// Stuck returns the records that have been in status since before olderThan,
+	// oldest first
+	Stuck(ctx context.Context, status vobj.ImageStatus, olderThan time.Time) ([]*model.ImageRecord, error)
+	// FailuresByDataset counts the failed and failed_permanent records updated since
+	// since, keyed by their "dataset" metadata ("" for records without one)
+	FailuresByDataset(ctx context.Context, since time.Time) (map[string]int, error)
+	// ThroughputPerDay counts the records processed per UTC day since since, oldest day
+	// first; days without processed images are omitted
+	ThroughputPerDay(ctx context.Context, since time.Time) ([]model.DailyCount, error)
+	// Outdated returns the processed records whose pipeline version is not
+	// pipelineVersion, including records without one, oldest first
+	Outdated(ctx context.Context, pipelineVersion string) ([]*model.ImageRecord, error)
+}
+
+// HeartbeatStore keeps the last heartbeat of every worker running a job, for a
+// supervisor that re-dispatches the jobs of crashed or wedged workers
+type HeartbeatStore interface {
+	// Beat stores heartbeat, replacing the previous one of its worker
+	Beat(ctx context.Context, heartbeat *model.Heartbeat) error
+	// Clear removes the heartbeat of a worker whose job ended; a missing one is not an error
+	Clear(ctx context.Context, workerID string) error
+	// Stale returns the heartbeats last updated before olderThan, oldest first
+	Stale(ctx context.Context, olderThan time.Time) ([]*model.Heartbeat, error)
+}
@@ -0,0 +1,13 @@
+package port
+
+import "time"
+
+// Clock is the source of event timestamps and other wall-clock reads that end up in outputs
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator produces the IDs of events, contents and workspaces
+type IDGenerator interface {
+	NewID() string
+}
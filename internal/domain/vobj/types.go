@@ -27,6 +27,8 @@ const (
 	StatusFailedPermanent ImageStatus = "failed_permanent" // Permanent failure (DLQ)
 	StatusDeleting        ImageStatus = "deleting"         // Marked for deletion
 	StatusUploaded        ImageStatus = "uploaded"         // Successfully uploaded
+	StatusPendingReview   ImageStatus = "pending_review"   // Processed but failed QC, result held until released
+	StatusDuplicate       ImageStatus = "duplicate"        // Same original as a processed image, not processed again
 )
 
 const (
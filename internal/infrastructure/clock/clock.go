@@ -0,0 +1,55 @@
+// Package clock provides the system clock and a settable clock for deterministic tests
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+)
+
+// System reads the wall clock
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Fixed returns a set time, advanced by step after every read (zero keeps it still)
+type Fixed struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+// NewFixed creates a clock that starts at now and moves by step on every read
+func NewFixed(now time.Time, step time.Duration) *Fixed {
+	return &Fixed{now: now, step: step}
+}
+
+func (c *Fixed) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// Set moves the clock to now
+func (c *Fixed) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *Fixed) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var (
+	_ port.Clock = System{}
+	_ port.Clock = (*Fixed)(nil)
+)
@@ -0,0 +1,224 @@
+// Package capture provides a publisher for tests that records every published
+// message instead of sending it, so tests can assert which events the job
+// orchestrator emitted.
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Message is one published message
+type Message struct {
+	Topic      string
+	Data       []byte
+	Attributes map[string]string
+}
+
+// EventType returns the event_type attribute of the message
+func (m Message) EventType() events.EventType {
+	return events.EventType(m.Attributes["event_type"])
+}
+
+// ImageID returns the image_id attribute of the message
+func (m Message) ImageID() string {
+	return m.Attributes["image_id"]
+}
+
+// Decode unmarshals the payload into v
+func (m Message) Decode(v any) error {
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s message: %w", m.EventType(), err)
+	}
+	return nil
+}
+
+// Publisher records published messages. Failures can be injected with FailNext
+// and FailAlways; failed publishes are not recorded.
+type Publisher struct {
+	mu        sync.Mutex
+	messages  []Message
+	failNext  []error
+	failAll   error
+	attempts  int
+	closed    bool
+	published chan struct{} // Closed and replaced on every recorded message
+}
+
+// NewPublisher creates an empty capturing publisher
+func NewPublisher() *Publisher {
+	return &Publisher{published: make(chan struct{})}
+}
+
+// Publish implements port.EventPublisher.Publish
+func (p *Publisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts++
+	if p.closed {
+		return errors.NewMessagingError("publisher is closed").
+			WithContext("topic", topicID)
+	}
+	if len(p.failNext) > 0 {
+		err := p.failNext[0]
+		p.failNext = p.failNext[1:]
+		return err
+	}
+	if p.failAll != nil {
+		return p.failAll
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, errors.ErrorTypeCancellation, "publish canceled").
+			WithContext("topic", topicID)
+	}
+
+	attrs := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	p.messages = append(p.messages, Message{
+		Topic:      topicID,
+		Data:       append([]byte(nil), data...),
+		Attributes: attrs,
+	})
+	close(p.published)
+	p.published = make(chan struct{})
+	return nil
+}
+
+// Close implements port.EventPublisher.Close
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// FailNext makes the next len(errs) publishes return errs in order
+func (p *Publisher) FailNext(errs ...error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failNext = append(p.failNext, errs...)
+}
+
+// FailAlways makes every publish return err; nil stops failing
+func (p *Publisher) FailAlways(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failAll = err
+}
+
+// Messages returns the recorded messages in publish order
+func (p *Publisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// ByTopic returns the recorded messages published to topicID
+func (p *Publisher) ByTopic(topicID string) []Message {
+	return p.filter(func(m Message) bool { return m.Topic == topicID })
+}
+
+// ByEventType returns the recorded messages with the event_type attribute
+func (p *Publisher) ByEventType(eventType events.EventType) []Message {
+	return p.filter(func(m Message) bool { return m.EventType() == eventType })
+}
+
+// ByImageID returns the recorded messages with the image_id attribute
+func (p *Publisher) ByImageID(imageID string) []Message {
+	return p.filter(func(m Message) bool { return m.ImageID() == imageID })
+}
+
+// Last returns the most recently recorded message
+func (p *Publisher) Last() (Message, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.messages) == 0 {
+		return Message{}, false
+	}
+	return p.messages[len(p.messages)-1], true
+}
+
+// CompleteEvents decodes the recorded image processing results for imageID ("" for all)
+func (p *Publisher) CompleteEvents(imageID string) ([]events.ImageProcessCompleteEvent, error) {
+	var completes []events.ImageProcessCompleteEvent
+	for _, m := range p.ByEventType(events.ImageProcessCompleteEventType) {
+		if imageID != "" && m.ImageID() != imageID {
+			continue
+		}
+		var event events.ImageProcessCompleteEvent
+		if err := m.Decode(&event); err != nil {
+			return nil, err
+		}
+		completes = append(completes, event)
+	}
+	return completes, nil
+}
+
+// Attempts returns how many publishes were made, including failed ones
+func (p *Publisher) Attempts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.attempts
+}
+
+// Closed reports whether Close was called
+func (p *Publisher) Closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// WaitFor blocks until n messages were recorded or ctx is done, for publishes made
+// from other goroutines
+func (p *Publisher) WaitFor(ctx context.Context, n int) ([]Message, error) {
+	for {
+		p.mu.Lock()
+		if len(p.messages) >= n {
+			messages := append([]Message(nil), p.messages...)
+			p.mu.Unlock()
+			return messages, nil
+		}
+		published := p.published
+		p.mu.Unlock()
+
+		select {
+		case <-published:
+		case <-ctx.Done():
+			return p.Messages(), ctx.Err()
+		}
+	}
+}
+
+// Reset removes the recorded messages and injected failures
+func (p *Publisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = nil
+	p.failNext = nil
+	p.failAll = nil
+	p.attempts = 0
+	p.closed = false
+}
+
+func (p *Publisher) filter(keep func(Message) bool) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matched []Message
+	for _, m := range p.messages {
+		if keep(m) {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+var _ port.EventPublisher = (*Publisher)(nil)
@@ -3,47 +3,98 @@ package pubsub
 import (
 	"context"
 	"log/slog"
+	"sync"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
+// Publisher publishes through one long-lived topic handle per topic ID so that
+// progress events share the handle's batching and connection instead of paying
+// for a new publisher per message. Handles are stopped on Close.
 type Publisher struct {
-	client *pubsub.Client
-	logger *slog.Logger
+	client   *pubsub.Client
+	logger   *slog.Logger
+	settings pubsub.PublishSettings
+	retrier  *retry.Retrier
+
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
 }
 
-func NewPublisher(client *pubsub.Client, logger *slog.Logger) *Publisher {
+func NewPublisher(client *pubsub.Client, logger *slog.Logger, cfg config.PubSubConfig) *Publisher {
+	settings := pubsub.DefaultPublishSettings
+	settings.DelayThreshold = cfg.BatchDelay
+	settings.CountThreshold = cfg.BatchCount
+	settings.ByteThreshold = cfg.BatchBytes
+	// Transient publish failures are retried by the client until this deadline
+	settings.Timeout = cfg.PublishTimeout
+
 	return &Publisher{
-		client: client,
-		logger: logger,
+		client:   client,
+		logger:   logger,
+		settings: settings,
+		retrier:  retry.New(logger, retry.DefaultPolicy),
+		topics:   make(map[string]*pubsub.Topic),
 	}
 }
 
-func (p *Publisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+// SetRetrier replaces the default retry policy of publishes that failed after the
+// client's own retries
+func (p *Publisher) SetRetrier(retrier *retry.Retrier) {
+	p.retrier = retrier
+}
+
+// topic returns the cached handle for topicID, creating it on first use
+func (p *Publisher) topic(topicID string) *pubsub.Topic {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if topic, ok := p.topics[topicID]; ok {
+		return topic
+	}
 
 	topic := p.client.Topic(topicID)
-	defer topic.Stop()
+	topic.PublishSettings = p.settings
+	p.topics[topicID] = topic
+	return topic
+}
+
+func (p *Publisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	topic := p.topic(topicID)
 
 	msg := &pubsub.Message{
 		Data:       data,
 		Attributes: attributes,
 	}
 
-	result := topic.Publish(ctx, msg)
-
-	_, err := result.Get(ctx)
+	err := p.retrier.Do(ctx, "pubsub publish", func(ctx context.Context) error {
+		if _, err := topic.Publish(ctx, msg).Get(ctx); err != nil {
+			return errors.WrapMessagingError(err, "could not publish message").WithContext("topic", topicID)
+		}
+		return nil
+	})
 	if err != nil {
 		p.logger.Error("Failed to publish message", "topic", topicID, "error", err)
-		return errors.NewInternalError("could not publish message").WithContext("topic", topicID)
+		return err
 	}
 
 	p.logger.Info("Message published successfully", "topic", topicID)
 	return nil
 }
 
+// Close flushes and stops every cached topic handle, then closes the client
 func (p *Publisher) Close() error {
+	p.mu.Lock()
+	for topicID, topic := range p.topics {
+		topic.Stop()
+		delete(p.topics, topicID)
+	}
+	p.mu.Unlock()
+
 	return p.client.Close()
 }
 
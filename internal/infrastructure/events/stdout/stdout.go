@@ -7,29 +7,114 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/clock"
 )
 
 type Publisher struct {
 	logger    *slog.Logger
 	outputDir string
+	quiet     bool // Only write result.json, do not print events
+	clock     port.Clock
+
+	mu        sync.Mutex
+	eventLog  *os.File // Every event is appended as an EventLogRecord line, when set
+	messageID int64
+}
+
+// EventLogRecord is one line of the event log: the message as a Pub/Sub subscriber
+// receives it in the REST representation, so the data is the published bytes
+// (base64-encoded), and the topic it was published to
+type EventLogRecord struct {
+	Topic   string          `json:"topic"`
+	Message EventLogMessage `json:"message"`
+}
+
+// EventLogMessage is a PubsubMessage as returned by a pull or pushed to an endpoint
+type EventLogMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
 }
 
 func NewPublisher(logger *slog.Logger, outputDir string) *Publisher {
 	return &Publisher{
 		logger:    logger,
 		outputDir: outputDir,
+		clock:     clock.System{},
+	}
+}
+
+// SetClock replaces the system clock used for the publish times of the event log
+func (p *Publisher) SetClock(clock port.Clock) {
+	p.clock = clock
+}
+
+// SetEcho controls whether published events are printed to stdout (the default)
+func (p *Publisher) SetEcho(enabled bool) {
+	p.quiet = !enabled
+}
+
+// SetEventLog appends every published event to the JSONL file at path, one
+// EventLogRecord per line
+func (p *Publisher) SetEventLog(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create event log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
 	}
+	p.eventLog = f
+	p.logger.Info("Appending events to event log", "path", path)
+	return nil
+}
+
+// appendEventLog writes the event as a line of the event log
+func (p *Publisher) appendEventLog(topicID string, data []byte, attributes map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messageID++
+	line, err := json.Marshal(EventLogRecord{
+		Topic: topicID,
+		Message: EventLogMessage{
+			Data:        data,
+			Attributes:  attributes,
+			MessageID:   strconv.FormatInt(p.messageID, 10),
+			PublishTime: p.clock.Now().UTC(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event log record: %w", err)
+	}
+	if _, err := p.eventLog.Write(append(line, '\n')); err != nil {
+		p.logger.Error("Failed to append to event log", "path", p.eventLog.Name(), "error", err)
+		return fmt.Errorf("failed to append to event log: %w", err)
+	}
+	return nil
 }
 
 func (p *Publisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	if p.eventLog != nil {
+		if err := p.appendEventLog(topicID, data, attributes); err != nil {
+			return err
+		}
+	}
+
 	// Pretty-print the JSON for stdout
 	var prettyJSON json.RawMessage
 	if err := json.Unmarshal(data, &prettyJSON); err != nil {
 		// If not valid JSON, write raw data
-		fmt.Fprintln(os.Stdout, string(data))
-	} else {
+		if !p.quiet {
+			fmt.Fprintln(os.Stdout, string(data))
+		}
+	} else if !p.quiet {
 		formatted, err := json.MarshalIndent(prettyJSON, "", "  ")
 		if err != nil {
 			fmt.Fprintln(os.Stdout, string(data))
@@ -77,6 +162,9 @@ func (p *Publisher) Publish(ctx context.Context, topicID string, data []byte, at
 }
 
 func (p *Publisher) Close() error {
+	if p.eventLog != nil {
+		return p.eventLog.Close()
+	}
 	return nil
 }
 
@@ -0,0 +1,41 @@
+// Package idgen provides random UUIDs and a deterministic sequence for tests
+package idgen
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+)
+
+// UUID generates random (version 4) UUIDs
+type UUID struct{}
+
+func (UUID) NewID() string {
+	return uuid.New().String()
+}
+
+// Sequence generates UUID-shaped IDs from a counter: 00000000-0000-4000-8000-000000000001,
+// ...-000000000002 and so on, so consumers that parse IDs as UUIDs still accept them
+type Sequence struct {
+	next atomic.Uint64
+}
+
+// NewSequence creates a sequence whose first ID ends in start
+func NewSequence(start uint64) *Sequence {
+	s := &Sequence{}
+	s.next.Store(start)
+	return s
+}
+
+func (s *Sequence) NewID() string {
+	n := s.next.Add(1) - 1
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", n%1_000_000_000_000)
+}
+
+var (
+	_ port.IDGenerator = UUID{}
+	_ port.IDGenerator = (*Sequence)(nil)
+)
@@ -3,20 +3,28 @@ package processors
 import (
 	"bytes"
 	"context"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 // BaseProcessor provides common functionality for CLI-based processors
 type BaseProcessor struct {
 	logger     *slog.Logger
 	binaryName string
+	globalArgs []string // Prepended to every invocation, before the command arguments
+	env        []string // Added to the inherited environment of every invocation
+	retrier    *retry.Retrier
+	slowLog    *SlowLog
 }
 
 // NewBaseProcessor creates a new base processor instance
@@ -27,6 +35,58 @@ func NewBaseProcessor(logger *slog.Logger, binaryName string) *BaseProcessor {
 	}
 }
 
+// SetGlobalArgs sets arguments passed to every invocation of the binary
+func (p *BaseProcessor) SetGlobalArgs(args ...string) {
+	p.globalArgs = args
+}
+
+// SetEnv sets KEY=VALUE pairs added to the environment of every invocation
+func (p *BaseProcessor) SetEnv(env ...string) {
+	p.env = env
+}
+
+// SetRetryPolicy retries invocations killed by a signal (exit codes 137 and 143, e.g.
+// the OOM killer or preemption) under policy; other failures are never retried
+func (p *BaseProcessor) SetRetryPolicy(policy retry.Policy) {
+	p.retrier = retry.New(p.logger, policy)
+	p.retrier.SetRetryable(retryableCommandError)
+}
+
+// SetSlowLog writes invocations longer than the threshold of l to it; nil disables
+func (p *BaseProcessor) SetSlowLog(l *SlowLog) {
+	p.slowLog = l
+}
+
+// retryableCommandError reports whether err comes from a command killed by a signal
+func retryableCommandError(err error) bool {
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) {
+		return false
+	}
+	exitCode, _ := appErr.Context["exit_code"].(int)
+	return appErr.Type == errors.ErrorTypeProcessing && (exitCode == 137 || exitCode == 143)
+}
+
+// retried runs one invocation per attempt under the retry policy
+func (p *BaseProcessor) retried(ctx context.Context, run func(ctx context.Context) (*CommandResult, error)) (*CommandResult, error) {
+	var result *CommandResult
+	err := p.retrier.Do(ctx, p.binaryName, func(ctx context.Context) error {
+		var err error
+		result, err = run(ctx)
+		return err
+	})
+	return result, err
+}
+
+// command builds the exec.Cmd for an invocation with the global args and environment applied
+func (p *BaseProcessor) command(ctx context.Context, args []string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, p.binaryName, append(append([]string{}, p.globalArgs...), args...)...)
+	if len(p.env) > 0 {
+		cmd.Env = append(os.Environ(), p.env...)
+	}
+	return cmd
+}
+
 // VerifyBinary checks if the binary exists in system PATH
 func (p *BaseProcessor) VerifyBinary() error {
 	_, err := exec.LookPath(p.binaryName)
@@ -37,7 +97,26 @@ func (p *BaseProcessor) VerifyBinary() error {
 	return nil
 }
 
+// Version returns the first line of "<binary> --version", or "" if it cannot be determined
+func (p *BaseProcessor) Version(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, p.binaryName, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
 func (p *BaseProcessor) Execute(ctx context.Context, args []string, timeoutMinutes int) (*CommandResult, error) {
+	return p.retried(ctx, func(ctx context.Context) (*CommandResult, error) {
+		return p.execute(ctx, args, timeoutMinutes)
+	})
+}
+
+func (p *BaseProcessor) execute(ctx context.Context, args []string, timeoutMinutes int) (*CommandResult, error) {
 	if timeoutMinutes <= 0 {
 		return nil, errors.NewValidationError("timeout must be positive").
 			WithContext("timeout_minutes", timeoutMinutes)
@@ -46,16 +125,17 @@ func (p *BaseProcessor) Execute(ctx context.Context, args []string, timeoutMinut
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMinutes)*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, p.binaryName, args...)
+	cmd := p.command(ctx, args)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	p.logCommandStart(args, timeoutMinutes)
 
+	startedAt := time.Now()
 	err := cmd.Run()
 
-	return p.handleCommandResult(ctx, cmd, stdout, stderr, err, timeoutMinutes)
+	return p.handleCommandResult(ctx, cmd, args, startedAt, stdout, stderr, err, timeoutMinutes)
 }
 
 func (p *BaseProcessor) ExecuteWithInput(ctx context.Context, args []string, input io.Reader, timeoutMinutes int) (*CommandResult, error) {
@@ -67,7 +147,7 @@ func (p *BaseProcessor) ExecuteWithInput(ctx context.Context, args []string, inp
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMinutes)*time.Minute)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, p.binaryName, args...)
+	cmd := p.command(ctx, args)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdin = input
 	cmd.Stdout = &stdout
@@ -75,12 +155,48 @@ func (p *BaseProcessor) ExecuteWithInput(ctx context.Context, args []string, inp
 
 	p.logCommandStart(args, timeoutMinutes)
 
+	startedAt := time.Now()
+	err := cmd.Run()
+
+	return p.handleCommandResult(ctx, cmd, args, startedAt, stdout, stderr, err, timeoutMinutes)
+}
+
+// ExecuteWithOutput is Execute with stdout also streamed to w as the command writes it
+func (p *BaseProcessor) ExecuteWithOutput(ctx context.Context, args []string, w io.Writer, timeoutMinutes int) (*CommandResult, error) {
+	return p.retried(ctx, func(ctx context.Context) (*CommandResult, error) {
+		return p.executeWithOutput(ctx, args, w, timeoutMinutes)
+	})
+}
+
+func (p *BaseProcessor) executeWithOutput(ctx context.Context, args []string, w io.Writer, timeoutMinutes int) (*CommandResult, error) {
+	if timeoutMinutes <= 0 {
+		return nil, errors.NewValidationError("timeout must be positive").
+			WithContext("timeout_minutes", timeoutMinutes)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMinutes)*time.Minute)
+	defer cancel()
+
+	cmd := p.command(ctx, args)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&stdout, w)
+	cmd.Stderr = &stderr
+
+	p.logCommandStart(args, timeoutMinutes)
+
+	startedAt := time.Now()
 	err := cmd.Run()
 
-	return p.handleCommandResult(ctx, cmd, stdout, stderr, err, timeoutMinutes)
+	return p.handleCommandResult(ctx, cmd, args, startedAt, stdout, stderr, err, timeoutMinutes)
 }
 
 func (p *BaseProcessor) ExecuteToFile(ctx context.Context, args []string, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	return p.retried(ctx, func(ctx context.Context) (*CommandResult, error) {
+		return p.executeToFile(ctx, args, outputFilePath, timeoutMinutes)
+	})
+}
+
+func (p *BaseProcessor) executeToFile(ctx context.Context, args []string, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
 	if timeoutMinutes <= 0 {
 		return nil, errors.NewValidationError("timeout must be positive").
 			WithContext("timeout_minutes", timeoutMinutes)
@@ -96,20 +212,22 @@ func (p *BaseProcessor) ExecuteToFile(ctx context.Context, args []string, output
 	}
 	defer file.Close()
 
-	cmd := exec.CommandContext(ctx, p.binaryName, args...)
+	cmd := p.command(ctx, args)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = io.MultiWriter(file, &stdout) // Write to both file and buffer
 	cmd.Stderr = &stderr
 
 	p.logCommandStart(args, timeoutMinutes)
 
+	startedAt := time.Now()
 	err = cmd.Run()
 
-	return p.handleCommandResult(ctx, cmd, stdout, stderr, err, timeoutMinutes)
+	return p.handleCommandResult(ctx, cmd, args, startedAt, stdout, stderr, err, timeoutMinutes)
 }
 
-func (p *BaseProcessor) handleCommandResult(ctx context.Context, cmd *exec.Cmd, stdout, stderr bytes.Buffer, err error, timeoutMinutes int) (*CommandResult, error) {
+func (p *BaseProcessor) handleCommandResult(ctx context.Context, cmd *exec.Cmd, args []string, startedAt time.Time, stdout, stderr bytes.Buffer, err error, timeoutMinutes int) (*CommandResult, error) {
 	result := p.createResult(stdout, stderr, err)
+	p.slowLog.record(ctx, p.binaryName, args, time.Since(startedAt), result.ExitCode, timeoutMinutes)
 
 	// Check context errors first
 	if ctx.Err() == context.DeadlineExceeded {
@@ -147,6 +265,19 @@ func (p *BaseProcessor) categorizeCommandError(result *CommandResult, err error)
 	exitCode := result.ExitCode
 	stderr := result.Stderr
 
+	if errors.IsDiskFullOutput(stderr) {
+		// Out of scratch space - retryable on a worker with a fresh or larger disk
+		p.logger.Error("command ran out of disk space",
+			"binary", p.binaryName,
+			"exit_code", exitCode,
+			"stderr", stderr,
+		)
+		return errors.Wrap(err, errors.ErrorTypeDiskFull, "command ran out of disk space").
+			WithContext("binary", p.binaryName).
+			WithContext("exit_code", exitCode).
+			WithContext("stderr", stderr)
+	}
+
 	switch exitCode {
 	case 126:
 		// Permission or not executable - configuration issue
@@ -248,3 +379,29 @@ func (p *BaseProcessor) logCommandStart(args []string, timeoutMinutes int) {
 		)
 	}
 }
+
+func (p *BaseProcessor) ensureOutputDirectory(outputFilePath string) error {
+	outputDir := filepath.Dir(outputFilePath)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create output directory").
+			WithContext("output_dir", outputDir)
+	}
+	return nil
+}
+
+func (p *BaseProcessor) verifyOutputFile(outputFilePath string) error {
+	info, err := os.Stat(outputFilePath)
+	if os.IsNotExist(err) {
+		return errors.NewProcessingError("output file was not created").
+			WithContext("output_file", outputFilePath)
+	}
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to verify output file").
+			WithContext("output_file", outputFilePath)
+	}
+	if info.Size() == 0 {
+		return errors.NewProcessingError("output file is empty").
+			WithContext("output_file", outputFilePath)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package processors
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Format families: formats of a family go through the same processors
+const (
+	FamilyRaster     = "raster"      // Single-resolution images vips reads directly
+	FamilyWholeSlide = "whole-slide" // Vendor slides read through OpenSlide
+	FamilyRaw        = "raw"         // Camera raw files developed by dcraw first
+)
+
+// FormatCapability is a row of the capability matrix: which processors handle an
+// input format at each step, and what has to happen to it before it can be tiled
+type FormatCapability struct {
+	Format      string   `json:"format"` // Extension without the dot
+	Family      string   `json:"family"`
+	Info        []string `json:"info"`      // Dimension probes, in the order they are tried
+	Thumbnail   string   `json:"thumbnail"` // Processor of thumbnail.jpg
+	Tiling      []string `json:"tiling"`    // Tilers, fallbacks after the first
+	Conversions []string `json:"conversions,omitempty"`
+	MultiFile   bool     `json:"multi_file,omitempty"` // Pixel data in a companion directory (IsMultiFileFormat)
+}
+
+// familyCapabilities are the processors of each family, see GetImageInfoAs for the
+// probes and GenerateDZI for the tilers
+var familyCapabilities = map[string]FormatCapability{
+	FamilyRaster: {
+		Info:        []string{"vipsheader"},
+		Thumbnail:   "vips thumbnail",
+		Tiling:      []string{"vips dzsave"},
+		Conversions: []string{"channel mapping of single/multi-channel or >8-bit images (CHANNEL_MAPPING_ENABLED)"},
+	},
+	FamilyWholeSlide: {
+		Info:      []string{"openslide", "exiftool", "vipsheader"},
+		Thumbnail: "vips thumbnail (openslide loader), OpenSlide preview fallback",
+		Tiling:    []string{"vips dzsave (openslide loader)", "openslide tiler (OPENSLIDE_TILER)"},
+	},
+	FamilyRaw: {
+		Info:      []string{"exiftool"},
+		Thumbnail: "vips thumbnail of the intermediate",
+		Tiling:    []string{"vips dzsave of the intermediate"},
+		Conversions: []string{
+			"dcraw: develop to INTERMEDIATE_FORMAT",
+			"channel mapping of single/multi-channel or >8-bit images (CHANNEL_MAPPING_ENABLED)",
+		},
+	},
+}
+
+// formatFamilies is the registry of the input formats the pipeline processes, keyed by
+// extension. It must list the formats of supported_formats.json.
+var formatFamilies = map[string]string{
+	"bmp":  FamilyRaster,
+	"jpeg": FamilyRaster,
+	"jpg":  FamilyRaster,
+	"png":  FamilyRaster,
+	"tif":  FamilyRaster,
+	"tiff": FamilyRaster,
+	"bif":  FamilyWholeSlide,
+	"mrxs": FamilyWholeSlide,
+	"ndpi": FamilyWholeSlide,
+	"scn":  FamilyWholeSlide,
+	"svs":  FamilyWholeSlide,
+	"vms":  FamilyWholeSlide,
+	"vmu":  FamilyWholeSlide,
+	"dng":  FamilyRaw,
+}
+
+// unsupportedFormatHints say what to do with formats that are often submitted but no
+// processor reads
+var unsupportedFormatHints = map[string]string{
+	"czi":     "Zeiss CZI is not read by OpenSlide or vips, convert it to OME-TIFF (e.g. with bfconvert)",
+	"dcm":     "DICOM whole-slide images are not supported, export the slide as SVS or OME-TIFF",
+	"isyntax": "Philips iSyntax is not read by OpenSlide or vips, convert it to TIFF with the Philips SDK",
+	"jp2":     "JPEG 2000 is not read by the workers, convert it to TIFF",
+	"cr2":     "only DNG camera raw files are developed, convert the raw file to DNG",
+	"nef":     "only DNG camera raw files are developed, convert the raw file to DNG",
+	"arw":     "only DNG camera raw files are developed, convert the raw file to DNG",
+	"zip":     "archives are not unpacked, submit the image inside",
+}
+
+// LookupFormat returns the capabilities of the format of the extension ext (with or
+// without the dot, any case); ok is false for unsupported formats
+func LookupFormat(ext string) (FormatCapability, bool) {
+	format := strings.ToLower(strings.TrimPrefix(ext, "."))
+	family, ok := formatFamilies[format]
+	if !ok {
+		return FormatCapability{}, false
+	}
+	capability := familyCapabilities[family]
+	capability.Format = format
+	capability.Family = family
+	capability.MultiFile = IsMultiFileFormat("." + format)
+	if capability.MultiFile {
+		capability.Conversions = append(slices.Clip(capability.Conversions),
+			"staging of the companion directory")
+	}
+	return capability, true
+}
+
+// FormatCapabilities is the capability matrix of every supported format, by family
+// and then format
+func FormatCapabilities() []FormatCapability {
+	capabilities := make([]FormatCapability, 0, len(formatFamilies))
+	for format := range formatFamilies {
+		capability, _ := LookupFormat(format)
+		capabilities = append(capabilities, capability)
+	}
+	sort.Slice(capabilities, func(i, j int) bool {
+		if capabilities[i].Family != capabilities[j].Family {
+			return capabilities[i].Family < capabilities[j].Family
+		}
+		return capabilities[i].Format < capabilities[j].Format
+	})
+	return capabilities
+}
+
+// SupportedFormatNames lists the supported formats, sorted
+func SupportedFormatNames() []string {
+	names := make([]string, 0, len(formatFamilies))
+	for format := range formatFamilies {
+		names = append(names, format)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnsupportedFormatError is the validation error of an input whose format is not in
+// the capability matrix: ext is the extension the input was processed as, detected
+// the format sniffed from its content ("" when unrecognized)
+func UnsupportedFormatError(ext, detected string) error {
+	format := strings.ToLower(strings.TrimPrefix(ext, "."))
+	err := errors.NewValidationError(UnsupportedFormatMessage(ext, detected))
+	if format != "" {
+		err = err.WithContext("format", format)
+	}
+	if detected != "" {
+		err = err.WithContext("detected_format", detected)
+	}
+	return err
+}
+
+// UnsupportedFormatMessage says why an input of the format is rejected and, for
+// formats often submitted, what to convert it to; otherwise it lists the supported ones
+func UnsupportedFormatMessage(ext, detected string) string {
+	format := strings.ToLower(strings.TrimPrefix(ext, "."))
+
+	var message string
+	switch {
+	case format == "" && detected == "":
+		message = "input has no extension and its content is not a recognized image format"
+	case format == "":
+		message = fmt.Sprintf("input has no extension and its content (%s) is not a supported format", detected)
+	default:
+		message = fmt.Sprintf("input format .%s is not supported", format)
+	}
+	if hint, ok := unsupportedFormatHints[format]; ok {
+		message += ": " + hint
+	} else {
+		message += "; supported formats: " + strings.Join(SupportedFormatNames(), ", ")
+	}
+	return message
+}
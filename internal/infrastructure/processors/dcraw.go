@@ -5,7 +5,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/errors"
 )
 
@@ -26,8 +29,9 @@ func NewDcrawProcessor(logger *slog.Logger) *DcrawProcessor {
 	return processor
 }
 
-// DNGToTIFF converts a DNG file to TIFF format
-func (p *DcrawProcessor) DNGToTIFF(ctx context.Context, inputFilePath, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+// DNGToTIFF develops a DNG file into an uncompressed 8 or 16-bit TIFF with the white
+// balance, gamma, highlight mode and output color space of cfg
+func (p *DcrawProcessor) DNGToTIFF(ctx context.Context, inputFilePath, outputFilePath string, cfg config.DNGConfig, bitDepth, timeoutMinutes int) (*CommandResult, error) {
 	// Validate inputs
 	if err := p.validateDNGToTIFFInputs(inputFilePath, outputFilePath, timeoutMinutes); err != nil {
 		return nil, err
@@ -40,15 +44,15 @@ func (p *DcrawProcessor) DNGToTIFF(ctx context.Context, inputFilePath, outputFil
 
 	// Build command arguments
 	args := []string{
-		"-c",      // Write to stdout
-		"-T",      // Output TIFF
-		"-6",      // 16-bit output with sRGB gamma (matches macOS Preview brightness)
-		"-q", "3", // AHD interpolation (high-quality)
-		"-w",      // Camera white balance
-		"-H", "0", // No highlight clipping
-		"-o", "1", // sRGB color space
-		inputFilePath,
+		"-c", // Write to stdout
+		"-T", // Output TIFF
 	}
+	if bitDepth == 16 {
+		args = append(args, "-6") // 16-bit output with gamma (matches macOS Preview brightness)
+	}
+	args = append(args, "-q", "3") // AHD interpolation (high-quality)
+	args = append(args, developArgs(cfg)...)
+	args = append(args, inputFilePath)
 
 	result, err := p.ExecuteToFile(ctx, args, outputFilePath, timeoutMinutes)
 
@@ -56,7 +60,9 @@ func (p *DcrawProcessor) DNGToTIFF(ctx context.Context, inputFilePath, outputFil
 	if err != nil {
 		return result, errors.WrapProcessingError(err, "failed to convert DNG to TIFF").
 			WithContext("input_file", inputFilePath).
-			WithContext("output_file", outputFilePath)
+			WithContext("output_file", outputFilePath).
+			WithContext("white_balance", cfg.WhiteBalance).
+			WithContext("color_space", cfg.ColorSpace)
 	}
 
 	// Verify output file was created and has content
@@ -67,6 +73,33 @@ func (p *DcrawProcessor) DNGToTIFF(ctx context.Context, inputFilePath, outputFil
 	return result, nil
 }
 
+// developArgs are the dcraw flags of the development options in cfg
+func developArgs(cfg config.DNGConfig) []string {
+	var args []string
+	switch cfg.WhiteBalance {
+	case config.DNGWhiteBalanceCamera:
+		args = append(args, "-w")
+	case config.DNGWhiteBalanceAuto:
+		args = append(args, "-a")
+	case config.DNGWhiteBalanceNone:
+	default:
+		// Custom multipliers, validated by the config loader
+		args = append(args, "-r")
+		args = append(args, strings.Fields(cfg.WhiteBalance)...)
+	}
+
+	if cfg.Gamma != "" {
+		args = append(args, "-g")
+		args = append(args, strings.Fields(cfg.Gamma)...)
+	}
+
+	args = append(args,
+		"-H", strconv.Itoa(cfg.Highlight),
+		"-o", strconv.Itoa(cfg.ColorSpaceCode()),
+	)
+	return args
+}
+
 func (p *DcrawProcessor) validateDNGToTIFFInputs(inputFilePath, outputFilePath string, timeoutMinutes int) error {
 	// Check input file exists
 	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
@@ -74,9 +107,9 @@ func (p *DcrawProcessor) validateDNGToTIFFInputs(inputFilePath, outputFilePath s
 			WithContext("input_file", inputFilePath)
 	}
 
-	// Check input file extension
+	// Check input file extension, or the content for DNGs named otherwise
 	ext := filepath.Ext(inputFilePath)
-	if ext != ".dng" && ext != ".DNG" {
+	if ext != ".dng" && ext != ".DNG" && !isSniffed(inputFilePath, SniffedDNG) {
 		return errors.NewValidationError("input file must be a DNG file").
 			WithContext("input_file", inputFilePath).
 			WithContext("extension", ext)
@@ -98,29 +131,3 @@ func (p *DcrawProcessor) validateDNGToTIFFInputs(inputFilePath, outputFilePath s
 
 	return nil
 }
-
-func (p *DcrawProcessor) ensureOutputDirectory(outputFilePath string) error {
-	outputDir := filepath.Dir(outputFilePath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return errors.WrapStorageError(err, "failed to create output directory").
-			WithContext("output_dir", outputDir)
-	}
-	return nil
-}
-
-func (p *DcrawProcessor) verifyOutputFile(outputFilePath string) error {
-	info, err := os.Stat(outputFilePath)
-	if os.IsNotExist(err) {
-		return errors.NewProcessingError("output file was not created").
-			WithContext("output_file", outputFilePath)
-	}
-	if err != nil {
-		return errors.WrapStorageError(err, "failed to verify output file").
-			WithContext("output_file", outputFilePath)
-	}
-	if info.Size() == 0 {
-		return errors.NewProcessingError("output file is empty").
-			WithContext("output_file", outputFilePath)
-	}
-	return nil
-}
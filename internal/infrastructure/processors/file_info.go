@@ -18,7 +18,13 @@ import (
 type ImageInfo struct {
 	Width  int
 	Height int
-	Size   int64
+	// Size is the bytes on disk, from stat rather than image properties: the file,
+	// and the companion directory of a multi-file slide
+	Size int64
+
+	// Levels is the pyramid of a whole-slide image read through OpenSlide, level 0
+	// first; empty for other formats and when OpenSlide could not read the slide
+	Levels []SlideLevel
 }
 
 type ImageInfoProcessor struct {
@@ -32,38 +38,51 @@ func NewImageInfoProcessor(logger *slog.Logger) *ImageInfoProcessor {
 }
 
 func (p *ImageInfoProcessor) GetImageInfo(ctx context.Context, inputFilePath string) (*ImageInfo, error) {
+	return p.GetImageInfoAs(ctx, inputFilePath, filepath.Ext(inputFilePath))
+}
+
+// GetImageInfoAs is GetImageInfo for a file whose format is given by ext instead of
+// its name, for inputs whose content did not match their extension
+func (p *ImageInfoProcessor) GetImageInfoAs(ctx context.Context, inputFilePath, ext string) (*ImageInfo, error) {
 	fileInfo, err := os.Stat(inputFilePath)
 	if err != nil {
 		return nil, errors.WrapStorageError(err, "failed to stat file").
 			WithContext("file", inputFilePath)
 	}
 
-	ext := strings.ToLower(filepath.Ext(inputFilePath))
+	ext = strings.ToLower(ext)
+
+	size := fileInfo.Size()
+	if IsMultiFileFormat(ext) {
+		if size, err = SlideBundleSize(inputFilePath); err != nil {
+			return nil, err
+		}
+	}
 
-	switch ext {
-	case ".dng":
+	switch {
+	case ext == ".dng":
 		p.logger.Info("Detected RAW format, using ExifTool for dimensions", "file", inputFilePath)
-		return p.getDimensionsWithExifTool(ctx, inputFilePath, fileInfo.Size())
+		return p.getDimensionsWithExifTool(ctx, inputFilePath, size)
 
-	case ".ndpi", ".svs", ".scn", ".bif", ".vms", ".vmu":
+	case IsWholeSlideFormat(ext):
 		p.logger.Info("Detected WSI format, attempting extraction strategies", "file", inputFilePath)
 
 		// 1. Strateji: OpenSlide (Standart yöntem)
-		info, err := p.getDimensionsWithOpenSlide(ctx, inputFilePath, fileInfo.Size())
+		info, err := p.getDimensionsWithOpenSlide(ctx, inputFilePath, size)
 		if err == nil {
 			return info, nil
 		}
 		p.logger.Warn("OpenSlide failed, trying ExifTool", "error", err)
 
 		// 2. Strateji: ExifTool (Metadata okuyucu)
-		info, err = p.getDimensionsWithExifTool(ctx, inputFilePath, fileInfo.Size())
+		info, err = p.getDimensionsWithExifTool(ctx, inputFilePath, size)
 		if err == nil {
 			return info, nil
 		}
 		p.logger.Warn("ExifTool failed, trying VipsHeader", "error", err)
 
 		// 3. Strateji: VipsHeader (Alternatif kütüphane)
-		info, err = p.getDimensionsWithVips(ctx, inputFilePath, fileInfo.Size())
+		info, err = p.getDimensionsWithVips(ctx, inputFilePath, size)
 		if err == nil {
 			return info, nil
 		}
@@ -72,47 +91,81 @@ func (p *ImageInfoProcessor) GetImageInfo(ctx context.Context, inputFilePath str
 			WithContext("file", inputFilePath)
 
 	default:
-		return p.getDimensionsWithVips(ctx, inputFilePath, fileInfo.Size())
+		return p.getDimensionsWithVips(ctx, inputFilePath, size)
 	}
 }
 
-func (p *ImageInfoProcessor) getDimensionsWithOpenSlide(ctx context.Context, inputFilePath string, size int64) (*ImageInfo, error) {
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+// IsWholeSlideFormat reports whether the extension belongs to a vendor
+// whole-slide format that is read through OpenSlide
+func IsWholeSlideFormat(ext string) bool {
+	format := strings.ToLower(strings.TrimPrefix(ext, "."))
+	return formatFamilies[format] == FamilyWholeSlide
+}
 
-	cmd := exec.CommandContext(ctx, "openslide-show-properties", inputFilePath)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// IsMultiFileFormat reports whether the extension names the index file of a slide
+// whose pixel data sits in a companion directory next to it: a MIRAX slide.mrxs
+// comes with slide/ holding Slidedat.ini and the Data*.dat files
+func IsMultiFileFormat(ext string) bool {
+	return strings.ToLower(ext) == ".mrxs"
+}
 
-	if err := cmd.Run(); err != nil {
+// CompanionDir is the directory holding the data files of the multi-file slide at
+// path, the path without its extension
+func CompanionDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// SlideBundleSize is the size of the multi-file slide at path: its index file and
+// every file in its companion directory. A missing companion directory is a
+// validation error, the slide cannot be read without it.
+func SlideBundleSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, errors.WrapStorageError(err, "failed to stat file").
+			WithContext("file", path)
+	}
+	size := info.Size()
+
+	dir := CompanionDir(path)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return 0, errors.NewValidationError("multi-file slide has no companion directory").
+			WithContext("file", path).
+			WithContext("dir", dir)
+	}
+	err = filepath.WalkDir(dir, func(p string, entry os.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, errors.WrapStorageError(err, "failed to read companion directory").
+			WithContext("file", path).
+			WithContext("dir", dir)
+	}
+	return size, nil
+}
+
+// getDimensionsWithOpenSlide reads the dimensions and the whole level listing of a
+// slide from its OpenSlide properties. The size is the stat size passed in: properties
+// like openslide.image-size are missing from most slides.
+func (p *ImageInfoProcessor) getDimensionsWithOpenSlide(ctx context.Context, inputFilePath string, size int64) (*ImageInfo, error) {
+	slide, err := p.GetSlideProperties(ctx, inputFilePath)
+	if err != nil {
 		p.logger.Error("openslide-show-properties failed",
 			"file", inputFilePath,
-			"stderr", stderr.String(),
 			"error", err)
-		return nil, errors.WrapProcessingError(err, "failed to get dimensions with OpenSlide").
-			WithContext("file", inputFilePath).
-			WithContext("stderr", stderr.String())
+		return nil, err
 	}
 
-	output := stdout.String()
-
-	// OpenSlide properties format:
-	// openslide.level[0].width: 46000
-	// openslide.level[0].height: 32914
-
 	var width, height int
-
-	// Extract width
-	widthRegex := regexp.MustCompile(`openslide\.level\[0\]\.width:\s*(\d+)`)
-	if matches := widthRegex.FindStringSubmatch(output); len(matches) > 1 {
-		fmt.Sscanf(matches[1], "%d", &width)
-	}
-
-	// Extract height
-	heightRegex := regexp.MustCompile(`openslide\.level\[0\]\.height:\s*(\d+)`)
-	if matches := heightRegex.FindStringSubmatch(output); len(matches) > 1 {
-		fmt.Sscanf(matches[1], "%d", &height)
+	if len(slide.Levels) > 0 {
+		width, height = slide.Levels[0].Width, slide.Levels[0].Height
 	}
 
 	if width == 0 || height == 0 {
@@ -130,12 +183,14 @@ func (p *ImageInfoProcessor) getDimensionsWithOpenSlide(ctx context.Context, inp
 		"file", inputFilePath,
 		"width", width,
 		"height", height,
+		"levels", len(slide.Levels),
 		"size", size)
 
 	return &ImageInfo{
 		Width:  width,
 		Height: height,
 		Size:   size,
+		Levels: slide.Levels,
 	}, nil
 }
 
@@ -263,3 +318,45 @@ func (p *ImageInfoProcessor) getDimensionsWithVips(ctx context.Context, inputFil
 		Size:   size,
 	}, nil
 }
+
+// GetLevelDownsample returns the downsample factor of an OpenSlide pyramid level
+// relative to level 0
+func (p *ImageInfoProcessor) GetLevelDownsample(ctx context.Context, inputFilePath string, level int) (float64, error) {
+	if level == 0 {
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "openslide-show-properties", inputFilePath)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return 0, errors.WrapProcessingError(err, "failed to read OpenSlide properties").
+			WithContext("file", inputFilePath).
+			WithContext("stderr", stderr.String())
+	}
+
+	// openslide.level[1].downsample: '4.0001'
+	pattern := regexp.MustCompile(fmt.Sprintf(`openslide\.level\[%d\]\.downsample:\s*'?([0-9.]+)`, level))
+	matches := pattern.FindStringSubmatch(stdout.String())
+	if len(matches) < 2 {
+		return 0, errors.NewValidationError("pyramid level not found in slide").
+			WithContext("file", inputFilePath).
+			WithContext("level", level)
+	}
+
+	var downsample float64
+	fmt.Sscanf(matches[1], "%g", &downsample)
+	if downsample <= 0 {
+		return 0, errors.NewProcessingError("invalid level downsample detected from OpenSlide").
+			WithContext("file", inputFilePath).
+			WithContext("level", level).
+			WithContext("downsample", matches[1])
+	}
+
+	return downsample, nil
+}
@@ -0,0 +1,89 @@
+package processors
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// decodeImageFile decodes a PNG or JPEG file into memory
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to open image").
+			WithContext("file", path)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, errors.WrapProcessingError(err, "failed to decode image").
+			WithContext("file", path)
+	}
+	return img, nil
+}
+
+// encodeImageFile writes img to path, picking the encoder from the extension
+func encodeImageFile(path string, img image.Image, quality int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create output directory").
+			WithContext("output_dir", filepath.Dir(path))
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to create output file").
+			WithContext("output_file", path)
+	}
+	defer out.Close()
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".png":
+		err = png.Encode(out, img)
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
+	default:
+		return errors.NewValidationError("unsupported output image extension").
+			WithContext("output_file", path).
+			WithContext("extension", ext)
+	}
+	if err != nil {
+		return errors.WrapProcessingError(err, "failed to encode image").
+			WithContext("output_file", path)
+	}
+	return nil
+}
+
+// ReadImageConfig returns the dimensions of a PNG or JPEG file without decoding pixels
+func ReadImageConfig(path string) (*ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to open image").
+			WithContext("file", path)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, errors.WrapProcessingError(err, "failed to read image header").
+			WithContext("file", path)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to stat image").
+			WithContext("file", path)
+	}
+
+	return &ImageInfo{
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Size:   stat.Size(),
+	}, nil
+}
@@ -0,0 +1,382 @@
+package processors
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagSamplesPerPixel = 277
+	tiffTagSampleFormat    = 339
+
+	tiffTypeASCII = 2
+	tiffTypeShort = 3
+	tiffTypeLong  = 4
+	tiffTypeLong8 = 16
+
+	omeNamespace      = "http://www.openmicroscopy.org/Schemas/OME/2016-06"
+	omeSchemaLocation = omeNamespace + " " + omeNamespace + "/ome.xsd"
+)
+
+// OMEMetadata is what the OME-XML of a pyramid says beyond the pixel layout, which is
+// read from the TIFF itself
+type OMEMetadata struct {
+	Name string
+	MPPX float64 // Microns per pixel, 0 when unknown
+	MPPY float64
+}
+
+type omeXML struct {
+	XMLName        xml.Name `xml:"OME"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsXSI       string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	Creator        string   `xml:"Creator,attr"`
+	Image          omeImage `xml:"Image"`
+}
+
+type omeImage struct {
+	ID     string    `xml:"ID,attr"`
+	Name   string    `xml:"Name,attr,omitempty"`
+	Pixels omePixels `xml:"Pixels"`
+}
+
+type omePixels struct {
+	ID             string      `xml:"ID,attr"`
+	DimensionOrder string      `xml:"DimensionOrder,attr"`
+	Type           string      `xml:"Type,attr"`
+	SizeX          uint64      `xml:"SizeX,attr"`
+	SizeY          uint64      `xml:"SizeY,attr"`
+	SizeC          uint64      `xml:"SizeC,attr"`
+	SizeZ          int         `xml:"SizeZ,attr"`
+	SizeT          int         `xml:"SizeT,attr"`
+	Interleaved    bool        `xml:"Interleaved,attr"`
+	PhysicalSizeX  float64     `xml:"PhysicalSizeX,attr,omitempty"` // µm, the OME default unit
+	PhysicalSizeY  float64     `xml:"PhysicalSizeY,attr,omitempty"`
+	Channel        omeChannel  `xml:"Channel"`
+	TiffData       omeTiffData `xml:"TiffData"`
+}
+
+type omeChannel struct {
+	ID              string `xml:"ID,attr"`
+	SamplesPerPixel uint64 `xml:"SamplesPerPixel,attr"`
+}
+
+type omeTiffData struct {
+	IFD        int `xml:"IFD,attr"`
+	PlaneCount int `xml:"PlaneCount,attr"`
+}
+
+// WriteOMEXML makes the TIFF at path an OME-TIFF: OME-XML describing its first image
+// becomes the ImageDescription of that image. The XML and a copy of the first image
+// directory with the description are appended to the file and the header pointed at
+// the copy, the pixel data is not touched.
+func WriteOMEXML(path string, meta OMEMetadata) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to open TIFF").
+			WithContext("file", path)
+	}
+	defer f.Close()
+
+	dir, err := readFirstTIFFDirectory(f)
+	if err != nil {
+		return errors.WrapProcessingError(err, "failed to read TIFF directory").
+			WithContext("file", path)
+	}
+	description, err := dir.omeXML(f, meta)
+	if err != nil {
+		return errors.WrapProcessingError(err, "failed to describe TIFF pixels").
+			WithContext("file", path)
+	}
+	if err := dir.setDescription(f, description); err != nil {
+		return errors.WrapStorageError(err, "failed to write OME-XML").
+			WithContext("file", path)
+	}
+	return f.Close()
+}
+
+// tiffDirectory is the first image directory of a TIFF or BigTIFF
+type tiffDirectory struct {
+	order     binary.ByteOrder
+	bigTIFF   bool
+	entries   [][]byte // Raw entries, sorted by tag as the format requires
+	nextIFD   []byte   // Raw offset of the next directory
+	entrySize int
+	valueSize int
+}
+
+func readFirstTIFFDirectory(r io.ReaderAt) (*tiffDirectory, error) {
+	head := make([]byte, 16)
+	if _, err := r.ReadAt(head[:8], 0); err != nil {
+		return nil, err
+	}
+	dir := &tiffDirectory{order: binary.LittleEndian, entrySize: 12, valueSize: 4}
+	switch string(head[:2]) {
+	case "II":
+	case "MM":
+		dir.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF")
+	}
+
+	var offset int64
+	countSize := 2
+	switch dir.order.Uint16(head[2:4]) {
+	case 42:
+		offset = int64(dir.order.Uint32(head[4:8]))
+	case 43:
+		if _, err := r.ReadAt(head[8:16], 8); err != nil {
+			return nil, err
+		}
+		dir.bigTIFF, dir.entrySize, dir.valueSize, countSize = true, 20, 8, 8
+		offset = int64(dir.order.Uint64(head[8:16]))
+	default:
+		return nil, fmt.Errorf("not a TIFF")
+	}
+
+	countBuf := make([]byte, countSize)
+	if _, err := r.ReadAt(countBuf, offset); err != nil {
+		return nil, err
+	}
+	var count uint64
+	if dir.bigTIFF {
+		count = dir.order.Uint64(countBuf)
+	} else {
+		count = uint64(dir.order.Uint16(countBuf))
+	}
+	if count == 0 || count > 4096 {
+		return nil, fmt.Errorf("invalid directory entry count %d", count)
+	}
+
+	block := make([]byte, int(count)*dir.entrySize+dir.valueSize)
+	if _, err := r.ReadAt(block, offset+int64(countSize)); err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(count); i++ {
+		dir.entries = append(dir.entries, block[i*dir.entrySize:(i+1)*dir.entrySize])
+	}
+	dir.nextIFD = block[int(count)*dir.entrySize:]
+	return dir, nil
+}
+
+// value returns the first value of the integer tag, ok false when it is missing
+func (d *tiffDirectory) value(r io.ReaderAt, tag uint16) (uint64, bool) {
+	for _, entry := range d.entries {
+		if d.order.Uint16(entry[0:2]) != tag {
+			continue
+		}
+		var size int
+		switch d.order.Uint16(entry[2:4]) {
+		case tiffTypeShort:
+			size = 2
+		case tiffTypeLong:
+			size = 4
+		case tiffTypeLong8:
+			size = 8
+		default:
+			return 0, false
+		}
+
+		var count uint64
+		field := entry[8:]
+		if d.bigTIFF {
+			count = d.order.Uint64(entry[4:12])
+			field = entry[12:20]
+		} else {
+			count = uint64(d.order.Uint32(entry[4:8]))
+		}
+		if count == 0 {
+			return 0, false
+		}
+		// Values that do not fit the field are stored at the offset it holds
+		if count*uint64(size) > uint64(d.valueSize) {
+			var offset int64
+			if d.bigTIFF {
+				offset = int64(d.order.Uint64(field))
+			} else {
+				offset = int64(d.order.Uint32(field))
+			}
+			field = make([]byte, size)
+			if _, err := r.ReadAt(field, offset); err != nil {
+				return 0, false
+			}
+		}
+		switch size {
+		case 2:
+			return uint64(d.order.Uint16(field)), true
+		case 4:
+			return uint64(d.order.Uint32(field)), true
+		default:
+			return d.order.Uint64(field), true
+		}
+	}
+	return 0, false
+}
+
+// omeXML describes the first image of the TIFF as one plane of interleaved samples
+func (d *tiffDirectory) omeXML(r io.ReaderAt, meta OMEMetadata) ([]byte, error) {
+	width, okWidth := d.value(r, tiffTagImageWidth)
+	height, okHeight := d.value(r, tiffTagImageLength)
+	if !okWidth || !okHeight {
+		return nil, fmt.Errorf("image size tags are missing")
+	}
+	samples, ok := d.value(r, tiffTagSamplesPerPixel)
+	if !ok {
+		samples = 1
+	}
+	bits, ok := d.value(r, tiffTagBitsPerSample)
+	if !ok {
+		bits = 1
+	}
+	format, ok := d.value(r, tiffTagSampleFormat)
+	if !ok {
+		format = 1
+	}
+	pixelType, err := omePixelType(bits, format)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := omeXML{
+		Xmlns:          omeNamespace,
+		XmlnsXSI:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: omeSchemaLocation,
+		Creator:        "histopathai image-processing-service",
+		Image: omeImage{
+			ID:   "Image:0",
+			Name: meta.Name,
+			Pixels: omePixels{
+				ID:             "Pixels:0",
+				DimensionOrder: "XYCZT",
+				Type:           pixelType,
+				SizeX:          width,
+				SizeY:          height,
+				SizeC:          samples,
+				SizeZ:          1,
+				SizeT:          1,
+				Interleaved:    samples > 1,
+				PhysicalSizeX:  meta.MPPX,
+				PhysicalSizeY:  meta.MPPY,
+				Channel:        omeChannel{ID: "Channel:0:0", SamplesPerPixel: samples},
+				TiffData:       omeTiffData{IFD: 0, PlaneCount: 1},
+			},
+		},
+	}
+	data, err := xml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// omePixelType is the OME pixel type of samples of bits bits in TIFF SampleFormat
+// format (1 unsigned, 2 signed, 3 floating point)
+func omePixelType(bits, format uint64) (string, error) {
+	switch {
+	case format == 1 && (bits == 8 || bits == 16 || bits == 32):
+		return fmt.Sprintf("uint%d", bits), nil
+	case format == 2 && (bits == 8 || bits == 16 || bits == 32):
+		return fmt.Sprintf("int%d", bits), nil
+	case format == 3 && bits == 32:
+		return "float", nil
+	case format == 3 && bits == 64:
+		return "double", nil
+	}
+	return "", fmt.Errorf("no OME pixel type for %d-bit samples of sample format %d", bits, format)
+}
+
+// setDescription appends description and a copy of the directory with it as the
+// ImageDescription to f, and points the header at the copy
+func (d *tiffDirectory) setDescription(f *os.File, description []byte) error {
+	text := append(description, 0)
+	textOffset, err := appendAligned(f, text)
+	if err != nil {
+		return err
+	}
+
+	entry := make([]byte, d.entrySize)
+	d.order.PutUint16(entry[0:2], tiffTagImageDescription)
+	d.order.PutUint16(entry[2:4], tiffTypeASCII)
+	if d.bigTIFF {
+		d.order.PutUint64(entry[4:12], uint64(len(text)))
+		d.order.PutUint64(entry[12:20], uint64(textOffset))
+	} else {
+		if textOffset > math.MaxUint32 {
+			return fmt.Errorf("TIFF is too large for the description, it must be a BigTIFF")
+		}
+		d.order.PutUint32(entry[4:8], uint32(len(text)))
+		d.order.PutUint32(entry[8:12], uint32(textOffset))
+	}
+
+	entries := make([][]byte, 0, len(d.entries)+1)
+	for _, e := range d.entries {
+		if d.order.Uint16(e[0:2]) != tiffTagImageDescription {
+			entries = append(entries, e)
+		}
+	}
+	entries = append(entries, entry)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return d.order.Uint16(entries[i][0:2]) < d.order.Uint16(entries[j][0:2])
+	})
+
+	var block []byte
+	if d.bigTIFF {
+		block = make([]byte, 8)
+		d.order.PutUint64(block, uint64(len(entries)))
+	} else {
+		block = make([]byte, 2)
+		d.order.PutUint16(block, uint16(len(entries)))
+	}
+	for _, e := range entries {
+		block = append(block, e...)
+	}
+	block = append(block, d.nextIFD...)
+	dirOffset, err := appendAligned(f, block)
+	if err != nil {
+		return err
+	}
+
+	if d.bigTIFF {
+		pointer := make([]byte, 8)
+		d.order.PutUint64(pointer, uint64(dirOffset))
+		_, err = f.WriteAt(pointer, 8)
+	} else {
+		if dirOffset > math.MaxUint32 {
+			return fmt.Errorf("TIFF is too large for the description, it must be a BigTIFF")
+		}
+		pointer := make([]byte, 4)
+		d.order.PutUint32(pointer, uint32(dirOffset))
+		_, err = f.WriteAt(pointer, 4)
+	}
+	return err
+}
+
+// appendAligned writes b at the end of f, on a word boundary as TIFF offsets must
+// be, and returns where it starts
+func appendAligned(f *os.File, b []byte) (int64, error) {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if pad := (8 - end%8) % 8; pad > 0 {
+		if _, err := f.Write(make([]byte, pad)); err != nil {
+			return 0, err
+		}
+		end += pad
+	}
+	if _, err := f.Write(b); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
@@ -0,0 +1,72 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+type OpenSlideProcessor struct {
+	*BaseProcessor
+}
+
+func NewOpenSlideProcessor(logger *slog.Logger) *OpenSlideProcessor {
+	processor := &OpenSlideProcessor{
+		BaseProcessor: NewBaseProcessor(logger, "openslide-write-png"),
+	}
+
+	// Verify binary at initialization
+	if err := processor.VerifyBinary(); err != nil {
+		logger.Error("openslide-write-png binary verification failed", "error", err)
+	}
+
+	return processor
+}
+
+// ReadRegion writes a PNG of the given region. x and y are level-0 coordinates,
+// width and height are in pixels of the requested level.
+func (p *OpenSlideProcessor) ReadRegion(ctx context.Context, slidePath string, x, y, level, width, height int, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(slidePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", slidePath)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.NewValidationError("region width and height must be positive").
+			WithContext("width", width).
+			WithContext("height", height)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		slidePath,
+		fmt.Sprintf("%d", x),
+		fmt.Sprintf("%d", y),
+		fmt.Sprintf("%d", level),
+		fmt.Sprintf("%d", width),
+		fmt.Sprintf("%d", height),
+		outputFilePath,
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to read slide region").
+			WithContext("input_file", slidePath).
+			WithContext("x", x).
+			WithContext("y", y).
+			WithContext("level", level).
+			WithContext("width", width).
+			WithContext("height", height)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
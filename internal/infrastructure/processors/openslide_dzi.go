@@ -0,0 +1,202 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// downsampleTolerance accepts OpenSlide levels whose downsample is slightly above the
+// power of two they stand for (4.0001 for 4)
+const downsampleTolerance = 1.001
+
+// CreateDZI tiles a whole-slide image into a dz-layout pyramid at outputBase.dzi and
+// outputBase_files without going through vips: every level is read from the closest
+// OpenSlide level in regions of chunkTiles x chunkTiles tiles, scaled in memory and cut
+// into tiles. Only jpg and png tiles are written. A non-nil onProgress is called with
+// the percentage of tiles written whenever it changes.
+func (p *OpenSlideProcessor) CreateDZI(ctx context.Context, slide *SlideProperties, slidePath, outputBase string, cfg config.DZIConfig, chunkTiles, parallelism, timeoutMinutes int, onProgress func(percent int)) (*dzi.Descriptor, error) {
+	if len(slide.Levels) == 0 {
+		return nil, errors.NewValidationError("slide has no levels").
+			WithContext("input_file", slidePath)
+	}
+	for i, level := range slide.Levels {
+		if level.Downsample <= 0 {
+			return nil, errors.NewValidationError("slide level has no downsample").
+				WithContext("input_file", slidePath).
+				WithContext("level", i)
+		}
+	}
+	suffix := dzi.FormatForSuffix(cfg.Suffix)
+	if suffix != "jpg" && suffix != "jpeg" && suffix != "png" {
+		return nil, errors.NewValidationError("the OpenSlide tiler only writes jpg and png tiles").
+			WithContext("suffix", cfg.Suffix)
+	}
+	if cfg.Layout != "dz" {
+		return nil, errors.NewValidationError("the OpenSlide tiler only writes the dz layout").
+			WithContext("layout", cfg.Layout)
+	}
+
+	descriptor := &dzi.Descriptor{
+		TileSize: cfg.TileSize,
+		Overlap:  cfg.Overlap,
+		Format:   dzi.FormatForSuffix(cfg.Suffix),
+		Width:    slide.Levels[0].Width,
+		Height:   slide.Levels[0].Height,
+	}
+	if err := descriptor.Validate(); err != nil {
+		return nil, errors.WrapValidationError(err, "invalid pyramid geometry").
+			WithContext("input_file", slidePath)
+	}
+
+	filesDir := outputBase + "_files"
+	chunkDir, err := os.MkdirTemp(filepath.Dir(outputBase), "openslide-chunks-")
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to create chunk directory").
+			WithContext("output_dir", filepath.Dir(outputBase))
+	}
+	defer os.RemoveAll(chunkDir)
+
+	total := int64(descriptor.TotalTiles())
+	var written, lastPercent atomic.Int64
+	lastPercent.Store(-1)
+	tileWritten := func() {
+		if onProgress == nil {
+			return
+		}
+		percent := written.Add(1) * 100 / total
+		if lastPercent.Swap(percent) != percent {
+			onProgress(int(percent))
+		}
+	}
+
+	// Full resolution first, so the level uploader can start on the largest level
+	for level := descriptor.MaxLevel(); level >= 0; level-- {
+		scale := float64(int64(1) << (descriptor.MaxLevel() - level))
+		source := closestSlideLevel(slide.Levels, scale)
+		ratio := scale / slide.Levels[source].Downsample
+
+		// Keep the region read from OpenSlide near chunkTiles x chunkTiles tiles
+		perChunk := max(1, int(float64(chunkTiles)/ratio))
+		cols, rows := descriptor.LevelTiles(level)
+
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(max(1, parallelism))
+		for c0 := 0; c0 < cols; c0 += perChunk {
+			for r0 := 0; r0 < rows; r0 += perChunk {
+				chunk := tileChunk{
+					level:  level,
+					col0:   c0,
+					row0:   r0,
+					col1:   min(cols, c0+perChunk),
+					row1:   min(rows, r0+perChunk),
+					source: source,
+					scale:  scale,
+				}
+				g.Go(func() error {
+					return p.writeChunk(gctx, slide, slidePath, descriptor, chunk, filesDir, chunkDir, suffix, cfg.Quality, timeoutMinutes, tileWritten)
+				})
+			}
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := descriptor.WriteFile(outputBase + ".dzi"); err != nil {
+		return nil, errors.WrapStorageError(err, "failed to write DZI descriptor").
+			WithContext("output_base", outputBase)
+	}
+	return descriptor, nil
+}
+
+// tileChunk is a block of tiles of one pyramid level read in a single region
+type tileChunk struct {
+	level      int
+	col0, row0 int // First tile, inclusive
+	col1, row1 int // Last tile, exclusive
+	source     int // OpenSlide level the region is read from
+	scale      float64
+}
+
+// writeChunk reads the region of chunk from OpenSlide, scales it to the pyramid level
+// and writes its tiles
+func (p *OpenSlideProcessor) writeChunk(ctx context.Context, slide *SlideProperties, slidePath string, descriptor *dzi.Descriptor, chunk tileChunk, filesDir, chunkDir, suffix string, quality, timeoutMinutes int, tileWritten func()) error {
+	levelWidth, levelHeight := descriptor.LevelSize(chunk.level)
+	tileSize, overlap := descriptor.TileSize, descriptor.Overlap
+	tileRect := func(col, row int) image.Rectangle {
+		return image.Rect(
+			max(0, col*tileSize-overlap),
+			max(0, row*tileSize-overlap),
+			min(levelWidth, (col+1)*tileSize+overlap),
+			min(levelHeight, (row+1)*tileSize+overlap),
+		)
+	}
+	region := tileRect(chunk.col0, chunk.row0).Union(tileRect(chunk.col1-1, chunk.row1-1))
+
+	downsample := slide.Levels[chunk.source].Downsample
+	x := int(float64(region.Min.X) * chunk.scale)
+	y := int(float64(region.Min.Y) * chunk.scale)
+	width := max(1, int(float64(region.Dx())*chunk.scale/downsample+0.5))
+	height := max(1, int(float64(region.Dy())*chunk.scale/downsample+0.5))
+
+	pngPath := filepath.Join(chunkDir, fmt.Sprintf("%d_%d_%d.png", chunk.level, chunk.col0, chunk.row0))
+	if _, err := p.ReadRegion(ctx, slidePath, x, y, chunk.source, width, height, pngPath, timeoutMinutes); err != nil {
+		return err
+	}
+	src, err := decodeImageFile(pngPath)
+	os.Remove(pngPath)
+	if err != nil {
+		return err
+	}
+
+	// OpenSlide leaves pixels outside the slide transparent, tiles get a white background
+	// like dzsave --background 255
+	pixels := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(pixels, pixels.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if src.Bounds().Dx() == region.Dx() && src.Bounds().Dy() == region.Dy() {
+		draw.Draw(pixels, pixels.Bounds(), src, src.Bounds().Min, draw.Over)
+	} else {
+		draw.BiLinear.Scale(pixels, pixels.Bounds(), src, src.Bounds(), draw.Over, nil)
+	}
+
+	levelDir := filepath.Join(filesDir, strconv.Itoa(chunk.level))
+	for col := chunk.col0; col < chunk.col1; col++ {
+		for row := chunk.row0; row < chunk.row1; row++ {
+			if err := ctx.Err(); err != nil {
+				return errors.Wrap(err, errors.ErrorTypeCancellation, "tiling canceled")
+			}
+			tile := pixels.SubImage(tileRect(col, row).Sub(region.Min))
+			tilePath := filepath.Join(levelDir, fmt.Sprintf("%d_%d.%s", col, row, suffix))
+			if err := encodeImageFile(tilePath, tile, quality); err != nil {
+				return err
+			}
+			tileWritten()
+		}
+	}
+	return nil
+}
+
+// closestSlideLevel is the OpenSlide level with the largest downsample that is not
+// above scale, so tiles are always scaled down
+func closestSlideLevel(levels []SlideLevel, scale float64) int {
+	best := 0
+	for i, level := range levels {
+		if level.Downsample <= scale*downsampleTolerance && level.Downsample > levels[best].Downsample {
+			best = i
+		}
+	}
+	return best
+}
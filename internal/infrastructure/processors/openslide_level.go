@@ -0,0 +1,98 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ReadLevelScaled writes a PNG of a whole slide level scaled down to fit within
+// maxSize x maxSize (never scaled up). The level is read in regions of chunkSize x
+// chunkSize level pixels, each scaled into the output as soon as it is decoded, so
+// memory stays near the output plus one region however large the level is. It
+// returns the size of the written image.
+func (p *OpenSlideProcessor) ReadLevelScaled(ctx context.Context, slidePath string, levels []SlideLevel, level, maxSize, chunkSize int, outputFilePath string, timeoutMinutes int) (image.Point, error) {
+	if level < 0 || level >= len(levels) {
+		return image.Point{}, errors.NewValidationError("slide level does not exist").
+			WithContext("input_file", slidePath).
+			WithContext("level", level)
+	}
+	source := levels[level]
+	if source.Width <= 0 || source.Height <= 0 || source.Downsample <= 0 {
+		return image.Point{}, errors.NewValidationError("slide level has no size or downsample").
+			WithContext("input_file", slidePath).
+			WithContext("level", level)
+	}
+	if maxSize <= 0 || chunkSize <= 0 {
+		return image.Point{}, errors.NewValidationError("output size and chunk size must be positive").
+			WithContext("max_size", maxSize).
+			WithContext("chunk_size", chunkSize)
+	}
+
+	size := image.Pt(source.Width, source.Height)
+	if longest := max(source.Width, source.Height); longest > maxSize {
+		size = image.Pt(
+			max(1, int(int64(source.Width)*int64(maxSize)/int64(longest))),
+			max(1, int(int64(source.Height)*int64(maxSize)/int64(longest))))
+	}
+	// Chunk edges in level pixels map to output pixels the same way on every chunk, so
+	// neighbouring chunks meet without gaps
+	toOutputX := func(x int) int { return int(int64(x) * int64(size.X) / int64(source.Width)) }
+	toOutputY := func(y int) int { return int(int64(y) * int64(size.Y) / int64(source.Height)) }
+
+	chunkDir, err := os.MkdirTemp(filepath.Dir(outputFilePath), "openslide-level-")
+	if err != nil {
+		return image.Point{}, errors.WrapStorageError(err, "failed to create chunk directory").
+			WithContext("output_dir", filepath.Dir(outputFilePath))
+	}
+	defer os.RemoveAll(chunkDir)
+
+	// OpenSlide leaves pixels outside the slide transparent, the output gets a white
+	// background like the tiles
+	out := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(out, out.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for y0 := 0; y0 < source.Height; y0 += chunkSize {
+		for x0 := 0; x0 < source.Width; x0 += chunkSize {
+			if err := ctx.Err(); err != nil {
+				return image.Point{}, errors.Wrap(err, errors.ErrorTypeCancellation, "level read canceled")
+			}
+			x1 := min(source.Width, x0+chunkSize)
+			y1 := min(source.Height, y0+chunkSize)
+			dst := image.Rect(toOutputX(x0), toOutputY(y0), toOutputX(x1), toOutputY(y1))
+			if dst.Empty() {
+				continue
+			}
+
+			pngPath := filepath.Join(chunkDir, fmt.Sprintf("%d_%d.png", x0, y0))
+			if _, err := p.ReadRegion(ctx, slidePath,
+				int(float64(x0)*source.Downsample), int(float64(y0)*source.Downsample),
+				level, x1-x0, y1-y0, pngPath, timeoutMinutes); err != nil {
+				return image.Point{}, err
+			}
+			src, err := decodeImageFile(pngPath)
+			os.Remove(pngPath)
+			if err != nil {
+				return image.Point{}, err
+			}
+
+			if dst.Dx() == src.Bounds().Dx() && dst.Dy() == src.Bounds().Dy() {
+				draw.Draw(out, dst, src, src.Bounds().Min, draw.Over)
+			} else {
+				draw.BiLinear.Scale(out, dst, src, src.Bounds(), draw.Over, nil)
+			}
+		}
+	}
+
+	if err := encodeImageFile(outputFilePath, out, 0); err != nil {
+		return image.Point{}, err
+	}
+	return size, nil
+}
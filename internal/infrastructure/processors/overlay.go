@@ -0,0 +1,275 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Defaults applied when an annotation carries no style properties
+const (
+	defaultStrokeColor   = "#00ff00"
+	defaultStrokeWidth   = 2.0
+	defaultStrokeOpacity = 1.0
+	defaultFillOpacity   = 0.25
+)
+
+// OverlayTransform maps level-0 annotation coordinates onto the base image:
+// pixel = (point - offset) * scale
+type OverlayTransform struct {
+	OffsetX float64
+	OffsetY float64
+	Scale   float64
+}
+
+func (t OverlayTransform) apply(p model.Point) (float64, float64) {
+	return (p.X - t.OffsetX) * t.Scale, (p.Y - t.OffsetY) * t.Scale
+}
+
+// OverlayProcessor burns annotation geometries into a raster image in-process
+type OverlayProcessor struct {
+	logger *slog.Logger
+}
+
+func NewOverlayProcessor(logger *slog.Logger) *OverlayProcessor {
+	return &OverlayProcessor{
+		logger: logger,
+	}
+}
+
+// Render draws the shapes on top of the image at basePath and writes the
+// flattened result to outputFilePath (PNG or JPEG, chosen by extension)
+func (p *OverlayProcessor) Render(ctx context.Context, basePath, outputFilePath string, shapes []model.AnnotationShape, transform OverlayTransform) error {
+	if transform.Scale <= 0 {
+		return errors.NewValidationError("overlay scale must be positive").
+			WithContext("scale", transform.Scale)
+	}
+
+	base, err := decodeImageFile(basePath)
+	if err != nil {
+		return err
+	}
+
+	bounds := base.Bounds()
+	canvas := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), base, bounds.Min, draw.Src)
+
+	mask := newCoverageMask(canvas.Bounds().Dx(), canvas.Bounds().Dy())
+	drawn := 0
+
+	for i, shape := range shapes {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		rings := make([][][2]float64, 0, len(shape.Rings))
+		for _, ring := range shape.Rings {
+			points := make([][2]float64, 0, len(ring))
+			for _, point := range ring {
+				x, y := transform.apply(point)
+				points = append(points, [2]float64{x, y})
+			}
+			rings = append(rings, points)
+		}
+
+		style := shape.Style
+		if shape.Closed && style.Fill != "" {
+			fill, err := parseHexColor(style.Fill)
+			if err != nil {
+				return errors.WrapValidationError(err, "invalid annotation fill color").
+					WithContext("shape", i)
+			}
+			opacity := style.FillOpacity
+			if opacity == 0 {
+				opacity = defaultFillOpacity
+			}
+			mask.fillPolygon(rings)
+			mask.blendInto(canvas, fill, opacity)
+		}
+
+		strokeColor := style.Stroke
+		if strokeColor == "" {
+			strokeColor = defaultStrokeColor
+		}
+		stroke, err := parseHexColor(strokeColor)
+		if err != nil {
+			return errors.WrapValidationError(err, "invalid annotation stroke color").
+				WithContext("shape", i)
+		}
+		width := style.StrokeWidth
+		if width == 0 {
+			width = defaultStrokeWidth
+		}
+		opacity := style.StrokeOpacity
+		if opacity == 0 {
+			opacity = defaultStrokeOpacity
+		}
+		for _, ring := range rings {
+			mask.strokePolyline(ring, shape.Closed, width)
+		}
+		mask.blendInto(canvas, stroke, opacity)
+		drawn++
+	}
+
+	if err := encodeImageFile(outputFilePath, canvas, 95); err != nil {
+		return err
+	}
+
+	p.logger.Debug("Rendered annotation overlay",
+		"base_file", basePath,
+		"output_file", outputFilePath,
+		"shapes", drawn)
+
+	return nil
+}
+
+// coverageMask collects the pixels covered by a single fill or stroke so that
+// overlapping segments are blended only once
+type coverageMask struct {
+	width, height int
+	covered       []bool
+	dirty         image.Rectangle
+}
+
+func newCoverageMask(width, height int) *coverageMask {
+	return &coverageMask{
+		width:   width,
+		height:  height,
+		covered: make([]bool, width*height),
+	}
+}
+
+func (m *coverageMask) set(x, y int) {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return
+	}
+	m.covered[y*m.width+x] = true
+	m.dirty = m.dirty.Union(image.Rect(x, y, x+1, y+1))
+}
+
+// fillPolygon marks pixels whose centres lie inside the rings (even-odd rule)
+func (m *coverageMask) fillPolygon(rings [][][2]float64) {
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, ring := range rings {
+		for _, pt := range ring {
+			minY = math.Min(minY, pt[1])
+			maxY = math.Max(maxY, pt[1])
+		}
+	}
+	startY := max(0, int(math.Floor(minY)))
+	endY := min(m.height-1, int(math.Ceil(maxY)))
+
+	var crossings []float64
+	for y := startY; y <= endY; y++ {
+		sy := float64(y) + 0.5
+		crossings = crossings[:0]
+		for _, ring := range rings {
+			n := len(ring)
+			for i := 0; i < n; i++ {
+				a, b := ring[i], ring[(i+1)%n]
+				if (a[1] <= sy) == (b[1] <= sy) {
+					continue
+				}
+				crossings = append(crossings, a[0]+(sy-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+			}
+		}
+		sort.Float64s(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			x0 := max(0, int(math.Ceil(crossings[i]-0.5)))
+			x1 := min(m.width-1, int(math.Floor(crossings[i+1]-0.5)))
+			for x := x0; x <= x1; x++ {
+				m.set(x, y)
+			}
+		}
+	}
+}
+
+// strokePolyline marks pixels within width/2 of any segment of the polyline
+func (m *coverageMask) strokePolyline(points [][2]float64, closed bool, width float64) {
+	half := math.Max(width/2, 0.5)
+	segments := len(points) - 1
+	if closed {
+		segments = len(points)
+	}
+	for i := 0; i < segments; i++ {
+		a, b := points[i], points[(i+1)%len(points)]
+		x0 := max(0, int(math.Floor(math.Min(a[0], b[0])-half)))
+		x1 := min(m.width-1, int(math.Ceil(math.Max(a[0], b[0])+half)))
+		y0 := max(0, int(math.Floor(math.Min(a[1], b[1])-half)))
+		y1 := min(m.height-1, int(math.Ceil(math.Max(a[1], b[1])+half)))
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				if segmentDistance(float64(x)+0.5, float64(y)+0.5, a, b) <= half {
+					m.set(x, y)
+				}
+			}
+		}
+	}
+}
+
+// blendInto composites c over the covered pixels and clears the mask
+func (m *coverageMask) blendInto(canvas *image.NRGBA, c color.NRGBA, opacity float64) {
+	alpha := math.Max(0, math.Min(1, opacity)) * float64(c.A) / 255
+	for y := m.dirty.Min.Y; y < m.dirty.Max.Y; y++ {
+		for x := m.dirty.Min.X; x < m.dirty.Max.X; x++ {
+			idx := y*m.width + x
+			if !m.covered[idx] {
+				continue
+			}
+			m.covered[idx] = false
+			off := canvas.PixOffset(x, y)
+			px := canvas.Pix[off : off+4]
+			px[0] = blendChannel(px[0], c.R, alpha)
+			px[1] = blendChannel(px[1], c.G, alpha)
+			px[2] = blendChannel(px[2], c.B, alpha)
+			px[3] = 255
+		}
+	}
+	m.dirty = image.Rectangle{}
+}
+
+func blendChannel(dst, src uint8, alpha float64) uint8 {
+	return uint8(math.Round(float64(dst)*(1-alpha) + float64(src)*alpha))
+}
+
+func segmentDistance(px, py float64, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	lengthSq := dx*dx + dy*dy
+	t := 0.0
+	if lengthSq > 0 {
+		t = math.Max(0, math.Min(1, ((px-a[0])*dx+(py-a[1])*dy)/lengthSq))
+	}
+	return math.Hypot(px-(a[0]+t*dx), py-(a[1]+t*dy))
+}
+
+// parseHexColor accepts #rgb, #rrggbb and #rrggbbaa
+func parseHexColor(value string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, errors.NewValidationError("color must be #rgb, #rrggbb or #rrggbbaa").
+			WithContext("color", value)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, errors.WrapValidationError(err, "invalid hex color").
+			WithContext("color", value)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
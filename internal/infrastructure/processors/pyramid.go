@@ -0,0 +1,101 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// PyramidOptions controls the tiled pyramid TIFF written by CreateOMETIFF
+type PyramidOptions struct {
+	TileSize    int
+	Compression string // jpeg, lzw, deflate, zstd or none
+	Quality     int    // JPEG quality, only used with jpeg compression
+
+	// Flatten blends an alpha band onto white first: OpenSlide reads slides as RGBA,
+	// and JPEG tiles cannot hold the alpha
+	Flatten bool
+
+	// Metadata written into the OME-XML
+	Name string
+	MPPX float64 // Microns per pixel of the full resolution, 0 when unknown
+	MPPY float64
+}
+
+// PyramidProcessor writes whole-image pyramids other than DZI, with vips
+type PyramidProcessor struct {
+	*VipsProcessor
+}
+
+func NewPyramidProcessor(logger *slog.Logger) *PyramidProcessor {
+	return &PyramidProcessor{
+		VipsProcessor: NewVipsProcessor(logger),
+	}
+}
+
+// CreateOMETIFF writes the input as an OME-TIFF pyramid: a tiled BigTIFF with the
+// full resolution as its first image, the lower levels as its SubIFDs (vips tiffsave
+// --pyramid --subifd), and OME-XML describing the pixels in its ImageDescription
+func (p *PyramidProcessor) CreateOMETIFF(ctx context.Context, inputFilePath, outputFilePath string, opts PyramidOptions, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+	if opts.TileSize <= 0 || opts.TileSize%16 != 0 {
+		return nil, errors.NewValidationError("tile size must be a positive multiple of 16").
+			WithContext("tile_size", opts.TileSize)
+	}
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	saveOptions := []string{
+		"--tile",
+		"--pyramid",
+		"--subifd",
+		"--bigtiff",
+		"--tile-width", strconv.Itoa(opts.TileSize),
+		"--tile-height", strconv.Itoa(opts.TileSize),
+		"--compression", opts.Compression,
+	}
+	if opts.Compression == "jpeg" {
+		saveOptions = append(saveOptions, "--Q", strconv.Itoa(opts.Quality))
+	}
+
+	// The vips command line runs one operation, options of the saver of a flatten go in
+	// the output file name
+	args := append([]string{"tiffsave", inputFilePath, outputFilePath}, saveOptions...)
+	if opts.Flatten {
+		target := fmt.Sprintf("%s[tile,pyramid,subifd,bigtiff,tile-width=%d,tile-height=%d,compression=%s",
+			outputFilePath, opts.TileSize, opts.TileSize, opts.Compression)
+		if opts.Compression == "jpeg" {
+			target += fmt.Sprintf(",Q=%d", opts.Quality)
+		}
+		args = []string{"flatten", inputFilePath, target + "]", "--background", "255"}
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to create OME-TIFF pyramid").
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath).
+			WithContext("tile_size", opts.TileSize).
+			WithContext("compression", opts.Compression)
+	}
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	if err := WriteOMEXML(outputFilePath, OMEMetadata{
+		Name: opts.Name,
+		MPPX: opts.MPPX,
+		MPPY: opts.MPPY,
+	}); err != nil {
+		return result, err
+	}
+	return result, nil
+}
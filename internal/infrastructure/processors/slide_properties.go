@@ -0,0 +1,139 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// SlideLevel is one level of a whole-slide pyramid as reported by OpenSlide
+type SlideLevel struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Downsample float64 `json:"downsample"`
+}
+
+// SlideAssociatedImage is an image stored next to the pyramid, such as the label,
+// macro or scanner thumbnail
+type SlideAssociatedImage struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// SlideProperties are the OpenSlide properties of a whole-slide image
+type SlideProperties struct {
+	Vendor     string                 `json:"vendor,omitempty"`
+	MPPX       float64                `json:"mpp_x,omitempty"`
+	MPPY       float64                `json:"mpp_y,omitempty"`
+	Levels     []SlideLevel           `json:"levels"`
+	Associated []SlideAssociatedImage `json:"associated,omitempty"` // Sorted by name
+	Properties map[string]string      `json:"properties"`
+}
+
+var slideLevelProperty = regexp.MustCompile(`^openslide\.level\[(\d+)\]\.(width|height|downsample)$`)
+
+var slideAssociatedProperty = regexp.MustCompile(`^openslide\.associated\.(.+)\.(width|height)$`)
+
+// GetSlideProperties reads every OpenSlide property of the slide, including the
+// pyramid levels, microns per pixel and vendor-specific keys
+func (p *ImageInfoProcessor) GetSlideProperties(ctx context.Context, inputFilePath string) (*SlideProperties, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "openslide-show-properties", inputFilePath)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.WrapProcessingError(err, "failed to read OpenSlide properties").
+			WithContext("file", inputFilePath).
+			WithContext("stderr", stderr.String())
+	}
+
+	props := &SlideProperties{
+		Properties: make(map[string]string),
+	}
+	levels := make(map[int]*SlideLevel)
+	associated := make(map[string]*SlideAssociatedImage)
+
+	// Lines look like: openslide.level[1].downsample: '4.0001'
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), "'")
+		props.Properties[key] = value
+
+		switch key {
+		case "openslide.vendor":
+			props.Vendor = value
+		case "openslide.mpp-x":
+			props.MPPX, _ = strconv.ParseFloat(value, 64)
+		case "openslide.mpp-y":
+			props.MPPY, _ = strconv.ParseFloat(value, 64)
+		}
+
+		if matches := slideAssociatedProperty.FindStringSubmatch(key); matches != nil {
+			image, ok := associated[matches[1]]
+			if !ok {
+				image = &SlideAssociatedImage{Name: matches[1]}
+				associated[matches[1]] = image
+			}
+			if matches[2] == "width" {
+				image.Width, _ = strconv.Atoi(value)
+			} else {
+				image.Height, _ = strconv.Atoi(value)
+			}
+			continue
+		}
+
+		matches := slideLevelProperty.FindStringSubmatch(key)
+		if matches == nil {
+			continue
+		}
+		index, _ := strconv.Atoi(matches[1])
+		level, ok := levels[index]
+		if !ok {
+			level = &SlideLevel{}
+			levels[index] = level
+		}
+		switch matches[2] {
+		case "width":
+			level.Width, _ = strconv.Atoi(value)
+		case "height":
+			level.Height, _ = strconv.Atoi(value)
+		case "downsample":
+			level.Downsample, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	for i := 0; i < len(levels); i++ {
+		level, ok := levels[i]
+		if !ok {
+			break
+		}
+		props.Levels = append(props.Levels, *level)
+	}
+
+	for _, image := range associated {
+		props.Associated = append(props.Associated, *image)
+	}
+	sort.Slice(props.Associated, func(i, j int) bool {
+		return props.Associated[i].Name < props.Associated[j].Name
+	})
+
+	return props, nil
+}
@@ -0,0 +1,72 @@
+package processors
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlowLogType is the log_type of slow command entries, for log sinks that route them
+// into the dataset timeouts and formats are tuned from
+const SlowLogType = "slow_command"
+
+// SlowLog writes a dedicated entry for every invocation running longer than its
+// threshold, with the arguments, the duration and what the command ran on
+type SlowLog struct {
+	logger    *slog.Logger
+	threshold time.Duration
+	attrs     []any // Added to every entry, e.g. the worker type
+}
+
+// NewSlowLog returns a slow log for invocations longer than threshold, nil when the
+// threshold is not positive
+func NewSlowLog(logger *slog.Logger, threshold time.Duration, attrs ...any) *SlowLog {
+	if threshold <= 0 {
+		return nil
+	}
+	return &SlowLog{
+		logger:    logger,
+		threshold: threshold,
+		attrs:     attrs,
+	}
+}
+
+type commandInputKey struct{}
+
+// commandInput is the job input the commands of a context run on
+type commandInput struct {
+	fileID string
+	format string
+	size   int64
+}
+
+// WithCommandInput annotates ctx with the input its commands run on, reported in the
+// slow log entries of those commands
+func WithCommandInput(ctx context.Context, fileID, format string, size int64) context.Context {
+	return context.WithValue(ctx, commandInputKey{}, commandInput{fileID: fileID, format: format, size: size})
+}
+
+// record writes the entry of an invocation of binary that took duration, if that is
+// over the threshold
+func (l *SlowLog) record(ctx context.Context, binary string, args []string, duration time.Duration, exitCode, timeoutMinutes int) {
+	if l == nil || duration < l.threshold {
+		return
+	}
+
+	attrs := append([]any{
+		"log_type", SlowLogType,
+		"binary", binary,
+		"args", args,
+		"duration_ms", duration.Milliseconds(),
+		"threshold_ms", l.threshold.Milliseconds(),
+		"timeout_minutes", timeoutMinutes,
+		"exit_code", exitCode,
+	}, l.attrs...)
+	if input, ok := ctx.Value(commandInputKey{}).(commandInput); ok {
+		attrs = append(attrs,
+			"fileID", input.fileID,
+			"input_format", input.format,
+			"input_size", input.size)
+	}
+	l.logger.Warn("Slow command", attrs...)
+}
@@ -0,0 +1,204 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Formats reported by SniffFormat, named like the extensions in supported_formats.json
+const (
+	SniffedTIFF = "tiff"
+	SniffedSVS  = "svs"  // Aperio: TIFF whose ImageDescription starts with "Aperio"
+	SniffedNDPI = "ndpi" // Hamamatsu: TIFF with the NDPI format tag (65420)
+	SniffedSCN  = "scn"  // Leica: TIFF whose ImageDescription is Leica SCN XML
+	SniffedBIF  = "bif"  // Ventana: TIFF whose XMP names an iScan scanner
+	SniffedDNG  = "dng"  // TIFF with a DNGVersion tag (50706)
+	SniffedVMS  = "vms"  // Hamamatsu VMS index file
+	SniffedVMU  = "vmu"  // Hamamatsu VMU index file
+	SniffedJPEG = "jpeg"
+	SniffedPNG  = "png"
+	SniffedBMP  = "bmp"
+)
+
+const (
+	tiffTagImageDescription = 270
+	tiffTagXMP              = 700
+	tiffTagDNGVersion       = 50706
+	tiffTagNDPIFormat       = 65420
+
+	// maxSniffedValue bounds the bytes read of a tag value, enough for the leading
+	// part of an ImageDescription or XMP packet
+	maxSniffedValue = 64 << 10
+)
+
+// SniffFormat detects the format of the file at path from its content: TIFF and
+// BigTIFF headers (and the vendor signatures in their first directory), JPEG, PNG and
+// BMP magic bytes, and Hamamatsu VMS/VMU index files. It returns "" for content it
+// does not recognize.
+func SniffFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to open file for format detection").
+			WithContext("file", path)
+	}
+	defer f.Close()
+
+	sniffed, err := SniffFormatAt(f)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to read file header").
+			WithContext("file", path)
+	}
+	return sniffed, nil
+}
+
+// SniffFormatAt is SniffFormat of the content of r, which only needs the header and
+// the first TIFF directory: a range reader of a remote object reads a few blocks
+// rather than the whole file.
+func SniffFormatAt(r io.ReaderAt) (string, error) {
+	head := make([]byte, 64)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return SniffedJPEG, nil
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return SniffedPNG, nil
+	case bytes.HasPrefix(head, []byte("BM")) && len(head) >= 14:
+		return SniffedBMP, nil
+	case bytes.HasPrefix(head, []byte("II")) || bytes.HasPrefix(head, []byte("MM")):
+		return sniffTIFF(r, head), nil
+	}
+
+	text := strings.TrimPrefix(string(head), "\uFEFF")
+	switch {
+	case strings.HasPrefix(text, "[Virtual Microscope Specimen]"):
+		return SniffedVMS, nil
+	case strings.HasPrefix(text, "[Uncompressed Virtual Microscope Specimen]"):
+		return SniffedVMU, nil
+	}
+	return "", nil
+}
+
+// sniffTIFF inspects the first image directory of a TIFF or BigTIFF for vendor
+// signatures. Anything it cannot parse is reported as a plain TIFF, or "" when the
+// header itself is not TIFF.
+func sniffTIFF(r io.ReaderAt, head []byte) string {
+	if len(head) < 8 {
+		return ""
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if head[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	var bigTIFF bool
+	var ifdOffset int64
+	switch order.Uint16(head[2:4]) {
+	case 42:
+		ifdOffset = int64(order.Uint32(head[4:8]))
+	case 43:
+		if len(head) < 16 {
+			return ""
+		}
+		bigTIFF = true
+		ifdOffset = int64(order.Uint64(head[8:16]))
+	default:
+		return ""
+	}
+
+	// Classic TIFF: 2-byte count, 12-byte entries with a 4-byte value field.
+	// BigTIFF: 8-byte count, 20-byte entries with an 8-byte value field.
+	countSize, entrySize, valueSize := int64(2), int64(12), int64(4)
+	if bigTIFF {
+		countSize, entrySize, valueSize = 8, 20, 8
+	}
+
+	countBuf := make([]byte, countSize)
+	if _, err := r.ReadAt(countBuf, ifdOffset); err != nil {
+		return SniffedTIFF
+	}
+	var count int64
+	if bigTIFF {
+		count = int64(order.Uint64(countBuf))
+	} else {
+		count = int64(order.Uint16(countBuf))
+	}
+	if count <= 0 || count > 4096 {
+		return SniffedTIFF
+	}
+
+	entries := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(entries, ifdOffset+countSize); err != nil {
+		return SniffedTIFF
+	}
+
+	var description, xmp string
+	for i := int64(0); i < count; i++ {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		tag := order.Uint16(entry[0:2])
+		switch tag {
+		case tiffTagNDPIFormat:
+			return SniffedNDPI
+		case tiffTagDNGVersion:
+			return SniffedDNG
+		case tiffTagImageDescription, tiffTagXMP:
+			var n int64
+			var valueField []byte
+			if bigTIFF {
+				n = int64(order.Uint64(entry[4:12]))
+				valueField = entry[12:20]
+			} else {
+				n = int64(order.Uint32(entry[4:8]))
+				valueField = entry[8:12]
+			}
+			value := readTagValue(r, order, valueField, n, valueSize, bigTIFF)
+			if tag == tiffTagImageDescription {
+				description = value
+			} else {
+				xmp = value
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(description, "Aperio"):
+		return SniffedSVS
+	case strings.HasPrefix(description, "<?xml") && strings.Contains(description, "leica"):
+		return SniffedSCN
+	case strings.Contains(xmp, "iScan"):
+		return SniffedBIF
+	}
+	return SniffedTIFF
+}
+
+// readTagValue reads the bytes of an ASCII or BYTE tag value, which are stored in the
+// value field itself when they fit and at the offset it holds otherwise
+func readTagValue(r io.ReaderAt, order binary.ByteOrder, valueField []byte, n, valueSize int64, bigTIFF bool) string {
+	if n <= valueSize {
+		return string(bytes.TrimRight(valueField[:n], "\x00"))
+	}
+	var offset int64
+	if bigTIFF {
+		offset = int64(order.Uint64(valueField))
+	} else {
+		offset = int64(order.Uint32(valueField))
+	}
+	buf := make([]byte, min(n, maxSniffedValue))
+	read, _ := r.ReadAt(buf, offset)
+	return string(bytes.TrimRight(buf[:read], "\x00"))
+}
+
+// isSniffed reports whether the content of the file at path is of the given format
+func isSniffed(path, format string) bool {
+	sniffed, err := SniffFormat(path)
+	return err == nil && sniffed == format
+}
@@ -0,0 +1,281 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Pixels brighter than this (on every channel) with low chroma are treated as
+// glass/background when estimating the scanner white balance.
+const backgroundThreshold = 220
+
+type ChannelStats struct {
+	Name      string   `json:"name"`
+	Mean      float64  `json:"mean"`
+	Std       float64  `json:"std"`
+	Min       int      `json:"min"`
+	Max       int      `json:"max"`
+	Histogram []uint64 `json:"histogram"`
+}
+
+type WhiteBalanceStats struct {
+	BackgroundFraction float64   `json:"background_fraction"`
+	BackgroundMean     []float64 `json:"background_mean"`
+	RedGain            float64   `json:"red_gain"`
+	BlueGain           float64   `json:"blue_gain"`
+}
+
+// QualityStats are the slide QC measures of the overview: how much of it is tissue,
+// how sharp and how bright the tissue is
+type QualityStats struct {
+	TissueFraction float64 `json:"tissue_fraction"` // Share of opaque pixels that are not background
+	FocusScore     float64 `json:"focus_score"`     // Variance of the Laplacian of the luminance over tissue
+	Brightness     float64 `json:"brightness"`      // Mean luminance (0-255) of the tissue
+}
+
+type PixelStats struct {
+	OverviewWidth  int                `json:"overview_width"`
+	OverviewHeight int                `json:"overview_height"`
+	PixelCount     int64              `json:"pixel_count"`
+	HistogramBins  int                `json:"histogram_bins"`
+	Channels       []ChannelStats     `json:"channels"`
+	WhiteBalance   *WhiteBalanceStats `json:"white_balance,omitempty"`
+	Quality        *QualityStats      `json:"quality,omitempty"`
+}
+
+// StatsProcessor computes pixel statistics in-process on an already downsampled image
+type StatsProcessor struct {
+	logger *slog.Logger
+}
+
+func NewStatsProcessor(logger *slog.Logger) *StatsProcessor {
+	return &StatsProcessor{
+		logger: logger,
+	}
+}
+
+// ComputeStats decodes the image at imagePath and returns per-channel histograms,
+// mean/std and background white-balance estimates
+func (p *StatsProcessor) ComputeStats(ctx context.Context, imagePath string, bins int) (*PixelStats, error) {
+	if bins <= 0 || bins > 256 {
+		return nil, errors.NewValidationError("histogram bins must be between 1 and 256").
+			WithContext("bins", bins)
+	}
+
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	gray := isGrayImage(img)
+	names := []string{"red", "green", "blue"}
+	if gray {
+		names = []string{"gray"}
+	}
+
+	channels := make([]channelAccumulator, len(names))
+	for i := range channels {
+		channels[i] = newChannelAccumulator(bins)
+	}
+
+	var bgCount int64
+	var bgSum [3]float64
+
+	bounds := img.Bounds()
+	var count int64
+
+	// Luminance of every pixel for the focus score; tissue marks the pixels it is
+	// computed over
+	width := bounds.Dx()
+	luma := make([]uint8, width*bounds.Dy())
+	tissue := make([]bool, len(luma))
+	var tissueCount int64
+	var tissueLuma float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if y%256 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			if c.A == 0 {
+				continue
+			}
+			r, g, b := int(c.R>>8), int(c.G>>8), int(c.B>>8)
+			count++
+
+			i := (y-bounds.Min.Y)*width + (x - bounds.Min.X)
+			luma[i] = uint8((299*r + 587*g + 114*b) / 1000)
+			if gray && r < backgroundThreshold || !gray && !isBackgroundPixel(r, g, b) {
+				tissue[i] = true
+				tissueCount++
+				tissueLuma += float64(luma[i])
+			}
+
+			if gray {
+				channels[0].add(r)
+			} else {
+				channels[0].add(r)
+				channels[1].add(g)
+				channels[2].add(b)
+			}
+
+			if isBackgroundPixel(r, g, b) {
+				bgCount++
+				bgSum[0] += float64(r)
+				bgSum[1] += float64(g)
+				bgSum[2] += float64(b)
+			}
+		}
+	}
+
+	if count == 0 {
+		return nil, errors.NewProcessingError("overview image has no opaque pixels").
+			WithContext("file", imagePath)
+	}
+
+	stats := &PixelStats{
+		OverviewWidth:  bounds.Dx(),
+		OverviewHeight: bounds.Dy(),
+		PixelCount:     count,
+		HistogramBins:  bins,
+	}
+	for i, name := range names {
+		stats.Channels = append(stats.Channels, channels[i].result(name))
+	}
+
+	if !gray {
+		wb := &WhiteBalanceStats{
+			BackgroundFraction: float64(bgCount) / float64(count),
+		}
+		if bgCount > 0 {
+			mean := []float64{
+				bgSum[0] / float64(bgCount),
+				bgSum[1] / float64(bgCount),
+				bgSum[2] / float64(bgCount),
+			}
+			wb.BackgroundMean = mean
+			if mean[0] > 0 {
+				wb.RedGain = mean[1] / mean[0]
+			}
+			if mean[2] > 0 {
+				wb.BlueGain = mean[1] / mean[2]
+			}
+		}
+		stats.WhiteBalance = wb
+	}
+
+	stats.Quality = &QualityStats{
+		TissueFraction: float64(tissueCount) / float64(count),
+		FocusScore:     laplacianVariance(luma, tissue, width, bounds.Dy()),
+	}
+	if tissueCount > 0 {
+		stats.Quality.Brightness = tissueLuma / float64(tissueCount)
+	}
+
+	p.logger.Debug("Computed pixel statistics",
+		"file", imagePath,
+		"pixel_count", count,
+		"channels", len(stats.Channels))
+
+	return stats, nil
+}
+
+type channelAccumulator struct {
+	bins      int
+	histogram []uint64
+	sum       float64
+	sumSq     float64
+	n         int64
+	min       int
+	max       int
+}
+
+func newChannelAccumulator(bins int) channelAccumulator {
+	return channelAccumulator{
+		bins:      bins,
+		histogram: make([]uint64, bins),
+		min:       255,
+		max:       0,
+	}
+}
+
+func (a *channelAccumulator) add(v int) {
+	a.histogram[v*a.bins/256]++
+	a.sum += float64(v)
+	a.sumSq += float64(v) * float64(v)
+	a.n++
+	if v < a.min {
+		a.min = v
+	}
+	if v > a.max {
+		a.max = v
+	}
+}
+
+func (a *channelAccumulator) result(name string) ChannelStats {
+	mean := a.sum / float64(a.n)
+	variance := a.sumSq/float64(a.n) - mean*mean
+	if variance < 0 {
+		variance = 0
+	}
+	return ChannelStats{
+		Name:      name,
+		Mean:      mean,
+		Std:       math.Sqrt(variance),
+		Min:       a.min,
+		Max:       a.max,
+		Histogram: a.histogram,
+	}
+}
+
+func isGrayImage(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBackgroundPixel(r, g, b int) bool {
+	if r < backgroundThreshold || g < backgroundThreshold || b < backgroundThreshold {
+		return false
+	}
+	hi := max(r, g, b)
+	lo := min(r, g, b)
+	return hi-lo <= 20
+}
+
+// laplacianVariance is the variance of the 4-neighbour Laplacian of luma over the
+// interior pixels marked in mask; blurred tissue has little edge energy and scores low
+func laplacianVariance(luma []uint8, mask []bool, width, height int) float64 {
+	var sum, sumSq float64
+	var n int64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := y*width + x
+			if !mask[i] {
+				continue
+			}
+			v := 4*float64(luma[i]) - float64(luma[i-1]) - float64(luma[i+1]) -
+				float64(luma[i-width]) - float64(luma[i+width])
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return max(0, sumSq/float64(n)-mean*mean)
+}
@@ -1,12 +1,17 @@
 package processors
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/errors"
@@ -29,6 +34,23 @@ func NewVipsProcessor(logger *slog.Logger) *VipsProcessor {
 	return processor
 }
 
+// SetResourceLimits bounds the threads, operation cache and in-memory decode size
+// of every vips invocation. Zero values keep the libvips defaults.
+func (p *VipsProcessor) SetResourceLimits(concurrency, cacheMB, discThresholdMB int) {
+	var args, env []string
+	if concurrency > 0 {
+		env = append(env, fmt.Sprintf("VIPS_CONCURRENCY=%d", concurrency))
+	}
+	if discThresholdMB > 0 {
+		env = append(env, fmt.Sprintf("VIPS_DISC_THRESHOLD=%dm", discThresholdMB))
+	}
+	if cacheMB > 0 {
+		args = append(args, fmt.Sprintf("--vips-cache-max-memory=%d", int64(cacheMB)<<20))
+	}
+	p.SetGlobalArgs(args...)
+	p.SetEnv(env...)
+}
+
 // CreateThumbnail generates a thumbnail image with specified dimensions and quality
 func (p *VipsProcessor) CreateThumbnail(ctx context.Context, inputFilePath, outputFilePath string, width, height, quality int) (*CommandResult, error) {
 	// Validate inputs
@@ -72,7 +94,88 @@ func (p *VipsProcessor) CreateThumbnail(ctx context.Context, inputFilePath, outp
 	return result, nil
 }
 
-func (p *VipsProcessor) CreateDZI(ctx context.Context, inputFilePath, outputBase string, timeoutMinutes int, cfg config.DZIConfig, container string) (*CommandResult, error) {
+// CreateFramedThumbnail generates a thumbnail of exactly width x height for the crop,
+// attention and pad modes; fit keeps the aspect ratio within the box like
+// CreateThumbnail. Pad letterboxes the fitted image onto background, a vips colour
+// such as "255 255 255".
+func (p *VipsProcessor) CreateFramedThumbnail(ctx context.Context, inputFilePath, outputFilePath string, width, height, quality int, mode, background string) (*CommandResult, error) {
+	switch mode {
+	case "", config.ThumbnailModeFit:
+		return p.CreateThumbnail(ctx, inputFilePath, outputFilePath, width, height, quality)
+	case config.ThumbnailModeCrop, config.ThumbnailModeAttention, config.ThumbnailModePad:
+	default:
+		return nil, errors.NewValidationError("unknown thumbnail mode").
+			WithContext("mode", mode)
+	}
+
+	if err := p.validateThumbnailInputs(inputFilePath, outputFilePath, width, height, quality); err != nil {
+		return nil, err
+	}
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	outputWithQuality := fmt.Sprintf("%s[Q=%d]", outputFilePath, quality)
+	thumbnailOutput := outputWithQuality
+	var fittedPath string
+	if mode == config.ThumbnailModePad {
+		// The fitted image goes through a vips native file so it is only encoded once
+		fittedPath = strings.TrimSuffix(outputFilePath, filepath.Ext(outputFilePath)) + ".fitted.v"
+		thumbnailOutput = fittedPath
+		defer os.Remove(fittedPath)
+	}
+
+	args := []string{
+		"thumbnail",
+		inputFilePath,
+		thumbnailOutput,
+		fmt.Sprintf("%d", width),
+		"--height", fmt.Sprintf("%d", height),
+		"--auto-rotate",
+	}
+	switch mode {
+	case config.ThumbnailModeCrop:
+		args = append(args, "--crop", "centre")
+	case config.ThumbnailModeAttention:
+		args = append(args, "--crop", "attention")
+	case config.ThumbnailModePad:
+		args = append(args, "--size", "down")
+	}
+
+	result, err := p.Execute(ctx, args, 10)
+	if err == nil && mode == config.ThumbnailModePad {
+		result, err = p.Execute(ctx, []string{
+			"gravity",
+			fittedPath,
+			outputWithQuality,
+			"centre",
+			fmt.Sprintf("%d", width),
+			fmt.Sprintf("%d", height),
+			"--extend", "background",
+			"--background", background,
+		}, 10)
+	}
+
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to create thumbnail").
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath).
+			WithContext("width", width).
+			WithContext("height", height).
+			WithContext("quality", quality).
+			WithContext("mode", mode)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// CreateDZI tiles the input with dzsave. A non-nil onProgress is called with the
+// percentage reported by --vips-progress whenever it changes.
+func (p *VipsProcessor) CreateDZI(ctx context.Context, inputFilePath, outputBase string, timeoutMinutes int, cfg config.DZIConfig, container string, onProgress func(percent int)) (*CommandResult, error) {
 	// Validate inputs
 	if err := p.validateDZIInputs(inputFilePath, outputBase, timeoutMinutes, cfg); err != nil {
 		return nil, err
@@ -100,7 +203,14 @@ func (p *VipsProcessor) CreateDZI(ctx context.Context, inputFilePath, outputBase
 		"--container", container,
 	}
 
-	result, err := p.Execute(ctx, args, timeoutMinutes)
+	var result *CommandResult
+	var err error
+	if onProgress != nil {
+		args = append(args, "--vips-progress")
+		result, err = p.ExecuteWithOutput(ctx, args, &percentWriter{onProgress: onProgress, last: -1}, timeoutMinutes)
+	} else {
+		result, err = p.Execute(ctx, args, timeoutMinutes)
+	}
 
 	if err != nil {
 		return result, errors.WrapProcessingError(err, "failed to create DZI tiles").
@@ -156,6 +266,201 @@ func (p *VipsProcessor) CreateDZI(ctx context.Context, inputFilePath, outputBase
 	return result, nil
 }
 
+// ExtractArea crops a region out of the input image and writes it to outputFilePath
+func (p *VipsProcessor) ExtractArea(ctx context.Context, inputFilePath, outputFilePath string, x, y, width, height, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.NewValidationError("region width and height must be positive").
+			WithContext("width", width).
+			WithContext("height", height)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"crop",
+		inputFilePath,
+		outputFilePath,
+		fmt.Sprintf("%d", x),
+		fmt.Sprintf("%d", y),
+		fmt.Sprintf("%d", width),
+		fmt.Sprintf("%d", height),
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to extract image area").
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath).
+			WithContext("x", x).
+			WithContext("y", y).
+			WithContext("width", width).
+			WithContext("height", height)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ExtractAssociated writes the associated image name (label, macro, thumbnail) of a
+// whole-slide image, the output format is picked from the output extension
+func (p *VipsProcessor) ExtractAssociated(ctx context.Context, slidePath, name, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(slidePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", slidePath)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"openslideload",
+		slidePath,
+		outputFilePath,
+		"--associated", name,
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to extract associated image").
+			WithContext("input_file", slidePath).
+			WithContext("associated", name)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// JoinTiles lays tiles out in a grid across columns wide, row by row, and writes the
+// joined image to outputFilePath. Cells are the size of the first tile, so a
+// partial last row or column leaves background the caller crops off.
+func (p *VipsProcessor) JoinTiles(ctx context.Context, tiles []string, across int, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	if len(tiles) == 0 || across <= 0 {
+		return nil, errors.NewValidationError("no tiles to join").
+			WithContext("tiles", len(tiles)).
+			WithContext("across", across)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"arrayjoin",
+		strings.Join(tiles, " "),
+		outputFilePath,
+		"--across", fmt.Sprintf("%d", across),
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to join tiles").
+			WithContext("tiles", len(tiles)).
+			WithContext("across", across)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ConvertImage re-encodes an image, the output format is picked from the output extension
+func (p *VipsProcessor) ConvertImage(ctx context.Context, inputFilePath, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	result, err := p.Execute(ctx, []string{"copy", inputFilePath, outputFilePath}, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to convert image").
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// EncodeImage re-encodes an image like ConvertImage, with quality (1-100) for the
+// lossy savers; 0 keeps the saver default
+func (p *VipsProcessor) EncodeImage(ctx context.Context, inputFilePath, outputFilePath string, quality, timeoutMinutes int) (*CommandResult, error) {
+	target := outputFilePath
+	if quality > 0 {
+		target = fmt.Sprintf("%s[Q=%d]", outputFilePath, quality)
+	}
+	return p.runImageOp(ctx, "failed to encode image", inputFilePath, outputFilePath, timeoutMinutes,
+		"copy", inputFilePath, target)
+}
+
+// SaveTIFF re-encodes an image as a tiled BigTIFF with compression (none, lzw,
+// deflate or zstd)
+func (p *VipsProcessor) SaveTIFF(ctx context.Context, inputFilePath, outputFilePath, compression string, timeoutMinutes int) (*CommandResult, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	options := "tile,bigtiff,compression=" + compression
+	if compression == "lzw" || compression == "deflate" {
+		options += ",predictor=horizontal"
+	}
+	result, err := p.Execute(ctx, []string{"copy", inputFilePath, outputFilePath + "[" + options + "]"}, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, "failed to save TIFF").
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath).
+			WithContext("compression", compression)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// CanOpen checks that vips has a loader for the input by reading its header
+func (p *VipsProcessor) CanOpen(ctx context.Context, inputFilePath string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "vipsheader", inputFilePath)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.WrapProcessingError(err, "vips cannot open input").
+			WithContext("input_file", inputFilePath).
+			WithContext("stderr", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
 func (p *VipsProcessor) verifyDZIOutput(dziFilesDir string) error {
 	// Check if _files directory exists
 	info, err := os.Stat(dziFilesDir)
@@ -272,28 +577,35 @@ func (p *VipsProcessor) validateThumbnailInputs(inputFilePath, outputFilePath st
 	return nil
 }
 
-func (p *VipsProcessor) ensureOutputDirectory(outputFilePath string) error {
-	outputDir := filepath.Dir(outputFilePath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return errors.WrapStorageError(err, "failed to create output directory").
-			WithContext("output_dir", outputDir)
-	}
-	return nil
+var percentPattern = regexp.MustCompile(`(\d+)% complete`)
+
+// percentWriter parses the "NN% complete" lines vips --vips-progress writes to stdout
+type percentWriter struct {
+	onProgress func(percent int)
+	last       int
+	pending    []byte
 }
 
-func (p *VipsProcessor) verifyOutputFile(outputFilePath string) error {
-	info, err := os.Stat(outputFilePath)
-	if os.IsNotExist(err) {
-		return errors.NewProcessingError("output file was not created").
-			WithContext("output_file", outputFilePath)
-	}
-	if err != nil {
-		return errors.WrapStorageError(err, "failed to verify output file").
-			WithContext("output_file", outputFilePath)
+func (w *percentWriter) Write(b []byte) (int, error) {
+	w.pending = append(w.pending, b...)
+	for {
+		// Progress lines are redrawn with \r, finished ones end with \n
+		i := bytes.IndexAny(w.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := w.pending[:i]
+		w.pending = w.pending[i+1:]
+		if m := percentPattern.FindSubmatch(line); m != nil {
+			percent, _ := strconv.Atoi(string(m[1]))
+			if percent != w.last {
+				w.last = percent
+				w.onProgress(percent)
+			}
+		}
 	}
-	if info.Size() == 0 {
-		return errors.NewProcessingError("output file is empty").
-			WithContext("output_file", outputFilePath)
+	if len(w.pending) > 4096 {
+		w.pending = w.pending[:0]
 	}
-	return nil
+	return len(b), nil
 }
@@ -0,0 +1,131 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// BandInfo describes the pixel layout of an image as reported by vipsheader
+type BandInfo struct {
+	Bands          int
+	Format         string // uchar, ushort, float, ...
+	Interpretation string // srgb, b-w, grey16, multiband, ...
+}
+
+// GetBandInfo reads the band count, sample format and interpretation of an image
+func (p *VipsProcessor) GetBandInfo(ctx context.Context, inputFilePath string) (*BandInfo, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	fields := make(map[string]string, 3)
+	for _, field := range []string{"bands", "format", "interpretation"} {
+		cmd := exec.CommandContext(ctx, "vipsheader", "-f", field, inputFilePath)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			return nil, errors.WrapProcessingError(err, "failed to read image header").
+				WithContext("file", inputFilePath).
+				WithContext("field", field).
+				WithContext("stderr", stderr.String())
+		}
+		fields[field] = strings.TrimSpace(stdout.String())
+	}
+
+	bands, err := strconv.Atoi(fields["bands"])
+	if err != nil || bands <= 0 {
+		return nil, errors.NewProcessingError("invalid band count detected from vipsheader").
+			WithContext("file", inputFilePath).
+			WithContext("bands", fields["bands"])
+	}
+
+	return &BandInfo{
+		Bands:          bands,
+		Format:         strings.ToLower(fields["format"]),
+		Interpretation: strings.ToLower(fields["interpretation"]),
+	}, nil
+}
+
+// ScaleToUchar linearly stretches the image range to 0-255 uchar
+func (p *VipsProcessor) ScaleToUchar(ctx context.Context, inputFilePath, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	return p.runImageOp(ctx, "failed to scale image", inputFilePath, outputFilePath, timeoutMinutes,
+		"scale", inputFilePath, outputFilePath)
+}
+
+// ExtractBand writes a single band of the input image
+func (p *VipsProcessor) ExtractBand(ctx context.Context, inputFilePath, outputFilePath string, band, timeoutMinutes int) (*CommandResult, error) {
+	return p.runImageOp(ctx, "failed to extract band", inputFilePath, outputFilePath, timeoutMinutes,
+		"extract_band", inputFilePath, outputFilePath, strconv.Itoa(band))
+}
+
+// Tint maps a single-band image onto an RGB color: out[c] = in * rgb[c] / 255.
+// With toUchar the result is clipped to 8 bits, otherwise it stays float for summing.
+func (p *VipsProcessor) Tint(ctx context.Context, inputFilePath, outputFilePath string, rgb [3]uint8, toUchar bool, timeoutMinutes int) (*CommandResult, error) {
+	args := []string{
+		"linear", inputFilePath, outputFilePath,
+		fmt.Sprintf("%g %g %g", float64(rgb[0])/255, float64(rgb[1])/255, float64(rgb[2])/255),
+		"0 0 0",
+	}
+	if toUchar {
+		args = append(args, "--uchar")
+	}
+	return p.runImageOp(ctx, "failed to tint image", inputFilePath, outputFilePath, timeoutMinutes, args...)
+}
+
+// Composite sums the inputs band-wise and clips the result to uchar
+func (p *VipsProcessor) Composite(ctx context.Context, inputFilePaths []string, outputFilePath string, timeoutMinutes int) (*CommandResult, error) {
+	if len(inputFilePaths) == 0 {
+		return nil, errors.NewValidationError("composite needs at least one input")
+	}
+
+	sumPath := outputFilePath + ".sum.v"
+	defer os.Remove(sumPath)
+
+	if _, err := p.runImageOp(ctx, "failed to sum images", inputFilePaths[0], sumPath, timeoutMinutes,
+		"sum", strings.Join(inputFilePaths, " "), sumPath); err != nil {
+		return nil, err
+	}
+
+	return p.runImageOp(ctx, "failed to cast image", sumPath, outputFilePath, timeoutMinutes,
+		"cast", sumPath, outputFilePath, "uchar")
+}
+
+// runImageOp runs a single file-to-file vips operation with the usual input/output checks
+func (p *VipsProcessor) runImageOp(ctx context.Context, message, inputFilePath, outputFilePath string, timeoutMinutes int, args ...string) (*CommandResult, error) {
+	if _, err := os.Stat(inputFilePath); os.IsNotExist(err) {
+		return nil, errors.NewValidationError("input file does not exist").
+			WithContext("input_file", inputFilePath)
+	}
+
+	if err := p.ensureOutputDirectory(outputFilePath); err != nil {
+		return nil, err
+	}
+
+	result, err := p.Execute(ctx, args, timeoutMinutes)
+	if err != nil {
+		return result, errors.WrapProcessingError(err, message).
+			WithContext("operation", args[0]).
+			WithContext("input_file", inputFilePath).
+			WithContext("output_file", outputFilePath)
+	}
+
+	if err := p.verifyOutputFile(outputFilePath); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
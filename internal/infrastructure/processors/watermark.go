@@ -0,0 +1,201 @@
+package processors
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"log/slog"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// WatermarkOptions describes the attribution stamp. Text and logo may be combined;
+// the logo is placed to the left of the text.
+type WatermarkOptions struct {
+	Text      string
+	LogoPath  string
+	Position  string
+	Opacity   float64
+	Color     string
+	TextScale int
+	Margin    int
+}
+
+// WatermarkProcessor stamps text and/or a logo onto PNG and JPEG images in place
+type WatermarkProcessor struct {
+	logger *slog.Logger
+}
+
+func NewWatermarkProcessor(logger *slog.Logger) *WatermarkProcessor {
+	return &WatermarkProcessor{
+		logger: logger,
+	}
+}
+
+// Stamp draws the watermark onto the image at imagePath and rewrites it.
+// quality is used when the image is re-encoded as JPEG.
+func (p *WatermarkProcessor) Stamp(ctx context.Context, imagePath string, opts WatermarkOptions, quality int) error {
+	if opts.Text == "" && opts.LogoPath == "" {
+		return errors.NewValidationError("watermark needs text or a logo")
+	}
+
+	base, err := decodeImageFile(imagePath)
+	if err != nil {
+		return err
+	}
+
+	stamp, err := p.buildStamp(opts)
+	if err != nil {
+		return err
+	}
+
+	bounds := base.Bounds()
+	canvas := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), base, bounds.Min, draw.Src)
+
+	// Shrink the stamp if it does not fit inside the margins
+	available := image.Pt(canvas.Bounds().Dx()-2*opts.Margin, canvas.Bounds().Dy()-2*opts.Margin)
+	if available.X <= 0 || available.Y <= 0 {
+		p.logger.Warn("Image too small for watermark, skipping",
+			"file", imagePath,
+			"width", canvas.Bounds().Dx(),
+			"height", canvas.Bounds().Dy())
+		return nil
+	}
+	size := stamp.Bounds().Size()
+	if size.X > available.X || size.Y > available.Y {
+		ratio := math.Min(float64(available.X)/float64(size.X), float64(available.Y)/float64(size.Y))
+		scaled := image.NewNRGBA(image.Rect(0, 0,
+			max(1, int(float64(size.X)*ratio)),
+			max(1, int(float64(size.Y)*ratio))))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), stamp, stamp.Bounds(), draw.Src, nil)
+		stamp = scaled
+		size = stamp.Bounds().Size()
+	}
+
+	origin := watermarkOrigin(canvas.Bounds().Size(), size, opts.Position, opts.Margin)
+	opacity := uint8(math.Round(math.Max(0, math.Min(1, opts.Opacity)) * 255))
+	draw.DrawMask(canvas, image.Rectangle{Min: origin, Max: origin.Add(size)},
+		stamp, image.Point{},
+		image.NewUniform(color.Alpha{A: opacity}), image.Point{},
+		draw.Over)
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if err := encodeImageFile(imagePath, canvas, quality); err != nil {
+		return err
+	}
+
+	p.logger.Debug("Applied watermark",
+		"file", imagePath,
+		"position", opts.Position,
+		"stamp_width", size.X,
+		"stamp_height", size.Y)
+
+	return nil
+}
+
+func (p *WatermarkProcessor) buildStamp(opts WatermarkOptions) (*image.NRGBA, error) {
+	var logo image.Image
+	if opts.LogoPath != "" {
+		img, err := decodeImageFile(opts.LogoPath)
+		if err != nil {
+			return nil, errors.WrapConfigurationError(err, "failed to load watermark logo").
+				WithContext("logo_path", opts.LogoPath)
+		}
+		logo = img
+	}
+
+	var text *image.NRGBA
+	if opts.Text != "" {
+		textColor, err := parseHexColor(opts.Color)
+		if err != nil {
+			return nil, errors.WrapConfigurationError(err, "invalid watermark color")
+		}
+		text = renderText(opts.Text, textColor, max(1, opts.TextScale))
+	}
+
+	gap := 0
+	width, height := 0, 0
+	if logo != nil {
+		width += logo.Bounds().Dx()
+		height = max(height, logo.Bounds().Dy())
+	}
+	if text != nil {
+		if logo != nil {
+			gap = text.Bounds().Dy() / 2
+		}
+		width += gap + text.Bounds().Dx()
+		height = max(height, text.Bounds().Dy())
+	}
+
+	stamp := image.NewNRGBA(image.Rect(0, 0, width, height))
+	x := 0
+	if logo != nil {
+		lb := logo.Bounds()
+		dst := image.Rect(0, (height-lb.Dy())/2, lb.Dx(), (height-lb.Dy())/2+lb.Dy())
+		draw.Draw(stamp, dst, logo, lb.Min, draw.Src)
+		x = lb.Dx() + gap
+	}
+	if text != nil {
+		tb := text.Bounds()
+		dst := image.Rect(x, (height-tb.Dy())/2, x+tb.Dx(), (height-tb.Dy())/2+tb.Dy())
+		draw.Draw(stamp, dst, text, image.Point{}, draw.Over)
+	}
+
+	return stamp, nil
+}
+
+// renderText draws text with the built-in bitmap face and upscales it by an integer factor
+func renderText(text string, c color.NRGBA, scale int) *image.NRGBA {
+	face := basicfont.Face7x13
+	metrics := face.Metrics()
+	width := font.MeasureString(face, text).Ceil()
+	height := (metrics.Ascent + metrics.Descent).Ceil()
+
+	small := image.NewNRGBA(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.Point26_6{X: 0, Y: metrics.Ascent},
+	}
+	drawer.DrawString(text)
+
+	if scale == 1 {
+		return small
+	}
+	large := image.NewNRGBA(image.Rect(0, 0, width*scale, height*scale))
+	draw.NearestNeighbor.Scale(large, large.Bounds(), small, small.Bounds(), draw.Src, nil)
+	return large
+}
+
+func watermarkOrigin(canvas, stamp image.Point, position string, margin int) image.Point {
+	left := margin
+	right := canvas.X - stamp.X - margin
+	top := margin
+	bottom := canvas.Y - stamp.Y - margin
+
+	switch position {
+	case "top-left":
+		return image.Pt(left, top)
+	case "top-right":
+		return image.Pt(right, top)
+	case "bottom-left":
+		return image.Pt(left, bottom)
+	case "center":
+		return image.Pt((canvas.X-stamp.X)/2, (canvas.Y-stamp.Y)/2)
+	default:
+		return image.Pt(right, bottom)
+	}
+}
@@ -4,12 +4,13 @@ import (
 	"archive/zip"
 	"context"
 	"encoding/json"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
 )
 
 type ZipProcessor struct {
@@ -34,35 +35,45 @@ type ZipIndexMap struct {
 	Version int             `json:"version"`
 	ZipFile string          `json:"zip_file"`
 	Entries []ZipEntryIndex `json:"entries"`
+	// References maps deduplicated tile paths to the canonical tile holding the same bytes
+	References map[string]string `json:"references,omitempty"`
 }
 
+// BuildIndexMap writes IndexMap.json for the zip into destDir. Entries named in
+// extract (exact name or base name) are copied to the mapped destination paths
+// during the same pass over the archive, so the zip is only opened once.
 func (z *ZipProcessor) BuildIndexMap(
 	ctx context.Context,
 	zipPath string,
 	destDir string,
-) error {
+	extract map[string]string,
+) (*ZipIndexMap, error) {
 
 	r, err := zip.OpenReader(zipPath)
 	if err != nil {
-		return errors.WrapStorageError(err, "failed to open zip").
+		return nil, errors.WrapStorageError(err, "failed to open zip").
 			WithContext("zip", zipPath)
 	}
 	defer r.Close()
 
-	index := ZipIndexMap{
+	index := &ZipIndexMap{
 		Version: 1,
 		ZipFile: filepath.Base(zipPath),
+		Entries: make([]ZipEntryIndex, 0, len(r.File)),
+	}
+
+	pending := make(map[string]string, len(extract))
+	for name, dest := range extract {
+		pending[name] = dest
 	}
 
 	for _, f := range r.File {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+		if err := deadline.Err(ctx, "zip indexing"); err != nil {
+			return nil, err
 		}
 		offset, err := f.DataOffset()
 		if err != nil {
-			return errors.WrapProcessingError(err, "failed to get data offset").
+			return nil, errors.WrapProcessingError(err, "failed to get data offset").
 				WithContext("file", f.Name)
 		}
 		index.Entries = append(index.Entries, ZipEntryIndex{
@@ -72,17 +83,37 @@ func (z *ZipProcessor) BuildIndexMap(
 			UncompressedSize: int64(f.UncompressedSize64),
 			Method:           f.Method,
 		})
+
+		// vips dzsave --container zip may nest entries, e.g. "image/image.dzi"
+		target := f.Name
+		dest, ok := pending[target]
+		if !ok {
+			target = filepath.Base(f.Name)
+			dest, ok = pending[target]
+		}
+		if ok {
+			if err := copyZipEntry(ctx, f, dest); err != nil {
+				return nil, err
+			}
+			delete(pending, target)
+		}
+	}
+
+	for name := range pending {
+		return nil, errors.NewNotFoundError("file not found in zip").
+			WithContext("file", name).
+			WithContext("zip", zipPath)
 	}
 
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return errors.WrapStorageError(err, "failed to create dest dir").
+		return nil, errors.WrapStorageError(err, "failed to create dest dir").
 			WithContext("dir", destDir)
 	}
 
 	outPath := filepath.Join(destDir, "IndexMap.json")
 	out, err := os.Create(outPath)
 	if err != nil {
-		return errors.WrapStorageError(err, "failed to create index file").
+		return nil, errors.WrapStorageError(err, "failed to create index file").
 			WithContext("file", outPath)
 	}
 	defer out.Close()
@@ -90,9 +121,65 @@ func (z *ZipProcessor) BuildIndexMap(
 	enc := json.NewEncoder(out)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(index); err != nil {
+		return nil, errors.WrapProcessingError(err, "failed to write index map")
+	}
+
+	return index, nil
+}
+
+// WriteReferenceIndex writes an IndexMap.json that only carries tile references,
+// used by the fs container where tiles are stored as individual objects
+func (z *ZipProcessor) WriteReferenceIndex(destDir string, references map[string]string) error {
+	index := ZipIndexMap{
+		Version:    1,
+		Entries:    []ZipEntryIndex{},
+		References: references,
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
 		return errors.WrapProcessingError(err, "failed to write index map")
 	}
 
+	outPath := filepath.Join(destDir, "IndexMap.json")
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to create index file").
+			WithContext("file", outPath)
+	}
+	return nil
+}
+
+// ReadIndexMap loads an IndexMap.json written by BuildIndexMap
+func (z *ZipProcessor) ReadIndexMap(indexPath string) (*ZipIndexMap, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to read index map").
+			WithContext("file", indexPath)
+	}
+
+	var index ZipIndexMap
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, errors.WrapProcessingError(err, "failed to parse index map").
+			WithContext("file", indexPath)
+	}
+	return &index, nil
+}
+
+func copyZipEntry(ctx context.Context, f *zip.File, destPath string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to open target file in zip").
+			WithContext("file", f.Name)
+	}
+	defer rc.Close()
+
+	if _, err := fsutil.WriteFile(ctx, destPath, rc, 0644, fsutil.Options{Op: "zip extraction"}); err != nil {
+		if ctxErr := deadline.Err(ctx, "zip extraction"); ctxErr != nil {
+			return ctxErr
+		}
+		return errors.WrapProcessingError(err, "failed to copy file content").
+			WithContext("file", destPath)
+	}
 	return nil
 }
 
@@ -141,24 +228,5 @@ func (z *ZipProcessor) ExtractDesiredFile(
 			WithContext("available_files", allNames) // debug için zip'in içini göster
 	}
 
-	rc, err := file.Open()
-	if err != nil {
-		return errors.WrapStorageError(err, "failed to open target file in zip").
-			WithContext("file", file.Name)
-	}
-	defer rc.Close()
-
-	out, err := os.Create(destPath)
-	if err != nil {
-		return errors.WrapStorageError(err, "failed to create dest file").
-			WithContext("file", destPath)
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, rc)
-	if err != nil {
-		return errors.WrapProcessingError(err, "failed to copy file content")
-	}
-
-	return nil
+	return copyZipEntry(ctx, file, destPath)
 }
@@ -0,0 +1,397 @@
+// Package firestore keeps image records in a Firestore collection (ImageRepository) and
+// holds the document model of image records and worker heartbeats: the typed documents
+// written and read with the firestore struct tags, the field paths the repository
+// queries and updates, and the migration of image documents written before the schema
+// was versioned. Writers and queries use the Field constants instead of string
+// literals, so a renamed field cannot leave a query behind.
+package firestore
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// SchemaVersion is the version of ImageDocument, stored in every document. Documents
+// without a version are flat (version 1) and are read through MigrateFlat.
+const SchemaVersion = 2
+
+// Field paths of ImageDocument, for queries, updates and index definitions
+const (
+	FieldSchemaVersion     = "schema_version"
+	FieldImageID           = "image_id"
+	FieldTenant            = "tenant"
+	FieldOriginPath        = "origin_path"
+	FieldBucketName        = "bucket_name"
+	FieldProcessingVersion = "processing_version"
+	FieldPipelineVersion   = "pipeline_version"
+	FieldChecksum          = "checksum"
+	FieldMetadata          = "metadata"
+	FieldDataset           = FieldMetadata + ".dataset" // Grouping key of port.ImageDashboard.FailuresByDataset
+	FieldRequestEventID    = "request_event_id"
+	FieldCorrelationID     = "correlation_id"
+	FieldStatus            = "status"
+	FieldFailureReason     = "failure_reason"
+	FieldResult            = "result"
+	FieldResultOutputPath  = FieldResult + ".output_path" // Queried by port.ImageRepository.FindByOutputPath
+	FieldCreatedAt         = "created_at"
+	FieldUpdatedAt         = "updated_at"
+)
+
+// ImageDocument is the Firestore document of an image record, keyed by image ID
+type ImageDocument struct {
+	SchemaVersion     int               `firestore:"schema_version"`
+	ImageID           string            `firestore:"image_id"`
+	Tenant            string            `firestore:"tenant,omitempty"`
+	OriginPath        string            `firestore:"origin_path"`
+	BucketName        string            `firestore:"bucket_name,omitempty"`
+	ProcessingVersion string            `firestore:"processing_version"`
+	PipelineVersion   string            `firestore:"pipeline_version"` // Not omitted, so Outdated can query records without one
+	Checksum          string            `firestore:"checksum,omitempty"`
+	Metadata          map[string]string `firestore:"metadata,omitempty"`
+	RequestEventID    string            `firestore:"request_event_id,omitempty"`
+	CorrelationID     string            `firestore:"correlation_id,omitempty"`
+	Status            string            `firestore:"status"`
+	FailureReason     string            `firestore:"failure_reason,omitempty"`
+	Result            *ResultDocument   `firestore:"result,omitempty"`
+	CreatedAt         time.Time         `firestore:"created_at"`
+	UpdatedAt         time.Time         `firestore:"updated_at"`
+}
+
+// ResultDocument is the result of a processed image, nested in its ImageDocument
+type ResultDocument struct {
+	Width      int64    `firestore:"width"`
+	Height     int64    `firestore:"height"`
+	Size       int64    `firestore:"size"`
+	OutputPath string   `firestore:"output_path"`
+	Contents   []string `firestore:"contents,omitempty"`
+
+	Levels []LevelDocument `firestore:"levels,omitempty"`
+}
+
+// LevelDocument is a pyramid level of a whole-slide input, in the result of its image
+type LevelDocument struct {
+	Width      int64   `firestore:"width"`
+	Height     int64   `firestore:"height"`
+	Downsample float64 `firestore:"downsample"`
+}
+
+// FromRecord converts record into its document
+func FromRecord(record *model.ImageRecord) *ImageDocument {
+	return &ImageDocument{
+		SchemaVersion:     SchemaVersion,
+		ImageID:           record.ImageID,
+		Tenant:            record.Tenant,
+		OriginPath:        record.OriginPath,
+		BucketName:        record.BucketName,
+		ProcessingVersion: record.ProcessingVersion,
+		PipelineVersion:   record.PipelineVersion,
+		Checksum:          record.Checksum,
+		Metadata:          maps.Clone(record.Metadata),
+		RequestEventID:    record.RequestEventID,
+		CorrelationID:     record.CorrelationID,
+		Status:            string(record.Status),
+		FailureReason:     record.FailureReason,
+		Result:            fromResult(record.Result),
+		CreatedAt:         record.CreatedAt.UTC(),
+		UpdatedAt:         record.UpdatedAt.UTC(),
+	}
+}
+
+func fromResult(result *model.ImageResult) *ResultDocument {
+	if result == nil {
+		return nil
+	}
+	doc := &ResultDocument{
+		Width:      int64(result.Width),
+		Height:     int64(result.Height),
+		Size:       result.Size,
+		OutputPath: result.OutputPath,
+		Contents:   append([]string(nil), result.Contents...),
+	}
+	for _, level := range result.Levels {
+		doc.Levels = append(doc.Levels, LevelDocument{
+			Width:      int64(level.Width),
+			Height:     int64(level.Height),
+			Downsample: level.Downsample,
+		})
+	}
+	return doc
+}
+
+// Record converts the document back into an image record. Documents of another schema
+// version or with an unknown status are rejected.
+func (d *ImageDocument) Record() (*model.ImageRecord, error) {
+	if d.SchemaVersion != SchemaVersion {
+		return nil, errors.NewValidationError("unsupported image document schema version").
+			WithContext("image_id", d.ImageID).
+			WithContext("schema_version", d.SchemaVersion)
+	}
+	status := vobj.ImageStatus(d.Status)
+	if !status.IsValid() {
+		return nil, errors.NewValidationError("invalid image status").
+			WithContext("image_id", d.ImageID).
+			WithContext("status", d.Status)
+	}
+
+	record := &model.ImageRecord{
+		ImageID:           d.ImageID,
+		Tenant:            d.Tenant,
+		OriginPath:        d.OriginPath,
+		BucketName:        d.BucketName,
+		ProcessingVersion: d.ProcessingVersion,
+		PipelineVersion:   d.PipelineVersion,
+		Checksum:          d.Checksum,
+		Metadata:          maps.Clone(d.Metadata),
+		RequestEventID:    d.RequestEventID,
+		CorrelationID:     d.CorrelationID,
+		Status:            status,
+		FailureReason:     d.FailureReason,
+		CreatedAt:         d.CreatedAt,
+		UpdatedAt:         d.UpdatedAt,
+	}
+	if d.Result != nil {
+		record.Result = &model.ImageResult{
+			Width:      int(d.Result.Width),
+			Height:     int(d.Result.Height),
+			Size:       d.Result.Size,
+			OutputPath: d.Result.OutputPath,
+			Contents:   append([]string(nil), d.Result.Contents...),
+		}
+		for _, level := range d.Result.Levels {
+			record.Result.Levels = append(record.Result.Levels, model.ImageLevel{
+				Width:      int(level.Width),
+				Height:     int(level.Height),
+				Downsample: level.Downsample,
+			})
+		}
+	}
+	return record, nil
+}
+
+// FieldUpdate sets the field at Path, the shape of a firestore.Update
+type FieldUpdate struct {
+	Path  string
+	Value any
+}
+
+// StatusUpdates are the field updates of update, applied like the inmem repository
+// applies them: the result is kept when nil and the checksum when empty, the failure
+// reason is cleared unless the status is a failure
+func StatusUpdates(update model.ImageStatusUpdate) []FieldUpdate {
+	failureReason := ""
+	if update.Status == vobj.StatusFailed || update.Status == vobj.StatusFailedPermanent {
+		failureReason = update.FailureReason
+	}
+	updates := []FieldUpdate{
+		{Path: FieldStatus, Value: string(update.Status)},
+		{Path: FieldFailureReason, Value: failureReason},
+		{Path: FieldUpdatedAt, Value: update.UpdatedAt.UTC()},
+	}
+	if update.Result != nil {
+		updates = append(updates, FieldUpdate{Path: FieldResult, Value: fromResult(update.Result)})
+	}
+	if update.Checksum != "" {
+		updates = append(updates, FieldUpdate{Path: FieldChecksum, Value: update.Checksum})
+	}
+	return updates
+}
+
+// DocumentSchemaVersion is the schema version of the raw data of a document, 1 for
+// flat documents written before the version was stored
+func DocumentSchemaVersion(data map[string]any) int {
+	version, ok := toInt64(data[FieldSchemaVersion])
+	if !ok || version < 1 {
+		return 1
+	}
+	return int(version)
+}
+
+// NeedsMigration reports whether the raw data of a document predates SchemaVersion
+func NeedsMigration(data map[string]any) bool {
+	return DocumentSchemaVersion(data) < SchemaVersion
+}
+
+// flatResultFields are the top level fields of a flat document that moved into result
+var flatResultFields = []string{"width", "height", "size", "output_path", "contents"}
+
+// MigrateFlat converts the raw data of a flat document into an ImageDocument. Flat
+// documents kept the result fields (width, height, size, output_path, contents) at the
+// top level, the metadata as metadata_<key> fields or a metadata map, and timestamps
+// as Firestore timestamps, RFC 3339 strings or Unix seconds. Fields it does not know
+// are returned so the caller can log them before the document is rewritten.
+func MigrateFlat(data map[string]any) (*ImageDocument, []string, error) {
+	if version := DocumentSchemaVersion(data); version != 1 {
+		return nil, nil, errors.NewValidationError("image document is not flat").
+			WithContext("schema_version", version)
+	}
+
+	known := map[string]bool{FieldSchemaVersion: true}
+	str := func(key string) string {
+		known[key] = true
+		s, _ := data[key].(string)
+		return s
+	}
+
+	doc := &ImageDocument{
+		SchemaVersion:     SchemaVersion,
+		ImageID:           str(FieldImageID),
+		Tenant:            str(FieldTenant),
+		OriginPath:        str(FieldOriginPath),
+		BucketName:        str(FieldBucketName),
+		ProcessingVersion: str(FieldProcessingVersion),
+		PipelineVersion:   str(FieldPipelineVersion),
+		Checksum:          str(FieldChecksum),
+		Status:            str(FieldStatus),
+		FailureReason:     str(FieldFailureReason),
+	}
+	if doc.ImageID == "" {
+		return nil, nil, errors.NewValidationError("flat image document has no image_id")
+	}
+	if !vobj.ImageStatus(doc.Status).IsValid() {
+		return nil, nil, errors.NewValidationError("invalid image status").
+			WithContext("image_id", doc.ImageID).
+			WithContext("status", doc.Status)
+	}
+
+	var err error
+	for _, field := range []struct {
+		key string
+		dst *time.Time
+	}{{FieldCreatedAt, &doc.CreatedAt}, {FieldUpdatedAt, &doc.UpdatedAt}} {
+		known[field.key] = true
+		if *field.dst, err = toTime(data[field.key]); err != nil {
+			return nil, nil, errors.WrapValidationError(err, "invalid timestamp in flat image document").
+				WithContext("image_id", doc.ImageID).
+				WithContext("field", field.key)
+		}
+	}
+
+	doc.Metadata, err = flatMetadata(data, known)
+	if err != nil {
+		return nil, nil, errors.WrapValidationError(err, "invalid metadata in flat image document").
+			WithContext("image_id", doc.ImageID)
+	}
+
+	if doc.Result, err = flatResult(data, known); err != nil {
+		return nil, nil, errors.WrapValidationError(err, "invalid result in flat image document").
+			WithContext("image_id", doc.ImageID)
+	}
+
+	var unknown []string
+	for key := range data {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	return doc, unknown, nil
+}
+
+// flatMetadata collects the metadata map and the metadata_<key> fields of a flat document
+func flatMetadata(data map[string]any, known map[string]bool) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if raw, ok := data[FieldMetadata]; ok {
+		known[FieldMetadata] = true
+		m, ok := raw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("metadata is a %T, not a map", raw)
+		}
+		for key, value := range m {
+			metadata[key] = fmt.Sprint(value)
+		}
+	}
+	for key, value := range data {
+		name, ok := strings.CutPrefix(key, FieldMetadata+"_")
+		if !ok || name == "" {
+			continue
+		}
+		known[key] = true
+		metadata[name] = fmt.Sprint(value)
+	}
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+// flatResult collects the top level result fields of a flat document, nil when it has
+// none (a record that was never processed)
+func flatResult(data map[string]any, known map[string]bool) (*ResultDocument, error) {
+	found := false
+	for _, key := range flatResultFields {
+		if _, ok := data[key]; ok {
+			known[key] = true
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	result := &ResultDocument{}
+	for key, dst := range map[string]*int64{"width": &result.Width, "height": &result.Height, "size": &result.Size} {
+		raw, ok := data[key]
+		if !ok {
+			continue
+		}
+		n, ok := toInt64(raw)
+		if !ok {
+			return nil, fmt.Errorf("%s is a %T, not a number", key, raw)
+		}
+		*dst = n
+	}
+	result.OutputPath, _ = data["output_path"].(string)
+	if raw, ok := data["contents"]; ok {
+		contents, ok := raw.([]any)
+		if !ok {
+			return nil, fmt.Errorf("contents is a %T, not an array", raw)
+		}
+		for _, content := range contents {
+			result.Contents = append(result.Contents, fmt.Sprint(content))
+		}
+	}
+	return result, nil
+}
+
+// toInt64 reads the numbers Firestore decodes into interface values (int64, float64)
+// and the strings some flat documents stored them as
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case string:
+		parsed, err := strconv.ParseInt(n, 10, 64)
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// toTime reads a Firestore timestamp, an RFC 3339 string or Unix seconds; a missing
+// field is the zero time
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return t.UTC(), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, t)
+	default:
+		seconds, ok := toInt64(v)
+		if !ok {
+			return time.Time{}, fmt.Errorf("timestamp is a %T", v)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+}
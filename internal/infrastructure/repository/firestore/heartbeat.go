@@ -0,0 +1,61 @@
+package firestore
+
+import (
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+// Field paths of HeartbeatDocument besides the shared image_id, tenant and updated_at.
+// Stale queries need an index on updated_at.
+const (
+	FieldWorkerID       = "worker_id"
+	FieldPhase          = "phase"
+	FieldPhaseStartedAt = "phase_started_at"
+)
+
+// HeartbeatDocument is the Firestore document of a worker heartbeat, keyed by worker ID
+type HeartbeatDocument struct {
+	WorkerID       string    `firestore:"worker_id"`
+	WorkerType     string    `firestore:"worker_type,omitempty"`
+	Tenant         string    `firestore:"tenant,omitempty"`
+	ImageID        string    `firestore:"image_id"`
+	JobType        string    `firestore:"job_type"`
+	TaskAttempt    int64     `firestore:"task_attempt"`
+	Phase          string    `firestore:"phase"`
+	StartedAt      time.Time `firestore:"started_at"`
+	PhaseStartedAt time.Time `firestore:"phase_started_at"`
+	UpdatedAt      time.Time `firestore:"updated_at"`
+}
+
+// FromHeartbeat converts heartbeat into its document
+func FromHeartbeat(heartbeat *model.Heartbeat) *HeartbeatDocument {
+	return &HeartbeatDocument{
+		WorkerID:       heartbeat.WorkerID,
+		WorkerType:     heartbeat.WorkerType,
+		Tenant:         heartbeat.Tenant,
+		ImageID:        heartbeat.ImageID,
+		JobType:        string(heartbeat.JobType),
+		TaskAttempt:    int64(heartbeat.TaskAttempt),
+		Phase:          heartbeat.Phase,
+		StartedAt:      heartbeat.StartedAt.UTC(),
+		PhaseStartedAt: heartbeat.PhaseStartedAt.UTC(),
+		UpdatedAt:      heartbeat.UpdatedAt.UTC(),
+	}
+}
+
+// Heartbeat converts the document back into a heartbeat
+func (d *HeartbeatDocument) Heartbeat() *model.Heartbeat {
+	return &model.Heartbeat{
+		WorkerID:       d.WorkerID,
+		WorkerType:     d.WorkerType,
+		Tenant:         d.Tenant,
+		ImageID:        d.ImageID,
+		JobType:        model.JobType(d.JobType),
+		TaskAttempt:    int(d.TaskAttempt),
+		Phase:          d.Phase,
+		StartedAt:      d.StartedAt,
+		PhaseStartedAt: d.PhaseStartedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
@@ -0,0 +1,313 @@
+package firestore
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ImageRepository keeps image records as ImageDocuments in a Firestore collection,
+// keyed by image ID. Flat documents written before the schema was versioned are
+// migrated when they are read and rewritten in the current schema.
+type ImageRepository struct {
+	logger *slog.Logger
+	docs   documents
+}
+
+// NewImageRepository keeps the records in collection of client
+func NewImageRepository(logger *slog.Logger, client *firestore.Client, collection string) *ImageRepository {
+	return newImageRepository(logger, clientCollection{ref: client.Collection(collection)})
+}
+
+func newImageRepository(logger *slog.Logger, docs documents) *ImageRepository {
+	return &ImageRepository{logger: logger, docs: docs}
+}
+
+// documents is the part of a Firestore collection the repository uses, so the
+// queries can run against a fake
+type documents interface {
+	get(ctx context.Context, id string) (snapshot, error)
+	set(ctx context.Context, id string, doc any) error
+	update(ctx context.Context, id string, updates []FieldUpdate) error
+	query(ctx context.Context, q query) ([]snapshot, error)
+}
+
+// snapshot is the read side of a *firestore.DocumentSnapshot
+type snapshot interface {
+	Data() map[string]any
+	DataTo(p any) error
+}
+
+// query selects the documents matching all of its filters, ordered by orderBy when set
+type query struct {
+	filters []filter
+	orderBy string
+	desc    bool
+	limit   int // 0 for no limit
+}
+
+// filter is a Firestore field filter: ==, !=, <, >= or in (a []any value)
+type filter struct {
+	path  string
+	op    string
+	value any
+}
+
+// clientCollection runs the operations of documents on a collection of the client
+type clientCollection struct {
+	ref *firestore.CollectionRef
+}
+
+func (c clientCollection) get(ctx context.Context, id string) (snapshot, error) {
+	snap, err := c.ref.Doc(id).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (c clientCollection) set(ctx context.Context, id string, doc any) error {
+	_, err := c.ref.Doc(id).Set(ctx, doc)
+	return err
+}
+
+func (c clientCollection) update(ctx context.Context, id string, updates []FieldUpdate) error {
+	fields := make([]firestore.Update, len(updates))
+	for i, update := range updates {
+		fields[i] = firestore.Update{Path: update.Path, Value: update.Value}
+	}
+	_, err := c.ref.Doc(id).Update(ctx, fields)
+	return err
+}
+
+func (c clientCollection) query(ctx context.Context, q query) ([]snapshot, error) {
+	fq := c.ref.Query
+	for _, f := range q.filters {
+		fq = fq.Where(f.path, f.op, f.value)
+	}
+	if q.orderBy != "" {
+		direction := firestore.Asc
+		if q.desc {
+			direction = firestore.Desc
+		}
+		fq = fq.OrderBy(q.orderBy, direction)
+	}
+	if q.limit > 0 {
+		fq = fq.Limit(q.limit)
+	}
+	snaps, err := fq.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	found := make([]snapshot, len(snaps))
+	for i, snap := range snaps {
+		found[i] = snap
+	}
+	return found, nil
+}
+
+func (r *ImageRepository) Create(ctx context.Context, record *model.ImageRecord) error {
+	if record == nil || record.ImageID == "" {
+		return errors.NewValidationError("image record needs an image ID")
+	}
+	if !record.Status.IsValid() {
+		return errors.NewValidationError("invalid image status").WithContext("status", record.Status)
+	}
+	if err := r.docs.set(ctx, record.ImageID, FromRecord(record)); err != nil {
+		return errors.WrapStorageError(err, "failed to store image record").
+			WithContext("image_id", record.ImageID)
+	}
+	return nil
+}
+
+func (r *ImageRepository) UpdateStatus(ctx context.Context, imageID string, update model.ImageStatusUpdate) error {
+	if !update.Status.IsValid() {
+		return errors.NewValidationError("invalid image status").WithContext("status", update.Status)
+	}
+	// A flat document would get nested fields next to its flat ones
+	if _, err := r.GetByID(ctx, imageID); err != nil {
+		return err
+	}
+	if err := r.docs.update(ctx, imageID, StatusUpdates(update)); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return errors.WrapNotFoundError(err, "image record").WithContext("image_id", imageID)
+		}
+		return errors.WrapStorageError(err, "failed to update image record").
+			WithContext("image_id", imageID)
+	}
+	return nil
+}
+
+func (r *ImageRepository) GetByID(ctx context.Context, imageID string) (*model.ImageRecord, error) {
+	snap, err := r.docs.get(ctx, imageID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, errors.WrapNotFoundError(err, "image record").WithContext("image_id", imageID)
+		}
+		return nil, errors.WrapStorageError(err, "failed to read image record").
+			WithContext("image_id", imageID)
+	}
+	return r.decode(ctx, snap)
+}
+
+func (r *ImageRepository) FindByChecksum(ctx context.Context, checksum string) (*model.ImageRecord, error) {
+	if checksum == "" {
+		return nil, errors.NewNotFoundError("image record").WithContext("checksum", checksum)
+	}
+	records, err := r.find(ctx, query{
+		filters: []filter{
+			{path: FieldChecksum, op: "==", value: checksum},
+			{path: FieldStatus, op: "==", value: string(vobj.StatusProcessed)},
+		},
+		orderBy: FieldUpdatedAt,
+		desc:    true,
+		limit:   1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.NewNotFoundError("image record").WithContext("checksum", checksum)
+	}
+	return records[0], nil
+}
+
+func (r *ImageRepository) FindByOutputPath(ctx context.Context, outputPath string) ([]*model.ImageRecord, error) {
+	if outputPath == "" {
+		return nil, nil
+	}
+	records, err := r.find(ctx, query{
+		filters: []filter{{path: FieldResultOutputPath, op: "==", value: outputPath}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ImageID < records[j].ImageID })
+	return records, nil
+}
+
+func (r *ImageRepository) Stuck(ctx context.Context, status vobj.ImageStatus, olderThan time.Time) ([]*model.ImageRecord, error) {
+	return r.find(ctx, query{
+		filters: []filter{
+			{path: FieldStatus, op: "==", value: string(status)},
+			{path: FieldUpdatedAt, op: "<", value: olderThan.UTC()},
+		},
+		orderBy: FieldUpdatedAt,
+	})
+}
+
+func (r *ImageRepository) FailuresByDataset(ctx context.Context, since time.Time) (map[string]int, error) {
+	records, err := r.find(ctx, query{
+		filters: []filter{
+			{path: FieldStatus, op: "in", value: []any{string(vobj.StatusFailed), string(vobj.StatusFailedPermanent)}},
+			{path: FieldUpdatedAt, op: ">=", value: since.UTC()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	failures := make(map[string]int)
+	for _, record := range records {
+		failures[record.Metadata["dataset"]]++
+	}
+	return failures, nil
+}
+
+func (r *ImageRepository) ThroughputPerDay(ctx context.Context, since time.Time) ([]model.DailyCount, error) {
+	records, err := r.find(ctx, query{
+		filters: []filter{
+			{path: FieldStatus, op: "==", value: string(vobj.StatusProcessed)},
+			{path: FieldUpdatedAt, op: ">=", value: since.UTC()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[time.Time]int)
+	for _, record := range records {
+		counts[record.UpdatedAt.UTC().Truncate(24*time.Hour)]++
+	}
+	days := make([]model.DailyCount, 0, len(counts))
+	for day, count := range counts {
+		days = append(days, model.DailyCount{Day: day, Count: count})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day.Before(days[j].Day) })
+	return days, nil
+}
+
+// Outdated sorts in memory: a != filter would have to be the first order of the query
+func (r *ImageRepository) Outdated(ctx context.Context, pipelineVersion string) ([]*model.ImageRecord, error) {
+	records, err := r.find(ctx, query{
+		filters: []filter{
+			{path: FieldStatus, op: "==", value: string(vobj.StatusProcessed)},
+			{path: FieldPipelineVersion, op: "!=", value: pipelineVersion},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].UpdatedAt.Before(records[j].UpdatedAt) })
+	return records, nil
+}
+
+// find runs q and decodes the documents it returns
+func (r *ImageRepository) find(ctx context.Context, q query) ([]*model.ImageRecord, error) {
+	snaps, err := r.docs.query(ctx, q)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to query image records")
+	}
+	records := make([]*model.ImageRecord, 0, len(snaps))
+	for _, snap := range snaps {
+		record, err := r.decode(ctx, snap)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// decode reads the record of a document, migrating a flat one. The migrated document
+// is written back; a failed rewrite is logged, the record is still returned.
+func (r *ImageRepository) decode(ctx context.Context, snap snapshot) (*model.ImageRecord, error) {
+	data := snap.Data()
+	if !NeedsMigration(data) {
+		var doc ImageDocument
+		if err := snap.DataTo(&doc); err != nil {
+			return nil, errors.WrapValidationError(err, "invalid image document")
+		}
+		return doc.Record()
+	}
+
+	doc, unknown, err := MigrateFlat(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		r.logger.Warn("Dropping unknown fields of flat image document",
+			"imageID", doc.ImageID,
+			"fields", unknown)
+	}
+	if err := r.docs.set(ctx, doc.ImageID, doc); err != nil {
+		r.logger.Warn("Failed to rewrite flat image document",
+			"imageID", doc.ImageID,
+			"error", err)
+	}
+	return doc.Record()
+}
+
+var (
+	_ port.ImageRepository = (*ImageRepository)(nil)
+	_ port.ImageDashboard  = (*ImageRepository)(nil)
+)
@@ -0,0 +1,421 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+func TestImageRepository(t *testing.T) {
+	testImageRepository(t, newImageRepository(discardLogger(), newFakeDocuments()))
+}
+
+// TestImageRepositoryEmulator runs the same checks against the Firestore emulator
+// (gcloud emulators firestore start), including the queries the fake only imitates
+func TestImageRepositoryEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, "test-project")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	collection := fmt.Sprintf("images-%d", time.Now().UnixNano())
+	testImageRepository(t, NewImageRepository(discardLogger(), client, collection))
+}
+
+func TestImageRepositoryMigratesFlatDocuments(t *testing.T) {
+	ctx := context.Background()
+	docs := newFakeDocuments()
+	docs.docs["img-flat"] = map[string]any{
+		FieldImageID:       "img-flat",
+		FieldStatus:        "processed",
+		FieldChecksum:      "abc",
+		FieldUpdatedAt:     "2026-01-02T03:04:05Z",
+		"output_path":      "img-flat",
+		"width":            int64(100),
+		"metadata_dataset": "tcga",
+		"legacy_field":     true,
+	}
+	repo := newImageRepository(discardLogger(), docs)
+
+	record, err := repo.GetByID(ctx, "img-flat")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if record.Result == nil || record.Result.OutputPath != "img-flat" || record.Result.Width != 100 {
+		t.Errorf("result = %+v, want the flat result fields", record.Result)
+	}
+	if record.Metadata["dataset"] != "tcga" {
+		t.Errorf("metadata = %v, want dataset tcga", record.Metadata)
+	}
+
+	rewritten, ok := docs.docs["img-flat"].(*ImageDocument)
+	if !ok {
+		t.Fatalf("document was not rewritten, it is a %T", docs.docs["img-flat"])
+	}
+	if rewritten.SchemaVersion != SchemaVersion {
+		t.Errorf("schema version = %d, want %d", rewritten.SchemaVersion, SchemaVersion)
+	}
+}
+
+func testImageRepository(t *testing.T, repo *ImageRepository) {
+	ctx := context.Background()
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := repo.GetByID(ctx, "missing"); !errors.Is(err, errors.ErrorTypeNotFound) {
+		t.Fatalf("GetByID of a missing record: %v, want not found", err)
+	}
+	err := repo.UpdateStatus(ctx, "missing", model.ImageStatusUpdate{Status: vobj.StatusProcessing, UpdatedAt: day})
+	if !errors.Is(err, errors.ErrorTypeNotFound) {
+		t.Fatalf("UpdateStatus of a missing record: %v, want not found", err)
+	}
+
+	create := func(imageID, dataset, pipelineVersion string, at time.Time) {
+		t.Helper()
+		record := &model.ImageRecord{
+			ImageID:           imageID,
+			OriginPath:        imageID + ".svs",
+			ProcessingVersion: "v1",
+			PipelineVersion:   pipelineVersion,
+			Metadata:          map[string]string{"dataset": dataset},
+			Status:            vobj.StatusPending,
+			CreatedAt:         at,
+			UpdatedAt:         at,
+		}
+		if err := repo.Create(ctx, record); err != nil {
+			t.Fatalf("Create %s: %v", imageID, err)
+		}
+	}
+	update := func(imageID string, update model.ImageStatusUpdate) {
+		t.Helper()
+		if err := repo.UpdateStatus(ctx, imageID, update); err != nil {
+			t.Fatalf("UpdateStatus %s: %v", imageID, err)
+		}
+	}
+
+	create("img-a", "tcga", "p1", day)
+	create("img-b", "tcga", "p2", day)
+	create("img-c", "camelyon", "p2", day)
+	create("img-d", "camelyon", "", day)
+	update("img-a", model.ImageStatusUpdate{
+		Status:    vobj.StatusProcessed,
+		Checksum:  "sum",
+		Result:    &model.ImageResult{Width: 10, Height: 20, OutputPath: "content/sum", Contents: []string{"image.dzi"}},
+		UpdatedAt: day.Add(time.Hour),
+	})
+	update("img-b", model.ImageStatusUpdate{
+		Status:    vobj.StatusProcessed,
+		Checksum:  "sum",
+		Result:    &model.ImageResult{Width: 10, Height: 20, OutputPath: "content/sum"},
+		UpdatedAt: day.Add(24 * time.Hour),
+	})
+	// In flight with the same checksum and updated last, FindByChecksum skips it
+	update("img-c", model.ImageStatusUpdate{Status: vobj.StatusProcessing, Checksum: "sum", UpdatedAt: day.Add(48 * time.Hour)})
+	update("img-d", model.ImageStatusUpdate{Status: vobj.StatusFailed, FailureReason: "corrupt", UpdatedAt: day.Add(2 * time.Hour)})
+
+	record, err := repo.GetByID(ctx, "img-a")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if record.Status != vobj.StatusProcessed || record.Checksum != "sum" || record.Result == nil || record.Result.Height != 20 {
+		t.Errorf("img-a = %+v, want processed with its checksum and result", record)
+	}
+
+	found, err := repo.FindByChecksum(ctx, "sum")
+	if err != nil {
+		t.Fatalf("FindByChecksum: %v", err)
+	}
+	if found.ImageID != "img-b" {
+		t.Errorf("FindByChecksum = %s, want the latest processed record img-b", found.ImageID)
+	}
+	if _, err := repo.FindByChecksum(ctx, "other"); !errors.Is(err, errors.ErrorTypeNotFound) {
+		t.Errorf("FindByChecksum of an unknown checksum: %v, want not found", err)
+	}
+
+	shared, err := repo.FindByOutputPath(ctx, "content/sum")
+	if err != nil {
+		t.Fatalf("FindByOutputPath: %v", err)
+	}
+	if got := imageIDs(shared); !reflect.DeepEqual(got, []string{"img-a", "img-b"}) {
+		t.Errorf("FindByOutputPath = %v, want [img-a img-b]", got)
+	}
+
+	stuck, err := repo.Stuck(ctx, vobj.StatusProcessing, day.Add(72*time.Hour))
+	if err != nil {
+		t.Fatalf("Stuck: %v", err)
+	}
+	if got := imageIDs(stuck); !reflect.DeepEqual(got, []string{"img-c"}) {
+		t.Errorf("Stuck = %v, want [img-c]", got)
+	}
+
+	failures, err := repo.FailuresByDataset(ctx, day)
+	if err != nil {
+		t.Fatalf("FailuresByDataset: %v", err)
+	}
+	if !reflect.DeepEqual(failures, map[string]int{"camelyon": 1}) {
+		t.Errorf("FailuresByDataset = %v, want camelyon: 1", failures)
+	}
+
+	throughput, err := repo.ThroughputPerDay(ctx, day)
+	if err != nil {
+		t.Fatalf("ThroughputPerDay: %v", err)
+	}
+	want := []model.DailyCount{{Day: day.Truncate(24 * time.Hour), Count: 1}, {Day: day.Add(24 * time.Hour).Truncate(24 * time.Hour), Count: 1}}
+	if !reflect.DeepEqual(throughput, want) {
+		t.Errorf("ThroughputPerDay = %v, want %v", throughput, want)
+	}
+
+	outdated, err := repo.Outdated(ctx, "p2")
+	if err != nil {
+		t.Fatalf("Outdated: %v", err)
+	}
+	if got := imageIDs(outdated); !reflect.DeepEqual(got, []string{"img-a"}) {
+		t.Errorf("Outdated = %v, want [img-a]", got)
+	}
+}
+
+func imageIDs(records []*model.ImageRecord) []string {
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, record.ImageID)
+	}
+	return ids
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// fakeDocuments is an in-memory collection. Documents are *ImageDocument values, or
+// the raw map of a flat document seeded by a test; queries see the fields as the
+// client would encode them.
+type fakeDocuments struct {
+	mu   sync.Mutex
+	docs map[string]any
+}
+
+func newFakeDocuments() *fakeDocuments {
+	return &fakeDocuments{docs: make(map[string]any)}
+}
+
+type fakeSnapshot struct {
+	doc any
+}
+
+func (s fakeSnapshot) Data() map[string]any {
+	if data, ok := s.doc.(map[string]any); ok {
+		return data
+	}
+	return encode(reflect.ValueOf(s.doc)).(map[string]any)
+}
+
+func (s fakeSnapshot) DataTo(p any) error {
+	doc, ok := s.doc.(*ImageDocument)
+	if !ok {
+		return fmt.Errorf("fake cannot decode a %T", s.doc)
+	}
+	*p.(*ImageDocument) = *doc
+	return nil
+}
+
+func (f *fakeDocuments) get(ctx context.Context, id string) (snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	doc, ok := f.docs[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "document %s not found", id)
+	}
+	return fakeSnapshot{doc: doc}, nil
+}
+
+func (f *fakeDocuments) set(ctx context.Context, id string, doc any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := *doc.(*ImageDocument)
+	f.docs[id] = &stored
+	return nil
+}
+
+// update sets the top level fields the repository updates, by their firestore tag
+func (f *fakeDocuments) update(ctx context.Context, id string, updates []FieldUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	doc, ok := f.docs[id].(*ImageDocument)
+	if !ok {
+		return status.Errorf(codes.NotFound, "document %s not found", id)
+	}
+	updated := *doc
+	v := reflect.ValueOf(&updated).Elem()
+	for _, update := range updates {
+		field, ok := fieldByTag(v, update.Path)
+		if !ok {
+			return fmt.Errorf("fake cannot update %s", update.Path)
+		}
+		field.Set(reflect.ValueOf(update.Value))
+	}
+	f.docs[id] = &updated
+	return nil
+}
+
+func (f *fakeDocuments) query(ctx context.Context, q query) ([]snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []fakeSnapshot
+	for _, doc := range f.docs {
+		snap := fakeSnapshot{doc: doc}
+		if matches(snap.Data(), q.filters) {
+			found = append(found, snap)
+		}
+	}
+	if q.orderBy != "" {
+		sort.Slice(found, func(i, j int) bool {
+			a, _ := lookup(found[i].Data(), q.orderBy)
+			b, _ := lookup(found[j].Data(), q.orderBy)
+			if q.desc {
+				return compare(b, a) < 0
+			}
+			return compare(a, b) < 0
+		})
+	}
+	if q.limit > 0 && len(found) > q.limit {
+		found = found[:q.limit]
+	}
+	snaps := make([]snapshot, len(found))
+	for i, snap := range found {
+		snaps[i] = snap
+	}
+	return snaps, nil
+}
+
+func matches(data map[string]any, filters []filter) bool {
+	for _, f := range filters {
+		value, ok := lookup(data, f.path)
+		if !ok {
+			return false
+		}
+		switch f.op {
+		case "==":
+			ok = compare(value, f.value) == 0
+		case "!=":
+			ok = compare(value, f.value) != 0
+		case "<":
+			ok = compare(value, f.value) < 0
+		case ">=":
+			ok = compare(value, f.value) >= 0
+		case "in":
+			ok = false
+			for _, candidate := range f.value.([]any) {
+				ok = ok || compare(value, candidate) == 0
+			}
+		default:
+			panic("fake has no operator " + f.op)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup reads a dotted field path
+func lookup(data map[string]any, path string) (any, bool) {
+	var value any = data
+	for _, name := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compare orders strings and timestamps; values of other types only compare equal
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return 1
+}
+
+func fieldByTag(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("firestore"), ",")
+		if tag == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// encode converts a document into the values the client would store: maps keyed by
+// the firestore tags, without zero omitempty fields
+func encode(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return encode(v.Elem())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t
+		}
+		data := make(map[string]any)
+		for i := 0; i < v.NumField(); i++ {
+			name, options, _ := strings.Cut(v.Type().Field(i).Tag.Get("firestore"), ",")
+			if options == "omitempty" && v.Field(i).IsZero() {
+				continue
+			}
+			data[name] = encode(v.Field(i))
+		}
+		return data
+	case reflect.Map:
+		data := make(map[string]any)
+		for _, key := range v.MapKeys() {
+			data[key.String()] = encode(v.MapIndex(key))
+		}
+		return data
+	case reflect.Slice:
+		values := make([]any, v.Len())
+		for i := range values {
+			values[i] = encode(v.Index(i))
+		}
+		return values
+	case reflect.Int, reflect.Int64:
+		return v.Int()
+	default:
+		return v.Interface()
+	}
+}
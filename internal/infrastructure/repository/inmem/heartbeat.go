@@ -0,0 +1,68 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// HeartbeatStore keeps worker heartbeats in memory, keyed by worker ID
+type HeartbeatStore struct {
+	mu         sync.Mutex
+	heartbeats map[string]model.Heartbeat
+}
+
+// NewHeartbeatStore creates an empty store
+func NewHeartbeatStore() *HeartbeatStore {
+	return &HeartbeatStore{heartbeats: make(map[string]model.Heartbeat)}
+}
+
+func (s *HeartbeatStore) Beat(ctx context.Context, heartbeat *model.Heartbeat) error {
+	if heartbeat == nil || heartbeat.WorkerID == "" {
+		return errors.NewValidationError("heartbeat needs a worker ID")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeats[heartbeat.WorkerID] = *heartbeat
+	return nil
+}
+
+func (s *HeartbeatStore) Clear(ctx context.Context, workerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.heartbeats, workerID)
+	return nil
+}
+
+func (s *HeartbeatStore) Stale(ctx context.Context, olderThan time.Time) ([]*model.Heartbeat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stale []*model.Heartbeat
+	for _, heartbeat := range s.heartbeats {
+		if heartbeat.UpdatedAt.Before(olderThan) {
+			heartbeat := heartbeat
+			stale = append(stale, &heartbeat)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].UpdatedAt.Before(stale[j].UpdatedAt) })
+	return stale, nil
+}
+
+// Heartbeats returns copies of all stored heartbeats
+func (s *HeartbeatStore) Heartbeats() []*model.Heartbeat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heartbeats := make([]*model.Heartbeat, 0, len(s.heartbeats))
+	for _, heartbeat := range s.heartbeats {
+		heartbeat := heartbeat
+		heartbeats = append(heartbeats, &heartbeat)
+	}
+	return heartbeats
+}
+
+var _ port.HeartbeatStore = (*HeartbeatStore)(nil)
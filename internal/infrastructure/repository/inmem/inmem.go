@@ -0,0 +1,204 @@
+// Package inmem provides map-backed port.ImageRepository and port.HeartbeatStore
+// implementations for local runs and tests of the job orchestrator
+package inmem
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ImageRepository keeps image records in memory, keyed by image ID
+type ImageRepository struct {
+	mu      sync.Mutex
+	records map[string]*model.ImageRecord
+}
+
+// NewImageRepository creates an empty repository
+func NewImageRepository() *ImageRepository {
+	return &ImageRepository{records: make(map[string]*model.ImageRecord)}
+}
+
+func (r *ImageRepository) Create(ctx context.Context, record *model.ImageRecord) error {
+	if record == nil || record.ImageID == "" {
+		return errors.NewValidationError("image record needs an image ID")
+	}
+	if !record.Status.IsValid() {
+		return errors.NewValidationError("invalid image status").WithContext("status", record.Status)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[record.ImageID] = copyRecord(record)
+	return nil
+}
+
+func (r *ImageRepository) UpdateStatus(ctx context.Context, imageID string, update model.ImageStatusUpdate) error {
+	if !update.Status.IsValid() {
+		return errors.NewValidationError("invalid image status").WithContext("status", update.Status)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[imageID]
+	if !ok {
+		return errors.NewNotFoundError("image record").WithContext("image_id", imageID)
+	}
+	record.Status = update.Status
+	record.FailureReason = ""
+	if update.Status == vobj.StatusFailed || update.Status == vobj.StatusFailedPermanent {
+		record.FailureReason = update.FailureReason
+	}
+	if update.Result != nil {
+		record.Result = copyResult(update.Result)
+	}
+	if update.Checksum != "" {
+		record.Checksum = update.Checksum
+	}
+	record.UpdatedAt = update.UpdatedAt
+	return nil
+}
+
+func (r *ImageRepository) GetByID(ctx context.Context, imageID string) (*model.ImageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	record, ok := r.records[imageID]
+	if !ok {
+		return nil, errors.NewNotFoundError("image record").WithContext("image_id", imageID)
+	}
+	return copyRecord(record), nil
+}
+
+func (r *ImageRepository) FindByChecksum(ctx context.Context, checksum string) (*model.ImageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found *model.ImageRecord
+	for _, record := range r.records {
+		if checksum == "" || record.Checksum != checksum || record.Status != vobj.StatusProcessed {
+			continue
+		}
+		if found == nil || record.UpdatedAt.After(found.UpdatedAt) {
+			found = record
+		}
+	}
+	if found == nil {
+		return nil, errors.NewNotFoundError("image record").WithContext("checksum", checksum)
+	}
+	return copyRecord(found), nil
+}
+
+func (r *ImageRepository) FindByOutputPath(ctx context.Context, outputPath string) ([]*model.ImageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []*model.ImageRecord
+	for _, record := range r.records {
+		if outputPath != "" && record.Result != nil && record.Result.OutputPath == outputPath {
+			found = append(found, copyRecord(record))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ImageID < found[j].ImageID })
+	return found, nil
+}
+
+func (r *ImageRepository) Stuck(ctx context.Context, status vobj.ImageStatus, olderThan time.Time) ([]*model.ImageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stuck []*model.ImageRecord
+	for _, record := range r.records {
+		if record.Status == status && record.UpdatedAt.Before(olderThan) {
+			stuck = append(stuck, copyRecord(record))
+		}
+	}
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].UpdatedAt.Before(stuck[j].UpdatedAt) })
+	return stuck, nil
+}
+
+func (r *ImageRepository) FailuresByDataset(ctx context.Context, since time.Time) (map[string]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failures := make(map[string]int)
+	for _, record := range r.records {
+		if record.Status != vobj.StatusFailed && record.Status != vobj.StatusFailedPermanent {
+			continue
+		}
+		if record.UpdatedAt.Before(since) {
+			continue
+		}
+		failures[record.Metadata["dataset"]]++
+	}
+	return failures, nil
+}
+
+func (r *ImageRepository) ThroughputPerDay(ctx context.Context, since time.Time) ([]model.DailyCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[time.Time]int)
+	for _, record := range r.records {
+		if record.Status != vobj.StatusProcessed || record.UpdatedAt.Before(since) {
+			continue
+		}
+		day := record.UpdatedAt.UTC().Truncate(24 * time.Hour)
+		counts[day]++
+	}
+	days := make([]model.DailyCount, 0, len(counts))
+	for day, count := range counts {
+		days = append(days, model.DailyCount{Day: day, Count: count})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day.Before(days[j].Day) })
+	return days, nil
+}
+
+func (r *ImageRepository) Outdated(ctx context.Context, pipelineVersion string) ([]*model.ImageRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var outdated []*model.ImageRecord
+	for _, record := range r.records {
+		if record.Status == vobj.StatusProcessed && record.PipelineVersion != pipelineVersion {
+			outdated = append(outdated, copyRecord(record))
+		}
+	}
+	sort.Slice(outdated, func(i, j int) bool { return outdated[i].UpdatedAt.Before(outdated[j].UpdatedAt) })
+	return outdated, nil
+}
+
+// Records returns copies of all stored records
+func (r *ImageRepository) Records() []*model.ImageRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := make([]*model.ImageRecord, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, copyRecord(record))
+	}
+	return records
+}
+
+func copyRecord(record *model.ImageRecord) *model.ImageRecord {
+	c := *record
+	c.Result = copyResult(record.Result)
+	if record.Metadata != nil {
+		c.Metadata = make(map[string]string, len(record.Metadata))
+		for key, value := range record.Metadata {
+			c.Metadata[key] = value
+		}
+	}
+	return &c
+}
+
+func copyResult(result *model.ImageResult) *model.ImageResult {
+	if result == nil {
+		return nil
+	}
+	c := *result
+	c.Contents = append([]string(nil), result.Contents...)
+	c.Levels = append([]model.ImageLevel(nil), result.Levels...)
+	return &c
+}
+
+var (
+	_ port.ImageRepository = (*ImageRepository)(nil)
+	_ port.ImageDashboard  = (*ImageRepository)(nil)
+)
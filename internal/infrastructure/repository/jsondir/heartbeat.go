@@ -0,0 +1,103 @@
+// Package jsondir provides a port.HeartbeatStore keeping one JSON file per worker in a
+// directory, e.g. on the output mount, where a supervisor without database access
+// lists them
+package jsondir
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// HeartbeatStore writes the heartbeat of worker <id> to <dir>/<id>.json
+type HeartbeatStore struct {
+	dir string
+}
+
+// NewHeartbeatStore creates the store, and dir if it does not exist
+func NewHeartbeatStore(dir string) (*HeartbeatStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WrapStorageError(err, "failed to create heartbeat directory").
+			WithContext("dir", dir)
+	}
+	return &HeartbeatStore{dir: dir}, nil
+}
+
+// path is the file of a worker; IDs are reduced to one path element
+func (s *HeartbeatStore) path(workerID string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(workerID)
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Beat writes the heartbeat next to its file and renames it over, so readers never
+// see a partial document
+func (s *HeartbeatStore) Beat(ctx context.Context, heartbeat *model.Heartbeat) error {
+	if heartbeat == nil || heartbeat.WorkerID == "" {
+		return errors.NewValidationError("heartbeat needs a worker ID")
+	}
+	data, err := json.MarshalIndent(heartbeat, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode heartbeat")
+	}
+
+	path := s.path(heartbeat.WorkerID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write heartbeat").
+			WithContext("path", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.WrapStorageError(err, "failed to write heartbeat").
+			WithContext("path", path)
+	}
+	return nil
+}
+
+func (s *HeartbeatStore) Clear(ctx context.Context, workerID string) error {
+	if err := os.Remove(s.path(workerID)); err != nil && !os.IsNotExist(err) {
+		return errors.WrapStorageError(err, "failed to remove heartbeat").
+			WithContext("worker_id", workerID)
+	}
+	return nil
+}
+
+// Stale reads every heartbeat of the directory. Files that are not heartbeats, or
+// were removed while listing, are skipped.
+func (s *HeartbeatStore) Stale(ctx context.Context, olderThan time.Time) ([]*model.Heartbeat, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to list heartbeats").
+			WithContext("dir", s.dir)
+	}
+
+	var stale []*model.Heartbeat
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var heartbeat model.Heartbeat
+		if err := json.Unmarshal(data, &heartbeat); err != nil || heartbeat.WorkerID == "" {
+			continue
+		}
+		if heartbeat.UpdatedAt.Before(olderThan) {
+			stale = append(stale, &heartbeat)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].UpdatedAt.Before(stale[j].UpdatedAt) })
+	return stale, nil
+}
+
+var _ port.HeartbeatStore = (*HeartbeatStore)(nil)
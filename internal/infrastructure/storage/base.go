@@ -1,31 +1,52 @@
 package storage
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/ratelimit"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 type BaseStorage struct {
-	logger *slog.Logger
+	logger  *slog.Logger
+	retrier *retry.Retrier
+	pacer   *ratelimit.Pacer
 }
 
 func NewBaseStorage(logger *slog.Logger) *BaseStorage {
 	return &BaseStorage{
-		logger: logger,
+		logger:  logger,
+		retrier: retry.New(logger, retry.DefaultPolicy),
 	}
 }
 
-func (bs *BaseStorage) collectFiles(sourceDir string) ([]port.FileInfo, error) {
+// SetRetrier replaces the default retry policy of object writes
+func (bs *BaseStorage) SetRetrier(retrier *retry.Retrier) {
+	bs.retrier = retrier
+}
+
+// SetPacer paces object writes, nil writes as fast as the parallelism allows
+func (bs *BaseStorage) SetPacer(pacer *ratelimit.Pacer) {
+	bs.pacer = pacer
+}
+
+// collectFiles lists the regular files under sourceDir, stopping once ctx is done
+func (bs *BaseStorage) collectFiles(ctx context.Context, sourceDir string) ([]port.FileInfo, error) {
 	var files []port.FileInfo
 	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := deadline.Err(ctx, "file collection"); err != nil {
+			return err
+		}
 		if !info.Mode().IsRegular() {
 			return nil
 		}
@@ -40,6 +61,9 @@ func (bs *BaseStorage) collectFiles(sourceDir string) ([]port.FileInfo, error) {
 		})
 		return nil
 	})
+	if ctxErr := deadline.Err(ctx, "file collection"); ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil {
 		return nil, errors.WrapStorageError(err, "failed to collect files").
 			WithContext("sourceDir", sourceDir)
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+)
+
+// ChecksumLedger records the SHA-256 of every file a storage copies, computed
+// while the bytes pass through so originals are never read a second time
+type ChecksumLedger struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+func NewChecksumLedger() *ChecksumLedger {
+	return &ChecksumLedger{
+		sums: make(map[string]string),
+	}
+}
+
+func (l *ChecksumLedger) Record(path, sum string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sums[filepath.ToSlash(path)] = sum
+}
+
+// Get returns the checksum recorded for path
+func (l *ChecksumLedger) Get(path string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sum, ok := l.sums[filepath.ToSlash(path)]
+	return sum, ok
+}
+
+// Under returns the checksums recorded below prefix, keyed by path relative to it
+func (l *ChecksumLedger) Under(prefix string) map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prefix = strings.TrimSuffix(filepath.ToSlash(prefix), "/") + "/"
+	sums := make(map[string]string)
+	for path, sum := range l.sums {
+		if rel, ok := strings.CutPrefix(path, prefix); ok {
+			sums[rel] = sum
+		}
+	}
+	return sums
+}
+
+// copyWithChecksum copies src to dst like fsutil.Copy and returns the SHA-256 of the
+// copied bytes
+func copyWithChecksum(ctx context.Context, dst io.Writer, src io.Reader, op string) (int64, string, error) {
+	h := sha256.New()
+	n, err := fsutil.Copy(ctx, dst, io.TeeReader(src, h), fsutil.Options{Op: op})
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -2,15 +2,19 @@ package storage
 
 import (
 	"context"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/api/iterator"
 )
 
 type GCSStorage struct {
@@ -18,6 +22,7 @@ type GCSStorage struct {
 	gcsClient   *storage.Client
 	bucketName  string
 	maxParallel int
+	kmsKeyName  string
 }
 
 func NewGCSStorage(logger *slog.Logger, gcsClient *storage.Client, bucketName string) *GCSStorage {
@@ -29,6 +34,12 @@ func NewGCSStorage(logger *slog.Logger, gcsClient *storage.Client, bucketName st
 	}
 }
 
+// SetKMSKeyName makes uploads encrypted with the Cloud KMS key instead of the bucket
+// default
+func (s *GCSStorage) SetKMSKeyName(name string) {
+	s.kmsKeyName = name
+}
+
 func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath string) error {
 	s.logger.Info("Starting parallel GCS upload",
 		"source", sourceDir,
@@ -36,7 +47,7 @@ func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath st
 		"bucket", s.bucketName,
 		"max_parallel", s.maxParallel)
 
-	files, err := s.collectFiles(sourceDir)
+	files, err := s.collectFiles(ctx, sourceDir)
 	if err != nil {
 		return err
 	}
@@ -50,7 +61,7 @@ func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath st
 		"count", len(files),
 		"source", sourceDir)
 
-	g, ctx := errgroup.WithContext(ctx)
+	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(s.maxParallel)
 
 	var uploaded, failed int64
@@ -58,6 +69,10 @@ func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath st
 
 	for _, fileInfo := range files {
 		fileInfo := fileInfo
+		// Stop queueing uploads once canceled or a sibling failed
+		if gctx.Err() != nil {
+			break
+		}
 
 		g.Go(func() error {
 			sourcePath := fileInfo.SourcePath
@@ -65,7 +80,12 @@ func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath st
 			fullDestKey = filepath.ToSlash(fullDestKey)
 			destKey := fullDestKey
 
-			if err := s.uploadFileToGCS(ctx, sourcePath, destKey); err != nil {
+			err := s.retrier.Do(gctx, "gcs upload", func(ctx context.Context) error {
+				return s.pacer.Do(ctx, func(ctx context.Context) error {
+					return s.uploadFileToGCS(ctx, sourcePath, destKey)
+				})
+			})
+			if err != nil {
 				mu.Lock()
 				failed++
 				mu.Unlock()
@@ -89,8 +109,12 @@ func (s *GCSStorage) UploadDirectory(ctx context.Context, sourceDir, destPath st
 		})
 	}
 
-	// Wait for all uploads to complete
-	if err := g.Wait(); err != nil {
+	// Wait for all uploads to complete; canceled before any upload failed still fails
+	err = g.Wait()
+	if err == nil {
+		err = deadline.Err(ctx, "GCS upload")
+	}
+	if err != nil {
 		return errors.WrapStorageError(err, "failed to upload directory to GCS").
 			WithContext("source", sourceDir).
 			WithContext("uploaded", uploaded).
@@ -120,8 +144,9 @@ func (s *GCSStorage) uploadFileToGCS(ctx context.Context, sourcePath, destKey st
 
 	writer.ChunkSize = 16 * 1024 * 1024 // 16MB chunks
 	writer.ContentType = s.detectContentType(sourcePath)
+	writer.KMSKeyName = s.kmsKeyName
 
-	if _, err := io.Copy(writer, file); err != nil {
+	if _, err := fsutil.Copy(ctx, writer, file, fsutil.Options{Op: "gcs upload"}); err != nil {
 		writer.Close()
 		return errors.WrapStorageError(err, "failed to upload file content").
 			WithContext("source_path", sourcePath).
@@ -136,3 +161,47 @@ func (s *GCSStorage) uploadFileToGCS(ctx context.Context, sourcePath, destKey st
 
 	return nil
 }
+
+// SignedURLs mints V4 signed GET URLs valid for expires. With no names given it signs
+// every object directly under prefix; tiles below it are reached through the index map.
+// Keys of the returned map are object names relative to prefix.
+func (s *GCSStorage) SignedURLs(ctx context.Context, prefix string, names []string, expires time.Duration) (map[string]string, error) {
+	bucket := s.gcsClient.Bucket(s.bucketName)
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	if len(names) == 0 {
+		it := bucket.Objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"})
+		for {
+			attrs, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, errors.WrapStorageError(err, "failed to list objects").
+					WithContext("bucket", s.bucketName).
+					WithContext("prefix", prefix)
+			}
+			// Sub-prefixes (tiles/, overviews/) come back with only Prefix set
+			if attrs.Name == "" {
+				continue
+			}
+			names = append(names, strings.TrimPrefix(attrs.Name, prefix))
+		}
+	}
+
+	urls := make(map[string]string, len(names))
+	for _, name := range names {
+		url, err := bucket.SignedURL(prefix+name, &storage.SignedURLOptions{
+			Scheme:  storage.SigningSchemeV4,
+			Method:  "GET",
+			Expires: time.Now().Add(expires),
+		})
+		if err != nil {
+			return nil, errors.WrapStorageError(err, "failed to sign URL").
+				WithContext("bucket", s.bucketName).
+				WithContext("object", prefix+name)
+		}
+		urls[name] = url
+	}
+	return urls, nil
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+	"google.golang.org/api/iterator"
+)
+
+// rangeBlockSize is the smallest range requested from GCS. Header parsers issue many
+// small reads close to each other, most of them are served from the last block.
+const rangeBlockSize = 256 << 10
+
+// GCSInputStorage reads inputs from a bucket through the GCS API instead of the FUSE
+// mount of the bucket. Paths are object names; absolute paths below mountPath, the
+// mount point of the same bucket, are mapped to the object they stand for.
+type GCSInputStorage struct {
+	logger     *slog.Logger
+	gcsClient  *storage.Client
+	bucketName string
+	mountPath  string
+	checksums  *ChecksumLedger
+}
+
+func NewGCSInputStorage(logger *slog.Logger, gcsClient *storage.Client, bucketName, mountPath string) *GCSInputStorage {
+	// Input paths are made absolute before they get here, and so must the mount be
+	if abs, err := filepath.Abs(mountPath); err == nil {
+		mountPath = abs
+	}
+	return &GCSInputStorage{
+		logger:     logger,
+		gcsClient:  gcsClient,
+		bucketName: bucketName,
+		mountPath:  mountPath,
+	}
+}
+
+// EnableChecksums makes every CopyToLocal record the SHA-256 of the object in a
+// ledger, keyed by the path as passed to CopyToLocal
+func (s *GCSInputStorage) EnableChecksums() {
+	s.checksums = NewChecksumLedger()
+}
+
+// Checksums returns the ledger, nil unless EnableChecksums was called
+func (s *GCSInputStorage) Checksums() *ChecksumLedger {
+	return s.checksums
+}
+
+// object returns the handle of the object p stands for
+func (s *GCSInputStorage) object(p string) (*storage.ObjectHandle, error) {
+	name := filepath.ToSlash(p)
+	if filepath.IsAbs(p) {
+		rel, err := filepath.Rel(s.mountPath, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return nil, errors.NewValidationError("path is outside of the input mount").
+				WithContext("path", p).
+				WithContext("mount_path", s.mountPath)
+		}
+		name = filepath.ToSlash(rel)
+	}
+	name = path.Clean(name)
+	if name == "." || strings.HasPrefix(name, "../") || name == ".." {
+		return nil, errors.NewValidationError("invalid object path").
+			WithContext("path", p)
+	}
+	return s.gcsClient.Bucket(s.bucketName).Object(name), nil
+}
+
+// objectError converts a GCS read error into a not found or storage error
+func (s *GCSInputStorage) objectError(err error, p, message string) error {
+	if stderrors.Is(err, storage.ErrObjectNotExist) {
+		return errors.NewNotFoundError("object").
+			WithContext("bucket", s.bucketName).
+			WithContext("path", p)
+	}
+	return errors.WrapStorageError(err, message).
+		WithContext("bucket", s.bucketName).
+		WithContext("path", p)
+}
+
+// GetReader implements InputStorage.GetReader, streaming the object
+func (s *GCSInputStorage) GetReader(ctx context.Context, p string) (io.ReadCloser, error) {
+	obj, err := s.object(p)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := obj.NewReader(ctx)
+	if err != nil {
+		return nil, s.objectError(err, p, "failed to open object")
+	}
+	return reader, nil
+}
+
+// OpenRange implements RangeInputStorage.OpenRange. Every read that misses the last
+// block is a range request of at least rangeBlockSize bytes.
+func (s *GCSInputStorage) OpenRange(ctx context.Context, p string) (RangeReader, error) {
+	obj, err := s.object(p)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		return nil, s.objectError(err, p, "failed to read object attributes")
+	}
+	// Pin the generation, the reads must not mix two versions of an overwritten object
+	return &gcsRangeReader{
+		ctx:  ctx,
+		obj:  obj.Generation(attrs.Generation),
+		path: p,
+		size: attrs.Size,
+	}, nil
+}
+
+// CopyToLocal implements InputStorage.CopyToLocal
+func (s *GCSInputStorage) CopyToLocal(ctx context.Context, remotePath, localPath string) error {
+	obj, err := s.object(remotePath)
+	if err != nil {
+		return err
+	}
+
+	localDir := filepath.Dir(localPath)
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create local directory").
+			WithContext("dir", localDir)
+	}
+
+	reader, err := obj.NewReader(ctx)
+	if err != nil {
+		return s.objectError(err, remotePath, "failed to open object")
+	}
+	defer reader.Close()
+
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to create destination file").
+			WithContext("local_path", localPath)
+	}
+	defer dst.Close()
+
+	var copied int64
+	if s.checksums == nil {
+		copied, err = fsutil.Copy(ctx, dst, reader, fsutil.Options{Op: "input download"})
+	} else {
+		var sum string
+		copied, sum, err = copyWithChecksum(ctx, dst, reader, "input download")
+		if err == nil {
+			s.checksums.Record(remotePath, sum)
+		}
+	}
+	if err != nil {
+		if ctxErr := deadline.Err(ctx, "input download"); ctxErr != nil {
+			return ctxErr
+		}
+		return errors.WrapStorageError(err, "failed to download object").
+			WithContext("bucket", s.bucketName).
+			WithContext("remote_path", remotePath).
+			WithContext("local_path", localPath)
+	}
+
+	s.logger.Debug("Object downloaded",
+		"bucket", s.bucketName,
+		"remote_path", remotePath,
+		"local_path", localPath,
+		"bytes", copied)
+	return nil
+}
+
+// CopyDirToLocal implements DirectoryInputStorage.CopyDirToLocal, downloading every
+// object under the prefix remoteDir stands for
+func (s *GCSInputStorage) CopyDirToLocal(ctx context.Context, remoteDir, localDir string) error {
+	obj, err := s.object(remoteDir)
+	if err != nil {
+		return err
+	}
+	prefix := obj.ObjectName() + "/"
+
+	copied := 0
+	it := s.gcsClient.Bucket(s.bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to list objects").
+				WithContext("bucket", s.bucketName).
+				WithContext("prefix", prefix)
+		}
+		rel := strings.TrimPrefix(attrs.Name, prefix)
+		// Folder placeholders of the console end with a slash and hold nothing
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		localPath, err := ResolveWithin(localDir, rel)
+		if err != nil {
+			return err
+		}
+		if err := s.CopyToLocal(ctx, attrs.Name, localPath); err != nil {
+			return err
+		}
+		copied++
+	}
+	if copied == 0 {
+		return errors.NewNotFoundError("directory").
+			WithContext("bucket", s.bucketName).
+			WithContext("path", remoteDir)
+	}
+	return nil
+}
+
+// Exists implements InputStorage.Exists
+func (s *GCSInputStorage) Exists(ctx context.Context, p string) (bool, error) {
+	obj, err := s.object(p)
+	if err != nil {
+		return false, err
+	}
+	if _, err := obj.Attrs(ctx); err != nil {
+		if stderrors.Is(err, storage.ErrObjectNotExist) {
+			return false, nil
+		}
+		return false, s.objectError(err, p, "failed to check object existence")
+	}
+	return true, nil
+}
+
+// gcsRangeReader reads an object with range requests, keeping the last block read
+type gcsRangeReader struct {
+	ctx  context.Context
+	obj  *storage.ObjectHandle
+	path string
+	size int64
+
+	mu       sync.Mutex
+	blockOff int64
+	block    []byte
+}
+
+func (r *gcsRangeReader) Size() int64 {
+	return r.size
+}
+
+func (r *gcsRangeReader) Close() error {
+	return nil
+}
+
+// ReadAt implements io.ReaderAt
+func (r *gcsRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.NewValidationError("negative read offset").
+			WithContext("offset", off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < r.size {
+		pos := off + int64(n)
+		if pos < r.blockOff || pos >= r.blockOff+int64(len(r.block)) {
+			if err := r.fetch(pos, len(p)-n); err != nil {
+				return n, err
+			}
+		}
+		n += copy(p[n:], r.block[pos-r.blockOff:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fetch replaces the kept block with the range of at least want bytes at off
+func (r *gcsRangeReader) fetch(off int64, want int) error {
+	length := min(max(int64(want), rangeBlockSize), r.size-off)
+	reader, err := r.obj.NewRangeReader(r.ctx, off, length)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to request object range").
+			WithContext("path", r.path).
+			WithContext("offset", off).
+			WithContext("length", length)
+	}
+	defer reader.Close()
+
+	block := make([]byte, length)
+	if _, err := io.ReadFull(deadline.Reader(r.ctx, reader, "range read"), block); err != nil {
+		if ctxErr := deadline.Err(r.ctx, "range read"); ctxErr != nil {
+			return ctxErr
+		}
+		return errors.WrapStorageError(err, "failed to read object range").
+			WithContext("path", r.path).
+			WithContext("offset", off).
+			WithContext("length", length)
+	}
+	r.blockOff, r.block = off, block
+	return nil
+}
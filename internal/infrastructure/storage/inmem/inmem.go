@@ -0,0 +1,306 @@
+// Package inmem provides a map-backed storage for tests of the service and the job
+// orchestrator. It implements storage.InputStorage, storage.OutputStorage and
+// port.Storage, and can be told to fail or slow down specific operations.
+package inmem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Op names a storage operation for failure injection and the call log
+type Op string
+
+const (
+	OpGetReader       Op = "get_reader"
+	OpCopyToLocal     Op = "copy_to_local"
+	OpExists          Op = "exists"
+	OpPutFile         Op = "put_file"
+	OpPutDirectory    Op = "put_directory"
+	OpDelete          Op = "delete"
+	OpUploadDirectory Op = "upload_directory"
+)
+
+// Failure makes matching calls return Err. An empty Op matches every operation and
+// an empty Prefix every path; Times limits how many calls fail (0 = all of them).
+type Failure struct {
+	Op     Op
+	Prefix string
+	Err    error
+	Times  int
+}
+
+// Call is one recorded storage call
+type Call struct {
+	Op   Op
+	Path string
+}
+
+// Storage keeps objects in memory, keyed by slash-separated relative paths
+type Storage struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	failures []*Failure
+	latency  time.Duration
+	calls    []Call
+}
+
+// New creates an empty storage
+func New() *Storage {
+	return &Storage{objects: make(map[string][]byte)}
+}
+
+// Put stores data under p, bypassing failure injection and latency
+func (s *Storage) Put(p string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[cleanKey(p)] = append([]byte(nil), data...)
+}
+
+// Get returns a copy of the object stored under p
+func (s *Storage) Get(p string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[cleanKey(p)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+// Keys returns the stored paths under prefix (all paths for ""), sorted
+func (s *Storage) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.objects {
+		if underPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Fail registers a failure; failures are checked in the order they were added
+func (s *Storage) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// ClearFailures removes all registered failures
+func (s *Storage) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// SetLatency delays every operation by d, or until its context is done
+func (s *Storage) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Calls returns the operations made so far, in order
+func (s *Storage) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// Reset removes all objects, failures and recorded calls
+func (s *Storage) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects = make(map[string][]byte)
+	s.failures = nil
+	s.calls = nil
+	s.latency = 0
+}
+
+// begin records the call, waits out the latency and returns an injected failure, if any
+func (s *Storage) begin(ctx context.Context, op Op, p string) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Op: op, Path: p})
+	latency := s.latency
+	var injected error
+	for _, f := range s.failures {
+		if (f.Op != "" && f.Op != op) || !underPrefix(cleanKey(p), f.Prefix) || f.Times < 0 {
+			continue
+		}
+		injected = f.Err
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				f.Times = -1 // Used up
+			}
+		}
+		break
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return errors.New(errors.ErrorTypeCancellation, "storage operation canceled").
+				WithContext("op", string(op)).
+				WithContext("path", p)
+		}
+	}
+	return injected
+}
+
+// GetReader implements storage.InputStorage.GetReader
+func (s *Storage) GetReader(ctx context.Context, p string) (io.ReadCloser, error) {
+	if err := s.begin(ctx, OpGetReader, p); err != nil {
+		return nil, err
+	}
+	data, ok := s.Get(p)
+	if !ok {
+		return nil, errors.NewNotFoundError("file not found").
+			WithContext("path", p)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// CopyToLocal implements storage.InputStorage.CopyToLocal
+func (s *Storage) CopyToLocal(ctx context.Context, remotePath, localPath string) error {
+	if err := s.begin(ctx, OpCopyToLocal, remotePath); err != nil {
+		return err
+	}
+	data, ok := s.Get(remotePath)
+	if !ok {
+		return errors.NewNotFoundError("file not found").
+			WithContext("path", remotePath)
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create local directory").
+			WithContext("local_path", localPath)
+	}
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write local file").
+			WithContext("local_path", localPath)
+	}
+	return nil
+}
+
+// Exists implements storage.InputStorage.Exists
+func (s *Storage) Exists(ctx context.Context, p string) (bool, error) {
+	if err := s.begin(ctx, OpExists, p); err != nil {
+		return false, err
+	}
+	_, ok := s.Get(p)
+	return ok, nil
+}
+
+// PutFile implements storage.OutputStorage.PutFile
+func (s *Storage) PutFile(ctx context.Context, localPath, remotePath string) error {
+	if err := s.begin(ctx, OpPutFile, remotePath); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to read local file").
+			WithContext("local_path", localPath)
+	}
+	s.Put(remotePath, data)
+	return nil
+}
+
+// PutDirectory implements storage.OutputStorage.PutDirectory
+func (s *Storage) PutDirectory(ctx context.Context, localDir, remoteDir string) error {
+	if err := s.begin(ctx, OpPutDirectory, remoteDir); err != nil {
+		return err
+	}
+	return s.putTree(ctx, localDir, remoteDir)
+}
+
+// Delete implements storage.OutputStorage.Delete, removing a file or everything under a directory
+func (s *Storage) Delete(ctx context.Context, remotePath string) error {
+	if err := s.begin(ctx, OpDelete, remotePath); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := cleanKey(remotePath)
+	for key := range s.objects {
+		if underPrefix(key, prefix) {
+			delete(s.objects, key)
+		}
+	}
+	return nil
+}
+
+// UploadDirectory implements port.Storage.UploadDirectory
+func (s *Storage) UploadDirectory(ctx context.Context, sourceDir, destPath string) error {
+	if err := s.begin(ctx, OpUploadDirectory, destPath); err != nil {
+		return err
+	}
+	return s.putTree(ctx, sourceDir, destPath)
+}
+
+func (s *Storage) putTree(ctx context.Context, localDir, remoteDir string) error {
+	err := filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return errors.New(errors.ErrorTypeCancellation, "storage operation canceled").
+				WithContext("remote_dir", remoteDir)
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		s.Put(path.Join(filepath.ToSlash(remoteDir), filepath.ToSlash(rel)), data)
+		return nil
+	})
+	if errors.Is(err, errors.ErrorTypeCancellation) {
+		return err
+	}
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to copy directory").
+			WithContext("local_dir", localDir).
+			WithContext("remote_dir", remoteDir)
+	}
+	return nil
+}
+
+// cleanKey normalizes a path to the slash-separated, relative form objects are keyed by
+func cleanKey(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+}
+
+// underPrefix reports whether key is prefix itself or lies below it; "" matches everything
+func underPrefix(key, prefix string) bool {
+	prefix = cleanKey(prefix)
+	return prefix == "" || key == prefix || strings.HasPrefix(key, prefix+"/")
+}
+
+var (
+	_ storage.InputStorage  = (*Storage)(nil)
+	_ storage.OutputStorage = (*Storage)(nil)
+	_ port.Storage          = (*Storage)(nil)
+)
@@ -17,6 +17,34 @@ type InputStorage interface {
 	Exists(ctx context.Context, path string) (bool, error)
 }
 
+// RangeReader reads parts of a file without copying the whole of it first
+type RangeReader interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the size of the file in bytes
+	Size() int64
+}
+
+// RangeInputStorage is an InputStorage that can read a file at random offsets, so a
+// header parse reads the header rather than the whole slide
+type RangeInputStorage interface {
+	InputStorage
+
+	// OpenRange opens the file at the given path for random access
+	OpenRange(ctx context.Context, path string) (RangeReader, error)
+}
+
+// DirectoryInputStorage is an InputStorage that can copy a whole directory, for
+// slides whose data files sit in a directory next to the file that names them (MIRAX)
+type DirectoryInputStorage interface {
+	InputStorage
+
+	// CopyDirToLocal copies every file below the directory at remoteDir into localDir,
+	// keeping their relative paths
+	CopyDirToLocal(ctx context.Context, remoteDir, localDir string) error
+}
+
 // OutputStorage abstracts writing files to various destinations (GCS upload, GCS FUSE mount, local filesystem, etc.)
 type OutputStorage interface {
 	// PutFile uploads a single file from local path to remote path
@@ -2,12 +2,13 @@ package storage
 
 import (
 	"context"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
 )
 
 type LocalStorage struct {
@@ -34,6 +35,9 @@ func (s *LocalStorage) UploadDirectory(ctx context.Context, sourceDir, destDir s
 		if err != nil {
 			return err
 		}
+		if err := deadline.Err(ctx, "local upload"); err != nil {
+			return err
+		}
 
 		rel, err := filepath.Rel(sourceDir, srcPath)
 		if err != nil {
@@ -50,26 +54,7 @@ func (s *LocalStorage) UploadDirectory(ctx context.Context, sourceDir, destDir s
 			return nil
 		}
 
-		if err := copyFile(srcPath, dstPath, info.Mode()); err != nil {
-			return err
-		}
-		return nil
-	})
-}
-
-func copyFile(src, dst string, mode os.FileMode) error {
-	in, err := os.Open(src)
-	if err != nil {
+		_, err = fsutil.CopyFile(ctx, srcPath, dstPath, fsutil.Options{Op: "local upload"})
 		return err
-	}
-	defer in.Close()
-
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, in)
-	return err
+	})
 }
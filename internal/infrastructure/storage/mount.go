@@ -7,14 +7,25 @@ import (
 	"os"
 	"path/filepath"
 
+	"golang.org/x/sync/errgroup"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+	"github.com/histopathai/image-processing-service/pkg/ratelimit"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 // MountStorage implements storage interfaces for mount-based access (GCS FUSE, local filesystem)
 // It simply copies files between the mount point and local /tmp
 type MountStorage struct {
-	basePath string
-	logger   *slog.Logger
+	basePath  string
+	logger    *slog.Logger
+	checksums *ChecksumLedger
+	retrier   *retry.Retrier
+	pacer     *ratelimit.Pacer
+	parallel  int // Files PutDirectory copies at once
 }
 
 // NewMountStorage creates a new mount-based storage
@@ -23,12 +34,64 @@ func NewMountStorage(basePath string, logger *slog.Logger) *MountStorage {
 	return &MountStorage{
 		basePath: basePath,
 		logger:   logger,
+		retrier:  retry.New(logger, retry.DefaultPolicy),
+		parallel: 1,
 	}
 }
 
+// SetRetrier replaces the default retry policy of writes to the mount
+func (m *MountStorage) SetRetrier(retrier *retry.Retrier) {
+	m.retrier = retrier
+}
+
+// SetPacer paces writes to the mount, which gcsfuse turns into object writes
+func (m *MountStorage) SetPacer(pacer *ratelimit.Pacer) {
+	m.pacer = pacer
+}
+
+// SetParallelism sets how many files PutDirectory copies at once. Writes through
+// gcsfuse are latency bound, so copying a pyramid of many small tiles one at a time
+// leaves the mount mostly idle.
+func (m *MountStorage) SetParallelism(n int) {
+	m.parallel = max(1, n)
+}
+
+// EnableChecksums makes every copy record the SHA-256 of the file in a ledger,
+// keyed by the path as passed to CopyToLocal or the remote path of PutFile/PutDirectory
+func (m *MountStorage) EnableChecksums() {
+	m.checksums = NewChecksumLedger()
+}
+
+// Checksums returns the ledger, nil unless EnableChecksums was called
+func (m *MountStorage) Checksums() *ChecksumLedger {
+	return m.checksums
+}
+
+// copy copies src to dst and, with checksums enabled, records the checksum under key
+func (m *MountStorage) copy(ctx context.Context, dst io.Writer, src io.Reader, key, op string) (int64, error) {
+	if m.checksums == nil {
+		return fsutil.Copy(ctx, dst, src, fsutil.Options{Op: op})
+	}
+	n, sum, err := copyWithChecksum(ctx, dst, src, op)
+	if err != nil {
+		return n, err
+	}
+	m.checksums.Record(key, sum)
+	return n, nil
+}
+
+// resolve joins a path relative to the mount onto basePath, rejecting paths that are
+// absolute, contain ".." or lead out of the mount through a symlink
+func (m *MountStorage) resolve(path string) (string, error) {
+	return ResolveWithin(m.basePath, path)
+}
+
 // GetReader implements InputStorage.GetReader
 func (m *MountStorage) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
-	fullPath := filepath.Join(m.basePath, path)
+	fullPath, err := m.resolve(path)
+	if err != nil {
+		return nil, err
+	}
 
 	file, err := os.Open(fullPath)
 	if err != nil {
@@ -45,6 +108,49 @@ func (m *MountStorage) GetReader(ctx context.Context, path string) (io.ReadClose
 	return file, nil
 }
 
+// OpenRange implements RangeInputStorage.OpenRange. Absolute paths are opened
+// directly, like in CopyToLocal.
+func (m *MountStorage) OpenRange(ctx context.Context, path string) (RangeReader, error) {
+	fullPath := path
+	if !filepath.IsAbs(path) {
+		resolved, err := m.resolve(path)
+		if err != nil {
+			return nil, err
+		}
+		fullPath = resolved
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewNotFoundError("file not found").
+				WithContext("path", path).
+				WithContext("full_path", fullPath)
+		}
+		return nil, errors.WrapStorageError(err, "failed to open file").
+			WithContext("path", path).
+			WithContext("full_path", fullPath)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.WrapStorageError(err, "failed to stat file").
+			WithContext("path", path).
+			WithContext("full_path", fullPath)
+	}
+	return &fileRangeReader{File: file, size: info.Size()}, nil
+}
+
+// fileRangeReader is a RangeReader of a file on the mount
+type fileRangeReader struct {
+	*os.File
+	size int64
+}
+
+func (r *fileRangeReader) Size() int64 {
+	return r.size
+}
+
 // CopyToLocal implements InputStorage.CopyToLocal
 func (m *MountStorage) CopyToLocal(ctx context.Context, remotePath, localPath string) error {
 	// Handle absolute paths by using them directly as the source
@@ -58,7 +164,11 @@ func (m *MountStorage) CopyToLocal(ctx context.Context, remotePath, localPath st
 			"full_remote_path", fullRemotePath)
 	} else {
 		// Join with basePath for relative paths
-		fullRemotePath = filepath.Join(m.basePath, remotePath)
+		resolved, err := m.resolve(remotePath)
+		if err != nil {
+			return err
+		}
+		fullRemotePath = resolved
 		m.logger.Debug("Joining with basePath",
 			"remote_path", remotePath,
 			"basePath", m.basePath,
@@ -100,8 +210,11 @@ func (m *MountStorage) CopyToLocal(ctx context.Context, remotePath, localPath st
 	defer dst.Close()
 
 	// Copy data
-	copied, err := io.Copy(dst, src)
+	copied, err := m.copy(ctx, dst, src, remotePath, "input copy")
 	if err != nil {
+		if ctxErr := deadline.Err(ctx, "input copy"); ctxErr != nil {
+			return ctxErr
+		}
 		return errors.WrapStorageError(err, "failed to copy file data").
 			WithContext("remote_path", remotePath).
 			WithContext("local_path", localPath)
@@ -115,11 +228,57 @@ func (m *MountStorage) CopyToLocal(ctx context.Context, remotePath, localPath st
 	return nil
 }
 
+// CopyDirToLocal implements DirectoryInputStorage.CopyDirToLocal. Absolute paths are
+// used directly, like in CopyToLocal.
+func (m *MountStorage) CopyDirToLocal(ctx context.Context, remoteDir, localDir string) error {
+	fullRemoteDir := remoteDir
+	if !filepath.IsAbs(remoteDir) {
+		resolved, err := m.resolve(remoteDir)
+		if err != nil {
+			return err
+		}
+		fullRemoteDir = resolved
+	}
+
+	info, err := os.Stat(fullRemoteDir)
+	if err != nil || !info.IsDir() {
+		if err == nil || os.IsNotExist(err) {
+			return errors.NewNotFoundError("source directory not found").
+				WithContext("remote_dir", remoteDir).
+				WithContext("full_path", fullRemoteDir)
+		}
+		return errors.WrapStorageError(err, "failed to stat source directory").
+			WithContext("remote_dir", remoteDir).
+			WithContext("full_path", fullRemoteDir)
+	}
+
+	return filepath.WalkDir(fullRemoteDir, func(remotePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to walk source directory").
+				WithContext("remote_dir", remoteDir).
+				WithContext("path", remotePath)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(fullRemoteDir, remotePath)
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to calculate relative path").
+				WithContext("remote_path", remotePath).
+				WithContext("remote_dir", fullRemoteDir)
+		}
+		return m.CopyToLocal(ctx, remotePath, filepath.Join(localDir, relPath))
+	})
+}
+
 // Exists implements InputStorage.Exists
 func (m *MountStorage) Exists(ctx context.Context, path string) (bool, error) {
-	fullPath := filepath.Join(m.basePath, path)
+	fullPath, err := m.resolve(path)
+	if err != nil {
+		return false, err
+	}
 
-	_, err := os.Stat(fullPath)
+	_, err = os.Stat(fullPath)
 	if err == nil {
 		return true, nil
 	}
@@ -133,7 +292,10 @@ func (m *MountStorage) Exists(ctx context.Context, path string) (bool, error) {
 
 // PutFile implements OutputStorage.PutFile
 func (m *MountStorage) PutFile(ctx context.Context, localPath, remotePath string) error {
-	fullRemotePath := filepath.Join(m.basePath, remotePath)
+	fullRemotePath, err := m.resolve(remotePath)
+	if err != nil {
+		return err
+	}
 
 	m.logger.Debug("Copying file from local to mount",
 		"local_path", localPath,
@@ -147,33 +309,9 @@ func (m *MountStorage) PutFile(ctx context.Context, localPath, remotePath string
 			WithContext("dir", remoteDir)
 	}
 
-	// Open source file
-	src, err := os.Open(localPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.NewNotFoundError("local file not found").
-				WithContext("local_path", localPath)
-		}
-		return errors.WrapStorageError(err, "failed to open local file").
-			WithContext("local_path", localPath)
-	}
-	defer src.Close()
-
-	// Create destination file
-	dst, err := os.Create(fullRemotePath)
-	if err != nil {
-		return errors.WrapStorageError(err, "failed to create remote file").
-			WithContext("remote_path", remotePath).
-			WithContext("full_path", fullRemotePath)
-	}
-	defer dst.Close()
-
-	// Copy data
-	copied, err := io.Copy(dst, src)
+	copied, err := m.writeFile(ctx, localPath, fullRemotePath, remotePath)
 	if err != nil {
-		return errors.WrapStorageError(err, "failed to copy file data").
-			WithContext("local_path", localPath).
-			WithContext("remote_path", remotePath)
+		return err
 	}
 
 	m.logger.Debug("File uploaded successfully",
@@ -184,20 +322,32 @@ func (m *MountStorage) PutFile(ctx context.Context, localPath, remotePath string
 	return nil
 }
 
-// PutDirectory implements OutputStorage.PutDirectory
+// PutDirectory implements OutputStorage.PutDirectory. The tree is walked first,
+// creating the directories, then its files are copied up to SetParallelism at once.
 func (m *MountStorage) PutDirectory(ctx context.Context, localDir, remoteDir string) error {
-	fullRemoteDir := filepath.Join(m.basePath, remoteDir)
+	fullRemoteDir, err := m.resolve(remoteDir)
+	if err != nil {
+		return err
+	}
 
 	m.logger.Debug("Copying directory from local to mount",
 		"local_dir", localDir,
 		"remote_dir", remoteDir,
-		"full_remote_dir", fullRemoteDir)
+		"full_remote_dir", fullRemoteDir,
+		"parallel", m.parallel)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(m.parallel)
 
-	// Walk the local directory
-	return filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+	// Walk the local directory, queueing the file copies
+	walkErr := filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		// Stop queueing copies once canceled or a sibling failed
+		if err := deadline.Err(gctx, "directory copy"); err != nil {
+			return err
+		}
 
 		// Calculate relative path
 		relPath, err := filepath.Rel(localDir, localPath)
@@ -210,7 +360,7 @@ func (m *MountStorage) PutDirectory(ctx context.Context, localDir, remoteDir str
 		remotePath := filepath.Join(fullRemoteDir, relPath)
 
 		if info.IsDir() {
-			// Create directory
+			// Create directory before any copy into it is queued
 			if err := os.MkdirAll(remotePath, 0755); err != nil {
 				return errors.WrapStorageError(err, "failed to create remote directory").
 					WithContext("remote_path", remotePath)
@@ -218,40 +368,82 @@ func (m *MountStorage) PutDirectory(ctx context.Context, localDir, remoteDir str
 			return nil
 		}
 
-		// Copy file
+		g.Go(func() error {
+			_, err := m.writeFile(gctx, localPath, remotePath, filepath.Join(remoteDir, relPath))
+			return err
+		})
+		return nil
+	})
+
+	// A failed copy cancels gctx and stops the walk, so its error wins over the walk's
+	copyErr := g.Wait()
+	if ctxErr := deadline.Err(ctx, "directory copy"); ctxErr != nil {
+		return ctxErr
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+	return walkErr
+}
+
+// writeFile copies a local file to fullRemotePath, retrying transient failures of the
+// mount (FUSE writes); key names the file in the checksum ledger
+func (m *MountStorage) writeFile(ctx context.Context, localPath, fullRemotePath, key string) (int64, error) {
+	var copied int64
+	err := m.retrier.Do(ctx, "mount write", func(ctx context.Context) error {
+		if err := m.pacer.Wait(ctx); err != nil {
+			return err
+		}
 		src, err := os.Open(localPath)
 		if err != nil {
+			if os.IsNotExist(err) {
+				return errors.NewNotFoundError("local file not found").
+					WithContext("local_path", localPath)
+			}
 			return errors.WrapStorageError(err, "failed to open local file").
 				WithContext("local_path", localPath)
 		}
 		defer src.Close()
 
-		dst, err := os.Create(remotePath)
+		dst, err := os.Create(fullRemotePath)
 		if err != nil {
 			return errors.WrapStorageError(err, "failed to create remote file").
-				WithContext("remote_path", remotePath)
+				WithContext("remote_path", key).
+				WithContext("full_path", fullRemotePath)
 		}
-		defer dst.Close()
 
-		if _, err := io.Copy(dst, src); err != nil {
-			return errors.WrapStorageError(err, "failed to copy file").
+		copied, err = m.copy(ctx, dst, src, key, "mount write")
+		if err != nil {
+			dst.Close()
+			if ctxErr := deadline.Err(ctx, "mount write"); ctxErr != nil {
+				return ctxErr
+			}
+			return errors.WrapStorageError(err, "failed to copy file data").
 				WithContext("local_path", localPath).
-				WithContext("remote_path", remotePath)
+				WithContext("remote_path", key)
+		}
+		if err := dst.Close(); err != nil {
+			return errors.WrapStorageError(err, "failed to close remote file").
+				WithContext("remote_path", key).
+				WithContext("full_path", fullRemotePath)
 		}
-
 		return nil
 	})
+	return copied, err
 }
 
 // Delete implements OutputStorage.Delete
 func (m *MountStorage) Delete(ctx context.Context, remotePath string) error {
-	fullPath := filepath.Join(m.basePath, remotePath)
+	fullPath, err := m.resolve(remotePath)
+	if err != nil {
+		return err
+	}
 
 	m.logger.Debug("Deleting file/directory",
 		"remote_path", remotePath,
 		"full_path", fullPath)
 
-	err := os.RemoveAll(fullPath)
+	err = os.RemoveAll(fullPath)
 	if err != nil && !os.IsNotExist(err) {
 		return errors.WrapStorageError(err, "failed to delete").
 			WithContext("remote_path", remotePath).
@@ -261,6 +453,14 @@ func (m *MountStorage) Delete(ctx context.Context, remotePath string) error {
 	return nil
 }
 
+// UploadDirectory implements port.Storage.UploadDirectory by copying, so a mount can
+// be the destination of the orchestrator (e.g. the output replica) without the
+// source being moved away
+func (m *MountStorage) UploadDirectory(ctx context.Context, sourceDir, destPath string) error {
+	return m.PutDirectory(ctx, sourceDir, destPath)
+}
+
 // Verify interfaces are implemented
-var _ InputStorage = (*MountStorage)(nil)
+var _ DirectoryInputStorage = (*MountStorage)(nil)
 var _ OutputStorage = (*MountStorage)(nil)
+var _ port.Storage = (*MountStorage)(nil)
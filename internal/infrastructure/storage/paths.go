@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ResolveWithin joins the relative path rel onto root and makes sure the result,
+// with symlinks resolved, stays inside root. Paths that do not exist yet are checked
+// through their deepest existing parent. It returns the joined (unresolved) path.
+func ResolveWithin(root, rel string) (string, error) {
+	if err := model.ValidateRelativePath("path", rel); err != nil {
+		return "", err
+	}
+	joined := filepath.Join(root, filepath.FromSlash(rel))
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to resolve mount path").
+			WithContext("root", root)
+	}
+	realRoot, err := evalExisting(absRoot)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to resolve mount path").
+			WithContext("root", root)
+	}
+	realPath, err := evalExisting(filepath.Join(absRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to resolve path").
+			WithContext("path", joined)
+	}
+
+	inside, err := filepath.Rel(realRoot, realPath)
+	if err != nil || !(inside == "." || filepath.IsLocal(inside)) {
+		return "", errors.NewValidationError("path resolves outside the mount").
+			WithContext("path", rel).
+			WithContext("resolved_path", realPath).
+			WithContext("root", root)
+	}
+	return joined, nil
+}
+
+// evalExisting resolves the symlinks of the deepest existing ancestor of p and
+// appends the rest of p to it
+func evalExisting(p string) (string, error) {
+	real, err := filepath.EvalSymlinks(p)
+	if err == nil {
+		return real, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	parent := filepath.Dir(p)
+	if parent == p {
+		return p, nil
+	}
+	realParent, err := evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(realParent, filepath.Base(p)), nil
+}
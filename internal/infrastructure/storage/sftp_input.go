@@ -0,0 +1,479 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+)
+
+// sftpReadAhead is the number of reads kept in flight at once, so a copy is not
+// bound by the round trip to the server
+const sftpReadAhead = 64
+
+// sftpBlockSize is the length of the sequential reads of a file, sftpReadAhead reads
+// of the 32 KiB every server supports
+const sftpBlockSize = sftpReadAhead * 32 << 10
+
+// SFTPInputStorage reads inputs from an SFTP server, such as the share scanner
+// workstations drop slides on, so they are ingested without an uploader copying them
+// to a bucket first. Paths are relative to root on the server; absolute paths below
+// mountPath, where the inputs would be mounted otherwise, map to the same files. The
+// connection is opened on first use and again after it failed or was closed because
+// the context of a call was done while it waited on the server.
+type SFTPInputStorage struct {
+	logger    *slog.Logger
+	addr      string
+	sshConfig *ssh.ClientConfig
+	root      string
+	mountPath string
+	checksums *ChecksumLedger
+
+	mu   sync.Mutex
+	conn *sftpConn
+}
+
+// sftpConn is an SSH connection with the SFTP session on it
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	done   chan struct{} // Closed once the connection is gone
+	once   sync.Once
+}
+
+func newSFTPConn(sshClient *ssh.Client, client *sftp.Client) *sftpConn {
+	c := &sftpConn{ssh: sshClient, client: client, done: make(chan struct{})}
+	go func() {
+		sshClient.Wait()
+		c.markDone()
+	}()
+	return c
+}
+
+func (c *sftpConn) markDone() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *sftpConn) alive() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close closes the SSH connection before the session, which waits for the server
+// otherwise
+func (c *sftpConn) Close() error {
+	c.markDone()
+	err := c.ssh.Close()
+	c.client.Close()
+	return err
+}
+
+func NewSFTPInputStorage(logger *slog.Logger, addr string, sshConfig *ssh.ClientConfig, root, mountPath string) *SFTPInputStorage {
+	// Input paths are made absolute before they get here, and so must the mount be
+	if abs, err := filepath.Abs(mountPath); err == nil {
+		mountPath = abs
+	}
+	return &SFTPInputStorage{
+		logger:    logger,
+		addr:      addr,
+		sshConfig: sshConfig,
+		root:      root,
+		mountPath: mountPath,
+	}
+}
+
+// EnableChecksums makes every CopyToLocal record the SHA-256 of the file in a
+// ledger, keyed by the path as passed to CopyToLocal
+func (s *SFTPInputStorage) EnableChecksums() {
+	s.checksums = NewChecksumLedger()
+}
+
+// Checksums returns the ledger, nil unless EnableChecksums was called
+func (s *SFTPInputStorage) Checksums() *ChecksumLedger {
+	return s.checksums
+}
+
+// Close closes the connection to the server
+func (s *SFTPInputStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// connect returns the open connection, dialing the server when there is none
+func (s *SFTPInputStorage) connect(ctx context.Context) (*sftpConn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.alive() {
+		return s.conn, nil
+	}
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to connect to SFTP server").
+			WithContext("addr", s.addr)
+	}
+	// The handshake does not take a context
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.addr, s.sshConfig)
+	if err != nil {
+		conn.Close()
+		if ctxErr := deadline.Err(ctx, "SFTP connect"); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, errors.WrapStorageError(err, "failed to open SSH connection").
+			WithContext("addr", s.addr).
+			WithContext("user", s.sshConfig.User)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	client, err := sftp.NewClient(sshClient, sftp.MaxConcurrentRequestsPerFile(sftpReadAhead))
+	if err != nil {
+		sshClient.Close()
+		if ctxErr := deadline.Err(ctx, "SFTP connect"); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, errors.WrapStorageError(err, "failed to start SFTP session").
+			WithContext("addr", s.addr)
+	}
+	if !stop() {
+		sshClient.Close()
+		client.Close()
+		return nil, deadline.Err(ctx, "SFTP connect")
+	}
+
+	s.logger.Info("Connected to SFTP server",
+		"addr", s.addr,
+		"user", s.sshConfig.User,
+		"root", s.root)
+	s.conn = newSFTPConn(sshClient, client)
+	return s.conn, nil
+}
+
+// watch closes conn once ctx is done, until stop is called, so calls waiting on a
+// server that stopped answering return. Other calls on the connection fail with it
+// and the next one dials again.
+func (s *SFTPInputStorage) watch(ctx context.Context, conn *sftpConn) (stop func() bool) {
+	return context.AfterFunc(ctx, func() {
+		s.logger.Warn("Closing SFTP connection, context done while waiting on the server",
+			"addr", s.addr,
+			"error", ctx.Err())
+		conn.Close()
+	})
+}
+
+// remotePath returns the path on the server p stands for
+func (s *SFTPInputStorage) remotePath(p string) (string, error) {
+	name := filepath.ToSlash(p)
+	if filepath.IsAbs(p) {
+		rel, err := filepath.Rel(s.mountPath, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return "", errors.NewValidationError("path is outside of the input mount").
+				WithContext("path", p).
+				WithContext("mount_path", s.mountPath)
+		}
+		name = filepath.ToSlash(rel)
+	}
+	name = path.Clean(name)
+	if name == "." || strings.HasPrefix(name, "../") || name == ".." || path.IsAbs(name) {
+		return "", errors.NewValidationError("invalid input path").
+			WithContext("path", p)
+	}
+	return path.Join(s.root, name), nil
+}
+
+// fileError converts an SFTP error into a not found or storage error, or the error of
+// ctx when the connection was closed because it is done
+func (s *SFTPInputStorage) fileError(ctx context.Context, err error, p, message string) error {
+	if ctxErr := deadline.Err(ctx, "SFTP request"); ctxErr != nil {
+		return ctxErr
+	}
+	if stderrors.Is(err, fs.ErrNotExist) {
+		return errors.NewNotFoundError("file").
+			WithContext("addr", s.addr).
+			WithContext("path", p)
+	}
+	return errors.WrapStorageError(err, message).
+		WithContext("addr", s.addr).
+		WithContext("path", p)
+}
+
+// open opens the regular file p stands for. The connection is watched until the file
+// is closed.
+func (s *SFTPInputStorage) open(ctx context.Context, p string) (*sftpFile, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stop := s.watch(ctx, conn)
+	file, err := conn.client.Open(remote)
+	if err != nil {
+		stop()
+		return nil, s.fileError(ctx, err, p, "failed to open file")
+	}
+	f := &sftpFile{file: file, stop: stop, path: p}
+	info, err := file.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = stderrors.New("not a regular file")
+	}
+	if err != nil {
+		f.Close()
+		return nil, s.fileError(ctx, err, p, "failed to read file attributes")
+	}
+	f.size = info.Size()
+	return f, nil
+}
+
+// GetReader implements InputStorage.GetReader, streaming the file
+func (s *SFTPInputStorage) GetReader(ctx context.Context, p string) (io.ReadCloser, error) {
+	f, err := s.open(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return newSFTPReader(f), nil
+}
+
+// OpenRange implements RangeInputStorage.OpenRange. Every read that misses the last
+// block reads at least rangeBlockSize bytes.
+func (s *SFTPInputStorage) OpenRange(ctx context.Context, p string) (RangeReader, error) {
+	f, err := s.open(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpRangeReader{f: f}, nil
+}
+
+// CopyToLocal implements InputStorage.CopyToLocal
+func (s *SFTPInputStorage) CopyToLocal(ctx context.Context, remotePath, localPath string) error {
+	localDir := filepath.Dir(localPath)
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create local directory").
+			WithContext("dir", localDir)
+	}
+
+	f, err := s.open(ctx, remotePath)
+	if err != nil {
+		return err
+	}
+	reader := newSFTPReader(f)
+	defer reader.Close()
+
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to create destination file").
+			WithContext("local_path", localPath)
+	}
+	defer dst.Close()
+
+	var copied int64
+	if s.checksums == nil {
+		copied, err = fsutil.Copy(ctx, dst, reader, fsutil.Options{Op: "input download"})
+	} else {
+		var sum string
+		copied, sum, err = copyWithChecksum(ctx, dst, reader, "input download")
+		if err == nil {
+			s.checksums.Record(remotePath, sum)
+		}
+	}
+	if err != nil {
+		return s.fileError(ctx, err, remotePath, "failed to download file")
+	}
+
+	s.logger.Debug("File downloaded",
+		"addr", s.addr,
+		"remote_path", remotePath,
+		"local_path", localPath,
+		"bytes", copied)
+	return nil
+}
+
+// CopyDirToLocal implements DirectoryInputStorage.CopyDirToLocal, walking the
+// directory on the server. Entries that are neither files nor directories are skipped.
+func (s *SFTPInputStorage) CopyDirToLocal(ctx context.Context, remoteDir, localDir string) error {
+	entries, err := s.listDir(ctx, remoteDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := deadline.Err(ctx, "directory download"); err != nil {
+			return err
+		}
+		localPath, err := ResolveWithin(localDir, entry.Name())
+		if err != nil {
+			return err
+		}
+		remotePath := filepath.Join(remoteDir, entry.Name())
+		switch {
+		case entry.IsDir():
+			err = s.CopyDirToLocal(ctx, remotePath, localPath)
+		case entry.Mode().IsRegular():
+			err = s.CopyToLocal(ctx, remotePath, localPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listDir returns the entries of the directory p stands for, without . and ..
+func (s *SFTPInputStorage) listDir(ctx context.Context, p string) ([]os.FileInfo, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.watch(ctx, conn)()
+	entries, err := conn.client.ReadDirContext(ctx, remote)
+	if err != nil {
+		return nil, s.fileError(ctx, err, p, "failed to list directory")
+	}
+	return entries, nil
+}
+
+// Exists implements InputStorage.Exists
+func (s *SFTPInputStorage) Exists(ctx context.Context, p string) (bool, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return false, err
+	}
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer s.watch(ctx, conn)()
+	if _, err := conn.client.Stat(remote); err != nil {
+		if ctxErr := deadline.Err(ctx, "SFTP request"); ctxErr == nil && stderrors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, s.fileError(ctx, err, p, "failed to check file existence")
+	}
+	return true, nil
+}
+
+// sftpFile is a file opened for reading on the server
+type sftpFile struct {
+	file *sftp.File
+	stop func() bool // Stops watching the connection
+	path string
+	size int64
+}
+
+func (f *sftpFile) Close() error {
+	defer f.stop()
+	return f.file.Close()
+}
+
+// sftpReader reads a file from start to end in blocks of sftpBlockSize, each read
+// with sftpReadAhead requests in flight
+type sftpReader struct {
+	f   *sftpFile
+	buf *bufio.Reader
+	off int64
+}
+
+func newSFTPReader(f *sftpFile) *sftpReader {
+	return &sftpReader{f: f, buf: bufio.NewReaderSize(f.file, sftpBlockSize)}
+}
+
+func (r *sftpReader) Read(p []byte) (int, error) {
+	n, err := r.buf.Read(p)
+	r.off += int64(n)
+	if err == io.EOF && r.off < r.f.size {
+		// The file shrank since it was opened
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *sftpReader) Close() error {
+	return r.f.Close()
+}
+
+// sftpRangeReader reads a file at random offsets, keeping the last block read
+type sftpRangeReader struct {
+	f *sftpFile
+
+	mu       sync.Mutex
+	blockOff int64
+	block    []byte
+}
+
+func (r *sftpRangeReader) Size() int64 {
+	return r.f.size
+}
+
+func (r *sftpRangeReader) Close() error {
+	return r.f.Close()
+}
+
+// ReadAt implements io.ReaderAt
+func (r *sftpRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.NewValidationError("negative read offset").
+			WithContext("offset", off)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) && off+int64(n) < r.f.size {
+		pos := off + int64(n)
+		if pos < r.blockOff || pos >= r.blockOff+int64(len(r.block)) {
+			length := min(max(int64(len(p)-n), rangeBlockSize), r.f.size-pos)
+			block := make([]byte, length)
+			read, err := r.f.file.ReadAt(block, pos)
+			if read == 0 {
+				if err == nil || err == io.EOF {
+					break
+				}
+				return n, errors.WrapStorageError(err, "failed to read file range").
+					WithContext("path", r.f.path).
+					WithContext("offset", pos).
+					WithContext("length", length)
+			}
+			r.blockOff, r.block = pos, block[:read]
+		}
+		n += copy(p[n:], r.block[pos-r.blockOff:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
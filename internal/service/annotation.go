@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// RenderAnnotations burns the annotations into a flattened PNG of either an
+// overview (longest edge renderSize) or, when region is set, a region crop.
+// It returns the workspace holding the render and its path relative to the workspace.
+func (s *ImageProcessingService) RenderAnnotations(ctx context.Context, file *model.File, annotations *model.AnnotationSet, region *model.RegionSpec, renderSize int) (_ *model.Workspace, _ string, err error) {
+	if annotations == nil || len(annotations.Shapes) == 0 {
+		return nil, "", errors.NewValidationError("annotations are required").
+			WithContext("fileID", file.ID)
+	}
+
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, "", errors.NewStorageError("failed to create workspace").
+			WithContext("fileID", file.ID)
+	}
+
+	// The caller owns the workspace on success; a failed job must not leave it behind
+	defer func() {
+		if err != nil {
+			workspace.Remove()
+		}
+	}()
+
+	if err := s.resolveOriginalPath(ctx, file); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.GetImageInfo(ctx, file); err != nil {
+		return nil, "", err
+	}
+
+	basePath := workspace.Join("annotation_base.png")
+	defer os.Remove(basePath)
+
+	var transform processors.OverlayTransform
+	var relPath string
+
+	if region != nil {
+		if err := region.Validate(); err != nil {
+			return nil, "", errors.WrapValidationError(err, "invalid region").
+				WithContext("fileID", file.ID)
+		}
+
+		s.logger.Info("Rendering annotations on region",
+			"fileID", file.ID,
+			"shapes", len(annotations.Shapes),
+			"x", region.X,
+			"y", region.Y,
+			"width", region.Width,
+			"height", region.Height,
+			"level", region.Level)
+
+		base := *region
+		base.Format = model.RegionFormatPNG
+		if err := s.extractRegionTo(ctx, file, workspace, &base, basePath); err != nil {
+			return nil, "", err
+		}
+
+		downsample := 1.0
+		if processors.IsWholeSlideFormat(file.Extension()) {
+			downsample, err = s.fileInfoProcessor.GetLevelDownsample(ctx, file.AbsolutePath(), region.Level)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		transform = processors.OverlayTransform{
+			OffsetX: float64(region.X),
+			OffsetY: float64(region.Y),
+			Scale:   1 / downsample,
+		}
+		relPath = filepath.Join("annotations", fmt.Sprintf("annotated_region_%d_%d_%d_%d_l%d.png",
+			region.X, region.Y, region.Width, region.Height, region.Level))
+	} else {
+		s.logger.Info("Rendering annotations on overview",
+			"fileID", file.ID,
+			"shapes", len(annotations.Shapes),
+			"size", renderSize)
+
+		if s.isDNGFile(file) {
+			if _, err := s.ConvertDNG(ctx, file, workspace); err != nil {
+				return nil, "", err
+			}
+			defer workspace.RemoveFile(s.sourcePath(file, workspace))
+		}
+
+		result, err := s.vipsProcessor.CreateThumbnail(ctx, s.sourcePath(file, workspace), basePath,
+			renderSize,
+			renderSize,
+			100)
+		if err != nil {
+			stderr := ""
+			if result != nil {
+				stderr = result.Stderr
+			}
+			s.logger.Error("Annotation overview generation failed",
+				"fileID", file.ID,
+				"stderr", stderr,
+				"error", err)
+			return nil, "", err
+		}
+
+		info, err := processors.ReadImageConfig(basePath)
+		if err != nil {
+			return nil, "", err
+		}
+
+		transform = processors.OverlayTransform{
+			Scale: float64(info.Width) / float64(file.WidthValue()),
+		}
+		relPath = filepath.Join("annotations", "annotated_overview.png")
+	}
+
+	outputFilePath := workspace.Join(relPath)
+	if err := s.overlayProcessor.Render(ctx, basePath, outputFilePath, annotations.Shapes, transform); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.applyWatermark(ctx, outputFilePath, 100); err != nil {
+		return nil, "", err
+	}
+
+	remotePath := filepath.Join(file.ID, relPath)
+	if err := s.outputStorage.PutFile(ctx, outputFilePath, remotePath); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to copy annotation render to storage").
+			WithContext("local_path", outputFilePath).
+			WithContext("remote_path", remotePath)
+	}
+
+	s.logger.Info("Annotation rendering succeeded",
+		"fileID", file.ID,
+		"outputFile", outputFilePath)
+
+	return workspace, relPath, nil
+}
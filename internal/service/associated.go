@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const (
+	associatedDir      = "associated"
+	associatedManifest = "associated.json"
+)
+
+// unsafeAssociatedName matches the characters of an associated image name that are
+// not kept in its file name
+var unsafeAssociatedName = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ExtractAssociatedImages exports the associated images of a whole-slide image named
+// by ASSOCIATED_IMAGES to associated/<name>.png and lists them in associated.json.
+// Slides without any of them get an empty manifest, other formats none.
+func (s *ImageProcessingService) ExtractAssociatedImages(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	if !processors.IsWholeSlideFormat(file.Extension()) {
+		return nil
+	}
+
+	slide, err := s.fileInfoProcessor.GetSlideProperties(ctx, file.AbsolutePath())
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(s.config.AssociatedImages.Names))
+	for _, name := range s.config.AssociatedImages.Names {
+		wanted[name] = true
+	}
+
+	manifest := model.AssociatedManifest{Images: []model.AssociatedImage{}}
+	for _, associated := range slide.Associated {
+		if !wanted[associated.Name] {
+			continue
+		}
+
+		relPath := path.Join(associatedDir, unsafeAssociatedName.ReplaceAllString(associated.Name, "_")+".png")
+		outputFilePath := workspace.Join(relPath)
+		result, err := s.vipsProcessor.ExtractAssociated(ctx, file.AbsolutePath(), associated.Name, outputFilePath,
+			s.config.ImageProcessTimeoutMinute.General)
+		if err != nil {
+			stderr := ""
+			if result != nil {
+				stderr = result.Stderr
+			}
+			s.logger.Error("Associated image extraction failed",
+				"fileID", file.ID,
+				"associated", associated.Name,
+				"stderr", stderr,
+				"error", err)
+			return err
+		}
+
+		info, err := os.Stat(outputFilePath)
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to stat associated image").
+				WithContext("path", outputFilePath)
+		}
+		manifest.Images = append(manifest.Images, model.AssociatedImage{
+			Name:   associated.Name,
+			Width:  associated.Width,
+			Height: associated.Height,
+			Path:   relPath,
+			Size:   info.Size(),
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode associated images manifest")
+	}
+	if err := os.WriteFile(workspace.Join(associatedManifest), data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write associated images manifest").
+			WithContext("path", workspace.Join(associatedManifest))
+	}
+
+	s.logger.Info("Associated images extracted",
+		"fileID", file.ID,
+		"count", len(manifest.Images))
+	return nil
+}
+
+// readAssociatedImages lists the associated images in the associated.json of dir with
+// their paths under outputPath; nil when dir has no manifest
+func readAssociatedImages(dir, outputPath string) ([]model.AssociatedImage, error) {
+	data, err := os.ReadFile(filepath.Join(dir, associatedManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to read associated images manifest").
+			WithContext("dir", dir)
+	}
+
+	var manifest model.AssociatedManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.WrapProcessingError(err, "invalid associated images manifest").
+			WithContext("dir", dir)
+	}
+	for i := range manifest.Images {
+		manifest.Images[i].Path = filepath.Join(outputPath, manifest.Images[i].Path)
+	}
+	return manifest.Images, nil
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const mappedSourceFilename = "source_mapped.v"
+
+var channelColors = map[string][3]uint8{
+	"gray":    {255, 255, 255},
+	"white":   {255, 255, 255},
+	"red":     {255, 0, 0},
+	"green":   {0, 255, 0},
+	"blue":    {0, 0, 255},
+	"cyan":    {0, 255, 255},
+	"magenta": {255, 0, 255},
+	"yellow":  {255, 255, 0},
+}
+
+// classifyBands reports whether the image is single-channel (optionally with
+// alpha), multi-channel fluorescence and 8 bits per sample
+func classifyBands(info *processors.BandInfo) (single, multi, eightBit bool) {
+	eightBit = info.Format == "uchar" || info.Format == "char"
+	single = info.Bands == 1 || (info.Bands == 2 && info.Interpretation != "multiband")
+	multi = info.Interpretation == "multiband" || info.Bands > 4
+	return single, multi, eightBit
+}
+
+// MapChannels detects single-channel and multi-channel (fluorescence) inputs and
+// maps them to 8-bit gray or pseudo-colored RGB. When a mapping is applied the
+// result becomes the workspace source for thumbnails, stats and tiles.
+func (s *ImageProcessingService) MapChannels(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	// Whole-slide formats are read through OpenSlide, which always yields 8-bit RGBA
+	if processors.IsWholeSlideFormat(file.Extension()) {
+		return nil
+	}
+
+	cfg := s.config.ChannelConfig
+	inputFilePath := s.sourcePath(file, workspace)
+
+	info, err := s.vipsProcessor.GetBandInfo(ctx, inputFilePath)
+	if err != nil {
+		return err
+	}
+
+	single, multi, eightBit := classifyBands(info)
+
+	if !single && !multi && (eightBit || !cfg.Rescale) {
+		return nil
+	}
+
+	s.logger.Info("Mapping image channels",
+		"fileID", file.ID,
+		"bands", info.Bands,
+		"format", info.Format,
+		"interpretation", info.Interpretation)
+
+	timeout := s.config.ImageProcessTimeoutMinute.FormatConversion
+	outputFilePath := workspace.Join(mappedSourceFilename)
+	scratch := make([]string, 0)
+	defer func() {
+		for _, path := range scratch {
+			os.Remove(path)
+		}
+	}()
+	tmp := func(name string) string {
+		path := workspace.Join("channels", name)
+		scratch = append(scratch, path)
+		return path
+	}
+
+	switch {
+	case single:
+		band := inputFilePath
+		if info.Bands == 2 {
+			// Drop the alpha band of gray+alpha inputs
+			band = tmp("band0.v")
+			if _, err := s.vipsProcessor.ExtractBand(ctx, inputFilePath, band, 0, timeout); err != nil {
+				return err
+			}
+		}
+		if cfg.Rescale && !eightBit {
+			scaled := tmp("scaled.v")
+			if _, err := s.vipsProcessor.ScaleToUchar(ctx, band, scaled, timeout); err != nil {
+				return err
+			}
+			band = scaled
+		}
+
+		lut := strings.ToLower(cfg.LUT)
+		if lut == "" || lut == "gray" || lut == "grey" {
+			if band == inputFilePath {
+				// 8-bit gray needs no mapping
+				return nil
+			}
+			if _, err := s.vipsProcessor.ConvertImage(ctx, band, outputFilePath, timeout); err != nil {
+				return err
+			}
+			break
+		}
+
+		rgb, err := parseChannelColor(lut)
+		if err != nil {
+			return errors.WrapConfigurationError(err, "invalid CHANNEL_LUT").
+				WithContext("lut", cfg.LUT)
+		}
+		if _, err := s.vipsProcessor.Tint(ctx, band, outputFilePath, rgb, true, timeout); err != nil {
+			return err
+		}
+
+	case multi:
+		if len(cfg.Colors) == 0 {
+			return errors.NewConfigurationError("CHANNEL_COLORS is empty, cannot map multi-channel image").
+				WithContext("fileID", file.ID)
+		}
+
+		bands := min(info.Bands, len(cfg.Colors))
+		if bands < info.Bands {
+			s.logger.Warn("More channels than configured colors, extra channels are dropped",
+				"fileID", file.ID,
+				"bands", info.Bands,
+				"colors", len(cfg.Colors))
+		}
+
+		tinted := make([]string, 0, bands)
+		for i := 0; i < bands; i++ {
+			rgb, err := parseChannelColor(cfg.Colors[i])
+			if err != nil {
+				return errors.WrapConfigurationError(err, "invalid CHANNEL_COLORS entry").
+					WithContext("band", i).
+					WithContext("color", cfg.Colors[i])
+			}
+
+			band := tmp(fmt.Sprintf("band%d.v", i))
+			if _, err := s.vipsProcessor.ExtractBand(ctx, inputFilePath, band, i, timeout); err != nil {
+				return err
+			}
+			if cfg.Rescale {
+				scaled := tmp(fmt.Sprintf("band%d_scaled.v", i))
+				if _, err := s.vipsProcessor.ScaleToUchar(ctx, band, scaled, timeout); err != nil {
+					return err
+				}
+				band = scaled
+			}
+
+			colored := tmp(fmt.Sprintf("band%d_tinted.v", i))
+			if _, err := s.vipsProcessor.Tint(ctx, band, colored, rgb, false, timeout); err != nil {
+				return err
+			}
+			tinted = append(tinted, colored)
+		}
+
+		if _, err := s.vipsProcessor.Composite(ctx, tinted, outputFilePath, timeout); err != nil {
+			return err
+		}
+
+	default:
+		// Multi-band RGB with more than 8 bits per sample
+		if _, err := s.vipsProcessor.ScaleToUchar(ctx, inputFilePath, outputFilePath, timeout); err != nil {
+			return err
+		}
+	}
+
+	os.RemoveAll(workspace.Join("channels"))
+	workspace.SetSource(outputFilePath)
+
+	s.logger.Info("Channel mapping succeeded",
+		"fileID", file.ID,
+		"outputFile", outputFilePath)
+
+	return nil
+}
+
+// parseChannelColor accepts a color name from channelColors or #rrggbb
+func parseChannelColor(value string) ([3]uint8, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if rgb, ok := channelColors[value]; ok {
+		return rgb, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 {
+		return [3]uint8{}, fmt.Errorf("unknown color %q", value)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]uint8{}, fmt.Errorf("invalid hex color %q: %w", value, err)
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
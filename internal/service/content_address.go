@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// originalDir holds the copy of the original in content-addressed outputs
+const originalDir = "original"
+
+// contentAddressedPath is the output path of the outputs of an original with checksum
+func (o *JobOrchestrator) contentAddressedPath(checksum string) string {
+	rel := path.Join(o.config.ContentAddress.Prefix, checksum)
+	if o.config.UsesGCS() {
+		return rel
+	}
+	return filepath.Join(o.constructOutputPath(""), rel)
+}
+
+// mountedOutputPath is where outputPath is visible on the output mount
+func (o *JobOrchestrator) mountedOutputPath(outputPath string) string {
+	if o.config.UsesGCS() {
+		return filepath.Join(o.config.Storage.OutputMountPath, outputPath)
+	}
+	return outputPath
+}
+
+// storedOutputs returns the record of imageID, nil without one, and the prefix of its
+// outputs on the output storage. Content-addressed outputs are under the checksum of
+// their original, so the prefix is where the record says they were written, and
+// <image-id> for images without a record or result.
+func (o *JobOrchestrator) storedOutputs(ctx context.Context, imageID string) (string, *model.ImageRecord, error) {
+	if o.images == nil {
+		return imageID, nil, nil
+	}
+	record, err := o.images.GetByID(ctx, imageID)
+	if errors.Is(err, errors.ErrorTypeNotFound) {
+		return imageID, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if record.Result == nil || record.Result.OutputPath == "" {
+		return imageID, record, nil
+	}
+	outputPath := record.Result.OutputPath
+	if o.config.UsesGCS() {
+		return outputPath, record, nil
+	}
+	// Local results are absolute paths below the output mount
+	rel, err := filepath.Rel(o.config.Storage.OutputMountPath, outputPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return imageID, record, nil
+	}
+	return rel, record, nil
+}
+
+// sharingImages lists the other images whose records use the outputs of record,
+// sorted: images of the same original sharing content-addressed outputs, and
+// duplicates pointing at the outputs of the image they duplicate.
+func (o *JobOrchestrator) sharingImages(ctx context.Context, record *model.ImageRecord) ([]string, error) {
+	if o.images == nil || record == nil || record.Result == nil || record.Result.OutputPath == "" {
+		return nil, nil
+	}
+	records, err := o.images.FindByOutputPath(ctx, record.Result.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+	var imageIDs []string
+	for _, r := range records {
+		if r.ImageID != record.ImageID && usesOutputs(r.Status) {
+			imageIDs = append(imageIDs, r.ImageID)
+		}
+	}
+	sort.Strings(imageIDs)
+	return imageIDs, nil
+}
+
+// usesOutputs reports whether a record in status still points clients at its outputs
+func usesOutputs(status vobj.ImageStatus) bool {
+	return status == vobj.StatusProcessed || status == vobj.StatusPendingReview || status == vobj.StatusDuplicate
+}
+
+// recordChecksum stores the ImageID to checksum mapping on the record of input. Like
+// processedRecord it runs only with CHECKSUM_DEDUP or CONTENT_ADDRESSED_OUTPUTS, which
+// container.New refuses without an image repository.
+func (o *JobOrchestrator) recordChecksum(ctx context.Context, input *model.JobInput, checksum string) {
+	err := o.images.UpdateStatus(ctx, input.ImageID, model.ImageStatusUpdate{
+		Status:    vobj.StatusProcessing,
+		Checksum:  checksum,
+		UpdatedAt: o.clock.Now(),
+	})
+	if err != nil {
+		o.logger.Warn("Failed to store image checksum",
+			"imageID", input.ImageID,
+			"sha256", checksum,
+			"error", err)
+	}
+}
+
+// processedContent finds earlier outputs of the same original at outputPath. It
+// returns the record they were produced for and the contents of input pointing at
+// them, or nil when the original has to be processed: no record, a different
+// processing or pipeline version, or outputs that are no longer complete.
+func (o *JobOrchestrator) processedContent(ctx context.Context, input *model.JobInput, checksum, outputPath string) (*model.ImageRecord, []*model.Content) {
+	record := o.processedRecord(ctx, input, checksum)
+	if record == nil || record.Result.OutputPath != outputPath || record.ProcessingVersion != input.ProcessingVersion ||
+		record.PipelineVersion != o.imageProcessingService.PipelineVersion(ctx) {
+		return nil, nil
+	}
+	contents := o.recordContents(input, record)
+	if contents == nil {
+		return nil, nil
+	}
+	return record, contents
+}
+
+// processedRecord is the latest processed record of the original with checksum, nil
+// when there is none
+func (o *JobOrchestrator) processedRecord(ctx context.Context, input *model.JobInput, checksum string) *model.ImageRecord {
+	record, err := o.images.FindByChecksum(ctx, checksum)
+	if err != nil {
+		if !errors.Is(err, errors.ErrorTypeNotFound) {
+			o.logger.Warn("Failed to look up outputs by checksum", "imageID", input.ImageID, "error", err)
+		}
+		return nil
+	}
+	if record.Result == nil {
+		return nil
+	}
+	return record
+}
+
+// recordContents returns the contents of input pointing at the outputs of record, nil
+// when they are no longer complete and the original has to be processed again
+func (o *JobOrchestrator) recordContents(input *model.JobInput, record *model.ImageRecord) []*model.Content {
+	outputPath := record.Result.OutputPath
+	contents, err := o.prepareContents(input, o.mountedOutputPath(outputPath), outputPath, o.contentProvider())
+	if err != nil {
+		o.logger.Warn("Stored outputs are incomplete, processing again",
+			"imageID", input.ImageID,
+			"processedFor", record.ImageID,
+			"outputPath", outputPath,
+			"error", err)
+		return nil
+	}
+	return contents
+}
+
+// storeOriginal copies the original into the outputs in workspaceDir, so it is
+// uploaded with them under the content-addressed path
+func (o *JobOrchestrator) storeOriginal(ctx context.Context, input *model.JobInput, workspaceDir string) error {
+	if o.inputStorage == nil {
+		return errors.NewConfigurationError("no input storage to copy the original from")
+	}
+	dir := filepath.Join(workspaceDir, originalDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.WrapStorageError(err, "failed to create original directory").
+			WithContext("dir", dir)
+	}
+	return o.inputStorage.CopyToLocal(ctx, input.OriginPath, filepath.Join(dir, filepath.Base(input.OriginPath)))
+}
+
+// completeFromRecord completes input with the outputs processed for record, without
+// processing or uploading anything. status is processed for reused content-addressed
+// outputs, duplicate for a duplicate of the image duplicateOf.
+func (o *JobOrchestrator) completeFromRecord(ctx context.Context, input *model.JobInput, baseEvent events.BaseEvent, record *model.ImageRecord, contents []*model.Content, status vobj.ImageStatus, duplicateOf string) error {
+	o.logger.Info("Completing from stored outputs",
+		"imageID", input.ImageID,
+		"status", status,
+		"processedFor", record.ImageID,
+		"sha256", record.Checksum,
+		"outputPath", record.Result.OutputPath,
+	)
+
+	var eventContents []model.Content
+	for _, c := range contents {
+		eventContents = append(eventContents, *c)
+	}
+
+	associated, err := readAssociatedImages(o.mountedOutputPath(record.Result.OutputPath), record.Result.OutputPath)
+	if err != nil {
+		o.logger.Warn("Failed to list associated images", "imageID", input.ImageID, "error", err)
+	}
+	qc, err := readQC(o.mountedOutputPath(record.Result.OutputPath))
+	if err != nil {
+		o.logger.Warn("Failed to read QC verdict", "imageID", input.ImageID, "error", err)
+	}
+
+	o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
+		BaseEvent:         baseEvent,
+		ImageID:           input.ImageID,
+		ProcessingVersion: input.ProcessingVersion,
+		PipelineVersion:   record.PipelineVersion,
+		Success:           true,
+		Status:            status,
+		DuplicateOf:       duplicateOf,
+		Contents:          eventContents,
+		Outputs:           outputURIs(contents),
+		AssociatedImages:  associated,
+		QC:                qc,
+		Metadata:          input.Metadata,
+		Result: &events.ProcessResult{
+			Width:  record.Result.Width,
+			Height: record.Result.Height,
+			Size:   record.Result.Size,
+			Levels: record.Result.Levels,
+		},
+	})
+
+	result := *record.Result
+	result.Contents = nil
+	for _, content := range contents {
+		result.Contents = append(result.Contents, content.Path)
+	}
+	o.recordStatus(ctx, input, status, "", &result)
+	return nil
+}
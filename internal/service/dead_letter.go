@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/logger"
+	"github.com/histopathai/image-processing-service/pkg/retry"
+)
+
+// ErrDeadLettered marks a job whose image was failed permanently: the failure event
+// says so and the request was published to the dead letter topic. The job should end
+// without an error exit, so Cloud Run does not run the poison image again.
+var ErrDeadLettered = stderrors.New("image failed permanently and was dead-lettered")
+
+// attempt is the 1-based Cloud Run task attempt of this job, the counterpart of a
+// Pub/Sub delivery attempt
+func (o *JobOrchestrator) attempt() int {
+	return o.config.TaskAttempt + 1
+}
+
+// finalAttempt reports whether a failure of this attempt fails the image permanently
+func (o *JobOrchestrator) finalAttempt() bool {
+	maxAttempts := o.config.DeadLetter.MaxAttempts
+	return maxAttempts > 0 && o.attempt() >= maxAttempts
+}
+
+// poisoned reports whether earlier attempts already used up POISON_MAX_ATTEMPTS, which
+// means they ended without a result (the process crashed or was killed)
+func (o *JobOrchestrator) poisoned() bool {
+	maxAttempts := o.config.DeadLetter.MaxAttempts
+	return maxAttempts > 0 && o.attempt() > maxAttempts
+}
+
+// failImage publishes the failure event of an image processing job and returns err.
+// On the final attempt the image is failed permanently instead: the request is
+// dead-lettered, the event is marked failed_permanent and not retryable, and the
+// returned error wraps ErrDeadLettered. Permanent failures are quarantined first.
+func (o *JobOrchestrator) failImage(ctx context.Context, input *model.JobInput, baseEvent events.BaseEvent, reason string, retryable bool, err error) error {
+	event := &events.ImageProcessCompleteEvent{
+		BaseEvent:           baseEvent,
+		ImageID:             input.ImageID,
+		ProcessingVersion:   input.ProcessingVersion,
+		Success:             false,
+		Status:              vobj.StatusFailed,
+		FailureReason:       reason,
+		Retryable:           retryable,
+		SuggestedWorkerType: string(o.suggestWorkerType(err)),
+		FailureCode:         failureCode(err),
+		Failure:             o.failureDetail(err),
+		Metadata:            input.Metadata,
+	}
+	if !retryable {
+		event.Status = vobj.StatusFailedPermanent
+	}
+	if !o.finalAttempt() {
+		o.quarantine(ctx, input, event, err)
+		o.recordStatus(ctx, input, event.Status, reason, nil)
+		o.publishEvent(ctx, event)
+		return err
+	}
+
+	// Dead-letter first: without the copy of the request, failing again is the only
+	// way not to lose the image
+	if dlqErr := o.deadLetter(ctx, input, reason); dlqErr != nil {
+		o.logger.Error("Failed to dead-letter image",
+			"imageID", input.ImageID,
+			"topic", o.config.DeadLetter.TopicID,
+			"error", dlqErr,
+		)
+		o.quarantine(ctx, input, event, err)
+		o.recordStatus(ctx, input, event.Status, reason, nil)
+		o.publishEvent(ctx, event)
+		return err
+	}
+
+	event.Status = vobj.StatusFailedPermanent
+	event.Retryable = false
+	o.quarantine(ctx, input, event, err)
+	o.recordStatus(ctx, input, event.Status, reason, nil)
+	o.publishEvent(ctx, event)
+
+	o.logger.Error("Image failed permanently",
+		"imageID", input.ImageID,
+		"attempt", o.attempt(),
+		"maxAttempts", o.config.DeadLetter.MaxAttempts,
+		"topic", o.config.DeadLetter.TopicID,
+		"reason", reason,
+	)
+	return fmt.Errorf("%w: %w", ErrDeadLettered, err)
+}
+
+// deadLetter publishes the request of the job to the dead letter topic, from where it
+// can be inspected and replayed (himgproc replay) once the cause is fixed
+func (o *JobOrchestrator) deadLetter(ctx context.Context, input *model.JobInput, reason string) error {
+	request := &events.ImageProcessRequestEvent{
+		BaseEvent:         events.NewBaseEventWith(events.ImageProcessRequestEventType, o.clock, o.ids),
+		ImageID:           input.ImageID,
+		OriginPath:        input.OriginPath,
+		ProcessingVersion: input.ProcessingVersion,
+		BucketName:        input.BucketName(),
+		Tenant:            input.Tenant,
+		Metadata:          input.Metadata,
+		FailureReason:     reason,
+	}
+	// A replay continues the chain of the request that failed
+	request.CausedBy(input.RequestEventID, input.CorrelationID)
+	data, err := o.eventSerializer.Serialize(request)
+	if err != nil {
+		return fmt.Errorf("failed to serialize dead letter request: %w", err)
+	}
+
+	attributes := map[string]string{
+		"event_type":     string(request.GetEventType()),
+		"image_id":       input.ImageID,
+		"failure_reason": excerptTail(reason, failureReasonAttributeBytes),
+		"attempts":       strconv.Itoa(o.attempt()),
+	}
+	if input.Tenant != "" {
+		attributes["tenant"] = input.Tenant
+	}
+	if request.CorrelationID != "" {
+		attributes["correlation_id"] = request.CorrelationID
+	}
+	ctx, cancel := deadline.Reserved(retry.WithoutBudget(ctx))
+	defer cancel()
+	return o.publisher.Publish(ctx, o.config.DeadLetter.TopicID, data, attributes)
+}
+
+// suggestedWorkerTypeKey is the error context key of the worker type an input
+// rejected as too large for this worker should be run on
+const suggestedWorkerTypeKey = "suggested_worker_type"
+
+// suggestWorkerType returns the larger worker type to run a failed job on when it ran
+// out of disk space, its command was killed (exit 137, most likely by the OOM killer)
+// or its input or workspace was too large. GCS quota errors are not about the worker and
+// get no suggestion.
+func (o *JobOrchestrator) suggestWorkerType(err error) config.WorkerType {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		if suggested, ok := appErr.Context[suggestedWorkerTypeKey].(string); ok {
+			return config.WorkerType(suggested)
+		}
+	}
+	if !errors.HasType(err, errors.ErrorTypeDiskFull) && !killedCommand(err) {
+		return ""
+	}
+	return o.config.WorkerType.Larger()
+}
+
+// failureCode returns the FailureCode of the failure event for err
+func failureCode(err error) string {
+	if errors.HasType(err, errors.ErrorTypeCorruptInput) {
+		return events.FailureCodeCorruptInput
+	}
+	return ""
+}
+
+const (
+	// stderrExcerptBytes is how much of the end of a command's stderr a failure event
+	// carries; the error is usually in the last lines
+	stderrExcerptBytes = 2048
+	// failureContextValueBytes caps the other context values of a failure event
+	failureContextValueBytes = 512
+	// failureReasonAttributeBytes keeps the failure_reason attribute of a dead letter,
+	// with the "..." of a cut, within the 1024 bytes Pub/Sub allows for a value; the
+	// payload carries the full reason
+	failureReasonAttributeBytes = 1024 - len("...")
+)
+
+// failureDetail is the structured form of err for the failure event, nil when err is
+// not an AppError. Context values set closer to the failure win over the same key set
+// further out; sensitive keys are redacted like in the logs.
+func (o *JobOrchestrator) failureDetail(err error) *events.FailureDetail {
+	chain := errors.Chain(err)
+	if len(chain) == 0 {
+		return nil
+	}
+	detail := &events.FailureDetail{Type: string(chain[0].Type)}
+	// Wrapping with the same type adds nothing a dispatcher can decide on
+	previous := chain[0].Type
+	for _, cause := range chain[1:] {
+		if cause.Type != previous {
+			detail.Causes = append(detail.Causes, string(cause.Type))
+		}
+		previous = cause.Type
+	}
+
+	fields := make(map[string]any)
+	for _, appErr := range chain {
+		for key, value := range appErr.Context {
+			if key == "stderr" {
+				if stderr, ok := value.(string); ok {
+					detail.Stderr = excerptTail(stderr, stderrExcerptBytes)
+				}
+				continue
+			}
+			fields[key] = failureContextValue(value)
+		}
+	}
+	if len(fields) > 0 {
+		detail.Context = logger.RedactMap(fields, o.config.Logging.RedactKeys)
+	}
+	return detail
+}
+
+// failureContextValue keeps JSON scalars and turns anything else into its string form
+func failureContextValue(value any) any {
+	switch v := value.(type) {
+	case nil, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	case string:
+		return excerptTail(v, failureContextValueBytes)
+	case error:
+		return excerptTail(v.Error(), failureContextValueBytes)
+	default:
+		return excerptTail(fmt.Sprint(v), failureContextValueBytes)
+	}
+}
+
+// excerptTail returns the last max bytes of s, cut at a rune boundary
+func excerptTail(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return "..." + s
+}
+
+// killedCommand reports whether err comes from an external command killed with SIGKILL
+func killedCommand(err error) bool {
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) {
+		return false
+	}
+	exitCode, _ := appErr.Context["exit_code"].(int)
+	return appErr.Type == errors.ErrorTypeProcessing && exitCode == 137
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// deletionMarkerName is written into the output directory of a soft-deleted image
+const deletionMarkerName = ".deleted.json"
+
+// DeletionMarker records when the deletion of an image was requested
+type DeletionMarker struct {
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
+
+// DeletionResult is the outcome of DeleteOutputs
+type DeletionResult struct {
+	Purged     bool // The outputs were removed, not only marked
+	DeletedAt  time.Time
+	PurgeAfter time.Time
+}
+
+// DeleteOutputs removes the published outputs (tiles or image.zip, thumbnail, ...) of
+// an image, under prefix on the output storage. With a retention window the first request only writes a deletion marker;
+// a request after the window removes the outputs, one within it changes nothing.
+func (s *ImageProcessingService) DeleteOutputs(ctx context.Context, imageID, prefix string, retention time.Duration) (*DeletionResult, error) {
+	dir := filepath.Join(s.config.Storage.OutputMountPath, prefix)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewNotFoundError("image outputs").WithContext("imageID", imageID)
+		}
+		return nil, errors.WrapStorageError(err, "failed to stat image outputs").
+			WithContext("imageID", imageID)
+	}
+
+	now := s.clock.Now()
+	markerPath := filepath.Join(dir, deletionMarkerName)
+	marker := DeletionMarker{DeletedAt: now, PurgeAfter: now.Add(retention)}
+	if existing, err := readDeletionMarker(dir); err != nil {
+		return nil, err
+	} else if existing != nil {
+		marker = *existing
+	} else if retention > 0 {
+		data, err := json.MarshalIndent(marker, "", "  ")
+		if err != nil {
+			return nil, errors.WrapInternalError(err, "failed to encode deletion marker")
+		}
+		if err := os.WriteFile(markerPath, data, 0644); err != nil {
+			return nil, errors.WrapStorageError(err, "failed to write deletion marker").
+				WithContext("file", markerPath)
+		}
+		s.logger.Info("Image marked for deletion",
+			"imageID", imageID,
+			"purgeAfter", marker.PurgeAfter)
+	}
+
+	result := &DeletionResult{DeletedAt: marker.DeletedAt, PurgeAfter: marker.PurgeAfter}
+	if now.Before(marker.PurgeAfter) {
+		return result, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, errors.ErrorTypeCancellation, "deletion canceled")
+	}
+	if err := s.outputStorage.Delete(ctx, prefix); err != nil {
+		return nil, err
+	}
+	s.logger.Info("Image outputs deleted", "imageID", imageID)
+	result.Purged = true
+	return result, nil
+}
+
+// readDeletionMarker reads the deletion marker in dir, nil when there is none
+func readDeletionMarker(dir string) (*DeletionMarker, error) {
+	markerPath := filepath.Join(dir, deletionMarkerName)
+	data, err := os.ReadFile(markerPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to read deletion marker").
+			WithContext("file", markerPath)
+	}
+	var marker DeletionMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return nil, errors.WrapStorageError(err, "invalid deletion marker").
+			WithContext("file", markerPath)
+	}
+	return &marker, nil
+}
+
+// PurgeResult lists what PurgeDeleted removed (or would remove)
+type PurgeResult struct {
+	Root    string   `json:"root"`
+	Purged  []string `json:"purged"`
+	Pending int      `json:"pending"`
+	Failed  []string `json:"failed,omitempty"`
+}
+
+// PurgeDeleted removes the outputs whose deletion marker is past its PurgeAfter.
+// DeleteOutputs only purges when the deletion is requested again, so without this
+// sweep the outputs of images deleted within DELETE_RETENTION_HOURS would stay. The
+// image directories of the output mount are scanned, and the content-addressed ones
+// under CONTENT_ADDRESS_PREFIX. With dryRun nothing is removed.
+func (s *ImageProcessingService) PurgeDeleted(ctx context.Context, dryRun bool) (*PurgeResult, error) {
+	root := s.config.Storage.OutputMountPath
+	prefixes, err := outputPrefixes(root, "")
+	if err != nil {
+		return nil, err
+	}
+	if contentPrefix := s.config.ContentAddress.Prefix; contentPrefix != "" {
+		content, err := outputPrefixes(root, contentPrefix)
+		if err != nil && !errors.Is(err, errors.ErrorTypeNotFound) {
+			return nil, err
+		}
+		prefixes = append(prefixes, content...)
+	}
+
+	result := &PurgeResult{Root: root}
+	now := s.clock.Now()
+	for _, prefix := range prefixes {
+		if err := deadline.Err(ctx, "deleted output purge"); err != nil {
+			return nil, err
+		}
+		marker, err := readDeletionMarker(filepath.Join(root, prefix))
+		if err != nil {
+			s.logger.Warn("Skipping unreadable deletion marker",
+				"prefix", prefix,
+				"error", err)
+			result.Failed = append(result.Failed, prefix)
+			continue
+		}
+		if marker == nil {
+			continue
+		}
+		if now.Before(marker.PurgeAfter) {
+			result.Pending++
+			continue
+		}
+
+		if !dryRun {
+			if err := s.outputStorage.Delete(ctx, prefix); err != nil {
+				s.logger.Warn("Failed to purge deleted outputs",
+					"prefix", prefix,
+					"error", err)
+				result.Failed = append(result.Failed, prefix)
+				continue
+			}
+		}
+		result.Purged = append(result.Purged, prefix)
+	}
+
+	if len(result.Purged) > 0 || len(result.Failed) > 0 {
+		s.logger.Info("Purged deleted outputs",
+			"root", root,
+			"purged", len(result.Purged),
+			"failed", len(result.Failed),
+			"pending", result.Pending,
+			"dryRun", dryRun)
+	}
+	return result, nil
+}
+
+// outputPrefixes lists the directories under root/parent as prefixes relative to root
+func outputPrefixes(root, parent string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, parent))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.WrapNotFoundError(err, "output directory").
+				WithContext("dir", filepath.Join(root, parent))
+		}
+		return nil, errors.WrapStorageError(err, "failed to list output directory").
+			WithContext("dir", filepath.Join(root, parent))
+	}
+	var prefixes []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			prefixes = append(prefixes, filepath.Join(parent, entry.Name()))
+		}
+	}
+	return prefixes, nil
+}
+
+// deleteImage deletes (or, within DELETE_RETENTION_HOURS, marks) the outputs of an
+// image, tombstones its record with the deleting status and publishes image.deleted
+func (o *JobOrchestrator) deleteImage(ctx context.Context, input *model.JobInput) error {
+	o.logger.Info("Starting image deletion job", "imageID", input.ImageID)
+
+	baseEvent := o.newEvent(events.ImageDeletedEventType, input)
+	prefix, record, err := o.storedOutputs(ctx, input.ImageID)
+	var shared []string
+	if err == nil {
+		shared, err = o.sharingImages(ctx, record)
+	}
+	if err != nil {
+		o.publishEvent(ctx, &events.ImageDeletedEvent{
+			BaseEvent:     baseEvent,
+			ImageID:       input.ImageID,
+			Success:       false,
+			FailureReason: err.Error(),
+			Retryable:     !errors.IsNonRetryable(err),
+		})
+		return err
+	}
+
+	// Content-addressed outputs other images still use are kept; the last image to be
+	// deleted removes them
+	if len(shared) > 0 {
+		o.logger.Info("Image outputs are shared, keeping them",
+			"imageID", input.ImageID,
+			"prefix", prefix,
+			"sharedWith", shared)
+		o.recordStatus(ctx, input, vobj.StatusDeleting, "", nil)
+		deletedAt := o.clock.Now()
+		o.publishEvent(ctx, &events.ImageDeletedEvent{
+			BaseEvent:  baseEvent,
+			ImageID:    input.ImageID,
+			Success:    true,
+			DeletedAt:  &deletedAt,
+			SharedWith: shared,
+		})
+		return nil
+	}
+
+	result, err := o.imageProcessingService.DeleteOutputs(ctx, input.ImageID, prefix, o.config.Deletion.Retention)
+	if err != nil {
+		o.publishEvent(ctx, &events.ImageDeletedEvent{
+			BaseEvent:     baseEvent,
+			ImageID:       input.ImageID,
+			Success:       false,
+			FailureReason: err.Error(),
+			Retryable:     !errors.IsNonRetryable(err),
+		})
+		return err
+	}
+
+	o.recordStatus(ctx, input, vobj.StatusDeleting, "", nil)
+
+	event := &events.ImageDeletedEvent{
+		BaseEvent: baseEvent,
+		ImageID:   input.ImageID,
+		Success:   true,
+		Purged:    result.Purged,
+		DeletedAt: &result.DeletedAt,
+	}
+	if !result.Purged {
+		event.PurgeAfter = &result.PurgeAfter
+	}
+	o.publishEvent(ctx, event)
+
+	o.logger.Info("Image deletion job completed successfully",
+		"imageID", input.ImageID,
+		"purged", result.Purged,
+	)
+	return nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/infrastructure/clock"
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	for _, prefix := range []string{"img-1", "img-2", "img-kept", filepath.Join("content", "abc")} {
+		if err := os.MkdirAll(filepath.Join(root, prefix), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{
+		Storage:        config.StorageConfig{OutputMountPath: root},
+		ContentAddress: config.ContentAddressConfig{Prefix: "content"},
+	}
+	output := &recordingStorage{}
+	s := NewImageProcessingService(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg, nil, output)
+	now := clock.NewFixed(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), 0)
+	s.SetClock(now)
+
+	retention := 24 * time.Hour
+	for _, prefix := range []string{"img-1", filepath.Join("content", "abc")} {
+		if _, err := s.DeleteOutputs(ctx, prefix, prefix, retention); err != nil {
+			t.Fatalf("DeleteOutputs %s: %v", prefix, err)
+		}
+	}
+	now.Advance(12 * time.Hour)
+	if _, err := s.DeleteOutputs(ctx, "img-2", "img-2", retention); err != nil {
+		t.Fatalf("DeleteOutputs img-2: %v", err)
+	}
+
+	purge := func(dryRun bool) *PurgeResult {
+		t.Helper()
+		result, err := s.PurgeDeleted(ctx, dryRun)
+		if err != nil {
+			t.Fatalf("PurgeDeleted: %v", err)
+		}
+		return result
+	}
+
+	if result := purge(false); len(result.Purged) > 0 || result.Pending != 3 {
+		t.Errorf("within the retention window: purged %v, %d pending, want none purged and 3 pending", result.Purged, result.Pending)
+	}
+
+	now.Advance(12 * time.Hour)
+	want := []string{"img-1", filepath.Join("content", "abc")}
+	if result := purge(true); !reflect.DeepEqual(result.Purged, want) || result.Pending != 1 {
+		t.Errorf("dry run: purged %v, %d pending, want %v and 1 pending", result.Purged, result.Pending, want)
+	}
+	if deleted := output.deleted(); len(deleted) > 0 {
+		t.Fatalf("dry run deleted %v", deleted)
+	}
+
+	if result := purge(false); !reflect.DeepEqual(result.Purged, want) {
+		t.Errorf("purged %v, want %v", result.Purged, want)
+	}
+	if deleted := output.deleted(); !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+}
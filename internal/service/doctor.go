@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+	CheckSkip CheckStatus = "skip"
+)
+
+// minVipsMajor and minVipsMinor are the oldest libvips whose dzsave supports every
+// option the service passes (zip container, suffix options, skip-blanks)
+const (
+	minVipsMajor = 8
+	minVipsMinor = 10
+)
+
+// minScratchFreeMB is the free scratch space below which the scratch check warns
+const minScratchFreeMB = 10 * 1024
+
+// DiagnosticCheck is one line of an environment diagnosis
+type DiagnosticCheck struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Detail string      `json:"detail"`
+}
+
+// requiredBinary is an external tool and the arguments that print its version
+type requiredBinary struct {
+	name        string
+	versionArgs []string
+	optional    bool // Only some inputs need it, a missing binary is a warning
+}
+
+var requiredBinaries = []requiredBinary{
+	{name: "vips", versionArgs: []string{"--version"}},
+	{name: "openslide-show-properties", versionArgs: []string{"--version"}},
+	{name: "openslide-write-png", versionArgs: []string{"--version"}},
+	{name: "exiftool", versionArgs: []string{"-ver"}},
+	{name: "dcraw", optional: true},
+}
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// Diagnose checks the local prerequisites of a processing job: external binaries and
+// their versions, scratch disk space and access to the input and output mounts
+func (s *ImageProcessingService) Diagnose(ctx context.Context) []DiagnosticCheck {
+	var checks []DiagnosticCheck
+	for _, binary := range requiredBinaries {
+		checks = append(checks, checkBinary(ctx, binary))
+	}
+	checks = append(checks, checkScratch(s.config.Scratch.Dir))
+	// Inputs read from an SFTP server are not mounted
+	if s.config.Storage.InputReader != config.InputReaderSFTP {
+		checks = append(checks, checkReadable("input mount", s.config.Storage.InputMountPath))
+	}
+	checks = append(checks, checkWritable("output mount", s.config.Storage.OutputMountPath))
+	return checks
+}
+
+func checkBinary(ctx context.Context, binary requiredBinary) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "binary " + binary.name}
+
+	path, err := exec.LookPath(binary.name)
+	if err != nil {
+		check.Status = CheckFail
+		if binary.optional {
+			check.Status = CheckWarn
+		}
+		check.Detail = "not found in PATH"
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = path
+
+	if len(binary.versionArgs) == 0 {
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	// Some tools exit non-zero after printing their version, the output is what counts
+	out, _ := exec.CommandContext(ctx, binary.name, binary.versionArgs...).CombinedOutput()
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if version == "" {
+		check.Status = CheckWarn
+		check.Detail = path + ", version unknown"
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s (%s)", strings.TrimSpace(version), path)
+
+	if binary.name == "vips" && !vipsVersionSupported(version) {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s, need %d.%d or newer", strings.TrimSpace(version), minVipsMajor, minVipsMinor)
+	}
+	return check
+}
+
+func vipsVersionSupported(version string) bool {
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major > minVipsMajor || (major == minVipsMajor && minor >= minVipsMinor)
+}
+
+func checkScratch(dir string) DiagnosticCheck {
+	check := checkWritable("scratch dir", dir)
+	if check.Status != CheckPass {
+		return check
+	}
+
+	free, err := freeDiskBytes(dir)
+	if err != nil {
+		check.Status = CheckWarn
+		check.Detail = fmt.Sprintf("%s, free space unknown: %v", dir, err)
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s, %d MB free", dir, free>>20)
+	if free>>20 < minScratchFreeMB {
+		check.Status = CheckWarn
+		check.Detail += fmt.Sprintf(", large slides need more than %d MB", minScratchFreeMB)
+	}
+	return check
+}
+
+func checkReadable(name, dir string) DiagnosticCheck {
+	check := DiagnosticCheck{Name: name}
+	if _, err := os.ReadDir(dir); err != nil {
+		check.Status = CheckFail
+		check.Detail = err.Error()
+		return check
+	}
+	check.Status = CheckPass
+	check.Detail = dir
+	return check
+}
+
+// checkWritable writes and removes a probe file in dir
+func checkWritable(name, dir string) DiagnosticCheck {
+	check := checkReadable(name, dir)
+	if check.Status != CheckPass {
+		return check
+	}
+
+	probe := filepath.Join(dir, fmt.Sprintf(".himgproc-doctor-%d", time.Now().UnixNano()))
+	if err := os.WriteFile(probe, []byte("ok"), 0644); err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	if err := os.Remove(probe); err != nil {
+		check.Status = CheckWarn
+		check.Detail = fmt.Sprintf("%s, failed to remove probe file: %v", dir, err)
+	}
+	return check
+}
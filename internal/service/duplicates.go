@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+// duplicateOf finds the processed image whose original has checksum, under another
+// image ID, and the contents of input pointing at its outputs. It returns nil when
+// input has to be processed: no such image, a different processing version, or
+// outputs that are no longer complete.
+func (o *JobOrchestrator) duplicateOf(ctx context.Context, input *model.JobInput, checksum string) (*model.ImageRecord, []*model.Content) {
+	record := o.processedRecord(ctx, input, checksum)
+	// Reprocessing the same image is not a duplicate
+	if record == nil || record.ImageID == input.ImageID || record.ProcessingVersion != input.ProcessingVersion {
+		return nil, nil
+	}
+	contents := o.recordContents(input, record)
+	if contents == nil {
+		return nil, nil
+	}
+	return record, contents
+}
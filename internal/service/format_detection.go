@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// tiffBasedFormats are the declared formats whose content is a TIFF. A plain TIFF
+// signature does not contradict them: vendors that sniffing cannot tell apart from
+// plain TIFF are left to the loader of the declared format.
+var tiffBasedFormats = map[string]bool{
+	processors.SniffedTIFF: true,
+	processors.SniffedSVS:  true,
+	processors.SniffedNDPI: true,
+	processors.SniffedSCN:  true,
+	processors.SniffedBIF:  true,
+	processors.SniffedDNG:  true,
+}
+
+// reconcileFormat detects the format of file from its content and, when that
+// contradicts the extension (a .tif that is an Aperio SVS, a .png that is a JPEG),
+// sets it as the format of file so the processor is chosen by the content. It returns
+// the detected format, "" when the content was not recognized; unrecognized content
+// keeps the extension.
+func (s *ImageProcessingService) reconcileFormat(ctx context.Context, file *model.File) (string, error) {
+	sniffed, err := s.sniffInput(ctx, file.AbsolutePath())
+	if err != nil {
+		return "", err
+	}
+
+	declared := declaredFormat(file.Extension())
+	if sniffed == "" || sniffed == declared {
+		return sniffed, nil
+	}
+	// The index file of a multi-file slide is not the slide, the .mrxs of a MIRAX slide
+	// is a JPEG of its overview
+	if processors.IsMultiFileFormat(file.Extension()) {
+		return sniffed, nil
+	}
+	if sniffed == processors.SniffedTIFF && tiffBasedFormats[declared] {
+		return sniffed, nil
+	}
+
+	s.logger.Warn("File content does not match its extension, using the detected format",
+		"fileID", file.ID,
+		"filename", file.Filename,
+		"extension", file.Extension(),
+		"detectedFormat", sniffed)
+	file.SetFormat(sniffed)
+	return sniffed, nil
+}
+
+// declaredFormat maps an extension to the format name SniffFormat reports for it
+func declaredFormat(ext string) string {
+	switch ext {
+	case ".jpg", ".jpeg":
+		return processors.SniffedJPEG
+	case ".tif", ".tiff":
+		return processors.SniffedTIFF
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// sniffInput detects the format of the original at path. An input storage that reads
+// ranges (the GCS API with INPUT_READER=gcs) reads the header without the whole file
+// passing through the mount.
+func (s *ImageProcessingService) sniffInput(ctx context.Context, path string) (string, error) {
+	rs, ok := s.inputStorage.(storage.RangeInputStorage)
+	if !ok {
+		return processors.SniffFormat(path)
+	}
+	reader, err := s.openInputRange(ctx, rs, path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	sniffed, err := processors.SniffFormatAt(reader)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to read file header").
+			WithContext("file", path)
+	}
+	return sniffed, nil
+}
+
+// inputSize returns the size of the original at path
+func (s *ImageProcessingService) inputSize(ctx context.Context, path string) (int64, error) {
+	rs, ok := s.inputStorage.(storage.RangeInputStorage)
+	if !ok {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, errors.WrapStorageError(err, "failed to stat input file").
+				WithContext("path", path)
+		}
+		return info.Size(), nil
+	}
+	reader, err := s.openInputRange(ctx, rs, path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return reader.Size(), nil
+}
+
+// openInputRange opens the original at path, a path on the input mount, through rs
+func (s *ImageProcessingService) openInputRange(ctx context.Context, rs storage.RangeInputStorage, path string) (storage.RangeReader, error) {
+	// The mount path may be relative to the working directory locally
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.WrapValidationError(err, "failed to resolve input path").
+			WithContext("path", path)
+	}
+	return rs.OpenRange(ctx, abs)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// generateOutputs runs the independent generation steps (thumbnail, stats,
+// overviews, DZI, OME-TIFF) concurrently, bounded by the worker profile parallelism.
+// All step failures are returned joined; siblings canceled because of an
+// earlier failure are left out.
+func (s *ImageProcessingService) generateOutputs(ctx context.Context, file *model.File, workspace *model.Workspace, container string, report *model.ProcessingReport) error {
+	parallelism := max(1, s.config.WorkerProfile.Parallelism)
+
+	s.logger.Info("Generating outputs",
+		"fileID", file.ID,
+		"parallelism", parallelism)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+
+	var mu sync.Mutex
+	var failures []error
+
+	run := func(name string, required bool, fn func(context.Context) error) {
+		g.Go(func() error {
+			err := s.runStep(report, name, func() error {
+				return fn(gctx)
+			})
+			if err == nil {
+				return nil
+			}
+			if !required {
+				s.logger.Warn("Optional step failed, continuing without it",
+					"fileID", file.ID,
+					"step", name,
+					"error", err)
+				return nil
+			}
+			if errors.Is(err, errors.ErrorTypeCancellation) && gctx.Err() != nil && ctx.Err() == nil {
+				// Canceled because a sibling failed, that failure is reported instead
+				return err
+			}
+			mu.Lock()
+			failures = append(failures, err)
+			mu.Unlock()
+			return err
+		})
+	}
+
+	// A thumbnail from the pyramid waits for it, below
+	if !s.config.ThumbnailConfig.FromPyramid {
+		run("thumbnail", true, func(ctx context.Context) error {
+			return s.GenerateThumbnail(ctx, file, workspace)
+		})
+	}
+
+	// Stats are a QC aid, a failure here should not fail the whole job
+	if s.config.StatsConfig.Enabled {
+		run("stats", false, func(ctx context.Context) error {
+			return s.GenerateStats(ctx, file, workspace)
+		})
+	} else {
+		s.skipStep(report, "stats")
+	}
+
+	if s.config.OverviewConfig.Enabled {
+		run("overviews", true, func(ctx context.Context) error {
+			return s.GenerateOverviews(ctx, file, workspace)
+		})
+	} else {
+		s.skipStep(report, "overviews")
+	}
+
+	// Associated images are an extra for viewers, their absence should not fail the job
+	if len(s.config.AssociatedImages.Names) > 0 {
+		run("associated_images", false, func(ctx context.Context) error {
+			return s.ExtractAssociatedImages(ctx, file, workspace)
+		})
+	} else {
+		s.skipStep(report, "associated_images")
+	}
+
+	run("dzi", true, func(ctx context.Context) error {
+		return s.GenerateDZI(ctx, file, workspace, container)
+	})
+
+	if s.config.Output.Has(config.OutputFormatOMETIFF) {
+		run("ome_tiff", true, func(ctx context.Context) error {
+			return s.GenerateOMETIFF(ctx, file, workspace)
+		})
+	} else {
+		s.skipStep(report, "ome_tiff")
+	}
+
+	if err := g.Wait(); err != nil {
+		if len(failures) == 1 {
+			return failures[0]
+		}
+		if len(failures) > 1 {
+			return stderrors.Join(failures...)
+		}
+		return err
+	}
+
+	if s.config.ThumbnailConfig.FromPyramid {
+		return s.runStep(report, "thumbnail", func() error {
+			return s.GenerateThumbnailFromPyramid(ctx, file, workspace, container)
+		})
+	}
+	return nil
+}
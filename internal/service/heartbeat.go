@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+)
+
+// SetHeartbeat makes the orchestrator write the heartbeat of every job to store under
+// workerID, at the start of each phase and every interval in between, and remove it
+// when the job ends. A heartbeat that stops being updated belongs to a crashed worker.
+func (o *JobOrchestrator) SetHeartbeat(store port.HeartbeatStore, workerID string, interval time.Duration) {
+	o.heartbeats = store
+	o.workerID = workerID
+	o.heartbeatInterval = interval
+}
+
+type heartbeatKey struct{}
+
+// jobHeartbeat beats for one job until it is stopped
+type jobHeartbeat struct {
+	o    *JobOrchestrator
+	mu   sync.Mutex
+	beat model.Heartbeat
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat writes the first heartbeat of a job and keeps beating in the
+// background. The returned func stops it and removes the heartbeat; ctx carries it to
+// setPhase.
+func (o *JobOrchestrator) startHeartbeat(ctx context.Context, input *model.JobInput) (context.Context, func()) {
+	if o.heartbeats == nil {
+		return ctx, func() {}
+	}
+
+	now := o.clock.Now()
+	h := &jobHeartbeat{
+		o: o,
+		beat: model.Heartbeat{
+			WorkerID:       o.workerID,
+			WorkerType:     string(o.config.WorkerType),
+			Tenant:         input.Tenant,
+			ImageID:        input.ImageID,
+			JobType:        input.JobType,
+			TaskAttempt:    o.config.TaskAttempt,
+			Phase:          model.PhaseStarting,
+			StartedAt:      now,
+			PhaseStartedAt: now,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	h.write(ctx)
+
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(max(o.heartbeatInterval, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.write(ctx)
+			}
+		}
+	}()
+
+	return context.WithValue(ctx, heartbeatKey{}, h), func() {
+		close(h.stop)
+		<-h.done
+
+		// Removed under the reserved time, also after the job ran out of its own
+		clearCtx, cancel := deadline.Reserved(ctx)
+		defer cancel()
+		if err := o.heartbeats.Clear(clearCtx, o.workerID); err != nil {
+			o.logger.Warn("Failed to clear heartbeat", "workerID", o.workerID, "imageID", input.ImageID, "error", err)
+		}
+	}
+}
+
+// setPhase records that the job of ctx entered phase and beats right away
+func (o *JobOrchestrator) setPhase(ctx context.Context, phase string) {
+	h, ok := ctx.Value(heartbeatKey{}).(*jobHeartbeat)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	h.beat.Phase = phase
+	h.beat.PhaseStartedAt = o.clock.Now()
+	h.mu.Unlock()
+	h.write(ctx)
+}
+
+// write stores the current heartbeat. Failures are logged, the job goes on.
+func (h *jobHeartbeat) write(ctx context.Context) {
+	h.mu.Lock()
+	h.beat.UpdatedAt = h.o.clock.Now()
+	beat := h.beat
+	h.mu.Unlock()
+
+	if err := h.o.heartbeats.Beat(ctx, &beat); err != nil {
+		h.o.logger.Warn("Failed to write heartbeat",
+			"workerID", beat.WorkerID,
+			"imageID", beat.ImageID,
+			"phase", beat.Phase,
+			"error", err)
+	}
+}
@@ -5,23 +5,39 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/clock"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/idgen"
 	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
 	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
 	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 type ImageProcessingService struct {
-	logger            *slog.Logger
-	dcrawProcessor    *processors.DcrawProcessor
-	vipsProcessor     *processors.VipsProcessor
-	fileInfoProcessor *processors.ImageInfoProcessor
-	zipProcessor      *processors.ZipProcessor
-	inputStorage      storage.InputStorage
-	outputStorage     storage.OutputStorage
-	config            *config.Config
+	logger             *slog.Logger
+	dcrawProcessor     *processors.DcrawProcessor
+	vipsProcessor      *processors.VipsProcessor
+	fileInfoProcessor  *processors.ImageInfoProcessor
+	zipProcessor       *processors.ZipProcessor
+	statsProcessor     *processors.StatsProcessor
+	openSlideProc      *processors.OpenSlideProcessor
+	overlayProcessor   *processors.OverlayProcessor
+	watermarkProcessor *processors.WatermarkProcessor
+	pyramidProcessor   *processors.PyramidProcessor
+	inputStorage       storage.InputStorage
+	outputStorage      storage.OutputStorage
+	config             *config.Config
+	progress           ProgressFunc
+	clock              port.Clock
+	ids                port.IDGenerator
+
+	softwareOnce sync.Once
+	software     map[string]string
 }
 
 func NewImageProcessingService(
@@ -30,148 +46,419 @@ func NewImageProcessingService(
 	inputStorage storage.InputStorage,
 	outputStorage storage.OutputStorage,
 ) *ImageProcessingService {
+	vipsProcessor := processors.NewVipsProcessor(logger)
+	vipsProcessor.SetResourceLimits(cfg.Memory.VipsConcurrency, cfg.Memory.VipsCacheMB, cfg.Memory.VipsDiscMB)
+	logger.Info("Memory budget initialized",
+		"memoryLimitMB", cfg.Memory.LimitBytes>>20,
+		"vipsConcurrency", cfg.Memory.VipsConcurrency,
+		"vipsCacheMB", cfg.Memory.VipsCacheMB,
+		"vipsDiscThresholdMB", cfg.Memory.VipsDiscMB,
+		"maxInputPixels", cfg.Memory.MaxInputPixels)
+
+	// Commands killed by a signal are retried under the command policy
+	commandPolicy := retry.Policy{
+		MaxAttempts: cfg.Retry.CommandMaxAttempts,
+		BaseDelay:   cfg.Retry.BaseDelay,
+		MaxDelay:    cfg.Retry.MaxDelay,
+		Jitter:      cfg.Retry.Jitter,
+	}
+	dcrawProcessor := processors.NewDcrawProcessor(logger)
+	zipProcessor := processors.NewZipProcessor(logger)
+	openSlideProc := processors.NewOpenSlideProcessor(logger)
+	pyramidProcessor := processors.NewPyramidProcessor(logger)
+	pyramidProcessor.SetResourceLimits(cfg.Memory.VipsConcurrency, cfg.Memory.VipsCacheMB, cfg.Memory.VipsDiscMB)
+	slowLog := processors.NewSlowLog(logger, cfg.Logging.SlowCommandThreshold, "worker_type", string(cfg.WorkerType))
+	for _, p := range []*processors.BaseProcessor{
+		vipsProcessor.BaseProcessor,
+		dcrawProcessor.BaseProcessor,
+		zipProcessor.BaseProcessor,
+		openSlideProc.BaseProcessor,
+		pyramidProcessor.BaseProcessor,
+	} {
+		p.SetRetryPolicy(commandPolicy)
+		p.SetSlowLog(slowLog)
+	}
+
 	return &ImageProcessingService{
-		logger:            logger,
-		dcrawProcessor:    processors.NewDcrawProcessor(logger),
-		vipsProcessor:     processors.NewVipsProcessor(logger),
-		fileInfoProcessor: processors.NewImageInfoProcessor(logger),
-		zipProcessor:      processors.NewZipProcessor(logger),
-		inputStorage:      inputStorage,
-		outputStorage:     outputStorage,
-		config:            cfg,
+		logger:             logger,
+		dcrawProcessor:     dcrawProcessor,
+		vipsProcessor:      vipsProcessor,
+		fileInfoProcessor:  processors.NewImageInfoProcessor(logger),
+		zipProcessor:       zipProcessor,
+		statsProcessor:     processors.NewStatsProcessor(logger),
+		openSlideProc:      openSlideProc,
+		overlayProcessor:   processors.NewOverlayProcessor(logger),
+		watermarkProcessor: processors.NewWatermarkProcessor(logger),
+		pyramidProcessor:   pyramidProcessor,
+		inputStorage:       inputStorage,
+		outputStorage:      outputStorage,
+		config:             cfg,
+		clock:              clock.System{},
+		ids:                idgen.UUID{},
 	}
 }
 
+// SetClock replaces the system clock used for timestamps written into outputs
+func (s *ImageProcessingService) SetClock(clock port.Clock) {
+	s.clock = clock
+}
+
+// SetIDGenerator replaces the random IDs used to name workspaces
+func (s *ImageProcessingService) SetIDGenerator(ids port.IDGenerator) {
+	s.ids = ids
+}
+
+// newWorkspace creates the workspace of a job in the scratch dir
+func (s *ImageProcessingService) newWorkspace(file *model.File) (*model.Workspace, error) {
+	return model.NewWorkspaceNamed(file, s.config.Scratch.Dir, s.ids.NewID())
+}
+
 func (s *ImageProcessingService) ProcessFile(ctx context.Context, file *model.File, container string) (*model.Workspace, error) {
-	// Create workspace in /tmp (ephemeral, instance-local storage)
-	workspace, err := model.NewWorkspace(file)
-	if err != nil {
-		return nil, errors.NewStorageError("failed to create workspace").
-			WithContext("fileID", file.ID)
-	}
+	return s.process(ctx, file, nil, container)
+}
 
-	s.logger.Info("Created workspace in /tmp",
-		"fileID", file.ID,
-		"workspace", workspace.Dir())
+// ProcessStaged processes file like ProcessFile, in the workspace StageFile staged
+// its original into. The workspace is removed when processing fails.
+func (s *ImageProcessingService) ProcessStaged(ctx context.Context, file *model.File, staged *StagedInput, container string) (*model.Workspace, error) {
+	return s.process(ctx, file, staged, container)
+}
 
-	// Step 1: Determine the full path to the original file
-	// For local: file.Filename is already an absolute path (e.g., /Users/yasin/.../test.png)
-	// For cloud: file.Filename is relative (e.g., "image-id-file.dng"), need to join with mount path
-	var originalFilePath string
-	if filepath.IsAbs(file.Filename) {
-		// Local development: use absolute path directly
-		originalFilePath = file.Filename
-		s.logger.Info("Using absolute path directly (local)",
-			"fileID", file.ID,
-			"original_path", originalFilePath)
+func (s *ImageProcessingService) process(ctx context.Context, file *model.File, staged *StagedInput, container string) (_ *model.Workspace, err error) {
+	var workspace *model.Workspace
+	if staged != nil {
+		workspace = staged.Workspace
 	} else {
-		// Cloud: join with input mount path
-		// inputStorage is MountStorage with basePath set to input mount (e.g., "/input")
-		originalFilePath = filepath.Join(s.config.Storage.InputMountPath, file.Filename)
-		s.logger.Info("Joining with input mount path (cloud)",
+		// Create workspace in the scratch dir (ephemeral, instance-local storage)
+		workspace, err = s.newWorkspace(file)
+		if err != nil {
+			return nil, errors.NewStorageError("failed to create workspace").
+				WithContext("fileID", file.ID)
+		}
+		s.logger.Info("Created workspace",
 			"fileID", file.ID,
-			"relative_path", file.Filename,
-			"mount_path", s.config.Storage.InputMountPath,
-			"original_path", originalFilePath)
+			"workspace", workspace.Dir())
 	}
 
-	// Update file to point to the original file location
-	originalDir := filepath.Dir(originalFilePath)
-	originalFilename := filepath.Base(originalFilePath)
+	// The caller owns the workspace on success; a failed job must not leave it behind
+	defer func() {
+		if err != nil {
+			workspace.Remove()
+		}
+	}()
 
-	file.SetDir(originalDir)
-	file.SetFilename(originalFilename)
+	// A step failing because the workspace outgrew MAX_WORKSPACE_MB reports the quota
+	ctx, quota := s.watchWorkspaceQuota(ctx, file.ID, workspace)
+	defer func() {
+		err = quota.Stop(err)
+	}()
 
-	// Step 2: Process file in /tmp workspace
-	wasDNGFile := s.isDNGFile(file)
-	tiffFilename := ""
+	report := model.NewProcessingReport(file.ID, container, s.config.TaskAttempt+1)
 
-	if err := s.GetImageInfo(ctx, file); err != nil {
+	// Step 1: Point the file at the original location, a staged file already points at
+	// its copy
+	if staged == nil {
+		if err := s.resolveOriginalPath(ctx, file); err != nil {
+			return nil, err
+		}
+	}
+	ctx, err = s.checkOriginal(ctx, file)
+	if err != nil {
 		return nil, err
 	}
 
-	if wasDNGFile {
-		tiffFilename, err = s.ConvertDNGToTIFF(ctx, file, workspace)
-		if err != nil {
+	inputChecksum := ""
+	switch {
+	case staged != nil:
+		report.RecordFinishedStep("input_staging", staged.StartedAt, staged.Duration)
+		inputChecksum = staged.Checksum
+	case s.config.Storage.StageInput:
+		if err := s.runStep(report, "input_staging", func() error {
+			inputChecksum, err = s.StageInput(ctx, file, workspace)
+			return err
+		}); err != nil {
 			return nil, err
 		}
+	default:
+		s.skipStep(report, "input_staging")
 	}
 
-	if err := s.GenerateThumbnail(ctx, file, workspace); err != nil {
+	// Step 2: Process file in /tmp workspace
+	wasDNGFile := s.isDNGFile(file)
+	intermediateFilename := ""
+
+	if err := s.runStep(report, "image_info", func() error {
+		if err := s.GetImageInfo(ctx, file); err != nil {
+			return asCorruptInput(err, file)
+		}
+		if err := s.checkInputPixels(file); err != nil {
+			return err
+		}
+		return s.checkMemoryBudget(file)
+	}); err != nil {
 		return nil, err
 	}
+	report.SetInput(file)
+	report.SetInputChecksum(inputChecksum)
 
-	if err := s.GenerateDZI(ctx, file, workspace, container); err != nil {
-		return nil, err
+	if s.config.OpenSlideTiler.Enabled {
+		if err := s.runStep(report, "openslide_tiler", func() error {
+			return s.PrepareOpenSlideTiler(ctx, file, workspace, container)
+		}); err != nil {
+			return nil, err
+		}
+	} else {
+		s.skipStep(report, "openslide_tiler")
 	}
 
-	// Step 3: Post-process based on container type
-	if container == "zip" {
-		// Build index map for zip container
-		if err := s.zipProcessor.BuildIndexMap(ctx, workspace.Join("image.zip"), workspace.Dir()); err != nil {
+	if s.config.InputCheck.Enabled {
+		if err := s.runStep(report, "input_check", func() error {
+			return s.CheckInput(ctx, file, workspace)
+		}); err != nil {
 			return nil, err
 		}
+	} else {
+		s.skipStep(report, "input_check")
+	}
 
-		// Extract image.dzi from zip so it can be uploaded as a separate file
-		if err := s.zipProcessor.ExtractDesiredFile(ctx, workspace.Join("image.zip"), "image.dzi", workspace.Join("image.dzi")); err != nil {
+	if wasDNGFile {
+		if err := s.runStep(report, "dng_conversion", func() error {
+			intermediateFilename, err = s.ConvertDNG(ctx, file, workspace)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.config.ChannelConfig.Enabled {
+		if err := s.runStep(report, "channel_mapping", func() error {
+			return s.MapChannels(ctx, file, workspace)
+		}); err != nil {
 			return nil, err
 		}
 	} else {
-		// container == "fs"
-		// vips generates "image_files", rename it to "tiles" as expected by output validation
-		oldPath := workspace.Join("image_files")
-		newPath := workspace.Join("tiles")
-		if err := os.Rename(oldPath, newPath); err != nil {
-			return nil, errors.WrapStorageError(err, "failed to rename tiles directory").
-				WithContext("old", oldPath).
-				WithContext("new", newPath)
+		s.skipStep(report, "channel_mapping")
+	}
+
+	if err := s.generateOutputs(ctx, file, workspace, container, report); err != nil {
+		return nil, err
+	}
+
+	// After the stats it is computed from; the verdict is part of the result, so unlike
+	// the stats a failure here fails the job
+	if s.config.QC.Enabled {
+		if err := s.runStep(report, "qc", func() error {
+			return s.EvaluateQC(ctx, file, workspace)
+		}); err != nil {
+			return nil, err
 		}
+	} else {
+		s.skipStep(report, "qc")
+	}
+
+	// Step 3: Post-process based on container type
+	if err := s.runStep(report, "post_process", func() error {
+		return s.postProcessContainer(ctx, workspace, container)
+	}); err != nil {
+		return nil, err
+	}
+
+	// Re-run detection compares the outputs' pipeline.json with the current pipeline
+	if err := s.runStep(report, "pipeline_stamp", func() error {
+		return s.writePipelineStamp(ctx, workspace)
+	}); err != nil {
+		return nil, err
 	}
 
 	// Step 4: Validate outputs before copying to storage
-	if err := s.validateOutputs(workspace, container); err != nil {
+	var validation *outputValidation
+	if err := s.runStep(report, "validation", func() error {
+		validation, err = s.validateOutputs(ctx, workspace, container)
+		return err
+	}); err != nil {
 		return nil, err
 	}
 
+	report.WorkspacePeakBytes = quota.Peak()
+
+	// The report is a reproducibility aid, a failure here should not fail the whole job
+	if err := s.writeReport(ctx, report, workspace, validation); err != nil {
+		s.logger.Warn("Processing report generation failed, continuing without report.json",
+			"fileID", file.ID,
+			"error", err)
+	}
+
 	s.logger.Info("File processing workflow completed successfully",
 		"fileID", file.ID)
 
-	// Step 5: Copy outputs to destination storage
-	if err := s.copyOutputsToStorage(ctx, workspace, file.ID, container); err != nil {
-		return nil, err
+	// Step 5: Copy outputs to destination storage. Content-addressed outputs are only
+	// uploaded by the orchestrator, under the checksum instead of the image ID.
+	if !s.config.ContentAddress.Enabled {
+		if err := s.TrackStep(file.ID, "copy_outputs", func() error {
+			return s.copyOutputsToStorage(ctx, workspace, file.ID, container)
+		}); err != nil {
+			return nil, err
+		}
 	}
 
-	// Cleanup: Remove converted TIFF file if it was created
-	if wasDNGFile && tiffFilename != "" {
-		tiffPath := workspace.Join(tiffFilename)
-		if err := workspace.RemoveFile(tiffPath); err != nil {
-			s.logger.Warn("Failed to remove converted TIFF file from workspace",
+	// Cleanup: Remove the developed intermediate if it was created
+	if wasDNGFile && intermediateFilename != "" {
+		intermediatePath := workspace.Join(intermediateFilename)
+		if err := workspace.RemoveFile(intermediatePath); err != nil {
+			s.logger.Warn("Failed to remove DNG intermediate from workspace",
 				"fileID", file.ID,
-				"tiffPath", tiffPath,
+				"intermediatePath", intermediatePath,
 				"error", err)
 		} else {
-			s.logger.Info("Removed converted TIFF file from workspace",
+			s.logger.Info("Removed DNG intermediate from workspace",
 				"fileID", file.ID,
-				"tiffPath", tiffPath)
+				"intermediatePath", intermediatePath)
 		}
 	}
 
+	// Cleanup: Remove the staged input copy
+	if s.config.Storage.StageInput || staged != nil {
+		if err := workspace.RemoveDir(stagedInputDir); err != nil {
+			s.logger.Warn("Failed to remove staged input from workspace",
+				"fileID", file.ID,
+				"error", err)
+		}
+	}
+
+	// Cleanup: Remove the OpenSlide preview if one was rendered
+	if preview := workspace.Preview(); preview != "" {
+		if err := workspace.RemoveFile(preview); err != nil {
+			s.logger.Warn("Failed to remove OpenSlide preview from workspace",
+				"fileID", file.ID,
+				"previewPath", preview,
+				"error", err)
+		}
+		workspace.SetPreview("")
+	}
+
+	// Cleanup: Remove the channel-mapped source if one was created
+	if source := workspace.Source(); source != "" {
+		if err := workspace.RemoveFile(source); err != nil {
+			s.logger.Warn("Failed to remove mapped source from workspace",
+				"fileID", file.ID,
+				"sourcePath", source,
+				"error", err)
+		}
+		workspace.SetSource("")
+	}
+
 	return workspace, nil
 }
 
+// checkOriginal rejects an original above MAX_INPUT_SIZE_MB and returns ctx carrying
+// the input slow commands are reported with
+func (s *ImageProcessingService) checkOriginal(ctx context.Context, file *model.File) (context.Context, error) {
+	info, err := os.Stat(file.AbsolutePath())
+	if err != nil {
+		return ctx, nil
+	}
+	size := info.Size()
+	// A multi-file slide is as large as its data files, the index file is small
+	if processors.IsMultiFileFormat(file.Extension()) {
+		if bundle, err := processors.SlideBundleSize(file.AbsolutePath()); err == nil {
+			size = bundle
+		}
+	}
+	if err := checkInputSize(s.config, file.ID, size); err != nil {
+		return ctx, err
+	}
+	return processors.WithCommandInput(ctx, file.ID, file.Extension(), size), nil
+}
+
+// postProcessContainer finalizes the dzsave output: zip containers get an index map
+// and a standalone image.dzi, fs containers get their tiles directory renamed
+func (s *ImageProcessingService) postProcessContainer(ctx context.Context, workspace *model.Workspace, container string) error {
+	if container == "zip" {
+		// Build index map for zip container and extract image.dzi so it can be
+		// uploaded as a separate file, in a single pass over the archive
+		_, err := s.zipProcessor.BuildIndexMap(ctx, workspace.Join("image.zip"), workspace.Dir(),
+			map[string]string{"image.dzi": workspace.Join("image.dzi")})
+		return err
+	}
+
+	// container == "fs"
+	// vips generates "image_files", rename it to "tiles" as expected by output validation
+	oldPath := workspace.Join("image_files")
+	newPath := workspace.Join("tiles")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return errors.WrapStorageError(err, "failed to rename tiles directory").
+			WithContext("old", oldPath).
+			WithContext("new", newPath)
+	}
+	return nil
+}
+
+// resolveOriginalPath points file at the original on the input mount.
+// For local: file.Filename is already an absolute path (e.g., /Users/yasin/.../test.png)
+// For cloud: file.Filename is relative (e.g., "image-id-file.dng"), need to join with mount path.
+// Relative paths that leave the mount, also through a symlink, are rejected.
+func (s *ImageProcessingService) resolveOriginalPath(ctx context.Context, file *model.File) error {
+	var originalFilePath string
+	if filepath.IsAbs(file.Filename) {
+		// Local development: use absolute path directly
+		originalFilePath = file.Filename
+		s.logger.Info("Using absolute path directly (local)",
+			"fileID", file.ID,
+			"original_path", originalFilePath)
+	} else {
+		// Cloud: join with input mount path
+		// inputStorage is MountStorage with basePath set to input mount (e.g., "/input")
+		resolved, err := storage.ResolveWithin(s.config.Storage.InputMountPath, file.Filename)
+		if err != nil {
+			return err
+		}
+		originalFilePath = resolved
+		s.logger.Info("Joining with input mount path (cloud)",
+			"fileID", file.ID,
+			"relative_path", file.Filename,
+			"mount_path", s.config.Storage.InputMountPath,
+			"original_path", originalFilePath)
+	}
+
+	// Update file to point to the original file location
+	originalDir := filepath.Dir(originalFilePath)
+	originalFilename := filepath.Base(originalFilePath)
+
+	file.SetDir(originalDir)
+	file.SetFilename(originalFilename)
+	detected, err := s.reconcileFormat(ctx, file)
+	if err != nil {
+		return err
+	}
+	// Rejected before any processor runs on it, with what to do about the format
+	if _, ok := processors.LookupFormat(file.Extension()); !ok {
+		return processors.UnsupportedFormatError(file.Extension(), detected)
+	}
+	return nil
+}
+
 func (s *ImageProcessingService) GetImageInfo(ctx context.Context, file *model.File) error {
 	s.logger.Info("Getting image info",
 		"fileID", file.ID,
 		"filename", file.Filename)
 
 	inputFilePath := file.AbsolutePath()
-	imageInfo, err := s.fileInfoProcessor.GetImageInfo(ctx, inputFilePath)
+	imageInfo, err := s.fileInfoProcessor.GetImageInfoAs(ctx, inputFilePath, file.Extension())
 
 	if err != nil {
 		return err
 	}
 
 	file.SetDimensions(imageInfo.Width, imageInfo.Height, imageInfo.Size)
+
+	var levels []model.ImageLevel
+	for _, level := range imageInfo.Levels {
+		levels = append(levels, model.ImageLevel{
+			Width:      level.Width,
+			Height:     level.Height,
+			Downsample: level.Downsample,
+		})
+	}
+	file.SetLevels(levels)
 	return nil
 }
 
@@ -180,16 +467,43 @@ func (s *ImageProcessingService) isDNGFile(file *model.File) bool {
 	return ext == ".dng"
 }
 
-func (s *ImageProcessingService) ConvertDNGToTIFF(ctx context.Context, file *model.File, workspace *model.Workspace) (string, error) {
-	s.logger.Info("Converting DNG to TIFF",
+// sourcePath returns the file pixel data should be read from: a workspace
+// intermediate if one was set, the developed intermediate for DNG inputs, the original file otherwise
+func (s *ImageProcessingService) sourcePath(file *model.File, workspace *model.Workspace) string {
+	if source := workspace.Source(); source != "" {
+		return source
+	}
+	// DNG ise workspace'teki ara dosyayı kullan, değilse orijinal dosyayı kullan
+	if s.isDNGFile(file) {
+		return workspace.Join(s.config.Intermediate.Filename(file.BaseName()))
+	}
+	return file.AbsolutePath()
+}
+
+// ConvertDNG develops a DNG file into the intermediate of INTERMEDIATE_FORMAT in the
+// workspace, which every later step reads (see sourcePath). It returns the file name.
+func (s *ImageProcessingService) ConvertDNG(ctx context.Context, file *model.File, workspace *model.Workspace) (string, error) {
+	cfg := s.config.Intermediate
+	s.logger.Info("Developing DNG",
 		"fileID", file.ID,
-		"filename", file.Filename)
+		"filename", file.Filename,
+		"format", cfg.Format,
+		"compression", cfg.Compression,
+		"bitDepth", cfg.BitDepth)
 
 	inputFilePath := file.AbsolutePath()
-	tiffFilename := file.BaseName() + ".tiff"
-	outputFilePath := workspace.Join(tiffFilename)
+	intermediateFilename := cfg.Filename(file.BaseName())
+	outputFilePath := workspace.Join(intermediateFilename)
+	timeout := s.config.ImageProcessTimeoutMinute.FormatConversion
+
+	// dcraw only writes uncompressed TIFF, other intermediates are copied from it
+	developedPath := outputFilePath
+	if !cfg.Direct() {
+		developedPath = workspace.Join(file.BaseName() + ".developed.tiff")
+		defer os.Remove(developedPath)
+	}
 
-	result, err := s.dcrawProcessor.DNGToTIFF(ctx, inputFilePath, outputFilePath, s.config.ImageProcessTimeoutMinute.FormatConversion)
+	result, err := s.dcrawProcessor.DNGToTIFF(ctx, inputFilePath, developedPath, s.config.DNG, cfg.BitDepth, timeout)
 	if err != nil {
 		stdout := ""
 		stderr := ""
@@ -205,11 +519,30 @@ func (s *ImageProcessingService) ConvertDNGToTIFF(ctx context.Context, file *mod
 		return "", err
 	}
 
-	s.logger.Info("DNG to TIFF conversion succeeded",
+	if developedPath != outputFilePath {
+		if cfg.Format == "tiff" {
+			result, err = s.vipsProcessor.SaveTIFF(ctx, developedPath, outputFilePath, cfg.Compression, timeout)
+		} else {
+			result, err = s.vipsProcessor.ConvertImage(ctx, developedPath, outputFilePath, timeout)
+		}
+		if err != nil {
+			stderr := ""
+			if result != nil {
+				stderr = result.Stderr
+			}
+			s.logger.Error("Intermediate conversion failed",
+				"fileID", file.ID,
+				"stderr", stderr,
+				"error", err)
+			return "", err
+		}
+	}
+
+	s.logger.Info("DNG development succeeded",
 		"fileID", file.ID,
 		"outputFile", outputFilePath)
 
-	return tiffFilename, nil
+	return intermediateFilename, nil
 }
 
 func (s *ImageProcessingService) GenerateThumbnail(ctx context.Context, file *model.File, workspace *model.Workspace) error {
@@ -217,22 +550,19 @@ func (s *ImageProcessingService) GenerateThumbnail(ctx context.Context, file *mo
 		"fileID", file.ID,
 		"filename", file.Filename)
 
-	var inputFilePath string
-
-	// DNG ise workspace'teki TIFF'i kullan, değilse orijinal dosyayı kullan
-	if s.isDNGFile(file) {
-		tiffFilename := file.BaseName() + ".tiff"
-		inputFilePath = workspace.Join(tiffFilename)
-	} else {
-		inputFilePath = file.AbsolutePath()
-	}
+	return s.generateThumbnailFrom(ctx, file, workspace, s.previewSource(file, workspace))
+}
 
+// generateThumbnailFrom writes thumbnail.jpg of the workspace from inputFilePath
+func (s *ImageProcessingService) generateThumbnailFrom(ctx context.Context, file *model.File, workspace *model.Workspace, inputFilePath string) error {
 	outputFilePath := workspace.Join("thumbnail.jpg")
 
-	result, err := s.vipsProcessor.CreateThumbnail(ctx, inputFilePath, outputFilePath,
+	result, err := s.vipsProcessor.CreateFramedThumbnail(ctx, inputFilePath, outputFilePath,
 		s.config.ThumbnailConfig.Width,
 		s.config.ThumbnailConfig.Height,
-		s.config.ThumbnailConfig.Quality)
+		s.config.ThumbnailConfig.Quality,
+		s.config.ThumbnailConfig.Mode,
+		s.config.ThumbnailConfig.Background)
 
 	if err != nil {
 		stdout := ""
@@ -249,6 +579,10 @@ func (s *ImageProcessingService) GenerateThumbnail(ctx context.Context, file *mo
 		return err
 	}
 
+	if err := s.applyWatermark(ctx, outputFilePath, s.config.ThumbnailConfig.Quality); err != nil {
+		return err
+	}
+
 	s.logger.Info("Thumbnail generation succeeded",
 		"fileID", file.ID,
 		"outputFile", outputFilePath)
@@ -261,15 +595,7 @@ func (s *ImageProcessingService) GenerateDZI(ctx context.Context, file *model.Fi
 		"fileID", file.ID,
 		"filename", file.Filename)
 
-	var inputFilePath string
-
-	if s.isDNGFile(file) {
-		tiffFilename := file.BaseName() + ".tiff"
-		inputFilePath = workspace.Join(tiffFilename)
-	} else {
-		inputFilePath = file.AbsolutePath()
-	}
-
+	inputFilePath := s.sourcePath(file, workspace)
 	outputBase := workspace.Join("image")
 
 	dziConfig := s.config.DZIConfig
@@ -279,11 +605,27 @@ func (s *ImageProcessingService) GenerateDZI(ctx context.Context, file *model.Fi
 		dziConfig.Compression = 0
 	}
 
+	// Overlap upload of finished pyramid levels with tiling of the remaining ones
+	if s.uploadsLevelsEarly(container) {
+		uploader := s.startLevelUploader(ctx, file, workspace)
+		defer func() {
+			if err := uploader.Stop(); err != nil {
+				s.logger.Warn("Some pyramid levels were not uploaded early",
+					"fileID", file.ID,
+					"error", err)
+			}
+		}()
+	}
+
+	if workspace.Preview() != "" {
+		return s.generateDZIWithOpenSlide(ctx, file, workspace)
+	}
+
 	result, err := s.vipsProcessor.CreateDZI(ctx,
 		inputFilePath,
 		outputBase,
 		s.config.ImageProcessTimeoutMinute.DZIConversion,
-		dziConfig, container)
+		dziConfig, container, s.dziProgress(file.ID))
 
 	if err != nil {
 		stdout := ""
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// SetImageRepository makes the orchestrator persist the status and result of every
+// image it processes. Without one, the result events are the only record.
+func (o *JobOrchestrator) SetImageRepository(repository port.ImageRepository) {
+	o.images = repository
+}
+
+// recordStart stores the record of a job that starts processing
+func (o *JobOrchestrator) recordStart(ctx context.Context, input *model.JobInput) {
+	if o.images == nil {
+		return
+	}
+	now := o.clock.Now()
+	record := &model.ImageRecord{
+		ImageID:           input.ImageID,
+		Tenant:            input.Tenant,
+		OriginPath:        input.OriginPath,
+		BucketName:        input.BucketName(),
+		ProcessingVersion: input.ProcessingVersion,
+		PipelineVersion:   o.imageProcessingService.PipelineVersion(ctx),
+		Metadata:          input.Metadata,
+		RequestEventID:    input.RequestEventID,
+		CorrelationID:     input.CorrelationID,
+		Status:            vobj.StatusProcessing,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := o.images.Create(ctx, record); err != nil {
+		o.logger.Warn("Failed to store image record", "imageID", input.ImageID, "error", err)
+	}
+}
+
+// recordStatus updates the record of a job, creating it when the job failed before
+// recordStart. Repository failures are logged; the result event is still published.
+func (o *JobOrchestrator) recordStatus(ctx context.Context, input *model.JobInput, status vobj.ImageStatus, reason string, result *model.ImageResult) {
+	if o.images == nil {
+		return
+	}
+	// Statuses are written under the reserved time like the result event
+	ctx, cancel := deadline.Reserved(ctx)
+	defer cancel()
+
+	update := model.ImageStatusUpdate{
+		Status:        status,
+		FailureReason: reason,
+		Result:        result,
+		UpdatedAt:     o.clock.Now(),
+	}
+	err := o.images.UpdateStatus(ctx, input.ImageID, update)
+	if errors.Is(err, errors.ErrorTypeNotFound) {
+		err = o.images.Create(ctx, &model.ImageRecord{
+			ImageID:           input.ImageID,
+			Tenant:            input.Tenant,
+			OriginPath:        input.OriginPath,
+			BucketName:        input.BucketName(),
+			ProcessingVersion: input.ProcessingVersion,
+			PipelineVersion:   o.imageProcessingService.PipelineVersion(ctx),
+			Metadata:          input.Metadata,
+			RequestEventID:    input.RequestEventID,
+			CorrelationID:     input.CorrelationID,
+			Status:            status,
+			FailureReason:     reason,
+			Result:            result,
+			CreatedAt:         update.UpdatedAt,
+			UpdatedAt:         update.UpdatedAt,
+		})
+	}
+	if err != nil {
+		o.logger.Warn("Failed to update image record",
+			"imageID", input.ImageID,
+			"status", status,
+			"error", err,
+		)
+	}
+}
+
+// imageResult summarizes a successful job for its record
+func imageResult(file *model.File, outputPath string, contents []*model.Content) *model.ImageResult {
+	result := &model.ImageResult{
+		Width:      file.WidthValue(),
+		Height:     file.HeightValue(),
+		Size:       file.SizeValue(),
+		OutputPath: outputPath,
+		Levels:     file.Levels,
+	}
+	for _, content := range contents {
+		result.Contents = append(result.Contents, content.Path)
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// CheckInput reads a region of the bottom-right corner of the input at full
+// resolution, the part a truncated upload is missing, so a corrupt input fails
+// before tiling starts. file dimensions must already be resolved. DNG inputs are
+// not checked: the conversion decodes the whole file anyway.
+func (s *ImageProcessingService) CheckInput(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	if s.isDNGFile(file) {
+		return nil
+	}
+
+	size := s.config.InputCheck.RegionSize
+	width := min(size, file.WidthValue())
+	height := min(size, file.HeightValue())
+	x := file.WidthValue() - width
+	y := file.HeightValue() - height
+
+	s.logger.Info("Checking input",
+		"fileID", file.ID,
+		"x", x,
+		"y", y,
+		"width", width,
+		"height", height)
+
+	regionPath := workspace.Join("input_check.png")
+	defer workspace.RemoveFile(regionPath)
+
+	timeout := s.config.InputCheck.TimeoutMinute
+	var err error
+	if processors.IsWholeSlideFormat(file.Extension()) {
+		_, err = s.openSlideProc.ReadRegion(ctx, file.AbsolutePath(), x, y, 0, width, height, regionPath, timeout)
+	} else {
+		_, err = s.vipsProcessor.ExtractArea(ctx, file.AbsolutePath(), regionPath, x, y, width, height, timeout)
+	}
+	if err != nil {
+		return asCorruptInput(err, file)
+	}
+	return nil
+}
+
+// asCorruptInput reclassifies the failure of a command that opened or read the input
+// as corrupt input. Commands killed by a signal keep their type, as do timeouts,
+// storage and configuration errors: they say nothing about the file.
+func asCorruptInput(err error, file *model.File) error {
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) || appErr.Type != errors.ErrorTypeProcessing {
+		return err
+	}
+	if exitCode, _ := appErr.Context["exit_code"].(int); exitCode == 137 || exitCode == 143 {
+		return err
+	}
+	return errors.WrapCorruptInputError(err, "input is truncated or corrupt").
+		WithContext("fileID", file.ID)
+}
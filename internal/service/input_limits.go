@@ -0,0 +1,49 @@
+package service
+
+import (
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// checkInputSize rejects inputs larger than MAX_INPUT_SIZE_MB of the worker type, so
+// a slide too big for the worker fails before anything is staged or decoded instead
+// of running out of memory or disk on every retry
+func checkInputSize(cfg *config.Config, fileID string, size int64) error {
+	maxMB := cfg.WorkerProfile.MaxInputMB
+	if maxMB <= 0 || size <= maxMB<<20 {
+		return nil
+	}
+	return tooLargeError(cfg, "input file exceeds the size limit of this worker").
+		WithContext("fileID", fileID).
+		WithContext("size_mb", size>>20).
+		WithContext("max_input_size_mb", maxMB)
+}
+
+// checkInputPixels rejects inputs with more pixels than MAX_INPUT_MEGAPIXELS of the
+// worker type. file dimensions must already be resolved.
+func (s *ImageProcessingService) checkInputPixels(file *model.File) error {
+	maxMegapixels := s.config.WorkerProfile.MaxInputMegapixels
+	megapixels := int64(file.WidthValue()) * int64(file.HeightValue()) / 1_000_000
+	if maxMegapixels <= 0 || megapixels <= maxMegapixels {
+		return nil
+	}
+	return tooLargeError(s.config, "input image exceeds the pixel limit of this worker").
+		WithContext("fileID", file.ID).
+		WithContext("megapixels", megapixels).
+		WithContext("max_input_megapixels", maxMegapixels)
+}
+
+// tooLargeError is the non-retryable error of an input too large for the worker type.
+// It names the larger worker type to run the job on, which the failure event passes
+// on as its suggested worker type.
+func tooLargeError(cfg *config.Config, message string) *errors.AppError {
+	larger := cfg.WorkerType.Larger()
+	if larger == "" {
+		return errors.NewValidationError(message+", even the largest worker type").
+			WithContext("worker_type", string(cfg.WorkerType))
+	}
+	return errors.NewValidationError(message+", use the "+string(larger)+" worker type").
+		WithContext("worker_type", string(cfg.WorkerType)).
+		WithContext(suggestedWorkerTypeKey, string(larger))
+}
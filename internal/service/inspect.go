@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// SlideInspection summarizes what a processing job would see and do for an
+// input, without running it
+type SlideInspection struct {
+	Path      string `json:"path"`
+	Extension string `json:"extension"`
+	Supported bool   `json:"supported"`
+	SizeBytes int64  `json:"size_bytes"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+
+	// DetectedFormat is the format sniffed from the content, "" when unrecognized.
+	// Extension is that of the detected format when the two disagree.
+	DetectedFormat string `json:"detected_format,omitempty"`
+
+	// Processor path: how dimensions are probed and which steps produce the tiles
+	DimensionProbe string   `json:"dimension_probe"`
+	Pipeline       []string `json:"pipeline"`
+
+	Bands *processors.BandInfo        `json:"bands,omitempty"`
+	Slide *processors.SlideProperties `json:"slide,omitempty"`
+
+	DZI            *dzi.Descriptor `json:"dzi"`
+	LevelTiles     []int           `json:"level_tiles"`
+	EstimatedTiles int             `json:"estimated_tiles"`
+
+	EstimatedScratchBytes int64  `json:"estimated_scratch_bytes"`
+	MemoryCheck           string `json:"memory_check"`
+
+	// Warnings are non-fatal problems found while inspecting
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Inspect probes an input file with the same processors and decisions as
+// ProcessFile and reports dimensions, levels, tile estimates and the processor
+// path that would be taken. Probe failures are returned as errors only when the
+// dimensions cannot be determined; everything else becomes a warning.
+func (s *ImageProcessingService) Inspect(ctx context.Context, path string) (*SlideInspection, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.WrapValidationError(err, "failed to resolve input path").
+			WithContext("path", path)
+	}
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to stat input file").
+			WithContext("path", absPath)
+	}
+
+	file, err := model.NewFile("inspect", filepath.Base(absPath), filepath.Dir(absPath), nil, nil, nil, nil)
+	if err != nil {
+		return nil, errors.WrapValidationError(err, "invalid input file").
+			WithContext("path", absPath)
+	}
+
+	nameExt := file.Extension()
+	detected, err := s.reconcileFormat(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	ext := file.Extension()
+	_, supported := processors.LookupFormat(ext)
+	inspection := &SlideInspection{
+		Path:           absPath,
+		Extension:      ext,
+		Supported:      supported,
+		SizeBytes:      stat.Size(),
+		DetectedFormat: detected,
+	}
+	if ext != nameExt {
+		inspection.Warnings = append(inspection.Warnings,
+			fmt.Sprintf("content is %s but the extension is %s, processed as %s", detected, nameExt, detected))
+	}
+	if !inspection.Supported {
+		inspection.Warnings = append(inspection.Warnings, processors.UnsupportedFormatMessage(ext, detected))
+	}
+
+	// Mirror the probe order of ImageInfoProcessor.GetImageInfo
+	switch {
+	case s.isDNGFile(file):
+		inspection.DimensionProbe = "exiftool"
+		inspection.Pipeline = append(inspection.Pipeline, "dcraw: DNG to 16-bit TIFF")
+	case processors.IsWholeSlideFormat(ext):
+		inspection.DimensionProbe = "openslide (fallback exiftool, vipsheader)"
+	default:
+		inspection.DimensionProbe = "vipsheader"
+	}
+
+	if err := s.GetImageInfo(ctx, file); err != nil {
+		return nil, err
+	}
+	inspection.Width = file.WidthValue()
+	inspection.Height = file.HeightValue()
+
+	if processors.IsWholeSlideFormat(ext) {
+		inspection.Pipeline = append(inspection.Pipeline, "vips dzsave via openslide loader")
+		slide, err := s.fileInfoProcessor.GetSlideProperties(ctx, absPath)
+		if err != nil {
+			inspection.Warnings = append(inspection.Warnings, "openslide properties unavailable: "+err.Error())
+		} else {
+			inspection.Slide = slide
+		}
+	} else if !s.isDNGFile(file) {
+		inspection.Pipeline = append(inspection.Pipeline, s.describeChannelMapping(ctx, absPath, inspection)...)
+		inspection.Pipeline = append(inspection.Pipeline, "vips dzsave")
+	} else {
+		inspection.Pipeline = append(inspection.Pipeline, "channel mapping decided after conversion", "vips dzsave")
+	}
+
+	cfg := s.config.DZIConfig
+	descriptor := &dzi.Descriptor{
+		TileSize: cfg.TileSize,
+		Overlap:  cfg.Overlap,
+		Format:   dzi.FormatForSuffix(cfg.Suffix),
+		Width:    inspection.Width,
+		Height:   inspection.Height,
+	}
+	if err := descriptor.Validate(); err != nil {
+		inspection.Warnings = append(inspection.Warnings, "invalid DZI geometry: "+err.Error())
+	} else {
+		inspection.DZI = descriptor
+		for level := 0; level < descriptor.LevelCount(); level++ {
+			inspection.LevelTiles = append(inspection.LevelTiles, descriptor.ExpectedTiles(level))
+		}
+		inspection.EstimatedTiles = descriptor.TotalTiles()
+	}
+
+	inspection.EstimatedScratchBytes = max(1, int64(float64(stat.Size())*s.config.Scratch.Multiplier))
+
+	inspection.MemoryCheck = "ok"
+	if err := s.checkMemoryBudget(file); err != nil {
+		inspection.MemoryCheck = err.Error()
+	}
+
+	return inspection, nil
+}
+
+// describeChannelMapping reports the channel mapping MapChannels would apply
+func (s *ImageProcessingService) describeChannelMapping(ctx context.Context, path string, inspection *SlideInspection) []string {
+	if !s.config.ChannelConfig.Enabled {
+		return nil
+	}
+
+	info, err := s.vipsProcessor.GetBandInfo(ctx, path)
+	if err != nil {
+		inspection.Warnings = append(inspection.Warnings, "band layout unavailable: "+err.Error())
+		return nil
+	}
+	inspection.Bands = info
+
+	lut := strings.ToLower(s.config.ChannelConfig.LUT)
+	grayLUT := lut == "" || lut == "gray" || lut == "grey"
+
+	single, multi, eightBit := classifyBands(info)
+	switch {
+	case single && eightBit && info.Bands == 1 && grayLUT:
+		return nil
+	case single:
+		return []string{"channel mapping: single channel through CHANNEL_LUT"}
+	case multi:
+		return []string{"channel mapping: fluorescence composite of CHANNEL_COLORS"}
+	case !eightBit && s.config.ChannelConfig.Rescale:
+		return []string{"channel mapping: rescale to 8 bits"}
+	default:
+		return nil
+	}
+}
@@ -6,29 +6,53 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
 	"github.com/histopathai/image-processing-service/internal/domain/events"
 	"github.com/histopathai/image-processing-service/internal/domain/model"
 	"github.com/histopathai/image-processing-service/internal/domain/port"
 	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/clock"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/idgen"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
 	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 type JobOrchestrator struct {
 	logger                 *slog.Logger
 	config                 *config.Config
-	imageProcessingService *ImageProcessingService
+	imageProcessingService ImageProcessor
 	storage                port.Storage
+	inputStorage           storage.InputStorage
 	publisher              port.EventPublisher
 	eventSerializer        events.EventSerializer
+	scheduler              *JobScheduler
+	clock                  port.Clock
+	ids                    port.IDGenerator
+	images                 port.ImageRepository
+	replica                port.Storage
+
+	// Heartbeats of running jobs (heartbeat.go)
+	heartbeats        port.HeartbeatStore
+	workerID          string
+	heartbeatInterval time.Duration
+
+	// Background replica uploads (replica.go)
+	replicas    sync.WaitGroup
+	replicaMu   sync.Mutex
+	replicaErrs []error
 }
 
 func NewJobOrchestrator(
 	logger *slog.Logger,
 	config *config.Config,
-	imageProcessingService *ImageProcessingService,
+	imageProcessingService ImageProcessor,
 	storage port.Storage,
 	publisher port.EventPublisher,
 	eventSerializer events.EventSerializer,
@@ -40,10 +64,72 @@ func NewJobOrchestrator(
 		storage:                storage,
 		publisher:              publisher,
 		eventSerializer:        eventSerializer,
+		scheduler:              NewJobScheduler(logger, config),
+		clock:                  clock.System{},
+		ids:                    idgen.UUID{},
 	}
 }
 
+// SetClock replaces the system clock used for event timestamps
+func (o *JobOrchestrator) SetClock(clock port.Clock) {
+	o.clock = clock
+}
+
+// SetIDGenerator replaces the random UUIDs used for event and content IDs
+func (o *JobOrchestrator) SetIDGenerator(ids port.IDGenerator) {
+	o.ids = ids
+}
+
+// newEvent starts an event of the job of input, caused by its request
+func (o *JobOrchestrator) newEvent(eventType events.EventType, input *model.JobInput) events.BaseEvent {
+	base := events.NewBaseEventWith(eventType, o.clock, o.ids)
+	base.CausedBy(input.RequestEventID, input.CorrelationID)
+	return base
+}
+
 func (o *JobOrchestrator) ProcessJob(ctx context.Context, input *model.JobInput) error {
+	// The clients were built for one tenant's buckets and topic; never process another's image with them
+	if input.Tenant != o.config.Tenant {
+		return errors.NewConfigurationError("job tenant does not match the configured tenant").
+			WithContext("job_tenant", input.Tenant).
+			WithContext("configured_tenant", o.config.Tenant)
+	}
+
+	// A request that waited too long is answered without doing the work
+	if reason := o.requestExpired(input); reason != "" {
+		return o.expireJob(ctx, input, reason)
+	}
+
+	ctx, stopHeartbeat := o.startHeartbeat(ctx, input)
+	defer stopHeartbeat()
+
+	// Retries of all phases draw from one budget, so flaky dependencies cannot add up
+	budget := retry.NewBudget(o.config.Retry.JobMaxRetries, o.config.Retry.JobMaxTime)
+	ctx = retry.WithBudget(ctx, budget)
+	defer func() {
+		if retries, spent := budget.Used(); retries > 0 {
+			o.logger.Info("Job retries",
+				"imageID", input.ImageID,
+				"retries", retries,
+				"retryTime", spent.Round(time.Millisecond))
+		}
+	}()
+
+	switch input.JobType {
+	case model.JobTypeExtractRegion:
+		return o.extractRegion(ctx, input)
+	case model.JobTypeRenderAnnotations:
+		return o.renderAnnotations(ctx, input)
+	case model.JobTypeDelete:
+		return o.deleteImage(ctx, input)
+	case model.JobTypeTranscode:
+		return o.transcodeTiles(ctx, input)
+	default:
+		return o.processImage(ctx, input)
+	}
+}
+
+func (o *JobOrchestrator) processImage(ctx context.Context, input *model.JobInput) error {
 	o.logger.Info("Starting job processing",
 		"imageID", input.ImageID,
 		"originPath", input.OriginPath,
@@ -52,7 +138,14 @@ func (o *JobOrchestrator) ProcessJob(ctx context.Context, input *model.JobInput)
 	// OriginPath is relative to the input storage mount point
 	// e.g., "image-id/file.png" or just "file.png"
 	// The storage layer handles the actual mount point (/input, /gcs/bucket, etc.)
-	baseEvent := events.NewBaseEvent(events.ImageProcessCompleteEventType)
+	baseEvent := o.newEvent(events.ImageProcessCompleteEventType, input)
+
+	if o.poisoned() {
+		err := fmt.Errorf("image did not finish in %d task attempts", o.config.DeadLetter.MaxAttempts)
+		return o.failImage(ctx, input, baseEvent, err.Error(), false, err)
+	}
+
+	o.recordStart(ctx, input)
 
 	file, err := model.NewFile(
 		input.ImageID,
@@ -61,16 +154,24 @@ func (o *JobOrchestrator) ProcessJob(ctx context.Context, input *model.JobInput)
 		nil, nil, nil, nil,
 	)
 	if err != nil {
-		o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
-			BaseEvent:         baseEvent,
-			ImageID:           input.ImageID,
-			ProcessingVersion: input.ProcessingVersion,
-			Success:           false,
-			FailureReason:     err.Error(),
-			Retryable:         !errors.IsNonRetryable(err),
-		})
-		return err
+		return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+	}
+
+	// Admit the job by its memory and scratch before touching the disk
+	inputSize, err := o.imageProcessingService.InputSize(ctx, file)
+	if err != nil {
+		return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+	}
+	if err := checkInputSize(o.config, input.ImageID, inputSize); err != nil {
+		return o.failImage(ctx, input, baseEvent, err.Error(), false, err)
+	}
+
+	o.setPhase(ctx, model.PhaseAdmission)
+	release, err := o.scheduler.Admit(ctx, o.scheduler.Cost(file, inputSize))
+	if err != nil {
+		return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
 	}
+	defer release()
 
 	var container string
 	if input.ProcessingVersion == "v1" {
@@ -79,89 +180,157 @@ func (o *JobOrchestrator) ProcessJob(ctx context.Context, input *model.JobInput)
 		container = "zip"
 	}
 
-	outputWorkspace, err := o.imageProcessingService.ProcessFile(ctx, file, container)
-	if err != nil {
-		o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
-			BaseEvent:         baseEvent,
-			ImageID:           input.ImageID,
-			ProcessingVersion: input.ProcessingVersion,
-			Success:           false,
-			FailureReason:     err.Error(),
-			Retryable:         !errors.IsNonRetryable(err),
-		})
-		return err
-	}
-
+	o.setPhase(ctx, model.PhaseProcessing)
 	finalOutputPath := o.constructOutputPath(input.ImageID)
+	var staged *StagedInput
+	if o.config.ContentAddress.Enabled || o.config.Dedup.Enabled {
+		// The checksum is computed while staging, the original is read once
+		staged, err = o.imageProcessingService.StageFile(ctx, file)
+		if err != nil {
+			return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+		}
+		checksum := staged.Checksum
+		o.recordChecksum(ctx, input, checksum)
+
+		// The same slide was processed before; lookups only match processed records
+		if o.config.Dedup.Enabled {
+			if original, contents := o.duplicateOf(ctx, input, checksum); original != nil {
+				if err := staged.Workspace.Remove(); err != nil {
+					o.logger.Warn("Failed to clean up staged input workspace",
+						"imageID", input.ImageID,
+						"error", err,
+					)
+				}
+				return o.completeFromRecord(ctx, input, baseEvent, original, contents, vobj.StatusDuplicate, original.ImageID)
+			}
+		}
+		if o.config.ContentAddress.Enabled {
+			finalOutputPath = o.contentAddressedPath(checksum)
+			if record, contents := o.processedContent(ctx, input, checksum, finalOutputPath); record != nil {
+				if err := staged.Workspace.Remove(); err != nil {
+					o.logger.Warn("Failed to clean up staged input workspace",
+						"imageID", input.ImageID,
+						"error", err,
+					)
+				}
+				return o.completeFromRecord(ctx, input, baseEvent, record, contents, vobj.StatusProcessed, "")
+			}
+		}
+	}
 
-	o.logger.Info("Preparing contents", "imageID", input.ImageID)
-
-	var contentProvider vobj.ContentProvider
-	if o.config.Env == config.EnvLocal {
-		contentProvider = vobj.ContentProviderLocal
+	var outputWorkspace *model.Workspace
+	if staged != nil {
+		outputWorkspace, err = o.imageProcessingService.ProcessStaged(ctx, file, staged, container)
 	} else {
-		contentProvider = vobj.ContentProviderGCS
+		outputWorkspace, err = o.imageProcessingService.ProcessFile(ctx, file, container)
 	}
-
-	contents, err := o.prepareContents(input, outputWorkspace.Dir(), finalOutputPath, contentProvider)
 	if err != nil {
-		o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
-			BaseEvent:         baseEvent,
-			ImageID:           input.ImageID,
-			ProcessingVersion: input.ProcessingVersion,
-			Success:           false,
-			FailureReason:     fmt.Sprintf("failed to prepare contents: %v", err),
-			Retryable:         false,
-		})
-		return err
+		return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
 	}
 
-	o.logger.Info("Starting upload",
-		"imageID", input.ImageID,
-		"source", outputWorkspace.Dir(),
-		"destination", finalOutputPath,
-	)
+	if o.config.ContentAddress.Enabled && o.config.ContentAddress.StoreOriginal {
+		if err := o.storeOriginal(ctx, input, outputWorkspace.Dir()); err != nil {
+			return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+		}
+	}
 
-	if err := o.storage.UploadDirectory(ctx, outputWorkspace.Dir(), finalOutputPath); err != nil {
-		o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
-			BaseEvent:         baseEvent,
-			ImageID:           input.ImageID,
-			ProcessingVersion: input.ProcessingVersion,
-			Success:           false,
-			FailureReason:     err.Error(),
-			Retryable:         !errors.IsNonRetryable(err),
-		})
-		return err
+	// Everything in the workspace is uploaded; only qc_hold.json, written below, is not
+	// listed
+	if o.config.Storage.UploadManifest {
+		manifest, err := writeUploadManifest(ctx, outputWorkspace.Dir())
+		if err != nil {
+			return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+		}
+		o.logger.Info("Upload manifest written",
+			"imageID", input.ImageID,
+			"objects", len(manifest.Objects))
 	}
 
-	o.logger.Info("Upload completed successfully",
-		"imageID", input.ImageID,
-		"destination", finalOutputPath,
-	)
+	o.logger.Info("Preparing contents", "imageID", input.ImageID)
+
+	contents, err := o.prepareContents(input, outputWorkspace.Dir(), finalOutputPath, o.contentProvider())
+	if err != nil {
+		return o.failImage(ctx, input, baseEvent, fmt.Sprintf("failed to prepare contents: %v", err), false, err)
+	}
 
 	var eventContents []model.Content
 	for _, c := range contents {
 		eventContents = append(eventContents, *c)
 	}
 
-	o.publishEvent(ctx, &events.ImageProcessCompleteEvent{
+	associated, err := readAssociatedImages(outputWorkspace.Dir(), finalOutputPath)
+	if err != nil {
+		o.logger.Warn("Failed to list associated images", "imageID", input.ImageID, "error", err)
+	}
+	qc, err := readQC(outputWorkspace.Dir())
+	if err != nil {
+		return o.failImage(ctx, input, baseEvent, err.Error(), false, err)
+	}
+
+	event := &events.ImageProcessCompleteEvent{
 		BaseEvent:         baseEvent,
 		ImageID:           input.ImageID,
 		ProcessingVersion: input.ProcessingVersion,
+		PipelineVersion:   o.imageProcessingService.PipelineVersion(ctx),
 		Success:           true,
+		Status:            vobj.StatusProcessed,
 		Contents:          eventContents,
+		Outputs:           outputURIs(contents),
+		AssociatedImages:  associated,
+		QC:                qc,
+		Metadata:          input.Metadata,
 		Result: &events.ProcessResult{
 			Width:  file.WidthValue(),
 			Height: file.HeightValue(),
 			Size:   file.SizeValue(),
+			Levels: file.Levels,
 		},
-	})
+	}
+
+	// A slide failing QC is uploaded with its result event, which is published once a
+	// reviewer releases it
+	held := o.config.QC.HoldFailed && qc != nil && qc.Verdict == model.QCVerdictFail
+	if held {
+		if err := o.writeHeldEvent(event, outputWorkspace.Dir()); err != nil {
+			return o.failImage(ctx, input, baseEvent, err.Error(), false, err)
+		}
+	}
+
+	o.setPhase(ctx, model.PhaseUploading)
+	o.logger.Info("Starting upload",
+		"imageID", input.ImageID,
+		"source", outputWorkspace.Dir(),
+		"destination", finalOutputPath,
+	)
+
+	if err := o.imageProcessingService.TrackStep(input.ImageID, "upload", func() error {
+		return o.storage.UploadDirectory(ctx, outputWorkspace.Dir(), finalOutputPath)
+	}); err != nil {
+		return o.failImage(ctx, input, baseEvent, err.Error(), !errors.IsNonRetryable(err), err)
+	}
+
+	o.logger.Info("Upload completed successfully",
+		"imageID", input.ImageID,
+		"destination", finalOutputPath,
+	)
 
-	if err := outputWorkspace.Remove(); err != nil {
-		o.logger.Warn("Failed to clean up output workspace",
+	o.setPhase(ctx, model.PhasePublishing)
+	if held {
+		o.logger.Warn("Slide failed QC, result held for review",
 			"imageID", input.ImageID,
-			"error", err,
+			"reasons", qc.Reasons,
+			"heldEvent", filepath.Join(finalOutputPath, qcHoldFilename),
 		)
+		o.recordStatus(ctx, input, vobj.StatusPendingReview, strings.Join(qc.Reasons, "; "), imageResult(file, finalOutputPath, contents))
+	} else {
+		o.publishEvent(ctx, event)
+		o.recordStatus(ctx, input, vobj.StatusProcessed, "", imageResult(file, finalOutputPath, contents))
+	}
+
+	if o.replica != nil {
+		o.mirrorToReplica(ctx, input.ImageID, finalOutputPath, outputWorkspace)
+	} else {
+		o.removeWorkspace(input.ImageID, outputWorkspace)
 	}
 
 	o.logger.Info("Image processing job completed successfully",
@@ -171,17 +340,208 @@ func (o *JobOrchestrator) ProcessJob(ctx context.Context, input *model.JobInput)
 	return nil
 }
 
-func (o *JobOrchestrator) constructInputPath(input *model.JobInput) string {
+func (o *JobOrchestrator) extractRegion(ctx context.Context, input *model.JobInput) error {
+	o.logger.Info("Starting region extraction job",
+		"imageID", input.ImageID,
+		"originPath", input.OriginPath,
+	)
 
-	if o.config.Env == config.EnvLocal {
+	baseEvent := o.newEvent(events.ImageRegionExtractCompleteEventType, input)
+	failed := func(err error) error {
+		event := &events.ImageRegionExtractCompleteEvent{
+			BaseEvent:     baseEvent,
+			ImageID:       input.ImageID,
+			Success:       false,
+			FailureReason: err.Error(),
+			Retryable:     !errors.IsNonRetryable(err),
+		}
+		if input.Region != nil {
+			event.Region = *input.Region
+		}
+		o.publishEvent(ctx, event)
+		return err
+	}
+
+	if input.Region == nil {
+		return failed(errors.NewValidationError("region is required for region extraction").
+			WithContext("imageID", input.ImageID))
+	}
+
+	file, err := model.NewFile(input.ImageID, input.OriginPath, "", nil, nil, nil, nil)
+	if err != nil {
+		return failed(err)
+	}
+
+	workspace, relPath, err := o.imageProcessingService.ExtractRegion(ctx, file, input.Region)
+	if err != nil {
+		return failed(err)
+	}
+	defer func() {
+		if err := workspace.Remove(); err != nil {
+			o.logger.Warn("Failed to clean up region workspace",
+				"imageID", input.ImageID,
+				"error", err,
+			)
+		}
+	}()
+
+	finalOutputPath := o.constructOutputPath(input.ImageID)
+	if err := o.storage.UploadDirectory(ctx, workspace.Dir(), finalOutputPath); err != nil {
+		return failed(err)
+	}
+
+	contentType := vobj.ContentTypeImagePNG
+	if input.Region.Format == model.RegionFormatTIFF {
+		contentType = vobj.ContentTypeImageTIFF
+	}
+
+	content, err := o.artifactContent(input.ImageID, workspace, relPath, finalOutputPath, contentType)
+	if err != nil {
+		return failed(err)
+	}
+
+	o.publishEvent(ctx, &events.ImageRegionExtractCompleteEvent{
+		BaseEvent: baseEvent,
+		ImageID:   input.ImageID,
+		Region:    *input.Region,
+		Content:   content,
+		Success:   true,
+	})
+
+	o.logger.Info("Region extraction job completed successfully",
+		"imageID", input.ImageID,
+		"path", content.Path,
+	)
+
+	return nil
+}
+
+func (o *JobOrchestrator) renderAnnotations(ctx context.Context, input *model.JobInput) error {
+	o.logger.Info("Starting annotation render job",
+		"imageID", input.ImageID,
+		"originPath", input.OriginPath,
+	)
+
+	baseEvent := o.newEvent(events.ImageAnnotationRenderCompleteEventType, input)
+	shapeCount := 0
+	if input.Annotations != nil {
+		shapeCount = len(input.Annotations.Shapes)
+	}
+	failed := func(err error) error {
+		o.publishEvent(ctx, &events.ImageAnnotationRenderCompleteEvent{
+			BaseEvent:     baseEvent,
+			ImageID:       input.ImageID,
+			Region:        input.Region,
+			ShapeCount:    shapeCount,
+			Success:       false,
+			FailureReason: err.Error(),
+			Retryable:     !errors.IsNonRetryable(err),
+		})
+		return err
+	}
+
+	if shapeCount == 0 {
+		return failed(errors.NewValidationError("annotations are required for annotation rendering").
+			WithContext("imageID", input.ImageID))
+	}
+
+	file, err := model.NewFile(input.ImageID, input.OriginPath, "", nil, nil, nil, nil)
+	if err != nil {
+		return failed(err)
+	}
+
+	renderSize := input.RenderSize
+	if renderSize <= 0 {
+		renderSize = model.DefaultAnnotationRenderSize
+	}
+
+	workspace, relPath, err := o.imageProcessingService.RenderAnnotations(ctx, file, input.Annotations, input.Region, renderSize)
+	if err != nil {
+		return failed(err)
+	}
+	defer func() {
+		if err := workspace.Remove(); err != nil {
+			o.logger.Warn("Failed to clean up annotation workspace",
+				"imageID", input.ImageID,
+				"error", err,
+			)
+		}
+	}()
+
+	finalOutputPath := o.constructOutputPath(input.ImageID)
+	if err := o.storage.UploadDirectory(ctx, workspace.Dir(), finalOutputPath); err != nil {
+		return failed(err)
+	}
+
+	content, err := o.artifactContent(input.ImageID, workspace, relPath, finalOutputPath, vobj.ContentTypeImagePNG)
+	if err != nil {
+		return failed(err)
+	}
+
+	o.publishEvent(ctx, &events.ImageAnnotationRenderCompleteEvent{
+		BaseEvent:  baseEvent,
+		ImageID:    input.ImageID,
+		Region:     input.Region,
+		ShapeCount: shapeCount,
+		Content:    content,
+		Success:    true,
+	})
+
+	o.logger.Info("Annotation render job completed successfully",
+		"imageID", input.ImageID,
+		"path", content.Path,
+	)
+
+	return nil
+}
+
+// artifactContent describes a single file produced by an on-demand job
+func (o *JobOrchestrator) artifactContent(imageID string, workspace *model.Workspace, relPath, finalOutputPath string, contentType vobj.ContentType) (*model.Content, error) {
+	localPath := workspace.Join(relPath)
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to stat job output").
+			WithContext("path", localPath)
+	}
+
+	return &model.Content{
+		Entity: vobj.Entity{
+			ID:         o.ids.NewID(),
+			Name:       filepath.Base(relPath),
+			EntityType: vobj.EntityTypeContent,
+			Parent: vobj.ParentRef{
+				ID:   imageID,
+				Type: vobj.ParentTypeImage,
+			},
+			CreatedAt: info.ModTime(),
+			UpdatedAt: info.ModTime(),
+		},
+		Provider:    o.contentProvider(),
+		Path:        filepath.Join(finalOutputPath, relPath),
+		ContentType: contentType,
+		Size:        info.Size(),
+		URI:         o.contentURI(o.contentProvider(), filepath.Join(finalOutputPath, relPath)),
+	}, nil
+}
+
+func (o *JobOrchestrator) contentProvider() vobj.ContentProvider {
+	if !o.config.UsesGCS() {
+		return vobj.ContentProviderLocal
+	}
+	return vobj.ContentProviderGCS
+}
+
+func (o *JobOrchestrator) constructInputPath(input *model.JobInput) string {
+	// Like the outputs, inputs are only local paths when no GCS (or emulator) is used
+	if !o.config.UsesGCS() {
 		return input.OriginPath
 	}
 	return filepath.Join("/gcs/"+o.config.GCP.InputBucketName, input.OriginPath)
 }
 
 func (o *JobOrchestrator) constructOutputPath(imageID string) string {
-	// if GCS upload is used and not local env, return imageID as is
-	if o.config.Env != config.EnvLocal {
+	// if GCS upload is used (cloud env or storage emulator), return imageID as is
+	if o.config.UsesGCS() {
 		return imageID
 	}
 
@@ -195,17 +555,29 @@ func (o *JobOrchestrator) constructOutputPath(imageID string) string {
 	return o.config.OutputRootPath
 }
 
-func (o *JobOrchestrator) publishEvent(ctx context.Context, event *events.ImageProcessCompleteEvent) error {
+func (o *JobOrchestrator) publishEvent(ctx context.Context, event events.ImageEvent) error {
 	data, err := o.eventSerializer.Serialize(event)
 	if err != nil {
 		return fmt.Errorf("failed to serialize event: %w", err)
 	}
 
 	attributes := map[string]string{
-		"event_type": string(event.EventType),
-		"image_id":   event.ImageID,
+		"event_type": string(event.GetEventType()),
+		"image_id":   event.GetImageID(),
+	}
+	// Subscribers of a shared topic filter on the tenant
+	if o.config.Tenant != "" {
+		attributes["tenant"] = o.config.Tenant
+	}
+	// Consumers collect the events about one request without decoding them
+	if correlationID := event.GetCorrelationID(); correlationID != "" {
+		attributes["correlation_id"] = correlationID
 	}
 
+	// Results go out under the reserved time, also when the job ran out of time or was
+	// shut down, and are retried also when the job used up its retry budget
+	ctx, cancel := deadline.Reserved(retry.WithoutBudget(ctx))
+	defer cancel()
 	return o.publisher.Publish(ctx, o.config.ImageProcessingTopicID, data, attributes)
 }
 
@@ -230,7 +602,7 @@ func (o *JobOrchestrator) prepareContents(input *model.JobInput, sourceDir strin
 
 		content := &model.Content{
 			Entity: vobj.Entity{
-				ID:         uuid.New().String(),
+				ID:         o.ids.NewID(),
 				Name:       filename,
 				EntityType: vobj.EntityTypeContent,
 				Parent:     parent,
@@ -242,11 +614,20 @@ func (o *JobOrchestrator) prepareContents(input *model.JobInput, sourceDir strin
 			ContentType:   contentType,
 			Size:          info.Size(),
 			UploadPending: false,
+			URI:           o.contentURI(contentProvider, filepath.Join(finalOutputPath, filename)),
 		}
 		contents = append(contents, content)
 		return nil
 	}
 
+	// Helper for artifacts that are not produced on every run
+	addOptionalContent := func(filename string, contentType vobj.ContentType) error {
+		if _, err := os.Stat(filepath.Join(sourceDir, filename)); os.IsNotExist(err) {
+			return nil
+		}
+		return addContent(filename, contentType)
+	}
+
 	// Add Thumbnail
 	if err := addContent("thumbnail.jpg", vobj.ContentTypeThumbnailJPEG); err != nil {
 		return nil, err
@@ -266,6 +647,10 @@ func (o *JobOrchestrator) prepareContents(input *model.JobInput, sourceDir strin
 		if err := addContent("tiles", vobj.ContentTypeApplicationOctetStream); err != nil {
 			return nil, err
 		}
+		// Tile references, written when identical tiles were deduplicated
+		if err := addOptionalContent("IndexMap.json", vobj.ContentTypeApplicationJSON); err != nil {
+			return nil, err
+		}
 	} else {
 		// v2: Zip and IndexMap
 		if err := addContent("image.zip", vobj.ContentTypeApplicationZip); err != nil {
@@ -276,5 +661,157 @@ func (o *JobOrchestrator) prepareContents(input *model.JobInput, sourceDir strin
 		}
 	}
 
+	// Add OME-TIFF pyramid (image.ome.tif)
+	if err := addOptionalContent(omeTIFFFilename, vobj.ContentTypeImageTIFF); err != nil {
+		return nil, err
+	}
+
+	// Add pixel statistics (stats.json)
+	if err := addOptionalContent("stats.json", vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add slide QC verdict (qc.json)
+	if err := addOptionalContent(qcFilename, vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add processing report (report.json)
+	if err := addOptionalContent("report.json", vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add pipeline stamp (pipeline.json)
+	if err := addOptionalContent(pipelineFilename, vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add output checksums (checksums.json)
+	if err := addOptionalContent(checksumsFilename, vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add upload manifest (upload-manifest.json)
+	if err := addOptionalContent(uploadManifestFilename, vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+
+	// Add associated images (associated.json, associated/<name>.png)
+	if err := addOptionalContent(associatedManifest, vobj.ContentTypeApplicationJSON); err != nil {
+		return nil, err
+	}
+	associated, err := readAssociatedImages(sourceDir, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range associated {
+		if err := addContent(image.Path, vobj.ContentTypeImagePNG); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add per-level overviews (overviews/overview_<n>x.jpg)
+	overviews, err := os.ReadDir(filepath.Join(sourceDir, overviewsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list overviews: %w", err)
+	}
+	for _, entry := range overviews {
+		if entry.IsDir() {
+			continue
+		}
+		if err := addContent(filepath.Join(overviewsDir, entry.Name()), vobj.ContentTypeImageJPEG); err != nil {
+			return nil, err
+		}
+	}
+
 	return contents, nil
 }
+
+// MigrateJob converts the fs-layout outputs of an image to the zip container in place
+// and publishes a v2 completion event with the new contents, so downstream records
+// point at image.zip
+func (o *JobOrchestrator) MigrateJob(ctx context.Context, imageID string, keepTiles bool) error {
+	prefix, record, err := o.storedOutputs(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	// Removing tiles/ would break the contents of the other images using the outputs
+	if !keepTiles {
+		shared, err := o.sharingImages(ctx, record)
+		if err != nil {
+			return err
+		}
+		if len(shared) > 0 {
+			return errors.NewValidationError("outputs are shared with other images, migrate with --keep-tiles").
+				WithContext("imageID", imageID).
+				WithContext("sharedWith", shared)
+		}
+	}
+	descriptor, err := o.imageProcessingService.MigrateToZip(ctx, imageID, prefix, keepTiles)
+	if err != nil {
+		return err
+	}
+	return o.publishStoredContents(ctx, imageID, prefix, "v2", descriptor)
+}
+
+// RetileJob regenerates the pyramid levels below fromLevel of the fs-layout outputs
+// of an image from its stored tiles and publishes a v1 completion event, so records
+// pick up the changed tiles without a full reprocess
+func (o *JobOrchestrator) RetileJob(ctx context.Context, imageID string, fromLevel int) error {
+	prefix, _, err := o.storedOutputs(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	descriptor, err := o.imageProcessingService.RetileLowLevels(ctx, imageID, prefix, fromLevel)
+	if err != nil {
+		return err
+	}
+	return o.publishStoredContents(ctx, imageID, prefix, "v1", descriptor)
+}
+
+// publishStoredContents publishes a completion event listing the outputs of an image
+// as they are stored under prefix on the output mount
+func (o *JobOrchestrator) publishStoredContents(ctx context.Context, imageID, prefix, processingVersion string, descriptor *dzi.Descriptor) error {
+	event, err := o.storedContentsEvent(imageID, prefix, processingVersion, descriptor)
+	if err != nil {
+		return err
+	}
+	return o.publishEvent(ctx, event)
+}
+
+// storedContentsEvent builds the completion event of an image listing the outputs
+// stored under outputDir on the output mount
+func (o *JobOrchestrator) storedContentsEvent(imageID, outputDir, processingVersion string, descriptor *dzi.Descriptor) (*events.ImageProcessCompleteEvent, error) {
+	input := &model.JobInput{
+		ImageID:           imageID,
+		ProcessingVersion: processingVersion,
+		JobType:           model.JobTypeProcess,
+	}
+	finalOutputPath := outputDir
+	if !o.config.UsesGCS() {
+		finalOutputPath = filepath.Join(o.config.Storage.OutputMountPath, outputDir)
+	}
+	contents, err := o.prepareContents(input, filepath.Join(o.config.Storage.OutputMountPath, outputDir), finalOutputPath, o.contentProvider())
+	if err != nil {
+		return nil, errors.WrapInternalError(err, "failed to prepare stored contents").
+			WithContext("imageID", imageID)
+	}
+
+	var eventContents []model.Content
+	for _, c := range contents {
+		eventContents = append(eventContents, *c)
+	}
+
+	return &events.ImageProcessCompleteEvent{
+		BaseEvent:         events.NewBaseEventWith(events.ImageProcessCompleteEventType, o.clock, o.ids),
+		ImageID:           imageID,
+		ProcessingVersion: processingVersion,
+		Success:           true,
+		Contents:          eventContents,
+		Outputs:           outputURIs(contents),
+		Result: &events.ProcessResult{
+			Width:  descriptor.Width,
+			Height: descriptor.Height,
+		},
+	}, nil
+}
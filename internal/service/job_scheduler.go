@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// JobCost is what a job is expected to claim of the worker while it runs
+type JobCost struct {
+	Format       string
+	InputSize    int64
+	MemoryBytes  int64
+	ScratchBytes int64
+}
+
+// JobScheduler admits the slides of a `himgproc process-dir` batch by their estimated
+// cost instead of a fixed count: a slide starts once its memory fits next to the
+// slides already running and its scratch fits the scratch budget. A batch on a worker
+// with plenty of memory runs many streamed slides at once, while two DNGs that would
+// not fit together are never co-scheduled. A Cloud Run job processes one image, which
+// is admitted at once.
+type JobScheduler struct {
+	logger   *slog.Logger
+	config   config.SchedulerConfig
+	memory   config.MemoryConfig
+	sem      *semaphore.Weighted
+	capacity int64
+	scratch  *ScratchBudget
+}
+
+func NewJobScheduler(logger *slog.Logger, cfg *config.Config) *JobScheduler {
+	capacity := int64(cfg.Scheduler.MemoryMB) << 20
+	if capacity == 0 {
+		// The rest of the limit is headroom for the process and estimation errors
+		capacity = cfg.Memory.LimitBytes * 8 / 10
+	}
+	if capacity <= 0 {
+		// No memory limit known: only the scratch budget gates the jobs
+		capacity = 1 << 62
+	}
+
+	logger.Info("Job scheduler initialized",
+		"memoryCapacityMB", capacity>>20,
+		"jobBaseMB", cfg.Scheduler.JobBaseMB,
+		"maxJobs", cfg.Scheduler.MaxJobs)
+
+	return &JobScheduler{
+		logger:   logger,
+		config:   cfg.Scheduler,
+		memory:   cfg.Memory,
+		sem:      semaphore.NewWeighted(capacity),
+		capacity: capacity,
+		scratch:  NewScratchBudget(logger, cfg.Scratch),
+	}
+}
+
+// Cost estimates the memory and scratch of a job on file, an input of inputSize bytes.
+// Formats decoded fully into memory (DNG) cost their decoded size; formats vips decodes
+// before tiling (JPEG, PNG) cost it up to VIPS_DISC_THRESHOLD_MB, past which vips
+// decodes to disk; tiled slides are streamed and only cost the base.
+func (s *JobScheduler) Cost(file *model.File, inputSize int64) JobCost {
+	format := file.Extension()
+	decoded := int64(float64(inputSize) * s.config.FormatFactors[format])
+	if !fullDecodeFormats[format] && s.memory.VipsDiscMB > 0 {
+		decoded = min(decoded, int64(s.memory.VipsDiscMB)<<20)
+	}
+
+	return JobCost{
+		Format:       format,
+		InputSize:    inputSize,
+		MemoryBytes:  max(1, int64(s.config.JobBaseMB)<<20+decoded),
+		ScratchBytes: s.scratch.Estimate(inputSize),
+	}
+}
+
+// Admit blocks until the job fits, first its memory and then its scratch. The returned
+// func releases both. Like the scratch budget, a job estimated above the whole memory
+// capacity is not rejected, it waits to run alone.
+func (s *JobScheduler) Admit(ctx context.Context, cost JobCost) (func(), error) {
+	startedAt := time.Now()
+
+	memory := cost.MemoryBytes
+	if memory > s.capacity {
+		s.logger.Warn("Job memory estimate exceeds scheduler capacity, running it exclusively",
+			"format", cost.Format,
+			"requiredMB", memory>>20,
+			"capacityMB", s.capacity>>20)
+		memory = s.capacity
+	}
+
+	if !s.sem.TryAcquire(memory) {
+		s.logger.Info("Waiting for memory", "format", cost.Format, "requiredMB", memory>>20)
+		if err := s.sem.Acquire(ctx, memory); err != nil {
+			return nil, errors.WrapTimeoutError(err, "gave up waiting for memory").
+				WithContext("required_mb", memory>>20)
+		}
+	}
+
+	releaseScratch, err := s.scratch.Acquire(ctx, cost.ScratchBytes)
+	if err != nil {
+		s.sem.Release(memory)
+		return nil, err
+	}
+
+	s.logger.Info("Job admitted",
+		"format", cost.Format,
+		"inputMB", cost.InputSize>>20,
+		"memoryMB", memory>>20,
+		"scratchMB", cost.ScratchBytes>>20,
+		"waited", time.Since(startedAt).Round(time.Millisecond))
+
+	return func() {
+		releaseScratch()
+		s.sem.Release(memory)
+	}, nil
+}
+
+// MaxJobs is the upper bound of jobs running at once, SCHEDULER_MAX_JOBS or one per CPU.
+// Jobs past it are not even estimated until a running one finishes.
+func (s *JobScheduler) MaxJobs() int {
+	if s.config.MaxJobs > 0 {
+		return s.config.MaxJobs
+	}
+	return runtime.NumCPU()
+}
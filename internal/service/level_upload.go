@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+const levelPollInterval = 2 * time.Second
+
+// levelUploader copies fs-container pyramid levels to output storage while dzsave
+// is still running. A watcher emits levels whose tile count matches the expected
+// grid and that have been quiet for a poll interval; an uploader consumes them.
+// The bounded channel holds the watcher back when uploads fall behind.
+type levelUploader struct {
+	s          *ImageProcessingService
+	workspace  *model.Workspace
+	imageID    string
+	filesDir   string
+	descriptor *dzi.Descriptor
+
+	levels chan int
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	err    error
+}
+
+// uploadsLevelsEarly reports whether GenerateDZI uploads finished levels of an fs
+// container to <image-id>/tiles while dzsave runs. Content-addressed outputs are
+// uploaded by the orchestrator under the checksum once processing is done; levels
+// uploaded early would be left behind under the image ID.
+func (s *ImageProcessingService) uploadsLevelsEarly(container string) bool {
+	cfg := s.config.DZIConfig
+	return container == "fs" && cfg.LevelUpload && cfg.Layout == "dz" && !s.config.ContentAddress.Enabled
+}
+
+func (s *ImageProcessingService) startLevelUploader(ctx context.Context, file *model.File, workspace *model.Workspace) *levelUploader {
+	cfg := s.config.DZIConfig
+	u := &levelUploader{
+		s:         s,
+		workspace: workspace,
+		imageID:   file.ID,
+		filesDir:  workspace.Join("image_files"),
+		descriptor: &dzi.Descriptor{
+			TileSize: cfg.TileSize,
+			Overlap:  cfg.Overlap,
+			Format:   dzi.FormatForSuffix(cfg.Suffix),
+			Width:    file.WidthValue(),
+			Height:   file.HeightValue(),
+		},
+		levels: make(chan int, cfg.LevelUploadQueue),
+		stop:   make(chan struct{}),
+	}
+
+	u.wg.Add(2)
+	go u.watch(ctx)
+	go u.upload(ctx)
+	return u
+}
+
+// Stop ends the watcher, drains pending uploads and returns the first upload error
+func (u *levelUploader) Stop() error {
+	close(u.stop)
+	u.wg.Wait()
+	return u.err
+}
+
+func (u *levelUploader) watch(ctx context.Context) {
+	defer u.wg.Done()
+	defer close(u.levels)
+
+	ticker := time.NewTicker(levelPollInterval)
+	defer ticker.Stop()
+
+	emitted := make(map[int]bool)
+	lastCount := make(map[int]int)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-u.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for level := 0; level < u.descriptor.LevelCount(); level++ {
+			if emitted[level] {
+				continue
+			}
+			entries, err := os.ReadDir(filepath.Join(u.filesDir, strconv.Itoa(level)))
+			if err != nil {
+				continue
+			}
+			count := len(entries)
+
+			// Complete and unchanged since the previous poll, so the last tile is flushed
+			if count == u.descriptor.ExpectedTiles(level) && lastCount[level] == count {
+				emitted[level] = true
+				select {
+				case u.levels <- level:
+				case <-ctx.Done():
+					return
+				case <-u.stop:
+					return
+				}
+			}
+			lastCount[level] = count
+		}
+	}
+}
+
+func (u *levelUploader) upload(ctx context.Context) {
+	defer u.wg.Done()
+
+	for level := range u.levels {
+		if u.err != nil {
+			continue
+		}
+
+		localDir := filepath.Join(u.filesDir, strconv.Itoa(level))
+		relDir := filepath.Join("tiles", strconv.Itoa(level))
+
+		startedAt := time.Now()
+		if err := u.s.putTileLevel(ctx, u.workspace, localDir, relDir, u.imageID); err != nil {
+			u.s.logger.Warn("Early level upload failed, level will be copied with the final outputs",
+				"fileID", u.imageID,
+				"level", level,
+				"error", err)
+			u.err = err
+			continue
+		}
+		u.workspace.MarkUploaded(relDir)
+
+		u.s.logger.Info("Uploaded completed pyramid level",
+			"fileID", u.imageID,
+			"level", level,
+			"durationMs", time.Since(startedAt).Milliseconds())
+	}
+}
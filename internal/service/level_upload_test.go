@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+// fakeDZSave stands in for vips: it writes a one-tile pyramid, then keeps running for
+// more than two level polls so a level uploader sees the level complete
+const fakeDZSave = `#!/bin/sh
+mkdir -p "$3_files/0"
+echo tile > "$3_files/0/0_0.jpg"
+echo dzi > "$3.dzi"
+sleep 5
+`
+
+// recordingStorage records the remote paths written to and deleted from it
+type recordingStorage struct {
+	mu      sync.Mutex
+	paths   []string
+	deletes []string
+}
+
+func (s *recordingStorage) PutFile(ctx context.Context, localPath, remotePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, remotePath)
+	return nil
+}
+
+func (s *recordingStorage) PutDirectory(ctx context.Context, localDir, remoteDir string) error {
+	return s.PutFile(ctx, localDir, remoteDir)
+}
+
+func (s *recordingStorage) Delete(ctx context.Context, remotePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletes = append(s.deletes, remotePath)
+	return nil
+}
+
+func (s *recordingStorage) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...)
+}
+
+func (s *recordingStorage) deleted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.deletes...)
+}
+
+func TestGenerateDZILevelUpload(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for level polls")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "vips"), []byte(fakeDZSave), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	for _, tc := range []struct {
+		name           string
+		contentAddress bool
+		wantUploads    bool
+	}{
+		{name: "image ID outputs", wantUploads: true},
+		// The orchestrator uploads content-addressed outputs under the checksum, nothing
+		// may land under the image ID
+		{name: "content-addressed outputs", contentAddress: true, wantUploads: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.Config{
+				DZIConfig: config.DZIConfig{
+					TileSize:         256,
+					Quality:          85,
+					Layout:           "dz",
+					Suffix:           "jpg",
+					LevelUpload:      true,
+					LevelUploadQueue: 2,
+				},
+				ImageProcessTimeoutMinute: config.ImageProcessTimeoutMinute{DZIConversion: 1},
+				ContentAddress:            config.ContentAddressConfig{Enabled: tc.contentAddress, Prefix: "content"},
+			}
+			output := &recordingStorage{}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			s := NewImageProcessingService(logger, cfg, nil, output)
+
+			inputDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(inputDir, "slide.tif"), []byte("slide"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			width, height := 100, 100
+			file, err := model.NewFile("img-1", "slide.tif", inputDir, &width, &height, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			workspace, err := model.NewWorkspace(file, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.GenerateDZI(context.Background(), file, workspace, "fs"); err != nil {
+				t.Fatalf("GenerateDZI: %v", err)
+			}
+
+			written := output.written()
+			if tc.wantUploads && len(written) == 0 {
+				t.Fatalf("no level was uploaded while dzsave ran")
+			}
+			if !tc.wantUploads && len(written) > 0 {
+				t.Errorf("objects were written under the image ID: %v", written)
+			}
+			for _, path := range written {
+				if want := filepath.Join("img-1", "tiles", "0"); path != want {
+					t.Errorf("uploaded %s, want %s", path, want)
+				}
+			}
+		})
+	}
+}
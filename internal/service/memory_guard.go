@@ -0,0 +1,39 @@
+package service
+
+import (
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+// fullDecodeFormats are inputs whose converter holds the whole image in memory
+// rather than streaming it (dcraw decodes DNG into a single 16-bit buffer)
+var fullDecodeFormats = map[string]bool{
+	".dng": true,
+}
+
+// checkMemoryBudget rejects inputs that would be decoded fully into memory and do
+// not fit the container memory limit, so they fail fast with a clear reason
+// instead of being killed with exit 137 part way through
+func (s *ImageProcessingService) checkMemoryBudget(file *model.File) error {
+	maxPixels := s.config.Memory.MaxInputPixels
+	if maxPixels <= 0 || !fullDecodeFormats[file.Extension()] {
+		return nil
+	}
+
+	pixels := int64(file.WidthValue()) * int64(file.HeightValue())
+	if pixels <= maxPixels {
+		return nil
+	}
+
+	s.logger.Error("Input exceeds the memory budget of this worker",
+		"fileID", file.ID,
+		"pixels", pixels,
+		"maxInputPixels", maxPixels,
+		"memoryLimitMB", s.config.Memory.LimitBytes>>20,
+		"workerType", s.config.WorkerType)
+
+	return tooLargeError(s.config, "input image exceeds the memory budget of this worker").
+		WithContext("fileID", file.ID).
+		WithContext("pixels", pixels).
+		WithContext("max_input_pixels", maxPixels).
+		WithContext("memory_limit_mb", s.config.Memory.LimitBytes>>20)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+)
+
+// zipTilePrefix is where dzsave --container zip puts the pyramid inside image.zip
+const zipTilePrefix = "image/image_files/"
+
+// MigrateToZip converts the published fs-layout outputs of an image (tiles/ plus
+// optional IndexMap.json references) into the zip container in place. image.zip and
+// its IndexMap.json are written next to the tiles and validated before tiles/ is
+// removed; on failure the fs outputs are left as they were. prefix is where the
+// outputs are on the output storage, <image-id> unless content-addressed. It returns
+// the descriptor of the migrated image.
+func (s *ImageProcessingService) MigrateToZip(ctx context.Context, imageID, prefix string, keepTiles bool) (*dzi.Descriptor, error) {
+	dir := filepath.Join(s.config.Storage.OutputMountPath, prefix)
+
+	before, err := s.ValidateStored(ctx, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	if before.Container == "zip" {
+		return nil, errors.NewValidationError("outputs already use the zip container").
+			WithContext("imageID", imageID)
+	}
+	if !before.OK() {
+		return nil, errors.NewValidationError("fs outputs are incomplete, reprocess the image instead").
+			WithContext("imageID", imageID).
+			WithContext("missing", before.MissingCount).
+			WithContext("issues", len(before.Issues))
+	}
+
+	var references map[string]string
+	indexPath := filepath.Join(dir, "IndexMap.json")
+	previousIndex, err := os.ReadFile(indexPath)
+	if err == nil {
+		index, err := s.zipProcessor.ReadIndexMap(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		references = index.References
+	} else if !os.IsNotExist(err) {
+		return nil, errors.WrapStorageError(err, "failed to read index map").
+			WithContext("file", indexPath)
+	}
+
+	file, err := model.NewFile(imageID, "image.dzi", dir, nil, nil, nil, nil)
+	if err != nil {
+		return nil, errors.WrapValidationError(err, "invalid image ID").
+			WithContext("imageID", imageID)
+	}
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to create workspace").
+			WithContext("imageID", imageID)
+	}
+	defer workspace.Remove()
+
+	s.logger.Info("Migrating outputs to zip container",
+		"imageID", imageID,
+		"levels", len(before.Levels),
+		"references", len(references))
+
+	zipPath := workspace.Join("image.zip")
+	if err := writeTileZip(ctx, dir, zipPath, references, s.config.DZIConfig.Compression, s.clock.Now()); err != nil {
+		return nil, err
+	}
+	if _, err := s.zipProcessor.BuildIndexMap(ctx, zipPath, workspace.Dir(), nil); err != nil {
+		return nil, err
+	}
+
+	// image.zip goes first: readers switch to the zip container as soon as it exists
+	for _, name := range []string{"image.zip", "IndexMap.json"} {
+		if err := s.outputStorage.PutFile(ctx, workspace.Join(name), filepath.Join(prefix, name)); err != nil {
+			s.rollbackMigration(ctx, imageID, prefix, previousIndex)
+			return nil, errors.WrapStorageError(err, "failed to copy migrated outputs").
+				WithContext("imageID", imageID).
+				WithContext("file", name)
+		}
+	}
+
+	after, err := s.ValidateStored(ctx, dir, false)
+	if err == nil && !after.OK() {
+		err = errors.NewProcessingError("migrated zip container failed validation").
+			WithContext("missing", after.MissingCount).
+			WithContext("issues", len(after.Issues))
+	}
+	if err != nil {
+		s.rollbackMigration(ctx, imageID, prefix, previousIndex)
+		return nil, err
+	}
+
+	if !keepTiles {
+		if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, "tiles")); err != nil {
+			return nil, err
+		}
+	}
+
+	// checksums.json and upload-manifest.json described the fs layout
+	if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, checksumsFilename)); err != nil {
+		s.logger.Warn("Failed to remove stale checksums", "imageID", imageID, "error", err)
+	}
+	if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, uploadManifestFilename)); err != nil {
+		s.logger.Warn("Failed to remove stale upload manifest", "imageID", imageID, "error", err)
+	}
+
+	s.logger.Info("Outputs migrated to zip container",
+		"imageID", imageID,
+		"tilesRemoved", !keepTiles)
+
+	return after.Descriptor, nil
+}
+
+// rollbackMigration removes a partially copied zip container and restores the fs index map
+func (s *ImageProcessingService) rollbackMigration(ctx context.Context, imageID, prefix string, previousIndex []byte) {
+	// Roll back also when the migration failed because the job ran out of time
+	ctx, cancel := deadline.Reserved(ctx)
+	defer cancel()
+
+	if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, "image.zip")); err != nil {
+		s.logger.Error("Failed to remove image.zip during rollback", "imageID", imageID, "error", err)
+	}
+
+	indexPath := filepath.Join(s.config.Storage.OutputMountPath, prefix, "IndexMap.json")
+	var err error
+	if previousIndex != nil {
+		err = os.WriteFile(indexPath, previousIndex, 0644)
+	} else {
+		err = os.Remove(indexPath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		s.logger.Error("Failed to restore IndexMap.json during rollback", "imageID", imageID, "error", err)
+	}
+}
+
+// writeTileZip packs image.dzi and the tiles/ pyramid of dir into a zip laid out like
+// dzsave --container zip. Referenced (deduplicated) tiles are written with the bytes
+// of their canonical tile.
+func writeTileZip(ctx context.Context, dir, zipPath string, references map[string]string, compression int, modified time.Time) error {
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to create zip").
+			WithContext("zip", zipPath)
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	method := zip.Store
+	if compression > 0 {
+		method = zip.Deflate
+		w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, compression)
+		})
+	}
+
+	add := func(name, srcPath string) error {
+		src, err := os.Open(srcPath)
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to open tile").
+				WithContext("file", srcPath)
+		}
+		defer src.Close()
+
+		dst, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to add zip entry").
+				WithContext("entry", name)
+		}
+		if _, err := fsutil.Copy(ctx, dst, src, fsutil.Options{Op: "zip packing"}); err != nil {
+			return errors.WrapStorageError(err, "failed to write zip entry").
+				WithContext("entry", name)
+		}
+		return nil
+	}
+
+	if err := add("image/image.dzi", filepath.Join(dir, "image.dzi")); err != nil {
+		return err
+	}
+
+	tilesDir := filepath.Join(dir, "tiles")
+	err = filepath.WalkDir(tilesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(tilesDir, path)
+		if err != nil {
+			return err
+		}
+		return add(zipTilePrefix+filepath.ToSlash(rel), path)
+	})
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to pack tiles").
+			WithContext("tiles_dir", tilesDir)
+	}
+
+	refs := make([]string, 0, len(references))
+	for ref := range references {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		canonical := strings.TrimPrefix(filepath.ToSlash(references[ref]), "tiles/")
+		name := zipTilePrefix + strings.TrimPrefix(filepath.ToSlash(ref), "tiles/")
+		if err := add(name, filepath.Join(tilesDir, filepath.FromSlash(canonical))); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.WrapStorageError(err, "failed to finish zip").
+			WithContext("zip", zipPath)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+)
+
+const omeTIFFFilename = "image.ome.tif"
+
+// GenerateOMETIFF writes the image as an OME-TIFF pyramid to image.ome.tif, for
+// viewers and analysis tools that read OME-TIFF rather than DZI. Inputs that vips
+// cannot open, tiled from an OpenSlide preview, get none.
+func (s *ImageProcessingService) GenerateOMETIFF(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	if workspace.Preview() != "" {
+		s.logger.Warn("Skipping OME-TIFF, the input is only readable through OpenSlide",
+			"fileID", file.ID)
+		return nil
+	}
+
+	cfg := s.config.Output
+	inputFilePath := s.sourcePath(file, workspace)
+	opts := processors.PyramidOptions{
+		TileSize:    cfg.OMETIFFTileSize,
+		Compression: cfg.OMETIFFCompression,
+		Quality:     cfg.OMETIFFQuality,
+		Name:        file.Filename,
+	}
+
+	if processors.IsWholeSlideFormat(file.Extension()) {
+		// OpenSlide reads slides as RGBA
+		opts.Flatten = cfg.OMETIFFCompression == "jpeg"
+		slide, err := s.fileInfoProcessor.GetSlideProperties(ctx, file.AbsolutePath())
+		if err != nil {
+			s.logger.Warn("Slide properties unavailable, OME-TIFF has no physical pixel size",
+				"fileID", file.ID,
+				"error", err)
+		} else {
+			opts.MPPX, opts.MPPY = slide.MPPX, slide.MPPY
+		}
+	} else if cfg.OMETIFFCompression == "jpeg" {
+		info, err := s.vipsProcessor.GetBandInfo(ctx, inputFilePath)
+		if err != nil {
+			return err
+		}
+		opts.Flatten = (info.Bands == 2 || info.Bands == 4) && info.Interpretation != "multiband"
+	}
+
+	s.logger.Info("Generating OME-TIFF",
+		"fileID", file.ID,
+		"tileSize", opts.TileSize,
+		"compression", opts.Compression,
+		"flatten", opts.Flatten)
+
+	outputFilePath := workspace.Join(omeTIFFFilename)
+	result, err := s.pyramidProcessor.CreateOMETIFF(ctx, inputFilePath, outputFilePath, opts,
+		s.config.ImageProcessTimeoutMinute.DZIConversion)
+	if err != nil {
+		stderr := ""
+		if result != nil {
+			stderr = result.Stderr
+		}
+		s.logger.Error("OME-TIFF generation failed",
+			"fileID", file.ID,
+			"stderr", stderr,
+			"error", err)
+		return err
+	}
+
+	s.logger.Info("OME-TIFF generated",
+		"fileID", file.ID,
+		"outputFile", filepath.Base(outputFilePath))
+	return nil
+}
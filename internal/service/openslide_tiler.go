@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const openSlidePreviewFilename = "openslide_preview.png"
+
+// PrepareOpenSlideTiler switches a whole-slide image that vips cannot open but
+// OpenSlide can to the OpenSlide tiler: the largest slide level within
+// OPENSLIDE_TILER_PREVIEW_SIZE (or the smallest level, scaled down to it) is rendered
+// in chunks as the preview of the workspace, and GenerateDZI then tiles the pyramid
+// through OpenSlide. Images vips can open are left alone.
+func (s *ImageProcessingService) PrepareOpenSlideTiler(ctx context.Context, file *model.File, workspace *model.Workspace, container string) error {
+	if !s.config.OpenSlideTiler.Enabled || !processors.IsWholeSlideFormat(file.Extension()) {
+		return nil
+	}
+	vipsErr := s.vipsProcessor.CanOpen(ctx, file.AbsolutePath())
+	if vipsErr == nil {
+		return nil
+	}
+
+	slide, err := s.fileInfoProcessor.GetSlideProperties(ctx, file.AbsolutePath())
+	if err != nil || len(slide.Levels) == 0 {
+		// Neither can open it, the vips error is the one the other steps would run into
+		return vipsErr
+	}
+	if container != "fs" {
+		return errors.NewValidationError("vips cannot open the slide and the OpenSlide tiler only writes fs containers").
+			WithContext("fileID", file.ID).
+			WithContext("container", container)
+	}
+
+	cfg := s.config.OpenSlideTiler
+	level := previewLevel(slide.Levels, cfg.PreviewSize)
+	s.logger.Warn("vips cannot open the slide, tiling through OpenSlide",
+		"fileID", file.ID,
+		"vendor", slide.Vendor,
+		"previewLevel", level,
+		"vipsError", vipsErr)
+
+	// Slides without a level within the preview size fall back to their smallest level,
+	// which is read in chunks and scaled down, up to a cap on its pixels
+	pixels := int64(slide.Levels[level].Width) * int64(slide.Levels[level].Height)
+	if cfg.PreviewMaxMegapixels > 0 && pixels > cfg.PreviewMaxMegapixels*1_000_000 {
+		return errors.NewValidationError("the smallest slide level is too large for an OpenSlide preview").
+			WithContext("fileID", file.ID).
+			WithContext("level", level).
+			WithContext("megapixels", pixels/1_000_000).
+			WithContext("max_megapixels", cfg.PreviewMaxMegapixels)
+	}
+
+	previewPath := workspace.Join(openSlidePreviewFilename)
+	size, err := s.openSlideProc.ReadLevelScaled(ctx, file.AbsolutePath(), slide.Levels, level,
+		cfg.PreviewSize, cfg.PreviewChunkSize,
+		previewPath, s.config.ImageProcessTimeoutMinute.FormatConversion)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("OpenSlide preview rendered",
+		"fileID", file.ID,
+		"level", level,
+		"width", size.X,
+		"height", size.Y)
+	workspace.SetPreview(previewPath)
+	return nil
+}
+
+// generateDZIWithOpenSlide tiles the pyramid of the slide through OpenSlide into the
+// same image.dzi and image_files as dzsave
+func (s *ImageProcessingService) generateDZIWithOpenSlide(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	slide, err := s.fileInfoProcessor.GetSlideProperties(ctx, file.AbsolutePath())
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("Tiling through OpenSlide",
+		"fileID", file.ID,
+		"levels", len(slide.Levels),
+		"chunkTiles", s.config.OpenSlideTiler.ChunkTiles)
+
+	descriptor, err := s.openSlideProc.CreateDZI(ctx, slide, file.AbsolutePath(), workspace.Join("image"),
+		s.config.DZIConfig,
+		s.config.OpenSlideTiler.ChunkTiles,
+		max(1, s.config.WorkerProfile.Parallelism),
+		s.config.ImageProcessTimeoutMinute.General,
+		s.dziProgress(file.ID))
+	if err != nil {
+		s.logger.Error("OpenSlide tiling failed",
+			"fileID", file.ID,
+			"error", err)
+		return err
+	}
+
+	s.logger.Info("OpenSlide tiling succeeded",
+		"fileID", file.ID,
+		"tiles", descriptor.TotalTiles())
+	return nil
+}
+
+// previewSource is the file steps that only need the whole image at low resolution
+// read: the OpenSlide preview when vips cannot open the source
+func (s *ImageProcessingService) previewSource(file *model.File, workspace *model.Workspace) string {
+	if preview := workspace.Preview(); preview != "" {
+		return preview
+	}
+	return s.sourcePath(file, workspace)
+}
+
+// previewLevel is the largest slide level whose longest edge is within maxSize, or
+// the smallest level when none is
+func previewLevel(levels []processors.SlideLevel, maxSize int) int {
+	best := len(levels) - 1
+	for i := len(levels) - 1; i >= 0; i-- {
+		if max(levels[i].Width, levels[i].Height) <= maxSize {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/imagehash"
+)
+
+// OutputDiff is the divergence between two stored outputs of the same image, e.g. the
+// pyramids written by the deployed and by a candidate vips version
+type OutputDiff struct {
+	A           string          `json:"a"`
+	B           string          `json:"b"`
+	ContainerA  string          `json:"container_a"`
+	ContainerB  string          `json:"container_b"`
+	DescriptorA *dzi.Descriptor `json:"descriptor_a,omitempty"`
+	DescriptorB *dzi.Descriptor `json:"descriptor_b,omitempty"`
+	Levels      []LevelDiff     `json:"levels,omitempty"`
+	Tiles       []TileDiff      `json:"tiles,omitempty"`
+	MaxDistance int             `json:"max_distance"`
+
+	// Differences lists every divergence found, empty when the outputs match
+	Differences []string `json:"differences,omitempty"`
+}
+
+// LevelDiff is the tile count of a level in both outputs
+type LevelDiff struct {
+	Level    int `json:"level"`
+	Expected int `json:"expected"`
+	FoundA   int `json:"found_a"`
+	FoundB   int `json:"found_b"`
+}
+
+// TileDiff compares a sampled tile of both outputs
+type TileDiff struct {
+	Tile     string      `json:"tile"` // <level>/<col>_<row>
+	A        *TileSample `json:"a,omitempty"`
+	B        *TileSample `json:"b,omitempty"` // nil when the output lacks the tile
+	Distance int         `json:"distance"`    // Bits the hashes differ in
+}
+
+// TileSample is the size and perceptual hash (pkg/imagehash) of a tile
+type TileSample struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+// Equal reports whether no divergence was found
+func (d *OutputDiff) Equal() bool {
+	return len(d.Differences) == 0
+}
+
+func (d *OutputDiff) differ(format string, args ...any) {
+	d.Differences = append(d.Differences, fmt.Sprintf(format, args...))
+}
+
+// DiffStored compares two stored outputs of an image (directories like those checked
+// by ValidateStored, fs or zip container): the descriptors, the tile count of every
+// level and the perceptual hashes of sampled tiles, the corner and center tiles of
+// every level plus extra more per level. Hashes match within maxDistance bits, so
+// encoder noise is no divergence but shifted or miscolored tiles are.
+func (s *ImageProcessingService) DiffStored(ctx context.Context, dirA, dirB string, extra, maxDistance int) (*OutputDiff, error) {
+	a, err := s.ValidateStored(ctx, dirA, false)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.ValidateStored(ctx, dirB, false)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &OutputDiff{
+		A:           dirA,
+		B:           dirB,
+		ContainerA:  a.Container,
+		ContainerB:  b.Container,
+		DescriptorA: a.Descriptor,
+		DescriptorB: b.Descriptor,
+		MaxDistance: maxDistance,
+	}
+	for _, side := range []struct {
+		name string
+		v    *StoredValidation
+	}{{"a", a}, {"b", b}} {
+		for _, issue := range side.v.Issues {
+			diff.differ("%s: %s", side.name, issue)
+		}
+		if side.v.MissingCount > 0 {
+			diff.differ("%s: %d tiles missing", side.name, side.v.MissingCount)
+		}
+	}
+	if a.Descriptor == nil || b.Descriptor == nil {
+		return diff, nil
+	}
+
+	da, db := a.Descriptor, b.Descriptor
+	check := func(what string, va, vb any) {
+		if va != vb {
+			diff.differ("%s: %v in a, %v in b", what, va, vb)
+		}
+	}
+	check("tile size", da.TileSize, db.TileSize)
+	check("overlap", da.Overlap, db.Overlap)
+	check("format", da.Format, db.Format)
+	check("width", da.Width, db.Width)
+	check("height", da.Height, db.Height)
+	if da.TileSize != db.TileSize || da.Overlap != db.Overlap || da.Width != db.Width || da.Height != db.Height {
+		diff.differ("tile grids differ, tiles not compared")
+		return diff, nil
+	}
+
+	for i, tally := range a.Levels {
+		level := LevelDiff{Level: tally.Level, Expected: tally.Expected, FoundA: tally.Found}
+		if i < len(b.Levels) {
+			level.FoundB = b.Levels[i].Found
+		}
+		if level.FoundA != level.FoundB {
+			diff.differ("level %d: %d tiles in a, %d in b", level.Level, level.FoundA, level.FoundB)
+		}
+		diff.Levels = append(diff.Levels, level)
+	}
+
+	tilesA, err := s.openStoredTiles(dirA, a.Container)
+	if err != nil {
+		return nil, err
+	}
+	defer tilesA.Close()
+	tilesB, err := s.openStoredTiles(dirB, b.Container)
+	if err != nil {
+		return nil, err
+	}
+	defer tilesB.Close()
+
+	for _, pos := range da.SampleTiles(extra) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tile := TileDiff{Tile: fmt.Sprintf("%d/%d_%d", pos.Level, pos.Col, pos.Row)}
+		sample := func(side string, tiles *storedTiles) *TileSample {
+			sample, err := tiles.sample(pos)
+			switch {
+			case err != nil:
+				diff.differ("tile %s: %s: %v", tile.Tile, side, err)
+			case sample == nil:
+				diff.differ("tile %s: missing in %s", tile.Tile, side)
+			}
+			return sample
+		}
+		tile.A = sample("a", tilesA)
+		tile.B = sample("b", tilesB)
+		if tile.A != nil && tile.B != nil {
+			switch {
+			case tile.A.Width != tile.B.Width || tile.A.Height != tile.B.Height:
+				diff.differ("tile %s: %dx%d in a, %dx%d in b", tile.Tile, tile.A.Width, tile.A.Height, tile.B.Width, tile.B.Height)
+			default:
+				tile.Distance, _ = imagehash.Distance(tile.A.Hash, tile.B.Hash)
+				if tile.Distance > maxDistance {
+					diff.differ("tile %s: hash differs in %d bits (max %d)", tile.Tile, tile.Distance, maxDistance)
+				}
+			}
+		}
+		diff.Tiles = append(diff.Tiles, tile)
+	}
+
+	s.logger.Info("Stored outputs compared",
+		"a", dirA,
+		"b", dirB,
+		"tiles", len(diff.Tiles),
+		"differences", len(diff.Differences))
+
+	return diff, nil
+}
+
+// storedTiles reads the tiles of a stored output by position, from tiles/ (deduplicated
+// tiles resolved through IndexMap.json) or from image.zip
+type storedTiles struct {
+	files   map[dzi.TilePosition]string
+	entries map[dzi.TilePosition]*zip.File
+	zip     *zip.ReadCloser
+}
+
+func (s *ImageProcessingService) openStoredTiles(dir, container string) (*storedTiles, error) {
+	tiles := &storedTiles{}
+	if container == "zip" {
+		zipPath := filepath.Join(dir, "image.zip")
+		r, err := zip.OpenReader(zipPath)
+		if err != nil {
+			return nil, errors.WrapStorageError(err, "failed to open image.zip").
+				WithContext("zip", zipPath)
+		}
+		tiles.zip = r
+		tiles.entries = make(map[dzi.TilePosition]*zip.File, len(r.File))
+		for _, f := range r.File {
+			if level, col, row, ok := dzi.ParseTilePath(f.Name); ok {
+				tiles.entries[dzi.TilePosition{Level: level, Col: col, Row: row}] = f
+			}
+		}
+		return tiles, nil
+	}
+
+	tilesDir := filepath.Join(dir, "tiles")
+	tiles.files = make(map[dzi.TilePosition]string)
+	err := filepath.WalkDir(tilesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if level, col, row, ok := dzi.ParseTilePath(filepath.ToSlash(path)); ok {
+			tiles.files[dzi.TilePosition{Level: level, Col: col, Row: row}] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to walk tiles directory").
+			WithContext("tiles_dir", tilesDir)
+	}
+
+	if indexPath := filepath.Join(dir, "IndexMap.json"); fileExists(indexPath) {
+		index, err := s.zipProcessor.ReadIndexMap(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		for ref, canonical := range index.References {
+			if level, col, row, ok := dzi.ParseTilePath(filepath.ToSlash(ref)); ok {
+				tiles.files[dzi.TilePosition{Level: level, Col: col, Row: row}] = filepath.Join(dir, filepath.FromSlash(canonical))
+			}
+		}
+	}
+	return tiles, nil
+}
+
+// sample decodes the tile at pos and hashes it, nil without an error when the output
+// lacks the tile
+func (t *storedTiles) sample(pos dzi.TilePosition) (*TileSample, error) {
+	var r io.ReadCloser
+	var err error
+	if t.zip != nil {
+		f, ok := t.entries[pos]
+		if !ok {
+			return nil, nil
+		}
+		r, err = f.Open()
+	} else {
+		path, ok := t.files[pos]
+		if !ok {
+			return nil, nil
+		}
+		r, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode: %w", err)
+	}
+	bounds := img.Bounds()
+	return &TileSample{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Hash:   imagehash.Format(imagehash.DHash(img)),
+	}, nil
+}
+
+func (t *storedTiles) Close() error {
+	if t.zip != nil {
+		return t.zip.Close()
+	}
+	return nil
+}
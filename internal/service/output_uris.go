@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+)
+
+// contentURI is the fully qualified location of an output stored at p by provider:
+// gs://<output bucket>/<p> on GCS, a file:// URL of the absolute path for local outputs.
+// Consumers use it as is instead of joining the relative path with a bucket or root of
+// their own.
+func (o *JobOrchestrator) contentURI(provider vobj.ContentProvider, p string) string {
+	if provider == vobj.ContentProviderLocal {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+	}
+
+	scheme := string(provider)
+	if provider == vobj.ContentProviderGCS {
+		scheme = "gs"
+	}
+	return scheme + "://" + o.config.GCP.OutputBucketName + "/" + strings.TrimPrefix(filepath.ToSlash(p), "/")
+}
+
+// outputURIs picks the main outputs of a processed image out of its contents
+func outputURIs(contents []*model.Content) *events.OutputURIs {
+	outputs := &events.OutputURIs{}
+	for _, content := range contents {
+		switch content.Name {
+		case "image.dzi":
+			outputs.DZI = content.URI
+		case "tiles":
+			outputs.Tiles = content.URI
+		case "image.zip":
+			outputs.Zip = content.URI
+		case "IndexMap.json":
+			outputs.IndexMap = content.URI
+		case "thumbnail.jpg":
+			outputs.Thumbnail = content.URI
+		case "stats.json":
+			outputs.Stats = content.URI
+		case pipelineFilename:
+			outputs.Pipeline = content.URI
+		case "report.json":
+			outputs.Report = content.URI
+		case omeTIFFFilename:
+			outputs.OMETIFF = content.URI
+		}
+	}
+	return outputs
+}
@@ -3,15 +3,40 @@ package service
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
 	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
 	"github.com/histopathai/image-processing-service/pkg/errors"
 )
 
+// optionalOutputFiles are artifacts that may be missing without failing the job
+var optionalOutputFiles = []string{
+	"stats.json",
+	qcFilename,
+	"report.json",
+	pipelineFilename,
+	associatedManifest,
+	omeTIFFFilename,
+}
+
+// optionalOutputDirs are artifact directories that are only produced when enabled
+var optionalOutputDirs = []string{
+	overviewsDir,
+	associatedDir,
+}
+
+// outputValidation summarizes what validateOutputs checked, for the processing report
+type outputValidation struct {
+	Descriptor *dzi.Descriptor
+	Levels     []dzi.LevelTally
+}
+
 // validateOutputs checks that all expected output files exist based on container type
-func (s *ImageProcessingService) validateOutputs(workspace *model.Workspace, container string) error {
+func (s *ImageProcessingService) validateOutputs(ctx context.Context, workspace *model.Workspace, container string) (*outputValidation, error) {
 	s.logger.Info("Validating outputs", "container", container)
 
 	// Common outputs for both container types
@@ -33,25 +58,25 @@ func (s *ImageProcessingService) validateOutputs(workspace *model.Workspace, con
 		info, err := os.Stat(tilesDir)
 		if err != nil {
 			if os.IsNotExist(err) {
-				return errors.NewProcessingError("tiles directory was not created").
+				return nil, errors.NewProcessingError("tiles directory was not created").
 					WithContext("tiles_dir", tilesDir)
 			}
-			return errors.WrapStorageError(err, "failed to check tiles directory").
+			return nil, errors.WrapStorageError(err, "failed to check tiles directory").
 				WithContext("tiles_dir", tilesDir)
 		}
 		if !info.IsDir() {
-			return errors.NewProcessingError("tiles path is not a directory").
+			return nil, errors.NewProcessingError("tiles path is not a directory").
 				WithContext("tiles_dir", tilesDir)
 		}
 
 		// Check tiles directory is not empty
 		entries, err := os.ReadDir(tilesDir)
 		if err != nil {
-			return errors.WrapStorageError(err, "failed to read tiles directory").
+			return nil, errors.WrapStorageError(err, "failed to read tiles directory").
 				WithContext("tiles_dir", tilesDir)
 		}
 		if len(entries) == 0 {
-			return errors.NewProcessingError("tiles directory is empty").
+			return nil, errors.NewProcessingError("tiles directory is empty").
 				WithContext("tiles_dir", tilesDir)
 		}
 	}
@@ -62,16 +87,16 @@ func (s *ImageProcessingService) validateOutputs(workspace *model.Workspace, con
 		info, err := os.Stat(filePath)
 		if err != nil {
 			if os.IsNotExist(err) {
-				return errors.NewProcessingError(fmt.Sprintf("required output file not found: %s", filename)).
+				return nil, errors.NewProcessingError(fmt.Sprintf("required output file not found: %s", filename)).
 					WithContext("file", filename).
 					WithContext("path", filePath)
 			}
-			return errors.WrapStorageError(err, fmt.Sprintf("failed to check output file: %s", filename)).
+			return nil, errors.WrapStorageError(err, fmt.Sprintf("failed to check output file: %s", filename)).
 				WithContext("file", filename).
 				WithContext("path", filePath)
 		}
 		if info.Size() == 0 {
-			return errors.NewProcessingError(fmt.Sprintf("output file is empty: %s", filename)).
+			return nil, errors.NewProcessingError(fmt.Sprintf("output file is empty: %s", filename)).
 				WithContext("file", filename).
 				WithContext("path", filePath).
 				WithContext("size", info.Size())
@@ -82,8 +107,138 @@ func (s *ImageProcessingService) validateOutputs(workspace *model.Workspace, con
 			"size", info.Size())
 	}
 
+	descriptor, err := s.validateDescriptor(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := s.validateTileCounts(ctx, workspace, container, descriptor)
+	if err != nil {
+		return nil, err
+	}
+
 	s.logger.Info("All outputs validated successfully", "container", container)
-	return nil
+	return &outputValidation{
+		Descriptor: descriptor,
+		Levels:     levels,
+	}, nil
+}
+
+// validateDescriptor checks that image.dzi describes the pyramid that was requested
+func (s *ImageProcessingService) validateDescriptor(workspace *model.Workspace) (*dzi.Descriptor, error) {
+	dziPath := workspace.Join("image.dzi")
+	descriptor, err := dzi.ParseFile(dziPath)
+	if err != nil {
+		return nil, errors.WrapProcessingError(err, "invalid DZI descriptor").
+			WithContext("path", dziPath)
+	}
+
+	cfg := s.config.DZIConfig
+	if descriptor.TileSize != cfg.TileSize || descriptor.Overlap != cfg.Overlap {
+		return nil, errors.NewProcessingError("DZI descriptor does not match requested tiling").
+			WithContext("tile_size", descriptor.TileSize).
+			WithContext("expected_tile_size", cfg.TileSize).
+			WithContext("overlap", descriptor.Overlap).
+			WithContext("expected_overlap", cfg.Overlap)
+	}
+	if descriptor.Format != dzi.FormatForSuffix(cfg.Suffix) {
+		return nil, errors.NewProcessingError("DZI descriptor tile format does not match requested suffix").
+			WithContext("format", descriptor.Format).
+			WithContext("suffix", cfg.Suffix)
+	}
+
+	// Dimension probes (exiftool, dcraw) can disagree with the decoded raster by a few pixels
+	if file := workspace.File(); file != nil && file.WidthValue() > 0 &&
+		(descriptor.Width != file.WidthValue() || descriptor.Height != file.HeightValue()) {
+		s.logger.Warn("DZI dimensions differ from probed image dimensions",
+			"fileID", file.ID,
+			"dziWidth", descriptor.Width,
+			"dziHeight", descriptor.Height,
+			"width", file.WidthValue(),
+			"height", file.HeightValue())
+	}
+
+	s.logger.Debug("DZI descriptor validated",
+		"width", descriptor.Width,
+		"height", descriptor.Height,
+		"levels", descriptor.LevelCount(),
+		"tiles", descriptor.TotalTiles())
+
+	return descriptor, nil
+}
+
+// validateTileCounts checks that every pyramid level holds exactly the tiles the
+// descriptor implies, so truncated dzsave runs fail the job instead of shipping holes
+func (s *ImageProcessingService) validateTileCounts(ctx context.Context, workspace *model.Workspace, container string, descriptor *dzi.Descriptor) ([]dzi.LevelTally, error) {
+	if s.config.DZIConfig.Layout != "dz" {
+		s.logger.Info("Skipping tile count validation for non-dz layout",
+			"layout", s.config.DZIConfig.Layout)
+		return nil, nil
+	}
+
+	var names []string
+	if container == "zip" {
+		// The index map already lists every archive entry, no need to reopen the zip
+		index, err := s.zipProcessor.ReadIndexMap(workspace.Join("IndexMap.json"))
+		if err != nil {
+			return nil, err
+		}
+		names = make([]string, 0, len(index.Entries))
+		for _, entry := range index.Entries {
+			names = append(names, entry.Name)
+		}
+	} else {
+		tilesDir := workspace.Join("tiles")
+		err := filepath.WalkDir(tilesDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := deadline.Err(ctx, "output validation"); err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				rel, err := filepath.Rel(tilesDir, path)
+				if err != nil {
+					return err
+				}
+				names = append(names, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if ctxErr := deadline.Err(ctx, "output validation"); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if err != nil {
+			return nil, errors.WrapStorageError(err, "failed to walk tiles directory").
+				WithContext("tiles_dir", tilesDir)
+		}
+	}
+
+	tallies, unexpected := descriptor.TallyTiles(names)
+	if len(unexpected) > 0 {
+		return nil, errors.NewProcessingError("tile pyramid contains tiles outside the descriptor grid").
+			WithContext("count", len(unexpected)).
+			WithContext("first", unexpected[0])
+	}
+
+	var incomplete []dzi.LevelTally
+	for _, tally := range tallies {
+		if !tally.Complete() {
+			incomplete = append(incomplete, tally)
+		}
+	}
+	if len(incomplete) > 0 {
+		return nil, errors.NewProcessingError("tile pyramid is incomplete").
+			WithContext("container", container).
+			WithContext("incomplete_levels", incomplete)
+	}
+
+	s.logger.Info("Tile counts validated",
+		"container", container,
+		"levels", len(tallies),
+		"tiles", descriptor.TotalTiles())
+
+	return tallies, nil
 }
 
 // copyOutputsToStorage copies all output files from /tmp workspace to destination storage
@@ -106,6 +261,9 @@ func (s *ImageProcessingService) copyOutputsToStorage(ctx context.Context, works
 
 	// Copy individual files
 	for _, filename := range outputFiles {
+		if err := deadline.Err(ctx, "output copy"); err != nil {
+			return err
+		}
 		localPath := workspace.Join(filename)
 		remotePath := filepath.Join(imageID, filename)
 
@@ -122,22 +280,96 @@ func (s *ImageProcessingService) copyOutputsToStorage(ctx context.Context, works
 		}
 	}
 
-	// Copy tiles directory for fs container
-	if container == "fs" {
-		localTilesDir := workspace.Join("tiles")
-		remoteTilesDir := filepath.Join(imageID, "tiles")
+	// Optional artifacts are only copied when they were produced
+	for _, filename := range optionalOutputFiles {
+		localPath := workspace.Join(filename)
+		if _, err := os.Stat(localPath); err != nil {
+			continue
+		}
+		remotePath := filepath.Join(imageID, filename)
 
-		s.logger.Debug("Copying tiles directory",
-			"local_dir", localTilesDir,
-			"remote_dir", remoteTilesDir)
+		if err := s.outputStorage.PutFile(ctx, localPath, remotePath); err != nil {
+			return errors.WrapStorageError(err, "failed to copy optional output file to storage").
+				WithContext("file", filename).
+				WithContext("local_path", localPath).
+				WithContext("remote_path", remotePath)
+		}
+	}
+
+	for _, dirname := range optionalOutputDirs {
+		localDir := workspace.Join(dirname)
+		if _, err := os.Stat(localDir); err != nil {
+			continue
+		}
+		remoteDir := filepath.Join(imageID, dirname)
 
-		if err := s.outputStorage.PutDirectory(ctx, localTilesDir, remoteTilesDir); err != nil {
-			return errors.WrapStorageError(err, "failed to copy tiles directory to storage").
-				WithContext("local_dir", localTilesDir).
-				WithContext("remote_dir", remoteTilesDir)
+		if err := s.outputStorage.PutDirectory(ctx, localDir, remoteDir); err != nil {
+			return errors.WrapStorageError(err, "failed to copy optional output directory to storage").
+				WithContext("local_dir", localDir).
+				WithContext("remote_dir", remoteDir)
+		}
+	}
+
+	// Copy tiles directory for fs container, skipping levels uploaded during tiling
+	if container == "fs" {
+		if err := s.copyTilesToStorage(ctx, workspace, imageID); err != nil {
+			return err
 		}
 	}
 
+	// Checksums were computed during the copies above, nothing is read again
+	if err := s.copyChecksums(ctx, workspace, imageID); err != nil {
+		return err
+	}
+
 	s.logger.Info("All outputs copied to storage successfully", "imageID", imageID)
 	return nil
 }
+
+// copyTilesToStorage copies the fs container pyramid level by level, skipping
+// levels that were already uploaded while dzsave was running
+func (s *ImageProcessingService) copyTilesToStorage(ctx context.Context, workspace *model.Workspace, imageID string) error {
+	localTilesDir := workspace.Join("tiles")
+	entries, err := os.ReadDir(localTilesDir)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to read tiles directory").
+			WithContext("tiles_dir", localTilesDir)
+	}
+
+	skipped := 0
+	for _, entry := range entries {
+		if err := deadline.Err(ctx, "tile copy"); err != nil {
+			return err
+		}
+		relPath := filepath.Join("tiles", entry.Name())
+		if workspace.IsUploaded(relPath) {
+			skipped++
+			continue
+		}
+
+		localPath := workspace.Join(relPath)
+		remotePath := filepath.Join(imageID, relPath)
+
+		s.logger.Debug("Copying tiles",
+			"local_path", localPath,
+			"remote_path", remotePath)
+
+		if entry.IsDir() {
+			err = s.putTileLevel(ctx, workspace, localPath, relPath, imageID)
+		} else {
+			err = s.outputStorage.PutFile(ctx, localPath, remotePath)
+		}
+		if err != nil {
+			return errors.WrapStorageError(err, "failed to copy tiles to storage").
+				WithContext("local_path", localPath).
+				WithContext("remote_path", remotePath)
+		}
+	}
+
+	s.logger.Info("Tiles copied to storage",
+		"imageID", imageID,
+		"levels", len(entries),
+		"alreadyUploaded", skipped)
+
+	return s.finalizeTileDedup(ctx, workspace, imageID)
+}
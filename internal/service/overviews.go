@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+)
+
+const overviewsDir = "overviews"
+
+// GenerateOverviews exports whole-slide JPEGs at the configured downsample factors
+// to overviews/overview_<n>x.jpg. Factors that would exceed the size cap are skipped.
+func (s *ImageProcessingService) GenerateOverviews(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	cfg := s.config.OverviewConfig
+	inputFilePath := s.previewSource(file, workspace)
+	width, height := file.WidthValue(), file.HeightValue()
+
+	// Overviews are not scaled up from an OpenSlide preview
+	maxSize := cfg.MaxSize
+	if preview := workspace.Preview(); preview != "" {
+		info, err := processors.ReadImageConfig(preview)
+		if err != nil {
+			return err
+		}
+		maxSize = min(maxSize, max(info.Width, info.Height))
+	}
+
+	s.logger.Info("Generating overviews",
+		"fileID", file.ID,
+		"downsamples", cfg.Downsamples)
+
+	for _, factor := range cfg.Downsamples {
+		w := (width + factor - 1) / factor
+		h := (height + factor - 1) / factor
+		if max(w, h) > maxSize {
+			s.logger.Warn("Skipping overview larger than OVERVIEW_MAX_SIZE or the OpenSlide preview",
+				"fileID", file.ID,
+				"downsample", factor,
+				"width", w,
+				"height", h,
+				"maxSize", maxSize)
+			continue
+		}
+
+		outputFilePath := workspace.Join(overviewsDir, fmt.Sprintf("overview_%dx.jpg", factor))
+		result, err := s.vipsProcessor.CreateThumbnail(ctx, inputFilePath, outputFilePath, w, h, cfg.Quality)
+		if err != nil {
+			stderr := ""
+			if result != nil {
+				stderr = result.Stderr
+			}
+			s.logger.Error("Overview generation failed",
+				"fileID", file.ID,
+				"downsample", factor,
+				"stderr", stderr,
+				"error", err)
+			return err
+		}
+
+		if err := s.applyWatermark(ctx, outputFilePath, cfg.Quality); err != nil {
+			return err
+		}
+
+		s.logger.Info("Overview generated",
+			"fileID", file.ID,
+			"downsample", factor,
+			"outputFile", filepath.Base(outputFilePath))
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const pipelineFilename = "pipeline.json"
+
+// pipelineParameters are the settings that change the pixels or the layout of the
+// outputs. Unlike the report parameters they do not depend on the image, so every
+// image processed with the same settings gets the same pipeline version.
+func (s *ImageProcessingService) pipelineParameters() map[string]any {
+	dziCfg := s.config.DZIConfig
+	params := map[string]any{
+		"dzi": map[string]any{
+			"tile_size":   dziCfg.TileSize,
+			"overlap":     dziCfg.Overlap,
+			"quality":     dziCfg.Quality,
+			"layout":      dziCfg.Layout,
+			"suffix":      dziCfg.Suffix,
+			"compression": dziCfg.Compression,
+			"dedup":       dziCfg.Dedup,
+		},
+		"thumbnail": map[string]any{
+			"width":   s.config.ThumbnailConfig.Width,
+			"height":  s.config.ThumbnailConfig.Height,
+			"quality": s.config.ThumbnailConfig.Quality,
+			"mode":    s.config.ThumbnailConfig.Mode,
+			"pyramid": s.config.ThumbnailConfig.FromPyramid,
+		},
+		"channel_mapping": map[string]any{
+			"enabled": s.config.ChannelConfig.Enabled,
+			"lut":     s.config.ChannelConfig.LUT,
+			"colors":  s.config.ChannelConfig.Colors,
+			"rescale": s.config.ChannelConfig.Rescale,
+		},
+		"dng": map[string]any{
+			"white_balance": s.config.DNG.WhiteBalance,
+			"gamma":         s.config.DNG.Gamma,
+			"highlight":     s.config.DNG.Highlight,
+			"color_space":   s.config.DNG.ColorSpace,
+			"intermediate": map[string]any{
+				"format":      s.config.Intermediate.Format,
+				"compression": s.config.Intermediate.Compression,
+				"bit_depth":   s.config.Intermediate.BitDepth,
+			},
+		},
+		"watermark": s.config.WatermarkConfig.Enabled,
+	}
+	if s.config.OverviewConfig.Enabled {
+		params["overview_downsamples"] = s.config.OverviewConfig.Downsamples
+	}
+	if s.config.Output.Has(config.OutputFormatOMETIFF) {
+		params["ome_tiff"] = map[string]any{
+			"tile_size":   s.config.Output.OMETIFFTileSize,
+			"compression": s.config.Output.OMETIFFCompression,
+			"quality":     s.config.Output.OMETIFFQuality,
+		}
+	}
+	return params
+}
+
+// PipelineStamp describes the pipeline of the service: its output parameters, the
+// software versions and the pipeline version hashed from both
+func (s *ImageProcessingService) PipelineStamp(ctx context.Context) *model.PipelineStamp {
+	stamp := &model.PipelineStamp{
+		Parameters: s.pipelineParameters(),
+		Software:   s.softwareVersions(ctx),
+	}
+	// encoding/json sorts map keys, the same settings always encode the same. Only
+	// numbers, strings and bools, which cannot fail to encode.
+	data, _ := json.Marshal(struct {
+		Parameters map[string]any    `json:"parameters"`
+		Software   map[string]string `json:"software"`
+	}{stamp.Parameters, stamp.Software})
+	sum := sha256.Sum256(data)
+	stamp.Version = hex.EncodeToString(sum[:6])
+	return stamp
+}
+
+// PipelineVersion is the version of PipelineStamp
+func (s *ImageProcessingService) PipelineVersion(ctx context.Context) string {
+	return s.PipelineStamp(ctx).Version
+}
+
+// writePipelineStamp stamps the outputs in the workspace with pipeline.json
+func (s *ImageProcessingService) writePipelineStamp(ctx context.Context, workspace *model.Workspace) error {
+	data, err := json.MarshalIndent(s.PipelineStamp(ctx), "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode pipeline stamp")
+	}
+	path := workspace.Join(pipelineFilename)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write pipeline.json").
+			WithContext("path", path)
+	}
+	return nil
+}
+
+// readPipelineStamp reads the pipeline.json of dir; nil when dir has none
+func readPipelineStamp(dir string) (*model.PipelineStamp, error) {
+	data, err := os.ReadFile(filepath.Join(dir, pipelineFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to read pipeline stamp").
+			WithContext("dir", dir)
+	}
+
+	var stamp model.PipelineStamp
+	if err := json.Unmarshal(data, &stamp); err != nil {
+		return nil, errors.WrapProcessingError(err, "invalid pipeline stamp").
+			WithContext("dir", dir)
+	}
+	return &stamp, nil
+}
+
+// OutdatedOutputs lists the images under the output root whose outputs were produced
+// by another pipeline version than the current one, including outputs produced before
+// pipeline stamps. Only directories with an image.dzi are image outputs; the origin
+// path is left to the caller, the outputs do not record it.
+func (s *ImageProcessingService) OutdatedOutputs(ctx context.Context, root string) ([]model.OutdatedImage, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to list output root").
+			WithContext("root", root)
+	}
+	current := s.PipelineVersion(ctx)
+
+	var outdated []model.OutdatedImage
+	for _, entry := range entries {
+		if err := deadline.Err(ctx, "outdated output scan"); err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(root, entry.Name())
+		if !entry.IsDir() || !fileExists(filepath.Join(dir, "image.dzi")) {
+			continue
+		}
+
+		stamp, err := readPipelineStamp(dir)
+		if err != nil {
+			s.logger.Warn("Unreadable pipeline stamp, treating the outputs as outdated",
+				"dir", dir,
+				"error", err)
+		}
+		version := ""
+		if stamp != nil {
+			version = stamp.Version
+		}
+		if version == current {
+			continue
+		}
+
+		outdated = append(outdated, model.OutdatedImage{
+			ImageID:           entry.Name(),
+			ProcessingVersion: outputProcessingVersion(dir),
+			PipelineVersion:   version,
+			OutputPath:        dir,
+		})
+	}
+	sort.Slice(outdated, func(i, j int) bool { return outdated[i].ImageID < outdated[j].ImageID })
+	return outdated, nil
+}
+
+// outputProcessingVersion is the processing version of the outputs in dir: v2 for the
+// zip container, v1 for the fs container
+func outputProcessingVersion(dir string) string {
+	if fileExists(filepath.Join(dir, "image.zip")) {
+		return "v2"
+	}
+	return "v1"
+}
+
+// OutdatedImages lists the processed images of the image repository whose outputs
+// were produced by another pipeline version than the current one. The repository has
+// to answer the dashboard queries (port.ImageDashboard).
+func (o *JobOrchestrator) OutdatedImages(ctx context.Context) ([]model.OutdatedImage, error) {
+	dashboard, ok := o.images.(port.ImageDashboard)
+	if !ok {
+		return nil, errors.NewConfigurationError("no image repository to list outdated images from")
+	}
+	records, err := dashboard.Outdated(ctx, o.imageProcessingService.PipelineVersion(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	outdated := make([]model.OutdatedImage, 0, len(records))
+	for _, record := range records {
+		image := model.OutdatedImage{
+			ImageID:           record.ImageID,
+			OriginPath:        record.OriginPath,
+			ProcessingVersion: record.ProcessingVersion,
+			PipelineVersion:   record.PipelineVersion,
+			Tenant:            record.Tenant,
+			BucketName:        record.BucketName,
+			Metadata:          record.Metadata,
+		}
+		if record.Result != nil {
+			image.OutputPath = record.Result.OutputPath
+		}
+		outdated = append(outdated, image)
+	}
+	return outdated, nil
+}
+
+// RequeueOutdated publishes a forced processing request for each image to the request
+// topic and returns how many were published. It stops at the first image without an
+// origin path or failed publish.
+func (o *JobOrchestrator) RequeueOutdated(ctx context.Context, images []model.OutdatedImage) (int, error) {
+	for i, image := range images {
+		if image.OriginPath == "" {
+			return i, errors.NewValidationError("outdated image has no origin path").
+				WithContext("imageID", image.ImageID)
+		}
+		request := &events.ImageProcessRequestEvent{
+			BaseEvent:         events.NewBaseEventWith(events.ImageProcessRequestEventType, o.clock, o.ids),
+			ImageID:           image.ImageID,
+			OriginPath:        image.OriginPath,
+			ProcessingVersion: image.ProcessingVersion,
+			BucketName:        image.BucketName,
+			Tenant:            image.Tenant,
+			Force:             true,
+			Metadata:          image.Metadata,
+		}
+		data, err := o.eventSerializer.Serialize(request)
+		if err != nil {
+			return i, errors.WrapInternalError(err, "failed to serialize processing request").
+				WithContext("imageID", image.ImageID)
+		}
+		attributes := map[string]string{
+			"event_type": string(request.GetEventType()),
+			"image_id":   request.GetImageID(),
+		}
+		if request.Tenant != "" {
+			attributes["tenant"] = request.Tenant
+		}
+		if err := o.publisher.Publish(ctx, o.config.ImageRequestTopicID, data, attributes); err != nil {
+			return i, err
+		}
+
+		o.logger.Info("Outdated image requeued",
+			"imageID", image.ImageID,
+			"pipelineVersion", image.PipelineVersion,
+			"eventID", request.EventID)
+	}
+	return len(images), nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const statsOverviewFilename = "stats_overview.png"
+
+// GenerateStats computes per-channel histograms, mean/std and white-balance
+// estimates on a downsampled overview and writes them to stats.json
+func (s *ImageProcessingService) GenerateStats(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	s.logger.Info("Generating pixel statistics",
+		"fileID", file.ID,
+		"filename", file.Filename)
+
+	cfg := s.config.StatsConfig
+	inputFilePath := s.previewSource(file, workspace)
+	overviewPath := workspace.Join(statsOverviewFilename)
+	defer os.Remove(overviewPath)
+
+	result, err := s.vipsProcessor.CreateThumbnail(ctx, inputFilePath, overviewPath,
+		cfg.OverviewSize,
+		cfg.OverviewSize,
+		100)
+	if err != nil {
+		stderr := ""
+		if result != nil {
+			stderr = result.Stderr
+		}
+		s.logger.Error("Stats overview generation failed",
+			"fileID", file.ID,
+			"stderr", stderr,
+			"error", err)
+		return err
+	}
+
+	stats, err := s.statsProcessor.ComputeStats(ctx, overviewPath, cfg.HistogramBins)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode pixel statistics")
+	}
+
+	statsPath := workspace.Join("stats.json")
+	if err := os.WriteFile(statsPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write stats.json").
+			WithContext("path", statsPath)
+	}
+
+	s.logger.Info("Pixel statistics generated",
+		"fileID", file.ID,
+		"outputFile", statsPath)
+
+	return nil
+}
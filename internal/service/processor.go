@@ -0,0 +1,29 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+// ImageProcessor is the part of ImageProcessingService the JobOrchestrator drives.
+// Orchestration (events, uploads, workspace cleanup) can be tested against a fake
+// without running vips.
+type ImageProcessor interface {
+	InputSize(ctx context.Context, file *model.File) (int64, error)
+	ProcessFile(ctx context.Context, file *model.File, container string) (*model.Workspace, error)
+	StageFile(ctx context.Context, file *model.File) (*StagedInput, error)
+	ProcessStaged(ctx context.Context, file *model.File, staged *StagedInput, container string) (*model.Workspace, error)
+	ExtractRegion(ctx context.Context, file *model.File, region *model.RegionSpec) (*model.Workspace, string, error)
+	RenderAnnotations(ctx context.Context, file *model.File, annotations *model.AnnotationSet, region *model.RegionSpec, renderSize int) (*model.Workspace, string, error)
+	MigrateToZip(ctx context.Context, imageID, prefix string, keepTiles bool) (*dzi.Descriptor, error)
+	RetileLowLevels(ctx context.Context, imageID, prefix string, fromLevel int) (*dzi.Descriptor, error)
+	TranscodeTiles(ctx context.Context, imageID, prefix string, spec *model.TranscodeSpec) (*dzi.Descriptor, string, error)
+	DeleteOutputs(ctx context.Context, imageID, prefix string, retention time.Duration) (*DeletionResult, error)
+	TrackStep(imageID, name string, fn func() error) error
+	PipelineVersion(ctx context.Context) string
+}
+
+var _ ImageProcessor = (*ImageProcessingService)(nil)
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+type ProgressStatus string
+
+const (
+	ProgressStarted   ProgressStatus = "started"
+	ProgressRunning   ProgressStatus = "running"
+	ProgressCompleted ProgressStatus = "completed"
+	ProgressFailed    ProgressStatus = "failed"
+	ProgressSkipped   ProgressStatus = "skipped"
+)
+
+// Progress is an update on one step of a job. Percent is -1 for steps without
+// measurable progress; Elapsed and Err are set once the step finished.
+type Progress struct {
+	ImageID string
+	Step    string
+	Status  ProgressStatus
+	Percent int
+	Elapsed time.Duration
+	Err     error
+}
+
+// ProgressFunc receives step updates. Output steps run concurrently, so it must be
+// safe for concurrent use.
+type ProgressFunc func(Progress)
+
+// SetProgress registers fn to receive the step updates of every job the service runs
+func (s *ImageProcessingService) SetProgress(fn ProgressFunc) {
+	s.progress = fn
+}
+
+// EmitProgress forwards an update to the registered ProgressFunc, if any
+func (s *ImageProcessingService) EmitProgress(p Progress) {
+	if s.progress != nil {
+		s.progress(p)
+	}
+}
+
+// runStep times fn, records its outcome in the report and reports its progress
+func (s *ImageProcessingService) runStep(report *model.ProcessingReport, name string, fn func() error) error {
+	s.EmitProgress(Progress{ImageID: report.ImageID, Step: name, Status: ProgressStarted, Percent: -1})
+	startedAt := time.Now()
+	err := fn()
+	report.RecordStep(name, startedAt, err)
+
+	status := ProgressCompleted
+	if err != nil {
+		status = ProgressFailed
+	}
+	s.EmitProgress(Progress{
+		ImageID: report.ImageID,
+		Step:    name,
+		Status:  status,
+		Percent: -1,
+		Elapsed: time.Since(startedAt),
+		Err:     err,
+	})
+	return err
+}
+
+// skipStep records a disabled step in the report and reports it as skipped
+func (s *ImageProcessingService) skipStep(report *model.ProcessingReport, name string) {
+	report.SkipStep(name)
+	s.EmitProgress(Progress{ImageID: report.ImageID, Step: name, Status: ProgressSkipped, Percent: -1})
+}
+
+// dziProgress returns the callback reporting dzsave percentages, or nil when nobody
+// listens so vips does not have to print its progress
+func (s *ImageProcessingService) dziProgress(imageID string) func(percent int) {
+	if s.progress == nil {
+		return nil
+	}
+	return func(percent int) {
+		s.EmitProgress(Progress{ImageID: imageID, Step: "dzi", Status: ProgressRunning, Percent: percent})
+	}
+}
+
+// TrackStep reports the progress of a step that is not part of the processing report
+func (s *ImageProcessingService) TrackStep(imageID, name string, fn func() error) error {
+	s.EmitProgress(Progress{ImageID: imageID, Step: name, Status: ProgressStarted, Percent: -1})
+	startedAt := time.Now()
+	err := fn()
+
+	status := ProgressCompleted
+	if err != nil {
+		status = ProgressFailed
+	}
+	s.EmitProgress(Progress{
+		ImageID: imageID,
+		Step:    name,
+		Status:  status,
+		Percent: -1,
+		Elapsed: time.Since(startedAt),
+		Err:     err,
+	})
+	return err
+}
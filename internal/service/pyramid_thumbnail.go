@@ -0,0 +1,195 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"math"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/fsutil"
+)
+
+const (
+	// pyramidThumbnailDir holds the tiles and the stitched level a thumbnail is
+	// derived from, removed once the thumbnail is written
+	pyramidThumbnailDir = "pyramid_thumbnail"
+	// maxPyramidThumbnailTiles bounds the tiles of the level a thumbnail is derived
+	// from. A level that needs more is only that large for a very elongated slide,
+	// which is read from the original instead.
+	maxPyramidThumbnailTiles = 64
+)
+
+// GenerateThumbnailFromPyramid derives the thumbnail from the smallest level of the
+// pyramid GenerateDZI wrote into the workspace that still covers the thumbnail, so a
+// huge input is not decoded a second time. When the pyramid cannot be used (another
+// layout, overlapping tiles, a level with too many tiles) the thumbnail is generated
+// from the original like GenerateThumbnail does.
+func (s *ImageProcessingService) GenerateThumbnailFromPyramid(ctx context.Context, file *model.File, workspace *model.Workspace, container string) error {
+	defer func() {
+		if err := workspace.RemoveDir(pyramidThumbnailDir); err != nil {
+			s.logger.Warn("Failed to remove pyramid level from workspace",
+				"fileID", file.ID,
+				"error", err)
+		}
+	}()
+
+	source, level, err := s.pyramidThumbnailSource(ctx, workspace, container)
+	if err != nil {
+		if ctxErr := deadline.Err(ctx, "thumbnail"); ctxErr != nil {
+			return ctxErr
+		}
+		s.logger.Info("Pyramid not usable for the thumbnail, reading the original",
+			"fileID", file.ID,
+			"reason", err)
+		return s.GenerateThumbnail(ctx, file, workspace)
+	}
+
+	s.logger.Info("Generating thumbnail from pyramid",
+		"fileID", file.ID,
+		"level", level)
+	return s.generateThumbnailFrom(ctx, file, workspace, source)
+}
+
+// pyramidThumbnailSource returns the image of the pyramid level the thumbnail is
+// derived from and its level: the tile itself for a single-tile level, otherwise the
+// tiles stitched together and cropped to the level size
+func (s *ImageProcessingService) pyramidThumbnailSource(ctx context.Context, workspace *model.Workspace, container string) (string, int, error) {
+	if s.config.DZIConfig.Layout != "dz" {
+		return "", 0, errors.NewValidationError("pyramid layout is not dz").
+			WithContext("layout", s.config.DZIConfig.Layout)
+	}
+
+	// Tiles of the zip container are only in image.zip until post-processing
+	var entries map[string]*zip.File
+	var descriptor *dzi.Descriptor
+	if container == "zip" {
+		r, err := zip.OpenReader(workspace.Join("image.zip"))
+		if err != nil {
+			return "", 0, errors.WrapStorageError(err, "failed to open image.zip")
+		}
+		defer r.Close()
+
+		entries = make(map[string]*zip.File, len(r.File))
+		for _, f := range r.File {
+			entries[f.Name] = f
+			if filepath.Base(f.Name) == "image.dzi" {
+				if descriptor, err = readZipDescriptor(f); err != nil {
+					return "", 0, errors.WrapProcessingError(err, "invalid image.dzi in image.zip")
+				}
+			}
+		}
+		if descriptor == nil {
+			return "", 0, errors.NewNotFoundError("image.dzi in image.zip")
+		}
+	} else {
+		var err error
+		if descriptor, err = dzi.ParseFile(workspace.Join("image.dzi")); err != nil {
+			return "", 0, errors.WrapProcessingError(err, "invalid image.dzi")
+		}
+	}
+
+	thumbnail := s.config.ThumbnailConfig
+	level := pyramidThumbnailLevel(descriptor, thumbnail.Width, thumbnail.Height, thumbnail.Mode)
+	cols, rows := descriptor.LevelTiles(level)
+	switch {
+	case cols*rows > maxPyramidThumbnailTiles:
+		return "", 0, errors.NewValidationError("pyramid level covering the thumbnail has too many tiles").
+			WithContext("level", level).
+			WithContext("tiles", cols*rows)
+	case cols*rows > 1 && descriptor.Overlap > 0:
+		// Joining overlapping tiles would repeat the overlap at every seam
+		return "", 0, errors.NewValidationError("pyramid tiles overlap").
+			WithContext("overlap", descriptor.Overlap)
+	}
+
+	dir := workspace.Join(pyramidThumbnailDir)
+	tiles := make([]string, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			name := descriptor.TileName(level, col, row)
+			if entries == nil {
+				path := workspace.Join("image_files", filepath.FromSlash(name))
+				if !fileExists(path) {
+					return "", 0, errors.NewNotFoundError("pyramid tile").
+						WithContext("tile", name)
+				}
+				tiles = append(tiles, path)
+				continue
+			}
+
+			f, ok := entries[zipTilePrefix+name]
+			if !ok {
+				return "", 0, errors.NewNotFoundError("pyramid tile in image.zip").
+					WithContext("tile", name)
+			}
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := extractZipFile(ctx, f, path); err != nil {
+				return "", 0, err
+			}
+			tiles = append(tiles, path)
+		}
+	}
+	if len(tiles) == 1 {
+		return tiles[0], level, nil
+	}
+
+	timeout := s.config.ImageProcessTimeoutMinute.Thumbnail
+	joinedPath := filepath.Join(dir, "joined.v")
+	if _, err := s.vipsProcessor.JoinTiles(ctx, tiles, cols, joinedPath, timeout); err != nil {
+		return "", 0, err
+	}
+	width, height := descriptor.LevelSize(level)
+	levelPath := filepath.Join(dir, "level.v")
+	if _, err := s.vipsProcessor.ExtractArea(ctx, joinedPath, levelPath, 0, 0, width, height, timeout); err != nil {
+		return "", 0, err
+	}
+	return levelPath, level, nil
+}
+
+// pyramidThumbnailLevel is the smallest level of the pyramid the thumbnail can be
+// scaled down from: at least the size of the thumbnail in mode, or the full-resolution
+// level of an image smaller than that
+func pyramidThumbnailLevel(descriptor *dzi.Descriptor, width, height int, mode string) int {
+	scaleX := float64(width) / float64(descriptor.Width)
+	scaleY := float64(height) / float64(descriptor.Height)
+	// Fit and pad keep the whole image in the box, crop and attention fill it
+	scale := min(scaleX, scaleY)
+	if mode == config.ThumbnailModeCrop || mode == config.ThumbnailModeAttention {
+		scale = max(scaleX, scaleY)
+	}
+	needWidth := int(math.Ceil(float64(descriptor.Width) * scale))
+	needHeight := int(math.Ceil(float64(descriptor.Height) * scale))
+
+	for level := 0; level < descriptor.MaxLevel(); level++ {
+		w, h := descriptor.LevelSize(level)
+		if w >= needWidth && h >= needHeight {
+			return level
+		}
+	}
+	return descriptor.MaxLevel()
+}
+
+// extractZipFile copies the entry f of a zip archive to destPath
+func extractZipFile(ctx context.Context, f *zip.File, destPath string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to open zip entry").
+			WithContext("entry", f.Name)
+	}
+	defer rc.Close()
+
+	if _, err := fsutil.WriteFile(ctx, destPath, rc, 0644, fsutil.Options{Op: "zip extraction"}); err != nil {
+		if ctxErr := deadline.Err(ctx, "zip extraction"); ctxErr != nil {
+			return ctxErr
+		}
+		return errors.WrapStorageError(err, "failed to extract zip entry").
+			WithContext("entry", f.Name).
+			WithContext("path", destPath)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const (
+	qcFilename     = "qc.json"
+	qcHoldFilename = "qc_hold.json"
+)
+
+// EvaluateQC turns the quality measures of stats.json into a pass/warn/fail verdict
+// against the QC thresholds of the dataset of the job and writes it to qc.json. A
+// slide without statistics (the stats step failed) gets a warn verdict rather than
+// none, so it is not mistaken for one that passed.
+func (s *ImageProcessingService) EvaluateQC(ctx context.Context, file *model.File, workspace *model.Workspace) error {
+	result := &model.QCResult{Dataset: s.config.QC.Dataset}
+
+	data, err := os.ReadFile(workspace.Join("stats.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WrapStorageError(err, "failed to read stats.json").
+			WithContext("fileID", file.ID)
+	}
+	var stats processors.PixelStats
+	if err == nil {
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return errors.WrapProcessingError(err, "invalid stats.json").
+				WithContext("fileID", file.ID)
+		}
+	}
+	if stats.Quality == nil {
+		result.Verdict = model.QCVerdictWarn
+		result.Reasons = []string{"no pixel statistics"}
+	} else {
+		result.TissueFraction = stats.Quality.TissueFraction
+		result.FocusScore = stats.Quality.FocusScore
+		result.Brightness = stats.Quality.Brightness
+		result.Verdict, result.Reasons = qcVerdict(*stats.Quality, s.config.QC.Thresholds)
+	}
+
+	data, err = json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode QC verdict")
+	}
+	qcPath := workspace.Join(qcFilename)
+	if err := os.WriteFile(qcPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write qc.json").
+			WithContext("path", qcPath)
+	}
+
+	s.logger.Info("Slide QC evaluated",
+		"fileID", file.ID,
+		"verdict", result.Verdict,
+		"tissueFraction", result.TissueFraction,
+		"focusScore", result.FocusScore,
+		"brightness", result.Brightness,
+		"reasons", result.Reasons)
+	return nil
+}
+
+// qcVerdict checks each measure against its thresholds; the verdict is the worst of
+// them, with a reason for every measure that missed its warn or fail threshold
+func qcVerdict(quality processors.QualityStats, thresholds config.QCThresholds) (string, []string) {
+	verdict := model.QCVerdictPass
+	var reasons []string
+	check := func(name string, value float64, limit config.QCLimit, upper bool) {
+		past := func(threshold float64) bool {
+			if upper {
+				return value > threshold
+			}
+			return value < threshold
+		}
+		bound := "below"
+		if upper {
+			bound = "above"
+		}
+		switch {
+		case past(limit.Fail()):
+			verdict = model.QCVerdictFail
+			reasons = append(reasons, fmt.Sprintf("%s %.3g %s fail threshold %g", name, value, bound, limit.Fail()))
+		case past(limit.Warn()):
+			if verdict == model.QCVerdictPass {
+				verdict = model.QCVerdictWarn
+			}
+			reasons = append(reasons, fmt.Sprintf("%s %.3g %s warn threshold %g", name, value, bound, limit.Warn()))
+		}
+	}
+	check("tissue fraction", quality.TissueFraction, thresholds.MinTissueFraction, false)
+	check("focus score", quality.FocusScore, thresholds.MinFocusScore, false)
+	// Brightness means nothing without tissue, the tissue fraction already covers it
+	if quality.TissueFraction > 0 {
+		check("brightness", quality.Brightness, thresholds.MinBrightness, false)
+		check("brightness", quality.Brightness, thresholds.MaxBrightness, true)
+	}
+	return verdict, reasons
+}
+
+// readQC reads the qc.json of dir; nil when dir has none
+func readQC(dir string) (*model.QCResult, error) {
+	data, err := os.ReadFile(filepath.Join(dir, qcFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to read QC verdict").
+			WithContext("dir", dir)
+	}
+
+	var result model.QCResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.WrapProcessingError(err, "invalid QC verdict").
+			WithContext("dir", dir)
+	}
+	return &result, nil
+}
+
+// writeHeldEvent writes the result event of a slide held by QC to qc_hold.json in
+// dir, where "himgproc replay" publishes it from once the slide is released
+func (o *JobOrchestrator) writeHeldEvent(event *events.ImageProcessCompleteEvent, dir string) error {
+	data, err := o.eventSerializer.Serialize(event)
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to serialize held result event").
+			WithContext("imageID", event.ImageID)
+	}
+	path := filepath.Join(dir, qcHoldFilename)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write held result event").
+			WithContext("path", path)
+	}
+	return nil
+}
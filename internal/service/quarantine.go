@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const failureReportFilename = "failure.json"
+
+// SetInputStorage sets the storage originals are copied from when
+// QUARANTINE_COPY_ORIGINAL is set. Without one, quarantines only reference the original.
+func (o *JobOrchestrator) SetInputStorage(inputStorage storage.InputStorage) {
+	o.inputStorage = inputStorage
+}
+
+// quarantine uploads failure.json, and the original when QUARANTINE_COPY_ORIGINAL is
+// set, to <QUARANTINE_PREFIX>/<image-id> of the output storage and records the path
+// in event. It runs for permanent failures only; a failed quarantine is logged and
+// does not change the outcome of the job.
+func (o *JobOrchestrator) quarantine(ctx context.Context, input *model.JobInput, event *events.ImageProcessCompleteEvent, cause error) {
+	if !o.config.Quarantine.Enabled || event.Status != vobj.StatusFailedPermanent {
+		return
+	}
+
+	ctx, cancel := deadline.Reserved(ctx)
+	defer cancel()
+
+	dir, err := os.MkdirTemp(o.config.Scratch.Dir, "quarantine-")
+	if err != nil {
+		o.logger.Error("Failed to create quarantine directory",
+			"imageID", input.ImageID,
+			"error", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	report := &model.FailureReport{
+		ImageID:             input.ImageID,
+		OriginPath:          input.OriginPath,
+		BucketName:          input.BucketName(),
+		ProcessingVersion:   input.ProcessingVersion,
+		Status:              string(event.Status),
+		FailedAt:            o.clock.Now().UTC(),
+		Attempt:             o.attempt(),
+		WorkerType:          string(o.config.WorkerType),
+		FailureReason:       event.FailureReason,
+		FailureCode:         event.FailureCode,
+		SuggestedWorkerType: event.SuggestedWorkerType,
+	}
+	var appErr *errors.AppError
+	if stderrors.As(cause, &appErr) {
+		report.ErrorType = string(appErr.Type)
+		report.ErrorContext = appErr.Context
+	}
+
+	if o.config.Quarantine.CopyOriginal {
+		if original, err := o.copyOriginal(ctx, input, dir); err != nil {
+			o.logger.Warn("Failed to copy original into quarantine, referencing it instead",
+				"imageID", input.ImageID,
+				"originPath", input.OriginPath,
+				"error", err)
+		} else {
+			report.Original = original
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		o.logger.Error("Failed to encode failure report", "imageID", input.ImageID, "error", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, failureReportFilename), data, 0644); err != nil {
+		o.logger.Error("Failed to write failure report", "imageID", input.ImageID, "error", err)
+		return
+	}
+
+	destination := path.Join(o.config.Quarantine.Prefix, input.ImageID)
+	if err := o.storage.UploadDirectory(ctx, dir, destination); err != nil {
+		o.logger.Error("Failed to quarantine image",
+			"imageID", input.ImageID,
+			"destination", destination,
+			"error", err)
+		return
+	}
+
+	event.QuarantinePath = destination
+	o.logger.Warn("Quarantined permanently failed image",
+		"imageID", input.ImageID,
+		"destination", destination,
+		"originalCopied", report.Original != "")
+}
+
+// copyOriginal copies the original of input into dir and returns its file name
+func (o *JobOrchestrator) copyOriginal(ctx context.Context, input *model.JobInput, dir string) (string, error) {
+	if o.inputStorage == nil {
+		return "", errors.NewConfigurationError("no input storage to copy the original from")
+	}
+	name := filepath.Base(input.OriginPath)
+	if err := o.inputStorage.CopyToLocal(ctx, input.OriginPath, filepath.Join(dir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ExtractRegion crops a region out of the original slide and copies it to output storage.
+// It returns the workspace holding the crop and the crop path relative to the workspace.
+func (s *ImageProcessingService) ExtractRegion(ctx context.Context, file *model.File, region *model.RegionSpec) (_ *model.Workspace, _ string, err error) {
+	if err := region.Validate(); err != nil {
+		return nil, "", errors.WrapValidationError(err, "invalid region").
+			WithContext("fileID", file.ID)
+	}
+
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, "", errors.NewStorageError("failed to create workspace").
+			WithContext("fileID", file.ID)
+	}
+
+	// The caller owns the workspace on success; a failed job must not leave it behind
+	defer func() {
+		if err != nil {
+			workspace.Remove()
+		}
+	}()
+
+	if err := s.resolveOriginalPath(ctx, file); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.GetImageInfo(ctx, file); err != nil {
+		return nil, "", err
+	}
+
+	relPath := filepath.Join("regions", region.Filename())
+	outputFilePath := workspace.Join(relPath)
+
+	s.logger.Info("Extracting region",
+		"fileID", file.ID,
+		"x", region.X,
+		"y", region.Y,
+		"width", region.Width,
+		"height", region.Height,
+		"level", region.Level,
+		"format", region.Format)
+
+	if err := s.extractRegionTo(ctx, file, workspace, region, outputFilePath); err != nil {
+		return nil, "", err
+	}
+
+	if err := s.applyWatermark(ctx, outputFilePath, 100); err != nil {
+		return nil, "", err
+	}
+
+	remotePath := filepath.Join(file.ID, relPath)
+	if err := s.outputStorage.PutFile(ctx, outputFilePath, remotePath); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to copy region to storage").
+			WithContext("local_path", outputFilePath).
+			WithContext("remote_path", remotePath)
+	}
+
+	s.logger.Info("Region extraction succeeded",
+		"fileID", file.ID,
+		"outputFile", outputFilePath)
+
+	return workspace, relPath, nil
+}
+
+// extractRegionTo writes the region of the original image to outputFilePath in
+// region.Format. file dimensions must already be resolved.
+func (s *ImageProcessingService) extractRegionTo(ctx context.Context, file *model.File, workspace *model.Workspace, region *model.RegionSpec, outputFilePath string) error {
+	timeout := s.config.ImageProcessTimeoutMinute.General
+
+	if processors.IsWholeSlideFormat(file.Extension()) {
+		pngPath := outputFilePath
+		if region.Format != model.RegionFormatPNG {
+			pngPath = workspace.Join("region.png")
+		}
+
+		if _, err := s.openSlideProc.ReadRegion(ctx, file.AbsolutePath(),
+			region.X, region.Y, region.Level, region.Width, region.Height,
+			pngPath, timeout); err != nil {
+			return err
+		}
+
+		if pngPath != outputFilePath {
+			if _, err := s.vipsProcessor.ConvertImage(ctx, pngPath, outputFilePath, timeout); err != nil {
+				return err
+			}
+			os.Remove(pngPath)
+		}
+	} else {
+		if region.Level != 0 {
+			return errors.NewValidationError("region levels other than 0 are only supported for whole-slide formats").
+				WithContext("fileID", file.ID).
+				WithContext("level", region.Level)
+		}
+		if region.X+region.Width > file.WidthValue() || region.Y+region.Height > file.HeightValue() {
+			return errors.NewValidationError("region is outside of the image bounds").
+				WithContext("fileID", file.ID).
+				WithContext("image_width", file.WidthValue()).
+				WithContext("image_height", file.HeightValue())
+		}
+
+		if s.isDNGFile(file) {
+			if _, err := s.ConvertDNG(ctx, file, workspace); err != nil {
+				return err
+			}
+			defer workspace.RemoveFile(s.sourcePath(file, workspace))
+		}
+
+		if _, err := s.vipsProcessor.ExtractArea(ctx, s.sourcePath(file, workspace), outputFilePath,
+			region.X, region.Y, region.Width, region.Height, timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"path/filepath"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// SetReplicaStorage makes the orchestrator mirror the outputs of every processed image
+// to replica after the primary upload. Without one, outputs only go to the primary.
+func (o *JobOrchestrator) SetReplicaStorage(replica port.Storage) {
+	o.replica = replica
+}
+
+// mirrorToReplica copies the uploaded outputs in the background and removes the
+// workspace once it is done. It is started after the result is published, so neither
+// the event nor the next job waits for the replica; WaitForReplicas does.
+func (o *JobOrchestrator) mirrorToReplica(ctx context.Context, imageID, finalOutputPath string, workspace *model.Workspace) {
+	source := workspace.Dir()
+	if !fileExists(filepath.Join(source, "image.dzi")) {
+		// The local storage moves the outputs out of the workspace, mirror them from
+		// where they landed
+		source = finalOutputPath
+	}
+	dest := o.replicaPath(imageID, finalOutputPath)
+
+	// The job context ends with the job, the mirror has its own bound
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.config.Replica.Timeout)
+
+	o.replicas.Add(1)
+	go func() {
+		defer o.replicas.Done()
+		defer cancel()
+		defer o.removeWorkspace(imageID, workspace)
+
+		startedAt := time.Now()
+		o.logger.Info("Mirroring outputs to replica",
+			"imageID", imageID,
+			"source", source,
+			"destination", dest)
+
+		if err := o.replica.UploadDirectory(ctx, source, dest); err != nil {
+			err = errors.WrapStorageError(err, "failed to mirror outputs to replica").
+				WithContext("imageID", imageID).
+				WithContext("destination", dest)
+			o.logger.Error("Replica upload failed, the primary outputs are unaffected",
+				"imageID", imageID,
+				"error", err)
+			o.replicaMu.Lock()
+			o.replicaErrs = append(o.replicaErrs, err)
+			o.replicaMu.Unlock()
+			return
+		}
+
+		o.logger.Info("Outputs mirrored to replica",
+			"imageID", imageID,
+			"destination", dest,
+			"durationMs", time.Since(startedAt).Milliseconds())
+	}()
+}
+
+// replicaPath is the path of the outputs at finalOutputPath in the replica: the same
+// object prefix as in the output bucket. Local runs write the outputs of an image
+// straight into the output directory, the replica keeps them under the image ID.
+func (o *JobOrchestrator) replicaPath(imageID, finalOutputPath string) string {
+	if o.config.UsesGCS() {
+		return finalOutputPath
+	}
+	rel, err := filepath.Rel(o.constructOutputPath(""), finalOutputPath)
+	if err != nil || rel == "." {
+		return imageID
+	}
+	return filepath.ToSlash(rel)
+}
+
+// WaitForReplicas blocks until the background replica uploads are done and returns
+// their failures
+func (o *JobOrchestrator) WaitForReplicas() error {
+	o.replicas.Wait()
+	o.replicaMu.Lock()
+	defer o.replicaMu.Unlock()
+	err := stderrors.Join(o.replicaErrs...)
+	o.replicaErrs = nil
+	return err
+}
+
+// removeWorkspace removes the output workspace of a finished image
+func (o *JobOrchestrator) removeWorkspace(imageID string, workspace *model.Workspace) {
+	if err := workspace.Remove(); err != nil {
+		o.logger.Warn("Failed to clean up output workspace",
+			"imageID", imageID,
+			"error", err,
+		)
+	}
+}
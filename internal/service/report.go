@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// reportParameters captures the settings that influence the generated outputs
+func (s *ImageProcessingService) reportParameters(workspace *model.Workspace) map[string]any {
+	dziCfg := s.config.DZIConfig
+	params := map[string]any{
+		"dzi": map[string]any{
+			"tile_size":   dziCfg.TileSize,
+			"overlap":     dziCfg.Overlap,
+			"quality":     dziCfg.Quality,
+			"layout":      dziCfg.Layout,
+			"suffix":      dziCfg.Suffix,
+			"compression": dziCfg.Compression,
+		},
+		"thumbnail": map[string]any{
+			"width":   s.config.ThumbnailConfig.Width,
+			"height":  s.config.ThumbnailConfig.Height,
+			"quality": s.config.ThumbnailConfig.Quality,
+			"mode":    s.config.ThumbnailConfig.Mode,
+			"pyramid": s.config.ThumbnailConfig.FromPyramid,
+		},
+		"channel_mapping": map[string]any{
+			"enabled": s.config.ChannelConfig.Enabled,
+			"applied": workspace.Source() != "",
+			"lut":     s.config.ChannelConfig.LUT,
+			"colors":  s.config.ChannelConfig.Colors,
+			"rescale": s.config.ChannelConfig.Rescale,
+		},
+		"watermark": s.config.WatermarkConfig.Enabled,
+	}
+	if s.isDNGFile(workspace.File()) {
+		params["dng"] = map[string]any{
+			"white_balance": s.config.DNG.WhiteBalance,
+			"gamma":         s.config.DNG.Gamma,
+			"highlight":     s.config.DNG.Highlight,
+			"color_space":   s.config.DNG.ColorSpace,
+			"intermediate": map[string]any{
+				"format":      s.config.Intermediate.Format,
+				"compression": s.config.Intermediate.Compression,
+				"bit_depth":   s.config.Intermediate.BitDepth,
+			},
+		}
+	}
+	if s.config.QC.Enabled {
+		params["qc"] = map[string]any{
+			"dataset":     s.config.QC.Dataset,
+			"thresholds":  s.config.QC.Thresholds,
+			"hold_failed": s.config.QC.HoldFailed,
+		}
+	}
+	if s.config.OverviewConfig.Enabled {
+		params["overview_downsamples"] = s.config.OverviewConfig.Downsamples
+	}
+	if s.config.Output.Has(config.OutputFormatOMETIFF) {
+		params["ome_tiff"] = map[string]any{
+			"tile_size":   s.config.Output.OMETIFFTileSize,
+			"compression": s.config.Output.OMETIFFCompression,
+			"quality":     s.config.Output.OMETIFFQuality,
+		}
+	}
+	return params
+}
+
+// softwareVersions reports the service build and the versions of the external tools.
+// They cannot change while the service runs, the tools are only asked once.
+func (s *ImageProcessingService) softwareVersions(ctx context.Context) map[string]string {
+	s.softwareOnce.Do(func() {
+		s.software = s.readSoftwareVersions(ctx)
+	})
+	return s.software
+}
+
+func (s *ImageProcessingService) readSoftwareVersions(ctx context.Context) map[string]string {
+	versions := map[string]string{
+		"go": runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		versions["service"] = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				versions["service_revision"] = setting.Value
+			}
+		}
+	}
+
+	if v := s.vipsProcessor.Version(ctx); v != "" {
+		versions["vips"] = v
+	}
+	if v := s.openSlideProc.Version(ctx); v != "" {
+		versions["openslide"] = v
+	}
+
+	return versions
+}
+
+// writeReport fills in validation results and versions and writes report.json to the workspace
+func (s *ImageProcessingService) writeReport(ctx context.Context, report *model.ProcessingReport, workspace *model.Workspace, validation *outputValidation) error {
+	report.Parameters = s.reportParameters(workspace)
+	report.Software = s.softwareVersions(ctx)
+	report.PipelineVersion = s.PipelineVersion(ctx)
+
+	if validation != nil && validation.Descriptor != nil {
+		report.Validation = map[string]any{
+			"width":       validation.Descriptor.Width,
+			"height":      validation.Descriptor.Height,
+			"levels":      validation.Descriptor.LevelCount(),
+			"total_tiles": validation.Descriptor.TotalTiles(),
+			"tile_counts": validation.Levels,
+		}
+	}
+	report.Complete()
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode processing report")
+	}
+
+	reportPath := workspace.Join("report.json")
+	if err := os.WriteFile(reportPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write report.json").
+			WithContext("path", reportPath)
+	}
+
+	return nil
+}
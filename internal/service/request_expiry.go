@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+)
+
+// requestExpired returns why a job is too late to run, empty while it is not: past the
+// expires_at of its request, or older than REQUEST_MAX_AGE_HOURS since the request
+// was published
+func (o *JobOrchestrator) requestExpired(input *model.JobInput) string {
+	now := o.clock.Now()
+	if !input.ExpiresAt.IsZero() && now.After(input.ExpiresAt) {
+		return fmt.Sprintf("request expired at %s", input.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	maxAge := o.config.RequestExpiry.MaxAge
+	if maxAge > 0 && !input.RequestedAt.IsZero() {
+		if age := now.Sub(input.RequestedAt); age > maxAge {
+			return fmt.Sprintf("request is %s old, older than %s", age.Round(time.Second), maxAge)
+		}
+	}
+	return ""
+}
+
+// expireJob skips a late job: nothing is read, written or recorded, and the result
+// event of the job type reports the request expired (FailureCodeRequestExpired). The
+// event is retryable, whether to re-enqueue the request is up to the dispatcher. The
+// job itself succeeds, so the task is not run again.
+func (o *JobOrchestrator) expireJob(ctx context.Context, input *model.JobInput, reason string) error {
+	o.logger.Warn("Skipping expired request",
+		"imageID", input.ImageID,
+		"jobType", input.JobType,
+		"requestedAt", input.RequestedAt,
+		"expiresAt", input.ExpiresAt,
+		"reason", reason)
+
+	var event events.ImageEvent
+	switch input.JobType {
+	case model.JobTypeExtractRegion:
+		expired := &events.ImageRegionExtractCompleteEvent{
+			BaseEvent:     o.newEvent(events.ImageRegionExtractCompleteEventType, input),
+			ImageID:       input.ImageID,
+			FailureReason: reason,
+			FailureCode:   events.FailureCodeRequestExpired,
+			Retryable:     true,
+		}
+		if input.Region != nil {
+			expired.Region = *input.Region
+		}
+		event = expired
+	case model.JobTypeRenderAnnotations:
+		expired := &events.ImageAnnotationRenderCompleteEvent{
+			BaseEvent:     o.newEvent(events.ImageAnnotationRenderCompleteEventType, input),
+			ImageID:       input.ImageID,
+			Region:        input.Region,
+			FailureReason: reason,
+			FailureCode:   events.FailureCodeRequestExpired,
+			Retryable:     true,
+		}
+		if input.Annotations != nil {
+			expired.ShapeCount = len(input.Annotations.Shapes)
+		}
+		event = expired
+	case model.JobTypeDelete:
+		event = &events.ImageDeletedEvent{
+			BaseEvent:     o.newEvent(events.ImageDeletedEventType, input),
+			ImageID:       input.ImageID,
+			FailureReason: reason,
+			FailureCode:   events.FailureCodeRequestExpired,
+			Retryable:     true,
+		}
+	default:
+		event = &events.ImageProcessCompleteEvent{
+			BaseEvent:         o.newEvent(events.ImageProcessCompleteEventType, input),
+			ImageID:           input.ImageID,
+			ProcessingVersion: input.ProcessingVersion,
+			FailureReason:     reason,
+			FailureCode:       events.FailureCodeRequestExpired,
+			Retryable:         true,
+			Transcode:         input.Transcode,
+			Metadata:          input.Metadata,
+		}
+	}
+	return o.publishEvent(ctx, event)
+}
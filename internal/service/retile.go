@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// maxRetileBaseTiles bounds the tiles of the level low levels are regenerated from.
+// Beyond it the level is too large to join in one command and a full reprocess is
+// the better option anyway.
+const maxRetileBaseTiles = 4096
+
+// RetileLowLevels regenerates the levels below fromLevel of the published fs-layout
+// outputs of an image from the stored tiles of fromLevel, instead of tiling the
+// original again. Levels fromLevel and up are left as they are. Only settings that
+// do not change the tile grid (QUALITY) can differ from the original run; tile size,
+// overlap and format are taken from the stored image.dzi. prefix is where the outputs
+// are on the output storage. It returns the descriptor of the image.
+func (s *ImageProcessingService) RetileLowLevels(ctx context.Context, imageID, prefix string, fromLevel int) (*dzi.Descriptor, error) {
+	dir := filepath.Join(s.config.Storage.OutputMountPath, prefix)
+
+	before, err := s.ValidateStored(ctx, dir, false)
+	if err != nil {
+		return nil, err
+	}
+	if before.Container != "fs" {
+		return nil, errors.NewValidationError("partial re-tiling needs fs outputs, reprocess the image instead").
+			WithContext("imageID", imageID).
+			WithContext("container", before.Container)
+	}
+	if !before.OK() {
+		return nil, errors.NewValidationError("fs outputs are incomplete, reprocess the image instead").
+			WithContext("imageID", imageID).
+			WithContext("missing", before.MissingCount).
+			WithContext("issues", len(before.Issues))
+	}
+
+	descriptor := before.Descriptor
+	switch {
+	case descriptor.Overlap != 0:
+		return nil, errors.NewValidationError("partial re-tiling needs tiles without overlap").
+			WithContext("imageID", imageID).
+			WithContext("overlap", descriptor.Overlap)
+	case fromLevel < 1 || fromLevel > descriptor.MaxLevel():
+		return nil, errors.NewValidationError("level to re-tile from is out of range").
+			WithContext("imageID", imageID).
+			WithContext("from_level", fromLevel).
+			WithContext("max_level", descriptor.MaxLevel())
+	case descriptor.ExpectedTiles(fromLevel) > maxRetileBaseTiles:
+		return nil, errors.NewValidationError("level to re-tile from has too many tiles, pick a lower one or reprocess").
+			WithContext("imageID", imageID).
+			WithContext("from_level", fromLevel).
+			WithContext("tiles", descriptor.ExpectedTiles(fromLevel)).
+			WithContext("max_tiles", maxRetileBaseTiles)
+	}
+
+	indexPath := filepath.Join(dir, "IndexMap.json")
+	references := map[string]string{}
+	hasIndex := fileExists(indexPath)
+	if hasIndex {
+		index, err := s.zipProcessor.ReadIndexMap(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		for ref, canonical := range index.References {
+			references[filepath.ToSlash(ref)] = filepath.ToSlash(canonical)
+		}
+	}
+
+	tiles, suffix, err := baseLevelTiles(dir, descriptor, fromLevel, references)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := model.NewFile(imageID, "image.dzi", dir, nil, nil, nil, nil)
+	if err != nil {
+		return nil, errors.WrapValidationError(err, "invalid image ID").
+			WithContext("imageID", imageID)
+	}
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to create workspace").
+			WithContext("imageID", imageID)
+	}
+	defer workspace.Remove()
+
+	s.logger.Info("Re-tiling low levels from stored tiles",
+		"imageID", imageID,
+		"fromLevel", fromLevel,
+		"baseTiles", len(tiles))
+
+	// Stitch the base level back together and tile it; dzsave writes the same grid
+	// for levels 0..fromLevel as long as the base level has the stored size
+	timeout := s.config.ImageProcessTimeoutMinute.DZIConversion
+	cols, _ := descriptor.LevelTiles(fromLevel)
+	joinedPath := workspace.Join("joined.v")
+	if _, err := s.vipsProcessor.JoinTiles(ctx, tiles, cols, joinedPath, timeout); err != nil {
+		return nil, err
+	}
+	width, height := descriptor.LevelSize(fromLevel)
+	basePath := workspace.Join("base.v")
+	if _, err := s.vipsProcessor.ExtractArea(ctx, joinedPath, basePath, 0, 0, width, height, timeout); err != nil {
+		return nil, err
+	}
+	if err := workspace.RemoveFile(joinedPath); err != nil {
+		s.logger.Warn("Failed to remove joined base level", "imageID", imageID, "error", err)
+	}
+
+	dziConfig := s.config.DZIConfig
+	dziConfig.TileSize = descriptor.TileSize
+	dziConfig.Overlap = 0
+	dziConfig.Layout = "dz"
+	dziConfig.Suffix = suffix
+	if _, err := s.vipsProcessor.CreateDZI(ctx, basePath, workspace.Join("image"), timeout, dziConfig, "fs", nil); err != nil {
+		return nil, err
+	}
+
+	regenerated, err := dzi.ParseFile(workspace.Join("image.dzi"))
+	if err != nil {
+		return nil, errors.WrapProcessingError(err, "invalid regenerated descriptor")
+	}
+	if regenerated.MaxLevel() != fromLevel {
+		return nil, errors.NewProcessingError("regenerated pyramid does not line up with the stored one").
+			WithContext("from_level", fromLevel).
+			WithContext("regenerated_max_level", regenerated.MaxLevel())
+	}
+	for level := 0; level < fromLevel; level++ {
+		w, h := regenerated.LevelSize(level)
+		storedW, storedH := descriptor.LevelSize(level)
+		if w != storedW || h != storedH {
+			return nil, errors.NewProcessingError("regenerated level size differs from the stored one").
+				WithContext("level", level).
+				WithContext("size", []int{w, h}).
+				WithContext("stored_size", []int{storedW, storedH})
+		}
+	}
+
+	// References into the regenerated levels would point at new bytes: tiles of kept
+	// levels get a copy of their old canonical tile, regenerated tiles are uploaded
+	// in full
+	for ref, canonical := range references {
+		refLevel, _, _, _ := dzi.ParseTilePath(ref)
+		canonicalLevel, _, _, _ := dzi.ParseTilePath(canonical)
+		switch {
+		case refLevel < fromLevel:
+			delete(references, ref)
+		case canonicalLevel < fromLevel:
+			if err := s.outputStorage.PutFile(ctx, filepath.Join(dir, filepath.FromSlash(canonical)), path.Join(prefix, ref)); err != nil {
+				return nil, errors.WrapStorageError(err, "failed to materialize referenced tile").
+					WithContext("tile", ref).
+					WithContext("canonical", canonical)
+			}
+			delete(references, ref)
+		}
+	}
+
+	for level := 0; level < fromLevel; level++ {
+		localDir := workspace.Join("image_files", strconv.Itoa(level))
+		if err := s.outputStorage.PutDirectory(ctx, localDir, filepath.Join(prefix, "tiles", strconv.Itoa(level))); err != nil {
+			return nil, errors.WrapStorageError(err, "failed to copy re-tiled level").
+				WithContext("imageID", imageID).
+				WithContext("level", level)
+		}
+	}
+
+	if hasIndex {
+		if len(references) > 0 {
+			if err := s.zipProcessor.WriteReferenceIndex(workspace.Dir(), references); err != nil {
+				return nil, err
+			}
+			if err := s.outputStorage.PutFile(ctx, workspace.Join("IndexMap.json"), filepath.Join(prefix, "IndexMap.json")); err != nil {
+				return nil, err
+			}
+		} else if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, "IndexMap.json")); err != nil {
+			return nil, err
+		}
+	}
+
+	// checksums.json and upload-manifest.json described the replaced tiles
+	if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, checksumsFilename)); err != nil {
+		s.logger.Warn("Failed to remove stale checksums", "imageID", imageID, "error", err)
+	}
+	if err := s.outputStorage.Delete(ctx, filepath.Join(prefix, uploadManifestFilename)); err != nil {
+		s.logger.Warn("Failed to remove stale upload manifest", "imageID", imageID, "error", err)
+	}
+
+	after, err := s.ValidateStored(ctx, dir, false)
+	if err == nil && !after.OK() {
+		err = errors.NewProcessingError("re-tiled outputs failed validation").
+			WithContext("missing", after.MissingCount).
+			WithContext("issues", len(after.Issues))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Low levels re-tiled",
+		"imageID", imageID,
+		"levels", fromLevel,
+		"referencesKept", len(references))
+
+	return after.Descriptor, nil
+}
+
+// baseLevelTiles lists the stored tiles of level in row-major order, resolving
+// deduplicated tiles to their canonical tile, and returns them with the tile suffix
+func baseLevelTiles(dir string, descriptor *dzi.Descriptor, level int, references map[string]string) ([]string, string, error) {
+	levelDir := filepath.Join(dir, "tiles", strconv.Itoa(level))
+	entries, err := os.ReadDir(levelDir)
+	if err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to list tile level").
+			WithContext("dir", levelDir)
+	}
+
+	cols, rows := descriptor.LevelTiles(level)
+	grid := make([]string, cols*rows)
+	suffix := ""
+	place := func(name, path string) {
+		_, col, row, ok := dzi.ParseTilePath(name)
+		if !ok || col >= cols || row >= rows {
+			return
+		}
+		grid[row*cols+col] = path
+		if suffix == "" {
+			suffix = strings.TrimPrefix(filepath.Ext(name), ".")
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			place(path.Join("tiles", strconv.Itoa(level), entry.Name()), filepath.Join(levelDir, entry.Name()))
+		}
+	}
+	prefix := path.Join("tiles", strconv.Itoa(level)) + "/"
+	for ref, canonical := range references {
+		if strings.HasPrefix(ref, prefix) {
+			place(ref, filepath.Join(dir, filepath.FromSlash(canonical)))
+		}
+	}
+
+	for i, tile := range grid {
+		if tile == "" {
+			return nil, "", errors.NewValidationError("tile level is incomplete").
+				WithContext("level", level).
+				WithContext("col", i%cols).
+				WithContext("row", i/cols)
+		}
+	}
+	return grid, suffix, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"syscall"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// ScratchBudget gates the slides a `himgproc process-dir` batch processes at once on
+// their estimated scratch disk usage instead of a fixed count, so large slides do not
+// share a full disk. A Cloud Run job processes one image, which is admitted at once.
+type ScratchBudget struct {
+	logger     *slog.Logger
+	sem        *semaphore.Weighted
+	capacity   int64
+	multiplier float64
+}
+
+func NewScratchBudget(logger *slog.Logger, cfg config.ScratchConfig) *ScratchBudget {
+	capacity := int64(cfg.BudgetMB) << 20
+	if capacity == 0 {
+		free, err := freeDiskBytes(cfg.Dir)
+		if err != nil {
+			logger.Warn("Failed to read free scratch space, scratch budget is unlimited",
+				"dir", cfg.Dir,
+				"error", err)
+			capacity = 1 << 62
+		} else {
+			capacity = free
+		}
+	}
+
+	logger.Info("Scratch budget initialized",
+		"dir", cfg.Dir,
+		"capacityMB", capacity>>20,
+		"multiplier", cfg.Multiplier)
+
+	return &ScratchBudget{
+		logger:     logger,
+		sem:        semaphore.NewWeighted(capacity),
+		capacity:   capacity,
+		multiplier: cfg.Multiplier,
+	}
+}
+
+// Estimate returns the scratch bytes a job on an input of inputSize is expected to use
+func (b *ScratchBudget) Estimate(inputSize int64) int64 {
+	return max(1, int64(float64(inputSize)*b.multiplier))
+}
+
+// Acquire blocks until bytes of scratch are available. The returned func releases them.
+// A job estimated above the whole budget is not rejected, it waits to run alone.
+func (b *ScratchBudget) Acquire(ctx context.Context, bytes int64) (func(), error) {
+	if bytes > b.capacity {
+		b.logger.Warn("Job estimate exceeds scratch budget, running it exclusively",
+			"requiredMB", bytes>>20,
+			"capacityMB", b.capacity>>20)
+		bytes = b.capacity
+	}
+
+	if !b.sem.TryAcquire(bytes) {
+		b.logger.Info("Waiting for scratch space", "requiredMB", bytes>>20)
+		if err := b.sem.Acquire(ctx, bytes); err != nil {
+			return nil, errors.WrapTimeoutError(err, "gave up waiting for scratch space").
+				WithContext("required_mb", bytes>>20)
+		}
+	}
+
+	return func() { b.sem.Release(bytes) }, nil
+}
+
+// InputSize stats the original input of file without modifying it
+func (s *ImageProcessingService) InputSize(ctx context.Context, file *model.File) (int64, error) {
+	probe := file.Clone()
+	if err := s.resolveOriginalPath(ctx, probe); err != nil {
+		return 0, err
+	}
+	size, err := s.inputSize(ctx, probe.AbsolutePath())
+	if err != nil {
+		return 0, err
+	}
+	// The data files of a multi-file slide are counted where the mount shows them,
+	// storages read through an API only report the index file
+	if processors.IsMultiFileFormat(probe.Extension()) {
+		if bundle, err := processors.SlideBundleSize(probe.AbsolutePath()); err == nil {
+			size = bundle
+		}
+	}
+	return size, nil
+}
+
+func freeDiskBytes(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
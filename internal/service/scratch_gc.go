@@ -0,0 +1,111 @@
+package service
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// scratchPrefixes are the directory name prefixes this service creates in the scratch dir
+var scratchPrefixes = []string{"workspace-", "himgproc-bench-"}
+
+// ScratchGCResult lists what a scratch garbage collection removed (or would remove)
+type ScratchGCResult struct {
+	Dir        string   `json:"dir"`
+	Removed    []string `json:"removed"`
+	Kept       int      `json:"kept"`
+	FreedBytes int64    `json:"freed_bytes"`
+	Failed     []string `json:"failed,omitempty"`
+}
+
+// CollectScratch removes workspace directories under dir in which nothing was modified
+// for maxAge. Crashed or killed jobs never reach their cleanup, so their workspaces
+// would otherwise stay until the instance is recycled. With dryRun nothing is removed.
+func CollectScratch(logger *slog.Logger, dir string, maxAge time.Duration, dryRun bool) (*ScratchGCResult, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to list scratch directory").
+			WithContext("dir", dir)
+	}
+
+	result := &ScratchGCResult{Dir: dir}
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		if !entry.IsDir() || !hasScratchPrefix(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		size, stale := staleTree(path, cutoff)
+		if !stale {
+			result.Kept++
+			continue
+		}
+
+		if !dryRun {
+			if err := os.RemoveAll(path); err != nil {
+				logger.Warn("Failed to remove stale workspace",
+					"path", path,
+					"error", err)
+				result.Failed = append(result.Failed, path)
+				continue
+			}
+		}
+		result.Removed = append(result.Removed, path)
+		result.FreedBytes += size
+	}
+
+	if len(result.Removed) > 0 || len(result.Failed) > 0 {
+		logger.Info("Collected stale workspaces",
+			"dir", dir,
+			"removed", len(result.Removed),
+			"failed", len(result.Failed),
+			"kept", result.Kept,
+			"freedMB", result.FreedBytes>>20,
+			"dryRun", dryRun)
+	}
+
+	return result, nil
+}
+
+func hasScratchPrefix(name string) bool {
+	for _, prefix := range scratchPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleTree reports whether nothing under root was modified after cutoff, and the
+// total size of the tree. The walk stops at the first recent entry.
+func staleTree(root string, cutoff time.Time) (int64, bool) {
+	var size int64
+	stale := true
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries vanishing mid-walk belong to a live job
+			stale = false
+			return fs.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			stale = false
+			return fs.SkipAll
+		}
+		if info.ModTime().After(cutoff) {
+			stale = false
+			return fs.SkipAll
+		}
+		if !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, stale
+}
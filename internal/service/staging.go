@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// stagedInputDir holds the workspace copy of the input when INPUT_STAGING is set
+const stagedInputDir = "input"
+
+const checksumsFilename = "checksums.json"
+
+// checksumStorage is implemented by storages that can record checksums while copying
+type checksumStorage interface {
+	Checksums() *storage.ChecksumLedger
+}
+
+// ChecksumManifest lists the SHA-256 of every output copied for an image
+type ChecksumManifest struct {
+	Algorithm string            `json:"algorithm"`
+	Files     map[string]string `json:"files"`
+}
+
+// StageInput copies the input from the mount into the workspace and points file
+// at the copy, with the companion directory of a multi-file slide next to it. It
+// returns the input checksum when the input storage computed one during the copy,
+// "" otherwise.
+func (s *ImageProcessingService) StageInput(ctx context.Context, file *model.File, workspace *model.Workspace) (string, error) {
+	originalPath := file.AbsolutePath()
+	stagedDir := workspace.Join(stagedInputDir)
+	if err := os.MkdirAll(stagedDir, 0755); err != nil {
+		return "", errors.WrapStorageError(err, "failed to create staging directory").
+			WithContext("dir", stagedDir)
+	}
+
+	startedAt := time.Now()
+	stagedPath := filepath.Join(stagedDir, file.Filename)
+	if err := s.inputStorage.CopyToLocal(ctx, originalPath, stagedPath); err != nil {
+		return "", err
+	}
+	if processors.IsMultiFileFormat(file.Extension()) {
+		if err := s.stageCompanionDir(ctx, originalPath, stagedPath); err != nil {
+			return "", err
+		}
+	}
+	file.SetDir(stagedDir)
+
+	checksum := ""
+	if cs, ok := s.inputStorage.(checksumStorage); ok && cs.Checksums() != nil {
+		checksum, _ = cs.Checksums().Get(originalPath)
+	}
+
+	s.logger.Info("Staged input into workspace",
+		"fileID", file.ID,
+		"originalPath", originalPath,
+		"sha256", checksum,
+		"durationMs", time.Since(startedAt).Milliseconds())
+
+	return checksum, nil
+}
+
+// StagedInput is an original staged into the workspace of its job by StageFile, for
+// jobs that need its checksum before deciding to process it
+type StagedInput struct {
+	Workspace *model.Workspace
+	Checksum  string // SHA-256 of the original
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// StageFile creates the workspace of file and stages its original into it, whatever
+// INPUT_STAGING says, pointing file at the copy. The checksum is the one the input
+// storage computed while copying; storages that compute none have the local copy
+// hashed instead, so the original is never read twice. ProcessStaged continues in
+// the workspace; when the job ends without processing, the caller removes it.
+func (s *ImageProcessingService) StageFile(ctx context.Context, file *model.File) (_ *StagedInput, err error) {
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, errors.NewStorageError("failed to create workspace").
+			WithContext("fileID", file.ID)
+	}
+	defer func() {
+		if err != nil {
+			workspace.Remove()
+		}
+	}()
+
+	s.logger.Info("Created workspace",
+		"fileID", file.ID,
+		"workspace", workspace.Dir())
+
+	if err := s.resolveOriginalPath(ctx, file); err != nil {
+		return nil, err
+	}
+	if ctx, err = s.checkOriginal(ctx, file); err != nil {
+		return nil, err
+	}
+
+	staged := &StagedInput{Workspace: workspace, StartedAt: time.Now()}
+	err = s.TrackStep(file.ID, "input_staging", func() error {
+		staged.Checksum, err = s.StageInput(ctx, file, workspace)
+		if err == nil && staged.Checksum == "" {
+			staged.Checksum, err = fileChecksum(file.AbsolutePath())
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	staged.Duration = time.Since(staged.StartedAt)
+	return staged, nil
+}
+
+// fileChecksum is the SHA-256 of a local file
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to open staged input").
+			WithContext("path", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.WrapStorageError(err, "failed to hash staged input").
+			WithContext("path", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stageCompanionDir copies the companion directory of the multi-file slide at
+// originalPath next to its staged copy, OpenSlide finds the data files by the name of
+// the index file
+func (s *ImageProcessingService) stageCompanionDir(ctx context.Context, originalPath, stagedPath string) error {
+	ds, ok := s.inputStorage.(storage.DirectoryInputStorage)
+	if !ok {
+		return errors.NewConfigurationError("input storage cannot copy the companion directory of a multi-file slide").
+			WithContext("path", originalPath)
+	}
+	originalDir := processors.CompanionDir(originalPath)
+	if err := ds.CopyDirToLocal(ctx, originalDir, processors.CompanionDir(stagedPath)); err != nil {
+		if errors.Is(err, errors.ErrorTypeNotFound) {
+			return errors.NewValidationError("multi-file slide has no companion directory").
+				WithContext("path", originalPath).
+				WithContext("dir", originalDir)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyChecksums writes checksums.json from the checksums the output storage
+// recorded while copying the image outputs and copies it next to them
+func (s *ImageProcessingService) copyChecksums(ctx context.Context, workspace *model.Workspace, imageID string) error {
+	cs, ok := s.outputStorage.(checksumStorage)
+	if !ok || cs.Checksums() == nil {
+		return nil
+	}
+
+	manifest := ChecksumManifest{
+		Algorithm: "sha256",
+		Files:     cs.Checksums().Under(imageID),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.WrapInternalError(err, "failed to encode checksums")
+	}
+
+	localPath := workspace.Join(checksumsFilename)
+	if err := os.WriteFile(localPath, data, 0644); err != nil {
+		return errors.WrapStorageError(err, "failed to write checksums.json").
+			WithContext("path", localPath)
+	}
+
+	remotePath := filepath.Join(imageID, checksumsFilename)
+	if err := s.outputStorage.PutFile(ctx, localPath, remotePath); err != nil {
+		return errors.WrapStorageError(err, "failed to copy checksums to storage").
+			WithContext("local_path", localPath).
+			WithContext("remote_path", remotePath)
+	}
+
+	s.logger.Info("Output checksums written",
+		"imageID", imageID,
+		"files", len(manifest.Files))
+
+	return nil
+}
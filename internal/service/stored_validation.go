@@ -0,0 +1,320 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// maxListedTiles caps the tile names listed per problem category in a report
+const maxListedTiles = 50
+
+// StoredValidation is the result of checking an already published output prefix
+type StoredValidation struct {
+	Dir        string           `json:"dir"`
+	Container  string           `json:"container"`
+	Descriptor *dzi.Descriptor  `json:"descriptor,omitempty"`
+	Levels     []dzi.LevelTally `json:"levels,omitempty"`
+
+	MissingCount    int      `json:"missing_count"`
+	Missing         []string `json:"missing,omitempty"`
+	UnexpectedCount int      `json:"unexpected_count"`
+	Unexpected      []string `json:"unexpected,omitempty"`
+	CorruptCount    int      `json:"corrupt_count"`
+	Corrupt         []string `json:"corrupt,omitempty"`
+	TilesChecked    int      `json:"tiles_checked"`
+
+	// Issues are descriptor, index and layout problems that are not about a single tile
+	Issues []string `json:"issues,omitempty"`
+}
+
+// OK reports whether no problem was found
+func (v *StoredValidation) OK() bool {
+	return v.MissingCount == 0 && v.UnexpectedCount == 0 && v.CorruptCount == 0 && len(v.Issues) == 0
+}
+
+func (v *StoredValidation) issue(format string, args ...any) {
+	v.Issues = append(v.Issues, fmt.Sprintf(format, args...))
+}
+
+func (v *StoredValidation) addCorrupt(name string, err error) {
+	v.CorruptCount++
+	if len(v.Corrupt) < maxListedTiles {
+		v.Corrupt = append(v.Corrupt, fmt.Sprintf("%s: %v", name, err))
+	}
+}
+
+// ValidateStored checks a published output directory (an image prefix on the
+// output mount): the descriptor, IndexMap.json and the tile pyramid against the
+// grid the descriptor implies. With deep set every tile is read and decoded, which
+// also verifies zip CRCs, and every object listed in upload-manifest.json is checked
+// against its size and CRC32C; otherwise only names and the index are compared.
+func (s *ImageProcessingService) ValidateStored(ctx context.Context, dir string, deep bool) (*StoredValidation, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to access output directory").
+			WithContext("dir", dir)
+	}
+	if !info.IsDir() {
+		return nil, errors.NewValidationError("output path is not a directory").
+			WithContext("dir", dir)
+	}
+
+	result := &StoredValidation{Dir: dir}
+
+	descriptor, err := dzi.ParseFile(filepath.Join(dir, "image.dzi"))
+	if err != nil {
+		result.issue("image.dzi: %v", err)
+		return result, nil
+	}
+	result.Descriptor = descriptor
+
+	zipPath := filepath.Join(dir, "image.zip")
+	switch {
+	case fileExists(zipPath):
+		result.Container = "zip"
+		err = s.validateStoredZip(ctx, dir, zipPath, descriptor, deep, result)
+	case fileExists(filepath.Join(dir, "tiles")):
+		result.Container = "fs"
+		err = s.validateStoredTiles(ctx, dir, descriptor, deep, result)
+	default:
+		result.issue("neither image.zip nor tiles/ found")
+	}
+	if err == nil && deep {
+		err = validateUploadManifest(ctx, dir, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Stored outputs validated",
+		"dir", dir,
+		"container", result.Container,
+		"ok", result.OK(),
+		"missing", result.MissingCount,
+		"corrupt", result.CorruptCount,
+		"issues", len(result.Issues))
+
+	return result, nil
+}
+
+func (s *ImageProcessingService) validateStoredZip(ctx context.Context, dir, zipPath string, descriptor *dzi.Descriptor, deep bool, result *StoredValidation) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		result.issue("image.zip: %v", err)
+		return nil
+	}
+	defer r.Close()
+
+	entries := make(map[string]*zip.File, len(r.File))
+	names := make([]string, 0, len(r.File))
+	for _, f := range r.File {
+		entries[f.Name] = f
+		names = append(names, f.Name)
+
+		// The standalone descriptor must match the one inside the archive
+		if filepath.Base(f.Name) == "image.dzi" {
+			if inner, err := readZipDescriptor(f); err != nil {
+				result.issue("image.dzi in zip: %v", err)
+			} else if *inner != *descriptor {
+				result.issue("image.dzi differs from the descriptor inside image.zip")
+			}
+		}
+	}
+
+	index, err := s.zipProcessor.ReadIndexMap(filepath.Join(dir, "IndexMap.json"))
+	if err != nil {
+		result.issue("IndexMap.json: %v", err)
+	} else {
+		indexed := make(map[string]bool, len(index.Entries))
+		for _, entry := range index.Entries {
+			indexed[entry.Name] = true
+			f, ok := entries[entry.Name]
+			if !ok {
+				result.issue("IndexMap.json lists %s which is not in image.zip", entry.Name)
+				continue
+			}
+			offset, err := f.DataOffset()
+			if err != nil || offset != entry.Offset || int64(f.CompressedSize64) != entry.CompressedSize {
+				result.issue("IndexMap.json entry for %s does not match image.zip", entry.Name)
+			}
+		}
+		if len(indexed) != len(entries) {
+			result.issue("IndexMap.json lists %d entries, image.zip has %d", len(indexed), len(entries))
+		}
+	}
+
+	tallyStored(descriptor, names, result)
+
+	if !deep {
+		return nil
+	}
+	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, _, _, ok := dzi.ParseTilePath(f.Name); !ok {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			result.addCorrupt(f.Name, err)
+			continue
+		}
+		// Reading to EOF makes archive/zip verify the CRC
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		result.TilesChecked++
+		if err != nil {
+			result.addCorrupt(f.Name, err)
+			continue
+		}
+		if err := checkTile(data, descriptor); err != nil {
+			result.addCorrupt(f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *ImageProcessingService) validateStoredTiles(ctx context.Context, dir string, descriptor *dzi.Descriptor, deep bool, result *StoredValidation) error {
+	tilesDir := filepath.Join(dir, "tiles")
+
+	var names []string
+	err := filepath.WalkDir(tilesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(tilesDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to walk tiles directory").
+			WithContext("tiles_dir", tilesDir)
+	}
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+	}
+
+	// Deduplicated tiles are stored once and referenced from IndexMap.json
+	indexPath := filepath.Join(dir, "IndexMap.json")
+	if fileExists(indexPath) {
+		index, err := s.zipProcessor.ReadIndexMap(indexPath)
+		if err != nil {
+			result.issue("IndexMap.json: %v", err)
+		} else {
+			for ref, canonical := range index.References {
+				target := strings.TrimPrefix(filepath.ToSlash(canonical), "tiles/")
+				if !present[target] {
+					result.issue("reference %s points to missing tile %s", ref, canonical)
+					continue
+				}
+				names = append(names, strings.TrimPrefix(filepath.ToSlash(ref), "tiles/"))
+			}
+		}
+	}
+
+	tallyStored(descriptor, names, result)
+
+	if !deep {
+		return nil
+	}
+	for name := range present {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, _, _, ok := dzi.ParseTilePath(name); !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(tilesDir, filepath.FromSlash(name)))
+		result.TilesChecked++
+		if err != nil {
+			result.addCorrupt(name, err)
+			continue
+		}
+		if err := checkTile(data, descriptor); err != nil {
+			result.addCorrupt(name, err)
+		}
+	}
+	return nil
+}
+
+// tallyStored fills the level tallies and the missing and unexpected tiles
+func tallyStored(descriptor *dzi.Descriptor, names []string, result *StoredValidation) {
+	tallies, unexpected := descriptor.TallyTiles(names)
+	result.Levels = tallies
+	result.UnexpectedCount = len(unexpected)
+	result.Unexpected = unexpected[:min(len(unexpected), maxListedTiles)]
+
+	found := make(map[[3]int]bool, len(names))
+	for _, name := range names {
+		if level, col, row, ok := dzi.ParseTilePath(name); ok {
+			found[[3]int{level, col, row}] = true
+		}
+	}
+	for _, tally := range tallies {
+		if tally.Complete() {
+			continue
+		}
+		cols, rows := descriptor.LevelTiles(tally.Level)
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				if found[[3]int{tally.Level, col, row}] {
+					continue
+				}
+				result.MissingCount++
+				if len(result.Missing) < maxListedTiles {
+					result.Missing = append(result.Missing, descriptor.TileName(tally.Level, col, row))
+				}
+			}
+		}
+	}
+}
+
+// checkTile decodes the tile header and checks it fits the descriptor tile size
+func checkTile(data []byte, descriptor *dzi.Descriptor) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	limit := descriptor.TileSize + 2*descriptor.Overlap
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > limit || cfg.Height > limit {
+		return fmt.Errorf("tile is %dx%d, expected at most %dx%d", cfg.Width, cfg.Height, limit, limit)
+	}
+	return nil
+}
+
+func readZipDescriptor(f *zip.File) (*dzi.Descriptor, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return dzi.Parse(rc)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
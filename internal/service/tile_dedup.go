@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// putTileLevel copies one fs-container level directory to output storage. With
+// deduplication enabled every tile is hashed and only the first tile with given
+// content is uploaded; the others are recorded as references to it.
+func (s *ImageProcessingService) putTileLevel(ctx context.Context, workspace *model.Workspace, localDir, relDir, imageID string) error {
+	remoteDir := filepath.Join(imageID, relDir)
+	if !s.config.DZIConfig.Dedup {
+		return s.outputStorage.PutDirectory(ctx, localDir, remoteDir)
+	}
+
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to read tile level directory").
+			WithContext("local_dir", localDir)
+	}
+
+	dedup := workspace.TileDedup()
+	duplicates := 0
+	for _, entry := range entries {
+		if err := deadline.Err(ctx, "tile copy"); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			continue
+		}
+		localPath := filepath.Join(localDir, entry.Name())
+		relPath := filepath.Join(relDir, entry.Name())
+
+		sum, err := hashFile(localPath)
+		if err != nil {
+			return err
+		}
+		if _, duplicate := dedup.Observe(relPath, sum); duplicate {
+			duplicates++
+			continue
+		}
+
+		if err := s.outputStorage.PutFile(ctx, localPath, filepath.Join(imageID, relPath)); err != nil {
+			return err
+		}
+	}
+
+	s.logger.Debug("Copied tile level",
+		"imageID", imageID,
+		"level", relDir,
+		"tiles", len(entries),
+		"duplicates", duplicates)
+
+	return nil
+}
+
+// finalizeTileDedup writes the tile references to IndexMap.json, copies it to
+// output storage and removes the duplicate tiles from the workspace so the final
+// upload skips them as well
+func (s *ImageProcessingService) finalizeTileDedup(ctx context.Context, workspace *model.Workspace, imageID string) error {
+	references := workspace.TileDedup().References()
+	if len(references) == 0 {
+		return nil
+	}
+
+	if err := s.zipProcessor.WriteReferenceIndex(workspace.Dir(), references); err != nil {
+		return err
+	}
+
+	localPath := workspace.Join("IndexMap.json")
+	remotePath := filepath.Join(imageID, "IndexMap.json")
+	if err := s.outputStorage.PutFile(ctx, localPath, remotePath); err != nil {
+		return errors.WrapStorageError(err, "failed to copy tile references to storage").
+			WithContext("local_path", localPath).
+			WithContext("remote_path", remotePath)
+	}
+
+	for relPath := range references {
+		if err := os.Remove(workspace.Join(relPath)); err != nil && !os.IsNotExist(err) {
+			s.logger.Warn("Failed to remove duplicate tile from workspace",
+				"path", relPath,
+				"error", err)
+		}
+	}
+
+	s.logger.Info("Deduplicated identical tiles",
+		"imageID", imageID,
+		"references", len(references))
+
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.WrapStorageError(err, "failed to open tile").
+			WithContext("path", path)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.WrapStorageError(err, "failed to hash tile").
+			WithContext("path", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
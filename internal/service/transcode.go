@@ -0,0 +1,365 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// transcodeMarkerName is written into a transcode prefix, naming the image it was
+// transcoded from
+const transcodeMarkerName = "transcode.json"
+
+// TranscodeMarker records which image and spec the pyramid under a prefix came from
+type TranscodeMarker struct {
+	ImageID      string    `json:"image_id"`
+	Format       string    `json:"format"`
+	Quality      int       `json:"quality"`
+	TranscodedAt time.Time `json:"transcoded_at"`
+}
+
+// TranscodeTiles re-encodes the stored pyramid of an image (fs or zip container,
+// under prefix on the output mount) in the tile format and quality of spec and writes it under spec.Prefix on the output
+// mount, in the same container and with an image.dzi naming the new format. The
+// outputs of the image and its original are only read. It returns the descriptor of
+// the transcoded pyramid and its container.
+func (s *ImageProcessingService) TranscodeTiles(ctx context.Context, imageID, prefix string, spec *model.TranscodeSpec) (*dzi.Descriptor, string, error) {
+	if err := spec.ValidateFor(imageID); err != nil {
+		return nil, "", errors.WrapValidationError(err, "invalid transcode spec").
+			WithContext("imageID", imageID)
+	}
+	if err := s.checkTranscodePrefix(imageID, spec.Prefix); err != nil {
+		return nil, "", err
+	}
+	dir := filepath.Join(s.config.Storage.OutputMountPath, prefix)
+
+	source, err := s.ValidateStored(ctx, dir, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if !source.OK() {
+		return nil, "", errors.NewValidationError("stored outputs are incomplete, reprocess the image instead").
+			WithContext("imageID", imageID).
+			WithContext("missing", source.MissingCount).
+			WithContext("issues", len(source.Issues))
+	}
+	// Format is the exact tile suffix: jpg and jpeg tiles have different names
+	if source.Descriptor.Format == spec.Format && spec.Quality == 0 {
+		return nil, "", errors.NewValidationError("tiles already use the format, pass a quality to re-encode them").
+			WithContext("imageID", imageID).
+			WithContext("format", spec.Format)
+	}
+
+	file, err := model.NewFile(imageID, "image.dzi", dir, nil, nil, nil, nil)
+	if err != nil {
+		return nil, "", errors.WrapValidationError(err, "invalid image ID").
+			WithContext("imageID", imageID)
+	}
+	workspace, err := s.newWorkspace(file)
+	if err != nil {
+		return nil, "", errors.NewStorageError("failed to create workspace").
+			WithContext("imageID", imageID)
+	}
+	defer workspace.Remove()
+
+	// Tiles of the zip container are unpacked first; deduplicated fs tiles are
+	// transcoded once and stay references, renamed to the new suffix
+	tilesDir := filepath.Join(dir, "tiles")
+	var references map[string]string
+	if source.Container == "zip" {
+		tilesDir = workspace.Join("source")
+		if err := extractZipTiles(ctx, filepath.Join(dir, "image.zip"), tilesDir); err != nil {
+			return nil, "", err
+		}
+	} else if indexPath := filepath.Join(dir, "IndexMap.json"); fileExists(indexPath) {
+		index, err := s.zipProcessor.ReadIndexMap(indexPath)
+		if err != nil {
+			return nil, "", err
+		}
+		references = make(map[string]string, len(index.References))
+		for ref, canonical := range index.References {
+			references[withSuffix(filepath.ToSlash(ref), spec.Format)] = withSuffix(filepath.ToSlash(canonical), spec.Format)
+		}
+	}
+
+	quality := spec.Quality
+	if quality == 0 {
+		quality = s.config.DZIConfig.Quality
+	}
+	if spec.Format == "png" {
+		quality = 0
+	}
+
+	s.logger.Info("Transcoding stored tiles",
+		"imageID", imageID,
+		"container", source.Container,
+		"from", source.Descriptor.Format,
+		"to", spec.Format,
+		"quality", quality,
+		"prefix", spec.Prefix)
+
+	outDir := workspace.Join("transcoded")
+	tiles, err := s.transcodeTileTree(ctx, tilesDir, filepath.Join(outDir, "tiles"), spec.Format, quality)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Viewers request <level>/<col>_<row>.<Format>, the suffix the tiles were written with
+	descriptor := *source.Descriptor
+	descriptor.Format = spec.Format
+	if err := descriptor.WriteFile(filepath.Join(outDir, "image.dzi")); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to write transcoded descriptor")
+	}
+
+	marker, err := json.MarshalIndent(TranscodeMarker{
+		ImageID:      imageID,
+		Format:       spec.Format,
+		Quality:      quality,
+		TranscodedAt: s.clock.Now(),
+	}, "", "  ")
+	if err != nil {
+		return nil, "", errors.WrapInternalError(err, "failed to encode transcode marker")
+	}
+	if err := os.WriteFile(filepath.Join(outDir, transcodeMarkerName), marker, 0644); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to write transcode marker")
+	}
+
+	// A transcoded pyramid replaces the previous one under the prefix as a whole
+	if err := s.outputStorage.Delete(ctx, spec.Prefix); err != nil {
+		return nil, "", err
+	}
+
+	if source.Container == "zip" {
+		zipPath := workspace.Join("image.zip")
+		if err := writeTileZip(ctx, outDir, zipPath, nil, s.config.DZIConfig.Compression, s.clock.Now()); err != nil {
+			return nil, "", err
+		}
+		if _, err := s.zipProcessor.BuildIndexMap(ctx, zipPath, workspace.Dir(), nil); err != nil {
+			return nil, "", err
+		}
+		for _, name := range []string{"image.zip", "IndexMap.json"} {
+			if err := s.outputStorage.PutFile(ctx, workspace.Join(name), filepath.Join(spec.Prefix, name)); err != nil {
+				return nil, "", errors.WrapStorageError(err, "failed to copy transcoded outputs").
+					WithContext("prefix", spec.Prefix).
+					WithContext("file", name)
+			}
+		}
+	} else {
+		if err := s.outputStorage.PutDirectory(ctx, filepath.Join(outDir, "tiles"), filepath.Join(spec.Prefix, "tiles")); err != nil {
+			return nil, "", errors.WrapStorageError(err, "failed to copy transcoded tiles").
+				WithContext("prefix", spec.Prefix)
+		}
+		if len(references) > 0 {
+			if err := s.zipProcessor.WriteReferenceIndex(outDir, references); err != nil {
+				return nil, "", err
+			}
+			if err := s.outputStorage.PutFile(ctx, filepath.Join(outDir, "IndexMap.json"), filepath.Join(spec.Prefix, "IndexMap.json")); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	// With the thumbnail the prefix is a complete output set for viewers and records
+	if thumbnail := filepath.Join(dir, "thumbnail.jpg"); fileExists(thumbnail) {
+		if err := s.outputStorage.PutFile(ctx, thumbnail, filepath.Join(spec.Prefix, "thumbnail.jpg")); err != nil {
+			return nil, "", errors.WrapStorageError(err, "failed to copy thumbnail").
+				WithContext("prefix", spec.Prefix)
+		}
+	}
+
+	if err := s.outputStorage.PutFile(ctx, filepath.Join(outDir, transcodeMarkerName), filepath.Join(spec.Prefix, transcodeMarkerName)); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to copy transcode marker").
+			WithContext("prefix", spec.Prefix)
+	}
+
+	// image.dzi goes last: readers take the prefix for a complete pyramid once it exists
+	if err := s.outputStorage.PutFile(ctx, filepath.Join(outDir, "image.dzi"), filepath.Join(spec.Prefix, "image.dzi")); err != nil {
+		return nil, "", errors.WrapStorageError(err, "failed to copy transcoded descriptor").
+			WithContext("prefix", spec.Prefix)
+	}
+
+	after, err := s.ValidateStored(ctx, filepath.Join(s.config.Storage.OutputMountPath, spec.Prefix), false)
+	if err == nil && !after.OK() {
+		err = errors.NewProcessingError("transcoded outputs failed validation").
+			WithContext("missing", after.MissingCount).
+			WithContext("issues", len(after.Issues))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info("Stored tiles transcoded",
+		"imageID", imageID,
+		"prefix", spec.Prefix,
+		"tiles", tiles,
+		"references", len(references))
+
+	return after.Descriptor, source.Container, nil
+}
+
+// checkTranscodePrefix refuses a prefix that holds a pyramid other than an earlier
+// transcode of imageID: the transcode replaces everything under it
+func (s *ImageProcessingService) checkTranscodePrefix(imageID, prefix string) error {
+	dir := filepath.Join(s.config.Storage.OutputMountPath, prefix)
+	if !fileExists(filepath.Join(dir, "image.dzi")) {
+		return nil
+	}
+	var marker TranscodeMarker
+	data, err := os.ReadFile(filepath.Join(dir, transcodeMarkerName))
+	if err == nil && json.Unmarshal(data, &marker) == nil && marker.ImageID == imageID {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WrapStorageError(err, "failed to read transcode marker").
+			WithContext("prefix", prefix)
+	}
+	return errors.NewValidationError("transcode prefix holds outputs that are not a transcode of the image").
+		WithContext("imageID", imageID).
+		WithContext("prefix", prefix).
+		WithContext("transcodedFrom", marker.ImageID)
+}
+
+// transcodeTileTree re-encodes every tile below srcDir into the same place below
+// dstDir with suffix format, TRANSCODE_PARALLELISM tiles at once, and returns the
+// number of tiles
+func (s *ImageProcessingService) transcodeTileTree(ctx context.Context, srcDir, dstDir, format string, quality int) (int, error) {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(s.config.Transcode.Parallelism, 1))
+
+	timeout := s.config.ImageProcessTimeoutMinute.General
+	tiles := 0
+	walkErr := filepath.WalkDir(srcDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// A failed tile cancels gctx, no need to queue the rest
+		if err := gctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, p)
+		if err != nil {
+			return err
+		}
+		if _, _, _, ok := dzi.ParseTilePath(filepath.ToSlash(rel)); !ok {
+			return nil
+		}
+
+		tiles++
+		dst := filepath.Join(dstDir, withSuffix(rel, format))
+		g.Go(func() error {
+			_, err := s.vipsProcessor.EncodeImage(gctx, p, dst, quality, timeout)
+			return err
+		})
+		return nil
+	})
+	err := g.Wait()
+
+	if ctxErr := deadline.Err(ctx, "tile transcoding"); ctxErr != nil {
+		return 0, ctxErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if walkErr != nil {
+		return 0, errors.WrapStorageError(walkErr, "failed to list stored tiles").
+			WithContext("tiles_dir", srcDir)
+	}
+	return tiles, nil
+}
+
+// extractZipTiles unpacks the pyramid of a zip container into destDir, laid out like
+// the tiles/ directory of the fs container
+func extractZipTiles(ctx context.Context, zipPath, destDir string) error {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to open image.zip").
+			WithContext("zip", zipPath)
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		name, ok := strings.CutPrefix(f.Name, zipTilePrefix)
+		if !ok || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		if err := model.ValidateRelativePath("zip entry", name); err != nil {
+			return errors.WrapValidationError(err, "invalid zip entry").
+				WithContext("zip", zipPath)
+		}
+		if err := extractZipFile(ctx, f, filepath.Join(destDir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withSuffix replaces the extension of a tile path with format
+func withSuffix(p, format string) string {
+	return strings.TrimSuffix(p, path.Ext(p)) + "." + format
+}
+
+// transcodeTiles re-encodes the stored tiles of an image under the prefix of the job
+// and publishes a completion event for the transcoded pyramid, marked by its
+// transcode spec so records keep pointing at the primary outputs
+func (o *JobOrchestrator) transcodeTiles(ctx context.Context, input *model.JobInput) error {
+	o.logger.Info("Starting tile transcoding job",
+		"imageID", input.ImageID,
+		"format", input.Transcode.Format,
+		"prefix", input.Transcode.Prefix)
+
+	// The prefix is in the namespace of the image, but image IDs may contain dashes too
+	if o.images != nil {
+		_, err := o.images.GetByID(ctx, input.Transcode.Prefix)
+		if err == nil {
+			return errors.NewValidationError("transcode prefix is the ID of another image").
+				WithContext("imageID", input.ImageID).
+				WithContext("prefix", input.Transcode.Prefix)
+		}
+		if !errors.Is(err, errors.ErrorTypeNotFound) {
+			return err
+		}
+	}
+
+	prefix, _, err := o.storedOutputs(ctx, input.ImageID)
+	if err != nil {
+		return err
+	}
+	descriptor, container, err := o.imageProcessingService.TranscodeTiles(ctx, input.ImageID, prefix, input.Transcode)
+	if err != nil {
+		return err
+	}
+
+	processingVersion := "v2"
+	if container == "fs" {
+		processingVersion = "v1"
+	}
+	event, err := o.storedContentsEvent(input.ImageID, input.Transcode.Prefix, processingVersion, descriptor)
+	if err != nil {
+		return err
+	}
+	event.Transcode = input.Transcode
+	event.CausedBy(input.RequestEventID, input.CorrelationID)
+	if err := o.publishEvent(ctx, event); err != nil {
+		return err
+	}
+
+	o.logger.Info("Tile transcoding job completed successfully",
+		"imageID", input.ImageID,
+		"prefix", input.Transcode.Prefix)
+	return nil
+}
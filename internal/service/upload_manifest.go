@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+const uploadManifestFilename = "upload-manifest.json"
+
+// crc32cTable is the Castagnoli table GCS computes object checksums with
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// writeUploadManifest lists every file under dir with its size and CRC32C in
+// upload-manifest.json in dir, so the manifest goes up with the upload it describes.
+// The manifest does not list itself.
+func writeUploadManifest(ctx context.Context, dir string) (*model.UploadManifest, error) {
+	manifest := &model.UploadManifest{
+		Version:   1,
+		Algorithm: "crc32c",
+		Objects:   []model.UploadedObject{},
+	}
+	manifestPath := filepath.Join(dir, uploadManifestFilename)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := deadline.Err(ctx, "upload manifest"); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || path == manifestPath {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		size, sum, err := crc32cFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		manifest.Objects = append(manifest.Objects, model.UploadedObject{
+			Path:   filepath.ToSlash(rel),
+			Size:   size,
+			CRC32C: sum,
+		})
+		return nil
+	})
+	if ctxErr := deadline.Err(ctx, "upload manifest"); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, errors.WrapStorageError(err, "failed to checksum outputs").
+			WithContext("dir", dir)
+	}
+	sort.Slice(manifest.Objects, func(i, j int) bool {
+		return manifest.Objects[i].Path < manifest.Objects[j].Path
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.WrapInternalError(err, "failed to encode upload manifest")
+	}
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		return nil, errors.WrapStorageError(err, "failed to write upload manifest").
+			WithContext("path", manifestPath)
+	}
+	return manifest, nil
+}
+
+// crc32cFile returns the size and the CRC32C (base64, big-endian) of the file at path
+func crc32cFile(ctx context.Context, path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := crc32.New(crc32cTable)
+	n, err := io.Copy(h, deadline.Reader(ctx, f, "upload manifest"))
+	if err != nil {
+		return n, "", err
+	}
+	return n, base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, h.Sum32())), nil
+}
+
+// validateUploadManifest compares the objects listed in the upload-manifest.json of
+// dir, if any, with the stored files: every object must exist with its size and
+// CRC32C. Objects added after the upload (e.g. by a migration) are not checked.
+func validateUploadManifest(ctx context.Context, dir string, result *StoredValidation) error {
+	data, err := os.ReadFile(filepath.Join(dir, uploadManifestFilename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WrapStorageError(err, "failed to read upload manifest").
+			WithContext("dir", dir)
+	}
+	var manifest model.UploadManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		result.issue("%s: %v", uploadManifestFilename, err)
+		return nil
+	}
+
+	// Reported as issues, missing and corrupt tiles are already counted by the pyramid checks
+	problems := 0
+	report := func(format string, args ...any) {
+		problems++
+		if problems <= maxListedTiles {
+			result.issue(format, args...)
+		}
+	}
+	for _, object := range manifest.Objects {
+		size, sum, err := crc32cFile(ctx, filepath.Join(dir, filepath.FromSlash(object.Path)))
+		if ctxErr := deadline.Err(ctx, "upload manifest validation"); ctxErr != nil {
+			return ctxErr
+		}
+		switch {
+		case os.IsNotExist(err):
+			report("%s: listed in the upload manifest but missing", object.Path)
+		case err != nil:
+			report("%s: %v", object.Path, err)
+		case size != object.Size || sum != object.CRC32C:
+			report("%s: size %d crc32c %s, upload manifest has size %d crc32c %s",
+				object.Path, size, sum, object.Size, object.CRC32C)
+		}
+	}
+	if problems > maxListedTiles {
+		result.issue("%d more objects differ from the upload manifest", problems-maxListedTiles)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+)
+
+// applyWatermark stamps the configured attribution onto an exported image in place.
+// TIFF outputs are round-tripped through PNG since the stamp is drawn in-process.
+func (s *ImageProcessingService) applyWatermark(ctx context.Context, imagePath string, quality int) error {
+	cfg := s.config.WatermarkConfig
+	if !cfg.Enabled {
+		return nil
+	}
+
+	opts := processors.WatermarkOptions{
+		Text:      cfg.Text,
+		LogoPath:  cfg.LogoPath,
+		Position:  cfg.Position,
+		Opacity:   cfg.Opacity,
+		Color:     cfg.Color,
+		TextScale: cfg.TextScale,
+		Margin:    cfg.Margin,
+	}
+
+	ext := strings.ToLower(filepath.Ext(imagePath))
+	if ext != ".tif" && ext != ".tiff" {
+		return s.watermarkProcessor.Stamp(ctx, imagePath, opts, quality)
+	}
+
+	timeout := s.config.ImageProcessTimeoutMinute.General
+	pngPath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".watermark.png"
+	defer os.Remove(pngPath)
+
+	if _, err := s.vipsProcessor.ConvertImage(ctx, imagePath, pngPath, timeout); err != nil {
+		return err
+	}
+	if err := s.watermarkProcessor.Stamp(ctx, pngPath, opts, quality); err != nil {
+		return err
+	}
+	if _, err := s.vipsProcessor.ConvertImage(ctx, pngPath, imagePath, timeout); err != nil {
+		return err
+	}
+	return nil
+}
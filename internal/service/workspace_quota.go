@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// workspaceQuotaInterval is how often the workspace of a running job is measured
+const workspaceQuotaInterval = 10 * time.Second
+
+// workspaceQuota measures the workspace of a job in the background and cancels the
+// job once it grows past MAX_WORKSPACE_MB of the worker type, so a slide that needs
+// more scratch than the worker has fails with a quota error instead of an opaque
+// ENOSPC from vips, and the other jobs on the disk keep their space
+type workspaceQuota struct {
+	service   *ImageProcessingService
+	fileID    string
+	workspace *model.Workspace
+	limit     int64
+	cancel    context.CancelCauseFunc
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu       sync.Mutex
+	peak     int64
+	exceeded *errors.AppError
+}
+
+// watchWorkspaceQuota starts measuring the workspace. The returned context is
+// cancelled when the quota is exceeded; Stop ends the measuring.
+func (s *ImageProcessingService) watchWorkspaceQuota(ctx context.Context, fileID string, workspace *model.Workspace) (context.Context, *workspaceQuota) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	q := &workspaceQuota{
+		service:   s,
+		fileID:    fileID,
+		workspace: workspace,
+		limit:     s.config.WorkerProfile.MaxWorkspaceMB << 20,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go q.watch(ctx)
+	return ctx, q
+}
+
+func (q *workspaceQuota) watch(ctx context.Context) {
+	defer close(q.done)
+
+	ticker := time.NewTicker(workspaceQuotaInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			q.measure()
+		}
+	}
+}
+
+// measure records the current size of the workspace and cancels the job when it is
+// over the quota
+func (q *workspaceQuota) measure() {
+	usage, err := q.workspace.Usage()
+	if err != nil {
+		q.service.logger.Debug("Failed to measure workspace",
+			"fileID", q.fileID,
+			"error", err)
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.peak = max(q.peak, usage)
+	if q.limit <= 0 || usage <= q.limit || q.exceeded != nil {
+		return
+	}
+
+	q.exceeded = tooLargeError(q.service.config, "workspace quota exceeded").
+		WithContext("fileID", q.fileID).
+		WithContext("workspace_mb", usage>>20).
+		WithContext("max_workspace_mb", q.limit>>20)
+	q.service.logger.Error("Workspace quota exceeded, aborting the job",
+		"fileID", q.fileID,
+		"workspaceMB", usage>>20,
+		"maxWorkspaceMB", q.limit>>20)
+	q.cancel(q.exceeded)
+}
+
+// Peak measures the workspace once more and returns the largest size seen
+func (q *workspaceQuota) Peak() int64 {
+	q.measure()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.peak
+}
+
+// Stop ends the measuring and returns the error the job failed with. When the quota
+// was exceeded, the step error it caused (cancelled, killed, or out of disk space) is
+// replaced with the quota error, which keeps it as its cause.
+func (q *workspaceQuota) Stop(err error) error {
+	close(q.stop)
+	<-q.done
+	defer q.cancel(nil)
+
+	// A step can run out of disk space between two measures
+	if err != nil && errors.HasType(err, errors.ErrorTypeDiskFull) {
+		q.measure()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.service.logger.Info("Workspace usage",
+		"fileID", q.fileID,
+		"peakMB", q.peak>>20,
+		"maxWorkspaceMB", q.limit>>20)
+	if err == nil || q.exceeded == nil {
+		return err
+	}
+	q.exceeded.Err = err
+	return q.exceeded
+}
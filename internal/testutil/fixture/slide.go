@@ -0,0 +1,467 @@
+// Package fixture generates synthetic whole slide images for integration tests of
+// tiling: tiled, pyramidal TIFFs (optionally laid out like Aperio SVS) whose pixels
+// follow a known pattern, so produced tiles can be checked against ColorAt instead of
+// depending on multi-GB proprietary samples.
+package fixture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// Options describes a synthetic slide
+type Options struct {
+	Width    int     `json:"width"`               // Level-0 width in pixels
+	Height   int     `json:"height"`              // Level-0 height in pixels
+	TileSize int     `json:"tile_size,omitempty"` // Tile edge of every level (multiple of 16), default 256
+	CellSize int     `json:"cell_size,omitempty"` // Edge of the pattern cells (power of two), default 512
+	Levels   int     `json:"levels,omitempty"`    // Pyramid levels, 0 adds levels until the slide fits in one tile
+	SVS      bool    `json:"svs"`                 // Aperio ImageDescription and a stripped thumbnail directory after level 0
+	MPP      float64 `json:"mpp,omitempty"`       // Microns per pixel at level 0, default 0.25
+	Compress bool    `json:"compress"`            // Deflate-compress tiles (uniform cells compress to almost nothing)
+}
+
+// Level is the size of one pyramid level of a generated slide
+type Level struct {
+	Width      int `json:"width"`
+	Height     int `json:"height"`
+	Downsample int `json:"downsample"`
+}
+
+// Info describes a generated slide
+type Info struct {
+	Path   string  `json:"path"`
+	Levels []Level `json:"levels"`
+	Size   int64   `json:"size_bytes"`
+}
+
+// maxClassicTIFF is the largest file classic (32-bit offset) TIFF can address
+const maxClassicTIFF = 1<<32 - 1
+
+func (o *Options) applyDefaults() error {
+	if o.TileSize == 0 {
+		o.TileSize = 256
+	}
+	if o.CellSize == 0 {
+		o.CellSize = 512
+	}
+	if o.MPP == 0 {
+		o.MPP = 0.25
+	}
+	switch {
+	case o.Width <= 0 || o.Height <= 0:
+		return fmt.Errorf("slide size must be positive, got %dx%d", o.Width, o.Height)
+	case o.TileSize%16 != 0:
+		return fmt.Errorf("tile size must be a multiple of 16, got %d", o.TileSize)
+	case o.CellSize <= 0 || bits.OnesCount(uint(o.CellSize)) != 1:
+		return fmt.Errorf("cell size must be a power of two, got %d", o.CellSize)
+	case o.Levels < 0 || o.Levels > 16:
+		return fmt.Errorf("levels must be between 0 and 16, got %d", o.Levels)
+	case o.MPP < 0:
+		return fmt.Errorf("mpp must be positive, got %g", o.MPP)
+	}
+	return nil
+}
+
+// levels returns the pyramid: each level halves the previous one
+func (o *Options) levels() []Level {
+	var levels []Level
+	for d := 1; ; d *= 2 {
+		w, h := ceilDiv(o.Width, d), ceilDiv(o.Height, d)
+		levels = append(levels, Level{Width: w, Height: h, Downsample: d})
+		if o.Levels > 0 && len(levels) == o.Levels {
+			break
+		}
+		if o.Levels == 0 && (max(w, h) <= o.TileSize || w == 1 || h == 1) {
+			break
+		}
+	}
+	return levels
+}
+
+// CellColor is the color of the pattern cell at column cx, row cy. Colors are hashed
+// from the cell position, so misplaced or flipped tiles show up as wrong colors.
+func CellColor(cx, cy int) color.RGBA {
+	h := uint32(cx)*0x9e3779b1 ^ uint32(cy)*0x85ebca77
+	h ^= h >> 15
+	h *= 0x2c1b3c6d
+	h ^= h >> 12
+	return color.RGBA{R: uint8(h), G: uint8(h >> 8), B: uint8(h >> 16), A: 0xff}
+}
+
+// ColorAt is the level-0 color of pixel (x, y) of a slide generated with o
+func (o Options) ColorAt(x, y int) color.RGBA {
+	o.applyDefaults()
+	return CellColor(x/o.CellSize, y/o.CellSize)
+}
+
+// LevelColorAt is the color of pixel (x, y) of the pyramid level with the downsample.
+// Up to the cell size a level pixel lies inside one cell and is exact; beyond it the
+// pixel is the mean of the cells it covers.
+func (o Options) LevelColorAt(x, y, downsample int) color.RGBA {
+	o.applyDefaults()
+	return o.levelColor(x, y, downsample)
+}
+
+func (o *Options) levelColor(x, y, downsample int) color.RGBA {
+	if downsample <= o.CellSize {
+		return CellColor(x*downsample/o.CellSize, y*downsample/o.CellSize)
+	}
+	x0, y0 := x*downsample, y*downsample
+	x1, y1 := min(x0+downsample, o.Width), min(y0+downsample, o.Height)
+	var r, g, b, n int
+	for cy := y0 / o.CellSize; cy*o.CellSize < y1; cy++ {
+		for cx := x0 / o.CellSize; cx*o.CellSize < x1; cx++ {
+			c := CellColor(cx, cy)
+			r, g, b, n = r+int(c.R), g+int(c.G), b+int(c.B), n+1
+		}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 0xff}
+}
+
+// Write generates the slide at path
+func Write(path string, opts Options) (*Info, error) {
+	if err := opts.applyDefaults(); err != nil {
+		return nil, err
+	}
+	levels := opts.levels()
+
+	var raw int64
+	for _, level := range levels {
+		raw += int64(ceilDiv(level.Width, opts.TileSize)*ceilDiv(level.Height, opts.TileSize)) * int64(opts.TileSize*opts.TileSize*3)
+	}
+	if !opts.Compress && raw > maxClassicTIFF {
+		return nil, fmt.Errorf("uncompressed slide would be %d MB, more than classic TIFF can hold; enable compression or reduce the size", raw>>20)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := &tiffWriter{w: bufio.NewWriterSize(f, 1<<20)}
+	if err := w.writeSlide(&opts, levels); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := w.w.Flush(); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	// The first IFD offset is only known once everything is laid out
+	if _, err := f.WriteAt(binary.LittleEndian.AppendUint32(nil, w.firstIFD), 4); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	return &Info{Path: path, Levels: levels, Size: w.offset}, nil
+}
+
+// TIFF tag numbers and types used by the writer
+const (
+	tagNewSubfileType   = 254
+	tagImageWidth       = 256
+	tagImageLength      = 257
+	tagBitsPerSample    = 258
+	tagCompression      = 259
+	tagPhotometric      = 262
+	tagImageDescription = 270
+	tagStripOffsets     = 273
+	tagSamplesPerPixel  = 277
+	tagRowsPerStrip     = 278
+	tagStripByteCounts  = 279
+	tagXResolution      = 282
+	tagYResolution      = 283
+	tagPlanarConfig     = 284
+	tagResolutionUnit   = 296
+	tagTileWidth        = 322
+	tagTileLength       = 323
+	tagTileOffsets      = 324
+	tagTileByteCounts   = 325
+
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+// ifdEntry is one tag of an image file directory; values are already encoded
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// directory is a laid-out image whose pixel data was already written
+type directory struct {
+	entries []ifdEntry
+}
+
+type tiffWriter struct {
+	w        *bufio.Writer
+	offset   int64
+	firstIFD uint32
+}
+
+func (t *tiffWriter) write(b []byte) error {
+	n, err := t.w.Write(b)
+	t.offset += int64(n)
+	if err == nil && t.offset > maxClassicTIFF {
+		err = fmt.Errorf("slide exceeds the 4 GB classic TIFF limit, reduce its size")
+	}
+	return err
+}
+
+// align pads the output to an even offset, as TIFF requires for IFDs and values
+func (t *tiffWriter) align() error {
+	if t.offset%2 == 1 {
+		return t.write([]byte{0})
+	}
+	return nil
+}
+
+func (t *tiffWriter) writeSlide(opts *Options, levels []Level) error {
+	// Header; the first IFD offset is patched in by Write
+	if err := t.write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	var dirs []directory
+	for i, level := range levels {
+		offsets, counts, err := t.writeTiles(opts, level)
+		if err != nil {
+			return err
+		}
+		dir := directory{entries: t.baseEntries(opts, level, i > 0)}
+		dir.entries = append(dir.entries,
+			longs(tagTileOffsets, offsets),
+			longs(tagTileByteCounts, counts),
+			long(tagTileWidth, uint32(opts.TileSize)),
+			long(tagTileLength, uint32(opts.TileSize)))
+		if opts.SVS {
+			dir.entries = append(dir.entries, ascii(tagImageDescription, aperioDescription(opts, level)))
+		}
+		dirs = append(dirs, dir)
+
+		// Aperio puts a stripped thumbnail right after the full-resolution level
+		if opts.SVS && i == 0 {
+			thumb, err := t.writeThumbnail(opts)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, thumb)
+		}
+	}
+
+	return t.writeDirectories(dirs)
+}
+
+func (t *tiffWriter) baseEntries(opts *Options, level Level, reduced bool) []ifdEntry {
+	subfileType := uint32(0)
+	if reduced {
+		subfileType = 1
+	}
+	compression := uint16(1)
+	if opts.Compress {
+		compression = 8 // Adobe deflate
+	}
+	// Pixels per centimeter at this level
+	resolution := uint32(10000 / (opts.MPP * float64(level.Downsample)))
+	return []ifdEntry{
+		long(tagNewSubfileType, subfileType),
+		long(tagImageWidth, uint32(level.Width)),
+		long(tagImageLength, uint32(level.Height)),
+		shorts(tagBitsPerSample, 8, 8, 8),
+		shorts(tagCompression, compression),
+		shorts(tagPhotometric, 2), // RGB
+		shorts(tagSamplesPerPixel, 3),
+		shorts(tagPlanarConfig, 1), // Chunky
+		rational(tagXResolution, resolution, 1),
+		rational(tagYResolution, resolution, 1),
+		shorts(tagResolutionUnit, 3), // Centimeter
+	}
+}
+
+// writeTiles writes the tiles of a level row by row; edge tiles are padded with white
+func (t *tiffWriter) writeTiles(opts *Options, level Level) ([]uint32, []uint32, error) {
+	size := opts.TileSize
+	across, down := ceilDiv(level.Width, size), ceilDiv(level.Height, size)
+	offsets := make([]uint32, 0, across*down)
+	counts := make([]uint32, 0, across*down)
+
+	tile := make([]byte, size*size*3)
+	for ty := 0; ty < down; ty++ {
+		for tx := 0; tx < across; tx++ {
+			for y := 0; y < size; y++ {
+				for x := 0; x < size; x++ {
+					px, py := tx*size+x, ty*size+y
+					i := (y*size + x) * 3
+					if px >= level.Width || py >= level.Height {
+						tile[i], tile[i+1], tile[i+2] = 0xff, 0xff, 0xff
+						continue
+					}
+					c := opts.levelColor(px, py, level.Downsample)
+					tile[i], tile[i+1], tile[i+2] = c.R, c.G, c.B
+				}
+			}
+			offset, count, err := t.writeChunk(tile, opts.Compress)
+			if err != nil {
+				return nil, nil, err
+			}
+			offsets = append(offsets, offset)
+			counts = append(counts, count)
+		}
+	}
+	return offsets, counts, nil
+}
+
+// writeThumbnail writes a single-strip image of at most 768 pixels on the longest edge
+func (t *tiffWriter) writeThumbnail(opts *Options) (directory, error) {
+	downsample := 1
+	for max(ceilDiv(opts.Width, downsample), ceilDiv(opts.Height, downsample)) > 768 {
+		downsample *= 2
+	}
+	level := Level{Width: ceilDiv(opts.Width, downsample), Height: ceilDiv(opts.Height, downsample), Downsample: downsample}
+
+	strip := make([]byte, 0, level.Width*level.Height*3)
+	for y := 0; y < level.Height; y++ {
+		for x := 0; x < level.Width; x++ {
+			c := opts.levelColor(x, y, downsample)
+			strip = append(strip, c.R, c.G, c.B)
+		}
+	}
+	offset, count, err := t.writeChunk(strip, opts.Compress)
+	if err != nil {
+		return directory{}, err
+	}
+
+	dir := directory{entries: t.baseEntries(opts, level, true)}
+	dir.entries = append(dir.entries,
+		long(tagStripOffsets, offset),
+		long(tagRowsPerStrip, uint32(level.Height)),
+		long(tagStripByteCounts, count),
+		ascii(tagImageDescription, fmt.Sprintf("Aperio Image Library Fixture\r\n%dx%d -> %dx%d", opts.Width, opts.Height, level.Width, level.Height)))
+	return dir, nil
+}
+
+func (t *tiffWriter) writeChunk(data []byte, compress bool) (uint32, uint32, error) {
+	if err := t.align(); err != nil {
+		return 0, 0, err
+	}
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+	}
+	offset := uint32(t.offset)
+	if err := t.write(data); err != nil {
+		return 0, 0, err
+	}
+	return offset, uint32(len(data)), nil
+}
+
+// writeDirectories writes the IFDs after the pixel data, each followed by its
+// out-of-line values, chained in order
+func (t *tiffWriter) writeDirectories(dirs []directory) error {
+	for i, dir := range dirs {
+		// Readers expect tags in ascending order
+		sort.Slice(dir.entries, func(a, b int) bool { return dir.entries[a].tag < dir.entries[b].tag })
+		if err := t.align(); err != nil {
+			return err
+		}
+		ifdOffset := t.offset
+		if i == 0 {
+			t.firstIFD = uint32(ifdOffset)
+		}
+
+		// Values that do not fit the 4-byte field follow the IFD
+		ifdSize := int64(2 + 12*len(dir.entries) + 4)
+		valueOffset := ifdOffset + ifdSize
+		var ifd, values bytes.Buffer
+		binary.Write(&ifd, binary.LittleEndian, uint16(len(dir.entries)))
+		for _, e := range dir.entries {
+			binary.Write(&ifd, binary.LittleEndian, e.tag)
+			binary.Write(&ifd, binary.LittleEndian, e.typ)
+			binary.Write(&ifd, binary.LittleEndian, e.count)
+			if len(e.data) <= 4 {
+				field := make([]byte, 4)
+				copy(field, e.data)
+				ifd.Write(field)
+				continue
+			}
+			binary.Write(&ifd, binary.LittleEndian, uint32(valueOffset+int64(values.Len())))
+			values.Write(e.data)
+			if values.Len()%2 == 1 {
+				values.WriteByte(0)
+			}
+		}
+
+		next := uint32(0)
+		if i < len(dirs)-1 {
+			next = uint32(valueOffset + int64(values.Len()))
+		}
+		binary.Write(&ifd, binary.LittleEndian, next)
+
+		if err := t.write(ifd.Bytes()); err != nil {
+			return err
+		}
+		if err := t.write(values.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func aperioDescription(opts *Options, level Level) string {
+	return fmt.Sprintf("Aperio Image Library Fixture\r\n%dx%d [0,0 %dx%d] (%dx%d) -> %dx%d|AppMag = %g|MPP = %g|Filename = fixture",
+		opts.Width, opts.Height, opts.Width, opts.Height, opts.TileSize, opts.TileSize,
+		level.Width, level.Height, 10/opts.MPP, opts.MPP)
+}
+
+func long(tag uint16, v uint32) ifdEntry {
+	return ifdEntry{tag: tag, typ: typeLong, count: 1, data: binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func longs(tag uint16, vs []uint32) ifdEntry {
+	data := make([]byte, 0, 4*len(vs))
+	for _, v := range vs {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+	return ifdEntry{tag: tag, typ: typeLong, count: uint32(len(vs)), data: data}
+}
+
+func shorts(tag uint16, vs ...uint16) ifdEntry {
+	data := make([]byte, 0, 2*len(vs))
+	for _, v := range vs {
+		data = binary.LittleEndian.AppendUint16(data, v)
+	}
+	return ifdEntry{tag: tag, typ: typeShort, count: uint32(len(vs)), data: data}
+}
+
+func rational(tag uint16, num, den uint32) ifdEntry {
+	data := binary.LittleEndian.AppendUint32(nil, num)
+	return ifdEntry{tag: tag, typ: typeRational, count: 1, data: binary.LittleEndian.AppendUint32(data, den)}
+}
+
+func ascii(tag uint16, s string) ifdEntry {
+	data := append([]byte(s), 0)
+	return ifdEntry{tag: tag, typ: typeASCII, count: uint32(len(data)), data: data}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
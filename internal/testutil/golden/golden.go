@@ -0,0 +1,260 @@
+// Package golden tiles synthetic fixture slides with vips and compares the produced
+// pyramid against stored manifests: the descriptor, the tile count of every level and
+// perceptual hashes of sampled tiles. Manifests are regenerated on purpose when a
+// change of output is expected, and a mismatch otherwise points at a regression from
+// a vips upgrade or a changed tiling parameter.
+package golden
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/histopathai/image-processing-service/internal/domain/dzi"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/processors"
+	"github.com/histopathai/image-processing-service/internal/testutil/fixture"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/imagehash"
+)
+
+// DefaultMaxDistance is the Hamming distance between tile hashes that is still a match
+const DefaultMaxDistance = imagehash.DefaultMaxDistance
+
+// Case is a fixture slide and the DZI settings it is tiled with
+type Case struct {
+	Name     string          `json:"name"`
+	Fixture  fixture.Options `json:"fixture"`
+	TileSize int             `json:"tile_size"`
+	Overlap  int             `json:"overlap"`
+	Suffix   string          `json:"suffix"`
+	Quality  int             `json:"quality"`
+}
+
+// DefaultCases covers the production defaults, an overlapping PNG pyramid and a plain
+// (non-SVS) TIFF whose size is not a multiple of the tile size
+func DefaultCases() []Case {
+	return []Case{
+		{
+			Name:     "svs-jpg-256",
+			Fixture:  fixture.Options{Width: 3000, Height: 2000, SVS: true, Compress: true},
+			TileSize: 256,
+			Suffix:   "jpg",
+			Quality:  85,
+		},
+		{
+			Name:     "svs-png-510-overlap",
+			Fixture:  fixture.Options{Width: 2048, Height: 2048, CellSize: 256, SVS: true, Compress: true},
+			TileSize: 510,
+			Overlap:  1,
+			Suffix:   "png",
+			Quality:  85,
+		},
+		{
+			Name:     "tiff-jpg-odd-size",
+			Fixture:  fixture.Options{Width: 1999, Height: 1237, TileSize: 128, CellSize: 128, Compress: true},
+			TileSize: 256,
+			Suffix:   "jpg",
+			Quality:  90,
+		},
+	}
+}
+
+// Tile is the perceptual hash of a sampled tile
+type Tile struct {
+	Name   string `json:"name"` // Path relative to the _files directory
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Hash   string `json:"hash"` // 64-bit difference hash, hex
+}
+
+// Manifest is the recorded output of a case
+type Manifest struct {
+	Case       Case             `json:"case"`
+	Vips       string           `json:"vips_version,omitempty"` // Informational, not compared
+	TileSize   int              `json:"tile_size"`
+	Overlap    int              `json:"overlap"`
+	Format     string           `json:"format"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Levels     []dzi.LevelTally `json:"levels"`
+	Unexpected []string         `json:"unexpected,omitempty"`
+	Tiles      []Tile           `json:"tiles"`
+}
+
+// Path is the manifest file of a case within dir
+func Path(dir, caseName string) string {
+	return filepath.Join(dir, caseName+".json")
+}
+
+// Load reads the manifest at path
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid golden manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to path, creating its directory
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create golden directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write golden manifest: %w", err)
+	}
+	return nil
+}
+
+// Generate writes the fixture of c into workDir, tiles it with vips (fs container) and
+// records the resulting pyramid. dziCfg supplies the settings a Case does not set.
+func Generate(ctx context.Context, vips *processors.VipsProcessor, c Case, dziCfg config.DZIConfig, timeoutMinutes int, workDir string) (*Manifest, error) {
+	slidePath := filepath.Join(workDir, c.Name+".tiff")
+	if c.Fixture.SVS {
+		slidePath = filepath.Join(workDir, c.Name+".svs")
+	}
+	if _, err := fixture.Write(slidePath, c.Fixture); err != nil {
+		return nil, fmt.Errorf("failed to write fixture: %w", err)
+	}
+
+	dziCfg.TileSize = c.TileSize
+	dziCfg.Overlap = c.Overlap
+	dziCfg.Suffix = c.Suffix
+	dziCfg.Quality = c.Quality
+	dziCfg.Layout = "dz"
+
+	outputBase := filepath.Join(workDir, c.Name, "image")
+	if _, err := vips.CreateDZI(ctx, slidePath, outputBase, timeoutMinutes, dziCfg, "fs", nil); err != nil {
+		return nil, err
+	}
+
+	descriptor, err := dzi.ParseFile(outputBase + ".dzi")
+	if err != nil {
+		return nil, err
+	}
+
+	filesDir := outputBase + "_files"
+	var names []string
+	err = filepath.WalkDir(filesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(filesDir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tiles: %w", err)
+	}
+	levels, unexpected := descriptor.TallyTiles(names)
+	sort.Strings(unexpected)
+
+	m := &Manifest{
+		Case:       c,
+		Vips:       vips.Version(ctx),
+		TileSize:   descriptor.TileSize,
+		Overlap:    descriptor.Overlap,
+		Format:     descriptor.Format,
+		Width:      descriptor.Width,
+		Height:     descriptor.Height,
+		Levels:     levels,
+		Unexpected: unexpected,
+	}
+	for _, pos := range descriptor.SampleTiles(0) {
+		name := descriptor.TileName(pos.Level, pos.Col, pos.Row)
+		tile, err := hashTile(filepath.Join(filesDir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		tile.Name = name
+		m.Tiles = append(m.Tiles, tile)
+	}
+	return m, nil
+}
+
+// hashTile decodes a tile and computes its difference hash
+func hashTile(path string) (Tile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Tile{}, fmt.Errorf("failed to open sampled tile: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return Tile{}, fmt.Errorf("failed to decode tile %s: %w", path, err)
+	}
+	b := img.Bounds()
+	return Tile{
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Hash:   imagehash.Format(imagehash.DHash(img)),
+	}, nil
+}
+
+// Compare lists the differences between a golden manifest and a fresh one. Tile
+// hashes match within maxDistance bits; everything else must be identical.
+func Compare(want, got *Manifest, maxDistance int) []string {
+	var diffs []string
+	check := func(what string, w, g any) {
+		if w != g {
+			diffs = append(diffs, fmt.Sprintf("%s: want %v, got %v", what, w, g))
+		}
+	}
+	check("tile size", want.TileSize, got.TileSize)
+	check("overlap", want.Overlap, got.Overlap)
+	check("format", want.Format, got.Format)
+	check("width", want.Width, got.Width)
+	check("height", want.Height, got.Height)
+
+	check("level count", len(want.Levels), len(got.Levels))
+	for i := 0; i < min(len(want.Levels), len(got.Levels)); i++ {
+		check(fmt.Sprintf("level %d tiles", i), want.Levels[i].Found, got.Levels[i].Found)
+	}
+	check("unexpected tiles", len(want.Unexpected), len(got.Unexpected))
+
+	gotTiles := make(map[string]Tile, len(got.Tiles))
+	for _, tile := range got.Tiles {
+		gotTiles[tile.Name] = tile
+	}
+	for _, w := range want.Tiles {
+		g, ok := gotTiles[w.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("tile %s: missing", w.Name))
+			continue
+		}
+		if w.Width != g.Width || w.Height != g.Height {
+			diffs = append(diffs, fmt.Sprintf("tile %s: want %dx%d, got %dx%d", w.Name, w.Width, w.Height, g.Width, g.Height))
+			continue
+		}
+		distance, err := imagehash.Distance(w.Hash, g.Hash)
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("tile %s: %v", w.Name, err))
+			continue
+		}
+		if distance > maxDistance {
+			diffs = append(diffs, fmt.Sprintf("tile %s: hash differs in %d bits (max %d)", w.Name, distance, maxDistance))
+		}
+	}
+	return diffs
+}
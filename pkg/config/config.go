@@ -1,11 +1,17 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/histopathai/image-processing-service/pkg/logger"
 )
 
 type Environment string
@@ -24,60 +30,537 @@ const (
 	WorkerTypeLarge  WorkerType = "large"
 )
 
+// Larger returns the next larger worker type, or "" for the largest
+func (t WorkerType) Larger() WorkerType {
+	switch t {
+	case WorkerTypeSmall:
+		return WorkerTypeMedium
+	case WorkerTypeMedium:
+		return WorkerTypeLarge
+	default:
+		return ""
+	}
+}
+
+// WorkerProfile holds the resource-dependent settings of a worker type
+type WorkerProfile struct {
+	Parallelism        int   `env:"PROCESSING_PARALLELISM" doc:"Concurrent generation steps (thumbnail, DZI, ...); defaults to 1/2/4 for small/medium/large"`                   // Independent processing steps (thumbnail, DZI, ...) run at once
+	MaxInputMB         int64 `env:"MAX_INPUT_SIZE_MB" doc:"Largest input file accepted; defaults to 2048/16384/0 for small/medium/large, 0 disables the guard"`                 // Largest input file accepted, 0 accepts any size
+	MaxInputMegapixels int64 `env:"MAX_INPUT_MEGAPIXELS" doc:"Largest input in megapixels; defaults to 4000/40000/0 for small/medium/large, 0 disables the guard"`              // Largest input (width x height) accepted, 0 accepts any size
+	MaxWorkspaceMB     int64 `env:"MAX_WORKSPACE_MB" doc:"Largest scratch use of one job's workspace; defaults to 16384/131072/0 for small/medium/large, 0 disables the quota"` // Largest workspace of one job, 0 for no quota
+}
+
+// Profile returns the default profile of the worker type
+func (t WorkerType) Profile() WorkerProfile {
+	switch t {
+	case WorkerTypeSmall:
+		return WorkerProfile{Parallelism: 1, MaxInputMB: 2048, MaxInputMegapixels: 4000, MaxWorkspaceMB: 16384}
+	case WorkerTypeLarge:
+		return WorkerProfile{Parallelism: 4}
+	default:
+		return WorkerProfile{Parallelism: 2, MaxInputMB: 16384, MaxInputMegapixels: 40000, MaxWorkspaceMB: 131072}
+	}
+}
+
 // GCPConfig holds Google Cloud Platform related configuration.
 type GCPConfig struct {
-	ProjectID          string
-	Region             string
-	InputBucketName    string
-	OutputBucketName   string
+	ProjectID          string `env:"PROJECT_ID" example:"your-gcp-project-id"`
+	Region             string `env:"REGION" example:"us-central1"`
+	InputBucketName    string `env:"ORIGINAL_BUCKET_NAME" example:"histopath-original"`
+	OutputBucketName   string `env:"PROCESSED_BUCKET_NAME" example:"histopath-processed"`
+	KMSKeyName         string `env:"GCS_KMS_KEY_NAME" doc:"Cloud KMS key outputs are encrypted with, the bucket default when unset"`
 	MaxParallelUploads int
 	UploadChunkSizeMB  int
 }
 
+// PubSubConfig holds the batching and retry settings of the Pub/Sub publisher
+type PubSubConfig struct {
+	BatchDelay     time.Duration `env:"PUBSUB_BATCH_DELAY_MS" default:"10"`          // Wait this long for more messages before sending a batch
+	BatchCount     int           `env:"PUBSUB_BATCH_COUNT" default:"100"`            // Send a batch once it holds this many messages
+	BatchBytes     int           `env:"PUBSUB_BATCH_BYTES" default:"1000000"`        // Send a batch once it holds this many bytes
+	PublishTimeout time.Duration `env:"PUBSUB_PUBLISH_TIMEOUT_SECONDS" default:"60"` // Transient failures are retried until this deadline
+
+	EventLogPath string `env:"EVENT_LOG_PATH" doc:"Without Pub/Sub (LOCAL), also append every event as a Pub/Sub message to this JSONL file"`
+
+	DeploymentAttributes bool   `env:"EVENT_DEPLOYMENT_ATTRIBUTES" default:"true" doc:"Add region, worker_type, pipeline_version and git_sha attributes to every published message"`
+	GitSHA               string `env:"GIT_SHA" doc:"Commit of the deployment, defaults to the VCS revision stamped into the binary"`
+}
+
+// RetryConfig is the retry policy of storage writes, event publishes and external
+// commands (see pkg/retry)
+type RetryConfig struct {
+	MaxAttempts        int            `env:"RETRY_MAX_ATTEMPTS" default:"3" doc:"Attempts including the first, 1 disables retries"`
+	BaseDelay          time.Duration  `env:"RETRY_BASE_DELAY_MS" default:"500"`                                                                                    // Delay before the second attempt, doubled per attempt
+	MaxDelay           time.Duration  `env:"RETRY_MAX_DELAY_MS" default:"10000"`                                                                                   // Upper bound of a single delay
+	Jitter             float64        `env:"RETRY_JITTER" default:"0.2"`                                                                                           // Delays vary by up to this fraction either way
+	AttemptsByType     map[string]int `env:"RETRY_ATTEMPTS_BY_TYPE" default:"timeout_error=2" doc:"Attempts per error type, e.g. storage_error=5,timeout_error=1"` // Overrides MaxAttempts for single error types
+	CommandMaxAttempts int            `env:"RETRY_COMMAND_MAX_ATTEMPTS" default:"1" doc:"Attempts of external commands killed by a signal (exit 137/143), 1 disables"`
+	ResourceDelay      time.Duration  `env:"RETRY_RESOURCE_DELAY_MS" default:"5000" doc:"Delay before retrying disk-full and quota (429/503) errors, doubled per attempt"`
+	JobMaxRetries      int            `env:"RETRY_JOB_MAX_RETRIES" default:"25" doc:"Retries one job may make across all phases (copies, commands, uploads), 0 for no limit"`
+	JobMaxTime         time.Duration  `env:"RETRY_JOB_MAX_SECONDS" default:"900" doc:"Time one job may spend waiting for and running retries, 0 for no limit"`
+}
+
+// RateLimitConfig paces object writes to the output bucket (see pkg/ratelimit), so the
+// parallel uploads of many workers stay under the per-bucket write quota
+type RateLimitConfig struct {
+	WriteOpsPerSecond    float64 `env:"GCS_WRITE_OPS_PER_SECOND" default:"200" local:"0" doc:"Object writes per second of one worker, 0 disables pacing"`
+	WriteBurst           int     `env:"GCS_WRITE_BURST" default:"20"`                                                                    // Writes allowed at once after an idle period
+	MinWriteOpsPerSecond float64 `env:"GCS_WRITE_MIN_OPS_PER_SECOND" default:"5" doc:"Floor the rate is lowered to on repeated 429/503"` // The rate is halved per quota error down to this
+}
+
+// DeadlineConfig is the time budget of a job (see pkg/deadline)
+type DeadlineConfig struct {
+	JobTimeout     time.Duration `env:"JOB_TIMEOUT_SECONDS" default:"0" doc:"Cloud Run task timeout, 0 when the job has no deadline"` // Counted from process start
+	CleanupReserve time.Duration `env:"JOB_CLEANUP_RESERVE_SECONDS" default:"60"`                                                     // Kept back from the work for cleanup and failure events
+}
+
+// HeartbeatConfig makes every job write a heartbeat (worker, image, phase) while it
+// runs, so a supervisor can re-dispatch the jobs of crashed or wedged workers
+type HeartbeatConfig struct {
+	Dir      string        `env:"HEARTBEAT_DIR" doc:"Directory heartbeats are written to as <worker-id>.json (e.g. under the output mount), unset disables them"`
+	Interval time.Duration `env:"HEARTBEAT_INTERVAL_SECONDS" default:"30"`                                                                             // Time between two beats of a running job
+	WorkerID string        `env:"WORKER_ID" doc:"ID of this worker in heartbeats, defaults to the Cloud Run execution and task index or the hostname"` // Set by LoadHeartbeatConfig when unset
+}
+
+// FirestoreConfig is the Firestore collection image records (statuses, results and
+// checksums) are kept in, needed by checksum deduplication and content-addressed outputs
+type FirestoreConfig struct {
+	ImageCollection string `env:"FIRESTORE_IMAGE_COLLECTION" doc:"Collection image records are kept in, unset keeps no records"`
+	DatabaseID      string `env:"FIRESTORE_DATABASE" default:"(default)"` // Database of the collection, in PROJECT_ID
+}
+
+// Enabled reports whether image records are kept
+func (c FirestoreConfig) Enabled() bool {
+	return c.ImageCollection != ""
+}
+
+// DeadLetterConfig fails images permanently once they have failed on enough Cloud Run
+// task attempts, so a slide that crashes the job every time is not run over and over
+type DeadLetterConfig struct {
+	MaxAttempts int    `env:"POISON_MAX_ATTEMPTS" default:"0" doc:"Task attempts after which a failing image is failed permanently, 0 disables"` // Compared with CLOUD_RUN_TASK_ATTEMPT + 1
+	TopicID     string `env:"IMAGE_PROCESS_DLQ_TOPIC_ID" default:"image-processing-dlq"`                                                         // Topic the requests of permanently failed images are published to
+}
+
+// RequestExpiryConfig skips requests delivered too late, e.g. re-delivered days later
+// after an outage, with an expired result instead of processing them
+type RequestExpiryConfig struct {
+	MaxAge time.Duration `env:"REQUEST_MAX_AGE_HOURS" default:"0" doc:"Requests older than this (INPUT_REQUESTED_AT) expire, 0 only honors INPUT_EXPIRES_AT"`
+}
+
+// QuarantineConfig collects permanently failed inputs under one prefix of the output
+// storage, each with a failure.json, so bad scanner exports can be investigated in one
+// place
+type QuarantineConfig struct {
+	Enabled      bool   `env:"QUARANTINE_ENABLED" default:"false"`
+	Prefix       string `env:"QUARANTINE_PREFIX" default:"quarantine" doc:"Output bucket prefix (local runs: directory) of <prefix>/<image-id>/failure.json"`
+	CopyOriginal bool   `env:"QUARANTINE_COPY_ORIGINAL" default:"false"` // Copy the original next to failure.json instead of only referencing it
+}
+
+// ContentAddressConfig stores the outputs of an image under the SHA-256 of its original,
+// so re-uploads of the same slide under new image IDs reuse the tiles instead of
+// duplicating them
+type ContentAddressConfig struct {
+	Enabled       bool   `env:"CONTENT_ADDRESSED_OUTPUTS" default:"false" doc:"Store outputs under <prefix>/<sha256 of the original> and reuse them for identical originals; needs FIRESTORE_IMAGE_COLLECTION, startup fails without it"`
+	Prefix        string `env:"CONTENT_ADDRESS_PREFIX" default:"content"`       // Output bucket prefix (local runs: directory) of the content-addressed outputs
+	StoreOriginal bool   `env:"CONTENT_ADDRESS_STORE_ORIGINAL" default:"false"` // Also copy the original to <prefix>/<sha256>/original/
+}
+
+// DedupConfig skips originals already processed under another image ID, found by the
+// SHA-256 of their content rather than their dataset and file name, so renamed copies
+// are caught too
+type DedupConfig struct {
+	Enabled bool `env:"CHECKSUM_DEDUP" default:"false" doc:"Skip processing of originals whose SHA-256 matches a processed image and publish a duplicate result; needs FIRESTORE_IMAGE_COLLECTION, startup fails without it"`
+}
+
+// ReplicaConfig mirrors the outputs of every image to a secondary destination once
+// the primary upload succeeded, for disaster recovery and reads close to another
+// region. The mirror runs in the background; the result event does not wait for it.
+type ReplicaConfig struct {
+	Bucket     string        `env:"REPLICA_OUTPUT_BUCKET" doc:"GCS bucket outputs are mirrored to after the primary upload"`
+	MountPath  string        `env:"REPLICA_OUTPUT_MOUNT_PATH" doc:"Mounted destination (another provider through FUSE or NFS) outputs are mirrored to instead of a bucket"`
+	KMSKeyName string        `env:"REPLICA_KMS_KEY_NAME" doc:"Cloud KMS key of the replica bucket objects, when the replica is in another region"`
+	Timeout    time.Duration `env:"REPLICA_TIMEOUT_MINUTE" default:"30"` // Bound of one mirror, also past the job deadline
+}
+
+// Enabled reports whether outputs are mirrored
+func (c ReplicaConfig) Enabled() bool {
+	return c.Bucket != "" || c.MountPath != ""
+}
+
+// DeletionConfig is the soft-delete window of image deletion jobs
+type DeletionConfig struct {
+	Retention time.Duration `env:"DELETE_RETENTION_HOURS" default:"0" doc:"A deletion marks the outputs; a deletion request or himgproc purge-deleted after this long removes them, 0 removes them at once"`
+}
+
+// TranscodeConfig tunes tile transcoding jobs
+type TranscodeConfig struct {
+	Parallelism int `env:"TRANSCODE_PARALLELISM" default:"8" doc:"Tiles re-encoded at once, one vips command each"`
+}
+
 type LoggingConfig struct {
-	Level  string
-	Format string
+	Level  string `env:"LOG_LEVEL" default:"INFO" local:"DEBUG" doc:"DEBUG, INFO, WARN or ERROR"`
+	Format string `env:"LOG_FORMAT" default:"json" local:"text" doc:"text or json"`
+
+	RedactKeys []string `env:"LOG_REDACT_KEYS" doc:"Attribute keys redacted in addition to credentials and patient identifiers (pkg/logger), comma separated"`
+
+	SlowCommandThreshold time.Duration `env:"SLOW_COMMAND_THRESHOLD_SECONDS" default:"300" doc:"External commands running longer get a slow_command log entry, 0 disables"`
 }
 
 type DZIConfig struct {
-	TileSize    int
-	Overlap     int
-	Quality     int
-	Layout      string
-	Suffix      string
-	Container   string
-	Compression int
+	TileSize    int    `env:"TILE_SIZE" default:"256"`
+	Overlap     int    `env:"OVERLAP" default:"0"`
+	Quality     int    `env:"QUALITY" default:"85"`
+	Layout      string `env:"DZI_LAYOUT" default:"dz"`
+	Suffix      string `env:"DZI_SUFFIX" default:"jpg"`
+	Container   string `env:"DZI_CONTAINER" default:"fs" doc:"zip or fs"`
+	Compression int    `env:"DZI_COMPRESSION" default:"0" doc:"Zip container compression level, 0-9"`
+
+	LevelUpload      bool `env:"DZI_LEVEL_UPLOAD" default:"true" doc:"fs container: upload each pyramid level as soon as it is complete (not with CONTENT_ADDRESSED_OUTPUTS)"`
+	LevelUploadQueue int  `env:"DZI_LEVEL_UPLOAD_QUEUE" default:"2"`
+	Dedup            bool `env:"DZI_DEDUP" default:"false" doc:"fs container: store identical tiles once, duplicates are listed under \"references\" in IndexMap.json"`
 }
 
 type ImageProcessTimeoutMinute struct {
-	FormatConversion int
-	DZIConversion    int
-	Thumbnail        int
-	General          int
+	FormatConversion int `env:"FORMAT_CONVERSION_TIMEOUT_MINUTE" default:"20"`
+	DZIConversion    int `env:"DZI_CONVERSION_TIMEOUT_MINUTE" default:"120"`
+	Thumbnail        int `env:"THUMBNAIL_TIMEOUT_MINUTE" default:"10"`
+	General          int `env:"GENERAL_IMAGE_PROCESS_TIMEOUT_MINUTE" default:"10"`
 }
 
+// Thumbnail modes decide how a slide that is not square fits the thumbnail box
+const (
+	ThumbnailModeFit       = "fit"       // Keep the aspect ratio within the box, the thumbnail may be smaller on one side
+	ThumbnailModeCrop      = "crop"      // Fill the box, cropping the centre
+	ThumbnailModeAttention = "attention" // Fill the box, cropping around the most salient region (tissue rather than glass)
+	ThumbnailModePad       = "pad"       // Fit, then pad to the box with Background
+)
+
 type ThumbnailConfig struct {
-	Width   int
-	Height  int
-	Quality int
+	Width         int               `env:"THUMBNAIL_WIDTH" default:"256" doc:"Defaults to THUMBNAIL_SIZE"`
+	Height        int               `env:"THUMBNAIL_HEIGHT" default:"256" doc:"Defaults to THUMBNAIL_SIZE"`
+	Quality       int               `env:"THUMBNAIL_QUALITY" default:"90"`
+	Mode          string            `env:"THUMBNAIL_MODE" default:"fit" doc:"fit, crop, attention or pad"`
+	ModeByDataset map[string]string `env:"THUMBNAIL_MODE_BY_DATASET" doc:"dataset=mode pairs, comma separated, matched against the dataset metadata of a request"`
+	Background    string            `env:"THUMBNAIL_BACKGROUND" default:"255 255 255" doc:"Pad colour, space separated band values"`
+	FromPyramid   bool              `env:"THUMBNAIL_FROM_PYRAMID" default:"true" doc:"Derive the thumbnail from a low level of the generated pyramid instead of decoding the original again"`
+}
+
+// ModeFor returns the thumbnail mode of dataset
+func (c ThumbnailConfig) ModeFor(dataset string) string {
+	if mode, ok := c.ModeByDataset[dataset]; ok && dataset != "" {
+		return mode
+	}
+	return c.Mode
+}
+
+// Pyramids OUTPUT_FORMATS can list
+const (
+	OutputFormatDZI     = "dzi"
+	OutputFormatOMETIFF = "ome-tiff"
+)
+
+// OutputConfig selects the pyramids written for every image. The DZI pyramid is what
+// the viewers read and is always written; an OME-TIFF (image.ome.tif) is a single
+// tiled pyramid file for analysis tools that do not read DZI.
+type OutputConfig struct {
+	Formats            []string `env:"OUTPUT_FORMATS" default:"dzi" doc:"Pyramids to write, comma separated: dzi, ome-tiff; dzi cannot be left out"`
+	OMETIFFTileSize    int      `env:"OME_TIFF_TILE_SIZE" default:"512"`
+	OMETIFFCompression string   `env:"OME_TIFF_COMPRESSION" default:"jpeg" doc:"jpeg, lzw, deflate, zstd or none"`
+	OMETIFFQuality     int      `env:"OME_TIFF_QUALITY" default:"90"` // JPEG quality of the OME-TIFF tiles
+}
+
+// Has reports whether format is one of the pyramids to write
+func (c OutputConfig) Has(format string) bool {
+	for _, f := range c.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func validThumbnailMode(mode string) bool {
+	switch mode {
+	case ThumbnailModeFit, ThumbnailModeCrop, ThumbnailModeAttention, ThumbnailModePad:
+		return true
+	}
+	return false
+}
+
+// DNG white balance modes
+const (
+	DNGWhiteBalanceCamera = "camera" // As shot, from the camera metadata
+	DNGWhiteBalanceAuto   = "auto"   // Averaged over the whole image
+	DNGWhiteBalanceNone   = "none"   // dcraw's daylight multipliers
+)
+
+// dngColorSpaces maps the output color space names to the dcraw -o values
+var dngColorSpaces = map[string]int{
+	"raw":      0,
+	"srgb":     1,
+	"adobe":    2,
+	"wide":     3,
+	"prophoto": 4,
+	"xyz":      5,
+	"aces":     6,
+}
+
+// DNGConfig controls how DNG photos (gross specimens) are developed by dcraw before
+// tiling. The defaults are the camera white balance, clipped highlights and sRGB.
+type DNGConfig struct {
+	WhiteBalance string `env:"DNG_WHITE_BALANCE" default:"camera" doc:"camera, auto, none, or four space separated multipliers (r g b g)"`
+	Gamma        string `env:"DNG_GAMMA" doc:"Power and toe slope, e.g. \"2.4 12.92\" for sRGB; empty keeps dcraw's BT.709 curve"`
+	Highlight    int    `env:"DNG_HIGHLIGHT" default:"0" doc:"0 clip, 1 unclip, 2 blend, 3-9 rebuild"`
+	ColorSpace   string `env:"DNG_COLOR_SPACE" default:"srgb" doc:"raw, srgb, adobe, wide, prophoto, xyz or aces; tiles are not color managed, keep srgb for viewers"`
+}
+
+// ColorSpaceCode returns the dcraw -o value of ColorSpace
+func (c DNGConfig) ColorSpaceCode() int {
+	return dngColorSpaces[c.ColorSpace]
+}
+
+// parseNumbers parses count space separated non-negative numbers
+func parseNumbers(value string, count int) ([]float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) != count {
+		return nil, false
+	}
+	numbers := make([]float64, count)
+	for i, field := range fields {
+		n, err := strconv.ParseFloat(field, 64)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// IntermediateConfig is the format of the intermediate DNG photos are developed into.
+// Thumbnail, stats and tiles are all read from this one intermediate. dcraw writes an
+// uncompressed TIFF; any other format is a vips copy of it.
+type IntermediateConfig struct {
+	Format      string `env:"INTERMEDIATE_FORMAT" default:"tiff" doc:"tiff, or v (vips native, uncompressed, fastest to read)"`
+	Compression string `env:"INTERMEDIATE_COMPRESSION" default:"none" doc:"TIFF compression: none, lzw, deflate or zstd"`
+	BitDepth    int    `env:"INTERMEDIATE_BIT_DEPTH" default:"16" doc:"8 or 16 bits per sample"`
+}
+
+// Filename is the intermediate file name of an input with base name base
+func (c IntermediateConfig) Filename(base string) string {
+	if c.Format == "v" {
+		return base + ".v"
+	}
+	return base + ".tiff"
+}
+
+// Direct reports whether the TIFF written by dcraw is the intermediate as is
+func (c IntermediateConfig) Direct() bool {
+	return c.Format == "tiff" && c.Compression == "none"
+}
+
+// StatsConfig controls the pixel statistics artifact (stats.json) used for scanner QC.
+type StatsConfig struct {
+	Enabled       bool `env:"STATS_ENABLED" default:"true"`
+	OverviewSize  int  `env:"STATS_OVERVIEW_SIZE" default:"1024"` // Longest edge of the downsampled overview the stats are computed on
+	HistogramBins int  `env:"STATS_HISTOGRAM_BINS" default:"256"`
+}
+
+// OverviewConfig controls the optional standalone downsampled JPEG exports
+// (overviews/overview_<n>x.jpg) used for report embedding without a tile viewer.
+type OverviewConfig struct {
+	Enabled     bool  `env:"OVERVIEW_ENABLED" default:"false"`
+	Downsamples []int `env:"OVERVIEW_DOWNSAMPLES" default:"1,4,16"` // Downsample factors relative to full resolution, e.g. 1, 4, 16
+	Quality     int   `env:"OVERVIEW_QUALITY" default:"85"`
+	MaxSize     int   `env:"OVERVIEW_MAX_SIZE" default:"16384"` // Overviews whose longest edge would exceed this are skipped
+}
+
+// AssociatedImagesConfig selects the associated images (label, macro, thumbnail) of
+// whole-slide images exported next to the pyramid. The label is left out by default as
+// it often shows the patient name or a barcode.
+type AssociatedImagesConfig struct {
+	Names []string `env:"ASSOCIATED_IMAGES" default:"macro,thumbnail" doc:"Associated images to export, comma separated; empty disables"`
+}
+
+// OpenSlideTilerConfig controls the tiler used for whole-slide images vips cannot open
+// but OpenSlide can: the pyramid is read region by region through OpenSlide and the
+// tiles are written directly, without converting the slide to a TIFF first.
+type OpenSlideTilerConfig struct {
+	Enabled     bool `env:"OPENSLIDE_TILER" default:"true" doc:"Tile whole-slide images vips cannot open through OpenSlide (fs container, dz layout)"`
+	ChunkTiles  int  `env:"OPENSLIDE_TILER_CHUNK_TILES" default:"8"`     // Tiles per side read from OpenSlide in one region
+	PreviewSize int  `env:"OPENSLIDE_TILER_PREVIEW_SIZE" default:"4096"` // Longest edge of the slide level thumbnails, stats and overviews are made from
+	// The preview level is read in regions and scaled down on the fly, so a slide
+	// without a small level does not render a whole multi-GB level at once
+	PreviewChunkSize     int   `env:"OPENSLIDE_TILER_PREVIEW_CHUNK_SIZE" default:"2048"`     // Edge of the regions the preview level is read in
+	PreviewMaxMegapixels int64 `env:"OPENSLIDE_TILER_PREVIEW_MAX_MEGAPIXELS" default:"1024"` // Largest slide level read for the preview, 0 disables the cap
+}
+
+// WatermarkConfig controls the attribution stamp applied to thumbnails and exported
+// region/annotation images for datasets shared externally.
+type WatermarkConfig struct {
+	Enabled   bool    `env:"WATERMARK_ENABLED" default:"false"`
+	Text      string  `env:"WATERMARK_TEXT"`
+	LogoPath  string  `env:"WATERMARK_LOGO_PATH" doc:"Optional PNG logo, drawn before the text"`                                       // Optional PNG logo, drawn before the text
+	Position  string  `env:"WATERMARK_POSITION" default:"bottom-right" doc:"top-left, top-right, bottom-left, bottom-right or center"` // top-left, top-right, bottom-left, bottom-right or center
+	Opacity   float64 `env:"WATERMARK_OPACITY" default:"0.5"`
+	Color     string  `env:"WATERMARK_COLOR" default:"#ffffff"` // Text color as #rrggbb
+	TextScale int     `env:"WATERMARK_TEXT_SCALE" default:"1"`  // Integer upscale of the built-in 7x13 bitmap font
+	Margin    int     `env:"WATERMARK_MARGIN" default:"8"`      // Distance from the image edge in pixels
+}
+
+// ChannelConfig controls how single-channel and fluorescence inputs are mapped to
+// 8-bit RGB before thumbnails and tiles are generated.
+type ChannelConfig struct {
+	Enabled bool     `env:"CHANNEL_MAPPING_ENABLED" default:"true"`
+	LUT     string   `env:"CHANNEL_LUT" default:"gray"`                                  // Single-channel lookup: gray or a color name/#rrggbb to pseudo-color with
+	Colors  []string `env:"CHANNEL_COLORS" default:"blue,green,red,magenta,cyan,yellow"` // Pseudo-colors for multi-channel (fluorescence) inputs, in band order
+	Rescale bool     `env:"CHANNEL_RESCALE" default:"true"`                              // Stretch each channel to the full 0-255 range
+}
+
+// InputCheckConfig controls the check that opens the input and reads a region of its
+// bottom-right corner before tiling, so truncated or corrupt uploads fail in seconds
+// instead of part way through dzsave.
+type InputCheckConfig struct {
+	Enabled       bool `env:"INPUT_CHECK_ENABLED" default:"true"`
+	RegionSize    int  `env:"INPUT_CHECK_REGION_SIZE" default:"256"`  // Edge of the corner region read at full resolution
+	TimeoutMinute int  `env:"INPUT_CHECK_TIMEOUT_MINUTE" default:"5"` // Full decodes (JPEG, PNG) read the whole file to reach the corner
+}
+
+// ScratchConfig describes the local disk used for workspaces and how much of it the
+// slides of a process-dir batch may claim at once.
+type ScratchConfig struct {
+	Dir        string        `env:"SCRATCH_DIR" default:"/tmp"`
+	BudgetMB   int           `env:"SCRATCH_BUDGET_MB" default:"0" doc:"0 derives the budget from the free space of SCRATCH_DIR"`                                           // 0 derives the budget from the free space of Dir at startup
+	Multiplier float64       `env:"SCRATCH_MULTIPLIER" default:"3"`                                                                                                        // Estimated scratch usage as a multiple of the input size
+	GCMaxAge   time.Duration `env:"SCRATCH_GC_MAX_AGE_MINUTES" default:"360" doc:"Workspaces of crashed jobs untouched for this long are removed at startup (0 disables)"` // Workspaces untouched for this long are removed at startup (0 disables)
+}
+
+// SchedulerConfig is the cost model the slides of a process-dir batch are admitted
+// with: a slide starts once its estimated memory and scratch fit next to the slides
+// already running.
+type SchedulerConfig struct {
+	MemoryMB      int                `env:"SCHEDULER_MEMORY_MB" default:"0" doc:"Memory concurrent jobs may claim, 0 uses 80% of the memory limit (no memory gate without one)"` // 0 derives the capacity from Memory.LimitBytes
+	JobBaseMB     int                `env:"SCHEDULER_JOB_BASE_MB" default:"512"`                                                                                                 // Memory of a job regardless of its input: vips cache, tile buffers, the process itself
+	FormatFactors map[string]float64 `env:"SCHEDULER_FORMAT_FACTORS" default:"dng=8,jpg=12,jpeg=12,png=4,bmp=1" doc:"Decoded memory as a multiple of the input size, per extension; unlisted formats are streamed"`
+	MaxJobs       int                `env:"SCHEDULER_MAX_JOBS" default:"0" doc:"Upper bound of concurrent jobs, 0 for the number of CPUs"`
+}
+
+// EmulatorConfig points the GCS, Pub/Sub and Firestore clients at local emulators
+// (fake-gcs-server, the gcloud Pub/Sub and Firestore emulators) so a LOCAL run can go end to end without Google Cloud.
+type EmulatorConfig struct {
+	StorageHost   string `env:"STORAGE_EMULATOR_HOST" doc:"host:port of a GCS emulator, outputs are uploaded to PROCESSED_BUCKET_NAME on it"`
+	PubSubHost    string `env:"PUBSUB_EMULATOR_HOST" doc:"host:port of a Pub/Sub emulator, events are published to it instead of stdout"`
+	FirestoreHost string `env:"FIRESTORE_EMULATOR_HOST" doc:"host:port of a Firestore emulator, image records are kept on it"`
+}
+
+// Enabled reports whether any emulator is configured
+func (c EmulatorConfig) Enabled() bool {
+	return c.StorageHost != "" || c.PubSubHost != "" || c.FirestoreHost != ""
 }
 
 type StorageConfig struct {
-	InputMountPath  string // Mount path for input files (e.g., /input, /gcs/bucket-original, ./test-data/input)
-	OutputMountPath string // Mount path for output files (e.g., /output, /gcs/bucket-processed, ./test-data/output)
+	InputMountPath    string `env:"INPUT_MOUNT_PATH" default:"/input" local:"./test-data/input"`                                                                                            // Mount path for input files (e.g., /input, /gcs/bucket-original, ./test-data/input)
+	OutputMountPath   string `env:"OUTPUT_MOUNT_PATH" default:"/output" local:"./test-data/output"`                                                                                         // Mount path for output files (e.g., /output, /gcs/bucket-processed, ./test-data/output)
+	StageInput        bool   `env:"INPUT_STAGING" default:"false" doc:"Copy the input into the workspace before processing (local disk instead of FUSE reads)"`                             // Copy the input into the workspace before processing instead of reading it from the mount
+	Checksums         bool   `env:"STORAGE_CHECKSUMS" default:"false" doc:"SHA-256 of staged inputs and copied outputs, computed during the copy"`                                          // Compute SHA-256 of copied files during the copy (input staging, outputs)
+	UploadManifest    bool   `env:"UPLOAD_MANIFEST" default:"true" doc:"Write upload-manifest.json with the size and CRC32C of every uploaded object"`                                      // List every uploaded object with its size and CRC32C in upload-manifest.json
+	InputReader       string `env:"INPUT_READER" default:"mount" doc:"mount, gcs or sftp: read input headers and staged copies through the GCS API or from SFTP_HOST instead of the mount"` // How inputs are read outside of the processing commands
+	UploadParallelism int    `env:"MOUNT_UPLOAD_PARALLELISM" default:"16" local:"4" doc:"Files copied at once when a directory is copied to a mount, 1 copies sequentially"`
+}
+
+// Input readers of StorageConfig.InputReader
+const (
+	InputReaderMount = "mount" // Read through INPUT_MOUNT_PATH
+	InputReaderGCS   = "gcs"   // Read ORIGINAL_BUCKET_NAME with the GCS API, header reads are range requests
+	InputReaderSFTP  = "sftp"  // Read SFTP_ROOT on SFTP_HOST, inputs are always staged
+)
+
+// SFTPConfig is the SFTP server inputs are read from with INPUT_READER=sftp, such as
+// the share scanner workstations drop slides on. The password and private key are
+// Secret Manager secret versions (projects/<p>/secrets/<s>[/versions/<v>]), read at
+// startup; the host key must be pinned with a known_hosts file or secret.
+type SFTPConfig struct {
+	Host             string `env:"SFTP_HOST" doc:"Host (and optional :port) of the SFTP server"`
+	Port             int    `env:"SFTP_PORT" default:"22" doc:"Port when SFTP_HOST has none"`
+	User             string `env:"SFTP_USER" doc:"Login on the server"`
+	Root             string `env:"SFTP_ROOT" default:"." doc:"Directory on the server input paths are relative to"`
+	PasswordSecret   string `env:"SFTP_PASSWORD_SECRET" doc:"Secret Manager secret with the password"`
+	PrivateKeySecret string `env:"SFTP_PRIVATE_KEY_SECRET" doc:"Secret Manager secret with the private key (OpenSSH or PEM, unencrypted)"`
+	KnownHostsSecret string `env:"SFTP_KNOWN_HOSTS_SECRET" doc:"Secret Manager secret with the known_hosts lines of the server"`
+	KnownHostsFile   string `env:"SFTP_KNOWN_HOSTS_FILE" doc:"known_hosts file of the server, instead of SFTP_KNOWN_HOSTS_SECRET"`
+}
+
+// Addr is the host:port to dial
+func (c SFTPConfig) Addr() string {
+	if _, _, err := net.SplitHostPort(c.Host); err == nil {
+		return c.Host
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
 }
 
+// Config is the service configuration. The env tags name the environment variable of
+// each setting and default (or local/dev/prod for a single environment) the value the
+// loader falls back to; WriteTemplate generates the .env template from them. example
+// is the value the template suggests for a setting without a default.
 type Config struct {
-	Env                       Environment
-	WorkerType                WorkerType
-	GCP                       GCPConfig
-	Storage                   StorageConfig
-	OutputRootPath            string // Deprecated: use Storage.OutputMountPath
-	Logging                   LoggingConfig
-	DZIConfig                 DZIConfig
-	ThumbnailConfig           ThumbnailConfig
-	ImageProcessTimeoutMinute ImageProcessTimeoutMinute
-	ImageProcessingTopicID    string
+	Env                       Environment               `env:"APP_ENV" local:"LOCAL" dev:"DEV" prod:"PROD" doc:"Environment"`
+	WorkerType                WorkerType                `env:"WORKER_TYPE" default:"medium" doc:"small, medium or large"`
+	WorkerProfile             WorkerProfile             `doc:"Worker profile"`
+	GCP                       GCPConfig                 `doc:"GCP Configuration" profile:"cloud"`
+	PubSub                    PubSubConfig              `doc:"Pub/Sub publisher batching; transient publish failures are retried until the timeout" profile:"cloud"`
+	Retry                     RetryConfig               `doc:"Retries of storage writes, event publishes and external commands"`
+	RateLimit                 RateLimitConfig           `doc:"Pacing of object writes"`
+	RequestExpiry             RequestExpiryConfig       `doc:"Expiry of late requests: skipped with an expired result the dispatcher may re-enqueue"`
+	DeadLetter                DeadLetterConfig          `doc:"Poison images: failed permanently and dead-lettered after repeated task attempts"`
+	Quarantine                QuarantineConfig          `doc:"Quarantine of permanently failed inputs"`
+	ContentAddress            ContentAddressConfig      `doc:"Content-addressed outputs"`
+	Dedup                     DedupConfig               `doc:"Checksum deduplication of originals"`
+	Replica                   ReplicaConfig             `doc:"Replica of the outputs (disaster recovery, cross-region reads)"`
+	Deletion                  DeletionConfig            `doc:"Image deletion jobs (INPUT_JOB_TYPE=delete)"`
+	Transcode                 TranscodeConfig           `doc:"Tile transcoding jobs (INPUT_JOB_TYPE=transcode_tiles)"`
+	Deadline                  DeadlineConfig            `doc:"Job deadline: processing stops early enough to clean up and publish the result"`
+	Heartbeat                 HeartbeatConfig           `doc:"Worker heartbeats for a supervisor re-dispatching jobs of crashed or wedged workers"`
+	Firestore                 FirestoreConfig           `doc:"Image records (Firestore)"`
+	Storage                   StorageConfig             `doc:"Mount Paths"`
+	SFTP                      SFTPConfig                `doc:"SFTP input server (INPUT_READER=sftp)"`
+	Scratch                   ScratchConfig             `doc:"Scratch disk (workspaces) and concurrent job budget"`
+	Scheduler                 SchedulerConfig           `doc:"Admission of concurrent jobs by estimated memory and scratch"`
+	Memory                    MemoryConfig              `doc:"Memory budget, derived from the cgroup memory limit when unset"`
+	Tenants                   TenantConfig              `doc:"Multi-tenant routing by the tenant of the request" profile:"cloud"`
+	Tenant                    string                    // Tenant of the job (INPUT_TENANT), set by ApplyTenant
+	Emulator                  EmulatorConfig            `doc:"Emulators for end-to-end local runs (GCP settings are read when one is set)"`
+	OutputRootPath            string                    // Deprecated: use Storage.OutputMountPath
+	Logging                   LoggingConfig             `doc:"Logging Configuration"`
+	DZIConfig                 DZIConfig                 `doc:"DZI Configuration"`
+	ThumbnailConfig           ThumbnailConfig           `doc:"Thumbnail Configuration"`
+	Output                    OutputConfig              `doc:"Output pyramids (image.dzi, image.ome.tif)"`
+	DNG                       DNGConfig                 `doc:"DNG development (dcraw)"`
+	Intermediate              IntermediateConfig        `doc:"Intermediate DNG photos are developed into"`
+	StatsConfig               StatsConfig               `doc:"Pixel Statistics (stats.json)"`
+	QC                        QCConfig                  `doc:"Slide QC gate (qc.json)"`
+	OverviewConfig            OverviewConfig            `doc:"Per-level overview JPEGs (overviews/overview_<n>x.jpg)"`
+	AssociatedImages          AssociatedImagesConfig    `doc:"Associated images of whole-slide images (associated/<name>.png, associated.json)"`
+	OpenSlideTiler            OpenSlideTilerConfig      `doc:"OpenSlide tiler for whole-slide images vips cannot open"`
+	WatermarkConfig           WatermarkConfig           `doc:"Watermark (thumbnails, region crops and annotation renders)"`
+	ChannelConfig             ChannelConfig             `doc:"Single-channel / fluorescence mapping"`
+	InputCheck                InputCheckConfig          `doc:"Corrupt input check before tiling"`
+	ImageProcessTimeoutMinute ImageProcessTimeoutMinute `doc:"Timeout Configuration (minutes)"`
+	ImageProcessingTopicID    string                    `env:"IMAGE_PROCESS_RESULT_TOPIC_ID" default:"image-processing-results" doc:"Pub/Sub topics"`
+	ImageRequestTopicID       string                    `env:"IMAGE_PROCESS_REQUEST_TOPIC_ID" default:"image-processing-requests"` // Topic processing requests (reprocess, batch) are published to
+	StrictEvents              bool                      `env:"EVENT_SCHEMA_STRICT" default:"false" local:"true" doc:"Reject published and consumed events that do not match their JSON Schema (pkg/eventschema)"`
+	Preflight                 bool                      `env:"STARTUP_PREFLIGHT" default:"true" local:"false" doc:"Check input, output and topic access with tiny test operations at startup"`
+	TaskAttempt               int                       // Zero-based Cloud Run task attempt (CLOUD_RUN_TASK_ATTEMPT)
+}
+
+// UsesPubSub reports whether events are published to Pub/Sub: in the cloud, or in a
+// local run against the emulator
+func (c *Config) UsesPubSub() bool {
+	return c.Env != EnvLocal || c.Emulator.PubSubHost != ""
+}
+
+// UsesGCS reports whether outputs are uploaded to the output bucket: in the cloud, or
+// in a local run against the emulator
+func (c *Config) UsesGCS() bool {
+	return c.Env != EnvLocal || c.Emulator.StorageHost != ""
 }
 
 func LoadGCPConfig() GCPConfig {
@@ -86,111 +569,471 @@ func LoadGCPConfig() GCPConfig {
 		Region:           os.Getenv("REGION"),
 		InputBucketName:  os.Getenv("ORIGINAL_BUCKET_NAME"),
 		OutputBucketName: os.Getenv("PROCESSED_BUCKET_NAME"),
+		KMSKeyName:       os.Getenv("GCS_KMS_KEY_NAME"),
 	}
 }
 
-func LoadDZIConfig() DZIConfig {
-	tileSize, err := strconv.Atoi(os.Getenv("TILE_SIZE"))
-	if err != nil {
-		tileSize = 256
+func LoadPubSubConfig() PubSubConfig {
+	return PubSubConfig{
+		EventLogPath:         os.Getenv("EVENT_LOG_PATH"),
+		DeploymentAttributes: boolSetting("EVENT_DEPLOYMENT_ATTRIBUTES"),
+		GitSHA:               os.Getenv("GIT_SHA"),
+		BatchDelay:           durationSetting("PUBSUB_BATCH_DELAY_MS", time.Millisecond, notNegative),
+		BatchCount:           intSetting("PUBSUB_BATCH_COUNT", positive),
+		BatchBytes:           intSetting("PUBSUB_BATCH_BYTES", positive),
+		PublishTimeout:       durationSetting("PUBSUB_PUBLISH_TIMEOUT_SECONDS", time.Second, positive),
 	}
-	overlap, err := strconv.Atoi(os.Getenv("OVERLAP"))
-	if err != nil {
-		overlap = 0
+}
+
+func LoadDeadlineConfig() DeadlineConfig {
+	return DeadlineConfig{
+		JobTimeout:     durationSetting("JOB_TIMEOUT_SECONDS", time.Second, notNegative),
+		CleanupReserve: durationSetting("JOB_CLEANUP_RESERVE_SECONDS", time.Second, notNegative),
 	}
-	quality, err := strconv.Atoi(os.Getenv("QUALITY"))
+}
+
+func LoadHeartbeatConfig() HeartbeatConfig {
+	return HeartbeatConfig{
+		Dir:      os.Getenv("HEARTBEAT_DIR"),
+		Interval: durationSetting("HEARTBEAT_INTERVAL_SECONDS", time.Second, positive),
+		WorkerID: getEnv("WORKER_ID", defaultWorkerID()),
+	}
+}
+
+// defaultWorkerID names a Cloud Run task by its execution and index, anything else by
+// its hostname and process ID
+func defaultWorkerID() string {
+	if execution := os.Getenv("CLOUD_RUN_EXECUTION"); execution != "" {
+		return execution + "-" + getEnv("CLOUD_RUN_TASK_INDEX", "0")
+	}
+	hostname, err := os.Hostname()
 	if err != nil {
-		quality = 85
+		hostname = "worker"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+func LoadDeadLetterConfig() DeadLetterConfig {
+	return DeadLetterConfig{
+		MaxAttempts: intSetting("POISON_MAX_ATTEMPTS", notNegative),
+		TopicID:     stringSetting("IMAGE_PROCESS_DLQ_TOPIC_ID"),
+	}
+}
+
+func LoadRequestExpiryConfig() RequestExpiryConfig {
+	return RequestExpiryConfig{MaxAge: durationSetting("REQUEST_MAX_AGE_HOURS", time.Hour, notNegative)}
+}
+
+func LoadQuarantineConfig() QuarantineConfig {
+	return QuarantineConfig{
+		Enabled:      boolSetting("QUARANTINE_ENABLED"),
+		Prefix:       strings.Trim(stringSetting("QUARANTINE_PREFIX"), "/"),
+		CopyOriginal: boolSetting("QUARANTINE_COPY_ORIGINAL"),
+	}
+}
+
+func LoadContentAddressConfig() ContentAddressConfig {
+	return ContentAddressConfig{
+		Enabled:       boolSetting("CONTENT_ADDRESSED_OUTPUTS"),
+		Prefix:        strings.Trim(stringSetting("CONTENT_ADDRESS_PREFIX"), "/"),
+		StoreOriginal: boolSetting("CONTENT_ADDRESS_STORE_ORIGINAL"),
+	}
+}
+
+func LoadFirestoreConfig() FirestoreConfig {
+	return FirestoreConfig{
+		ImageCollection: os.Getenv("FIRESTORE_IMAGE_COLLECTION"),
+		DatabaseID:      stringSetting("FIRESTORE_DATABASE"),
+	}
+}
+
+func LoadDedupConfig() DedupConfig {
+	return DedupConfig{
+		Enabled: boolSetting("CHECKSUM_DEDUP"),
+	}
+}
+
+func LoadSFTPConfig() SFTPConfig {
+	return SFTPConfig{
+		Host:             os.Getenv("SFTP_HOST"),
+		Port:             intSetting("SFTP_PORT", positive),
+		User:             os.Getenv("SFTP_USER"),
+		Root:             stringSetting("SFTP_ROOT"),
+		PasswordSecret:   os.Getenv("SFTP_PASSWORD_SECRET"),
+		PrivateKeySecret: os.Getenv("SFTP_PRIVATE_KEY_SECRET"),
+		KnownHostsSecret: os.Getenv("SFTP_KNOWN_HOSTS_SECRET"),
+		KnownHostsFile:   os.Getenv("SFTP_KNOWN_HOSTS_FILE"),
 	}
-	layout := os.Getenv("DZI_LAYOUT")
-	if layout == "" {
-		layout = "dz"
+}
+
+// Validate checks that the server, a login and a pinned host key are configured
+func (c SFTPConfig) Validate() error {
+	switch {
+	case c.Host == "" || c.User == "":
+		return fmt.Errorf("INPUT_READER=sftp needs SFTP_HOST and SFTP_USER")
+	case c.PasswordSecret == "" && c.PrivateKeySecret == "":
+		return fmt.Errorf("INPUT_READER=sftp needs SFTP_PASSWORD_SECRET or SFTP_PRIVATE_KEY_SECRET")
+	case c.KnownHostsSecret == "" && c.KnownHostsFile == "":
+		return fmt.Errorf("INPUT_READER=sftp needs SFTP_KNOWN_HOSTS_SECRET or SFTP_KNOWN_HOSTS_FILE to verify the server")
 	}
-	suffix := os.Getenv("DZI_SUFFIX")
-	if suffix == "" {
-		suffix = "jpg"
+	return nil
+}
+
+func LoadReplicaConfig() (ReplicaConfig, error) {
+	cfg := ReplicaConfig{
+		Bucket:     os.Getenv("REPLICA_OUTPUT_BUCKET"),
+		MountPath:  os.Getenv("REPLICA_OUTPUT_MOUNT_PATH"),
+		KMSKeyName: os.Getenv("REPLICA_KMS_KEY_NAME"),
+		Timeout:    durationSetting("REPLICA_TIMEOUT_MINUTE", time.Minute, positive),
 	}
+	if cfg.Bucket != "" && cfg.MountPath != "" {
+		return cfg, fmt.Errorf("REPLICA_OUTPUT_BUCKET and REPLICA_OUTPUT_MOUNT_PATH are exclusive")
+	}
+	return cfg, nil
+}
+
+func LoadDeletionConfig() DeletionConfig {
+	return DeletionConfig{Retention: durationSetting("DELETE_RETENTION_HOURS", time.Hour, notNegative)}
+}
 
-	container := os.Getenv("DZI_CONTAINER")
+func LoadTranscodeConfig() TranscodeConfig {
+	return TranscodeConfig{Parallelism: intSetting("TRANSCODE_PARALLELISM", positive)}
+}
+
+// LoadRateLimitConfig reads the pacing settings; the pacer keeps the floor at or below
+// the rate
+func LoadRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		WriteOpsPerSecond:    floatSetting("GCS_WRITE_OPS_PER_SECOND", notNegative),
+		WriteBurst:           intSetting("GCS_WRITE_BURST", positive),
+		MinWriteOpsPerSecond: floatSetting("GCS_WRITE_MIN_OPS_PER_SECOND", positive),
+	}
+}
+
+func LoadRetryConfig() RetryConfig {
+	byType := make(map[string]int)
+	for _, entry := range strings.Split(stringSetting("RETRY_ATTEMPTS_BY_TYPE"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n > 0 {
+			byType[strings.TrimSpace(name)] = n
+		}
+	}
+
+	return RetryConfig{
+		MaxAttempts:        intSetting("RETRY_MAX_ATTEMPTS", positive),
+		BaseDelay:          durationSetting("RETRY_BASE_DELAY_MS", time.Millisecond, notNegative),
+		MaxDelay:           durationSetting("RETRY_MAX_DELAY_MS", time.Millisecond, notNegative),
+		Jitter:             floatSetting("RETRY_JITTER", inRange(0.0, 1.0)),
+		AttemptsByType:     byType,
+		CommandMaxAttempts: intSetting("RETRY_COMMAND_MAX_ATTEMPTS", positive),
+		ResourceDelay:      durationSetting("RETRY_RESOURCE_DELAY_MS", time.Millisecond, notNegative),
+		JobMaxRetries:      intSetting("RETRY_JOB_MAX_RETRIES", notNegative),
+		JobMaxTime:         durationSetting("RETRY_JOB_MAX_SECONDS", time.Second, notNegative),
+	}
+}
+
+func LoadEmulatorConfig() EmulatorConfig {
+	return EmulatorConfig{
+		StorageHost:   os.Getenv("STORAGE_EMULATOR_HOST"),
+		PubSubHost:    os.Getenv("PUBSUB_EMULATOR_HOST"),
+		FirestoreHost: os.Getenv("FIRESTORE_EMULATOR_HOST"),
+	}
+}
+
+func LoadDZIConfig() DZIConfig {
+	container := stringSetting("DZI_CONTAINER")
 	if container != "zip" {
 		container = "fs"
 	}
+	return DZIConfig{
+		TileSize:         intSetting("TILE_SIZE", anyValue),
+		Overlap:          intSetting("OVERLAP", anyValue),
+		Quality:          intSetting("QUALITY", anyValue),
+		Layout:           stringSetting("DZI_LAYOUT"),
+		Suffix:           stringSetting("DZI_SUFFIX"),
+		Container:        container,
+		Compression:      intSetting("DZI_COMPRESSION", inRange(0, 9)),
+		LevelUpload:      boolSetting("DZI_LEVEL_UPLOAD"),
+		LevelUploadQueue: intSetting("DZI_LEVEL_UPLOAD_QUEUE", positive),
+		Dedup:            boolSetting("DZI_DEDUP"),
+	}
+}
 
-	compression, err := strconv.Atoi(os.Getenv("DZI_COMPRESSION"))
-	if err != nil {
-		compression = 0
+func LoadThumbnailConfig() (ThumbnailConfig, error) {
+	width := intSetting("THUMBNAIL_WIDTH", anyValue)
+	height := intSetting("THUMBNAIL_HEIGHT", anyValue)
+	// THUMBNAIL_SIZE sets the edges that are not set on their own
+	if size, err := strconv.Atoi(os.Getenv("THUMBNAIL_SIZE")); err == nil {
+		if _, err := strconv.Atoi(os.Getenv("THUMBNAIL_WIDTH")); err != nil {
+			width = size
+		}
+		if _, err := strconv.Atoi(os.Getenv("THUMBNAIL_HEIGHT")); err != nil {
+			height = size
+		}
 	}
-	if compression < 0 || compression > 9 {
-		compression = 0
+
+	mode := strings.ToLower(stringSetting("THUMBNAIL_MODE"))
+	if !validThumbnailMode(mode) {
+		return ThumbnailConfig{}, fmt.Errorf("invalid THUMBNAIL_MODE %q", mode)
 	}
-	return DZIConfig{
-		TileSize:    tileSize,
-		Overlap:     overlap,
-		Quality:     quality,
-		Layout:      layout,
-		Suffix:      suffix,
-		Container:   container,
+	byDataset := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("THUMBNAIL_MODE_BY_DATASET"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dataset, datasetMode, ok := strings.Cut(entry, "=")
+		datasetMode = strings.ToLower(strings.TrimSpace(datasetMode))
+		if !ok || !validThumbnailMode(datasetMode) {
+			return ThumbnailConfig{}, fmt.Errorf("invalid THUMBNAIL_MODE_BY_DATASET entry %q", entry)
+		}
+		byDataset[strings.TrimSpace(dataset)] = datasetMode
+	}
+
+	return ThumbnailConfig{
+		Width:         width,
+		Height:        height,
+		Quality:       intSetting("THUMBNAIL_QUALITY", anyValue),
+		Mode:          mode,
+		ModeByDataset: byDataset,
+		Background:    stringSetting("THUMBNAIL_BACKGROUND"),
+		FromPyramid:   boolSetting("THUMBNAIL_FROM_PYRAMID"),
+	}, nil
+}
+
+func LoadOutputConfig() (OutputConfig, error) {
+	var formats []string
+	for _, format := range strings.Split(stringSetting("OUTPUT_FORMATS"), ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch format {
+		case "":
+			continue
+		case OutputFormatDZI, OutputFormatOMETIFF:
+			formats = append(formats, format)
+		default:
+			return OutputConfig{}, fmt.Errorf("invalid OUTPUT_FORMATS entry %q, expected dzi or ome-tiff", format)
+		}
+	}
+	cfg := OutputConfig{Formats: formats}
+	if !cfg.Has(OutputFormatDZI) {
+		return OutputConfig{}, fmt.Errorf("OUTPUT_FORMATS must include dzi, the pyramid viewers read")
+	}
+
+	tileSize := intSetting("OME_TIFF_TILE_SIZE", positive)
+	if tileSize%16 != 0 {
+		return OutputConfig{}, fmt.Errorf("invalid OME_TIFF_TILE_SIZE %d, TIFF tiles are a multiple of 16", tileSize)
+	}
+	compression := strings.ToLower(strings.TrimSpace(stringSetting("OME_TIFF_COMPRESSION")))
+	switch compression {
+	case "jpeg", "lzw", "deflate", "zstd", "none":
+	default:
+		return OutputConfig{}, fmt.Errorf("invalid OME_TIFF_COMPRESSION %q", compression)
+	}
+	cfg.OMETIFFTileSize = tileSize
+	cfg.OMETIFFCompression = compression
+	cfg.OMETIFFQuality = intSetting("OME_TIFF_QUALITY", inRange(1, 100))
+	return cfg, nil
+}
+
+func LoadDNGConfig() (DNGConfig, error) {
+	whiteBalance := strings.ToLower(strings.TrimSpace(stringSetting("DNG_WHITE_BALANCE")))
+	switch whiteBalance {
+	case DNGWhiteBalanceCamera, DNGWhiteBalanceAuto, DNGWhiteBalanceNone:
+	default:
+		if _, ok := parseNumbers(whiteBalance, 4); !ok {
+			return DNGConfig{}, fmt.Errorf("invalid DNG_WHITE_BALANCE %q", whiteBalance)
+		}
+	}
+
+	gamma := strings.TrimSpace(os.Getenv("DNG_GAMMA"))
+	if gamma != "" {
+		if values, ok := parseNumbers(gamma, 2); !ok || values[0] == 0 {
+			return DNGConfig{}, fmt.Errorf("invalid DNG_GAMMA %q, expected power and toe slope", gamma)
+		}
+	}
+
+	highlight, err := strconv.Atoi(stringSetting("DNG_HIGHLIGHT"))
+	if err != nil || highlight < 0 || highlight > 9 {
+		return DNGConfig{}, fmt.Errorf("invalid DNG_HIGHLIGHT %q, expected 0-9", os.Getenv("DNG_HIGHLIGHT"))
+	}
+
+	colorSpace := strings.ToLower(strings.TrimSpace(stringSetting("DNG_COLOR_SPACE")))
+	if _, ok := dngColorSpaces[colorSpace]; !ok {
+		return DNGConfig{}, fmt.Errorf("invalid DNG_COLOR_SPACE %q", colorSpace)
+	}
+
+	return DNGConfig{
+		WhiteBalance: whiteBalance,
+		Gamma:        gamma,
+		Highlight:    highlight,
+		ColorSpace:   colorSpace,
+	}, nil
+}
+
+func LoadIntermediateConfig() (IntermediateConfig, error) {
+	format := strings.ToLower(strings.TrimSpace(stringSetting("INTERMEDIATE_FORMAT")))
+	if format != "tiff" && format != "v" {
+		return IntermediateConfig{}, fmt.Errorf("invalid INTERMEDIATE_FORMAT %q, expected tiff or v", format)
+	}
+	compression := strings.ToLower(strings.TrimSpace(stringSetting("INTERMEDIATE_COMPRESSION")))
+	switch compression {
+	case "none", "lzw", "deflate", "zstd":
+	default:
+		return IntermediateConfig{}, fmt.Errorf("invalid INTERMEDIATE_COMPRESSION %q", compression)
+	}
+	if format == "v" && compression != "none" {
+		return IntermediateConfig{}, fmt.Errorf("INTERMEDIATE_COMPRESSION only applies to INTERMEDIATE_FORMAT=tiff")
+	}
+	bitDepth, err := strconv.Atoi(stringSetting("INTERMEDIATE_BIT_DEPTH"))
+	if err != nil || (bitDepth != 8 && bitDepth != 16) {
+		return IntermediateConfig{}, fmt.Errorf("invalid INTERMEDIATE_BIT_DEPTH %q, expected 8 or 16", os.Getenv("INTERMEDIATE_BIT_DEPTH"))
+	}
+	return IntermediateConfig{
+		Format:      format,
 		Compression: compression,
+		BitDepth:    bitDepth,
+	}, nil
+}
+
+func LoadStatsConfig() StatsConfig {
+	return StatsConfig{
+		Enabled:       boolSetting("STATS_ENABLED"),
+		OverviewSize:  intSetting("STATS_OVERVIEW_SIZE", positive),
+		HistogramBins: intSetting("STATS_HISTOGRAM_BINS", inRange(1, 256)),
 	}
 }
 
-func LoadThumbnailConfig() ThumbnailConfig {
-	width, err := strconv.Atoi(os.Getenv("THUMBNAIL_SIZE"))
-	if err != nil {
-		width = 256
+func LoadOverviewConfig() OverviewConfig {
+	var downsamples []int
+	for _, value := range strings.Split(stringSetting("OVERVIEW_DOWNSAMPLES"), ",") {
+		factor, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || factor <= 0 {
+			continue
+		}
+		downsamples = append(downsamples, factor)
 	}
-	height, err := strconv.Atoi(os.Getenv("THUMBNAIL_SIZE"))
-	if err != nil {
-		height = 256
+	return OverviewConfig{
+		Enabled:     boolSetting("OVERVIEW_ENABLED"),
+		Downsamples: downsamples,
+		Quality:     intSetting("OVERVIEW_QUALITY", inRange(1, 100)),
+		MaxSize:     intSetting("OVERVIEW_MAX_SIZE", inRange(1, 65500)),
 	}
-	quality, err := strconv.Atoi(os.Getenv("THUMBNAIL_QUALITY"))
-	if err != nil {
-		quality = 90
+}
+
+func LoadAssociatedImagesConfig() AssociatedImagesConfig {
+	// Set but empty disables the export
+	value, ok := os.LookupEnv("ASSOCIATED_IMAGES")
+	if !ok {
+		value = defaultOf("ASSOCIATED_IMAGES")
 	}
-	return ThumbnailConfig{
-		Width:   width,
-		Height:  height,
-		Quality: quality,
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
 	}
+	return AssociatedImagesConfig{Names: names}
 }
 
-func LoadTimeoutConfig() ImageProcessTimeoutMinute {
-	formatConversion, err := strconv.Atoi(os.Getenv("FORMAT_CONVERSION_TIMEOUT_MINUTE"))
-	if err != nil {
-		formatConversion = 20
+func LoadOpenSlideTilerConfig() OpenSlideTilerConfig {
+	return OpenSlideTilerConfig{
+		Enabled:              boolSetting("OPENSLIDE_TILER"),
+		ChunkTiles:           intSetting("OPENSLIDE_TILER_CHUNK_TILES", positive),
+		PreviewSize:          intSetting("OPENSLIDE_TILER_PREVIEW_SIZE", positive),
+		PreviewChunkSize:     intSetting("OPENSLIDE_TILER_PREVIEW_CHUNK_SIZE", positive),
+		PreviewMaxMegapixels: int64Setting("OPENSLIDE_TILER_PREVIEW_MAX_MEGAPIXELS", notNegative),
 	}
-	dziConversion, err := strconv.Atoi(os.Getenv("DZI_CONVERSION_TIMEOUT_MINUTE"))
-	if err != nil {
-		dziConversion = 120
+}
+
+func LoadWatermarkConfig() WatermarkConfig {
+	position := stringSetting("WATERMARK_POSITION")
+	switch position {
+	case "top-left", "top-right", "bottom-left", "bottom-right", "center":
+	default:
+		position = defaultOf("WATERMARK_POSITION")
 	}
-	thumbnail, err := strconv.Atoi(os.Getenv("THUMBNAIL_TIMEOUT_MINUTE"))
-	if err != nil {
-		thumbnail = 10
+	return WatermarkConfig{
+		Enabled:   boolSetting("WATERMARK_ENABLED"),
+		Text:      os.Getenv("WATERMARK_TEXT"),
+		LogoPath:  os.Getenv("WATERMARK_LOGO_PATH"),
+		Position:  position,
+		Opacity:   floatSetting("WATERMARK_OPACITY", func(v float64) bool { return v > 0 && v <= 1 }),
+		Color:     stringSetting("WATERMARK_COLOR"),
+		TextScale: intSetting("WATERMARK_TEXT_SCALE", positive),
+		Margin:    intSetting("WATERMARK_MARGIN", notNegative),
 	}
-	general, err := strconv.Atoi(os.Getenv("GENERAL_IMAGE_PROCESS_TIMEOUT_MINUTE"))
-	if err != nil {
-		general = 10
+}
+
+func LoadChannelConfig() ChannelConfig {
+	var colors []string
+	for _, c := range strings.Split(stringSetting("CHANNEL_COLORS"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			colors = append(colors, c)
+		}
 	}
-	return ImageProcessTimeoutMinute{
-		FormatConversion: formatConversion,
-		DZIConversion:    dziConversion,
-		Thumbnail:        thumbnail,
-		General:          general,
+	return ChannelConfig{
+		Enabled: boolSetting("CHANNEL_MAPPING_ENABLED"),
+		LUT:     stringSetting("CHANNEL_LUT"),
+		Colors:  colors,
+		Rescale: boolSetting("CHANNEL_RESCALE"),
 	}
 }
 
-func LoadLoggingConfig() LoggingConfig {
-	level := os.Getenv("LOG_LEVEL")
-	if level == "" {
-		level = "INFO"
+func LoadInputCheckConfig() InputCheckConfig {
+	return InputCheckConfig{
+		Enabled:       boolSetting("INPUT_CHECK_ENABLED"),
+		RegionSize:    intSetting("INPUT_CHECK_REGION_SIZE", positive),
+		TimeoutMinute: intSetting("INPUT_CHECK_TIMEOUT_MINUTE", positive),
+	}
+}
+
+func LoadScratchConfig() ScratchConfig {
+	return ScratchConfig{
+		Dir:        stringSetting("SCRATCH_DIR"),
+		BudgetMB:   intSetting("SCRATCH_BUDGET_MB", notNegative),
+		Multiplier: floatSetting("SCRATCH_MULTIPLIER", positive),
+		GCMaxAge:   durationSetting("SCRATCH_GC_MAX_AGE_MINUTES", time.Minute, notNegative),
+	}
+}
+
+func LoadSchedulerConfig() SchedulerConfig {
+	factors := make(map[string]float64)
+	for _, entry := range strings.Split(stringSetting("SCHEDULER_FORMAT_FACTORS"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && f >= 0 {
+			factors["."+strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "."))] = f
+		}
+	}
+
+	return SchedulerConfig{
+		MemoryMB:      intSetting("SCHEDULER_MEMORY_MB", notNegative),
+		JobBaseMB:     intSetting("SCHEDULER_JOB_BASE_MB", notNegative),
+		FormatFactors: factors,
+		MaxJobs:       intSetting("SCHEDULER_MAX_JOBS", notNegative),
 	}
-	format := os.Getenv("LOG_FORMAT")
-	if format == "" {
-		format = "json"
+}
+
+func LoadTimeoutConfig() ImageProcessTimeoutMinute {
+	return ImageProcessTimeoutMinute{
+		FormatConversion: intSetting("FORMAT_CONVERSION_TIMEOUT_MINUTE", anyValue),
+		DZIConversion:    intSetting("DZI_CONVERSION_TIMEOUT_MINUTE", anyValue),
+		Thumbnail:        intSetting("THUMBNAIL_TIMEOUT_MINUTE", anyValue),
+		General:          intSetting("GENERAL_IMAGE_PROCESS_TIMEOUT_MINUTE", anyValue),
 	}
+}
+
+func LoadLoggingConfig() LoggingConfig {
 	return LoggingConfig{
-		Level:  level,
-		Format: format,
+		Level:                stringSetting("LOG_LEVEL"),
+		Format:               stringSetting("LOG_FORMAT"),
+		RedactKeys:           logger.ParseKeys(os.Getenv(logger.RedactKeysEnv)),
+		SlowCommandThreshold: durationSetting("SLOW_COMMAND_THRESHOLD_SECONDS", time.Second, notNegative),
 	}
 }
 func LoadConfig(logger *slog.Logger) (*Config, error) {
@@ -198,48 +1041,202 @@ func LoadConfig(logger *slog.Logger) (*Config, error) {
 		logger.Warn("No .env file found, using environment variables")
 	}
 
-	env := Environment(getEnv("APP_ENV", "LOCAL"))
-	workerType := WorkerType(getEnv("WORKER_TYPE", "medium"))
+	env := environment()
+	workerType := WorkerType(stringSetting("WORKER_TYPE"))
+	workerProfile := workerType.Profile()
+	if parallelism, err := strconv.Atoi(os.Getenv("PROCESSING_PARALLELISM")); err == nil && parallelism > 0 {
+		workerProfile.Parallelism = parallelism
+	}
+	if maxMB, err := strconv.ParseInt(os.Getenv("MAX_INPUT_SIZE_MB"), 10, 64); err == nil && maxMB >= 0 {
+		workerProfile.MaxInputMB = maxMB
+	}
+	if maxMegapixels, err := strconv.ParseInt(os.Getenv("MAX_INPUT_MEGAPIXELS"), 10, 64); err == nil && maxMegapixels >= 0 {
+		workerProfile.MaxInputMegapixels = maxMegapixels
+	}
+	if maxWorkspaceMB, err := strconv.ParseInt(os.Getenv("MAX_WORKSPACE_MB"), 10, 64); err == nil && maxWorkspaceMB >= 0 {
+		workerProfile.MaxWorkspaceMB = maxWorkspaceMB
+	}
 
 	// Terraform IMAGE_PROCESS_RESULT_TOPIC_ID env var ile uyumlu
-	imageProcessingTopicID := getEnv("IMAGE_PROCESS_RESULT_TOPIC_ID", "image-processing-results")
+	imageProcessingTopicID := stringSetting("IMAGE_PROCESS_RESULT_TOPIC_ID")
+	imageRequestTopicID := stringSetting("IMAGE_PROCESS_REQUEST_TOPIC_ID")
 
 	dziConfig := LoadDZIConfig()
-	thumbnailConfig := LoadThumbnailConfig()
+	thumbnailConfig, err := LoadThumbnailConfig()
+	if err != nil {
+		return nil, err
+	}
+	outputConfig, err := LoadOutputConfig()
+	if err != nil {
+		return nil, err
+	}
+	dngConfig, err := LoadDNGConfig()
+	if err != nil {
+		return nil, err
+	}
+	intermediateConfig, err := LoadIntermediateConfig()
+	if err != nil {
+		return nil, err
+	}
+	statsConfig := LoadStatsConfig()
+	qcConfig, err := LoadQCConfig()
+	if err != nil {
+		return nil, err
+	}
+	if qcConfig.Enabled && !statsConfig.Enabled {
+		return nil, fmt.Errorf("QC_ENABLED needs STATS_ENABLED, the QC measures are computed with the pixel statistics")
+	}
+	overviewConfig := LoadOverviewConfig()
+	associatedImagesConfig := LoadAssociatedImagesConfig()
+	openSlideTilerConfig := LoadOpenSlideTilerConfig()
+	watermarkConfig := LoadWatermarkConfig()
+	if watermarkConfig.Enabled && watermarkConfig.Text == "" && watermarkConfig.LogoPath == "" {
+		logger.Warn("WATERMARK_ENABLED is set without WATERMARK_TEXT or WATERMARK_LOGO_PATH, disabling watermark")
+		watermarkConfig.Enabled = false
+	}
+	channelConfig := LoadChannelConfig()
+	inputCheckConfig := LoadInputCheckConfig()
+	taskAttempt, err := strconv.Atoi(os.Getenv("CLOUD_RUN_TASK_ATTEMPT"))
+	if err != nil || taskAttempt < 0 {
+		taskAttempt = 0
+	}
+	scratchConfig := LoadScratchConfig()
+	schedulerConfig := LoadSchedulerConfig()
+	memoryConfig := LoadMemoryConfig(workerProfile.Parallelism)
 	timeoutConfig := LoadTimeoutConfig()
 	loggingConfig := LoadLoggingConfig()
+	pubSubConfig := LoadPubSubConfig()
+	retryConfig := LoadRetryConfig()
+	rateLimitConfig := LoadRateLimitConfig()
+	requestExpiryConfig := LoadRequestExpiryConfig()
+	deadLetterConfig := LoadDeadLetterConfig()
+	quarantineConfig := LoadQuarantineConfig()
+	contentAddressConfig := LoadContentAddressConfig()
+	dedupConfig := LoadDedupConfig()
+	deletionConfig := LoadDeletionConfig()
+	transcodeConfig := LoadTranscodeConfig()
+	replicaConfig, err := LoadReplicaConfig()
+	if err != nil {
+		return nil, err
+	}
+	deadlineConfig := LoadDeadlineConfig()
+	heartbeatConfig := LoadHeartbeatConfig()
+	firestoreConfig := LoadFirestoreConfig()
+	emulatorConfig := LoadEmulatorConfig()
+	tenantConfig, err := LoadTenantConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tenantConfig.Enabled() && replicaConfig.Enabled() {
+		return nil, fmt.Errorf("a replica destination cannot be combined with TENANT_ROUTING_FILE, it would mix the outputs of tenants")
+	}
 	var outputRootPath string
 	var gcpConfig GCPConfig
 	var storageConfig StorageConfig
+	stageInput := boolSetting("INPUT_STAGING")
+	checksums := boolSetting("STORAGE_CHECKSUMS")
+	uploadManifest := boolSetting("UPLOAD_MANIFEST")
+	inputReader := strings.ToLower(stringSetting("INPUT_READER"))
+	if inputReader != InputReaderMount && inputReader != InputReaderGCS && inputReader != InputReaderSFTP {
+		return nil, fmt.Errorf("invalid INPUT_READER %q, expected mount, gcs or sftp", inputReader)
+	}
+	sftpConfig := LoadSFTPConfig()
+	if inputReader == InputReaderSFTP {
+		if err := sftpConfig.Validate(); err != nil {
+			return nil, err
+		}
+		// Nothing is mounted, the processing commands read the staged copy
+		if !stageInput {
+			logger.Info("INPUT_READER=sftp stages every input, enabling INPUT_STAGING")
+			stageInput = true
+		}
+	}
+	uploadParallelism := intSetting("MOUNT_UPLOAD_PARALLELISM", positive)
 
 	if env == EnvLocal {
 		outputRootPath = getEnv("OUTPUT_ROOT_PATH", "./output")
 		storageConfig = StorageConfig{
-			InputMountPath:  getEnv("INPUT_MOUNT_PATH", "./test-data/input"),
-			OutputMountPath: getEnv("OUTPUT_MOUNT_PATH", "./test-data/output"),
+			InputMountPath:    stringSetting("INPUT_MOUNT_PATH"),
+			OutputMountPath:   stringSetting("OUTPUT_MOUNT_PATH"),
+			StageInput:        stageInput,
+			Checksums:         checksums,
+			UploadManifest:    uploadManifest,
+			InputReader:       inputReader,
+			UploadParallelism: uploadParallelism,
 		}
 		gcpConfig = GCPConfig{}
+		if emulatorConfig.Enabled() {
+			gcpConfig = LoadGCPConfig()
+			if gcpConfig.ProjectID == "" {
+				// Emulators accept any project
+				gcpConfig.ProjectID = "local-emulator"
+			}
+		}
 	} else {
 		outputRootPath = ""
 		// In cloud, use /input and /output mount points (GCS FUSE)
 		storageConfig = StorageConfig{
-			InputMountPath:  getEnv("INPUT_MOUNT_PATH", "/input"),
-			OutputMountPath: getEnv("OUTPUT_MOUNT_PATH", "/output"),
+			InputMountPath:    stringSetting("INPUT_MOUNT_PATH"),
+			OutputMountPath:   stringSetting("OUTPUT_MOUNT_PATH"),
+			StageInput:        stageInput,
+			Checksums:         checksums,
+			UploadManifest:    uploadManifest,
+			InputReader:       inputReader,
+			UploadParallelism: uploadParallelism,
 		}
 		gcpConfig = LoadGCPConfig()
 	}
+	if inputReader == InputReaderGCS && gcpConfig.InputBucketName == "" {
+		return nil, fmt.Errorf("INPUT_READER=gcs needs ORIGINAL_BUCKET_NAME")
+	}
 
 	config := &Config{
 		Env:                       env,
 		WorkerType:                workerType,
+		WorkerProfile:             workerProfile,
 		Storage:                   storageConfig,
+		SFTP:                      sftpConfig,
+		Scratch:                   scratchConfig,
+		Scheduler:                 schedulerConfig,
+		Memory:                    memoryConfig,
+		Emulator:                  emulatorConfig,
+		Tenants:                   tenantConfig,
 		OutputRootPath:            outputRootPath,
 		GCP:                       gcpConfig,
+		PubSub:                    pubSubConfig,
+		Retry:                     retryConfig,
+		RateLimit:                 rateLimitConfig,
+		RequestExpiry:             requestExpiryConfig,
+		DeadLetter:                deadLetterConfig,
+		Quarantine:                quarantineConfig,
+		ContentAddress:            contentAddressConfig,
+		Dedup:                     dedupConfig,
+		Replica:                   replicaConfig,
+		Deletion:                  deletionConfig,
+		Transcode:                 transcodeConfig,
+		Deadline:                  deadlineConfig,
+		Heartbeat:                 heartbeatConfig,
+		Firestore:                 firestoreConfig,
 		Logging:                   loggingConfig,
 		DZIConfig:                 dziConfig,
 		ThumbnailConfig:           thumbnailConfig,
+		Output:                    outputConfig,
+		DNG:                       dngConfig,
+		Intermediate:              intermediateConfig,
+		StatsConfig:               statsConfig,
+		QC:                        qcConfig,
+		OverviewConfig:            overviewConfig,
+		AssociatedImages:          associatedImagesConfig,
+		OpenSlideTiler:            openSlideTilerConfig,
+		WatermarkConfig:           watermarkConfig,
+		ChannelConfig:             channelConfig,
+		InputCheck:                inputCheckConfig,
 		ImageProcessTimeoutMinute: timeoutConfig,
 		ImageProcessingTopicID:    imageProcessingTopicID,
+		ImageRequestTopicID:       imageRequestTopicID,
+		StrictEvents:              boolSetting("EVENT_SCHEMA_STRICT"),
+		Preflight:                 boolSetting("STARTUP_PREFLIGHT"),
+		TaskAttempt:               taskAttempt,
 	}
 
 	return config, nil
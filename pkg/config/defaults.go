@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settingTags are the struct tags of the settings of Config by env var. They are the
+// one table of defaults: the loaders fall back to them and WriteTemplate writes them.
+var settingTags = collectSettingTags(reflect.TypeOf(Config{}), make(map[string]reflect.StructTag))
+
+func collectSettingTags(typ reflect.Type, tags map[string]reflect.StructTag) map[string]reflect.StructTag {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			collectSettingTags(field.Type, tags)
+			continue
+		}
+		// Settings shared by several fields take the tags of the first
+		if name := field.Tag.Get("env"); name != "" {
+			if _, seen := tags[name]; !seen {
+				tags[name] = field.Tag
+			}
+		}
+	}
+	return tags
+}
+
+// settingDefault returns the default of a setting in env: its local, dev or prod tag,
+// else its default tag. ok is false for settings derived at startup.
+func settingDefault(env Environment, name string) (value string, ok bool) {
+	tag := settingTags[name]
+	if value, ok := tag.Lookup(strings.ToLower(string(env))); ok {
+		return value, true
+	}
+	return tag.Lookup("default")
+}
+
+// environment is the APP_ENV the loaders take the defaults of
+func environment() Environment {
+	return Environment(getEnv("APP_ENV", string(EnvLocal)))
+}
+
+func defaultOf(name string) string {
+	value, _ := settingDefault(environment(), name)
+	return value
+}
+
+// stringSetting returns the env var name, or its default when unset or empty
+func stringSetting(name string) string {
+	return getEnv(name, defaultOf(name))
+}
+
+// boolSetting parses the env var name, falling back to its default when it is unset
+// or not a boolean
+func boolSetting(name string) bool {
+	if value, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+		return value
+	}
+	value, _ := strconv.ParseBool(defaultOf(name))
+	return value
+}
+
+// intSetting parses the env var name, falling back to its default when it is unset,
+// not a number or not valid
+func intSetting(name string, valid func(int) bool) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && valid(value) {
+		return value
+	}
+	value, _ := strconv.Atoi(defaultOf(name))
+	return value
+}
+
+// int64Setting is intSetting for 64-bit values
+func int64Setting(name string, valid func(int64) bool) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && valid(value) {
+		return value
+	}
+	value, _ := strconv.ParseInt(defaultOf(name), 10, 64)
+	return value
+}
+
+// floatSetting is intSetting for floating point values
+func floatSetting(name string, valid func(float64) bool) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && valid(value) {
+		return value
+	}
+	value, _ := strconv.ParseFloat(defaultOf(name), 64)
+	return value
+}
+
+// durationSetting reads a setting counted in unit, e.g. the seconds of *_SECONDS
+func durationSetting(name string, unit time.Duration, valid func(int) bool) time.Duration {
+	return time.Duration(intSetting(name, valid)) * unit
+}
+
+// Validity checks of the numeric settings
+func anyValue[T int | int64 | float64](T) bool      { return true }
+func positive[T int | int64 | float64](v T) bool    { return v > 0 }
+func notNegative[T int | int64 | float64](v T) bool { return v >= 0 }
+
+// inRange accepts values from lo to hi, both included
+func inRange[T int | int64 | float64](lo, hi T) func(T) bool {
+	return func(v T) bool { return v >= lo && v <= hi }
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const mib = 1 << 20
+
+// cgroup v1 reports "no limit" as a page-aligned value close to math.MaxInt64
+const cgroupV1Unlimited = int64(1) << 60
+
+// MemoryConfig is derived from the container memory limit so vips settings and
+// input admission match the worker size instead of being killed with exit 137.
+type MemoryConfig struct {
+	LimitBytes      int64 `env:"MEMORY_LIMIT_MB"`                                                                        // Container memory limit, 0 when none could be determined
+	VipsConcurrency int   `env:"VIPS_CONCURRENCY"`                                                                       // Worker threads per vips invocation
+	VipsCacheMB     int   `env:"VIPS_CACHE_MAX_MEM_MB"`                                                                  // vips operation cache ceiling per invocation
+	VipsDiscMB      int   `env:"VIPS_DISC_THRESHOLD_MB"`                                                                 // Images decoded larger than this go to a temp file instead of RAM
+	MaxInputPixels  int64 `env:"MAX_INPUT_PIXELS" doc:"0 disables the guard for inputs decoded fully into memory (DNG)"` // Largest input decoded fully into memory (e.g. DNG), 0 disables the guard
+}
+
+// LoadMemoryConfig derives the memory settings from the cgroup limit (or
+// MEMORY_LIMIT_MB), sharing the budget between parallel processing steps.
+// Each derived value can be overridden through its own environment variable.
+func LoadMemoryConfig(parallelism int) MemoryConfig {
+	limit := cgroupMemoryLimit()
+	if mb, err := strconv.ParseInt(os.Getenv("MEMORY_LIMIT_MB"), 10, 64); err == nil && mb > 0 {
+		limit = mb * mib
+	}
+
+	cfg := deriveMemoryConfig(limit, parallelism)
+
+	if v, err := strconv.Atoi(os.Getenv("VIPS_CONCURRENCY")); err == nil && v > 0 {
+		cfg.VipsConcurrency = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("VIPS_CACHE_MAX_MEM_MB")); err == nil && v >= 0 {
+		cfg.VipsCacheMB = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("VIPS_DISC_THRESHOLD_MB")); err == nil && v > 0 {
+		cfg.VipsDiscMB = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MAX_INPUT_PIXELS"), 10, 64); err == nil && v >= 0 {
+		cfg.MaxInputPixels = v
+	}
+
+	return cfg
+}
+
+func deriveMemoryConfig(limit int64, parallelism int) MemoryConfig {
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	if limit <= 0 {
+		// Unknown limit: leave the vips defaults alone and admit everything
+		return MemoryConfig{VipsConcurrency: runtime.NumCPU()}
+	}
+
+	share := limit / int64(parallelism)
+
+	// Roughly one thread per 512MB share keeps tile buffers comfortably inside the limit
+	concurrency := int(share / (512 * mib))
+	concurrency = max(1, min(concurrency, runtime.NumCPU()))
+
+	// A tenth of the share for the operation cache, between 16MB and 512MB
+	cacheMB := int(max(16, min(share/10/mib, 512)))
+
+	// Decoding past a quarter of the share spills to disk
+	discMB := int(max(16, share/4/mib))
+
+	// Full-image decoders (dcraw) hold 16-bit RGB, keep them under 60% of the limit
+	maxPixels := limit * 6 / 10 / 6
+
+	return MemoryConfig{
+		LimitBytes:      limit,
+		VipsConcurrency: concurrency,
+		VipsCacheMB:     cacheMB,
+		VipsDiscMB:      discMB,
+		MaxInputPixels:  maxPixels,
+	}
+}
+
+// cgroupMemoryLimit reads the memory limit of the current cgroup (v2, then v1).
+// It returns 0 when no limit is set or the files are not available.
+func cgroupMemoryLimit() int64 {
+	if data, err := os.ReadFile("/sys/fs/cgroup/memory.max"); err == nil {
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0
+		}
+		if limit, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return limit
+		}
+	}
+
+	if data, err := os.ReadFile("/sys/fs/cgroup/memory/memory.limit_in_bytes"); err == nil {
+		if limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil && limit < cgroupV1Unlimited {
+			return limit
+		}
+	}
+
+	return 0
+}
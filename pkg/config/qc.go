@@ -0,0 +1,123 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// QCLimit is a warn and a fail threshold of one QC measure
+type QCLimit [2]float64
+
+// Warn is the threshold past which a slide gets a warn verdict
+func (l QCLimit) Warn() float64 { return l[0] }
+
+// Fail is the threshold past which a slide fails QC
+func (l QCLimit) Fail() float64 { return l[1] }
+
+// QCThresholds are the limits of the slide QC measures, each a warn,fail pair.
+// Dataset overrides in QC_DATASET_THRESHOLDS_FILE use the JSON names, e.g.
+// {"frozen": {"min_focus_score": [20, 5]}}.
+type QCThresholds struct {
+	MinTissueFraction QCLimit `json:"min_tissue_fraction" env:"QC_MIN_TISSUE_FRACTION" default:"0.05,0.01" doc:"Warn,fail share of the overview that is tissue"`
+	MinFocusScore     QCLimit `json:"min_focus_score" env:"QC_MIN_FOCUS_SCORE" default:"50,15" doc:"Warn,fail variance of the Laplacian of the tissue, low when out of focus"`
+	MinBrightness     QCLimit `json:"min_brightness" env:"QC_MIN_BRIGHTNESS" default:"60,30" doc:"Warn,fail mean luminance (0-255) of the tissue, low when overstained or underexposed"`
+	MaxBrightness     QCLimit `json:"max_brightness" env:"QC_MAX_BRIGHTNESS" default:"230,245" doc:"Warn,fail mean luminance (0-255) of the tissue, high when faint or overexposed"`
+}
+
+// Validate requires every warn threshold to be passed before its fail threshold
+func (t QCThresholds) Validate() error {
+	for _, limit := range []struct {
+		name  string
+		limit QCLimit
+		upper bool
+	}{
+		{"min_tissue_fraction", t.MinTissueFraction, false},
+		{"min_focus_score", t.MinFocusScore, false},
+		{"min_brightness", t.MinBrightness, false},
+		{"max_brightness", t.MaxBrightness, true},
+	} {
+		if limit.limit.Warn() < 0 || limit.limit.Fail() < 0 {
+			return fmt.Errorf("%s thresholds must not be negative", limit.name)
+		}
+		if !limit.upper && limit.limit.Warn() < limit.limit.Fail() ||
+			limit.upper && limit.limit.Warn() > limit.limit.Fail() {
+			return fmt.Errorf("%s warn threshold %g is past its fail threshold %g",
+				limit.name, limit.limit.Warn(), limit.limit.Fail())
+		}
+	}
+	return nil
+}
+
+// QCConfig controls the slide QC gate: a pass/warn/fail verdict (qc.json) from the
+// tissue fraction, focus score and brightness in stats.json
+type QCConfig struct {
+	Enabled               bool                    `env:"QC_ENABLED" default:"false" doc:"Needs STATS_ENABLED"`
+	HoldFailed            bool                    `env:"QC_HOLD_FAILED" default:"false" doc:"Upload failing slides but hold their result event in qc_hold.json pending review"`
+	DatasetThresholdsFile string                  `env:"QC_DATASET_THRESHOLDS_FILE" doc:"JSON object of dataset to thresholds overriding the defaults below"`
+	ByDataset             map[string]QCThresholds // Loaded from DatasetThresholdsFile, each on top of Thresholds
+	Thresholds            QCThresholds
+	Dataset               string // Dataset whose thresholds are applied, set by ApplyDataset
+}
+
+// ApplyDataset switches to the thresholds of dataset, when it has any of its own
+func (c *QCConfig) ApplyDataset(dataset string) {
+	if thresholds, ok := c.ByDataset[dataset]; ok && dataset != "" {
+		c.Thresholds = thresholds
+		c.Dataset = dataset
+	}
+}
+
+func LoadQCConfig() (QCConfig, error) {
+	cfg := QCConfig{
+		Enabled:               boolSetting("QC_ENABLED"),
+		HoldFailed:            boolSetting("QC_HOLD_FAILED"),
+		DatasetThresholdsFile: os.Getenv("QC_DATASET_THRESHOLDS_FILE"),
+	}
+
+	for _, limit := range []struct {
+		env    string
+		target *QCLimit
+	}{
+		{"QC_MIN_TISSUE_FRACTION", &cfg.Thresholds.MinTissueFraction},
+		{"QC_MIN_FOCUS_SCORE", &cfg.Thresholds.MinFocusScore},
+		{"QC_MIN_BRIGHTNESS", &cfg.Thresholds.MinBrightness},
+		{"QC_MAX_BRIGHTNESS", &cfg.Thresholds.MaxBrightness},
+	} {
+		value := stringSetting(limit.env)
+		numbers, ok := parseNumbers(strings.ReplaceAll(value, ",", " "), 2)
+		if !ok {
+			return cfg, fmt.Errorf("invalid %s %q, expected warn,fail", limit.env, value)
+		}
+		*limit.target = QCLimit{numbers[0], numbers[1]}
+	}
+	if err := cfg.Thresholds.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid QC thresholds: %w", err)
+	}
+
+	if cfg.DatasetThresholdsFile == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(cfg.DatasetThresholdsFile)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read QC_DATASET_THRESHOLDS_FILE: %w", err)
+	}
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return cfg, fmt.Errorf("invalid QC_DATASET_THRESHOLDS_FILE %s: %w", cfg.DatasetThresholdsFile, err)
+	}
+	cfg.ByDataset = make(map[string]QCThresholds, len(overrides))
+	for dataset, override := range overrides {
+		// Thresholds a dataset does not name keep their default
+		thresholds := cfg.Thresholds
+		if err := json.Unmarshal(override, &thresholds); err != nil {
+			return cfg, fmt.Errorf("invalid QC_DATASET_THRESHOLDS_FILE %s, dataset %q: %w", cfg.DatasetThresholdsFile, dataset, err)
+		}
+		if err := thresholds.Validate(); err != nil {
+			return cfg, fmt.Errorf("invalid QC_DATASET_THRESHOLDS_FILE %s, dataset %q: %w", cfg.DatasetThresholdsFile, dataset, err)
+		}
+		cfg.ByDataset[dataset] = thresholds
+	}
+	return cfg, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+// WriteTemplate writes a commented .env template with every setting of Config and
+// the defaults of the env profile. It is generated from the struct tags of Config,
+// so settings added there show up without further changes, with the defaults the
+// loaders fall back to. Settings without a default (derived at startup, off or to be
+// filled in) are written commented out.
+func WriteTemplate(w io.Writer, env Environment) error {
+	switch env {
+	case EnvLocal, EnvDev, EnvProduction:
+	default:
+		return fmt.Errorf("unknown environment %q, expected %s, %s or %s", env, EnvLocal, EnvDev, EnvProduction)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# himgproc configuration for %s, generated by \"himgproc config init\"\n", env)
+	fmt.Fprintf(bw, "# Commented-out settings have no default: they are derived at startup or off\n")
+	fmt.Fprintf(bw, "# when unset, or show a value to fill in.\n")
+
+	t := &templateWriter{w: bw, env: env, seen: make(map[string]bool)}
+	t.writeSection(reflect.TypeOf(Config{}), true, false)
+	return bw.Flush()
+}
+
+type templateWriter struct {
+	w    *bufio.Writer
+	env  Environment
+	seen map[string]bool // Settings shared by several fields are written once
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// writeSection writes the settings of a struct type. Nested structs and documented
+// top-level settings start a paragraph of their own.
+func (t *templateWriter) writeSection(typ reflect.Type, top, disabled bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			// Cloud-only sections are not read in the local environment
+			sectionDisabled := disabled || (field.Tag.Get("profile") == "cloud" && t.env == EnvLocal)
+			fmt.Fprintf(t.w, "\n")
+			if doc := field.Tag.Get("doc"); doc != "" {
+				fmt.Fprintf(t.w, "# %s\n", doc)
+			}
+			if sectionDisabled && !disabled {
+				fmt.Fprintf(t.w, "# Only read when APP_ENV is not %s\n", EnvLocal)
+			}
+			t.writeSection(field.Type, false, sectionDisabled)
+			continue
+		}
+		if top && field.Tag.Get("doc") != "" && !t.seen[field.Tag.Get("env")] {
+			fmt.Fprintf(t.w, "\n")
+		}
+		t.writeSetting(field, disabled)
+	}
+}
+
+func (t *templateWriter) writeSetting(field reflect.StructField, disabled bool) {
+	name := field.Tag.Get("env")
+	if name == "" || t.seen[name] {
+		return
+	}
+	t.seen[name] = true
+
+	if doc := field.Tag.Get("doc"); doc != "" {
+		fmt.Fprintf(t.w, "# %s\n", doc)
+	}
+	value, ok := settingDefault(t.env, name)
+	if !ok {
+		value = field.Tag.Get("example")
+	}
+	if !ok || disabled {
+		fmt.Fprintf(t.w, "# %s=%s\n", name, value)
+		return
+	}
+	fmt.Fprintf(t.w, "%s=%s\n", name, value)
+}
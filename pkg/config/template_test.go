@@ -0,0 +1,82 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+// TestTemplateMatchesLoader loads the configuration of an empty environment and of
+// the rendered template of the same environment, which must be the same
+func TestTemplateMatchesLoader(t *testing.T) {
+	for _, env := range []Environment{EnvLocal, EnvDev, EnvProduction} {
+		t.Run(string(env), func(t *testing.T) {
+			var template bytes.Buffer
+			if err := WriteTemplate(&template, env); err != nil {
+				t.Fatalf("WriteTemplate: %v", err)
+			}
+			settings, err := godotenv.Parse(&template)
+			if err != nil {
+				t.Fatalf("rendered template does not parse: %v", err)
+			}
+
+			clearEnv(t)
+			t.Setenv("APP_ENV", string(env))
+			defaults := loadConfig(t)
+
+			for name, value := range settings {
+				t.Setenv(name, value)
+			}
+			rendered := loadConfig(t)
+
+			if !reflect.DeepEqual(defaults, rendered) {
+				for _, diff := range fieldDiffs(reflect.ValueOf(*defaults), reflect.ValueOf(*rendered), "Config") {
+					t.Errorf("%s differs between the loader defaults and the template", diff)
+				}
+			}
+		})
+	}
+}
+
+// clearEnv unsets every environment variable for the duration of the test
+func clearEnv(t *testing.T) {
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		t.Setenv(name, value)
+		os.Unsetenv(name)
+	}
+}
+
+func loadConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := LoadConfig(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+// fieldDiffs names the fields in which a and b differ, with both values
+func fieldDiffs(a, b reflect.Value, path string) []string {
+	if a.Kind() != reflect.Struct || a.Type() == durationType {
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s (%v / %v)", path, a.Interface(), b.Interface())}
+	}
+	var diffs []string
+	for i := 0; i < a.NumField(); i++ {
+		if !a.Type().Field(i).IsExported() {
+			continue
+		}
+		diffs = append(diffs, fieldDiffs(a.Field(i), b.Field(i), path+"."+a.Type().Field(i).Name)...)
+	}
+	return diffs
+}
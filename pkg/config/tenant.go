@@ -0,0 +1,164 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+)
+
+// tenantIDPattern keeps tenant IDs usable as Pub/Sub attribute values and path segments
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// TenantRoute is the I/O of one tenant (hospital) of a multi-tenant deployment
+type TenantRoute struct {
+	InputBucket     string `json:"input_bucket"`
+	OutputBucket    string `json:"output_bucket"`
+	ResultTopicID   string `json:"result_topic_id"`
+	KMSKeyName      string `json:"kms_key_name,omitempty"`     // CMEK outputs are written with, projects/.../cryptoKeys/...
+	ImageCollection string `json:"image_collection,omitempty"` // Firestore collection of the tenant's image records, none kept without one
+	InputMountPath  string `json:"input_mount_path"`           // Mount of InputBucket
+	OutputMountPath string `json:"output_mount_path"`          // Mount of OutputBucket
+}
+
+// TenantConfig routes each request to the buckets, mounts, topic, KMS key and
+// Firestore collection of its tenant. Without routes the deployment is single-tenant.
+type TenantConfig struct {
+	RoutingFile string                 `env:"TENANT_ROUTING_FILE" doc:"JSON object of tenant ID to input_bucket, output_bucket, input_mount_path, output_mount_path, result_topic_id, kms_key_name, image_collection; requests must then name a known tenant"`
+	Routes      map[string]TenantRoute // Loaded from RoutingFile
+}
+
+// Enabled reports whether the deployment is multi-tenant
+func (c TenantConfig) Enabled() bool {
+	return len(c.Routes) > 0
+}
+
+func LoadTenantConfig() (TenantConfig, error) {
+	cfg := TenantConfig{RoutingFile: os.Getenv("TENANT_ROUTING_FILE")}
+	if cfg.RoutingFile == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(cfg.RoutingFile)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read TENANT_ROUTING_FILE: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg.Routes); err != nil {
+		return cfg, fmt.Errorf("invalid TENANT_ROUTING_FILE %s: %w", cfg.RoutingFile, err)
+	}
+	if err := validateTenantRoutes(cfg.Routes); err != nil {
+		return cfg, fmt.Errorf("invalid TENANT_ROUTING_FILE %s: %w", cfg.RoutingFile, err)
+	}
+	return cfg, nil
+}
+
+// validateTenantRoutes requires every route to be complete and no two tenants to
+// share a bucket, topic, collection or mount, so a routing mistake cannot mix the
+// data of two hospitals
+func validateTenantRoutes(routes map[string]TenantRoute) error {
+	if len(routes) == 0 {
+		return fmt.Errorf("no tenants defined")
+	}
+
+	tenants := make([]string, 0, len(routes))
+	for tenant := range routes {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	owners := make(map[string]string)
+	claim := func(tenant, kind, value string) error {
+		if value == "" {
+			return nil
+		}
+		key := kind + " " + value
+		if owner, ok := owners[key]; ok {
+			return fmt.Errorf("tenants %q and %q share %s", owner, tenant, key)
+		}
+		owners[key] = tenant
+		return nil
+	}
+
+	for _, tenant := range tenants {
+		route := routes[tenant]
+		if !tenantIDPattern.MatchString(tenant) {
+			return fmt.Errorf("invalid tenant ID %q", tenant)
+		}
+		switch {
+		case route.InputBucket == "":
+			return fmt.Errorf("tenant %q has no input_bucket", tenant)
+		case route.OutputBucket == "":
+			return fmt.Errorf("tenant %q has no output_bucket", tenant)
+		case route.ResultTopicID == "":
+			return fmt.Errorf("tenant %q has no result_topic_id", tenant)
+		// The default mounts are the buckets of the deployment, not of the tenant
+		case route.InputMountPath == "":
+			return fmt.Errorf("tenant %q has no input_mount_path", tenant)
+		case route.OutputMountPath == "":
+			return fmt.Errorf("tenant %q has no output_mount_path", tenant)
+		}
+		for _, resource := range []struct{ kind, value string }{
+			{"bucket", route.InputBucket},
+			{"bucket", route.OutputBucket},
+			{"topic", route.ResultTopicID},
+			{"collection", route.ImageCollection},
+			{"mount", route.InputMountPath},
+			{"mount", route.OutputMountPath},
+		} {
+			if err := claim(tenant, resource.kind, resource.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateTenantID checks the format of a tenant ID
+func ValidateTenantID(tenant string) error {
+	if !tenantIDPattern.MatchString(tenant) {
+		return fmt.Errorf("invalid tenant %q", tenant)
+	}
+	return nil
+}
+
+// ApplyTenant points the configuration at the buckets, mounts, topic, KMS key and image
+// collection of tenant; FIRESTORE_IMAGE_COLLECTION is not shared by tenants. A multi-tenant deployment requires a known tenant, a single-tenant one
+// rejects any tenant instead of silently using its own resources.
+func (c *Config) ApplyTenant(tenant string) error {
+	if !c.Tenants.Enabled() {
+		if tenant != "" {
+			return fmt.Errorf("request names tenant %q but no TENANT_ROUTING_FILE is configured", tenant)
+		}
+		return nil
+	}
+	if tenant == "" {
+		return fmt.Errorf("tenant is required by TENANT_ROUTING_FILE")
+	}
+	if err := ValidateTenantID(tenant); err != nil {
+		return err
+	}
+	route, ok := c.Tenants.Routes[tenant]
+	if !ok {
+		return fmt.Errorf("unknown tenant %q", tenant)
+	}
+
+	c.Tenant = tenant
+	c.GCP.InputBucketName = route.InputBucket
+	c.GCP.OutputBucketName = route.OutputBucket
+	c.GCP.KMSKeyName = route.KMSKeyName
+	c.ImageProcessingTopicID = route.ResultTopicID
+	c.Storage.InputMountPath = route.InputMountPath
+	c.Storage.OutputMountPath = route.OutputMountPath
+	c.Firestore.ImageCollection = route.ImageCollection
+	return nil
+}
+
+// TenantRoute returns the route of the applied tenant
+func (c *Config) TenantRoute() (TenantRoute, bool) {
+	if c.Tenant == "" {
+		return TenantRoute{}, false
+	}
+	route, ok := c.Tenants.Routes[c.Tenant]
+	return route, ok
+}
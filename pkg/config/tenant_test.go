@@ -0,0 +1,67 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func hospitalRoute(name string) TenantRoute {
+	return TenantRoute{
+		InputBucket:     name + "-original",
+		OutputBucket:    name + "-processed",
+		ResultTopicID:   name + "-results",
+		ImageCollection: name + "-images",
+		InputMountPath:  "/input/" + name,
+		OutputMountPath: "/output/" + name,
+	}
+}
+
+func TestValidateTenantRoutes(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		edit    func(route *TenantRoute)
+		wantErr string
+	}{
+		{name: "complete", edit: func(*TenantRoute) {}},
+		{name: "no input mount", edit: func(r *TenantRoute) { r.InputMountPath = "" }, wantErr: "no input_mount_path"},
+		{name: "no output mount", edit: func(r *TenantRoute) { r.OutputMountPath = "" }, wantErr: "no output_mount_path"},
+		{name: "shared mount", edit: func(r *TenantRoute) { r.OutputMountPath = "/output/hospital-a" }, wantErr: "share mount"},
+		{name: "shared collection", edit: func(r *TenantRoute) { r.ImageCollection = "hospital-a-images" }, wantErr: "share collection"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := hospitalRoute("hospital-b")
+			tc.edit(&b)
+			err := validateTenantRoutes(map[string]TenantRoute{"hospital-a": hospitalRoute("hospital-a"), "hospital-b": b})
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("validateTenantRoutes: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("validateTenantRoutes: %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyTenant(t *testing.T) {
+	cfg := &Config{
+		Tenants:   TenantConfig{Routes: map[string]TenantRoute{"hospital-a": hospitalRoute("hospital-a")}},
+		Storage:   StorageConfig{InputMountPath: "/gcs/default-original", OutputMountPath: "/gcs/default-processed"},
+		Firestore: FirestoreConfig{ImageCollection: "images"},
+	}
+	if err := cfg.ApplyTenant("hospital-a"); err != nil {
+		t.Fatalf("ApplyTenant: %v", err)
+	}
+	if cfg.Storage.InputMountPath != "/input/hospital-a" || cfg.Storage.OutputMountPath != "/output/hospital-a" {
+		t.Errorf("mounts = %s, %s, want the tenant's", cfg.Storage.InputMountPath, cfg.Storage.OutputMountPath)
+	}
+	if cfg.Firestore.ImageCollection != "hospital-a-images" {
+		t.Errorf("image collection = %s, want hospital-a-images", cfg.Firestore.ImageCollection)
+	}
+	if cfg.GCP.OutputBucketName != "hospital-a-processed" || cfg.ImageProcessingTopicID != "hospital-a-results" {
+		t.Errorf("bucket and topic = %s, %s, want the tenant's", cfg.GCP.OutputBucketName, cfg.ImageProcessingTopicID)
+	}
+
+	if err := cfg.ApplyTenant("hospital-b"); err == nil {
+		t.Errorf("ApplyTenant of an unknown tenant succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package container
+
+import (
+	"context"
+	"maps"
+	"runtime/debug"
+
+	"github.com/histopathai/image-processing-service/internal/domain/port"
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+// AttributeEnricher adds attributes to a message before it is published. It must keep
+// the attributes already set, by the publishing code or an earlier enricher.
+type AttributeEnricher func(ctx context.Context, topicID string, attributes map[string]string)
+
+// WithAttributeEnricher makes the container's publisher run enricher on every message,
+// after the deployment attributes
+func WithAttributeEnricher(enricher AttributeEnricher) Option {
+	return func(o *options) { o.enrichers = append(o.enrichers, enricher) }
+}
+
+// enrichedPublisher runs its enrichers on a copy of the attributes of every message
+type enrichedPublisher struct {
+	port.EventPublisher
+	enrichers []AttributeEnricher
+}
+
+func (p *enrichedPublisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	enriched := make(map[string]string, len(attributes)+4)
+	maps.Copy(enriched, attributes)
+	for _, enrich := range p.enrichers {
+		enrich(ctx, topicID, enriched)
+	}
+	return p.EventPublisher.Publish(ctx, topicID, data, enriched)
+}
+
+// DeploymentAttributes returns the enricher of the deployment a message comes from:
+// region, worker_type, pipeline_version (from pipelineVersion) and git_sha. Empty
+// values are left out.
+func DeploymentAttributes(cfg *config.Config, pipelineVersion func(ctx context.Context) string) AttributeEnricher {
+	gitSHA := cfg.PubSub.GitSHA
+	if gitSHA == "" {
+		gitSHA = buildRevision()
+	}
+	return func(ctx context.Context, topicID string, attributes map[string]string) {
+		setAttribute(attributes, "region", cfg.GCP.Region)
+		setAttribute(attributes, "worker_type", string(cfg.WorkerType))
+		setAttribute(attributes, "git_sha", gitSHA)
+		if pipelineVersion != nil {
+			if _, ok := attributes["pipeline_version"]; !ok {
+				setAttribute(attributes, "pipeline_version", pipelineVersion(ctx))
+			}
+		}
+	}
+}
+
+// setAttribute sets key to value unless key is set or value is empty
+func setAttribute(attributes map[string]string, key, value string) {
+	if _, ok := attributes[key]; ok || value == "" {
+		return
+	}
+	attributes[key] = value
+}
+
+// buildRevision is the VCS revision stamped into the binary, "" without one
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package container
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+)
+
+// NewPubSubClient creates a Pub/Sub client for the configured project, connected to
+// the emulator without credentials when PUBSUB_EMULATOR_HOST is set
+func NewPubSubClient(ctx context.Context, cfg *config.Config) (*pubsub.Client, error) {
+	var opts []option.ClientOption
+	if host := cfg.Emulator.PubSubHost; host != "" {
+		opts = append(opts,
+			option.WithEndpoint(host),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	}
+	return pubsub.NewClient(ctx, cfg.GCP.ProjectID, opts...)
+}
+
+// NewStorageClient creates a GCS client, connected to the emulator without
+// credentials when STORAGE_EMULATOR_HOST is set
+func NewStorageClient(ctx context.Context, cfg *config.Config) (*storage.Client, error) {
+	var opts []option.ClientOption
+	if host := cfg.Emulator.StorageHost; host != "" {
+		// The client derives both its JSON and XML API endpoints from the variable,
+		// which may not be in the environment when the config was built elsewhere
+		os.Setenv("STORAGE_EMULATOR_HOST", host)
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	return storage.NewClient(ctx, opts...)
+}
+
+// NewFirestoreClient creates a Firestore client for the configured project and
+// database, connected to the emulator without credentials when FIRESTORE_EMULATOR_HOST
+// is set
+func NewFirestoreClient(ctx context.Context, cfg *config.Config) (*firestore.Client, error) {
+	if host := cfg.Emulator.FirestoreHost; host != "" {
+		// The client only reads the emulator from the environment
+		os.Setenv("FIRESTORE_EMULATOR_HOST", host)
+	}
+	projectID := cfg.GCP.ProjectID
+	if projectID == "" {
+		projectID = firestore.DetectProjectID
+	}
+	return firestore.NewClientWithDatabase(ctx, projectID, cfg.Firestore.DatabaseID)
+}
+
+// AccessSecret reads the payload of a Secret Manager secret version
+// (projects/<p>/secrets/<s>/versions/<v>); a name without a version reads the latest
+func AccessSecret(ctx context.Context, name string) ([]byte, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	service, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version, err := service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if version.Payload == nil {
+		return nil, fmt.Errorf("secret version %s has no payload", name)
+	}
+	return base64.StdEncoding.DecodeString(version.Payload.Data)
+}
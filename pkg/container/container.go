@@ -2,18 +2,21 @@ package container
 
 import (
 	"context"
+	"io"
 	"log/slog"
 
-	"cloud.google.com/go/pubsub"
-	"cloud.google.com/go/storage"
 	"github.com/histopathai/image-processing-service/internal/domain/events"
 	"github.com/histopathai/image-processing-service/internal/domain/port"
 	InfraPubsub "github.com/histopathai/image-processing-service/internal/infrastructure/events/pubsub"
 	"github.com/histopathai/image-processing-service/internal/infrastructure/events/stdout"
+	InfraFirestore "github.com/histopathai/image-processing-service/internal/infrastructure/repository/firestore"
+	"github.com/histopathai/image-processing-service/internal/infrastructure/repository/jsondir"
 	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
 	"github.com/histopathai/image-processing-service/internal/service"
 	"github.com/histopathai/image-processing-service/pkg/config"
 	"github.com/histopathai/image-processing-service/pkg/errors"
+	"github.com/histopathai/image-processing-service/pkg/ratelimit"
+	"github.com/histopathai/image-processing-service/pkg/retry"
 )
 
 type Container struct {
@@ -24,14 +27,110 @@ type Container struct {
 	EventSerializer        events.EventSerializer
 	ImageProcessingService *service.ImageProcessingService
 	JobOrchestrator        *service.JobOrchestrator
+
+	inputStorage InfraStorage.InputStorage
+	firestore    io.Closer
+}
+
+// Option customizes the dependencies New wires up
+type Option func(*options)
+
+type options struct {
+	clock     port.Clock
+	ids       port.IDGenerator
+	processor service.ImageProcessor
+	storage   port.Storage
+	publisher port.EventPublisher
+	images    port.ImageRepository
+	heartbeat port.HeartbeatStore
+	observer  PublishObserver
+	enrichers []AttributeEnricher
+}
+
+// WithClock makes the service, the orchestrator and the event log of the stdout
+// publisher take timestamps from clock
+func WithClock(clock port.Clock) Option {
+	return func(o *options) { o.clock = clock }
+}
+
+// WithIDGenerator makes the service and orchestrator take event, content and
+// workspace IDs from ids
+func WithIDGenerator(ids port.IDGenerator) Option {
+	return func(o *options) { o.ids = ids }
+}
+
+// WithImageProcessor makes the orchestrator drive processor instead of the
+// ImageProcessingService, which is still built for the CLI
+func WithImageProcessor(processor service.ImageProcessor) Option {
+	return func(o *options) { o.processor = processor }
+}
+
+// WithOutputStorage makes the orchestrator upload outputs to storage instead of the
+// local filesystem or GCS
+func WithOutputStorage(storage port.Storage) Option {
+	return func(o *options) { o.storage = storage }
+}
+
+// WithPublisher makes the orchestrator publish events to publisher instead of
+// stdout or Pub/Sub
+func WithPublisher(publisher port.EventPublisher) Option {
+	return func(o *options) { o.publisher = publisher }
+}
+
+// WithImageRepository makes the orchestrator persist image statuses and results to
+// repository
+func WithImageRepository(repository port.ImageRepository) Option {
+	return func(o *options) { o.images = repository }
+}
+
+// WithHeartbeatStore makes the orchestrator write the heartbeats of its jobs to store
+// instead of HEARTBEAT_DIR
+func WithHeartbeatStore(store port.HeartbeatStore) Option {
+	return func(o *options) { o.heartbeat = store }
+}
+
+// PublishObserver is called with every message the container's publisher published
+type PublishObserver func(topicID string, data []byte, attributes map[string]string)
+
+// WithPublishObserver makes the container's publisher report every published message
+// to observer, after it was published to the configured (or injected) publisher
+func WithPublishObserver(observer PublishObserver) Option {
+	return func(o *options) { o.observer = observer }
+}
+
+// observedPublisher reports the messages its publisher published
+type observedPublisher struct {
+	port.EventPublisher
+	observe PublishObserver
+}
+
+func (p *observedPublisher) Publish(ctx context.Context, topicID string, data []byte, attributes map[string]string) error {
+	if err := p.EventPublisher.Publish(ctx, topicID, data, attributes); err != nil {
+		return err
+	}
+	p.observe(topicID, data, attributes)
+	return nil
 }
 
-func New(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*Container, error) {
+func New(ctx context.Context, cfg *config.Config, logger *slog.Logger, opts ...Option) (*Container, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	if cfg.Env == "" {
 		logger.Error("Environment not set in configuration")
 		return nil, errors.NewInternalError("environment not set in configuration")
 	}
+	// Without a repository no checksum is ever found, every duplicate would be processed again
+	if o.images == nil && !cfg.Firestore.Enabled() {
+		if cfg.Dedup.Enabled {
+			return nil, errors.NewConfigurationError("CHECKSUM_DEDUP needs an image repository, set FIRESTORE_IMAGE_COLLECTION")
+		}
+		if cfg.ContentAddress.Enabled {
+			return nil, errors.NewConfigurationError("CONTENT_ADDRESSED_OUTPUTS needs an image repository, set FIRESTORE_IMAGE_COLLECTION")
+		}
+	}
 	var publisher port.EventPublisher
 	var outputStorage port.Storage
 	var eventSerializer events.EventSerializer
@@ -39,49 +138,176 @@ func New(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*Contain
 	var jobOrchestrator *service.JobOrchestrator
 
 	if cfg.Env == config.EnvLocal {
-		logger.Info("Running in local environment")
-		publisher = stdout.NewPublisher(logger, cfg.Storage.OutputMountPath)
-
-		outputStorage = InfraStorage.NewLocalStorage(logger)
-		logger.Info("Using local storage service")
-
+		logger.Info("Running in local environment",
+			"storageEmulator", cfg.Emulator.StorageHost,
+			"pubsubEmulator", cfg.Emulator.PubSubHost)
 	} else {
 		logger.Info("Running in cloud environment")
+	}
+
+	// Injected storage or publishers are fakes with nothing to check
+	if cfg.Preflight && o.storage == nil && o.publisher == nil {
+		if err := Preflight(ctx, cfg, logger); err != nil {
+			return nil, err
+		}
+	}
 
-		pubsubClient, err := pubsub.NewClient(ctx, cfg.GCP.ProjectID)
+	retrier := retry.FromConfig(logger, cfg.Retry)
+	// Shared by the GCS client and the output mount, which write to the same bucket
+	pacer := ratelimit.FromConfig(logger, cfg.RateLimit)
+
+	// Local runs use the stdout publisher and the local filesystem unless emulators are configured
+	switch {
+	case o.publisher != nil:
+		publisher = o.publisher
+	case cfg.UsesPubSub():
+		pubsubClient, err := NewPubSubClient(ctx, cfg)
 		if err != nil {
 			logger.Error("Failed to create Pub/Sub client", "error", err)
 			return nil, errors.WrapInternalError(err, "failed to create pubsub client")
 		}
-		publisher = InfraPubsub.NewPublisher(pubsubClient, logger)
+		pubsubPublisher := InfraPubsub.NewPublisher(pubsubClient, logger, cfg.PubSub)
+		pubsubPublisher.SetRetrier(retrier)
+		publisher = pubsubPublisher
 		logger.Info("Using Pub/Sub publisher")
+	default:
+		stdoutPublisher := stdout.NewPublisher(logger, cfg.Storage.OutputMountPath)
+		if o.clock != nil {
+			stdoutPublisher.SetClock(o.clock)
+		}
+		if cfg.PubSub.EventLogPath != "" {
+			if err := stdoutPublisher.SetEventLog(cfg.PubSub.EventLogPath); err != nil {
+				return nil, errors.WrapConfigurationError(err, "failed to open event log").
+					WithContext("path", cfg.PubSub.EventLogPath)
+			}
+		}
+		publisher = stdoutPublisher
+	}
 
-		storageClient, err := storage.NewClient(ctx)
+	if o.observer != nil {
+		publisher = &observedPublisher{EventPublisher: publisher, observe: o.observer}
+	}
+	// Wraps the observer, which sees the attributes as published; the pipeline version
+	// enricher is added below, once the service it comes from exists
+	enriched := &enrichedPublisher{EventPublisher: publisher}
+	publisher = enriched
+
+	switch {
+	case o.storage != nil:
+		outputStorage = o.storage
+	case cfg.UsesGCS():
+		storageClient, err := NewStorageClient(ctx, cfg)
 		if err != nil {
 			logger.Error("Failed to create GCS client", "error", err)
 			return nil, errors.WrapInternalError(err, "failed to create GCS client")
 		}
-		outputStorage = InfraStorage.NewGCSStorage(logger, storageClient, cfg.GCP.OutputBucketName)
+		gcsStorage := InfraStorage.NewGCSStorage(logger, storageClient, cfg.GCP.OutputBucketName)
+		gcsStorage.SetRetrier(retrier)
+		gcsStorage.SetPacer(pacer)
+		gcsStorage.SetKMSKeyName(cfg.GCP.KMSKeyName)
+		outputStorage = gcsStorage
 		logger.Info("Using GCS storage service")
+	default:
+		outputStorage = InfraStorage.NewLocalStorage(logger)
+		logger.Info("Using local storage service")
 	}
 
-	eventSerializer = events.NewJSONEventSerializer()
+	serializer := events.NewJSONEventSerializer()
+	serializer.SetStrict(cfg.StrictEvents)
+	eventSerializer = serializer
+
+	// Reclaim scratch space left behind by crashed jobs before taking on new work
+	if cfg.Scratch.GCMaxAge > 0 {
+		if _, err := service.CollectScratch(logger, cfg.Scratch.Dir, cfg.Scratch.GCMaxAge, false); err != nil {
+			logger.Warn("Scratch garbage collection failed", "error", err)
+		}
+	}
 
 	// Create storage instances based on configuration
-	inputStorage := InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, logger)
+	inputStorage, err := newInputStorage(ctx, cfg, logger, retrier)
+	if err != nil {
+		return nil, err
+	}
 	outputMountStorage := InfraStorage.NewMountStorage(cfg.Storage.OutputMountPath, logger)
+	outputMountStorage.SetRetrier(retrier)
+	outputMountStorage.SetPacer(pacer)
+	outputMountStorage.SetParallelism(cfg.Storage.UploadParallelism)
+	if cfg.Storage.Checksums {
+		outputMountStorage.EnableChecksums()
+	}
 
 	imageProcessor = service.NewImageProcessingService(logger, cfg, inputStorage, outputMountStorage)
 
+	if cfg.PubSub.DeploymentAttributes {
+		enriched.enrichers = append(enriched.enrichers, DeploymentAttributes(cfg, imageProcessor.PipelineVersion))
+	}
+	enriched.enrichers = append(enriched.enrichers, o.enrichers...)
+
+	var processor service.ImageProcessor = imageProcessor
+	if o.processor != nil {
+		processor = o.processor
+	}
+
 	jobOrchestrator = service.NewJobOrchestrator(
 		logger,
 		cfg,
-		imageProcessor,
+		processor,
 		outputStorage,
 		publisher,
 		eventSerializer,
 	)
 
+	jobOrchestrator.SetInputStorage(inputStorage)
+
+	// Injected storage is a fake, there is nothing to mirror
+	if cfg.Replica.Enabled() && o.storage == nil {
+		replica, err := newReplicaStorage(ctx, cfg, logger, retrier)
+		if err != nil {
+			return nil, err
+		}
+		jobOrchestrator.SetReplicaStorage(replica)
+	}
+
+	if o.clock != nil {
+		imageProcessor.SetClock(o.clock)
+		jobOrchestrator.SetClock(o.clock)
+	}
+	if o.ids != nil {
+		imageProcessor.SetIDGenerator(o.ids)
+		jobOrchestrator.SetIDGenerator(o.ids)
+	}
+	images := o.images
+	var firestoreClient io.Closer
+	if images == nil && cfg.Firestore.Enabled() {
+		client, err := NewFirestoreClient(ctx, cfg)
+		if err != nil {
+			logger.Error("Failed to create Firestore client", "error", err)
+			return nil, errors.WrapInternalError(err, "failed to create Firestore client")
+		}
+		images = InfraFirestore.NewImageRepository(logger, client, cfg.Firestore.ImageCollection)
+		firestoreClient = client
+		logger.Info("Keeping image records in Firestore",
+			"database", cfg.Firestore.DatabaseID,
+			"collection", cfg.Firestore.ImageCollection)
+	}
+	if images != nil {
+		jobOrchestrator.SetImageRepository(images)
+	}
+
+	heartbeats := o.heartbeat
+	if heartbeats == nil && cfg.Heartbeat.Dir != "" {
+		heartbeats, err = jsondir.NewHeartbeatStore(cfg.Heartbeat.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if heartbeats != nil {
+		jobOrchestrator.SetHeartbeat(heartbeats, cfg.Heartbeat.WorkerID, cfg.Heartbeat.Interval)
+		logger.Info("Writing job heartbeats",
+			"workerID", cfg.Heartbeat.WorkerID,
+			"interval", cfg.Heartbeat.Interval)
+	}
+
 	logger.Info("Container initialized successfully")
 
 	return &Container{
@@ -92,17 +318,103 @@ func New(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*Contain
 		EventSerializer:        eventSerializer,
 		ImageProcessingService: imageProcessor,
 		JobOrchestrator:        jobOrchestrator,
+		inputStorage:           inputStorage,
+		firestore:              firestoreClient,
 	}, nil
 }
 
+// newInputStorage builds the storage originals are read from: the input mount, the
+// input bucket through the GCS API with INPUT_READER=gcs or an SFTP server with
+// INPUT_READER=sftp
+func newInputStorage(ctx context.Context, cfg *config.Config, logger *slog.Logger, retrier *retry.Retrier) (InfraStorage.InputStorage, error) {
+	if cfg.Storage.InputReader == config.InputReaderSFTP {
+		sftpInput, err := newSFTPInputStorage(ctx, cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Storage.Checksums {
+			sftpInput.EnableChecksums()
+		}
+		logger.Info("Reading inputs from SFTP server", "addr", cfg.SFTP.Addr(), "root", cfg.SFTP.Root)
+		return sftpInput, nil
+	}
+
+	if cfg.Storage.InputReader == config.InputReaderGCS {
+		storageClient, err := NewStorageClient(ctx, cfg)
+		if err != nil {
+			logger.Error("Failed to create GCS client", "error", err)
+			return nil, errors.WrapInternalError(err, "failed to create GCS client")
+		}
+		gcsInput := InfraStorage.NewGCSInputStorage(logger, storageClient, cfg.GCP.InputBucketName, cfg.Storage.InputMountPath)
+		if cfg.Storage.Checksums {
+			gcsInput.EnableChecksums()
+		}
+		logger.Info("Reading inputs through the GCS API", "bucket", cfg.GCP.InputBucketName)
+		return gcsInput, nil
+	}
+
+	mount := InfraStorage.NewMountStorage(cfg.Storage.InputMountPath, logger)
+	mount.SetRetrier(retrier)
+	if cfg.Storage.Checksums {
+		mount.EnableChecksums()
+	}
+	return mount, nil
+}
+
+// newReplicaStorage builds the destination outputs are mirrored to: a GCS bucket or a
+// mount
+func newReplicaStorage(ctx context.Context, cfg *config.Config, logger *slog.Logger, retrier *retry.Retrier) (port.Storage, error) {
+	if cfg.Replica.MountPath != "" {
+		mount := InfraStorage.NewMountStorage(cfg.Replica.MountPath, logger)
+		mount.SetRetrier(retrier)
+		mount.SetParallelism(cfg.Storage.UploadParallelism)
+		logger.Info("Mirroring outputs to replica mount", "path", cfg.Replica.MountPath)
+		return mount, nil
+	}
+
+	storageClient, err := NewStorageClient(ctx, cfg)
+	if err != nil {
+		logger.Error("Failed to create replica GCS client", "error", err)
+		return nil, errors.WrapInternalError(err, "failed to create replica GCS client")
+	}
+	gcsStorage := InfraStorage.NewGCSStorage(logger, storageClient, cfg.Replica.Bucket)
+	gcsStorage.SetRetrier(retrier)
+	gcsStorage.SetKMSKeyName(cfg.Replica.KMSKeyName)
+	logger.Info("Mirroring outputs to replica bucket", "bucket", cfg.Replica.Bucket)
+	return gcsStorage, nil
+}
+
 func (c *Container) Close() error {
 	c.Logger.Info("Closing container resources")
 
+	// Replica uploads still running in the background finish before the process exits
+	replicaErr := c.JobOrchestrator.WaitForReplicas()
+	if replicaErr != nil {
+		c.Logger.Error("Replica uploads failed", "error", replicaErr)
+	}
+
+	// Connections of the input storage (SFTP) are closed, a failure only matters to the server
+	if closer, ok := c.inputStorage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			c.Logger.Warn("Failed to close input storage", "error", err)
+		}
+	}
+
+	if c.firestore != nil {
+		if err := c.firestore.Close(); err != nil {
+			c.Logger.Warn("Failed to close Firestore client", "error", err)
+		}
+	}
+
 	if err := c.EventPublisher.Close(); err != nil {
 		c.Logger.Error("Failed to close event publisher", "error", err)
 		return errors.WrapInternalError(err, "failed to close event publisher")
 	}
 
+	if replicaErr != nil {
+		return errors.WrapStorageError(replicaErr, "replica uploads failed")
+	}
+
 	c.Logger.Info("Container resources closed successfully")
 	return nil
 }
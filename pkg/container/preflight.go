@@ -0,0 +1,160 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// preflightTimeout bounds each preflight operation so a missing credential does not
+// hang the job
+const preflightTimeout = 20 * time.Second
+
+// Preflight verifies with tiny operations that the job can do its I/O with the
+// identity it runs as: list the input mount and bucket, write and delete an object in
+// the output bucket (or a file on the output mount) and publish to the result topic.
+// IAM misconfigurations fail the job at startup with an error naming every missing
+// access, instead of after the image was processed.
+func Preflight(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	var failures []string
+	fail := func(resource string, err error) {
+		logger.Error("Preflight check failed", "resource", resource, "error", err)
+		failures = append(failures, fmt.Sprintf("%s: %v", resource, err))
+	}
+
+	// Inputs read from an SFTP server are not mounted
+	if cfg.Storage.InputReader != config.InputReaderSFTP {
+		if _, err := os.ReadDir(cfg.Storage.InputMountPath); err != nil {
+			fail("input mount "+cfg.Storage.InputMountPath, err)
+		}
+	}
+
+	if cfg.UsesGCS() {
+		if err := preflightBuckets(ctx, cfg, fail); err != nil {
+			fail("gcs client", err)
+		}
+	} else if err := probeDirWrite(cfg.Storage.OutputMountPath); err != nil {
+		fail("output mount "+cfg.Storage.OutputMountPath, err)
+	}
+
+	if cfg.UsesPubSub() {
+		if err := preflightTopics(ctx, cfg, fail); err != nil {
+			fail("pubsub client", err)
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.NewConfigurationError("startup preflight failed, check the IAM roles of the job service account").
+			WithContext("failures", failures)
+	}
+	logger.Info("Preflight checks passed")
+	return nil
+}
+
+func preflightBuckets(ctx context.Context, cfg *config.Config, fail func(string, error)) error {
+	client, err := NewStorageClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// The input is read through the mount; the bucket is listed only when it is named
+	if cfg.GCP.InputBucketName != "" {
+		checkCtx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		_, err := client.Bucket(cfg.GCP.InputBucketName).Objects(checkCtx, nil).Next()
+		cancel()
+		if err != nil && err != iterator.Done {
+			fail("input bucket "+cfg.GCP.InputBucketName, fmt.Errorf("cannot list objects: %w", err))
+		}
+	}
+
+	if cfg.GCP.OutputBucketName == "" {
+		fail("output bucket", fmt.Errorf("PROCESSED_BUCKET_NAME is not set"))
+	} else if err := ProbeBucketWrite(ctx, client.Bucket(cfg.GCP.OutputBucketName)); err != nil {
+		fail("output bucket "+cfg.GCP.OutputBucketName, err)
+	}
+	return nil
+}
+
+// preflightTopics tests the publish permission on the topics the job publishes to
+// without publishing anything subscribers would receive. The emulator has no IAM, so
+// there the topics only have to exist.
+func preflightTopics(ctx context.Context, cfg *config.Config, fail func(string, error)) error {
+	client, err := NewPubSubClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	topicIDs := []string{cfg.ImageProcessingTopicID}
+	if cfg.DeadLetter.MaxAttempts > 0 {
+		topicIDs = append(topicIDs, cfg.DeadLetter.TopicID)
+	}
+	for _, topicID := range topicIDs {
+		topic := client.Topic(topicID)
+		checkCtx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		if cfg.Emulator.PubSubHost != "" {
+			exists, err := topic.Exists(checkCtx)
+			if err == nil && !exists {
+				err = fmt.Errorf("topic does not exist")
+			}
+			if err != nil {
+				fail("pubsub topic "+topicID, err)
+			}
+		} else {
+			granted, err := topic.IAM().TestPermissions(checkCtx, []string{"pubsub.topics.publish"})
+			if err == nil && len(granted) == 0 {
+				err = fmt.Errorf("missing permission pubsub.topics.publish")
+			}
+			if err != nil {
+				fail("pubsub topic "+topicID, err)
+			}
+		}
+		cancel()
+	}
+	return nil
+}
+
+// ProbeBucketWrite writes and deletes a small object in the bucket
+func ProbeBucketWrite(ctx context.Context, bucket *storage.BucketHandle) error {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	object := bucket.Object(fmt.Sprintf(".himgproc-probe-%d", time.Now().UnixNano()))
+	w := object.NewWriter(ctx)
+	if _, err := w.Write([]byte("ok")); err != nil {
+		w.Close()
+		return fmt.Errorf("cannot write objects: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("cannot write objects: %w", err)
+	}
+	if err := object.Delete(ctx); err != nil {
+		return fmt.Errorf("wrote a probe object but cannot delete it: %w", err)
+	}
+	return nil
+}
+
+// probeDirWrite writes and removes a small file in dir
+func probeDirWrite(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	probe := filepath.Join(dir, fmt.Sprintf(".himgproc-probe-%d", time.Now().UnixNano()))
+	if err := os.WriteFile(probe, []byte("ok"), 0644); err != nil {
+		return fmt.Errorf("cannot write files: %w", err)
+	}
+	if err := os.Remove(probe); err != nil {
+		return fmt.Errorf("wrote a probe file but cannot remove it: %w", err)
+	}
+	return nil
+}
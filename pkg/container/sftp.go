@@ -0,0 +1,90 @@
+package container
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	InfraStorage "github.com/histopathai/image-processing-service/internal/infrastructure/storage"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// sftpDialTimeout bounds the TCP connect and SSH handshake with the server
+const sftpDialTimeout = 30 * time.Second
+
+// newSFTPInputStorage builds the input storage of INPUT_READER=sftp: the login is a
+// private key and/or password read from Secret Manager, and the server must present a
+// host key listed in its known_hosts lines
+func newSFTPInputStorage(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*InfraStorage.SFTPInputStorage, error) {
+	sftp := cfg.SFTP
+	secret := func(setting, name string) ([]byte, error) {
+		data, err := AccessSecret(ctx, name)
+		if err != nil {
+			return nil, errors.WrapConfigurationError(err, "failed to read secret").
+				WithContext("setting", setting).
+				WithContext("secret", name)
+		}
+		return data, nil
+	}
+
+	var auth []ssh.AuthMethod
+	if sftp.PrivateKeySecret != "" {
+		key, err := secret("SFTP_PRIVATE_KEY_SECRET", sftp.PrivateKeySecret)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.WrapConfigurationError(err, "invalid SFTP private key").
+				WithContext("secret", sftp.PrivateKeySecret)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if sftp.PasswordSecret != "" {
+		password, err := secret("SFTP_PASSWORD_SECRET", sftp.PasswordSecret)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.Password(strings.TrimRight(string(password), "\r\n")))
+	}
+
+	knownHostsFile := sftp.KnownHostsFile
+	if sftp.KnownHostsSecret != "" {
+		lines, err := secret("SFTP_KNOWN_HOSTS_SECRET", sftp.KnownHostsSecret)
+		if err != nil {
+			return nil, err
+		}
+		// knownhosts parses files only; the copy is read right away and removed
+		f, err := os.CreateTemp("", "sftp-known-hosts-")
+		if err != nil {
+			return nil, errors.WrapStorageError(err, "failed to write known_hosts")
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(lines)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, errors.WrapStorageError(err, "failed to write known_hosts")
+		}
+		knownHostsFile = f.Name()
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, errors.WrapConfigurationError(err, "invalid SFTP known_hosts")
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            sftp.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         sftpDialTimeout,
+	}
+	return InfraStorage.NewSFTPInputStorage(logger, sftp.Addr(), sshConfig, sftp.Root, cfg.Storage.InputMountPath), nil
+}
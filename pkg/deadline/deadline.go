@@ -0,0 +1,85 @@
+// Package deadline splits the time a job has before Cloud Run kills its container into
+// work time and a reserve. Processing runs under a context that ends when only the
+// reserve is left; cleanup and failure events run under Reserved, which outlives that
+// context and ends at the hard deadline, so a job that runs out of time still reports
+// why.
+package deadline
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// DefaultReserve bounds Reserved contexts of jobs without a budget
+const DefaultReserve = 30 * time.Second
+
+type budgetKey struct{}
+
+type budget struct {
+	hard    time.Time
+	reserve time.Duration
+}
+
+// WithBudget returns a context for the work of a job that must be finished by hard.
+// It is done reserve before hard; Reserved contexts derived from it last until hard.
+func WithBudget(parent context.Context, hard time.Time, reserve time.Duration) (context.Context, context.CancelFunc) {
+	ctx := context.WithValue(parent, budgetKey{}, budget{hard: hard, reserve: reserve})
+	return context.WithDeadline(ctx, hard.Add(-reserve))
+}
+
+// Reserved returns a context for cleanup and failure reporting that is not canceled
+// with ctx. It ends at the hard deadline of the budget of ctx, or after DefaultReserve
+// when ctx has no budget.
+func Reserved(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if b, ok := ctx.Value(budgetKey{}).(budget); ok {
+		return context.WithDeadline(detached, b.hard)
+	}
+	return context.WithTimeout(detached, DefaultReserve)
+}
+
+// Remaining is the work time left before the deadline of ctx, or -1 without one
+func Remaining(ctx context.Context) time.Duration {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return -1
+	}
+	return time.Until(d)
+}
+
+// Err returns the error of a done ctx as an AppError: a timeout when the deadline
+// passed, a cancellation otherwise. It returns nil while ctx is not done.
+func Err(ctx context.Context, op string) error {
+	err := ctx.Err()
+	switch {
+	case err == nil:
+		return nil
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return errors.WrapTimeoutError(err, op+" ran out of time")
+	default:
+		return errors.Wrap(err, errors.ErrorTypeCancellation, op+" canceled")
+	}
+}
+
+// Reader returns r with reads failing with Err once ctx is done, so long copies stop
+// at the deadline instead of running into the reserve
+func Reader(ctx context.Context, r io.Reader, op string) io.Reader {
+	return &reader{ctx: ctx, r: r, op: op}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	op  string
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if err := Err(r.ctx, r.op); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,248 @@
+// Package e2e runs a processing job end to end and checks what it produced: a
+// synthetic fixture slide is written to the input mount, processed through the real
+// container (storage, publisher and orchestrator as configured) and the uploaded
+// outputs and the published result event are checked. Locally the job writes to the
+// output directory and publishes to stdout or the emulators; with a cloud config it
+// uses the configured buckets and topics, so downstream teams can run the same checks
+// against their staging environment, from "himgproc e2e" or their own test binaries.
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/histopathai/image-processing-service/internal/domain/events"
+	"github.com/histopathai/image-processing-service/internal/domain/model"
+	"github.com/histopathai/image-processing-service/internal/domain/vobj"
+	"github.com/histopathai/image-processing-service/internal/testutil/fixture"
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/container"
+	"github.com/histopathai/image-processing-service/pkg/eventschema"
+)
+
+// Options describes the job the harness runs
+type Options struct {
+	ImageID           string // Default e2e-<unix time>
+	ProcessingVersion string // v1 (fs container) or v2 (zip container), default v2
+	Width             int    // Fixture width in pixels, default 2048
+	Height            int    // Fixture height in pixels, default 1536
+	Keep              bool   // Keep the fixture on the input mount
+
+	// ContainerOptions are passed on to container.New, e.g. an image repository
+	ContainerOptions []container.Option
+}
+
+func (o *Options) applyDefaults(now time.Time) error {
+	if o.ImageID == "" {
+		o.ImageID = fmt.Sprintf("e2e-%d", now.Unix())
+	}
+	if o.ProcessingVersion == "" {
+		o.ProcessingVersion = "v2"
+	}
+	if o.ProcessingVersion != "v1" && o.ProcessingVersion != "v2" {
+		return fmt.Errorf("invalid processing version %q, expected v1 or v2", o.ProcessingVersion)
+	}
+	if o.Width == 0 {
+		o.Width = 2048
+	}
+	if o.Height == 0 {
+		o.Height = 1536
+	}
+	return model.ValidateImageID(o.ImageID)
+}
+
+// Check is the outcome of one assertion
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Result is what a harness run checked
+type Result struct {
+	ImageID    string                            `json:"image_id"`
+	OutputDir  string                            `json:"output_dir,omitempty"`
+	DurationMs int64                             `json:"duration_ms"`
+	Event      *events.ImageProcessCompleteEvent `json:"event,omitempty"`
+	Checks     []Check                           `json:"checks"`
+}
+
+// OK reports whether every check passed
+func (r *Result) OK() bool {
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return len(r.Checks) > 0
+}
+
+func (r *Result) check(name string, ok bool, format string, args ...any) bool {
+	r.Checks = append(r.Checks, Check{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	return ok
+}
+
+// Run processes a fixture slide with cfg and checks the outputs and the result event.
+// cfg is not modified. Failed checks are reported in the result; the error is only
+// for a harness that could not run (fixture, config or container).
+func Run(ctx context.Context, cfg *config.Config, logger *slog.Logger, opts Options) (*Result, error) {
+	startedAt := time.Now()
+	if err := opts.applyDefaults(startedAt); err != nil {
+		return nil, err
+	}
+	jobCfg := *cfg
+	result := &Result{ImageID: opts.ImageID}
+
+	// The fixture is processed from the input mount like any original
+	originPath := path.Join(opts.ImageID, "fixture.tif")
+	fixturePath := filepath.Join(jobCfg.Storage.InputMountPath, filepath.FromSlash(originPath))
+	if err := os.MkdirAll(filepath.Dir(fixturePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	if _, err := fixture.Write(fixturePath, fixture.Options{
+		Width:    opts.Width,
+		Height:   opts.Height,
+		Compress: true,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write fixture slide: %w", err)
+	}
+	if !opts.Keep {
+		defer os.RemoveAll(filepath.Dir(fixturePath))
+	}
+
+	// Local runs write to the output mount directly, so point it at the image directory
+	if !jobCfg.UsesGCS() {
+		jobCfg.Storage.OutputMountPath = filepath.Join(cfg.Storage.OutputMountPath, opts.ImageID)
+	}
+
+	var mu sync.Mutex
+	var published [][]byte
+	observe := func(topicID string, data []byte, attributes map[string]string) {
+		if topicID != jobCfg.ImageProcessingTopicID ||
+			attributes["event_type"] != string(events.ImageProcessCompleteEventType) ||
+			attributes["image_id"] != opts.ImageID {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, append([]byte(nil), data...))
+	}
+
+	cnt, err := container.New(ctx, &jobCfg, logger,
+		append(opts.ContainerOptions, container.WithPublishObserver(observe))...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize container: %w", err)
+	}
+
+	bucket := jobCfg.GCP.InputBucketName
+	if bucket == "" {
+		bucket = "local"
+	}
+	input, err := model.NewJobInputFromEnv(opts.ImageID, originPath, opts.ProcessingVersion, bucket)
+	if err != nil {
+		cnt.Close()
+		return nil, fmt.Errorf("failed to create job input: %w", err)
+	}
+	input.Tenant = jobCfg.Tenant
+
+	jobErr := cnt.JobOrchestrator.ProcessJob(ctx, input)
+	// Flushes the publisher and waits for replica uploads
+	closeErr := cnt.Close()
+	result.DurationMs = time.Since(startedAt).Milliseconds()
+
+	result.check("job", jobErr == nil, "%v", errorOrOK(jobErr))
+	result.check("close", closeErr == nil, "%v", errorOrOK(closeErr))
+
+	if !result.check("result_event", len(published) == 1, "%d result events published", len(published)) {
+		return result, nil
+	}
+	data := published[0]
+	schemaErr := eventschema.Validate(string(events.ImageProcessCompleteEventType), data)
+	result.check("event_schema", schemaErr == nil, "%v", errorOrOK(schemaErr))
+
+	var event events.ImageProcessCompleteEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		result.check("event_decode", false, "%v", err)
+		return result, nil
+	}
+	result.Event = &event
+	if !result.check("event_success", event.Success && event.Status == vobj.StatusProcessed,
+		"success %t, status %q, failure %q", event.Success, event.Status, event.FailureReason) {
+		return result, nil
+	}
+	if event.Result != nil {
+		result.check("event_size", event.Result.Width == opts.Width && event.Result.Height == opts.Height,
+			"%dx%d, fixture %dx%d", event.Result.Width, event.Result.Height, opts.Width, opts.Height)
+	} else {
+		result.check("event_size", false, "no result in the event")
+	}
+
+	contents := make(map[string]string, len(event.Contents))
+	for _, content := range event.Contents {
+		contents[content.Name] = content.Path
+	}
+	required := []string{"image.dzi", "thumbnail.jpg"}
+	if opts.ProcessingVersion == "v2" {
+		required = append(required, "image.zip", "IndexMap.json")
+	}
+	var missing []string
+	for _, name := range required {
+		if _, ok := contents[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	result.check("event_contents", len(missing) == 0, "%d contents, missing %v", len(event.Contents), missing)
+	if event.Outputs != nil {
+		result.check("event_outputs", event.Outputs.DZI != "" && event.Outputs.Thumbnail != "",
+			"dzi %q, thumbnail %q", event.Outputs.DZI, event.Outputs.Thumbnail)
+	} else {
+		result.check("event_outputs", false, "no outputs in the event")
+	}
+
+	// The outputs are checked where the output mount sees them
+	dziPath, ok := contents["image.dzi"]
+	if !ok {
+		return result, nil
+	}
+	result.OutputDir = filepath.Dir(dziPath)
+	if jobCfg.UsesGCS() {
+		result.OutputDir = filepath.Join(jobCfg.Storage.OutputMountPath, result.OutputDir)
+	}
+	validation, err := cnt.ImageProcessingService.ValidateStored(ctx, result.OutputDir, true)
+	switch {
+	case err != nil:
+		result.check("outputs", false, "%v", err)
+	default:
+		result.check("outputs", validation.OK(),
+			"%d tiles decoded, %d missing, %d unexpected, %d corrupt, issues %v",
+			validation.TilesChecked, validation.MissingCount, validation.UnexpectedCount,
+			validation.CorruptCount, validation.Issues)
+	}
+
+	stamp, err := os.ReadFile(filepath.Join(result.OutputDir, "pipeline.json"))
+	var pipeline model.PipelineStamp
+	if err == nil {
+		err = json.Unmarshal(stamp, &pipeline)
+	}
+	if err != nil {
+		result.check("pipeline_stamp", false, "%v", err)
+	} else {
+		result.check("pipeline_stamp", pipeline.Version == event.PipelineVersion,
+			"pipeline.json %s, event %s", pipeline.Version, event.PipelineVersion)
+	}
+	return result, nil
+}
+
+func errorOrOK(err error) any {
+	if err != nil {
+		return err
+	}
+	return "ok"
+}
@@ -0,0 +1,90 @@
+package errors
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"google.golang.org/api/googleapi"
+)
+
+// quotaReasons are the GCS error reasons of rate limits and exhausted quotas
+var quotaReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+}
+
+// StorageErrorType classifies the cause of a storage failure: ErrorTypeDiskFull when a
+// disk or mount ran out of space or quota, ErrorTypeQuota when GCS rate limited the
+// request or was unavailable (429/503), ErrorTypeStorage otherwise. A cause that is
+// already classified keeps its type.
+func StorageErrorType(err error) ErrorType {
+	if HasType(err, ErrorTypeDiskFull) {
+		return ErrorTypeDiskFull
+	}
+	if HasType(err, ErrorTypeQuota) {
+		return ErrorTypeQuota
+	}
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return ErrorTypeDiskFull
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Code == http.StatusTooManyRequests || apiErr.Code == http.StatusServiceUnavailable {
+			return ErrorTypeQuota
+		}
+		for _, item := range apiErr.Errors {
+			if quotaReasons[item.Reason] {
+				return ErrorTypeQuota
+			}
+		}
+	}
+	return ErrorTypeStorage
+}
+
+// IsDiskFullOutput reports whether the output of an external command says it ran out
+// of disk space
+func IsDiskFullOutput(output string) bool {
+	return strings.Contains(output, "No space left on device") || strings.Contains(output, "Disk quota exceeded")
+}
+
+// HasType reports whether err or any error it wraps is an AppError of errType. Unlike
+// Is, which only looks at the outermost AppError, it finds a cause wrapped by a
+// different type.
+func HasType(err error, errType ErrorType) bool {
+	for err != nil {
+		var appErr *AppError
+		if !errors.As(err, &appErr) {
+			return false
+		}
+		if appErr.Type == errType {
+			return true
+		}
+		err = appErr.Err
+	}
+	return false
+}
+
+// Chain returns the AppErrors of err, from the outermost to the root cause
+func Chain(err error) []*AppError {
+	var chain []*AppError
+	for err != nil {
+		var appErr *AppError
+		if !errors.As(err, &appErr) {
+			break
+		}
+		chain = append(chain, appErr)
+		err = appErr.Err
+	}
+	return chain
+}
+
+// IsResourceExhausted reports whether err was caused by a full disk or an exhausted
+// quota. Such errors are retryable, but only after a longer delay than other
+// transient failures.
+func IsResourceExhausted(err error) bool {
+	return HasType(err, ErrorTypeDiskFull) || HasType(err, ErrorTypeQuota)
+}
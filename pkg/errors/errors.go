@@ -13,11 +13,14 @@ const (
 	ErrorTypeValidation    ErrorType = "validation_error"
 	ErrorTypeNotFound      ErrorType = "not_found"
 	ErrorTypeAlreadyExists ErrorType = "already_exists"
+	ErrorTypeCorruptInput  ErrorType = "corrupt_input" // The input cannot be opened or read (truncated or corrupt upload)
 
 	// Infrastructure errors
 	ErrorTypeStorage   ErrorType = "storage_error"
 	ErrorTypeMessaging ErrorType = "messaging_error"
 	ErrorTypeExternal  ErrorType = "external_service_error"
+	ErrorTypeDiskFull  ErrorType = "disk_full_error" // No space left on the scratch disk or a mount
+	ErrorTypeQuota     ErrorType = "quota_error"     // Rate limited or over quota (HTTP 429/503)
 
 	// Processing errors
 	ErrorTypeProcessing   ErrorType = "processing_error"
@@ -125,13 +128,20 @@ func NewAlreadyExistsError(resource string) *AppError {
 	return New(ErrorTypeAlreadyExists, fmt.Sprintf("%s already exists", resource))
 }
 
+// Corrupt input errors
+func WrapCorruptInputError(err error, message string) *AppError {
+	return Wrap(err, ErrorTypeCorruptInput, message)
+}
+
 // Storage errors
 func NewStorageError(message string) *AppError {
 	return New(ErrorTypeStorage, message)
 }
 
+// WrapStorageError wraps a storage failure; disk-full and quota causes keep their own
+// type (see StorageErrorType) so they are retried with a longer delay
 func WrapStorageError(err error, message string) *AppError {
-	return Wrap(err, ErrorTypeStorage, message)
+	return Wrap(err, StorageErrorType(err), message)
 }
 
 // Messaging errors
@@ -189,12 +199,15 @@ func IsNonRetryable(err error) bool {
 	case ErrorTypeValidation,
 		ErrorTypeNotFound,
 		ErrorTypeAlreadyExists,
+		ErrorTypeCorruptInput,
 		ErrorTypeProcessing,
 		ErrorTypeConfiguration,
 		ErrorTypeInternal:
 		return true
 
 	case ErrorTypeStorage,
+		ErrorTypeDiskFull,
+		ErrorTypeQuota,
 		ErrorTypeMessaging,
 		ErrorTypeExternal,
 		ErrorTypeTimeout:
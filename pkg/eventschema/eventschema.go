@@ -0,0 +1,121 @@
+// Package eventschema holds the JSON Schemas (draft 2020-12) of the events this
+// service consumes and publishes, and validates payloads against them. The schemas
+// are the contract with the services on the other side of the topics: they can
+// import this package, or read the files under schemas/ (also printed by
+// "himgproc schema"), and run their contract tests against the same definitions.
+//
+// Validate implements the subset of JSON Schema the bundled schemas use: type, enum,
+// const, properties, required, additionalProperties, items, minItems, minimum,
+// minLength, pattern, format (date-time), if/then and local $ref.
+package eventschema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed schemas/*.json
+var files embed.FS
+
+// FS returns the schema files, named <event_type>.json
+func FS() fs.FS {
+	sub, _ := fs.Sub(files, "schemas")
+	return sub
+}
+
+// Types returns the event types with a schema, sorted
+func Types() []string {
+	entries, _ := fs.ReadDir(FS(), ".")
+	types := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		types = append(types, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Schema returns the schema document of eventType
+func Schema(eventType string) ([]byte, error) {
+	data, err := fs.ReadFile(FS(), eventType+".json")
+	if err != nil {
+		return nil, fmt.Errorf("no schema for event type %q", eventType)
+	}
+	return data, nil
+}
+
+// Error lists the schema violations of a payload
+type Error struct {
+	EventType  string
+	Violations []string // "<json pointer>: <problem>"
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s event does not match its schema: %s", e.EventType, strings.Join(e.Violations, "; "))
+}
+
+var (
+	compiledMu sync.Mutex
+	compiled   = make(map[string]*schema)
+)
+
+// Validate checks the JSON payload data against the schema of eventType. It returns an
+// *Error when the payload does not match.
+func Validate(eventType string, data []byte) error {
+	s, err := load(eventType)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var instance any
+	if err := dec.Decode(&instance); err != nil {
+		return &Error{EventType: eventType, Violations: []string{"invalid JSON: " + err.Error()}}
+	}
+
+	v := &validator{root: s}
+	v.validate(s.doc, instance, "")
+	if len(v.violations) > 0 {
+		return &Error{EventType: eventType, Violations: v.violations}
+	}
+	return nil
+}
+
+// ValidateEvent is Validate with the event type read from the payload's event_type
+func ValidateEvent(data []byte) error {
+	var header struct {
+		EventType string `json:"event_type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("invalid event payload: %w", err)
+	}
+	if header.EventType == "" {
+		return fmt.Errorf("event payload has no event_type")
+	}
+	return Validate(header.EventType, data)
+}
+
+func load(eventType string) (*schema, error) {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+	if s, ok := compiled[eventType]; ok {
+		return s, nil
+	}
+
+	data, err := Schema(eventType)
+	if err != nil {
+		return nil, err
+	}
+	s, err := compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema for %s: %w", eventType, err)
+	}
+	compiled[eventType] = s
+	return s, nil
+}
@@ -0,0 +1,289 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// knownKeywords are the keywords a schema may use; anything else is rejected when the
+// schema is compiled rather than silently ignored
+var knownKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$defs": true, "$ref": true, "$comment": true,
+	"title": true, "description": true,
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true,
+	"minimum": true, "maximum": true, "minLength": true, "pattern": true, "format": true,
+	"if": true, "then": true,
+}
+
+// schema is a compiled schema document
+type schema struct {
+	doc      map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+func compile(data []byte) (*schema, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	s := &schema{doc: doc, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.check(doc, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// check rejects unknown keywords and broken references, and compiles the patterns
+func (s *schema) check(node map[string]any, at string) error {
+	for keyword, value := range node {
+		if !knownKeywords[keyword] {
+			return fmt.Errorf("%s: unsupported keyword %q", at, keyword)
+		}
+		switch keyword {
+		case "$ref":
+			if _, err := s.resolve(value.(string)); err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+		case "pattern":
+			re, err := regexp.Compile(value.(string))
+			if err != nil {
+				return fmt.Errorf("%s: %w", at, err)
+			}
+			s.patterns[value.(string)] = re
+		case "$defs", "properties":
+			for name, sub := range value.(map[string]any) {
+				if err := s.check(sub.(map[string]any), at+"/"+keyword+"/"+name); err != nil {
+					return err
+				}
+			}
+		case "items", "if", "then", "additionalProperties":
+			if sub, ok := value.(map[string]any); ok {
+				if err := s.check(sub, at+"/"+keyword); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolve looks up a local reference of the form #/$defs/<name>
+func (s *schema) resolve(ref string) (map[string]any, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("only local #/$defs references are supported, got %q", ref)
+	}
+	defs, _ := s.doc["$defs"].(map[string]any)
+	def, ok := defs[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("undefined reference %q", ref)
+	}
+	return def, nil
+}
+
+type validator struct {
+	root       *schema
+	violations []string
+}
+
+func (v *validator) fail(at, format string, args ...any) {
+	if at == "" {
+		at = "/"
+	}
+	v.violations = append(v.violations, at+": "+fmt.Sprintf(format, args...))
+}
+
+// validate checks instance (decoded with UseNumber) against node; at is the JSON
+// pointer of instance
+func (v *validator) validate(node map[string]any, instance any, at string) {
+	if ref, ok := node["$ref"].(string); ok {
+		def, _ := v.root.resolve(ref)
+		v.validate(def, instance, at)
+	}
+
+	if t, ok := node["type"]; ok && !matchesType(t, instance) {
+		v.fail(at, "expected %s, got %s", typeNames(t), jsonType(instance))
+		return
+	}
+	if enum, ok := node["enum"].([]any); ok && !containsValue(enum, instance) {
+		v.fail(at, "%s is not one of %s", render(instance), render(enum))
+	}
+	if c, ok := node["const"]; ok && !equalValues(c, instance) {
+		v.fail(at, "expected %s, got %s", render(c), render(instance))
+	}
+
+	switch value := instance.(type) {
+	case map[string]any:
+		v.validateObject(node, value, at)
+	case []any:
+		if min, ok := node["minItems"].(float64); ok && float64(len(value)) < min {
+			v.fail(at, "expected at least %d items, got %d", int(min), len(value))
+		}
+		if items, ok := node["items"].(map[string]any); ok {
+			for i, item := range value {
+				v.validate(items, item, at+"/"+strconv.Itoa(i))
+			}
+		}
+	case string:
+		if min, ok := node["minLength"].(float64); ok && float64(utf8.RuneCountInString(value)) < min {
+			v.fail(at, "expected at least %d characters", int(min))
+		}
+		if pattern, ok := node["pattern"].(string); ok && !v.root.patterns[pattern].MatchString(value) {
+			v.fail(at, "%q does not match %s", value, pattern)
+		}
+		if node["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				v.fail(at, "%q is not an RFC 3339 date-time", value)
+			}
+		}
+	case json.Number:
+		if min, ok := node["minimum"].(float64); ok {
+			if f, err := value.Float64(); err == nil && f < min {
+				v.fail(at, "%s is less than %v", value, min)
+			}
+		}
+		if max, ok := node["maximum"].(float64); ok {
+			if f, err := value.Float64(); err == nil && f > max {
+				v.fail(at, "%s is greater than %v", value, max)
+			}
+		}
+	}
+
+	if cond, ok := node["if"].(map[string]any); ok {
+		probe := &validator{root: v.root}
+		probe.validate(cond, instance, at)
+		if then, ok := node["then"].(map[string]any); ok && len(probe.violations) == 0 {
+			v.validate(then, instance, at)
+		}
+	}
+}
+
+func (v *validator) validateObject(node map[string]any, object map[string]any, at string) {
+	if required, ok := node["required"].([]any); ok {
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				v.fail(at, "missing required property %q", name)
+			}
+		}
+	}
+
+	properties, _ := node["properties"].(map[string]any)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		at := at + "/" + name
+		if sub, ok := properties[name].(map[string]any); ok {
+			v.validate(sub, object[name], at)
+			continue
+		}
+		switch additional := node["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(at, "unexpected property")
+			}
+		case map[string]any:
+			v.validate(additional, object[name], at)
+		}
+	}
+}
+
+func matchesType(t any, instance any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, instance)
+	case []any:
+		for _, name := range t {
+			if isType(name.(string), instance) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, instance any) bool {
+	switch name {
+	case "integer":
+		n, ok := instance.(json.Number)
+		if !ok {
+			return false
+		}
+		f, ok := new(big.Float).SetString(n.String())
+		return ok && f.IsInt()
+	case "number":
+		_, ok := instance.(json.Number)
+		return ok
+	default:
+		return jsonType(instance) == name
+	}
+}
+
+func jsonType(instance any) string {
+	switch instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", instance)
+	}
+}
+
+func typeNames(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, len(list))
+		for i, name := range list {
+			names[i] = name.(string)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func containsValue(values []any, instance any) bool {
+	for _, value := range values {
+		if equalValues(value, instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalValues compares a schema value (numbers decoded as float64) with an instance
+// value (numbers decoded as json.Number)
+func equalValues(schemaValue, instance any) bool {
+	if n, ok := instance.(json.Number); ok {
+		f, err := n.Float64()
+		return err == nil && schemaValue == f
+	}
+	return reflect.DeepEqual(schemaValue, instance)
+}
+
+func render(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
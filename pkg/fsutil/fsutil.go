@@ -0,0 +1,156 @@
+// Package fsutil copies streams, files and directory trees for the storages and the
+// service. Copies go through pooled 1 MB buffers, so the many small tile copies of a
+// job do not each allocate their own, stop mid-file once the context is done (with the
+// timeout or cancellation error of pkg/deadline), can report their progress and keep
+// the mode of the files they copy.
+package fsutil
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+)
+
+// BufferSize is large enough to keep GCS FUSE and GCS writer calls few per file
+const BufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, BufferSize)
+		return &buf
+	},
+}
+
+// Options tune a copy. The zero value is a plain copy.
+type Options struct {
+	// Op names the copy in the error of a copy stopped by the context, e.g. "input copy"
+	Op string
+	// Progress is called after every write with the bytes copied so far (of the current
+	// file for CopyFile and WriteFile, of the whole tree for CopyDir)
+	Progress func(copied int64)
+}
+
+func (o Options) op() string {
+	if o.Op == "" {
+		return "copy"
+	}
+	return o.Op
+}
+
+// progressWriter counts the bytes written and reports them. It also hides the
+// ReaderFrom of the destination, which would bypass the pooled buffer.
+type progressWriter struct {
+	w        io.Writer
+	progress func(int64)
+	base     int64
+	copied   int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.copied += int64(n)
+	if w.progress != nil {
+		w.progress(w.base + w.copied)
+	}
+	return n, err
+}
+
+// Copy copies src to dst through a pooled buffer and returns the bytes copied. Once
+// ctx is done the copy stops with deadline.Err.
+func Copy(ctx context.Context, dst io.Writer, src io.Reader, opts Options) (int64, error) {
+	return copyFrom(ctx, dst, src, opts, 0)
+}
+
+func copyFrom(ctx context.Context, dst io.Writer, src io.Reader, opts Options, base int64) (int64, error) {
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
+
+	w := &progressWriter{w: dst, progress: opts.Progress, base: base}
+	_, err := io.CopyBuffer(w, deadline.Reader(ctx, src, opts.op()), *buf)
+	if err != nil {
+		if ctxErr := deadline.Err(ctx, opts.op()); ctxErr != nil {
+			return w.copied, ctxErr
+		}
+	}
+	return w.copied, err
+}
+
+// WriteFile writes what r yields to the file at path with perm, creating its directory
+func WriteFile(ctx context.Context, path string, r io.Reader, perm fs.FileMode, opts Options) (int64, error) {
+	return writeFile(ctx, path, r, perm, opts, 0)
+}
+
+func writeFile(ctx context.Context, path string, r io.Reader, perm fs.FileMode, opts Options, base int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := copyFrom(ctx, out, r, opts, base)
+	if err != nil {
+		out.Close()
+		return n, err
+	}
+	return n, out.Close()
+}
+
+// CopyFile copies the file src to dst, creating the directory of dst. dst gets the
+// permissions of src.
+func CopyFile(ctx context.Context, src, dst string, opts Options) (int64, error) {
+	return copyFile(ctx, src, dst, opts, 0)
+}
+
+func copyFile(ctx context.Context, src, dst string, opts Options, base int64) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return writeFile(ctx, dst, in, info.Mode().Perm(), opts, base)
+}
+
+// CopyDir copies the tree below srcDir to dstDir, keeping the permissions of files
+// and directories, and returns the bytes copied
+func CopyDir(ctx context.Context, srcDir, dstDir string, opts Options) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := deadline.Err(ctx, opts.op()); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dstDir, rel)
+
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(dst, info.Mode().Perm())
+		}
+
+		n, err := copyFile(ctx, path, dst, opts, total)
+		total += n
+		return err
+	})
+	return total, err
+}
@@ -0,0 +1,81 @@
+// Package imagehash computes perceptual hashes of tiles. The hash of a picture stays
+// within a few bits when it is encoded by another encoder or at another quality,
+// while a shifted, flipped or miscolored picture differs in far more.
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// DefaultMaxDistance is the Hamming distance between tile hashes that is still a match.
+// It absorbs encoder noise across vips and libjpeg versions.
+const DefaultMaxDistance = 6
+
+// DHash is the 64-bit difference hash of img: the image is reduced to 9x8 gray cells
+// by area averaging, and each bit records whether a cell is brighter than its right
+// neighbour
+func DHash(img image.Image) uint64 {
+	const cols, rows = 9, 8
+	b := img.Bounds()
+	var gray [rows][cols]float64
+	for cy := 0; cy < rows; cy++ {
+		y0, y1 := span(b.Min.Y, b.Dy(), cy, rows)
+		for cx := 0; cx < cols; cx++ {
+			x0, x1 := span(b.Min.X, b.Dx(), cx, cols)
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+				}
+			}
+			gray[cy][cx] = sum / float64((x1-x0)*(y1-y0))
+		}
+	}
+
+	var hash uint64
+	for cy := 0; cy < rows; cy++ {
+		for cx := 0; cx < cols-1; cx++ {
+			hash <<= 1
+			if gray[cy][cx] > gray[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// span is the pixel range of cell i out of n along an axis of length size; cells of
+// images smaller than n pixels reuse the nearest pixel
+func span(origin, size, i, n int) (int, int) {
+	start := i * size / n
+	end := (i + 1) * size / n
+	if end <= start {
+		end = start + 1
+	}
+	if end > size {
+		start, end = size-1, size
+	}
+	return origin + start, origin + end
+}
+
+// Format writes a hash as 16 hex digits, the form manifests and reports store
+func Format(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// Distance is the number of bits two hex hashes (see Format) differ in
+func Distance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q", a)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash %q", b)
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
@@ -8,9 +8,12 @@ import (
 type Config struct {
 	Level  string // debug, info, warn, error
 	Format string // json, text
+
+	RedactKeys []string // Redacted in addition to DefaultRedactKeys and LOG_REDACT_KEYS
 }
 
-// New creates a new structured logger
+// New creates a new structured logger. Sensitive attributes are redacted before
+// either format is written (see RedactingHandler).
 func New(cfg Config) *slog.Logger {
 	level := parseLevel(cfg.Level)
 
@@ -26,7 +29,7 @@ func New(cfg Config) *slog.Logger {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(NewRedactingHandler(handler, redactKeys(cfg.RedactKeys)))
 }
 
 func parseLevel(level string) slog.Level {
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// RedactedValue replaces the value of a sensitive attribute
+const RedactedValue = "[REDACTED]"
+
+// RedactKeysEnv lists attribute keys redacted in addition to DefaultRedactKeys,
+// comma separated
+const RedactKeysEnv = "LOG_REDACT_KEYS"
+
+// DefaultRedactKeys are the credential and patient identifier keys that are never
+// logged. Keys match case-insensitively, "-" and "_" alike.
+var DefaultRedactKeys = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "authorization",
+	"api_key", "private_key", "credentials", "signature",
+	"patient_id", "patient_name", "patient_birth_date", "mrn", "accession_number",
+}
+
+// ParseKeys splits a comma separated key list
+func ParseKeys(value string) []string {
+	var keys []string
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RedactingHandler replaces the values of sensitive attributes before the wrapped
+// handler sees them. Groups and map values (event attributes, the Context of an
+// errors.AppError) are searched as well.
+type RedactingHandler struct {
+	next slog.Handler
+	keys map[string]struct{}
+}
+
+// NewRedactingHandler wraps next so attributes named by keys are redacted
+func NewRedactingHandler(next slog.Handler, keys []string) *RedactingHandler {
+	set := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		set[normalizeKey(key)] = struct{}{}
+	}
+	return &RedactingHandler{next: next, keys: set}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted), keys: h.keys}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name), keys: h.keys}
+}
+
+func (h *RedactingHandler) sensitive(key string) bool {
+	_, ok := h.keys[normalizeKey(key)]
+	return ok
+}
+
+func (h *RedactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if h.sensitive(attr.Key) {
+		return slog.String(attr.Key, RedactedValue)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, member := range group {
+			redacted[i] = h.redactAttr(member)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+	case slog.KindAny:
+		return slog.Any(attr.Key, h.redactAny(value.Any()))
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// redactAny returns a copy of maps with sensitive entries redacted; other values are
+// returned as they are
+func (h *RedactingHandler) redactAny(value any) any {
+	switch v := value.(type) {
+	case map[string]string:
+		if !h.anySensitive(v) {
+			return v
+		}
+		redacted := make(map[string]string, len(v))
+		for key, val := range v {
+			if h.sensitive(key) {
+				val = RedactedValue
+			}
+			redacted[key] = val
+		}
+		return redacted
+	case map[string]any:
+		if !h.anySensitive(v) {
+			return v
+		}
+		redacted := make(map[string]any, len(v))
+		for key, val := range v {
+			if h.sensitive(key) {
+				redacted[key] = RedactedValue
+			} else {
+				redacted[key] = h.redactAny(val)
+			}
+		}
+		return redacted
+	}
+	return value
+}
+
+func (h *RedactingHandler) anySensitive(m any) bool {
+	switch v := m.(type) {
+	case map[string]string:
+		for key := range v {
+			if h.sensitive(key) {
+				return true
+			}
+		}
+	case map[string]any:
+		for key, val := range v {
+			if h.sensitive(key) || h.anySensitive(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RedactMap returns a copy of m with the entries named by DefaultRedactKeys, configured
+// and LOG_REDACT_KEYS redacted, for maps that leave the service outside of logs
+func RedactMap(m map[string]any, configured []string) map[string]any {
+	h := NewRedactingHandler(nil, redactKeys(configured))
+	redacted, _ := h.redactAny(m).(map[string]any)
+	return redacted
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+}
+
+// redactKeys combines DefaultRedactKeys, the configured keys and LOG_REDACT_KEYS
+func redactKeys(configured []string) []string {
+	keys := append([]string{}, DefaultRedactKeys...)
+	keys = append(keys, configured...)
+	return append(keys, ParseKeys(os.Getenv(RedactKeysEnv))...)
+}
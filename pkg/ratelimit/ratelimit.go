@@ -0,0 +1,105 @@
+// Package ratelimit paces object writes to GCS. Every write waits for a token of a
+// shared limiter; a quota error (429/503) halves the rate and successful writes raise
+// it back step by step, so a worker backs off while the bucket is over its write quota
+// instead of failing the job.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// recoverAfter is the number of successful writes after which the rate is raised
+// again by a tenth of the configured rate
+const recoverAfter = 50
+
+// Pacer limits the rate of writes. A nil Pacer lets every write through.
+type Pacer struct {
+	logger    *slog.Logger
+	limiter   *rate.Limiter
+	max       rate.Limit
+	min       rate.Limit
+	mu        sync.Mutex
+	successes int
+}
+
+// New creates a pacer allowing opsPerSecond writes with bursts of burst, lowered to no
+// less than minOpsPerSecond on quota errors
+func New(logger *slog.Logger, opsPerSecond float64, burst int, minOpsPerSecond float64) *Pacer {
+	return &Pacer{
+		logger:  logger,
+		limiter: rate.NewLimiter(rate.Limit(opsPerSecond), max(burst, 1)),
+		max:     rate.Limit(opsPerSecond),
+		min:     rate.Limit(min(minOpsPerSecond, opsPerSecond)),
+	}
+}
+
+// FromConfig creates a pacer from the GCS_WRITE_* settings, nil when pacing is disabled
+func FromConfig(logger *slog.Logger, cfg config.RateLimitConfig) *Pacer {
+	if cfg.WriteOpsPerSecond <= 0 {
+		return nil
+	}
+	return New(logger, cfg.WriteOpsPerSecond, cfg.WriteBurst, cfg.MinWriteOpsPerSecond)
+}
+
+// Wait blocks until a write may start or ctx is done
+func (p *Pacer) Wait(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), errors.ErrorTypeCancellation, "write canceled while rate limited")
+		}
+		return errors.Wrap(err, errors.ErrorTypeTimeout, "no time left to wait for the write rate limit")
+	}
+	return nil
+}
+
+// Observe adapts the rate to the outcome of a write: quota errors halve it, every
+// recoverAfter successes raise it towards the configured rate
+func (p *Pacer) Observe(err error) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := p.limiter.Limit()
+	switch {
+	case err == nil:
+		p.successes++
+		if p.successes < recoverAfter || current >= p.max {
+			return
+		}
+		p.successes = 0
+		p.limiter.SetLimit(min(current+p.max/10, p.max))
+	case errors.HasType(err, errors.ErrorTypeQuota):
+		p.successes = 0
+		lowered := max(current/2, p.min)
+		if lowered == current {
+			return
+		}
+		p.limiter.SetLimit(lowered)
+		p.logger.Warn("Write quota exceeded, lowering write rate",
+			"opsPerSecond", float64(lowered),
+			"previous", float64(current))
+	}
+}
+
+// Do waits for the limiter, runs fn and observes its outcome
+func (p *Pacer) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := p.Wait(ctx); err != nil {
+		return err
+	}
+	err := fn(ctx)
+	p.Observe(err)
+	return err
+}
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Budget bounds the retries of a whole job, shared by every Retrier the job's context
+// reaches: input copies, commands, uploads and publishes. Each retrier stays within
+// its own policy, the budget keeps flaky dependencies in different phases from adding
+// up to an unbounded job. Safe for concurrent use (parallel uploads share it).
+type Budget struct {
+	maxRetries int           // Retries of the job, 0 for no limit
+	maxTime    time.Duration // Time spent waiting for and running retries, 0 for no limit
+
+	mu        sync.Mutex
+	retries   int
+	spent     time.Duration
+	exhausted bool
+}
+
+// NewBudget creates a budget of maxRetries retries and maxTime of retry time; zero
+// leaves the respective limit off
+func NewBudget(maxRetries int, maxTime time.Duration) *Budget {
+	return &Budget{maxRetries: maxRetries, maxTime: maxTime}
+}
+
+// take claims a retry that waits delay first. It fails once the retries are used up or
+// the delay would pass the time left; the first failure is reported as exhausted.
+func (b *Budget) take(delay time.Duration) (ok, exhausted bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if (b.maxRetries > 0 && b.retries >= b.maxRetries) || (b.maxTime > 0 && b.spent+delay > b.maxTime) {
+		exhausted = !b.exhausted
+		b.exhausted = true
+		return false, exhausted
+	}
+	b.retries++
+	b.spent += delay
+	return true, false
+}
+
+// spend adds the duration of a retried attempt
+func (b *Budget) spend(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent += d
+}
+
+// Used returns the retries taken and the time spent on them so far
+func (b *Budget) Used() (retries int, spent time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retries, b.spent
+}
+
+type budgetKey struct{}
+
+// WithBudget makes the retries of operations under ctx draw from b. A nil budget
+// leaves ctx as it is.
+func WithBudget(ctx context.Context, b *Budget) context.Context {
+	if b == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+// WithoutBudget lifts the job budget of ctx, for the result events and records that
+// must go out after the budget was used up by the failure they report
+func WithoutBudget(ctx context.Context) context.Context {
+	return context.WithValue(ctx, budgetKey{}, (*Budget)(nil))
+}
+
+// BudgetFrom returns the budget of ctx, nil without one
+func BudgetFrom(ctx context.Context) *Budget {
+	b, _ := ctx.Value(budgetKey{}).(*Budget)
+	return b
+}
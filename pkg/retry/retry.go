@@ -0,0 +1,204 @@
+// Package retry runs operations under a retry policy: a bounded number of attempts
+// with exponential backoff and jitter, and per-ErrorType overrides. It is shared by
+// storage writes, event publishing and external commands so transient failures are
+// handled the same way everywhere.
+package retry
+
+import (
+	"context"
+	stderrors "errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/histopathai/image-processing-service/pkg/config"
+	"github.com/histopathai/image-processing-service/pkg/deadline"
+	"github.com/histopathai/image-processing-service/pkg/errors"
+)
+
+// Policy bounds the attempts of an operation and the delays between them
+type Policy struct {
+	MaxAttempts int           // Attempts including the first, 1 disables retries
+	BaseDelay   time.Duration // Delay before the second attempt
+	MaxDelay    time.Duration // Upper bound of a single delay
+	Multiplier  float64       // Growth of the delay per attempt, default 2
+	Jitter      float64       // Delays vary by up to this fraction (0-1) either way
+}
+
+// DefaultPolicy is used where no configuration is available
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+}
+
+// Delay returns the wait after the given (1-based) failed attempt
+func (p Policy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 {
+		delay = math.Min(delay, float64(p.MaxDelay))
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// Retrier retries operations whose errors are retryable. A nil Retrier runs every
+// operation once.
+type Retrier struct {
+	logger    *slog.Logger
+	policy    Policy
+	byType    map[errors.ErrorType]Policy
+	retryable func(error) bool
+}
+
+// New creates a retrier with policy for every error type
+func New(logger *slog.Logger, policy Policy) *Retrier {
+	return &Retrier{
+		logger:    logger,
+		policy:    policy,
+		byType:    make(map[errors.ErrorType]Policy),
+		retryable: Retryable,
+	}
+}
+
+// FromConfig creates a retrier from the RETRY_* settings. Disk-full and quota errors
+// wait RETRY_RESOURCE_DELAY_MS before the first retry, and RETRY_ATTEMPTS_BY_TYPE
+// overrides the attempts of single error types.
+func FromConfig(logger *slog.Logger, cfg config.RetryConfig) *Retrier {
+	policy := Policy{
+		MaxAttempts: cfg.MaxAttempts,
+		BaseDelay:   cfg.BaseDelay,
+		MaxDelay:    cfg.MaxDelay,
+		Multiplier:  2,
+		Jitter:      cfg.Jitter,
+	}
+	r := New(logger, policy)
+
+	if cfg.ResourceDelay > policy.BaseDelay {
+		resourcePolicy := policy
+		resourcePolicy.BaseDelay = cfg.ResourceDelay
+		resourcePolicy.MaxDelay = max(policy.MaxDelay, 4*cfg.ResourceDelay)
+		r.SetTypePolicy(errors.ErrorTypeDiskFull, resourcePolicy)
+		r.SetTypePolicy(errors.ErrorTypeQuota, resourcePolicy)
+	}
+
+	for errType, attempts := range cfg.AttemptsByType {
+		typePolicy, ok := r.byType[errors.ErrorType(errType)]
+		if !ok {
+			typePolicy = policy
+		}
+		typePolicy.MaxAttempts = attempts
+		r.SetTypePolicy(errors.ErrorType(errType), typePolicy)
+	}
+	return r
+}
+
+// SetTypePolicy makes errors of errType follow policy instead of the default one
+func (r *Retrier) SetTypePolicy(errType errors.ErrorType, policy Policy) {
+	r.byType[errType] = policy
+}
+
+// SetRetryable replaces the check deciding which errors are retried (Retryable)
+func (r *Retrier) SetRetryable(retryable func(error) bool) {
+	r.retryable = retryable
+}
+
+// Do runs fn until it succeeds, fails with an error that is not retryable, runs out
+// of attempts or ctx is done, or the next delay would pass the deadline of ctx or
+// exceed the job Budget of ctx. It returns the error of the last attempt.
+func (r *Retrier) Do(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	if r == nil {
+		return fn(ctx)
+	}
+
+	budget := BudgetFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		err := fn(ctx)
+		if attempt > 1 && budget != nil {
+			budget.spend(time.Since(startedAt))
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !r.retryable(err) {
+			return err
+		}
+
+		policy := r.policyFor(err)
+		if attempt >= policy.MaxAttempts {
+			if policy.MaxAttempts > 1 {
+				r.logger.Warn("Giving up after retries", "op", op, "attempts", attempt, "error", err)
+			}
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+		if remaining := deadline.Remaining(ctx); remaining >= 0 && delay >= remaining {
+			r.logger.Warn("Giving up, no time left for a retry",
+				"op", op,
+				"attempts", attempt,
+				"remaining", remaining,
+				"error", err)
+			return err
+		}
+		if budget != nil {
+			ok, exhausted := budget.take(delay)
+			if !ok {
+				if exhausted {
+					retries, spent := budget.Used()
+					r.logger.Warn("Giving up, retry budget of the job exhausted",
+						"op", op,
+						"attempts", attempt,
+						"jobRetries", retries,
+						"jobRetryTime", spent.Round(time.Millisecond),
+						"error", err)
+				}
+				return err
+			}
+		}
+		r.logger.Warn("Retrying operation",
+			"op", op,
+			"attempt", attempt,
+			"maxAttempts", policy.MaxAttempts,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func (r *Retrier) policyFor(err error) Policy {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		if policy, ok := r.byType[appErr.Type]; ok {
+			return policy
+		}
+	}
+	return r.policy
+}
+
+// Retryable is the default check: errors classified as non-retryable and canceled
+// operations are not retried, everything else (storage, messaging, timeouts and
+// unclassified errors) is
+func Retryable(err error) bool {
+	if errors.Is(err, errors.ErrorTypeCancellation) || stderrors.Is(err, context.Canceled) {
+		return false
+	}
+	return !errors.IsNonRetryable(err)
+}